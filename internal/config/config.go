@@ -8,19 +8,30 @@ import (
 )
 
 type Config struct {
-	App       *AppConfig       `yaml:"app"`
-	Database  *DatabaseConfig  `yaml:"database"`
-	Redis     *RedisConfig     `yaml:"redis"`
-	SMTP      *SMTPConfig      `yaml:"smtp"`
-	SMS       *SMSConfig       `yaml:"sms"`
-	Push      *PushConfig      `yaml:"push"`
-	Payment   *PaymentConfig   `yaml:"payment"`
-	OAuth     *OAuthConfig     `yaml:"oauth"`
-	Maps      *MapsConfig      `yaml:"maps"`
-	ML        *MLConfig        `yaml:"ml"`
-	Storage   *StorageConfig   `yaml:"storage"`
-	WebSocket *WebSocketConfig `yaml:"websocket"`
-	Security  *SecurityConfig  `yaml:"security"`
+	App         *AppConfig         `yaml:"app"`
+	Database    *DatabaseConfig    `yaml:"database"`
+	Redis       *RedisConfig       `yaml:"redis"`
+	SMTP        *SMTPConfig        `yaml:"smtp"`
+	SMS         *SMSConfig         `yaml:"sms"`
+	Push        *PushConfig        `yaml:"push"`
+	Payment     *PaymentConfig     `yaml:"payment"`
+	PaymentHold *PaymentHoldConfig `yaml:"payment_hold"`
+	OAuth       *OAuthConfig       `yaml:"oauth"`
+	Maps        *MapsConfig        `yaml:"maps"`
+	ML          *MLConfig          `yaml:"ml"`
+	Storage     *StorageConfig     `yaml:"storage"`
+	WebSocket   *WebSocketConfig   `yaml:"websocket"`
+	Security    *SecurityConfig    `yaml:"security"`
+	Dispatch    *DispatchConfig    `yaml:"dispatch"`
+	Pool        *PoolConfig        `yaml:"pool"`
+	RidePIN     *RidePINConfig     `yaml:"ride_pin"`
+	Waiting     *WaitingConfig     `yaml:"waiting"`
+	Pricing     *PricingConfig     `yaml:"pricing"`
+	Surge       *SurgeConfig       `yaml:"surge"`
+	Currency    *CurrencyConfig    `yaml:"currency"`
+	RidePass    *RidePassConfig    `yaml:"ride_pass"`
+	Ledger      *LedgerConfig      `yaml:"ledger"`
+	Payout      *PayoutConfig      `yaml:"payout"`
 }
 
 type AppConfig struct {
@@ -54,19 +65,30 @@ type SecurityConfig struct {
 
 func Load() (*Config, error) {
 	config := &Config{
-		App:       loadAppConfig(),
-		Database:  loadDatabaseConfig(),
-		Redis:     loadRedisConfig(),
-		SMTP:      loadSMTPConfig(),
-		SMS:       loadSMSConfig(),
-		Push:      loadPushConfig(),
-		Payment:   loadPaymentConfig(),
-		OAuth:     loadOAuthConfig(),
-		Maps:      loadMapsConfig(),
-		ML:        loadMLConfig(),
-		Storage:   loadStorageConfig(),
-		WebSocket: loadWebSocketConfig(),
-		Security:  loadSecurityConfig(),
+		App:         loadAppConfig(),
+		Database:    loadDatabaseConfig(),
+		Redis:       loadRedisConfig(),
+		SMTP:        loadSMTPConfig(),
+		SMS:         loadSMSConfig(),
+		Push:        loadPushConfig(),
+		Payment:     loadPaymentConfig(),
+		PaymentHold: loadPaymentHoldConfig(),
+		OAuth:       loadOAuthConfig(),
+		Maps:        loadMapsConfig(),
+		ML:          loadMLConfig(),
+		Storage:     loadStorageConfig(),
+		WebSocket:   loadWebSocketConfig(),
+		Security:    loadSecurityConfig(),
+		Dispatch:    loadDispatchConfig(),
+		Pool:        loadPoolConfig(),
+		RidePIN:     loadRidePINConfig(),
+		Waiting:     loadWaitingConfig(),
+		Pricing:     loadPricingConfig(),
+		Surge:       loadSurgeConfig(),
+		Currency:    loadCurrencyConfig(),
+		RidePass:    loadRidePassConfig(),
+		Ledger:      loadLedgerConfig(),
+		Payout:      loadPayoutConfig(),
 	}
 
 	return config, nil
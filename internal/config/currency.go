@@ -0,0 +1,19 @@
+package config
+
+import "time"
+
+type CurrencyConfig struct {
+	ReportingCurrency string        `yaml:"reporting_currency"` // currency reports and rate snapshots convert into
+	RateSource        string        `yaml:"rate_source"`        // file or mongodb
+	RatesFile         string        `yaml:"rates_file"`
+	RateCacheTTL      time.Duration `yaml:"rate_cache_ttl"`
+}
+
+func loadCurrencyConfig() *CurrencyConfig {
+	return &CurrencyConfig{
+		ReportingCurrency: getEnv("REPORTING_CURRENCY", "USD"),
+		RateSource:        getEnv("EXCHANGE_RATE_SOURCE", "file"),
+		RatesFile:         getEnv("EXCHANGE_RATES_FILE", "./configs/exchange_rates.json"),
+		RateCacheTTL:      getEnvAsDuration("EXCHANGE_RATE_CACHE_TTL", time.Hour),
+	}
+}
@@ -0,0 +1,54 @@
+package config
+
+import (
+	"time"
+)
+
+type DispatchConfig struct {
+	OfferTimeout       time.Duration `yaml:"offer_timeout"`
+	InitialRadiusKM    float64       `yaml:"initial_radius_km"`
+	RadiusStepKM       float64       `yaml:"radius_step_km"`
+	MaxRadiusKM        float64       `yaml:"max_radius_km"`
+	MaxOffersPerRadius int           `yaml:"max_offers_per_radius"`
+	AverageSpeedKMH    float64       `yaml:"average_speed_kmh"`
+	ETAWeight          float64       `yaml:"eta_weight"`
+	RatingWeight       float64       `yaml:"rating_weight"`
+	AcceptanceWeight   float64       `yaml:"acceptance_weight"`
+	BatchCities        []string      `yaml:"batch_cities"`
+	BatchWindow        time.Duration `yaml:"batch_window"`
+	MinBatchSize       int           `yaml:"min_batch_size"`
+	MaxBatchDrivers    int           `yaml:"max_batch_drivers"`
+
+	// Scheduled rides
+	ScheduledCheckInterval      time.Duration `yaml:"scheduled_check_interval"`
+	ScheduledLeadTime           time.Duration `yaml:"scheduled_lead_time"`
+	ScheduledEscalationTime     time.Duration `yaml:"scheduled_escalation_time"`
+	ScheduledEscalationRadiusKM float64       `yaml:"scheduled_escalation_radius_km"`
+	ScheduledEscalationBonus    float64       `yaml:"scheduled_escalation_bonus"`
+	ScheduledNoDriverGrace      time.Duration `yaml:"scheduled_no_driver_grace"`
+}
+
+func loadDispatchConfig() *DispatchConfig {
+	return &DispatchConfig{
+		OfferTimeout:       getEnvAsDuration("DISPATCH_OFFER_TIMEOUT", 15*time.Second),
+		InitialRadiusKM:    getEnvAsFloat64("DISPATCH_INITIAL_RADIUS_KM", 3),
+		RadiusStepKM:       getEnvAsFloat64("DISPATCH_RADIUS_STEP_KM", 2),
+		MaxRadiusKM:        getEnvAsFloat64("DISPATCH_MAX_RADIUS_KM", 10),
+		MaxOffersPerRadius: getEnvAsInt("DISPATCH_MAX_OFFERS_PER_RADIUS", 5),
+		AverageSpeedKMH:    getEnvAsFloat64("DISPATCH_AVERAGE_SPEED_KMH", 30),
+		ETAWeight:          getEnvAsFloat64("DISPATCH_ETA_WEIGHT", 0.5),
+		RatingWeight:       getEnvAsFloat64("DISPATCH_RATING_WEIGHT", 0.3),
+		AcceptanceWeight:   getEnvAsFloat64("DISPATCH_ACCEPTANCE_WEIGHT", 0.2),
+		BatchCities:        getEnvAsSlice("DISPATCH_BATCH_CITIES", []string{}),
+		BatchWindow:        getEnvAsDuration("DISPATCH_BATCH_WINDOW", 2*time.Second),
+		MinBatchSize:       getEnvAsInt("DISPATCH_MIN_BATCH_SIZE", 3),
+		MaxBatchDrivers:    getEnvAsInt("DISPATCH_MAX_BATCH_DRIVERS", 500),
+
+		ScheduledCheckInterval:      getEnvAsDuration("DISPATCH_SCHEDULED_CHECK_INTERVAL", time.Minute),
+		ScheduledLeadTime:           getEnvAsDuration("DISPATCH_SCHEDULED_LEAD_TIME", 20*time.Minute),
+		ScheduledEscalationTime:     getEnvAsDuration("DISPATCH_SCHEDULED_ESCALATION_TIME", 5*time.Minute),
+		ScheduledEscalationRadiusKM: getEnvAsFloat64("DISPATCH_SCHEDULED_ESCALATION_RADIUS_KM", 15),
+		ScheduledEscalationBonus:    getEnvAsFloat64("DISPATCH_SCHEDULED_ESCALATION_BONUS", 2),
+		ScheduledNoDriverGrace:      getEnvAsDuration("DISPATCH_SCHEDULED_NO_DRIVER_GRACE", 5*time.Minute),
+	}
+}
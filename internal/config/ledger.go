@@ -0,0 +1,13 @@
+package config
+
+import "time"
+
+type LedgerConfig struct {
+	CheckInterval time.Duration `yaml:"check_interval"` // how often the ledger is proven to sum to zero
+}
+
+func loadLedgerConfig() *LedgerConfig {
+	return &LedgerConfig{
+		CheckInterval: getEnvAsDuration("LEDGER_CHECK_INTERVAL", 24*time.Hour),
+	}
+}
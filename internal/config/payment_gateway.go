@@ -1,5 +1,7 @@
 package config
 
+import "time"
+
 type PaymentConfig struct {
 	DefaultProvider string          `yaml:"default_provider"`
 	Stripe          *StripeConfig   `yaml:"stripe"`
@@ -7,6 +9,34 @@ type PaymentConfig struct {
 	Razorpay        *RazorpayConfig `yaml:"razorpay"`
 	Currency        string          `yaml:"currency"`
 	CommissionRate  float64         `yaml:"commission_rate"`
+	Retry           *RetryConfig    `yaml:"retry"`
+	Recovery        *RecoveryConfig `yaml:"recovery"`
+	Webhook         *WebhookConfig  `yaml:"webhook"`
+}
+
+// RetryConfig is the backoff for transient provider failures.
+type RetryConfig struct {
+	MaxAttempts int           `yaml:"max_attempts"` // including the first
+	BaseDelay   time.Duration `yaml:"base_delay"`
+	MaxDelay    time.Duration `yaml:"max_delay"`
+}
+
+// RecoveryConfig drives the job settling payments left pending when the
+// provider's answer was lost.
+type RecoveryConfig struct {
+	Interval      time.Duration `yaml:"interval"`
+	Delay         time.Duration `yaml:"delay"`           // age before a pending payment is looked up
+	NotFoundAfter time.Duration `yaml:"not_found_after"` // age after which a payment the provider never saw is failed
+}
+
+// WebhookConfig drives the processing of stored provider webhooks. An event
+// that keeps failing is retried with backoff until it runs out of attempts
+// and waits for an admin to replay it.
+type WebhookConfig struct {
+	PollInterval time.Duration `yaml:"poll_interval"`
+	MaxAttempts  int           `yaml:"max_attempts"`
+	BaseDelay    time.Duration `yaml:"base_delay"`
+	MaxDelay     time.Duration `yaml:"max_delay"`
 }
 
 type StripeConfig struct {
@@ -51,5 +81,21 @@ func loadPaymentConfig() *PaymentConfig {
 		},
 		Currency:       getEnv("PAYMENT_CURRENCY", "USD"),
 		CommissionRate: getEnvAsFloat64("PAYMENT_COMMISSION_RATE", 0.05), // 5%
+		Retry: &RetryConfig{
+			MaxAttempts: getEnvAsInt("PAYMENT_RETRY_MAX_ATTEMPTS", 4),
+			BaseDelay:   getEnvAsDuration("PAYMENT_RETRY_BASE_DELAY", 250*time.Millisecond),
+			MaxDelay:    getEnvAsDuration("PAYMENT_RETRY_MAX_DELAY", 5*time.Second),
+		},
+		Recovery: &RecoveryConfig{
+			Interval:      getEnvAsDuration("PAYMENT_RECOVERY_INTERVAL", 5*time.Minute),
+			Delay:         getEnvAsDuration("PAYMENT_RECOVERY_DELAY", 10*time.Minute),
+			NotFoundAfter: getEnvAsDuration("PAYMENT_RECOVERY_NOT_FOUND_AFTER", 6*time.Hour),
+		},
+		Webhook: &WebhookConfig{
+			PollInterval: getEnvAsDuration("PAYMENT_WEBHOOK_POLL_INTERVAL", 5*time.Second),
+			MaxAttempts:  getEnvAsInt("PAYMENT_WEBHOOK_MAX_ATTEMPTS", 8),
+			BaseDelay:    getEnvAsDuration("PAYMENT_WEBHOOK_BASE_DELAY", 30*time.Second),
+			MaxDelay:     getEnvAsDuration("PAYMENT_WEBHOOK_MAX_DELAY", time.Hour),
+		},
 	}
 }
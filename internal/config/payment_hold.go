@@ -0,0 +1,19 @@
+package config
+
+import "time"
+
+type PaymentHoldConfig struct {
+	BufferPercent float64       `yaml:"buffer_percent"` // held on top of the estimated fare
+	CheckInterval time.Duration `yaml:"check_interval"` // how often open holds are swept
+	GracePeriod   time.Duration `yaml:"grace_period"`   // age before the sweep looks at a hold
+	MaxAge        time.Duration `yaml:"max_age"`        // released before the card network lets them lapse
+}
+
+func loadPaymentHoldConfig() *PaymentHoldConfig {
+	return &PaymentHoldConfig{
+		BufferPercent: getEnvAsFloat64("PAYMENT_HOLD_BUFFER_PERCENT", 20),
+		CheckInterval: getEnvAsDuration("PAYMENT_HOLD_CHECK_INTERVAL", 15*time.Minute),
+		GracePeriod:   getEnvAsDuration("PAYMENT_HOLD_GRACE_PERIOD", 10*time.Minute),
+		MaxAge:        getEnvAsDuration("PAYMENT_HOLD_MAX_AGE", 6*24*time.Hour),
+	}
+}
@@ -0,0 +1,39 @@
+package config
+
+import "time"
+
+type PayoutConfig struct {
+	Schedule          time.Duration `yaml:"schedule"`            // length of a scheduled payout period
+	CheckInterval     time.Duration `yaml:"check_interval"`      // how often due batches run and payouts are tracked
+	ReturnWindow      time.Duration `yaml:"return_window"`       // how long a sent payout is watched for a bank return
+	Directory         string        `yaml:"directory"`           // where the file payout provider writes payouts
+	Currency          string        `yaml:"currency"`            // of the amounts below
+	MinimumAmount     float64       `yaml:"minimum_amount"`      // smallest balance paid out in a batch
+	InstantFeePercent float64       `yaml:"instant_fee_percent"` // of the amount cashed out
+	InstantFeeMinimum float64       `yaml:"instant_fee_minimum"`
+	InstantMinimum    float64       `yaml:"instant_minimum"`
+	InstantDailyLimit float64       `yaml:"instant_daily_limit"` // per driver, fees included
+	InstantDailyCount int           `yaml:"instant_daily_count"` // cash-outs per driver per day
+	InstantMinAge     time.Duration `yaml:"instant_min_age"`     // time since driver approval before cashing out
+	InstantMinRides   int64         `yaml:"instant_min_rides"`
+	InstantMaxShare   float64       `yaml:"instant_max_share"` // percent of the balance earned in the last day that can be cashed out
+}
+
+func loadPayoutConfig() *PayoutConfig {
+	return &PayoutConfig{
+		Schedule:          getEnvAsDuration("PAYOUT_SCHEDULE", 7*24*time.Hour),
+		CheckInterval:     getEnvAsDuration("PAYOUT_CHECK_INTERVAL", time.Hour),
+		ReturnWindow:      getEnvAsDuration("PAYOUT_RETURN_WINDOW", 5*24*time.Hour),
+		Directory:         getEnv("PAYOUT_DIRECTORY", "./payouts"),
+		Currency:          getEnv("PAYOUT_CURRENCY", "USD"),
+		MinimumAmount:     getEnvAsFloat64("PAYOUT_MINIMUM_AMOUNT", 1),
+		InstantFeePercent: getEnvAsFloat64("PAYOUT_INSTANT_FEE_PERCENT", 1.5),
+		InstantFeeMinimum: getEnvAsFloat64("PAYOUT_INSTANT_FEE_MINIMUM", 0.5),
+		InstantMinimum:    getEnvAsFloat64("PAYOUT_INSTANT_MINIMUM", 5),
+		InstantDailyLimit: getEnvAsFloat64("PAYOUT_INSTANT_DAILY_LIMIT", 500),
+		InstantDailyCount: getEnvAsInt("PAYOUT_INSTANT_DAILY_COUNT", 3),
+		InstantMinAge:     getEnvAsDuration("PAYOUT_INSTANT_MIN_AGE", 7*24*time.Hour),
+		InstantMinRides:   int64(getEnvAsInt("PAYOUT_INSTANT_MIN_RIDES", 10)),
+		InstantMaxShare:   getEnvAsFloat64("PAYOUT_INSTANT_MAX_SHARE", 80),
+	}
+}
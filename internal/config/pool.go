@@ -0,0 +1,23 @@
+package config
+
+import "time"
+
+type PoolConfig struct {
+	SearchRadiusKM     float64       `yaml:"search_radius_km"`
+	MaxDetourMinutes   float64       `yaml:"max_detour_minutes"`
+	MaxDetourPercent   float64       `yaml:"max_detour_percent"`
+	AverageSpeedKMH    float64       `yaml:"average_speed_kmh"`
+	RoadFactor         float64       `yaml:"road_factor"`         // road distance over straight-line distance
+	SettlementInterval time.Duration `yaml:"settlement_interval"` // how often unsettled pools are charged again
+}
+
+func loadPoolConfig() *PoolConfig {
+	return &PoolConfig{
+		SearchRadiusKM:     getEnvAsFloat64("POOL_SEARCH_RADIUS_KM", 3),
+		MaxDetourMinutes:   getEnvAsFloat64("POOL_MAX_DETOUR_MINUTES", 10),
+		MaxDetourPercent:   getEnvAsFloat64("POOL_MAX_DETOUR_PERCENT", 50),
+		AverageSpeedKMH:    getEnvAsFloat64("POOL_AVERAGE_SPEED_KMH", 25),
+		RoadFactor:         getEnvAsFloat64("POOL_ROAD_FACTOR", 1.3),
+		SettlementInterval: getEnvAsDuration("POOL_SETTLEMENT_INTERVAL", 5*time.Minute),
+	}
+}
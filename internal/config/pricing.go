@@ -0,0 +1,23 @@
+package config
+
+import "time"
+
+type PricingConfig struct {
+	QuoteSecret          string        `yaml:"quote_secret"`
+	QuoteTTL             time.Duration `yaml:"quote_ttl"`
+	MaxDistanceDeviation float64       `yaml:"max_distance_deviation"` // percent over the quoted distance
+	MaxDurationDeviation float64       `yaml:"max_duration_deviation"` // percent over the quoted duration
+	TaxRate              float64       `yaml:"tax_rate"`               // percent, exclusive, used where no tax rule applies
+	PlatformCommission   float64       `yaml:"platform_commission"`    // percent of the driver's fare
+}
+
+func loadPricingConfig() *PricingConfig {
+	return &PricingConfig{
+		QuoteSecret:          getEnv("FARE_QUOTE_SECRET", "your-fare-quote-secret"),
+		QuoteTTL:             getEnvAsDuration("FARE_QUOTE_TTL", 5*time.Minute),
+		MaxDistanceDeviation: getEnvAsFloat64("FARE_MAX_DISTANCE_DEVIATION", 25),
+		MaxDurationDeviation: getEnvAsFloat64("FARE_MAX_DURATION_DEVIATION", 50),
+		TaxRate:              getEnvAsFloat64("FARE_TAX_RATE", 0),
+		PlatformCommission:   getEnvAsFloat64("FARE_PLATFORM_COMMISSION", 20),
+	}
+}
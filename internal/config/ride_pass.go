@@ -0,0 +1,17 @@
+package config
+
+import "time"
+
+type RidePassConfig struct {
+	RenewalInterval time.Duration `yaml:"renewal_interval"` // how often due subscriptions are billed
+	RetryInterval   time.Duration `yaml:"retry_interval"`   // wait between attempts on a past due subscription
+	RenewalBatch    int           `yaml:"renewal_batch"`
+}
+
+func loadRidePassConfig() *RidePassConfig {
+	return &RidePassConfig{
+		RenewalInterval: getEnvAsDuration("RIDE_PASS_RENEWAL_INTERVAL", 15*time.Minute),
+		RetryInterval:   getEnvAsDuration("RIDE_PASS_RETRY_INTERVAL", 24*time.Hour),
+		RenewalBatch:    getEnvAsInt("RIDE_PASS_RENEWAL_BATCH", 100),
+	}
+}
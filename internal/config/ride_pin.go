@@ -0,0 +1,27 @@
+package config
+
+import "time"
+
+type RidePINConfig struct {
+	Length               int           `yaml:"length"`
+	EnforceAlways        bool          `yaml:"enforce_always"`
+	MaxAttempts          int           `yaml:"max_attempts"` // per attempt window
+	AttemptWindow        time.Duration `yaml:"attempt_window"`
+	SafetyEventThreshold int           `yaml:"safety_event_threshold"` // failed attempts per ride
+	NightStartHour       int           `yaml:"night_start_hour"`
+	NightEndHour         int           `yaml:"night_end_hour"`
+	NightTimezone        string        `yaml:"night_timezone"`
+}
+
+func loadRidePINConfig() *RidePINConfig {
+	return &RidePINConfig{
+		Length:               getEnvAsInt("RIDE_PIN_LENGTH", 4),
+		EnforceAlways:        getEnvAsBool("RIDE_PIN_ENFORCE_ALWAYS", false),
+		MaxAttempts:          getEnvAsInt("RIDE_PIN_MAX_ATTEMPTS", 3),
+		AttemptWindow:        getEnvAsDuration("RIDE_PIN_ATTEMPT_WINDOW", 5*time.Minute),
+		SafetyEventThreshold: getEnvAsInt("RIDE_PIN_SAFETY_EVENT_THRESHOLD", 5),
+		NightStartHour:       getEnvAsInt("RIDE_PIN_NIGHT_START_HOUR", 22),
+		NightEndHour:         getEnvAsInt("RIDE_PIN_NIGHT_END_HOUR", 6),
+		NightTimezone:        getEnv("RIDE_PIN_NIGHT_TIMEZONE", "UTC"),
+	}
+}
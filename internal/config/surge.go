@@ -0,0 +1,59 @@
+package config
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SurgeCurvePoint maps a demand/supply ratio to a surge multiplier. The engine
+// interpolates linearly between points.
+type SurgeCurvePoint struct {
+	Ratio      float64 `yaml:"ratio"`
+	Multiplier float64 `yaml:"multiplier"`
+}
+
+type SurgeConfig struct {
+	UpdateInterval time.Duration     `yaml:"update_interval"`
+	Curve          []SurgeCurvePoint `yaml:"curve"`
+	Smoothing      float64           `yaml:"smoothing"` // weight of the newest target, 0-1
+	MaxMultiplier  float64           `yaml:"max_multiplier"`
+	Step           float64           `yaml:"step"`
+	MinDwell       time.Duration     `yaml:"min_dwell"` // minimum time a multiplier holds before it can change
+	MaxOverride    time.Duration     `yaml:"max_override"`
+}
+
+func loadSurgeConfig() *SurgeConfig {
+	return &SurgeConfig{
+		UpdateInterval: getEnvAsDuration("SURGE_UPDATE_INTERVAL", 2*time.Minute),
+		Curve:          parseSurgeCurve(getEnvAsSlice("SURGE_CURVE", []string{"1:1", "1.5:1.2", "2:1.5", "3:2", "5:3"})),
+		Smoothing:      getEnvAsFloat64("SURGE_SMOOTHING", 0.5),
+		MaxMultiplier:  getEnvAsFloat64("SURGE_MAX_MULTIPLIER", 3),
+		Step:           getEnvAsFloat64("SURGE_STEP", 0.1),
+		MinDwell:       getEnvAsDuration("SURGE_MIN_DWELL", 10*time.Minute),
+		MaxOverride:    getEnvAsDuration("SURGE_MAX_OVERRIDE", 12*time.Hour),
+	}
+}
+
+// parseSurgeCurve reads "ratio:multiplier" pairs, skipping malformed entries.
+func parseSurgeCurve(values []string) []SurgeCurvePoint {
+	var curve []SurgeCurvePoint
+	for _, value := range values {
+		ratio, multiplier, found := strings.Cut(strings.TrimSpace(value), ":")
+		if !found {
+			continue
+		}
+
+		r, err := strconv.ParseFloat(ratio, 64)
+		if err != nil {
+			continue
+		}
+		m, err := strconv.ParseFloat(multiplier, 64)
+		if err != nil {
+			continue
+		}
+
+		curve = append(curve, SurgeCurvePoint{Ratio: r, Multiplier: m})
+	}
+	return curve
+}
@@ -0,0 +1,15 @@
+package config
+
+import "time"
+
+type WaitingConfig struct {
+	NoShowWaitTime      time.Duration `yaml:"no_show_wait_time"` // measured from driver arrival
+	NoShowMaxDistanceKM float64       `yaml:"no_show_max_distance_km"`
+}
+
+func loadWaitingConfig() *WaitingConfig {
+	return &WaitingConfig{
+		NoShowWaitTime:      getEnvAsDuration("NO_SHOW_WAIT_TIME", 10*time.Minute),
+		NoShowMaxDistanceKM: getEnvAsFloat64("NO_SHOW_MAX_DISTANCE_KM", 0.2),
+	}
+}
@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"net/http"
+
+	"goride/internal/models"
+	"goride/internal/services"
+	"goride/internal/utils"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// maxPaymentWebhookSize bounds the payload read from a webhook request.
+const maxPaymentWebhookSize = 1 << 20
+
+type PaymentWebhookHandler struct {
+	webhookService services.PaymentWebhookService
+}
+
+func NewPaymentWebhookHandler(webhookService services.PaymentWebhookService) *PaymentWebhookHandler {
+	return &PaymentWebhookHandler{
+		webhookService: webhookService,
+	}
+}
+
+// HandlePaymentWebhook verifies a payment provider's webhook and stores it
+// for processing. Processing happens later, so the provider is answered as
+// soon as the event is stored.
+func (h *PaymentWebhookHandler) HandlePaymentWebhook(c *gin.Context) {
+	payload, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxPaymentWebhookSize))
+	if err != nil {
+		utils.BadRequestResponse(c, "Invalid webhook data")
+		return
+	}
+
+	event, err := h.webhookService.ReceiveEvent(c.Request.Context(), c.Param("provider"), payload, c.Request.Header)
+	switch {
+	case errors.Is(err, services.ErrUnknownPaymentProvider):
+		utils.NotFoundResponse(c, "Payment provider")
+		return
+	case errors.Is(err, services.ErrInvalidPaymentWebhook):
+		utils.BadRequestResponse(c, "Invalid webhook signature or payload")
+		return
+	case err != nil:
+		utils.ErrorResponse(c, http.StatusInternalServerError, "WEBHOOK_FAILED", "Failed to handle webhook: "+err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "success", "event_id": event.EventID})
+}
+
+// GetWebhookEvents lists stored payment webhooks in a status, failed ones by
+// default
+func (h *PaymentWebhookHandler) GetWebhookEvents(c *gin.Context) {
+	status := models.PaymentWebhookStatus(c.DefaultQuery("status", string(models.PaymentWebhookStatusFailed)))
+
+	params := utils.GetPaginationParams(c)
+	events, total, err := h.webhookService.GetEvents(c.Request.Context(), status, params)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "WEBHOOK_EVENTS_FETCH_FAILED", "Failed to get webhook events: "+err.Error())
+		return
+	}
+
+	meta := &utils.Meta{
+		Pagination: utils.CreatePaginationMeta(params, total),
+	}
+
+	response := map[string]interface{}{
+		"events": events,
+	}
+
+	utils.SuccessResponseWithMeta(c, "Webhook events retrieved successfully", response, meta)
+}
+
+// GetWebhookEvent retrieves a stored payment webhook with its payload
+func (h *PaymentWebhookHandler) GetWebhookEvent(c *gin.Context) {
+	eventID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		utils.BadRequestResponse(c, "Invalid webhook event ID")
+		return
+	}
+
+	event, err := h.webhookService.GetEvent(c.Request.Context(), eventID)
+	if err != nil {
+		utils.NotFoundResponse(c, "Webhook event")
+		return
+	}
+
+	utils.SuccessResponse(c, "Webhook event retrieved successfully", event)
+}
+
+// ReplayWebhookEvent queues a stored payment webhook to be processed again
+func (h *PaymentWebhookHandler) ReplayWebhookEvent(c *gin.Context) {
+	eventID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		utils.BadRequestResponse(c, "Invalid webhook event ID")
+		return
+	}
+
+	adminID, exists := c.Get("user_id")
+	if !exists {
+		utils.UnauthorizedResponse(c)
+		return
+	}
+
+	adminObjectID, ok := adminID.(primitive.ObjectID)
+	if !ok {
+		utils.BadRequestResponse(c, "Invalid user ID")
+		return
+	}
+
+	event, err := h.webhookService.ReplayEvent(c.Request.Context(), eventID, adminObjectID)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "WEBHOOK_REPLAY_FAILED", "Failed to replay webhook event: "+err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, "Webhook event queued for replay", event)
+}
@@ -24,6 +24,7 @@ type RideAnalytics struct {
 	ID                 primitive.ObjectID `json:"id" bson:"_id,omitempty"`
 	Date               time.Time          `json:"date" bson:"date"`
 	City               string             `json:"city" bson:"city"`
+	CellID             string             `json:"cell_id,omitempty" bson:"cell_id,omitempty"` // set on per-cell rollups, empty for the whole city
 	TotalRides         int64              `json:"total_rides" bson:"total_rides"`
 	CompletedRides     int64              `json:"completed_rides" bson:"completed_rides"`
 	CancelledRides     int64              `json:"cancelled_rides" bson:"cancelled_rides"`
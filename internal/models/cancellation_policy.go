@@ -0,0 +1,27 @@
+package models
+
+import (
+	"time"
+
+	"goride/pkg/money"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// CancellationPolicy holds the cancellation rules for a city and ride type. An
+// empty City or RideType acts as a fallback for any value.
+type CancellationPolicy struct {
+	ID                          primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	City                        string             `json:"city" bson:"city"`
+	RideType                    RideType           `json:"ride_type" bson:"ride_type"`
+	RiderFreeWindowAfterBooking int                `json:"rider_free_window_after_booking" bson:"rider_free_window_after_booking"` // minutes
+	RiderFreeWindowAfterAccept  int                `json:"rider_free_window_after_accept" bson:"rider_free_window_after_accept"`   // minutes
+	RiderFee                    money.Money        `json:"rider_fee" bson:"rider_fee"`                                             // falls back to FareStructure.CancellationFee
+	ETAIncreaseWaiver           int                `json:"eta_increase_waiver" bson:"eta_increase_waiver"`                         // minutes, 0 disables
+	HonorLoyaltyFlex            bool               `json:"honor_loyalty_flex" bson:"honor_loyalty_flex" default:"true"`
+	DriverFreeWindowAfterAccept int                `json:"driver_free_window_after_accept" bson:"driver_free_window_after_accept"` // minutes
+	DriverPenalty               money.Money        `json:"driver_penalty" bson:"driver_penalty"`
+	IsActive                    bool               `json:"is_active" bson:"is_active" default:"true"`
+	CreatedAt                   time.Time          `json:"created_at" bson:"created_at"`
+	UpdatedAt                   time.Time          `json:"updated_at" bson:"updated_at"`
+}
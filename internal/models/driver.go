@@ -46,6 +46,7 @@ type Driver struct {
 	OnlineHours           float64              `json:"online_hours" bson:"online_hours" default:"0"`
 	AcceptanceRate        float64              `json:"acceptance_rate" bson:"acceptance_rate" default:"0"`
 	CancellationRate      float64              `json:"cancellation_rate" bson:"cancellation_rate" default:"0"`
+	TotalCancellations    int64                `json:"total_cancellations" bson:"total_cancellations" default:"0"`
 	CompletionRate        float64              `json:"completion_rate" bson:"completion_rate" default:"0"`
 	IsAvailable           bool                 `json:"is_available" bson:"is_available" default:"false"`
 	VehicleIDs            []primitive.ObjectID `json:"vehicle_ids" bson:"vehicle_ids"`
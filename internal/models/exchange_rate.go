@@ -0,0 +1,21 @@
+package models
+
+import (
+	"time"
+
+	"goride/pkg/money"
+)
+
+// ExchangeRate is the rate captured when money is charged in one currency and
+// reported in another. Refunds and reports reuse it instead of today's rate.
+type ExchangeRate struct {
+	From   string    `json:"from" bson:"from"`
+	To     string    `json:"to" bson:"to"`
+	Rate   float64   `json:"rate" bson:"rate"` // units of To per unit of From
+	Source string    `json:"source" bson:"source"`
+	AsOf   time.Time `json:"as_of" bson:"as_of"`
+}
+
+func (r *ExchangeRate) Convert(amount money.Money) money.Money {
+	return amount.Convert(r.Rate, r.To)
+}
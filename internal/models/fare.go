@@ -3,25 +3,151 @@ package models
 import (
 	"time"
 
+	"goride/pkg/money"
+
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 type FareStructure struct {
-	ID               primitive.ObjectID `json:"id" bson:"_id,omitempty"`
-	City             string             `json:"city" bson:"city" validate:"required"`
-	RideType         RideType           `json:"ride_type" bson:"ride_type" validate:"required"`
-	BaseFare         float64            `json:"base_fare" bson:"base_fare" validate:"required"`
-	PricePerKM       float64            `json:"price_per_km" bson:"price_per_km" validate:"required"`
-	PricePerMinute   float64            `json:"price_per_minute" bson:"price_per_minute" validate:"required"`
-	MinimumFare      float64            `json:"minimum_fare" bson:"minimum_fare" validate:"required"`
-	MaximumFare      float64            `json:"maximum_fare" bson:"maximum_fare"`
-	BookingFee       float64            `json:"booking_fee" bson:"booking_fee" default:"0"`
-	CancellationFee  float64            `json:"cancellation_fee" bson:"cancellation_fee" default:"0"`
-	WaitingTimeRate  float64            `json:"waiting_time_rate" bson:"waiting_time_rate" default:"0"`
-	FreeWaitingTime  int                `json:"free_waiting_time" bson:"free_waiting_time" default:"5"` // minutes
-	Currency         string             `json:"currency" bson:"currency" default:"USD"`
-	IsActive         bool               `json:"is_active" bson:"is_active" default:"true"`
-	EffectiveFrom    time.Time          `json:"effective_from" bson:"effective_from"`
-	EffectiveUntil   *time.Time         `json:"effective_until" bson:"effective_until"`
-	CreatedAt        time.Time          `json:"created_at" bson:"created_at"`
-	UpdatedAt        time.Time          `json:"updated_at" bson:"updated_at"`
-}
\ No newline at end of file
+	ID              primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	City            string             `json:"city" bson:"city" validate:"required"`
+	RideType        RideType           `json:"ride_type" bson:"ride_type" validate:"required"`
+	BaseFare        money.Money        `json:"base_fare" bson:"base_fare" validate:"required"`
+	PricePerKM      float64            `json:"price_per_km" bson:"price_per_km" validate:"required"`         // major units per kilometer, may be finer than the minor unit
+	PricePerMinute  float64            `json:"price_per_minute" bson:"price_per_minute" validate:"required"` // major units per minute
+	MinimumFare     money.Money        `json:"minimum_fare" bson:"minimum_fare" validate:"required"`
+	MaximumFare     money.Money        `json:"maximum_fare" bson:"maximum_fare"`
+	BookingFee      money.Money        `json:"booking_fee" bson:"booking_fee" default:"0"`
+	CancellationFee money.Money        `json:"cancellation_fee" bson:"cancellation_fee" default:"0"`
+	WaitingTimeRate float64            `json:"waiting_time_rate" bson:"waiting_time_rate" default:"0"` // major units per minute
+	FreeWaitingTime int                `json:"free_waiting_time" bson:"free_waiting_time" default:"5"` // minutes
+	Currency        string             `json:"currency" bson:"currency" default:"USD"`
+	IsActive        bool               `json:"is_active" bson:"is_active" default:"true"`
+	EffectiveFrom   time.Time          `json:"effective_from" bson:"effective_from"`
+	EffectiveUntil  *time.Time         `json:"effective_until" bson:"effective_until"`
+	CreatedAt       time.Time          `json:"created_at" bson:"created_at"`
+	UpdatedAt       time.Time          `json:"updated_at" bson:"updated_at"`
+}
+type FareReconciliationDecision string
+
+const (
+	FareDecisionLocked   FareReconciliationDecision = "locked"
+	FareDecisionRepriced FareReconciliationDecision = "repriced"
+)
+
+// FareQuote is the upfront price offered to a rider before booking. Once locked
+// onto a ride it is the price charged unless reconciliation re-prices the trip.
+type FareQuote struct {
+	QuoteID         string                       `json:"quote_id" bson:"quote_id"`
+	RiderID         primitive.ObjectID           `json:"rider_id" bson:"rider_id"`
+	RideType        RideType                     `json:"ride_type" bson:"ride_type"`
+	PickupLocation  Location                     `json:"pickup_location" bson:"pickup_location"`
+	DropoffLocation Location                     `json:"dropoff_location" bson:"dropoff_location"`
+	Waypoints       []Location                   `json:"waypoints" bson:"waypoints"`
+	Distance        float64                      `json:"distance" bson:"distance"` // kilometers
+	Duration        int                          `json:"duration" bson:"duration"` // minutes
+	Fare            money.Money                  `json:"fare" bson:"fare"`
+	SurgeMultiplier float64                      `json:"surge_multiplier" bson:"surge_multiplier"`
+	Currency        string                       `json:"currency" bson:"currency"`
+	FareStructureID primitive.ObjectID           `json:"fare_structure_id" bson:"fare_structure_id"`
+	EncodedPolyline string                       `json:"encoded_polyline" bson:"encoded_polyline"` // planned route the quote was priced over
+	CreatedAt       time.Time                    `json:"created_at" bson:"created_at"`
+	ExpiresAt       time.Time                    `json:"expires_at" bson:"expires_at"`
+	LockedAt        *time.Time                   `json:"locked_at" bson:"locked_at"`
+	Breakdown       *FareBreakdown               `json:"breakdown" bson:"breakdown"`
+	Experiment      *PricingExperimentAssignment `json:"experiment" bson:"experiment"` // pricing experiment arm the quote was priced under
+}
+
+// FareReconciliation records how the charged fare was decided at completion.
+type FareReconciliation struct {
+	Decision          FareReconciliationDecision `json:"decision" bson:"decision"`
+	Reason            string                     `json:"reason" bson:"reason"`
+	QuotedFare        money.Money                `json:"quoted_fare" bson:"quoted_fare"`
+	QuotedDistance    float64                    `json:"quoted_distance" bson:"quoted_distance"`
+	QuotedDuration    int                        `json:"quoted_duration" bson:"quoted_duration"`
+	ActualDistance    float64                    `json:"actual_distance" bson:"actual_distance"`
+	ActualDuration    int                        `json:"actual_duration" bson:"actual_duration"`
+	DistanceDeviation float64                    `json:"distance_deviation" bson:"distance_deviation"` // percent
+	DurationDeviation float64                    `json:"duration_deviation" bson:"duration_deviation"` // percent
+	MeteredFare       money.Money                `json:"metered_fare" bson:"metered_fare"`
+	WaitingCharge     money.Money                `json:"waiting_charge" bson:"waiting_charge"`
+	ChargedFare       money.Money                `json:"charged_fare" bson:"charged_fare"`
+	ReconciledAt      time.Time                  `json:"reconciled_at" bson:"reconciled_at"`
+}
+
+// FareBreakdown itemizes a fare. Estimates, quotes and receipts are all built
+// from it so that every part of the system prices a trip the same way.
+type FareBreakdown struct {
+	FareStructureID primitive.ObjectID  `json:"fare_structure_id" bson:"fare_structure_id"`
+	City            string              `json:"city" bson:"city"`
+	RideType        RideType            `json:"ride_type" bson:"ride_type"`
+	Currency        string              `json:"currency" bson:"currency"`
+	Distance        float64             `json:"distance" bson:"distance"` // kilometers
+	Duration        int                 `json:"duration" bson:"duration"` // minutes
+	BaseFare        money.Money         `json:"base_fare" bson:"base_fare"`
+	DistanceFare    money.Money         `json:"distance_fare" bson:"distance_fare"`
+	TimeFare        money.Money         `json:"time_fare" bson:"time_fare"`
+	BookingFee      money.Money         `json:"booking_fee" bson:"booking_fee"`
+	SurgeMultiplier float64             `json:"surge_multiplier" bson:"surge_multiplier"`
+	SurgeAmount     money.Money         `json:"surge_amount" bson:"surge_amount"`
+	FareAdjustment  money.Money         `json:"fare_adjustment" bson:"fare_adjustment"` // brings the fare within the minimum and maximum
+	FixedFare       money.Money         `json:"fixed_fare" bson:"fixed_fare"`           // flat fare of a fixed route, replaces the metered lines
+	FixedFareRuleID *primitive.ObjectID `json:"fixed_fare_rule_id" bson:"fixed_fare_rule_id"`
+	WaitingTime     int                 `json:"waiting_time" bson:"waiting_time"` // billable minutes
+	WaitingCharge   money.Money         `json:"waiting_charge" bson:"waiting_charge"`
+	TollAmount      money.Money         `json:"toll_amount" bson:"toll_amount"`
+	Surcharges      []FareSurcharge     `json:"surcharges" bson:"surcharges"`
+	SurchargeAmount money.Money         `json:"surcharge_amount" bson:"surcharge_amount"`
+	Subtotal        money.Money         `json:"subtotal" bson:"subtotal"`
+	PromoCode       string              `json:"promo_code" bson:"promo_code"`
+	DiscountAmount  money.Money         `json:"discount_amount" bson:"discount_amount"`
+	RidePassID      *primitive.ObjectID `json:"ride_pass_id" bson:"ride_pass_id"`   // subscription whose benefits were applied
+	PassDiscount    money.Money         `json:"pass_discount" bson:"pass_discount"` // surge cap, booking fee waiver and pass discount together
+	TaxRate         float64             `json:"tax_rate" bson:"tax_rate"`           // percent, combined rate on the ride fare
+	TaxAmount       money.Money         `json:"tax_amount" bson:"tax_amount"`       // inclusive and exclusive tax
+	TaxIncluded     money.Money         `json:"tax_included" bson:"tax_included"`   // part of TaxAmount already contained in the fare lines
+	TaxLines        []TaxLine           `json:"tax_lines" bson:"tax_lines"`
+	Total           money.Money         `json:"total" bson:"total"`
+	PlatformFee     money.Money         `json:"platform_fee" bson:"platform_fee"`
+	DriverEarnings  money.Money         `json:"driver_earnings" bson:"driver_earnings"`
+	CalculatedAt    time.Time           `json:"calculated_at" bson:"calculated_at"`
+}
+
+// ApplyToPayment copies the breakdown onto a payment. Payment has no separate
+// lines for the booking fee, fare adjustment, fixed fare, waiting or tolls, so
+// they are folded into the base, time and distance fares respectively.
+// Surcharges keep their own lines and the pass discount is folded into the
+// discount.
+func (b *FareBreakdown) ApplyToPayment(payment *Payment) error {
+	baseFare, err := money.Sum(b.BaseFare, b.BookingFee, b.FareAdjustment, b.FixedFare)
+	if err != nil {
+		return err
+	}
+	distanceFare, err := b.DistanceFare.Add(b.TollAmount)
+	if err != nil {
+		return err
+	}
+	timeFare, err := b.TimeFare.Add(b.WaitingCharge)
+	if err != nil {
+		return err
+	}
+	discount, err := b.DiscountAmount.Add(b.PassDiscount)
+	if err != nil {
+		return err
+	}
+
+	payment.Amount = b.Total
+	payment.Currency = b.Currency
+	payment.BaseFare = baseFare
+	payment.DistanceFare = distanceFare
+	payment.TimeFare = timeFare
+	payment.SurgeAmount = b.SurgeAmount
+	payment.Surcharges = b.Surcharges
+	payment.SurchargeAmount = b.SurchargeAmount
+	payment.TaxAmount = b.TaxAmount
+	payment.TaxLines = b.TaxLines
+	payment.DiscountAmount = discount
+	payment.PlatformFee = b.PlatformFee
+	payment.DriverEarnings = b.DriverEarnings
+	payment.PromoCode = b.PromoCode
+	return nil
+}
@@ -0,0 +1,93 @@
+package models
+
+import (
+	"time"
+
+	"goride/pkg/money"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type FareSplitMode string
+type FareSplitStatus string
+type FareSplitParticipantStatus string
+
+const (
+	FareSplitModeEqual  FareSplitMode = "equal"  // every paying participant pays the same
+	FareSplitModeCustom FareSplitMode = "custom" // participants pay the percentages set by the requester
+
+	FareSplitStatusOpen      FareSplitStatus = "open"      // invitations can still be answered
+	FareSplitStatusSettled   FareSplitStatus = "settled"   // shares were charged when the ride completed
+	FareSplitStatusCancelled FareSplitStatus = "cancelled" // the ride ended without a fare
+
+	FareSplitParticipantInvited  FareSplitParticipantStatus = "invited"
+	FareSplitParticipantAccepted FareSplitParticipantStatus = "accepted"
+	FareSplitParticipantDeclined FareSplitParticipantStatus = "declined"
+	FareSplitParticipantPending  FareSplitParticipantStatus = "pending" // charged, the provider's answer is not known yet
+	FareSplitParticipantCharged  FareSplitParticipantStatus = "charged"
+	FareSplitParticipantFailed   FareSplitParticipantStatus = "failed" // charge failed, the share is charged to the requester
+)
+
+// FareSplit shares a ride's fare between the rider who requested it and the
+// users they invited. Shares are charged when the ride completes; invitees who
+// have not accepted by then pay nothing, and their share stays with the
+// requester.
+type FareSplit struct {
+	ID           primitive.ObjectID     `json:"id" bson:"_id,omitempty"`
+	RideID       primitive.ObjectID     `json:"ride_id" bson:"ride_id" validate:"required"`
+	RequesterID  primitive.ObjectID     `json:"requester_id" bson:"requester_id" validate:"required"` // user ID
+	Mode         FareSplitMode          `json:"mode" bson:"mode" validate:"required"`
+	Status       FareSplitStatus        `json:"status" bson:"status" default:"open"`
+	Participants []FareSplitParticipant `json:"participants" bson:"participants"` // the requester first
+	Total        money.Money            `json:"total" bson:"total"`               // fare that was split
+	SettledAt    *time.Time             `json:"settled_at" bson:"settled_at"`
+	CreatedAt    time.Time              `json:"created_at" bson:"created_at"`
+	UpdatedAt    time.Time              `json:"updated_at" bson:"updated_at"`
+}
+
+type FareSplitParticipant struct {
+	UserID            primitive.ObjectID         `json:"user_id" bson:"user_id"`
+	Phone             string                     `json:"phone,omitempty" bson:"phone,omitempty"`                 // invited by phone
+	ReferralCode      string                     `json:"referral_code,omitempty" bson:"referral_code,omitempty"` // invited by referral code
+	IsRequester       bool                       `json:"is_requester" bson:"is_requester"`
+	Percentage        float64                    `json:"percentage" bson:"percentage"` // custom splits only
+	Status            FareSplitParticipantStatus `json:"status" bson:"status"`
+	Share             money.Money                `json:"share" bson:"share"`
+	PaymentID         *primitive.ObjectID        `json:"payment_id" bson:"payment_id"`
+	FallbackPaymentID *primitive.ObjectID        `json:"fallback_payment_id" bson:"fallback_payment_id"` // requester's payment for a share that failed
+	FallbackStatus    PaymentStatus              `json:"fallback_status,omitempty" bson:"fallback_status,omitempty"`
+	FailureReason     string                     `json:"failure_reason,omitempty" bson:"failure_reason,omitempty"`
+	InvitedAt         time.Time                  `json:"invited_at" bson:"invited_at"`
+	RespondedAt       *time.Time                 `json:"responded_at" bson:"responded_at"`
+}
+
+// Participant returns the participant entry of a user, or nil.
+func (s *FareSplit) Participant(userID primitive.ObjectID) *FareSplitParticipant {
+	for i := range s.Participants {
+		if s.Participants[i].UserID == userID {
+			return &s.Participants[i]
+		}
+	}
+	return nil
+}
+
+// Paid reports whether the participant's share has been paid, by the
+// participant or, after their charge failed, by the requester.
+func (p *FareSplitParticipant) Paid() bool {
+	switch p.Status {
+	case FareSplitParticipantCharged:
+		return true
+	case FareSplitParticipantFailed:
+		return p.FallbackStatus == PaymentStatusCompleted
+	}
+	return false
+}
+
+// Uncollected reports whether the participant's share could not be charged:
+// their own charge failed and so did the requester's in their place, if one
+// was made.
+func (p *FareSplitParticipant) Uncollected() bool {
+	return p.Status == FareSplitParticipantFailed &&
+		p.FallbackStatus != PaymentStatusCompleted &&
+		p.FallbackStatus != PaymentStatusPending
+}
@@ -0,0 +1,111 @@
+package models
+
+import (
+	"time"
+
+	"goride/pkg/money"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type LedgerAccountType string
+type LedgerEntryType string
+
+const (
+	LedgerAccountRiderWallet       LedgerAccountType = "rider_wallet"
+	LedgerAccountDriverWallet      LedgerAccountType = "driver_wallet"
+	LedgerAccountPlatformRevenue   LedgerAccountType = "platform_revenue"
+	LedgerAccountPromotionsExpense LedgerAccountType = "promotions_expense"
+	LedgerAccountCashInTransit     LedgerAccountType = "cash_in_transit"  // cash a driver collected for the platform, per driver
+	LedgerAccountPaymentClearing   LedgerAccountType = "payment_clearing" // funds held by the payment provider
+	LedgerAccountTaxPayable        LedgerAccountType = "tax_payable"
+
+	LedgerEntryTopUp              LedgerEntryType = "top_up"
+	LedgerEntryRidePayment        LedgerEntryType = "ride_payment"
+	LedgerEntryRefund             LedgerEntryType = "refund"
+	LedgerEntryCashSettlement     LedgerEntryType = "cash_settlement"
+	LedgerEntryWithdrawal         LedgerEntryType = "withdrawal"
+	LedgerEntryWithdrawalReversal LedgerEntryType = "withdrawal_reversal" // a payout that failed or was returned
+	LedgerEntryAdjustment         LedgerEntryType = "adjustment"
+	LedgerEntryOpeningBalance     LedgerEntryType = "opening_balance" // wallet balances from before the ledger
+)
+
+// LedgerEntry is one balanced movement of money. Its postings are the
+// transactions that reference it; their signed amounts add up to zero.
+type LedgerEntry struct {
+	ID             primitive.ObjectID   `json:"id" bson:"_id,omitempty"`
+	Type           LedgerEntryType      `json:"type" bson:"type"`
+	Currency       string               `json:"currency" bson:"currency"`
+	Description    string               `json:"description" bson:"description"`
+	Reference      string               `json:"reference" bson:"reference"` // unique, so a movement is posted once
+	RideID         *primitive.ObjectID  `json:"ride_id" bson:"ride_id"`
+	PaymentID      *primitive.ObjectID  `json:"payment_id" bson:"payment_id"`
+	PaymentMethod  PaymentMethod        `json:"payment_method,omitempty" bson:"payment_method,omitempty"` // of the payment posted
+	TransactionIDs []primitive.ObjectID `json:"transaction_ids" bson:"transaction_ids"`
+	ExchangeRate   *ExchangeRate        `json:"exchange_rate" bson:"exchange_rate"` // into the reporting currency, copied to every transaction
+	CreatedBy      *primitive.ObjectID  `json:"created_by" bson:"created_by"`
+	CreatedAt      time.Time            `json:"created_at" bson:"created_at"`
+}
+
+// LedgerPosting asks for an amount to be posted to an account. A positive
+// amount credits the account and a negative one debits it. Platform accounts
+// have no user.
+type LedgerPosting struct {
+	AccountType  LedgerAccountType  `json:"account_type"`
+	UserID       primitive.ObjectID `json:"user_id"`
+	Amount       money.Money        `json:"amount"`
+	RequireFunds bool               `json:"require_funds"` // the account may not be left negative
+}
+
+// LedgerCheck records a run of the ledger invariant check.
+type LedgerCheck struct {
+	ID                primitive.ObjectID   `json:"id" bson:"_id,omitempty"`
+	Balanced          bool                 `json:"balanced" bson:"balanced"`
+	Totals            []LedgerTotal        `json:"totals" bson:"totals"`
+	UnbalancedEntries []primitive.ObjectID `json:"unbalanced_entries" bson:"unbalanced_entries"`
+	DriftedAccounts   []LedgerDrift        `json:"drifted_accounts" bson:"drifted_accounts"`
+	CheckedAt         time.Time            `json:"checked_at" bson:"checked_at"`
+}
+
+// LedgerTotal is the sum of every account balance and of every posting in one
+// currency. Both are zero in a sound ledger.
+type LedgerTotal struct {
+	Currency string      `json:"currency" bson:"currency"`
+	Accounts int64       `json:"accounts" bson:"accounts"`
+	Balance  money.Money `json:"balance" bson:"balance"`
+	Postings money.Money `json:"postings" bson:"postings"`
+}
+
+// LedgerDrift is an account whose stored balance differs from the sum of its
+// postings.
+type LedgerDrift struct {
+	WalletID primitive.ObjectID `json:"wallet_id" bson:"wallet_id"`
+	Balance  money.Money        `json:"balance" bson:"balance"`
+	Postings money.Money        `json:"postings" bson:"postings"`
+}
+
+// LedgerActivity is the net of an account's postings over a time range for
+// one kind of entry. Payments are further split by payment method.
+type LedgerActivity struct {
+	EntryType     LedgerEntryType `json:"entry_type" bson:"entry_type"`
+	PaymentMethod PaymentMethod   `json:"payment_method,omitempty" bson:"payment_method,omitempty"`
+	Amount        money.Money     `json:"amount" bson:"amount"`
+	Postings      int64           `json:"postings" bson:"postings"`
+}
+
+// IsUserAccount reports whether accounts of the type belong to a user.
+func (t LedgerAccountType) IsUserAccount() bool {
+	switch t {
+	case LedgerAccountRiderWallet, LedgerAccountDriverWallet, LedgerAccountCashInTransit:
+		return true
+	default:
+		return false
+	}
+}
+
+// AllowsNegative reports whether an account of the type may be overdrawn.
+// Drivers owe the platform its commission on cash rides, so only rider
+// wallets are kept from going negative.
+func (t LedgerAccountType) AllowsNegative() bool {
+	return t != LedgerAccountRiderWallet
+}
@@ -3,6 +3,8 @@ package models
 import (
 	"time"
 
+	"goride/pkg/hexgrid"
+
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
@@ -15,6 +17,7 @@ type Location struct {
 	Country     string    `json:"country" bson:"country"`
 	PostalCode  string    `json:"postal_code" bson:"postal_code"`
 	PlaceID     string    `json:"place_id" bson:"place_id"`
+	CellID      string    `json:"cell_id,omitempty" bson:"cell_id,omitempty"` // hexgrid cell, see AssignCell
 	Timestamp   time.Time `json:"timestamp" bson:"timestamp"`
 }
 
@@ -32,6 +35,17 @@ func (l Location) Longitude() float64 {
 	return 0
 }
 
+// AssignCell records the hexgrid cell containing the location so heatmaps,
+// analytics and surge zones can bucket it without geometry queries.
+func (l *Location) AssignCell(resolution int) {
+	if len(l.Coordinates) < 2 {
+		return
+	}
+	if cell, err := hexgrid.FromLatLng(l.Latitude(), l.Longitude(), resolution); err == nil {
+		l.CellID = cell.String()
+	}
+}
+
 type LocationHistory struct {
 	ID        primitive.ObjectID  `json:"id" bson:"_id,omitempty"`
 	UserID    *primitive.ObjectID `json:"user_id" bson:"user_id"`
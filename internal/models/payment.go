@@ -1,20 +1,26 @@
 package models
 
 import (
+	"fmt"
 	"time"
 
+	"goride/pkg/money"
+
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
+
 type PaymentStatus string
 type PaymentMethod string
 type PaymentType string
 
 const (
-	PaymentStatusPending   PaymentStatus = "pending"
-	PaymentStatusCompleted PaymentStatus = "completed"
-	PaymentStatusFailed    PaymentStatus = "failed"
-	PaymentStatusRefunded  PaymentStatus = "refunded"
-	PaymentStatusCancelled PaymentStatus = "cancelled"
+	PaymentStatusPending    PaymentStatus = "pending"
+	PaymentStatusCompleted  PaymentStatus = "completed"
+	PaymentStatusFailed     PaymentStatus = "failed"
+	PaymentStatusRefunded   PaymentStatus = "refunded"
+	PaymentStatusCancelled  PaymentStatus = "cancelled"
+	PaymentStatusAuthorized PaymentStatus = "authorized" // card held, not yet captured
+	PaymentStatusVoided     PaymentStatus = "voided"     // hold released without a charge
 
 	PaymentMethodCreditCard PaymentMethod = "credit_card"
 	PaymentMethodDebitCard  PaymentMethod = "debit_card"
@@ -24,41 +30,85 @@ const (
 	PaymentMethodCash       PaymentMethod = "cash"
 	PaymentMethodWallet     PaymentMethod = "wallet"
 
-	PaymentTypeRide     PaymentType = "ride"
-	PaymentTypeTip      PaymentType = "tip"
-	PaymentTypeRefund   PaymentType = "refund"
-	PaymentTypePenalty  PaymentType = "penalty"
-	PaymentTypeBonus    PaymentType = "bonus"
+	PaymentTypeRide         PaymentType = "ride"
+	PaymentTypeTip          PaymentType = "tip"
+	PaymentTypeRefund       PaymentType = "refund"
+	PaymentTypePenalty      PaymentType = "penalty"
+	PaymentTypeBonus        PaymentType = "bonus"
+	PaymentTypeSubscription PaymentType = "subscription" // ride pass billing, not tied to a ride
+	PaymentTypeDriverFine   PaymentType = "driver_fine"  // penalty taken from a driver's wallet
 )
 
 type Payment struct {
-	ID                primitive.ObjectID `json:"id" bson:"_id,omitempty"`
-	RideID            primitive.ObjectID `json:"ride_id" bson:"ride_id" validate:"required"`
-	PayerID           primitive.ObjectID `json:"payer_id" bson:"payer_id" validate:"required"`
-	PayeeID           primitive.ObjectID `json:"payee_id" bson:"payee_id"`
-	PaymentMethodID   primitive.ObjectID `json:"payment_method_id" bson:"payment_method_id"`
-	TransactionID     string             `json:"transaction_id" bson:"transaction_id"`
-	ExternalID        string             `json:"external_id" bson:"external_id"`
-	PaymentMethod     PaymentMethod      `json:"payment_method" bson:"payment_method" validate:"required"`
-	PaymentType       PaymentType        `json:"payment_type" bson:"payment_type" default:"ride"`
-	Status            PaymentStatus      `json:"status" bson:"status" default:"pending"`
-	Amount            float64            `json:"amount" bson:"amount" validate:"required"`
-	Currency          string             `json:"currency" bson:"currency" default:"USD"`
-	BaseFare          float64            `json:"base_fare" bson:"base_fare"`
-	DistanceFare      float64            `json:"distance_fare" bson:"distance_fare"`
-	TimeFare          float64            `json:"time_fare" bson:"time_fare"`
-	SurgeAmount       float64            `json:"surge_amount" bson:"surge_amount" default:"0"`
-	TipAmount         float64            `json:"tip_amount" bson:"tip_amount" default:"0"`
-	TaxAmount         float64            `json:"tax_amount" bson:"tax_amount" default:"0"`
-	DiscountAmount    float64            `json:"discount_amount" bson:"discount_amount" default:"0"`
-	PlatformFee       float64            `json:"platform_fee" bson:"platform_fee" default:"0"`
-	DriverEarnings    float64            `json:"driver_earnings" bson:"driver_earnings"`
-	PromoCode         string             `json:"promo_code" bson:"promo_code"`
-	FailureReason     string             `json:"failure_reason" bson:"failure_reason"`
-	RefundAmount      float64            `json:"refund_amount" bson:"refund_amount" default:"0"`
-	ProcessedAt       *time.Time         `json:"processed_at" bson:"processed_at"`
-	FailedAt          *time.Time         `json:"failed_at" bson:"failed_at"`
-	RefundedAt        *time.Time         `json:"refunded_at" bson:"refunded_at"`
-	CreatedAt         time.Time          `json:"created_at" bson:"created_at"`
-	UpdatedAt         time.Time          `json:"updated_at" bson:"updated_at"`
-}
\ No newline at end of file
+	ID                    primitive.ObjectID  `json:"id" bson:"_id,omitempty"`
+	RideID                primitive.ObjectID  `json:"ride_id" bson:"ride_id" validate:"required"`
+	PayerID               primitive.ObjectID  `json:"payer_id" bson:"payer_id" validate:"required"`
+	PayeeID               primitive.ObjectID  `json:"payee_id" bson:"payee_id"`
+	FareSplitID           *primitive.ObjectID `json:"fare_split_id" bson:"fare_split_id"` // share of a split fare
+	PaymentMethodID       primitive.ObjectID  `json:"payment_method_id" bson:"payment_method_id"`
+	TransactionID         string              `json:"transaction_id" bson:"transaction_id"`
+	ExternalID            string              `json:"external_id" bson:"external_id"`
+	IdempotencyKey        string              `json:"idempotency_key" bson:"idempotency_key,omitempty"` // sent to the provider, unique
+	Attempt               int                 `json:"attempt" bson:"attempt"`                           // numbers the charges of this type for the ride
+	AuthorizationID       string              `json:"authorization_id" bson:"authorization_id"`         // provider hold captured for this payment
+	AuthorizedAmount      money.Money         `json:"authorized_amount" bson:"authorized_amount"`
+	PaymentMethod         PaymentMethod       `json:"payment_method" bson:"payment_method" validate:"required"`
+	PaymentType           PaymentType         `json:"payment_type" bson:"payment_type" default:"ride"`
+	Status                PaymentStatus       `json:"status" bson:"status" default:"pending"`
+	Amount                money.Money         `json:"amount" bson:"amount" validate:"required"`
+	Currency              string              `json:"currency" bson:"currency" default:"USD"`
+	BaseFare              money.Money         `json:"base_fare" bson:"base_fare"`
+	DistanceFare          money.Money         `json:"distance_fare" bson:"distance_fare"`
+	TimeFare              money.Money         `json:"time_fare" bson:"time_fare"`
+	SurgeAmount           money.Money         `json:"surge_amount" bson:"surge_amount" default:"0"`
+	Surcharges            []FareSurcharge     `json:"surcharges" bson:"surcharges"`
+	SurchargeAmount       money.Money         `json:"surcharge_amount" bson:"surcharge_amount" default:"0"`
+	TipAmount             money.Money         `json:"tip_amount" bson:"tip_amount" default:"0"`
+	TaxAmount             money.Money         `json:"tax_amount" bson:"tax_amount" default:"0"`
+	TaxLines              []TaxLine           `json:"tax_lines" bson:"tax_lines"`
+	DiscountAmount        money.Money         `json:"discount_amount" bson:"discount_amount" default:"0"`
+	PlatformFee           money.Money         `json:"platform_fee" bson:"platform_fee" default:"0"`
+	DriverEarnings        money.Money         `json:"driver_earnings" bson:"driver_earnings"`
+	PromoCode             string              `json:"promo_code" bson:"promo_code"`
+	FailureReason         string              `json:"failure_reason" bson:"failure_reason"`
+	RefundAmount          money.Money         `json:"refund_amount" bson:"refund_amount" default:"0"`
+	DisputeID             string              `json:"dispute_id" bson:"dispute_id"` // chargeback opened with the provider
+	DisputedAmount        money.Money         `json:"disputed_amount" bson:"disputed_amount"`
+	DisputeReason         string              `json:"dispute_reason" bson:"dispute_reason"`
+	ExchangeRate          *ExchangeRate       `json:"exchange_rate" bson:"exchange_rate"` // snapshot taken at charge time
+	ReportingCurrency     string              `json:"reporting_currency" bson:"reporting_currency"`
+	ReportingAmount       money.Money         `json:"reporting_amount" bson:"reporting_amount"`
+	RefundReportingAmount money.Money         `json:"refund_reporting_amount" bson:"refund_reporting_amount"` // converted at the original rate
+	AuthorizedAt          *time.Time          `json:"authorized_at" bson:"authorized_at"`
+	VoidedAt              *time.Time          `json:"voided_at" bson:"voided_at"`
+	ProcessedAt           *time.Time          `json:"processed_at" bson:"processed_at"`
+	FailedAt              *time.Time          `json:"failed_at" bson:"failed_at"`
+	RefundedAt            *time.Time          `json:"refunded_at" bson:"refunded_at"`
+	DisputedAt            *time.Time          `json:"disputed_at" bson:"disputed_at"`
+	CreatedAt             time.Time           `json:"created_at" bson:"created_at"`
+	UpdatedAt             time.Time           `json:"updated_at" bson:"updated_at"`
+}
+
+// IdempotencyPrefix scopes the payment's idempotency keys: its ride, or its
+// payer for payments not tied to a ride, and its type.
+func (p *Payment) IdempotencyPrefix() string {
+	subject := p.RideID
+	if subject.IsZero() {
+		subject = p.PayerID
+	}
+	return fmt.Sprintf("%s:%s:", subject.Hex(), p.PaymentType)
+}
+
+// SetAttempt numbers the payment among the charges of its type for its ride
+// and derives its idempotency key from the number. Retrying the payment keeps
+// the key, so the provider charges it once.
+func (p *Payment) SetAttempt(attempt int) {
+	p.Attempt = attempt
+	p.IdempotencyKey = fmt.Sprintf("%s%d", p.IdempotencyPrefix(), attempt)
+}
+
+// RefundIdempotencyKey keys a refund of a payment by the total refunded once
+// it is made, so each refund is sent once and the next one gets a new key.
+func RefundIdempotencyKey(payment *Payment, refundedTotal money.Money) string {
+	return fmt.Sprintf("%s:%s:%d", payment.ID.Hex(), PaymentTypeRefund, refundedTotal.Amount)
+}
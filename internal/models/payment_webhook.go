@@ -0,0 +1,37 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type PaymentWebhookStatus string
+
+const (
+	PaymentWebhookStatusPending   PaymentWebhookStatus = "pending" // waiting for its first or next attempt
+	PaymentWebhookStatusProcessed PaymentWebhookStatus = "processed"
+	PaymentWebhookStatusIgnored   PaymentWebhookStatus = "ignored" // nothing to do for the event type
+	PaymentWebhookStatusFailed    PaymentWebhookStatus = "failed"  // out of attempts, waiting for a replay
+)
+
+// PaymentWebhookEvent is a webhook received from a payment provider, kept as
+// it was sent once its signature is verified. The provider's event ID is
+// unique per provider, so an event delivered again is stored once.
+type PaymentWebhookEvent struct {
+	ID            primitive.ObjectID   `json:"id" bson:"_id,omitempty"`
+	Provider      string               `json:"provider" bson:"provider"`
+	EventID       string               `json:"event_id" bson:"event_id"`
+	EventType     string               `json:"event_type" bson:"event_type"`
+	Payload       string               `json:"payload" bson:"payload"`
+	Status        PaymentWebhookStatus `json:"status" bson:"status"`
+	PaymentID     *primitive.ObjectID  `json:"payment_id" bson:"payment_id"` // payment the event was applied to
+	Attempts      int                  `json:"attempts" bson:"attempts"`
+	LastError     string               `json:"last_error" bson:"last_error"`
+	NextAttemptAt time.Time            `json:"next_attempt_at" bson:"next_attempt_at"`
+	ProcessedAt   *time.Time           `json:"processed_at" bson:"processed_at"`
+	ReplayedBy    *primitive.ObjectID  `json:"replayed_by" bson:"replayed_by"`
+	ReplayedAt    *time.Time           `json:"replayed_at" bson:"replayed_at"`
+	CreatedAt     time.Time            `json:"created_at" bson:"created_at"` // when received
+	UpdatedAt     time.Time            `json:"updated_at" bson:"updated_at"`
+}
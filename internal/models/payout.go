@@ -0,0 +1,74 @@
+package models
+
+import (
+	"time"
+
+	"goride/pkg/money"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type PayoutType string
+type PayoutStatus string
+type PayoutBatchStatus string
+
+const (
+	PayoutTypeScheduled PayoutType = "scheduled"
+	PayoutTypeInstant   PayoutType = "instant"
+
+	PayoutStatusPending  PayoutStatus = "pending" // taken from the wallet, not yet accepted by the provider
+	PayoutStatusSent     PayoutStatus = "sent"
+	PayoutStatusFailed   PayoutStatus = "failed"   // refused by the provider, money back in the wallet
+	PayoutStatusReturned PayoutStatus = "returned" // sent back by the bank, money back in the wallet
+
+	PayoutBatchStatusProcessing PayoutBatchStatus = "processing"
+	PayoutBatchStatusCompleted  PayoutBatchStatus = "completed"
+)
+
+// PayoutBatch is one scheduled run paying drivers what they earned in a
+// period.
+type PayoutBatch struct {
+	ID          primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	PeriodStart time.Time          `json:"period_start" bson:"period_start"`
+	PeriodEnd   time.Time          `json:"period_end" bson:"period_end"`
+	Status      PayoutBatchStatus  `json:"status" bson:"status"`
+	Payouts     int                `json:"payouts" bson:"payouts"`
+	Failed      int                `json:"failed" bson:"failed"`
+	Skipped     int                `json:"skipped" bson:"skipped"` // nothing owed, below the minimum or no verified bank account
+	Totals      []money.Money      `json:"totals" bson:"totals"`   // sent, per currency
+	CreatedAt   time.Time          `json:"created_at" bson:"created_at"`
+	CompletedAt *time.Time         `json:"completed_at" bson:"completed_at"`
+}
+
+// Payout is money sent from a driver's wallet to their bank account. The
+// breakdown explains a scheduled payout: earnings less the commission owed on
+// cash rides, plus adjustments, cash-outs already taken and the balance
+// carried over add up to Amount.
+type Payout struct {
+	ID               primitive.ObjectID  `json:"id" bson:"_id,omitempty"`
+	DriverID         primitive.ObjectID  `json:"driver_id" bson:"driver_id"` // user ID
+	BatchID          *primitive.ObjectID `json:"batch_id" bson:"batch_id"`
+	Type             PayoutType          `json:"type" bson:"type"`
+	Status           PayoutStatus        `json:"status" bson:"status"`
+	Earnings         money.Money         `json:"earnings" bson:"earnings"`               // fares, tips and bonuses on non-cash payments
+	CashCommission   money.Money         `json:"cash_commission" bson:"cash_commission"` // owed on fares the driver collected in cash
+	Adjustments      money.Money         `json:"adjustments" bson:"adjustments"`
+	CashedOut        money.Money         `json:"cashed_out" bson:"cashed_out"`     // instant cash-outs in the period, fees included
+	CarriedOver      money.Money         `json:"carried_over" bson:"carried_over"` // balance from before the period
+	Fee              money.Money         `json:"fee" bson:"fee"`                   // instant cash-out fee, on top of Amount
+	Amount           money.Money         `json:"amount" bson:"amount"`             // sent to the bank
+	BankAccount      BankAccount         `json:"bank_account" bson:"bank_account"`
+	Reference        string              `json:"reference" bson:"reference"` // unique, sent to the provider
+	ProviderPayoutID string              `json:"provider_payout_id" bson:"provider_payout_id"`
+	EntryID          *primitive.ObjectID `json:"entry_id" bson:"entry_id"` // ledger withdrawal
+	ReversalEntryID  *primitive.ObjectID `json:"reversal_entry_id" bson:"reversal_entry_id"`
+	Attempts         int                 `json:"attempts" bson:"attempts"` // requests made to the provider
+	FailureReason    string              `json:"failure_reason" bson:"failure_reason"`
+	PeriodStart      *time.Time          `json:"period_start" bson:"period_start"`
+	PeriodEnd        *time.Time          `json:"period_end" bson:"period_end"`
+	SentAt           *time.Time          `json:"sent_at" bson:"sent_at"`
+	FailedAt         *time.Time          `json:"failed_at" bson:"failed_at"`
+	ReturnedAt       *time.Time          `json:"returned_at" bson:"returned_at"`
+	CreatedAt        time.Time           `json:"created_at" bson:"created_at"`
+	UpdatedAt        time.Time           `json:"updated_at" bson:"updated_at"`
+}
@@ -0,0 +1,154 @@
+package models
+
+import (
+	"strings"
+	"time"
+
+	"goride/pkg/money"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// PricingExperiment A/B tests fare structure or surge curve changes on a share
+// of riders in some cities. Riders are assigned to an arm by hashing their user
+// ID, so a rider sees the same arm on every quote for the experiment's life.
+type PricingExperiment struct {
+	ID                primitive.ObjectID     `json:"id" bson:"_id,omitempty"`
+	Name              string                 `json:"name" bson:"name" validate:"required"`
+	Description       string                 `json:"description" bson:"description"`
+	Cities            []string               `json:"cities" bson:"cities" validate:"required"`
+	RideTypes         []RideType             `json:"ride_types" bson:"ride_types" validate:"required"`
+	Currency          string                 `json:"currency" bson:"currency"`                                              // of the targeted fare structures
+	TrafficAllocation float64                `json:"traffic_allocation" bson:"traffic_allocation" validate:"min=0,max=100"` // percent of riders enrolled
+	Arms              []PricingExperimentArm `json:"arms" bson:"arms" validate:"required,min=2"`
+	StartDate         time.Time              `json:"start_date" bson:"start_date"`
+	EndDate           time.Time              `json:"end_date" bson:"end_date" validate:"required"`
+	IsKilled          bool                   `json:"is_killed" bson:"is_killed" default:"false"`
+	KilledAt          *time.Time             `json:"killed_at" bson:"killed_at"`
+	KilledBy          *primitive.ObjectID    `json:"killed_by" bson:"killed_by"`
+	KillReason        string                 `json:"kill_reason" bson:"kill_reason"`
+	CreatedBy         *primitive.ObjectID    `json:"created_by" bson:"created_by"`
+	CreatedAt         time.Time              `json:"created_at" bson:"created_at"`
+	UpdatedAt         time.Time              `json:"updated_at" bson:"updated_at"`
+}
+
+// PricingExperimentArm is one variant of an experiment. The control arm has no
+// overrides; other arms override fare structure parameters, the surge curve
+// or both.
+type PricingExperimentArm struct {
+	Name      string                 `json:"name" bson:"name" validate:"required"`
+	Weight    float64                `json:"weight" bson:"weight" validate:"required"` // percent of enrolled riders
+	IsControl bool                   `json:"is_control" bson:"is_control"`
+	Fare      *FareStructureOverride `json:"fare" bson:"fare"`
+	Surge     *SurgeCurveOverride    `json:"surge" bson:"surge"`
+}
+
+// FareStructureOverride replaces the fare structure parameters it sets and
+// keeps the rest.
+type FareStructureOverride struct {
+	BaseFare       *money.Money `json:"base_fare" bson:"base_fare"`
+	PricePerKM     *float64     `json:"price_per_km" bson:"price_per_km"`
+	PricePerMinute *float64     `json:"price_per_minute" bson:"price_per_minute"`
+	MinimumFare    *money.Money `json:"minimum_fare" bson:"minimum_fare"`
+	MaximumFare    *money.Money `json:"maximum_fare" bson:"maximum_fare"`
+	BookingFee     *money.Money `json:"booking_fee" bson:"booking_fee"`
+}
+
+// SurgeCurveOverride prices surge from its own demand/supply curve instead of
+// the engine's.
+type SurgeCurveOverride struct {
+	Curve         []SurgeCurvePoint `json:"curve" bson:"curve"`
+	MaxMultiplier float64           `json:"max_multiplier" bson:"max_multiplier"`
+}
+
+type SurgeCurvePoint struct {
+	Ratio      float64 `json:"ratio" bson:"ratio"` // open requests per idle driver
+	Multiplier float64 `json:"multiplier" bson:"multiplier"`
+}
+
+// PricingExperimentAssignment records the arm a quote was priced under. It
+// carries the arm's overrides so a ride re-priced at completion follows the
+// arm it was booked in, even after the experiment has ended.
+type PricingExperimentAssignment struct {
+	ExperimentID primitive.ObjectID     `json:"experiment_id" bson:"experiment_id"`
+	Experiment   string                 `json:"experiment" bson:"experiment"`
+	Arm          string                 `json:"arm" bson:"arm"`
+	Fare         *FareStructureOverride `json:"fare,omitempty" bson:"fare,omitempty"`
+	Surge        *SurgeCurveOverride    `json:"surge,omitempty" bson:"surge,omitempty"`
+}
+
+// PricingExperimentExposure is one quote shown to an enrolled rider. RideID is
+// set when the quote is booked.
+type PricingExperimentExposure struct {
+	ID              primitive.ObjectID  `json:"id" bson:"_id,omitempty"`
+	ExperimentID    primitive.ObjectID  `json:"experiment_id" bson:"experiment_id"`
+	Arm             string              `json:"arm" bson:"arm"`
+	RiderID         primitive.ObjectID  `json:"rider_id" bson:"rider_id"`
+	QuoteID         string              `json:"quote_id" bson:"quote_id"`
+	Fare            money.Money         `json:"fare" bson:"fare"`
+	SurgeMultiplier float64             `json:"surge_multiplier" bson:"surge_multiplier"`
+	RideID          *primitive.ObjectID `json:"ride_id" bson:"ride_id"`
+	ConvertedAt     *time.Time          `json:"converted_at" bson:"converted_at"`
+	CreatedAt       time.Time           `json:"created_at" bson:"created_at"`
+}
+
+// IsRunning reports whether the experiment enrolls riders at the given time.
+func (e *PricingExperiment) IsRunning(at time.Time) bool {
+	return !e.IsKilled && !at.Before(e.StartDate) && at.Before(e.EndDate)
+}
+
+// AppliesTo reports whether the experiment targets a city and ride type.
+func (e *PricingExperiment) AppliesTo(city string, rideType RideType) bool {
+	cityMatched := false
+	for _, target := range e.Cities {
+		if strings.EqualFold(target, city) {
+			cityMatched = true
+			break
+		}
+	}
+	if !cityMatched {
+		return false
+	}
+
+	for _, target := range e.RideTypes {
+		if target == rideType {
+			return true
+		}
+	}
+	return false
+}
+
+// Apply returns a copy of the fare structure with the overridden parameters.
+func (o *FareStructureOverride) Apply(fareStructure *FareStructure) *FareStructure {
+	overridden := *fareStructure
+	if o.BaseFare != nil {
+		overridden.BaseFare = *o.BaseFare
+	}
+	if o.PricePerKM != nil {
+		overridden.PricePerKM = *o.PricePerKM
+	}
+	if o.PricePerMinute != nil {
+		overridden.PricePerMinute = *o.PricePerMinute
+	}
+	if o.MinimumFare != nil {
+		overridden.MinimumFare = *o.MinimumFare
+	}
+	if o.MaximumFare != nil {
+		overridden.MaximumFare = *o.MaximumFare
+	}
+	if o.BookingFee != nil {
+		overridden.BookingFee = *o.BookingFee
+	}
+	return &overridden
+}
+
+// Amounts lists the fixed amounts the override sets.
+func (o *FareStructureOverride) Amounts() []*money.Money {
+	var amounts []*money.Money
+	for _, amount := range []*money.Money{o.BaseFare, o.MinimumFare, o.MaximumFare, o.BookingFee} {
+		if amount != nil {
+			amounts = append(amounts, amount)
+		}
+	}
+	return amounts
+}
@@ -45,24 +45,49 @@ type Ride struct {
 	CancelledAt         *time.Time         `json:"cancelled_at" bson:"cancelled_at"`
 	CancellationReason  string             `json:"cancellation_reason" bson:"cancellation_reason"`
 	CancelledBy         string             `json:"cancelled_by" bson:"cancelled_by"`
+	CancellationFee     float64            `json:"cancellation_fee" bson:"cancellation_fee" default:"0"`
 	EstimatedDuration   int                `json:"estimated_duration" bson:"estimated_duration"` // minutes
+	PickupETA           int                `json:"pickup_eta" bson:"pickup_eta"` // minutes, quoted at acceptance
+	DriverBonus         float64            `json:"driver_bonus" bson:"driver_bonus" default:"0"` // escalation bonus offered to the accepting driver, paid at completion
 	EstimatedDistance   float64            `json:"estimated_distance" bson:"estimated_distance"` // kilometers
 	ActualDuration      int                `json:"actual_duration" bson:"actual_duration"`
 	ActualDistance      float64            `json:"actual_distance" bson:"actual_distance"`
 	EstimatedFare       float64            `json:"estimated_fare" bson:"estimated_fare"`
 	ActualFare          float64            `json:"actual_fare" bson:"actual_fare"`
+	FinalFare           float64            `json:"final_fare" bson:"final_fare"` // fare charged after reconciliation
+	FareQuote           *FareQuote         `json:"fare_quote" bson:"fare_quote"`
+	FareReconciliation  *FareReconciliation `json:"fare_reconciliation" bson:"fare_reconciliation"`
+	FareBreakdown       *FareBreakdown     `json:"fare_breakdown" bson:"fare_breakdown"` // itemized receipt for the final fare
+	Experiment          *PricingExperimentAssignment `json:"experiment" bson:"experiment"` // pricing experiment arm of the booked quote
+	WaitingTime         int                `json:"waiting_time" bson:"waiting_time"` // billable minutes after the free window
+	WaitingCharge       float64            `json:"waiting_charge" bson:"waiting_charge" default:"0"`
+	NoShowFee           float64            `json:"no_show_fee" bson:"no_show_fee" default:"0"`
 	SurgeMultiplier     float64            `json:"surge_multiplier" bson:"surge_multiplier" default:"1.0"`
 	Currency            string             `json:"currency" bson:"currency" default:"USD"`
 	Route               *Route             `json:"route" bson:"route"`
 	PaymentID           *primitive.ObjectID `json:"payment_id" bson:"payment_id"`
+	PaymentMethod       PaymentMethod      `json:"payment_method" bson:"payment_method"` // chosen at booking, card when empty
+	PaymentMethodID     *primitive.ObjectID `json:"payment_method_id" bson:"payment_method_id"` // rider's default when empty
+	FareSplitID         *primitive.ObjectID `json:"fare_split_id" bson:"fare_split_id"` // set when the fare is split between riders
 	RiderRating         *float64           `json:"rider_rating" bson:"rider_rating"`
 	DriverRating        *float64           `json:"driver_rating" bson:"driver_rating"`
 	SpecialRequests     []string           `json:"special_requests" bson:"special_requests"`
 	PromoCode           string             `json:"promo_code" bson:"promo_code"`
 	TipAmount           float64            `json:"tip_amount" bson:"tip_amount" default:"0"`
 	IsShared            bool               `json:"is_shared" bson:"is_shared" default:"false"`
-	SharedWith          []primitive.ObjectID `json:"shared_with" bson:"shared_with"`
-	OTP                 string             `json:"otp" bson:"otp"`
+	SharedWith          []primitive.ObjectID `json:"shared_with" bson:"shared_with"` // other rides pooled in the same vehicle
+	PoolSettlementPending bool             `json:"pool_settlement_pending" bson:"pool_settlement_pending"` // pool fare not yet charged to every rider
+	OTP                 string             `json:"-" bson:"otp"` // pickup PIN, only ever sent to the rider
+	PINRequired         bool               `json:"pin_required" bson:"pin_required" default:"false"`
+	History             []RideHistoryEntry `json:"history" bson:"history"`
 	CreatedAt           time.Time          `json:"created_at" bson:"created_at"`
 	UpdatedAt           time.Time          `json:"updated_at" bson:"updated_at"`
-}
\ No newline at end of file
+}
+
+type RideHistoryEntry struct {
+	Event     string                 `json:"event" bson:"event"`
+	ActorID   *primitive.ObjectID    `json:"actor_id" bson:"actor_id"`
+	ActorType string                 `json:"actor_type" bson:"actor_type"` // rider, driver, system, admin
+	Details   map[string]interface{} `json:"details" bson:"details"`
+	CreatedAt time.Time              `json:"created_at" bson:"created_at"`
+}
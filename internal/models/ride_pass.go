@@ -0,0 +1,149 @@
+package models
+
+import (
+	"strings"
+	"time"
+
+	"goride/pkg/money"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type RidePassInterval string
+type RidePassStatus string
+
+const (
+	RidePassIntervalWeek  RidePassInterval = "week"
+	RidePassIntervalMonth RidePassInterval = "month"
+	RidePassIntervalYear  RidePassInterval = "year"
+
+	RidePassStatusPending   RidePassStatus = "pending" // first payment not confirmed yet, no benefits
+	RidePassStatusActive    RidePassStatus = "active"
+	RidePassStatusPastDue   RidePassStatus = "past_due" // renewal failed, benefits kept until the grace period ends
+	RidePassStatusCancelled RidePassStatus = "cancelled"
+	RidePassStatusExpired   RidePassStatus = "expired"
+)
+
+// RidePassPlan is a subscription product riders buy for a recurring price.
+type RidePassPlan struct {
+	ID              primitive.ObjectID  `json:"id" bson:"_id,omitempty"`
+	Name            string              `json:"name" bson:"name" validate:"required"`
+	Description     string              `json:"description" bson:"description"`
+	Price           money.Money         `json:"price" bson:"price" validate:"required"`
+	Interval        RidePassInterval    `json:"interval" bson:"interval" validate:"required,oneof=week month year"`
+	GracePeriodDays int                 `json:"grace_period_days" bson:"grace_period_days"` // benefits kept while a failed renewal is retried
+	Benefits        RidePassBenefits    `json:"benefits" bson:"benefits"`
+	IsActive        bool                `json:"is_active" bson:"is_active" default:"true"`
+	CreatedBy       *primitive.ObjectID `json:"created_by" bson:"created_by"`
+	CreatedAt       time.Time           `json:"created_at" bson:"created_at"`
+	UpdatedAt       time.Time           `json:"updated_at" bson:"updated_at"`
+}
+
+// RidePassBenefits are applied to every eligible ride of a subscriber. The
+// platform funds them, so they do not reduce driver earnings.
+type RidePassBenefits struct {
+	DiscountPercent float64     `json:"discount_percent" bson:"discount_percent" validate:"min=0,max=100"` // off the trip fare
+	MaxDiscount     money.Money `json:"max_discount" bson:"max_discount"`                                  // per ride, zero for no cap
+	WaiveBookingFee bool        `json:"waive_booking_fee" bson:"waive_booking_fee"`
+	SurgeCap        float64     `json:"surge_cap" bson:"surge_cap"`   // highest multiplier charged, zero for no cap
+	Cities          []string    `json:"cities" bson:"cities"`         // empty for every city
+	RideTypes       []RideType  `json:"ride_types" bson:"ride_types"` // empty for every ride type
+}
+
+// RidePassSubscription is a rider's pass. The plan's price and benefits are
+// copied at subscription and renewal, so editing a plan does not change the
+// period a rider has already paid for.
+type RidePassSubscription struct {
+	ID                 primitive.ObjectID  `json:"id" bson:"_id,omitempty"`
+	RiderID            primitive.ObjectID  `json:"rider_id" bson:"rider_id"` // user ID
+	PlanID             primitive.ObjectID  `json:"plan_id" bson:"plan_id"`
+	PlanName           string              `json:"plan_name" bson:"plan_name"`
+	Price              money.Money         `json:"price" bson:"price"`
+	Interval           RidePassInterval    `json:"interval" bson:"interval"`
+	GracePeriodDays    int                 `json:"grace_period_days" bson:"grace_period_days"`
+	Benefits           RidePassBenefits    `json:"benefits" bson:"benefits"`
+	Status             RidePassStatus      `json:"status" bson:"status"`
+	PaymentMethodID    primitive.ObjectID  `json:"payment_method_id" bson:"payment_method_id"`
+	CurrentPeriodStart time.Time           `json:"current_period_start" bson:"current_period_start"`
+	CurrentPeriodEnd   time.Time           `json:"current_period_end" bson:"current_period_end"`
+	GraceUntil         *time.Time          `json:"grace_until" bson:"grace_until"`
+	CancelAtPeriodEnd  bool                `json:"cancel_at_period_end" bson:"cancel_at_period_end"`
+	CancelledAt        *time.Time          `json:"cancelled_at" bson:"cancelled_at"`
+	RenewalAttempts    int                 `json:"renewal_attempts" bson:"renewal_attempts"`
+	LastRenewalAttempt *time.Time          `json:"last_renewal_attempt" bson:"last_renewal_attempt"`
+	PendingPaymentID   *primitive.ObjectID `json:"pending_payment_id" bson:"pending_payment_id"` // charge waiting for the provider's answer
+	Periods            []RidePassPeriod    `json:"periods" bson:"periods"`
+	CreatedAt          time.Time           `json:"created_at" bson:"created_at"`
+	UpdatedAt          time.Time           `json:"updated_at" bson:"updated_at"`
+}
+
+// RidePassPeriod is one billing period. Amount is what was charged for it,
+// after any credit carried over from a plan change.
+type RidePassPeriod struct {
+	Start     time.Time           `json:"start" bson:"start"`
+	End       time.Time           `json:"end" bson:"end"`
+	PlanID    primitive.ObjectID  `json:"plan_id" bson:"plan_id"`
+	Amount    money.Money         `json:"amount" bson:"amount"`
+	Credit    money.Money         `json:"credit" bson:"credit"` // prorated unused value of the previous plan
+	Refunded  money.Money         `json:"refunded" bson:"refunded"`
+	PaymentID *primitive.ObjectID `json:"payment_id" bson:"payment_id"`
+}
+
+// Next returns the end of a billing period starting at the given time.
+func (i RidePassInterval) Next(start time.Time) time.Time {
+	switch i {
+	case RidePassIntervalWeek:
+		return start.AddDate(0, 0, 7)
+	case RidePassIntervalYear:
+		return start.AddDate(1, 0, 0)
+	default:
+		return start.AddDate(0, 1, 0)
+	}
+}
+
+// IsEntitled reports whether the subscriber gets the pass benefits at the
+// given time. A pass past due keeps its benefits until its grace period ends.
+func (s *RidePassSubscription) IsEntitled(at time.Time) bool {
+	if at.Before(s.CurrentPeriodStart) {
+		return false
+	}
+
+	switch s.Status {
+	case RidePassStatusActive:
+		if at.Before(s.CurrentPeriodEnd) {
+			return true
+		}
+		// A renewal not attempted yet is covered by the grace period too
+		return !s.CancelAtPeriodEnd && at.Before(s.CurrentPeriodEnd.AddDate(0, 0, s.GracePeriodDays))
+	case RidePassStatusPastDue:
+		return s.GraceUntil != nil && at.Before(*s.GraceUntil)
+	default:
+		return false
+	}
+}
+
+// AppliesTo reports whether the benefits cover a city and ride type.
+func (b *RidePassBenefits) AppliesTo(city string, rideType RideType) bool {
+	if len(b.Cities) > 0 {
+		matched := false
+		for _, target := range b.Cities {
+			if strings.EqualFold(target, city) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+
+	if len(b.RideTypes) == 0 {
+		return true
+	}
+	for _, target := range b.RideTypes {
+		if target == rideType {
+			return true
+		}
+	}
+	return false
+}
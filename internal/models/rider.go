@@ -42,4 +42,5 @@ type RidePreferences struct {
 	AllowPetFriendly    bool     `json:"allow_pet_friendly" bson:"allow_pet_friendly"`
 	AllowSharedRides    bool     `json:"allow_shared_rides" bson:"allow_shared_rides"`
 	PreferFemaleDrivers bool     `json:"prefer_female_drivers" bson:"prefer_female_drivers"`
+	AlwaysRequirePIN    bool     `json:"always_require_pin" bson:"always_require_pin"`
 }
@@ -17,9 +17,26 @@ type Route struct {
 	TrafficDuration   int                `json:"traffic_duration" bson:"traffic_duration"`
 	Steps             []RouteStep        `json:"steps" bson:"steps"`
 	Bounds            *RouteBounds       `json:"bounds" bson:"bounds"`
+	Stops             []RouteStop        `json:"stops" bson:"stops"` // ordered pickups/dropoffs of a shared ride
 	CreatedAt         time.Time          `json:"created_at" bson:"created_at"`
 }
 
+type RouteStopType string
+
+const (
+	RouteStopTypePickup  RouteStopType = "pickup"
+	RouteStopTypeDropoff RouteStopType = "dropoff"
+)
+
+type RouteStop struct {
+	RideID      primitive.ObjectID `json:"ride_id" bson:"ride_id"`
+	RiderID     primitive.ObjectID `json:"rider_id" bson:"rider_id"`
+	Type        RouteStopType      `json:"type" bson:"type"`
+	Location    Location           `json:"location" bson:"location"`
+	ETA         *time.Time         `json:"eta" bson:"eta"`
+	CompletedAt *time.Time         `json:"completed_at" bson:"completed_at"`
+}
+
 type RouteStep struct {
 	Instruction      string    `json:"instruction" bson:"instruction"`
 	Distance         float64   `json:"distance" bson:"distance"`
@@ -0,0 +1,61 @@
+package models
+
+import (
+	"time"
+
+	"goride/pkg/money"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type SurchargeType string
+
+const (
+	SurchargeTypeAirportPickup  SurchargeType = "airport_pickup"  // trip starts in the geofence
+	SurchargeTypeAirportDropoff SurchargeType = "airport_dropoff" // trip ends in the geofence
+	SurchargeTypeCongestion     SurchargeType = "congestion"      // trip starts, ends or passes through the geofence
+	SurchargeTypeToll           SurchargeType = "toll"            // route crosses the geofence
+	SurchargeTypeFixedRoute     SurchargeType = "fixed_route"     // flat fare between two geofences
+)
+
+// SurchargeRule adds a fee to trips that touch a geofence, or for fixed routes
+// replaces the metered fare of trips between two geofences.
+type SurchargeRule struct {
+	ID                    primitive.ObjectID  `json:"id" bson:"_id,omitempty"`
+	Name                  string              `json:"name" bson:"name" validate:"required"`
+	Type                  SurchargeType       `json:"type" bson:"type" validate:"required"`
+	GeofenceID            primitive.ObjectID  `json:"geofence_id" bson:"geofence_id" validate:"required"`
+	DestinationGeofenceID *primitive.ObjectID `json:"destination_geofence_id" bson:"destination_geofence_id"` // other end of a fixed route
+	Bidirectional         bool                `json:"bidirectional" bson:"bidirectional" default:"false"`     // fixed route also applies in reverse
+	City                  string              `json:"city" bson:"city"`
+	RideTypes             []RideType          `json:"ride_types" bson:"ride_types"` // empty applies to every ride type
+	Amount                money.Money         `json:"amount" bson:"amount" validate:"required"`
+	IsActive              bool                `json:"is_active" bson:"is_active" default:"true"`
+	EffectiveFrom         time.Time           `json:"effective_from" bson:"effective_from"`
+	EffectiveUntil        *time.Time          `json:"effective_until" bson:"effective_until"`
+	CreatedBy             *primitive.ObjectID `json:"created_by" bson:"created_by"`
+	CreatedAt             time.Time           `json:"created_at" bson:"created_at"`
+	UpdatedAt             time.Time           `json:"updated_at" bson:"updated_at"`
+}
+
+// AppliesTo reports whether the rule covers a ride type.
+func (r *SurchargeRule) AppliesTo(rideType RideType) bool {
+	if len(r.RideTypes) == 0 {
+		return true
+	}
+	for _, applicable := range r.RideTypes {
+		if applicable == rideType {
+			return true
+		}
+	}
+	return false
+}
+
+// FareSurcharge is one surcharge line on a fare breakdown or payment.
+type FareSurcharge struct {
+	RuleID     primitive.ObjectID `json:"rule_id" bson:"rule_id"`
+	Name       string             `json:"name" bson:"name"`
+	Type       SurchargeType      `json:"type" bson:"type"`
+	GeofenceID primitive.ObjectID `json:"geofence_id" bson:"geofence_id"`
+	Amount     money.Money        `json:"amount" bson:"amount"`
+}
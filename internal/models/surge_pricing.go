@@ -9,6 +9,7 @@ type SurgePricing struct {
 	ID           primitive.ObjectID `json:"id" bson:"_id,omitempty"`
 	Area         string             `json:"area" bson:"area" validate:"required"`
 	GeofenceID   primitive.ObjectID `json:"geofence_id" bson:"geofence_id"`
+	CellIDs      []string           `json:"cell_ids" bson:"cell_ids"` // hexgrid cells covering the geofence
 	RideTypes    []RideType         `json:"ride_types" bson:"ride_types"`
 	Multiplier   float64            `json:"multiplier" bson:"multiplier" validate:"required,min=1"`
 	Demand       int                `json:"demand" bson:"demand"`
@@ -17,6 +18,10 @@ type SurgePricing struct {
 	StartTime    time.Time          `json:"start_time" bson:"start_time"`
 	EndTime      *time.Time         `json:"end_time" bson:"end_time"`
 	Reason       string             `json:"reason" bson:"reason"`
+	TargetMultiplier float64        `json:"target_multiplier" bson:"target_multiplier"` // curve value before smoothing and stepping
+	IsOverride   bool               `json:"is_override" bson:"is_override" default:"false"`
+	OverriddenBy *primitive.ObjectID `json:"overridden_by" bson:"overridden_by"`
+	ExpiresAt    *time.Time         `json:"expires_at" bson:"expires_at"` // when an override lapses
 	CreatedAt    time.Time          `json:"created_at" bson:"created_at"`
 	UpdatedAt    time.Time          `json:"updated_at" bson:"updated_at"`
 }
\ No newline at end of file
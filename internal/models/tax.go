@@ -0,0 +1,90 @@
+package models
+
+import (
+	"strings"
+	"time"
+
+	"goride/pkg/money"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// TaxComponent is a part of what a rider pays that a jurisdiction may tax on
+// its own terms.
+type TaxComponent string
+
+const (
+	TaxComponentRide            TaxComponent = "ride"             // metered or fixed fare, surge and fare adjustment
+	TaxComponentBookingFee      TaxComponent = "booking_fee"      // platform booking fee
+	TaxComponentWaiting         TaxComponent = "waiting"          // waiting charge
+	TaxComponentToll            TaxComponent = "toll"             // tolls, including toll surcharges
+	TaxComponentSurcharge       TaxComponent = "surcharge"        // airport and congestion surcharges
+	TaxComponentTip             TaxComponent = "tip"              // tips
+	TaxComponentCancellationFee TaxComponent = "cancellation_fee" // rider cancellation fee
+)
+
+// TaxRule is a tax levied by one jurisdiction. A rule applies where every
+// jurisdiction field it sets matches the trip's pickup, so a state rule with
+// only Country and Region set stacks with a city rule that also sets City.
+// Inclusive rules treat the taxed amounts as already containing the tax;
+// exclusive rules add it on top.
+type TaxRule struct {
+	ID             primitive.ObjectID  `json:"id" bson:"_id,omitempty"`
+	Name           string              `json:"name" bson:"name" validate:"required"`
+	TaxCode        string              `json:"tax_code" bson:"tax_code"` // code the tax is filed under
+	Country        string              `json:"country" bson:"country"`
+	Region         string              `json:"region" bson:"region"` // state or province
+	City           string              `json:"city" bson:"city"`
+	GeofenceID     *primitive.ObjectID `json:"geofence_id" bson:"geofence_id"`
+	Rate           float64             `json:"rate" bson:"rate" validate:"required"` // percent
+	Inclusive      bool                `json:"inclusive" bson:"inclusive" default:"false"`
+	Components     []TaxComponent      `json:"components" bson:"components" validate:"required"`
+	IsActive       bool                `json:"is_active" bson:"is_active" default:"true"`
+	EffectiveFrom  time.Time           `json:"effective_from" bson:"effective_from"`
+	EffectiveUntil *time.Time          `json:"effective_until" bson:"effective_until"`
+	CreatedBy      *primitive.ObjectID `json:"created_by" bson:"created_by"`
+	CreatedAt      time.Time           `json:"created_at" bson:"created_at"`
+	UpdatedAt      time.Time           `json:"updated_at" bson:"updated_at"`
+}
+
+// Taxes reports whether the rule taxes a component.
+func (r *TaxRule) Taxes(component TaxComponent) bool {
+	for _, taxed := range r.Components {
+		if taxed == component {
+			return true
+		}
+	}
+	return false
+}
+
+// Jurisdiction names the rule's jurisdiction, such as "US/CA/San Francisco",
+// for receipts and filing reports.
+func (r *TaxRule) Jurisdiction() string {
+	var parts []string
+	for _, part := range []string{r.Country, r.Region, r.City} {
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+	if r.GeofenceID != nil {
+		parts = append(parts, "geofence:"+r.GeofenceID.Hex())
+	}
+	if len(parts) == 0 {
+		return "default"
+	}
+	return strings.Join(parts, "/")
+}
+
+// TaxLine is one tax on a receipt. Inclusive lines are already part of the
+// fare; exclusive lines were added to it.
+type TaxLine struct {
+	RuleID        primitive.ObjectID `json:"rule_id" bson:"rule_id"`
+	Name          string             `json:"name" bson:"name"`
+	TaxCode       string             `json:"tax_code" bson:"tax_code"`
+	Jurisdiction  string             `json:"jurisdiction" bson:"jurisdiction"`
+	Rate          float64            `json:"rate" bson:"rate"` // percent
+	Inclusive     bool               `json:"inclusive" bson:"inclusive"`
+	Components    []TaxComponent     `json:"components" bson:"components"` // components the line was levied on
+	TaxableAmount money.Money        `json:"taxable_amount" bson:"taxable_amount"`
+	Amount        money.Money        `json:"amount" bson:"amount"`
+}
@@ -3,6 +3,8 @@ package models
 import (
 	"time"
 
+	"goride/pkg/money"
+
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 type TransactionType string
@@ -19,19 +21,25 @@ const (
 )
 
 type Transaction struct {
-	ID            primitive.ObjectID `json:"id" bson:"_id,omitempty"`
-	UserID        primitive.ObjectID `json:"user_id" bson:"user_id" validate:"required"`
-	PaymentID     *primitive.ObjectID `json:"payment_id" bson:"payment_id"`
-	RideID        *primitive.ObjectID `json:"ride_id" bson:"ride_id"`
-	Type          TransactionType    `json:"type" bson:"type" validate:"required"`
-	Status        TransactionStatus  `json:"status" bson:"status" default:"pending"`
-	Amount        float64            `json:"amount" bson:"amount" validate:"required"`
-	Currency      string             `json:"currency" bson:"currency" default:"USD"`
-	Description   string             `json:"description" bson:"description"`
-	Reference     string             `json:"reference" bson:"reference"`
-	BalanceBefore float64            `json:"balance_before" bson:"balance_before"`
-	BalanceAfter  float64            `json:"balance_after" bson:"balance_after"`
-	ProcessedAt   *time.Time         `json:"processed_at" bson:"processed_at"`
-	CreatedAt     time.Time          `json:"created_at" bson:"created_at"`
-	UpdatedAt     time.Time          `json:"updated_at" bson:"updated_at"`
+	ID                primitive.ObjectID  `json:"id" bson:"_id,omitempty"`
+	UserID            primitive.ObjectID  `json:"user_id" bson:"user_id"`
+	WalletID          primitive.ObjectID  `json:"wallet_id" bson:"wallet_id"`
+	AccountType       LedgerAccountType   `json:"account_type" bson:"account_type"`
+	EntryID           *primitive.ObjectID `json:"entry_id" bson:"entry_id"` // ledger entry the posting belongs to
+	PaymentID         *primitive.ObjectID `json:"payment_id" bson:"payment_id"`
+	RideID            *primitive.ObjectID `json:"ride_id" bson:"ride_id"`
+	Type              TransactionType     `json:"type" bson:"type" validate:"required"`
+	Status            TransactionStatus   `json:"status" bson:"status" default:"pending"`
+	Amount            money.Money         `json:"amount" bson:"amount" validate:"required"`
+	Currency          string              `json:"currency" bson:"currency" default:"USD"`
+	ExchangeRate      *ExchangeRate       `json:"exchange_rate" bson:"exchange_rate"` // snapshot taken at charge time
+	ReportingCurrency string              `json:"reporting_currency" bson:"reporting_currency"`
+	ReportingAmount   money.Money         `json:"reporting_amount" bson:"reporting_amount"`
+	Description       string              `json:"description" bson:"description"`
+	Reference         string              `json:"reference" bson:"reference"`
+	BalanceBefore     money.Money         `json:"balance_before" bson:"balance_before"`
+	BalanceAfter      money.Money         `json:"balance_after" bson:"balance_after"`
+	ProcessedAt       *time.Time          `json:"processed_at" bson:"processed_at"`
+	CreatedAt         time.Time           `json:"created_at" bson:"created_at"`
+	UpdatedAt         time.Time           `json:"updated_at" bson:"updated_at"`
 }
@@ -3,14 +3,21 @@ package models
 import (
 	"time"
 
+	"goride/pkg/money"
+
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
+// Wallet is a ledger account. Users hold wallets and cash in transit; the
+// platform's accounts have no user. Balance only changes through ledger
+// postings, and Version guards it against concurrent writers.
 type Wallet struct {
-	ID        primitive.ObjectID `json:"id" bson:"_id,omitempty"`
-	UserID    primitive.ObjectID `json:"user_id" bson:"user_id" validate:"required"`
-	Balance   float64            `json:"balance" bson:"balance" default:"0"`
-	Currency  string             `json:"currency" bson:"currency" default:"USD"`
-	IsActive  bool               `json:"is_active" bson:"is_active" default:"true"`
-	CreatedAt time.Time          `json:"created_at" bson:"created_at"`
-	UpdatedAt time.Time          `json:"updated_at" bson:"updated_at"`
-}
\ No newline at end of file
+	ID          primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	UserID      primitive.ObjectID `json:"user_id" bson:"user_id"`
+	AccountType LedgerAccountType  `json:"account_type" bson:"account_type" validate:"required"`
+	Balance     money.Money        `json:"balance" bson:"balance" default:"0"`
+	Currency    string             `json:"currency" bson:"currency" default:"USD"`
+	Version     int64              `json:"version" bson:"version"`
+	IsActive    bool               `json:"is_active" bson:"is_active" default:"true"`
+	CreatedAt   time.Time          `json:"created_at" bson:"created_at"`
+	UpdatedAt   time.Time          `json:"updated_at" bson:"updated_at"`
+}
@@ -39,6 +39,11 @@ type AnalyticsRepository interface {
 	GetPopularPickupAreas(ctx context.Context, city string, days int, limit int) ([]map[string]interface{}, error)
 	GetPopularDropoffAreas(ctx context.Context, city string, days int, limit int) ([]map[string]interface{}, error)
 
+	// Spatial analytics
+	GetRideAnalyticsByCell(ctx context.Context, cellID string, startDate, endDate time.Time) ([]*models.RideAnalytics, error)
+	UpsertCellRideAnalytics(ctx context.Context, analytics *models.RideAnalytics) error
+	GetRideHeatmap(ctx context.Context, city string, days int, resolution int) ([]map[string]interface{}, error)
+
 	// Revenue analytics
 	GetRevenueStats(ctx context.Context, days int) (map[string]interface{}, error)
 	GetRevenueTrends(ctx context.Context, days int) ([]map[string]interface{}, error)
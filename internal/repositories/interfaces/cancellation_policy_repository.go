@@ -0,0 +1,22 @@
+package interfaces
+
+import (
+	"context"
+
+	"goride/internal/models"
+	"goride/internal/utils"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type CancellationPolicyRepository interface {
+	// Basic CRUD operations
+	Create(ctx context.Context, policy *models.CancellationPolicy) error
+	GetByID(ctx context.Context, id primitive.ObjectID) (*models.CancellationPolicy, error)
+	Update(ctx context.Context, id primitive.ObjectID, updates map[string]interface{}) error
+	Delete(ctx context.Context, id primitive.ObjectID) error
+
+	// Lookup operations
+	GetPolicy(ctx context.Context, city string, rideType models.RideType) (*models.CancellationPolicy, error)
+	List(ctx context.Context, params *utils.PaginationParams) ([]*models.CancellationPolicy, int64, error)
+}
@@ -0,0 +1,22 @@
+package interfaces
+
+import (
+	"context"
+
+	"goride/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type FareSplitRepository interface {
+	// Basic CRUD operations
+	Create(ctx context.Context, split *models.FareSplit) error
+	GetByID(ctx context.Context, id primitive.ObjectID) (*models.FareSplit, error)
+	Update(ctx context.Context, id primitive.ObjectID, updates map[string]interface{}) error
+
+	// Ride association
+	GetByRideID(ctx context.Context, rideID primitive.ObjectID) (*models.FareSplit, error)
+
+	// Participants
+	UpdateOpenParticipant(ctx context.Context, id, userID primitive.ObjectID, status models.FareSplitParticipantStatus, updates map[string]interface{}) error
+}
@@ -0,0 +1,24 @@
+package interfaces
+
+import (
+	"context"
+	"time"
+
+	"goride/internal/models"
+	"goride/internal/utils"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type FareStructureRepository interface {
+	// Basic CRUD operations
+	Create(ctx context.Context, fareStructure *models.FareStructure) error
+	GetByID(ctx context.Context, id primitive.ObjectID) (*models.FareStructure, error)
+	Update(ctx context.Context, id primitive.ObjectID, updates map[string]interface{}) error
+	Delete(ctx context.Context, id primitive.ObjectID) error
+
+	// Lookup operations
+	GetActive(ctx context.Context, city string, rideType models.RideType, at time.Time) (*models.FareStructure, error)
+	GetByCity(ctx context.Context, city string, params *utils.PaginationParams) ([]*models.FareStructure, int64, error)
+	List(ctx context.Context, params *utils.PaginationParams) ([]*models.FareStructure, int64, error)
+}
@@ -0,0 +1,22 @@
+package interfaces
+
+import (
+	"context"
+
+	"goride/internal/models"
+	"goride/internal/utils"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type GeofenceRepository interface {
+	// Basic CRUD operations
+	Create(ctx context.Context, geofence *models.Geofence) error
+	GetByID(ctx context.Context, id primitive.ObjectID) (*models.Geofence, error)
+	Update(ctx context.Context, id primitive.ObjectID, updates map[string]interface{}) error
+	Delete(ctx context.Context, id primitive.ObjectID) error
+
+	// Lookup operations
+	GetActive(ctx context.Context) ([]*models.Geofence, error)
+	List(ctx context.Context, params *utils.PaginationParams) ([]*models.Geofence, int64, error)
+}
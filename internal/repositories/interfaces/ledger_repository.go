@@ -0,0 +1,31 @@
+package interfaces
+
+import (
+	"context"
+	"time"
+
+	"goride/internal/models"
+	"goride/internal/utils"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type LedgerRepository interface {
+	// Accounts
+	GetAccount(ctx context.Context, accountType models.LedgerAccountType, userID primitive.ObjectID, currency string) (*models.Wallet, error)
+	GetAccountsByUser(ctx context.Context, userID primitive.ObjectID) ([]*models.Wallet, error)
+	GetAccountsByType(ctx context.Context, accountType models.LedgerAccountType) ([]*models.Wallet, error)
+	GetTransactions(ctx context.Context, walletID primitive.ObjectID, params *utils.PaginationParams) ([]*models.Transaction, int64, error)
+	GetAccountActivity(ctx context.Context, walletID primitive.ObjectID, from, to time.Time) ([]models.LedgerActivity, error)
+
+	// Entries
+	PostEntry(ctx context.Context, entry *models.LedgerEntry, postings []models.LedgerPosting) ([]*models.Transaction, error)
+	GetEntryByID(ctx context.Context, id primitive.ObjectID) (*models.LedgerEntry, error)
+	GetEntryByReference(ctx context.Context, reference string) (*models.LedgerEntry, error)
+
+	// Invariants
+	GetTotals(ctx context.Context) ([]models.LedgerTotal, error)
+	GetUnbalancedEntries(ctx context.Context) ([]primitive.ObjectID, error)
+	GetDriftedAccounts(ctx context.Context) ([]models.LedgerDrift, error)
+	CreateCheck(ctx context.Context, check *models.LedgerCheck) error
+}
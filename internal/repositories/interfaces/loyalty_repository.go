@@ -0,0 +1,19 @@
+package interfaces
+
+import (
+	"context"
+
+	"goride/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type LoyaltyRepository interface {
+	// Basic CRUD operations
+	Create(ctx context.Context, program *models.LoyaltyProgram) error
+	GetByID(ctx context.Context, id primitive.ObjectID) (*models.LoyaltyProgram, error)
+	Update(ctx context.Context, id primitive.ObjectID, updates map[string]interface{}) error
+
+	// Program lookup
+	GetActiveProgram(ctx context.Context) (*models.LoyaltyProgram, error)
+}
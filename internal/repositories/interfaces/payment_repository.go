@@ -6,6 +6,7 @@ import (
 
 	"goride/internal/models"
 	"goride/internal/utils"
+	"goride/pkg/money"
 
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
@@ -13,6 +14,7 @@ import (
 type PaymentRepository interface {
 	// Basic CRUD operations
 	Create(ctx context.Context, payment *models.Payment) error
+	CreateAttempt(ctx context.Context, payment *models.Payment) error
 	GetByID(ctx context.Context, id primitive.ObjectID) (*models.Payment, error)
 	Update(ctx context.Context, id primitive.ObjectID, updates map[string]interface{}) error
 	Delete(ctx context.Context, id primitive.ObjectID) error
@@ -20,6 +22,7 @@ type PaymentRepository interface {
 	// Transaction operations
 	GetByTransactionID(ctx context.Context, transactionID string) (*models.Payment, error)
 	GetByExternalID(ctx context.Context, externalID string) (*models.Payment, error)
+	GetByIdempotencyKey(ctx context.Context, key string) (*models.Payment, error)
 	UpdateStatus(ctx context.Context, id primitive.ObjectID, status models.PaymentStatus) error
 
 	// Ride association
@@ -37,6 +40,8 @@ type PaymentRepository interface {
 	// Status filtering
 	GetByStatus(ctx context.Context, status models.PaymentStatus, params *utils.PaginationParams) ([]*models.Payment, int64, error)
 	GetPendingPayments(ctx context.Context) ([]*models.Payment, error)
+	GetAuthorizedPayments(ctx context.Context, authorizedBefore time.Time, limit int) ([]*models.Payment, error)
+	GetPendingAttempts(ctx context.Context, createdBefore time.Time, limit int) ([]*models.Payment, error)
 	GetFailedPayments(ctx context.Context, params *utils.PaginationParams) ([]*models.Payment, int64, error)
 
 	// Time-based queries
@@ -44,13 +49,15 @@ type PaymentRepository interface {
 	GetDailyPayments(ctx context.Context, date time.Time) ([]*models.Payment, error)
 
 	// Refund operations
-	ProcessRefund(ctx context.Context, id primitive.ObjectID, refundAmount float64, reason string) error
+	ProcessRefund(ctx context.Context, id primitive.ObjectID, refundAmount money.Money, reason string) error
 	GetRefunds(ctx context.Context, params *utils.PaginationParams) ([]*models.Payment, int64, error)
 
 	// Financial reporting
 	GetRevenueStats(ctx context.Context, startDate, endDate time.Time) (map[string]interface{}, error)
 	GetPaymentStats(ctx context.Context, startDate, endDate time.Time) (map[string]interface{}, error)
 	GetDriverEarnings(ctx context.Context, driverID primitive.ObjectID, startDate, endDate time.Time) (map[string]interface{}, error)
+	GetRevenueByCurrency(ctx context.Context, startDate, endDate time.Time) ([]map[string]interface{}, error)
+	GetTaxByJurisdiction(ctx context.Context, startDate, endDate time.Time) ([]map[string]interface{}, error)
 
 	// Analytics
 	GetTotalRevenue(ctx context.Context, startDate, endDate time.Time) (float64, error)
@@ -0,0 +1,23 @@
+package interfaces
+
+import (
+	"context"
+	"time"
+
+	"goride/internal/models"
+	"goride/internal/utils"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type PaymentWebhookRepository interface {
+	// Events
+	CreateEvent(ctx context.Context, event *models.PaymentWebhookEvent) (bool, error)
+	GetEventByID(ctx context.Context, id primitive.ObjectID) (*models.PaymentWebhookEvent, error)
+	GetEventByEventID(ctx context.Context, provider, eventID string) (*models.PaymentWebhookEvent, error)
+	UpdateEvent(ctx context.Context, id primitive.ObjectID, updates map[string]interface{}) error
+	GetEventsByStatus(ctx context.Context, status models.PaymentWebhookStatus, params *utils.PaginationParams) ([]*models.PaymentWebhookEvent, int64, error)
+
+	// Processing
+	GetDueEvents(ctx context.Context, before time.Time, limit int) ([]*models.PaymentWebhookEvent, error)
+}
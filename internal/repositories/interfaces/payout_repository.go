@@ -0,0 +1,30 @@
+package interfaces
+
+import (
+	"context"
+	"time"
+
+	"goride/internal/models"
+	"goride/internal/utils"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type PayoutRepository interface {
+	// Batches
+	CreateBatch(ctx context.Context, batch *models.PayoutBatch) error
+	UpdateBatch(ctx context.Context, id primitive.ObjectID, updates map[string]interface{}) error
+	GetLatestBatch(ctx context.Context) (*models.PayoutBatch, error)
+	ListBatches(ctx context.Context, params *utils.PaginationParams) ([]*models.PayoutBatch, int64, error)
+
+	// Payouts
+	CreatePayout(ctx context.Context, payout *models.Payout) error
+	GetPayoutByID(ctx context.Context, id primitive.ObjectID) (*models.Payout, error)
+	UpdatePayout(ctx context.Context, id primitive.ObjectID, status models.PayoutStatus, updates map[string]interface{}) error
+	GetPayoutsByDriver(ctx context.Context, driverID primitive.ObjectID, params *utils.PaginationParams) ([]*models.Payout, int64, error)
+	GetPayoutsByBatch(ctx context.Context, batchID primitive.ObjectID, params *utils.PaginationParams) ([]*models.Payout, int64, error)
+	GetInstantPayoutsSince(ctx context.Context, driverID primitive.ObjectID, since time.Time) ([]*models.Payout, error)
+
+	// Tracking
+	GetPayoutsByStatus(ctx context.Context, status models.PayoutStatus, since, before time.Time, limit int) ([]*models.Payout, error)
+}
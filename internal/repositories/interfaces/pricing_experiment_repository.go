@@ -0,0 +1,29 @@
+package interfaces
+
+import (
+	"context"
+	"time"
+
+	"goride/internal/models"
+	"goride/internal/utils"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type PricingExperimentRepository interface {
+	// Basic CRUD operations
+	Create(ctx context.Context, experiment *models.PricingExperiment) error
+	GetByID(ctx context.Context, id primitive.ObjectID) (*models.PricingExperiment, error)
+	Update(ctx context.Context, id primitive.ObjectID, updates map[string]interface{}) error
+	List(ctx context.Context, params *utils.PaginationParams) ([]*models.PricingExperiment, int64, error)
+
+	// Lookup operations
+	GetRunning(ctx context.Context, at time.Time) ([]*models.PricingExperiment, error)
+
+	// Exposures
+	CreateExposure(ctx context.Context, exposure *models.PricingExperimentExposure) error
+	MarkConverted(ctx context.Context, quoteID string, rideID primitive.ObjectID, at time.Time) error
+
+	// Reporting
+	GetArmStats(ctx context.Context, experimentID primitive.ObjectID) ([]map[string]interface{}, error)
+}
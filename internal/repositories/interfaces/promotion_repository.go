@@ -6,6 +6,7 @@ import (
 
 	"goride/internal/models"
 	"goride/internal/utils"
+	"goride/pkg/money"
 
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
@@ -32,7 +33,7 @@ type PromotionRepository interface {
 
 	// Type and applicability
 	GetByType(ctx context.Context, promotionType models.PromotionType, params *utils.PaginationParams) ([]*models.Promotion, int64, error)
-	GetApplicablePromotions(ctx context.Context, userType models.UserType, rideType string, amount float64) ([]*models.Promotion, error)
+	GetApplicablePromotions(ctx context.Context, userType models.UserType, rideType string, amount money.Money) ([]*models.Promotion, error)
 
 	// Time-based queries
 	GetValidPromotions(ctx context.Context, checkTime time.Time) ([]*models.Promotion, error)
@@ -0,0 +1,30 @@
+package interfaces
+
+import (
+	"context"
+	"time"
+
+	"goride/internal/models"
+	"goride/internal/utils"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type RidePassRepository interface {
+	// Plans
+	CreatePlan(ctx context.Context, plan *models.RidePassPlan) error
+	GetPlanByID(ctx context.Context, id primitive.ObjectID) (*models.RidePassPlan, error)
+	UpdatePlan(ctx context.Context, id primitive.ObjectID, updates map[string]interface{}) error
+	ListPlans(ctx context.Context, activeOnly bool, params *utils.PaginationParams) ([]*models.RidePassPlan, int64, error)
+
+	// Subscriptions
+	CreateSubscription(ctx context.Context, subscription *models.RidePassSubscription) error
+	GetSubscriptionByID(ctx context.Context, id primitive.ObjectID) (*models.RidePassSubscription, error)
+	UpdateSubscription(ctx context.Context, id primitive.ObjectID, updates map[string]interface{}) error
+	AppendPeriod(ctx context.Context, id primitive.ObjectID, period *models.RidePassPeriod, updates map[string]interface{}) error
+	GetCurrentSubscriptions(ctx context.Context, riderID primitive.ObjectID) ([]*models.RidePassSubscription, error)
+	GetSubscriptionsByRider(ctx context.Context, riderID primitive.ObjectID, params *utils.PaginationParams) ([]*models.RidePassSubscription, int64, error)
+
+	// Billing
+	GetDueSubscriptions(ctx context.Context, at time.Time, limit int) ([]*models.RidePassSubscription, error)
+}
@@ -30,12 +30,16 @@ type RideRepository interface {
 	AddWaypoint(ctx context.Context, id primitive.ObjectID, waypoint *models.Location) error
 	RemoveWaypoint(ctx context.Context, id primitive.ObjectID, waypointIndex int) error
 
+	// History operations
+	AddHistoryEntry(ctx context.Context, id primitive.ObjectID, entry *models.RideHistoryEntry) error
+
 	// Search and filtering
 	GetByRider(ctx context.Context, riderID primitive.ObjectID, params *utils.PaginationParams) ([]*models.Ride, int64, error)
 	GetByDriver(ctx context.Context, driverID primitive.ObjectID, params *utils.PaginationParams) ([]*models.Ride, int64, error)
 	GetByStatus(ctx context.Context, status models.RideStatus, params *utils.PaginationParams) ([]*models.Ride, int64, error)
 	GetActiveRides(ctx context.Context) ([]*models.Ride, error)
 	GetPendingRides(ctx context.Context) ([]*models.Ride, error)
+	GetUnsettledPoolRides(ctx context.Context) ([]*models.Ride, error)
 
 	// Time-based queries
 	GetRidesByDateRange(ctx context.Context, startDate, endDate time.Time, params *utils.PaginationParams) ([]*models.Ride, int64, error)
@@ -51,6 +55,7 @@ type RideRepository interface {
 	GetRevenueStats(ctx context.Context, startDate, endDate time.Time) (map[string]interface{}, error)
 	GetPopularRoutes(ctx context.Context, limit int, days int) ([]map[string]interface{}, error)
 	GetPeakHours(ctx context.Context, days int) ([]map[string]interface{}, error)
+	GetRidePassSavings(ctx context.Context, subscriptionID primitive.ObjectID, boundaries []time.Time) ([]map[string]interface{}, error)
 
 	// Ratings
 	UpdateRiderRating(ctx context.Context, id primitive.ObjectID, rating float64) error
@@ -0,0 +1,23 @@
+package interfaces
+
+import (
+	"context"
+	"time"
+
+	"goride/internal/models"
+	"goride/internal/utils"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type SurchargeRuleRepository interface {
+	// Basic CRUD operations
+	Create(ctx context.Context, rule *models.SurchargeRule) error
+	GetByID(ctx context.Context, id primitive.ObjectID) (*models.SurchargeRule, error)
+	Update(ctx context.Context, id primitive.ObjectID, updates map[string]interface{}) error
+	Delete(ctx context.Context, id primitive.ObjectID) error
+
+	// Lookup operations
+	GetActive(ctx context.Context, city string, at time.Time) ([]*models.SurchargeRule, error)
+	List(ctx context.Context, city string, params *utils.PaginationParams) ([]*models.SurchargeRule, int64, error)
+}
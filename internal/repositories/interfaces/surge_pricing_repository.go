@@ -0,0 +1,28 @@
+package interfaces
+
+import (
+	"context"
+	"time"
+
+	"goride/internal/models"
+	"goride/internal/utils"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type SurgePricingRepository interface {
+	// Basic CRUD operations
+	Create(ctx context.Context, surge *models.SurgePricing) error
+	GetByID(ctx context.Context, id primitive.ObjectID) (*models.SurgePricing, error)
+	Update(ctx context.Context, id primitive.ObjectID, updates map[string]interface{}) error
+
+	// Lifecycle operations
+	End(ctx context.Context, id primitive.ObjectID, endTime time.Time) error
+
+	// Lookup operations
+	GetCurrent(ctx context.Context, geofenceID primitive.ObjectID) (*models.SurgePricing, error)
+	GetLastEnded(ctx context.Context, geofenceID primitive.ObjectID) (*models.SurgePricing, error)
+	GetActive(ctx context.Context) ([]*models.SurgePricing, error)
+	GetActiveByCell(ctx context.Context, cellID string) ([]*models.SurgePricing, error)
+	GetHistory(ctx context.Context, geofenceID primitive.ObjectID, params *utils.PaginationParams) ([]*models.SurgePricing, int64, error)
+}
@@ -0,0 +1,23 @@
+package interfaces
+
+import (
+	"context"
+	"time"
+
+	"goride/internal/models"
+	"goride/internal/utils"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type TaxRuleRepository interface {
+	// Basic CRUD operations
+	Create(ctx context.Context, rule *models.TaxRule) error
+	GetByID(ctx context.Context, id primitive.ObjectID) (*models.TaxRule, error)
+	Update(ctx context.Context, id primitive.ObjectID, updates map[string]interface{}) error
+	Delete(ctx context.Context, id primitive.ObjectID) error
+
+	// Lookup operations
+	GetActive(ctx context.Context, at time.Time) ([]*models.TaxRule, error)
+	List(ctx context.Context, country string, params *utils.PaginationParams) ([]*models.TaxRule, int64, error)
+}
@@ -3,12 +3,14 @@ package mongodb
 import (
 	"context"
 	"fmt"
+	"sort"
 	"time"
 
 	"goride/internal/models"
 	"goride/internal/repositories/interfaces"
 	"goride/internal/services"
 	"goride/internal/utils"
+	"goride/pkg/hexgrid"
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -103,7 +105,8 @@ func (r *analyticsRepository) GetRideAnalyticsByDate(ctx context.Context, date t
 			"$gte": utils.GetStartOfDay(date),
 			"$lt":  utils.GetEndOfDay(date),
 		},
-		"city": city,
+		"city":    city,
+		"cell_id": nil, // city-wide rollup
 	}
 
 	var analytics models.RideAnalytics
@@ -124,6 +127,7 @@ func (r *analyticsRepository) GetRideAnalyticsByDateRange(ctx context.Context, s
 			"$gte": startDate,
 			"$lte": endDate,
 		},
+		"cell_id": nil, // city-wide rollups
 	}
 
 	if city != "" {
@@ -154,7 +158,8 @@ func (r *analyticsRepository) UpdateRideAnalytics(ctx context.Context, date time
 			"$gte": utils.GetStartOfDay(date),
 			"$lt":  utils.GetEndOfDay(date),
 		},
-		"city": city,
+		"city":    city,
+		"cell_id": nil, // city-wide rollup
 	}
 
 	updates["updated_at"] = time.Now()
@@ -704,6 +709,171 @@ func (r *analyticsRepository) GetPopularDropoffAreas(ctx context.Context, city s
 	return results, nil
 }
 
+// Spatial analytics
+func (r *analyticsRepository) GetRideAnalyticsByCell(ctx context.Context, cellID string, startDate, endDate time.Time) ([]*models.RideAnalytics, error) {
+	filter := bson.M{
+		"cell_id": cellID,
+		"date": bson.M{
+			"$gte": startDate,
+			"$lte": endDate,
+		},
+	}
+
+	cursor, err := r.rideAnalyticsCollection.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "date", Value: 1}}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to find cell ride analytics: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var analytics []*models.RideAnalytics
+	for cursor.Next(ctx) {
+		var item models.RideAnalytics
+		if err := cursor.Decode(&item); err != nil {
+			return nil, fmt.Errorf("failed to decode ride analytics: %w", err)
+		}
+		analytics = append(analytics, &item)
+	}
+
+	return analytics, nil
+}
+
+// UpsertCellRideAnalytics writes the day's rollup for one cell, replacing any
+// earlier one.
+func (r *analyticsRepository) UpsertCellRideAnalytics(ctx context.Context, analytics *models.RideAnalytics) error {
+	if analytics.CellID == "" {
+		return fmt.Errorf("cell rollup requires a cell ID")
+	}
+
+	filter := bson.M{
+		"date": bson.M{
+			"$gte": utils.GetStartOfDay(analytics.Date),
+			"$lt":  utils.GetEndOfDay(analytics.Date),
+		},
+		"city":    analytics.City,
+		"cell_id": analytics.CellID,
+	}
+
+	now := time.Now()
+	_, err := r.rideAnalyticsCollection.UpdateOne(
+		ctx,
+		filter,
+		bson.M{
+			"$set": bson.M{
+				"date":                  analytics.Date,
+				"total_rides":           analytics.TotalRides,
+				"completed_rides":       analytics.CompletedRides,
+				"cancelled_rides":       analytics.CancelledRides,
+				"total_revenue":         analytics.TotalRevenue,
+				"average_ride_value":    analytics.AverageRideValue,
+				"average_ride_time":     analytics.AverageRideTime,
+				"average_ride_distance": analytics.AverageRideDistance,
+				"peak_hours":            analytics.PeakHours,
+				"popular_routes":        analytics.PopularRoutes,
+				"updated_at":            now,
+			},
+			"$setOnInsert": bson.M{"created_at": now},
+		},
+		options.Update().SetUpsert(true),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to upsert cell ride analytics: %w", err)
+	}
+
+	return nil
+}
+
+// GetRideHeatmap counts rides by pickup cell. Rides are stored with cells at
+// utils.CellResolution, so coarser resolutions are rolled up to their parents.
+func (r *analyticsRepository) GetRideHeatmap(ctx context.Context, city string, days int, resolution int) ([]map[string]interface{}, error) {
+	if resolution < 0 || resolution > utils.CellResolution {
+		return nil, fmt.Errorf("heatmap resolution must be between 0 and %d", utils.CellResolution)
+	}
+
+	startDate := time.Now().AddDate(0, 0, -days)
+	match := bson.M{
+		"created_at":              bson.M{"$gte": startDate},
+		"pickup_location.cell_id": bson.M{"$exists": true},
+	}
+	if city != "" {
+		match["pickup_location.city"] = city
+	}
+
+	ridesCollection := r.eventsCollection.Database().Collection("rides")
+
+	pipeline := mongo.Pipeline{
+		{{"$match", match}},
+		{{"$group", bson.M{
+			"_id":        "$pickup_location.cell_id",
+			"ride_count": bson.M{"$sum": 1},
+			"completed_rides": bson.M{"$sum": bson.M{
+				"$cond": []interface{}{bson.M{"$eq": []interface{}{"$status", models.RideStatusCompleted}}, 1, 0},
+			}},
+			"revenue": bson.M{"$sum": "$final_fare"},
+		}}},
+	}
+
+	cursor, err := ridesCollection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get ride heatmap: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	type cellStats struct {
+		rides     int64
+		completed int64
+		revenue   float64
+	}
+	stats := make(map[hexgrid.Cell]*cellStats)
+
+	for cursor.Next(ctx) {
+		var result struct {
+			CellID         string  `bson:"_id"`
+			RideCount      int64   `bson:"ride_count"`
+			CompletedRides int64   `bson:"completed_rides"`
+			Revenue        float64 `bson:"revenue"`
+		}
+		if err := cursor.Decode(&result); err != nil {
+			return nil, fmt.Errorf("failed to decode heatmap cell: %w", err)
+		}
+
+		cell, err := hexgrid.ParseCell(result.CellID)
+		if err != nil {
+			continue
+		}
+		if cell.Resolution() > resolution {
+			if cell, err = cell.Parent(resolution); err != nil {
+				continue
+			}
+		}
+
+		if stats[cell] == nil {
+			stats[cell] = &cellStats{}
+		}
+		stats[cell].rides += result.RideCount
+		stats[cell].completed += result.CompletedRides
+		stats[cell].revenue += result.Revenue
+	}
+
+	results := make([]map[string]interface{}, 0, len(stats))
+	for cell, entry := range stats {
+		results = append(results, map[string]interface{}{
+			"cell_id":         cell.String(),
+			"resolution":      cell.Resolution(),
+			"ride_count":      entry.rides,
+			"completed_rides": entry.completed,
+			"revenue":         entry.revenue,
+			"center":          cell.LatLng(),
+			"boundary":        cell.Boundary(),
+		})
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		return results[i]["ride_count"].(int64) > results[j]["ride_count"].(int64)
+	})
+
+	return results, nil
+}
+
 // Revenue analytics
 func (r *analyticsRepository) GetRevenueStats(ctx context.Context, days int) (map[string]interface{}, error) {
 	startDate := time.Now().AddDate(0, 0, -days)
@@ -0,0 +1,148 @@
+package mongodb
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"time"
+
+	"goride/internal/models"
+	"goride/internal/repositories/interfaces"
+	"goride/internal/services"
+	"goride/internal/utils"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type cancellationPolicyRepository struct {
+	collection *mongo.Collection
+	cache      services.CacheService
+}
+
+func NewCancellationPolicyRepository(db *mongo.Database, cache services.CacheService) interfaces.CancellationPolicyRepository {
+	return &cancellationPolicyRepository{
+		collection: db.Collection("cancellation_policies"),
+		cache:      cache,
+	}
+}
+
+// Basic CRUD operations
+func (r *cancellationPolicyRepository) Create(ctx context.Context, policy *models.CancellationPolicy) error {
+	policy.ID = primitive.NewObjectID()
+	policy.CreatedAt = time.Now()
+	policy.UpdatedAt = time.Now()
+
+	_, err := r.collection.InsertOne(ctx, policy)
+	if err != nil {
+		return fmt.Errorf("failed to create cancellation policy: %w", err)
+	}
+
+	return nil
+}
+
+func (r *cancellationPolicyRepository) GetByID(ctx context.Context, id primitive.ObjectID) (*models.CancellationPolicy, error) {
+	var policy models.CancellationPolicy
+	err := r.collection.FindOne(ctx, bson.M{"_id": id}).Decode(&policy)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, fmt.Errorf("cancellation policy not found")
+		}
+		return nil, fmt.Errorf("failed to get cancellation policy: %w", err)
+	}
+
+	return &policy, nil
+}
+
+func (r *cancellationPolicyRepository) Update(ctx context.Context, id primitive.ObjectID, updates map[string]interface{}) error {
+	updates["updated_at"] = time.Now()
+
+	result, err := r.collection.UpdateOne(
+		ctx,
+		bson.M{"_id": id},
+		bson.M{"$set": updates},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update cancellation policy: %w", err)
+	}
+
+	if result.MatchedCount == 0 {
+		return fmt.Errorf("cancellation policy not found")
+	}
+
+	return nil
+}
+
+func (r *cancellationPolicyRepository) Delete(ctx context.Context, id primitive.ObjectID) error {
+	result, err := r.collection.DeleteOne(ctx, bson.M{"_id": id})
+	if err != nil {
+		return fmt.Errorf("failed to delete cancellation policy: %w", err)
+	}
+
+	if result.DeletedCount == 0 {
+		return fmt.Errorf("cancellation policy not found")
+	}
+
+	return nil
+}
+
+// Lookup operations
+
+// GetPolicy returns the most specific active policy for a city and ride type,
+// falling back to policies with an empty city or ride type.
+func (r *cancellationPolicyRepository) GetPolicy(ctx context.Context, city string, rideType models.RideType) (*models.CancellationPolicy, error) {
+	filter := bson.M{
+		"is_active": true,
+		"city": bson.M{"$in": []interface{}{
+			primitive.Regex{Pattern: "^" + regexp.QuoteMeta(city) + "$", Options: "i"},
+			"",
+		}},
+		"ride_type": bson.M{"$in": []models.RideType{rideType, ""}},
+	}
+
+	// Non-empty values sort after empty ones, so descending puts the most
+	// specific match first
+	opts := options.FindOne().SetSort(bson.D{
+		{Key: "city", Value: -1},
+		{Key: "ride_type", Value: -1},
+	})
+
+	var policy models.CancellationPolicy
+	err := r.collection.FindOne(ctx, filter, opts).Decode(&policy)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, fmt.Errorf("cancellation policy not found")
+		}
+		return nil, fmt.Errorf("failed to get cancellation policy: %w", err)
+	}
+
+	return &policy, nil
+}
+
+func (r *cancellationPolicyRepository) List(ctx context.Context, params *utils.PaginationParams) ([]*models.CancellationPolicy, int64, error) {
+	filter := bson.M{}
+
+	total, err := r.collection.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to count cancellation policies: %w", err)
+	}
+
+	cursor, err := r.collection.Find(ctx, filter, params.GetSortOptions())
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to find cancellation policies: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var policies []*models.CancellationPolicy
+	for cursor.Next(ctx) {
+		var policy models.CancellationPolicy
+		if err := cursor.Decode(&policy); err != nil {
+			return nil, 0, fmt.Errorf("failed to decode cancellation policy: %w", err)
+		}
+		policies = append(policies, &policy)
+	}
+
+	return policies, total, nil
+}
@@ -123,6 +123,8 @@ func (r *driverRepository) Delete(ctx context.Context, id primitive.ObjectID) er
 
 // Location operations
 func (r *driverRepository) UpdateLocation(ctx context.Context, id primitive.ObjectID, location *models.Location) error {
+	location.AssignCell(utils.CellResolution)
+
 	updates := map[string]interface{}{
 		"current_location":     location,
 		"last_location_update": time.Now(),
@@ -0,0 +1,117 @@
+package mongodb
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"goride/internal/models"
+	"goride/internal/repositories/interfaces"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type fareSplitRepository struct {
+	collection *mongo.Collection
+}
+
+func NewFareSplitRepository(db *mongo.Database) interfaces.FareSplitRepository {
+	return &fareSplitRepository{
+		collection: db.Collection("fare_splits"),
+	}
+}
+
+// Basic CRUD operations
+func (r *fareSplitRepository) Create(ctx context.Context, split *models.FareSplit) error {
+	split.ID = primitive.NewObjectID()
+	split.CreatedAt = time.Now()
+	split.UpdatedAt = time.Now()
+
+	_, err := r.collection.InsertOne(ctx, split)
+	if err != nil {
+		return fmt.Errorf("failed to create fare split: %w", err)
+	}
+
+	return nil
+}
+
+func (r *fareSplitRepository) GetByID(ctx context.Context, id primitive.ObjectID) (*models.FareSplit, error) {
+	var split models.FareSplit
+	err := r.collection.FindOne(ctx, bson.M{"_id": id}).Decode(&split)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, fmt.Errorf("fare split not found")
+		}
+		return nil, fmt.Errorf("failed to get fare split: %w", err)
+	}
+
+	return &split, nil
+}
+
+func (r *fareSplitRepository) Update(ctx context.Context, id primitive.ObjectID, updates map[string]interface{}) error {
+	updates["updated_at"] = time.Now()
+
+	result, err := r.collection.UpdateOne(
+		ctx,
+		bson.M{"_id": id},
+		bson.M{"$set": updates},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update fare split: %w", err)
+	}
+	if result.MatchedCount == 0 {
+		return fmt.Errorf("fare split not found")
+	}
+
+	return nil
+}
+
+// Ride association
+func (r *fareSplitRepository) GetByRideID(ctx context.Context, rideID primitive.ObjectID) (*models.FareSplit, error) {
+	var split models.FareSplit
+	err := r.collection.FindOne(ctx, bson.M{"ride_id": rideID}).Decode(&split)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, fmt.Errorf("fare split not found")
+		}
+		return nil, fmt.Errorf("failed to get fare split: %w", err)
+	}
+
+	return &split, nil
+}
+
+// Participants
+
+// UpdateOpenParticipant updates a participant of a split that is still open,
+// provided the participant is in the given status. The check and the update
+// are one operation, so an invitation cannot be answered twice or after the
+// split was settled.
+func (r *fareSplitRepository) UpdateOpenParticipant(ctx context.Context, id, userID primitive.ObjectID, status models.FareSplitParticipantStatus, updates map[string]interface{}) error {
+	set := bson.M{"updated_at": time.Now()}
+	for field, value := range updates {
+		set["participants.$."+field] = value
+	}
+
+	result, err := r.collection.UpdateOne(
+		ctx,
+		bson.M{
+			"_id":    id,
+			"status": models.FareSplitStatusOpen,
+			"participants": bson.M{"$elemMatch": bson.M{
+				"user_id": userID,
+				"status":  status,
+			}},
+		},
+		bson.M{"$set": set},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update fare split participant: %w", err)
+	}
+	if result.MatchedCount == 0 {
+		return fmt.Errorf("no open invitation for this user")
+	}
+
+	return nil
+}
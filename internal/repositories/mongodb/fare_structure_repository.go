@@ -0,0 +1,199 @@
+package mongodb
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"goride/internal/models"
+	"goride/internal/repositories/interfaces"
+	"goride/internal/services"
+	"goride/internal/utils"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type fareStructureRepository struct {
+	collection *mongo.Collection
+	cache      services.CacheService
+}
+
+func NewFareStructureRepository(db *mongo.Database, cache services.CacheService) interfaces.FareStructureRepository {
+	return &fareStructureRepository{
+		collection: db.Collection("fare_structures"),
+		cache:      cache,
+	}
+}
+
+// Basic CRUD operations
+func (r *fareStructureRepository) Create(ctx context.Context, fareStructure *models.FareStructure) error {
+	fareStructure.ID = primitive.NewObjectID()
+	fareStructure.CreatedAt = time.Now()
+	fareStructure.UpdatedAt = time.Now()
+
+	if fareStructure.EffectiveFrom.IsZero() {
+		fareStructure.EffectiveFrom = fareStructure.CreatedAt
+	}
+
+	_, err := r.collection.InsertOne(ctx, fareStructure)
+	if err != nil {
+		return fmt.Errorf("failed to create fare structure: %w", err)
+	}
+
+	r.invalidateActiveCache(ctx, fareStructure.City, fareStructure.RideType)
+
+	return nil
+}
+
+func (r *fareStructureRepository) GetByID(ctx context.Context, id primitive.ObjectID) (*models.FareStructure, error) {
+	var fareStructure models.FareStructure
+	err := r.collection.FindOne(ctx, bson.M{"_id": id}).Decode(&fareStructure)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, fmt.Errorf("fare structure not found")
+		}
+		return nil, fmt.Errorf("failed to get fare structure: %w", err)
+	}
+
+	return &fareStructure, nil
+}
+
+func (r *fareStructureRepository) Update(ctx context.Context, id primitive.ObjectID, updates map[string]interface{}) error {
+	existing, err := r.GetByID(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	updates["updated_at"] = time.Now()
+
+	_, err = r.collection.UpdateOne(
+		ctx,
+		bson.M{"_id": id},
+		bson.M{"$set": updates},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update fare structure: %w", err)
+	}
+
+	r.invalidateActiveCache(ctx, existing.City, existing.RideType)
+
+	return nil
+}
+
+func (r *fareStructureRepository) Delete(ctx context.Context, id primitive.ObjectID) error {
+	existing, err := r.GetByID(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.collection.DeleteOne(ctx, bson.M{"_id": id})
+	if err != nil {
+		return fmt.Errorf("failed to delete fare structure: %w", err)
+	}
+
+	r.invalidateActiveCache(ctx, existing.City, existing.RideType)
+
+	return nil
+}
+
+// Lookup operations
+
+// GetActive returns the fare structure in force for a city and ride type at
+// the given time. When effective periods overlap the most recent one wins.
+func (r *fareStructureRepository) GetActive(ctx context.Context, city string, rideType models.RideType, at time.Time) (*models.FareStructure, error) {
+	cacheKey := activeFareCacheKey(city, rideType)
+	if r.cache != nil {
+		var cached models.FareStructure
+		if err := r.cache.Get(ctx, cacheKey, &cached); err == nil && isFareStructureEffective(&cached, at) {
+			return &cached, nil
+		}
+	}
+
+	filter := bson.M{
+		"city":           bson.M{"$regex": "^" + regexp.QuoteMeta(city) + "$", "$options": "i"},
+		"ride_type":      rideType,
+		"is_active":      true,
+		"effective_from": bson.M{"$lte": at},
+		"$or": []bson.M{
+			{"effective_until": nil},
+			{"effective_until": bson.M{"$gt": at}},
+		},
+	}
+
+	opts := options.FindOne().SetSort(bson.D{{Key: "effective_from", Value: -1}})
+
+	var fareStructure models.FareStructure
+	err := r.collection.FindOne(ctx, filter, opts).Decode(&fareStructure)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, fmt.Errorf("no active fare structure for %s %s", city, rideType)
+		}
+		return nil, fmt.Errorf("failed to get active fare structure: %w", err)
+	}
+
+	if r.cache != nil {
+		r.cache.Set(ctx, cacheKey, &fareStructure, 10*time.Minute)
+	}
+
+	return &fareStructure, nil
+}
+
+func (r *fareStructureRepository) GetByCity(ctx context.Context, city string, params *utils.PaginationParams) ([]*models.FareStructure, int64, error) {
+	filter := bson.M{
+		"city": bson.M{"$regex": "^" + regexp.QuoteMeta(city) + "$", "$options": "i"},
+	}
+
+	return r.findFareStructuresWithFilter(ctx, filter, params)
+}
+
+func (r *fareStructureRepository) List(ctx context.Context, params *utils.PaginationParams) ([]*models.FareStructure, int64, error) {
+	return r.findFareStructuresWithFilter(ctx, bson.M{}, params)
+}
+
+// Helper methods
+func (r *fareStructureRepository) findFareStructuresWithFilter(ctx context.Context, filter bson.M, params *utils.PaginationParams) ([]*models.FareStructure, int64, error) {
+	total, err := r.collection.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to count fare structures: %w", err)
+	}
+
+	opts := params.GetSortOptions()
+	cursor, err := r.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to find fare structures: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var fareStructures []*models.FareStructure
+	for cursor.Next(ctx) {
+		var fareStructure models.FareStructure
+		if err := cursor.Decode(&fareStructure); err != nil {
+			return nil, 0, fmt.Errorf("failed to decode fare structure: %w", err)
+		}
+		fareStructures = append(fareStructures, &fareStructure)
+	}
+
+	return fareStructures, total, nil
+}
+
+func (r *fareStructureRepository) invalidateActiveCache(ctx context.Context, city string, rideType models.RideType) {
+	if r.cache != nil {
+		r.cache.Delete(ctx, activeFareCacheKey(city, rideType))
+	}
+}
+
+func activeFareCacheKey(city string, rideType models.RideType) string {
+	return fmt.Sprintf("fare_structure:%s:%s", strings.ToLower(city), rideType)
+}
+
+func isFareStructureEffective(fareStructure *models.FareStructure, at time.Time) bool {
+	if !fareStructure.IsActive || fareStructure.EffectiveFrom.After(at) {
+		return false
+	}
+	return fareStructure.EffectiveUntil == nil || fareStructure.EffectiveUntil.After(at)
+}
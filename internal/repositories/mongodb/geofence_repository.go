@@ -0,0 +1,157 @@
+package mongodb
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"goride/internal/models"
+	"goride/internal/repositories/interfaces"
+	"goride/internal/services"
+	"goride/internal/utils"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const activeGeofencesCacheKey = "geofences:active"
+
+type geofenceRepository struct {
+	collection *mongo.Collection
+	cache      services.CacheService
+}
+
+func NewGeofenceRepository(db *mongo.Database, cache services.CacheService) interfaces.GeofenceRepository {
+	return &geofenceRepository{
+		collection: db.Collection("geofences"),
+		cache:      cache,
+	}
+}
+
+// Basic CRUD operations
+func (r *geofenceRepository) Create(ctx context.Context, geofence *models.Geofence) error {
+	geofence.ID = primitive.NewObjectID()
+	geofence.CreatedAt = time.Now()
+	geofence.UpdatedAt = time.Now()
+
+	_, err := r.collection.InsertOne(ctx, geofence)
+	if err != nil {
+		return fmt.Errorf("failed to create geofence: %w", err)
+	}
+
+	r.invalidateActiveCache(ctx)
+
+	return nil
+}
+
+func (r *geofenceRepository) GetByID(ctx context.Context, id primitive.ObjectID) (*models.Geofence, error) {
+	var geofence models.Geofence
+	err := r.collection.FindOne(ctx, bson.M{"_id": id}).Decode(&geofence)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, fmt.Errorf("geofence not found")
+		}
+		return nil, fmt.Errorf("failed to get geofence: %w", err)
+	}
+
+	return &geofence, nil
+}
+
+func (r *geofenceRepository) Update(ctx context.Context, id primitive.ObjectID, updates map[string]interface{}) error {
+	updates["updated_at"] = time.Now()
+
+	result, err := r.collection.UpdateOne(
+		ctx,
+		bson.M{"_id": id},
+		bson.M{"$set": updates},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update geofence: %w", err)
+	}
+
+	if result.MatchedCount == 0 {
+		return fmt.Errorf("geofence not found")
+	}
+
+	r.invalidateActiveCache(ctx)
+
+	return nil
+}
+
+func (r *geofenceRepository) Delete(ctx context.Context, id primitive.ObjectID) error {
+	result, err := r.collection.DeleteOne(ctx, bson.M{"_id": id})
+	if err != nil {
+		return fmt.Errorf("failed to delete geofence: %w", err)
+	}
+
+	if result.DeletedCount == 0 {
+		return fmt.Errorf("geofence not found")
+	}
+
+	r.invalidateActiveCache(ctx)
+
+	return nil
+}
+
+// Lookup operations
+func (r *geofenceRepository) GetActive(ctx context.Context) ([]*models.Geofence, error) {
+	if r.cache != nil {
+		var cached []*models.Geofence
+		if err := r.cache.Get(ctx, activeGeofencesCacheKey, &cached); err == nil {
+			return cached, nil
+		}
+	}
+
+	cursor, err := r.collection.Find(ctx, bson.M{"is_active": true})
+	if err != nil {
+		return nil, fmt.Errorf("failed to find active geofences: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var geofences []*models.Geofence
+	for cursor.Next(ctx) {
+		var geofence models.Geofence
+		if err := cursor.Decode(&geofence); err != nil {
+			return nil, fmt.Errorf("failed to decode geofence: %w", err)
+		}
+		geofences = append(geofences, &geofence)
+	}
+
+	if r.cache != nil {
+		r.cache.Set(ctx, activeGeofencesCacheKey, geofences, 10*time.Minute)
+	}
+
+	return geofences, nil
+}
+
+func (r *geofenceRepository) List(ctx context.Context, params *utils.PaginationParams) ([]*models.Geofence, int64, error) {
+	total, err := r.collection.CountDocuments(ctx, bson.M{})
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to count geofences: %w", err)
+	}
+
+	cursor, err := r.collection.Find(ctx, bson.M{}, params.GetSortOptions())
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to find geofences: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var geofences []*models.Geofence
+	for cursor.Next(ctx) {
+		var geofence models.Geofence
+		if err := cursor.Decode(&geofence); err != nil {
+			return nil, 0, fmt.Errorf("failed to decode geofence: %w", err)
+		}
+		geofences = append(geofences, &geofence)
+	}
+
+	return geofences, total, nil
+}
+
+// Cache operations
+func (r *geofenceRepository) invalidateActiveCache(ctx context.Context) {
+	if r.cache != nil {
+		r.cache.Delete(ctx, activeGeofencesCacheKey)
+	}
+}
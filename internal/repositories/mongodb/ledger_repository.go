@@ -0,0 +1,556 @@
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"goride/internal/models"
+	"goride/internal/repositories/interfaces"
+	"goride/internal/utils"
+	"goride/pkg/money"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// maxLedgerPostingAttempts bounds the retries of an entry whose account was
+// changed between being read and being written.
+const maxLedgerPostingAttempts = 3
+
+var errLedgerConflict = errors.New("ledger account was modified concurrently")
+
+// signedAmount is a posting's amount in minor units, negative for debits.
+var signedAmount = bson.M{"$cond": bson.A{
+	bson.M{"$eq": bson.A{"$type", models.TransactionTypeDebit}},
+	bson.M{"$multiply": bson.A{"$amount.amount", -1}},
+	"$amount.amount",
+}}
+
+type ledgerRepository struct {
+	accounts     *mongo.Collection
+	transactions *mongo.Collection
+	entries      *mongo.Collection
+	checks       *mongo.Collection
+}
+
+func NewLedgerRepository(db *mongo.Database) interfaces.LedgerRepository {
+	return &ledgerRepository{
+		accounts:     db.Collection("wallets"),
+		transactions: db.Collection("transactions"),
+		entries:      db.Collection("ledger_entries"),
+		checks:       db.Collection("ledger_checks"),
+	}
+}
+
+// Accounts
+func (r *ledgerRepository) GetAccount(ctx context.Context, accountType models.LedgerAccountType, userID primitive.ObjectID, currency string) (*models.Wallet, error) {
+	filter := bson.M{
+		"account_type": accountType,
+		"user_id":      userID,
+		"currency":     currency,
+	}
+
+	var account models.Wallet
+	err := r.accounts.FindOne(ctx, filter).Decode(&account)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, fmt.Errorf("ledger account not found")
+		}
+		return nil, fmt.Errorf("failed to get ledger account: %w", err)
+	}
+
+	return &account, nil
+}
+
+func (r *ledgerRepository) GetAccountsByUser(ctx context.Context, userID primitive.ObjectID) ([]*models.Wallet, error) {
+	cursor, err := r.accounts.Find(ctx, bson.M{"user_id": userID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to find ledger accounts: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var accounts []*models.Wallet
+	for cursor.Next(ctx) {
+		var account models.Wallet
+		if err := cursor.Decode(&account); err != nil {
+			return nil, fmt.Errorf("failed to decode ledger account: %w", err)
+		}
+		accounts = append(accounts, &account)
+	}
+
+	return accounts, nil
+}
+
+func (r *ledgerRepository) GetAccountsByType(ctx context.Context, accountType models.LedgerAccountType) ([]*models.Wallet, error) {
+	cursor, err := r.accounts.Find(ctx, bson.M{"account_type": accountType})
+	if err != nil {
+		return nil, fmt.Errorf("failed to find ledger accounts: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var accounts []*models.Wallet
+	for cursor.Next(ctx) {
+		var account models.Wallet
+		if err := cursor.Decode(&account); err != nil {
+			return nil, fmt.Errorf("failed to decode ledger account: %w", err)
+		}
+		accounts = append(accounts, &account)
+	}
+
+	return accounts, nil
+}
+
+func (r *ledgerRepository) GetTransactions(ctx context.Context, walletID primitive.ObjectID, params *utils.PaginationParams) ([]*models.Transaction, int64, error) {
+	filter := bson.M{"wallet_id": walletID}
+
+	total, err := r.transactions.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to count transactions: %w", err)
+	}
+
+	cursor, err := r.transactions.Find(ctx, filter, params.GetSortOptions())
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to find transactions: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var transactions []*models.Transaction
+	for cursor.Next(ctx) {
+		var transaction models.Transaction
+		if err := cursor.Decode(&transaction); err != nil {
+			return nil, 0, fmt.Errorf("failed to decode transaction: %w", err)
+		}
+		transactions = append(transactions, &transaction)
+	}
+
+	return transactions, total, nil
+}
+
+// GetAccountActivity nets an account's postings made in [from, to) by the
+// type of their entry and, for payments, the payment method.
+func (r *ledgerRepository) GetAccountActivity(ctx context.Context, walletID primitive.ObjectID, from, to time.Time) ([]models.LedgerActivity, error) {
+	cursor, err := r.transactions.Aggregate(ctx, mongo.Pipeline{
+		{{"$match", bson.M{
+			"wallet_id":  walletID,
+			"entry_id":   bson.M{"$ne": nil},
+			"created_at": bson.M{"$gte": from, "$lt": to},
+		}}},
+		{{"$lookup", bson.M{
+			"from":         "ledger_entries",
+			"localField":   "entry_id",
+			"foreignField": "_id",
+			"as":           "entry",
+		}}},
+		{{"$unwind", "$entry"}},
+		{{"$group", bson.M{
+			"_id": bson.M{
+				"entry_type":     "$entry.type",
+				"payment_method": "$entry.payment_method",
+			},
+			"currency": bson.M{"$first": "$currency"},
+			"amount":   bson.M{"$sum": signedAmount},
+			"postings": bson.M{"$sum": 1},
+		}}},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get ledger account activity: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var activity []models.LedgerActivity
+	for cursor.Next(ctx) {
+		var result struct {
+			ID struct {
+				EntryType     models.LedgerEntryType `bson:"entry_type"`
+				PaymentMethod models.PaymentMethod   `bson:"payment_method"`
+			} `bson:"_id"`
+			Currency string `bson:"currency"`
+			Amount   int64  `bson:"amount"`
+			Postings int64  `bson:"postings"`
+		}
+		if err := cursor.Decode(&result); err != nil {
+			return nil, fmt.Errorf("failed to decode ledger account activity: %w", err)
+		}
+
+		activity = append(activity, models.LedgerActivity{
+			EntryType:     result.ID.EntryType,
+			PaymentMethod: result.ID.PaymentMethod,
+			Amount:        money.New(result.Amount, result.Currency),
+			Postings:      result.Postings,
+		})
+	}
+
+	return activity, nil
+}
+
+// Entries
+
+// PostEntry writes a balanced entry in a single multi-document transaction:
+// every account balance is moved with a compare-and-set on its version, one
+// transaction is recorded per posting and the entry links them. Nothing is
+// written unless all of it is.
+func (r *ledgerRepository) PostEntry(ctx context.Context, entry *models.LedgerEntry, postings []models.LedgerPosting) ([]*models.Transaction, error) {
+	if err := validateLedgerPostings(entry.Currency, postings); err != nil {
+		return nil, err
+	}
+
+	var transactions []*models.Transaction
+	var err error
+	for attempt := 0; attempt < maxLedgerPostingAttempts; attempt++ {
+		transactions, err = r.postEntry(ctx, entry, postings)
+		if !errors.Is(err, errLedgerConflict) {
+			break
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to post ledger entry: %w", err)
+	}
+
+	return transactions, nil
+}
+
+func (r *ledgerRepository) GetEntryByID(ctx context.Context, id primitive.ObjectID) (*models.LedgerEntry, error) {
+	return r.findEntry(ctx, bson.M{"_id": id})
+}
+
+func (r *ledgerRepository) GetEntryByReference(ctx context.Context, reference string) (*models.LedgerEntry, error) {
+	return r.findEntry(ctx, bson.M{"reference": reference})
+}
+
+// Invariants
+
+// GetTotals sums, per currency, the balances of all accounts and the signed
+// amounts of all postings.
+func (r *ledgerRepository) GetTotals(ctx context.Context) ([]models.LedgerTotal, error) {
+	totals := make(map[string]*models.LedgerTotal)
+	total := func(currency string) *models.LedgerTotal {
+		if totals[currency] == nil {
+			totals[currency] = &models.LedgerTotal{
+				Currency: currency,
+				Balance:  money.Zero(currency),
+				Postings: money.Zero(currency),
+			}
+		}
+		return totals[currency]
+	}
+
+	balances, err := r.accounts.Aggregate(ctx, mongo.Pipeline{
+		{{"$group", bson.M{
+			"_id":      "$currency",
+			"accounts": bson.M{"$sum": 1},
+			"balance":  bson.M{"$sum": "$balance.amount"},
+		}}},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to sum ledger balances: %w", err)
+	}
+	defer balances.Close(ctx)
+
+	for balances.Next(ctx) {
+		var result struct {
+			Currency string `bson:"_id"`
+			Accounts int64  `bson:"accounts"`
+			Balance  int64  `bson:"balance"`
+		}
+		if err := balances.Decode(&result); err != nil {
+			return nil, fmt.Errorf("failed to decode ledger balance: %w", err)
+		}
+
+		line := total(result.Currency)
+		line.Accounts = result.Accounts
+		line.Balance = money.New(result.Balance, result.Currency)
+	}
+
+	postings, err := r.transactions.Aggregate(ctx, mongo.Pipeline{
+		{{"$match", bson.M{"entry_id": bson.M{"$ne": nil}}}},
+		{{"$group", bson.M{
+			"_id":      "$currency",
+			"postings": bson.M{"$sum": signedAmount},
+		}}},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to sum ledger postings: %w", err)
+	}
+	defer postings.Close(ctx)
+
+	for postings.Next(ctx) {
+		var result struct {
+			Currency string `bson:"_id"`
+			Postings int64  `bson:"postings"`
+		}
+		if err := postings.Decode(&result); err != nil {
+			return nil, fmt.Errorf("failed to decode ledger postings: %w", err)
+		}
+
+		total(result.Currency).Postings = money.New(result.Postings, result.Currency)
+	}
+
+	var results []models.LedgerTotal
+	for _, line := range totals {
+		results = append(results, *line)
+	}
+	return results, nil
+}
+
+// GetUnbalancedEntries returns the entries whose postings do not sum to zero.
+func (r *ledgerRepository) GetUnbalancedEntries(ctx context.Context) ([]primitive.ObjectID, error) {
+	cursor, err := r.transactions.Aggregate(ctx, mongo.Pipeline{
+		{{"$match", bson.M{"entry_id": bson.M{"$ne": nil}}}},
+		{{"$group", bson.M{
+			"_id":   "$entry_id",
+			"total": bson.M{"$sum": signedAmount},
+		}}},
+		{{"$match", bson.M{"total": bson.M{"$ne": 0}}}},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to find unbalanced ledger entries: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var entryIDs []primitive.ObjectID
+	for cursor.Next(ctx) {
+		var result struct {
+			EntryID primitive.ObjectID `bson:"_id"`
+		}
+		if err := cursor.Decode(&result); err != nil {
+			return nil, fmt.Errorf("failed to decode unbalanced ledger entry: %w", err)
+		}
+		entryIDs = append(entryIDs, result.EntryID)
+	}
+
+	return entryIDs, nil
+}
+
+// GetDriftedAccounts returns the accounts whose balance is not the sum of
+// their postings.
+func (r *ledgerRepository) GetDriftedAccounts(ctx context.Context) ([]models.LedgerDrift, error) {
+	cursor, err := r.accounts.Aggregate(ctx, mongo.Pipeline{
+		{{"$lookup", bson.M{
+			"from": "transactions",
+			"let":  bson.M{"wallet_id": "$_id"},
+			"pipeline": bson.A{
+				bson.M{"$match": bson.M{"$expr": bson.M{"$eq": bson.A{"$wallet_id", "$$wallet_id"}}}},
+				bson.M{"$group": bson.M{"_id": nil, "total": bson.M{"$sum": signedAmount}}},
+			},
+			"as": "postings",
+		}}},
+		{{"$project", bson.M{
+			"balance":  "$balance.amount",
+			"currency": 1,
+			"postings": bson.M{"$ifNull": bson.A{bson.M{"$arrayElemAt": bson.A{"$postings.total", 0}}, 0}},
+		}}},
+		{{"$match", bson.M{"$expr": bson.M{"$ne": bson.A{"$balance", "$postings"}}}}},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to find drifted ledger accounts: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var drifts []models.LedgerDrift
+	for cursor.Next(ctx) {
+		var result struct {
+			WalletID primitive.ObjectID `bson:"_id"`
+			Currency string             `bson:"currency"`
+			Balance  int64              `bson:"balance"`
+			Postings int64              `bson:"postings"`
+		}
+		if err := cursor.Decode(&result); err != nil {
+			return nil, fmt.Errorf("failed to decode drifted ledger account: %w", err)
+		}
+
+		drifts = append(drifts, models.LedgerDrift{
+			WalletID: result.WalletID,
+			Balance:  money.New(result.Balance, result.Currency),
+			Postings: money.New(result.Postings, result.Currency),
+		})
+	}
+
+	return drifts, nil
+}
+
+func (r *ledgerRepository) CreateCheck(ctx context.Context, check *models.LedgerCheck) error {
+	check.ID = primitive.NewObjectID()
+
+	_, err := r.checks.InsertOne(ctx, check)
+	if err != nil {
+		return fmt.Errorf("failed to create ledger check: %w", err)
+	}
+
+	return nil
+}
+
+// Helper methods
+func (r *ledgerRepository) postEntry(ctx context.Context, entry *models.LedgerEntry, postings []models.LedgerPosting) ([]*models.Transaction, error) {
+	session, err := r.accounts.Database().Client().StartSession()
+	if err != nil {
+		return nil, fmt.Errorf("failed to start session: %w", err)
+	}
+	defer session.EndSession(ctx)
+
+	result, err := session.WithTransaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+		now := time.Now()
+		entry.ID = primitive.NewObjectID()
+		entry.TransactionIDs = nil
+		entry.CreatedAt = now
+
+		var transactions []*models.Transaction
+		for _, posting := range postings {
+			account, err := r.openAccount(sc, posting.AccountType, posting.UserID, entry.Currency)
+			if err != nil {
+				return nil, err
+			}
+
+			balance, err := account.Balance.Add(posting.Amount)
+			if err != nil {
+				return nil, err
+			}
+			if balance.IsNegative() && (posting.RequireFunds || !posting.AccountType.AllowsNegative()) {
+				return nil, fmt.Errorf("insufficient balance in %s account", posting.AccountType)
+			}
+
+			updated, err := r.accounts.UpdateOne(
+				sc,
+				bson.M{"_id": account.ID, "version": account.Version},
+				bson.M{
+					"$set": bson.M{"balance": balance, "updated_at": now},
+					"$inc": bson.M{"version": 1},
+				},
+			)
+			if err != nil {
+				return nil, fmt.Errorf("failed to update ledger account: %w", err)
+			}
+			if updated.MatchedCount == 0 {
+				return nil, errLedgerConflict
+			}
+
+			transactionType := models.TransactionTypeCredit
+			if posting.Amount.IsNegative() {
+				transactionType = models.TransactionTypeDebit
+			}
+			transaction := &models.Transaction{
+				ID:            primitive.NewObjectID(),
+				UserID:        posting.UserID,
+				WalletID:      account.ID,
+				AccountType:   posting.AccountType,
+				EntryID:       &entry.ID,
+				PaymentID:     entry.PaymentID,
+				RideID:        entry.RideID,
+				Type:          transactionType,
+				Status:        models.TransactionStatusCompleted,
+				Amount:        posting.Amount.Abs(),
+				Currency:      entry.Currency,
+				Description:   entry.Description,
+				Reference:     entry.Reference,
+				BalanceBefore: account.Balance,
+				BalanceAfter:  balance,
+				ProcessedAt:   &now,
+				CreatedAt:     now,
+				UpdatedAt:     now,
+			}
+			if entry.ExchangeRate != nil {
+				transaction.ExchangeRate = entry.ExchangeRate
+				transaction.ReportingCurrency = entry.ExchangeRate.To
+				transaction.ReportingAmount = entry.ExchangeRate.Convert(transaction.Amount)
+			}
+			transactions = append(transactions, transaction)
+			entry.TransactionIDs = append(entry.TransactionIDs, transaction.ID)
+		}
+
+		documents := make([]interface{}, len(transactions))
+		for i, transaction := range transactions {
+			documents[i] = transaction
+		}
+		if _, err := r.transactions.InsertMany(sc, documents); err != nil {
+			return nil, fmt.Errorf("failed to create transactions: %w", err)
+		}
+
+		if _, err := r.entries.InsertOne(sc, entry); err != nil {
+			if mongo.IsDuplicateKeyError(err) {
+				return nil, fmt.Errorf("ledger entry %s already posted", entry.Reference)
+			}
+			return nil, fmt.Errorf("failed to create ledger entry: %w", err)
+		}
+
+		return transactions, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result.([]*models.Transaction), nil
+}
+
+// openAccount returns an account, creating it with a zero balance on its
+// first posting.
+func (r *ledgerRepository) openAccount(ctx context.Context, accountType models.LedgerAccountType, userID primitive.ObjectID, currency string) (*models.Wallet, error) {
+	now := time.Now()
+	filter := bson.M{
+		"account_type": accountType,
+		"user_id":      userID,
+		"currency":     currency,
+	}
+	update := bson.M{"$setOnInsert": bson.M{
+		"balance":    money.Zero(currency),
+		"version":    0,
+		"is_active":  true,
+		"created_at": now,
+		"updated_at": now,
+	}}
+	opts := options.FindOneAndUpdate().
+		SetUpsert(true).
+		SetReturnDocument(options.After)
+
+	var account models.Wallet
+	if err := r.accounts.FindOneAndUpdate(ctx, filter, update, opts).Decode(&account); err != nil {
+		return nil, fmt.Errorf("failed to open ledger account: %w", err)
+	}
+
+	return &account, nil
+}
+
+func (r *ledgerRepository) findEntry(ctx context.Context, filter bson.M) (*models.LedgerEntry, error) {
+	var entry models.LedgerEntry
+	err := r.entries.FindOne(ctx, filter).Decode(&entry)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, fmt.Errorf("ledger entry not found")
+		}
+		return nil, fmt.Errorf("failed to get ledger entry: %w", err)
+	}
+
+	return &entry, nil
+}
+
+// validateLedgerPostings checks that an entry is balanced: at least two
+// postings, all in the entry's currency, summing to zero.
+func validateLedgerPostings(currency string, postings []models.LedgerPosting) error {
+	if len(postings) < 2 {
+		return fmt.Errorf("ledger entry needs at least two postings")
+	}
+
+	total := money.Zero(currency)
+	for _, posting := range postings {
+		if posting.AccountType.IsUserAccount() == posting.UserID.IsZero() {
+			return fmt.Errorf("posting to %s account has the wrong owner", posting.AccountType)
+		}
+		if posting.Amount.Currency != currency {
+			return fmt.Errorf("posting in %s does not match entry currency %s", posting.Amount.Currency, currency)
+		}
+
+		var err error
+		total, err = total.Add(posting.Amount)
+		if err != nil {
+			return err
+		}
+	}
+
+	if !total.IsZero() {
+		return fmt.Errorf("ledger entry is unbalanced by %s %s", total.String(), currency)
+	}
+
+	return nil
+}
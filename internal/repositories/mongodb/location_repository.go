@@ -34,6 +34,7 @@ func NewLocationRepository(db *mongo.Database, cache services.CacheService) inte
 func (r *locationRepository) Create(ctx context.Context, location *models.LocationHistory) error {
 	location.ID = primitive.NewObjectID()
 	location.CreatedAt = time.Now()
+	location.Location.AssignCell(utils.CellResolution)
 
 	_, err := r.historyCollection.InsertOne(ctx, location)
 	if err != nil {
@@ -0,0 +1,108 @@
+package mongodb
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"goride/internal/models"
+	"goride/internal/repositories/interfaces"
+	"goride/internal/services"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type loyaltyRepository struct {
+	collection *mongo.Collection
+	cache      services.CacheService
+}
+
+func NewLoyaltyRepository(db *mongo.Database, cache services.CacheService) interfaces.LoyaltyRepository {
+	return &loyaltyRepository{
+		collection: db.Collection("loyalty_programs"),
+		cache:      cache,
+	}
+}
+
+// Basic CRUD operations
+func (r *loyaltyRepository) Create(ctx context.Context, program *models.LoyaltyProgram) error {
+	program.ID = primitive.NewObjectID()
+	program.CreatedAt = time.Now()
+	program.UpdatedAt = time.Now()
+
+	_, err := r.collection.InsertOne(ctx, program)
+	if err != nil {
+		return fmt.Errorf("failed to create loyalty program: %w", err)
+	}
+
+	r.invalidateActiveProgramCache(ctx)
+
+	return nil
+}
+
+func (r *loyaltyRepository) GetByID(ctx context.Context, id primitive.ObjectID) (*models.LoyaltyProgram, error) {
+	var program models.LoyaltyProgram
+	err := r.collection.FindOne(ctx, bson.M{"_id": id}).Decode(&program)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, fmt.Errorf("loyalty program not found")
+		}
+		return nil, fmt.Errorf("failed to get loyalty program: %w", err)
+	}
+
+	return &program, nil
+}
+
+func (r *loyaltyRepository) Update(ctx context.Context, id primitive.ObjectID, updates map[string]interface{}) error {
+	updates["updated_at"] = time.Now()
+
+	_, err := r.collection.UpdateOne(
+		ctx,
+		bson.M{"_id": id},
+		bson.M{"$set": updates},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update loyalty program: %w", err)
+	}
+
+	r.invalidateActiveProgramCache(ctx)
+
+	return nil
+}
+
+// Program lookup
+func (r *loyaltyRepository) GetActiveProgram(ctx context.Context) (*models.LoyaltyProgram, error) {
+	if r.cache != nil {
+		var cached models.LoyaltyProgram
+		if err := r.cache.Get(ctx, "loyalty_program:active", &cached); err == nil {
+			return &cached, nil
+		}
+	}
+
+	opts := options.FindOne().SetSort(bson.D{{Key: "updated_at", Value: -1}})
+
+	var program models.LoyaltyProgram
+	err := r.collection.FindOne(ctx, bson.M{"is_active": true}, opts).Decode(&program)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, fmt.Errorf("no active loyalty program")
+		}
+		return nil, fmt.Errorf("failed to get active loyalty program: %w", err)
+	}
+
+	if r.cache != nil {
+		r.cache.Set(ctx, "loyalty_program:active", &program, time.Hour)
+	}
+
+	return &program, nil
+}
+
+// Cache operations
+func (r *loyaltyRepository) invalidateActiveProgramCache(ctx context.Context) {
+	if r.cache != nil {
+		r.cache.Delete(ctx, "loyalty_program:active")
+	}
+}
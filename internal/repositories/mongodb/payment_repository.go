@@ -3,12 +3,16 @@ package mongodb
 import (
 	"context"
 	"fmt"
+	"math"
+	"regexp"
+	"sort"
 	"time"
 
 	"goride/internal/models"
 	"goride/internal/repositories/interfaces"
 	"goride/internal/services"
 	"goride/internal/utils"
+	"goride/pkg/money"
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -16,6 +20,10 @@ import (
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
+// maxAttemptRaces bounds how many attempt numbers CreateAttempt tries when
+// other payments for the same ride and type are created at the same time.
+const maxAttemptRaces = 5
+
 type paymentRepository struct {
 	collection *mongo.Collection
 	cache      services.CacheService
@@ -47,6 +55,29 @@ func (r *paymentRepository) Create(ctx context.Context, payment *models.Payment)
 	return nil
 }
 
+// CreateAttempt stores a payment under the next attempt for its ride and
+// type. The unique idempotency key settles races: a payment that loses one
+// takes the following attempt.
+func (r *paymentRepository) CreateAttempt(ctx context.Context, payment *models.Payment) error {
+	filter := bson.M{
+		"idempotency_key": primitive.Regex{Pattern: "^" + regexp.QuoteMeta(payment.IdempotencyPrefix())},
+	}
+	attempts, err := r.collection.CountDocuments(ctx, filter)
+	if err != nil {
+		return fmt.Errorf("failed to count payment attempts: %w", err)
+	}
+
+	for attempt := int(attempts) + 1; attempt <= int(attempts)+maxAttemptRaces; attempt++ {
+		payment.SetAttempt(attempt)
+		err := r.Create(ctx, payment)
+		if err == nil || !mongo.IsDuplicateKeyError(err) {
+			return err
+		}
+	}
+
+	return fmt.Errorf("failed to create payment: too many concurrent attempts")
+}
+
 func (r *paymentRepository) GetByID(ctx context.Context, id primitive.ObjectID) (*models.Payment, error) {
 	// Try cache first
 	if payment := r.getPaymentFromCache(ctx, id.Hex()); payment != nil {
@@ -141,6 +172,19 @@ func (r *paymentRepository) GetByExternalID(ctx context.Context, externalID stri
 	return &payment, nil
 }
 
+func (r *paymentRepository) GetByIdempotencyKey(ctx context.Context, key string) (*models.Payment, error) {
+	var payment models.Payment
+	err := r.collection.FindOne(ctx, bson.M{"idempotency_key": key}).Decode(&payment)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, fmt.Errorf("payment not found with idempotency key")
+		}
+		return nil, fmt.Errorf("failed to get payment by idempotency key: %w", err)
+	}
+
+	return &payment, nil
+}
+
 func (r *paymentRepository) UpdateStatus(ctx context.Context, id primitive.ObjectID, status models.PaymentStatus) error {
 	updates := map[string]interface{}{
 		"status": status,
@@ -251,6 +295,71 @@ func (r *paymentRepository) GetPendingPayments(ctx context.Context) ([]*models.P
 	return payments, nil
 }
 
+// GetAuthorizedPayments returns card holds placed before the given time that
+// have been neither captured nor voided, oldest first.
+func (r *paymentRepository) GetAuthorizedPayments(ctx context.Context, authorizedBefore time.Time, limit int) ([]*models.Payment, error) {
+	filter := bson.M{
+		"status":        models.PaymentStatusAuthorized,
+		"authorized_at": bson.M{"$lt": authorizedBefore},
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "authorized_at", Value: 1}}).
+		SetLimit(int64(limit))
+
+	cursor, err := r.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find authorized payments: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var payments []*models.Payment
+	for cursor.Next(ctx) {
+		var payment models.Payment
+		if err := cursor.Decode(&payment); err != nil {
+			return nil, fmt.Errorf("failed to decode payment: %w", err)
+		}
+		payments = append(payments, &payment)
+	}
+
+	return payments, nil
+}
+
+// GetPendingAttempts returns payments sent to a provider before the given time
+// whose outcome is still unknown, oldest first. Only payments the provider can
+// be asked about, by idempotency key or transaction ID, are returned.
+func (r *paymentRepository) GetPendingAttempts(ctx context.Context, createdBefore time.Time, limit int) ([]*models.Payment, error) {
+	filter := bson.M{
+		"status":     models.PaymentStatusPending,
+		"created_at": bson.M{"$lt": createdBefore},
+		"$or": []bson.M{
+			{"idempotency_key": bson.M{"$exists": true}},
+			{"transaction_id": bson.M{"$gt": ""}},
+		},
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "created_at", Value: 1}}).
+		SetLimit(int64(limit))
+
+	cursor, err := r.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find pending payment attempts: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var payments []*models.Payment
+	for cursor.Next(ctx) {
+		var payment models.Payment
+		if err := cursor.Decode(&payment); err != nil {
+			return nil, fmt.Errorf("failed to decode payment: %w", err)
+		}
+		payments = append(payments, &payment)
+	}
+
+	return payments, nil
+}
+
 func (r *paymentRepository) GetFailedPayments(ctx context.Context, params *utils.PaginationParams) ([]*models.Payment, int64, error) {
 	filter := bson.M{"status": models.PaymentStatusFailed}
 	return r.findPaymentsWithFilter(ctx, filter, params)
@@ -297,21 +406,38 @@ func (r *paymentRepository) GetDailyPayments(ctx context.Context, date time.Time
 }
 
 // Refund operations
-func (r *paymentRepository) ProcessRefund(ctx context.Context, id primitive.ObjectID, refundAmount float64, reason string) error {
+// ProcessRefund records a refund. The reporting amount is converted at the
+// rate snapshotted when the payment was charged, not today's rate.
+func (r *paymentRepository) ProcessRefund(ctx context.Context, id primitive.ObjectID, refundAmount money.Money, reason string) error {
+	payment, err := r.GetByID(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if !refundAmount.SameCurrency(payment.Amount) {
+		return fmt.Errorf("refund must be in the payment currency %s", payment.Amount.Currency)
+	}
+	if refundAmount.Currency == "" {
+		refundAmount.Currency = payment.Amount.Currency
+	}
+
 	updates := map[string]interface{}{
 		"status":         models.PaymentStatusRefunded,
 		"refund_amount":  refundAmount,
 		"failure_reason": reason,
 		"refunded_at":    time.Now(),
 	}
+	if payment.ExchangeRate != nil {
+		updates["refund_reporting_amount"] = payment.ExchangeRate.Convert(refundAmount)
+	}
 
 	return r.Update(ctx, id, updates)
 }
 
 func (r *paymentRepository) GetRefunds(ctx context.Context, params *utils.PaginationParams) ([]*models.Payment, int64, error) {
 	filter := bson.M{
-		"status":        models.PaymentStatusRefunded,
-		"refund_amount": bson.M{"$gt": 0},
+		"status":               models.PaymentStatusRefunded,
+		"refund_amount.amount": bson.M{"$gt": 0},
 	}
 	return r.findPaymentsWithFilter(ctx, filter, params)
 }
@@ -328,12 +454,12 @@ func (r *paymentRepository) GetRevenueStats(ctx context.Context, startDate, endD
 		}}},
 		{{"$group", bson.M{
 			"_id":                   nil,
-			"total_revenue":         bson.M{"$sum": "$total_amount"},
-			"platform_fees":         bson.M{"$sum": "$platform_fee"},
-			"driver_earnings":       bson.M{"$sum": "$driver_earnings"},
-			"tax_collected":         bson.M{"$sum": "$tax_amount"},
+			"total_revenue":         bson.M{"$sum": majorAmount("amount")},
+			"platform_fees":         bson.M{"$sum": majorAmount("platform_fee")},
+			"driver_earnings":       bson.M{"$sum": majorAmount("driver_earnings")},
+			"tax_collected":         bson.M{"$sum": majorAmount("tax_amount")},
 			"total_transactions":    bson.M{"$sum": 1},
-			"avg_transaction_value": bson.M{"$avg": "$total_amount"},
+			"avg_transaction_value": bson.M{"$avg": majorAmount("amount")},
 		}}},
 	}
 
@@ -370,6 +496,157 @@ func (r *paymentRepository) GetRevenueStats(ctx context.Context, startDate, endD
 	}, nil
 }
 
+// GetRevenueByCurrency totals payments per transaction currency alongside
+// their snapshotted reporting amounts, exactly in minor units. Payments
+// charged before snapshots were recorded have no reporting currency and are
+// grouped separately.
+func (r *paymentRepository) GetRevenueByCurrency(ctx context.Context, startDate, endDate time.Time) ([]map[string]interface{}, error) {
+	pipeline := mongo.Pipeline{
+		{{"$match", bson.M{
+			"status": bson.M{"$in": []models.PaymentStatus{models.PaymentStatusCompleted, models.PaymentStatusRefunded}},
+			"created_at": bson.M{
+				"$gte": startDate,
+				"$lte": endDate,
+			},
+		}}},
+		{{"$group", bson.M{
+			"_id": bson.M{
+				"currency":           "$currency",
+				"reporting_currency": "$reporting_currency",
+			},
+			"payments":                bson.M{"$sum": 1},
+			"amount":                  bson.M{"$sum": "$amount.amount"},
+			"refund_amount":           bson.M{"$sum": "$refund_amount.amount"},
+			"platform_fees":           bson.M{"$sum": "$platform_fee.amount"},
+			"reporting_amount":        bson.M{"$sum": "$reporting_amount.amount"},
+			"refund_reporting_amount": bson.M{"$sum": "$refund_reporting_amount.amount"},
+		}}},
+		{{"$sort", bson.D{{"amount", -1}}}},
+	}
+
+	cursor, err := r.collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get revenue by currency: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var results []map[string]interface{}
+	for cursor.Next(ctx) {
+		var result struct {
+			ID struct {
+				Currency          string `bson:"currency"`
+				ReportingCurrency string `bson:"reporting_currency"`
+			} `bson:"_id"`
+			Payments              int64 `bson:"payments"`
+			Amount                int64 `bson:"amount"`
+			RefundAmount          int64 `bson:"refund_amount"`
+			PlatformFees          int64 `bson:"platform_fees"`
+			ReportingAmount       int64 `bson:"reporting_amount"`
+			RefundReportingAmount int64 `bson:"refund_reporting_amount"`
+		}
+		if err := cursor.Decode(&result); err != nil {
+			return nil, fmt.Errorf("failed to decode revenue by currency: %w", err)
+		}
+
+		results = append(results, map[string]interface{}{
+			"currency":                result.ID.Currency,
+			"reporting_currency":      result.ID.ReportingCurrency,
+			"payments":                result.Payments,
+			"amount":                  money.New(result.Amount, result.ID.Currency),
+			"refund_amount":           money.New(result.RefundAmount, result.ID.Currency),
+			"platform_fees":           money.New(result.PlatformFees, result.ID.Currency),
+			"reporting_amount":        money.New(result.ReportingAmount, result.ID.ReportingCurrency),
+			"refund_reporting_amount": money.New(result.RefundReportingAmount, result.ID.ReportingCurrency),
+		})
+	}
+
+	return results, nil
+}
+
+// GetTaxByJurisdiction totals the tax lines of payments per jurisdiction and
+// tax, exactly in minor units of the tax currency. Tax on refunded amounts is
+// reversed in proportion to the refund and reported separately.
+func (r *paymentRepository) GetTaxByJurisdiction(ctx context.Context, startDate, endDate time.Time) ([]map[string]interface{}, error) {
+	pipeline := mongo.Pipeline{
+		{{"$match", bson.M{
+			"status": bson.M{"$in": []models.PaymentStatus{models.PaymentStatusCompleted, models.PaymentStatusRefunded}},
+			"created_at": bson.M{
+				"$gte": startDate,
+				"$lte": endDate,
+			},
+			"tax_lines.0": bson.M{"$exists": true},
+		}}},
+		{{"$unwind", "$tax_lines"}},
+		{{"$group", bson.M{
+			"_id": bson.M{
+				"jurisdiction": "$tax_lines.jurisdiction",
+				"rule_id":      "$tax_lines.rule_id",
+				"name":         "$tax_lines.name",
+				"tax_code":     "$tax_lines.tax_code",
+				"rate":         "$tax_lines.rate",
+				"inclusive":    "$tax_lines.inclusive",
+				"currency":     "$tax_lines.amount.currency",
+			},
+			"payments":       bson.M{"$sum": 1},
+			"taxable_amount": bson.M{"$sum": "$tax_lines.taxable_amount.amount"},
+			"tax_amount":     bson.M{"$sum": "$tax_lines.amount.amount"},
+			"refunded_tax": bson.M{"$sum": bson.M{"$cond": bson.A{
+				bson.M{"$gt": bson.A{"$amount.amount", 0}},
+				bson.M{"$divide": bson.A{
+					bson.M{"$multiply": bson.A{"$tax_lines.amount.amount", bson.M{"$ifNull": bson.A{"$refund_amount.amount", 0}}}},
+					"$amount.amount",
+				}},
+				0,
+			}}},
+		}}},
+		{{"$sort", bson.D{{"_id.jurisdiction", 1}, {"_id.tax_code", 1}, {"_id.currency", 1}}}},
+	}
+
+	cursor, err := r.collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get tax by jurisdiction: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var results []map[string]interface{}
+	for cursor.Next(ctx) {
+		var result struct {
+			ID struct {
+				Jurisdiction string             `bson:"jurisdiction"`
+				RuleID       primitive.ObjectID `bson:"rule_id"`
+				Name         string             `bson:"name"`
+				TaxCode      string             `bson:"tax_code"`
+				Rate         float64            `bson:"rate"`
+				Inclusive    bool               `bson:"inclusive"`
+				Currency     string             `bson:"currency"`
+			} `bson:"_id"`
+			Payments      int64   `bson:"payments"`
+			TaxableAmount int64   `bson:"taxable_amount"`
+			TaxAmount     int64   `bson:"tax_amount"`
+			RefundedTax   float64 `bson:"refunded_tax"`
+		}
+		if err := cursor.Decode(&result); err != nil {
+			return nil, fmt.Errorf("failed to decode tax by jurisdiction: %w", err)
+		}
+
+		results = append(results, map[string]interface{}{
+			"jurisdiction":   result.ID.Jurisdiction,
+			"rule_id":        result.ID.RuleID,
+			"name":           result.ID.Name,
+			"tax_code":       result.ID.TaxCode,
+			"rate":           result.ID.Rate,
+			"inclusive":      result.ID.Inclusive,
+			"currency":       result.ID.Currency,
+			"payments":       result.Payments,
+			"taxable_amount": money.New(result.TaxableAmount, result.ID.Currency),
+			"tax_amount":     money.New(result.TaxAmount, result.ID.Currency),
+			"refunded_tax":   money.New(int64(math.Round(result.RefundedTax)), result.ID.Currency),
+		})
+	}
+
+	return results, nil
+}
+
 func (r *paymentRepository) GetPaymentStats(ctx context.Context, startDate, endDate time.Time) (map[string]interface{}, error) {
 	pipeline := mongo.Pipeline{
 		{{"$match", bson.M{
@@ -381,7 +658,7 @@ func (r *paymentRepository) GetPaymentStats(ctx context.Context, startDate, endD
 		{{"$group", bson.M{
 			"_id":          "$status",
 			"count":        bson.M{"$sum": 1},
-			"total_amount": bson.M{"$sum": "$total_amount"},
+			"total_amount": bson.M{"$sum": majorAmount("amount")},
 		}}},
 	}
 
@@ -453,10 +730,10 @@ func (r *paymentRepository) GetDriverEarnings(ctx context.Context, driverID prim
 		}}},
 		{{"$group", bson.M{
 			"_id":                   nil,
-			"total_earnings":        bson.M{"$sum": "$driver_earnings"},
+			"total_earnings":        bson.M{"$sum": majorAmount("driver_earnings")},
 			"total_rides":           bson.M{"$sum": 1},
-			"total_tips":            bson.M{"$sum": "$tip_amount"},
-			"avg_earnings_per_ride": bson.M{"$avg": "$driver_earnings"},
+			"total_tips":            bson.M{"$sum": majorAmount("tip_amount")},
+			"avg_earnings_per_ride": bson.M{"$avg": majorAmount("driver_earnings")},
 		}}},
 	}
 
@@ -502,7 +779,7 @@ func (r *paymentRepository) GetTotalRevenue(ctx context.Context, startDate, endD
 		}}},
 		{{"$group", bson.M{
 			"_id":           nil,
-			"total_revenue": bson.M{"$sum": "$total_amount"},
+			"total_revenue": bson.M{"$sum": majorAmount("amount")},
 		}}},
 	}
 
@@ -536,7 +813,7 @@ func (r *paymentRepository) GetAverageRideValue(ctx context.Context, days int) (
 		}}},
 		{{"$group", bson.M{
 			"_id":       nil,
-			"avg_value": bson.M{"$avg": "$total_amount"},
+			"avg_value": bson.M{"$avg": majorAmount("amount")},
 		}}},
 	}
 
@@ -674,3 +951,28 @@ func (r *paymentRepository) invalidatePaymentCache(ctx context.Context, paymentI
 		// This is a trade-off for performance vs cache consistency
 	}
 }
+
+// majorAmount converts a stored money field to major units inside an
+// aggregation. Stats that mix currencies keep their float64 shape this way;
+// anything that must reconcile sums the minor units per currency instead.
+func majorAmount(field string) bson.M {
+	exponents := money.Exponents()
+	currencies := make([]string, 0, len(exponents))
+	for currency := range exponents {
+		currencies = append(currencies, currency)
+	}
+	sort.Strings(currencies)
+
+	branches := make(bson.A, 0, len(currencies))
+	for _, currency := range currencies {
+		branches = append(branches, bson.M{
+			"case": bson.M{"$eq": bson.A{"$" + field + ".currency", currency}},
+			"then": math.Pow10(exponents[currency]),
+		})
+	}
+
+	return bson.M{"$divide": bson.A{
+		"$" + field + ".amount",
+		bson.M{"$switch": bson.M{"branches": branches, "default": 100}},
+	}}
+}
@@ -0,0 +1,142 @@
+package mongodb
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"goride/internal/models"
+	"goride/internal/repositories/interfaces"
+	"goride/internal/utils"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type paymentWebhookRepository struct {
+	events *mongo.Collection
+}
+
+func NewPaymentWebhookRepository(db *mongo.Database) interfaces.PaymentWebhookRepository {
+	return &paymentWebhookRepository{
+		events: db.Collection("payment_webhook_events"),
+	}
+}
+
+// Events
+
+// CreateEvent stores an event unless the provider delivered it before, and
+// reports whether it was stored.
+func (r *paymentWebhookRepository) CreateEvent(ctx context.Context, event *models.PaymentWebhookEvent) (bool, error) {
+	event.ID = primitive.NewObjectID()
+	event.CreatedAt = time.Now()
+	event.UpdatedAt = time.Now()
+
+	_, err := r.events.InsertOne(ctx, event)
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to create payment webhook event: %w", err)
+	}
+
+	return true, nil
+}
+
+func (r *paymentWebhookRepository) GetEventByID(ctx context.Context, id primitive.ObjectID) (*models.PaymentWebhookEvent, error) {
+	return r.findEvent(ctx, bson.M{"_id": id})
+}
+
+func (r *paymentWebhookRepository) GetEventByEventID(ctx context.Context, provider, eventID string) (*models.PaymentWebhookEvent, error) {
+	return r.findEvent(ctx, bson.M{"provider": provider, "event_id": eventID})
+}
+
+func (r *paymentWebhookRepository) UpdateEvent(ctx context.Context, id primitive.ObjectID, updates map[string]interface{}) error {
+	updates["updated_at"] = time.Now()
+
+	result, err := r.events.UpdateOne(
+		ctx,
+		bson.M{"_id": id},
+		bson.M{"$set": updates},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update payment webhook event: %w", err)
+	}
+	if result.MatchedCount == 0 {
+		return fmt.Errorf("payment webhook event not found")
+	}
+
+	return nil
+}
+
+func (r *paymentWebhookRepository) GetEventsByStatus(ctx context.Context, status models.PaymentWebhookStatus, params *utils.PaginationParams) ([]*models.PaymentWebhookEvent, int64, error) {
+	filter := bson.M{"status": status}
+
+	total, err := r.events.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to count payment webhook events: %w", err)
+	}
+
+	cursor, err := r.events.Find(ctx, filter, params.GetSortOptions())
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to find payment webhook events: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	events, err := decodePaymentWebhookEvents(ctx, cursor)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return events, total, nil
+}
+
+// Processing
+
+// GetDueEvents returns pending events whose next attempt is due by the given
+// time, in the order they are due.
+func (r *paymentWebhookRepository) GetDueEvents(ctx context.Context, before time.Time, limit int) ([]*models.PaymentWebhookEvent, error) {
+	filter := bson.M{
+		"status":          models.PaymentWebhookStatusPending,
+		"next_attempt_at": bson.M{"$lte": before},
+	}
+	opts := options.Find().
+		SetSort(bson.D{{Key: "next_attempt_at", Value: 1}}).
+		SetLimit(int64(limit))
+
+	cursor, err := r.events.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find due payment webhook events: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	return decodePaymentWebhookEvents(ctx, cursor)
+}
+
+// Helper methods
+func (r *paymentWebhookRepository) findEvent(ctx context.Context, filter bson.M) (*models.PaymentWebhookEvent, error) {
+	var event models.PaymentWebhookEvent
+	err := r.events.FindOne(ctx, filter).Decode(&event)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, fmt.Errorf("payment webhook event not found")
+		}
+		return nil, fmt.Errorf("failed to get payment webhook event: %w", err)
+	}
+
+	return &event, nil
+}
+
+func decodePaymentWebhookEvents(ctx context.Context, cursor *mongo.Cursor) ([]*models.PaymentWebhookEvent, error) {
+	var events []*models.PaymentWebhookEvent
+	for cursor.Next(ctx) {
+		var event models.PaymentWebhookEvent
+		if err := cursor.Decode(&event); err != nil {
+			return nil, fmt.Errorf("failed to decode payment webhook event: %w", err)
+		}
+		events = append(events, &event)
+	}
+	return events, nil
+}
@@ -0,0 +1,230 @@
+package mongodb
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"goride/internal/models"
+	"goride/internal/repositories/interfaces"
+	"goride/internal/utils"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type payoutRepository struct {
+	batches *mongo.Collection
+	payouts *mongo.Collection
+}
+
+func NewPayoutRepository(db *mongo.Database) interfaces.PayoutRepository {
+	return &payoutRepository{
+		batches: db.Collection("payout_batches"),
+		payouts: db.Collection("payouts"),
+	}
+}
+
+// Batches
+func (r *payoutRepository) CreateBatch(ctx context.Context, batch *models.PayoutBatch) error {
+	batch.ID = primitive.NewObjectID()
+	batch.CreatedAt = time.Now()
+
+	_, err := r.batches.InsertOne(ctx, batch)
+	if err != nil {
+		return fmt.Errorf("failed to create payout batch: %w", err)
+	}
+
+	return nil
+}
+
+func (r *payoutRepository) UpdateBatch(ctx context.Context, id primitive.ObjectID, updates map[string]interface{}) error {
+	result, err := r.batches.UpdateOne(
+		ctx,
+		bson.M{"_id": id},
+		bson.M{"$set": updates},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update payout batch: %w", err)
+	}
+	if result.MatchedCount == 0 {
+		return fmt.Errorf("payout batch not found")
+	}
+
+	return nil
+}
+
+func (r *payoutRepository) GetLatestBatch(ctx context.Context) (*models.PayoutBatch, error) {
+	opts := options.FindOne().SetSort(bson.D{{Key: "period_end", Value: -1}})
+
+	var batch models.PayoutBatch
+	err := r.batches.FindOne(ctx, bson.M{}, opts).Decode(&batch)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, fmt.Errorf("payout batch not found")
+		}
+		return nil, fmt.Errorf("failed to get payout batch: %w", err)
+	}
+
+	return &batch, nil
+}
+
+func (r *payoutRepository) ListBatches(ctx context.Context, params *utils.PaginationParams) ([]*models.PayoutBatch, int64, error) {
+	filter := bson.M{}
+
+	total, err := r.batches.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to count payout batches: %w", err)
+	}
+
+	cursor, err := r.batches.Find(ctx, filter, params.GetSortOptions())
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to find payout batches: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var batches []*models.PayoutBatch
+	for cursor.Next(ctx) {
+		var batch models.PayoutBatch
+		if err := cursor.Decode(&batch); err != nil {
+			return nil, 0, fmt.Errorf("failed to decode payout batch: %w", err)
+		}
+		batches = append(batches, &batch)
+	}
+
+	return batches, total, nil
+}
+
+// Payouts
+func (r *payoutRepository) CreatePayout(ctx context.Context, payout *models.Payout) error {
+	payout.ID = primitive.NewObjectID()
+	payout.CreatedAt = time.Now()
+	payout.UpdatedAt = time.Now()
+
+	_, err := r.payouts.InsertOne(ctx, payout)
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return fmt.Errorf("payout %s already exists", payout.Reference)
+		}
+		return fmt.Errorf("failed to create payout: %w", err)
+	}
+
+	return nil
+}
+
+func (r *payoutRepository) GetPayoutByID(ctx context.Context, id primitive.ObjectID) (*models.Payout, error) {
+	var payout models.Payout
+	err := r.payouts.FindOne(ctx, bson.M{"_id": id}).Decode(&payout)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, fmt.Errorf("payout not found")
+		}
+		return nil, fmt.Errorf("failed to get payout: %w", err)
+	}
+
+	return &payout, nil
+}
+
+// UpdatePayout applies the updates only while the payout is still in the
+// given status, so two workers cannot both move it on.
+func (r *payoutRepository) UpdatePayout(ctx context.Context, id primitive.ObjectID, status models.PayoutStatus, updates map[string]interface{}) error {
+	updates["updated_at"] = time.Now()
+
+	result, err := r.payouts.UpdateOne(
+		ctx,
+		bson.M{"_id": id, "status": status},
+		bson.M{"$set": updates},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update payout: %w", err)
+	}
+	if result.MatchedCount == 0 {
+		return fmt.Errorf("payout not found or no longer %s", status)
+	}
+
+	return nil
+}
+
+func (r *payoutRepository) GetPayoutsByDriver(ctx context.Context, driverID primitive.ObjectID, params *utils.PaginationParams) ([]*models.Payout, int64, error) {
+	return r.findPayouts(ctx, bson.M{"driver_id": driverID}, params)
+}
+
+func (r *payoutRepository) GetPayoutsByBatch(ctx context.Context, batchID primitive.ObjectID, params *utils.PaginationParams) ([]*models.Payout, int64, error) {
+	return r.findPayouts(ctx, bson.M{"batch_id": batchID}, params)
+}
+
+// GetInstantPayoutsSince returns the driver's instant cash-outs created since
+// the given time, failed ones included.
+func (r *payoutRepository) GetInstantPayoutsSince(ctx context.Context, driverID primitive.ObjectID, since time.Time) ([]*models.Payout, error) {
+	filter := bson.M{
+		"driver_id":  driverID,
+		"type":       models.PayoutTypeInstant,
+		"created_at": bson.M{"$gte": since},
+	}
+
+	cursor, err := r.payouts.Find(ctx, filter)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find instant payouts: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	return decodePayouts(ctx, cursor)
+}
+
+// Tracking
+
+// GetPayoutsByStatus returns payouts in a status created since one time and
+// last updated before another, least recently updated first.
+func (r *payoutRepository) GetPayoutsByStatus(ctx context.Context, status models.PayoutStatus, since, before time.Time, limit int) ([]*models.Payout, error) {
+	filter := bson.M{
+		"status":     status,
+		"created_at": bson.M{"$gte": since},
+		"updated_at": bson.M{"$lt": before},
+	}
+	opts := options.Find().
+		SetSort(bson.D{{Key: "updated_at", Value: 1}}).
+		SetLimit(int64(limit))
+
+	cursor, err := r.payouts.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find payouts: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	return decodePayouts(ctx, cursor)
+}
+
+// Helper methods
+func (r *payoutRepository) findPayouts(ctx context.Context, filter bson.M, params *utils.PaginationParams) ([]*models.Payout, int64, error) {
+	total, err := r.payouts.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to count payouts: %w", err)
+	}
+
+	cursor, err := r.payouts.Find(ctx, filter, params.GetSortOptions())
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to find payouts: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	payouts, err := decodePayouts(ctx, cursor)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return payouts, total, nil
+}
+
+func decodePayouts(ctx context.Context, cursor *mongo.Cursor) ([]*models.Payout, error) {
+	var payouts []*models.Payout
+	for cursor.Next(ctx) {
+		var payout models.Payout
+		if err := cursor.Decode(&payout); err != nil {
+			return nil, fmt.Errorf("failed to decode payout: %w", err)
+		}
+		payouts = append(payouts, &payout)
+	}
+	return payouts, nil
+}
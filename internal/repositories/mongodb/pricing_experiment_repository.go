@@ -0,0 +1,263 @@
+package mongodb
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"goride/internal/models"
+	"goride/internal/repositories/interfaces"
+	"goride/internal/services"
+	"goride/internal/utils"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const livePricingExperimentsCacheKey = "pricing_experiments:live"
+
+type pricingExperimentRepository struct {
+	collection *mongo.Collection
+	exposures  *mongo.Collection
+	cache      services.CacheService
+}
+
+func NewPricingExperimentRepository(db *mongo.Database, cache services.CacheService) interfaces.PricingExperimentRepository {
+	return &pricingExperimentRepository{
+		collection: db.Collection("pricing_experiments"),
+		exposures:  db.Collection("pricing_experiment_exposures"),
+		cache:      cache,
+	}
+}
+
+// Basic CRUD operations
+func (r *pricingExperimentRepository) Create(ctx context.Context, experiment *models.PricingExperiment) error {
+	experiment.ID = primitive.NewObjectID()
+	experiment.CreatedAt = time.Now()
+	experiment.UpdatedAt = time.Now()
+
+	if experiment.StartDate.IsZero() {
+		experiment.StartDate = experiment.CreatedAt
+	}
+
+	_, err := r.collection.InsertOne(ctx, experiment)
+	if err != nil {
+		return fmt.Errorf("failed to create pricing experiment: %w", err)
+	}
+
+	r.invalidateLiveCache(ctx)
+
+	return nil
+}
+
+func (r *pricingExperimentRepository) GetByID(ctx context.Context, id primitive.ObjectID) (*models.PricingExperiment, error) {
+	var experiment models.PricingExperiment
+	err := r.collection.FindOne(ctx, bson.M{"_id": id}).Decode(&experiment)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, fmt.Errorf("pricing experiment not found")
+		}
+		return nil, fmt.Errorf("failed to get pricing experiment: %w", err)
+	}
+
+	return &experiment, nil
+}
+
+func (r *pricingExperimentRepository) Update(ctx context.Context, id primitive.ObjectID, updates map[string]interface{}) error {
+	updates["updated_at"] = time.Now()
+
+	result, err := r.collection.UpdateOne(
+		ctx,
+		bson.M{"_id": id},
+		bson.M{"$set": updates},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update pricing experiment: %w", err)
+	}
+	if result.MatchedCount == 0 {
+		return fmt.Errorf("pricing experiment not found")
+	}
+
+	// Dropping the cache is what makes the kill switch take effect at once
+	r.invalidateLiveCache(ctx)
+
+	return nil
+}
+
+func (r *pricingExperimentRepository) List(ctx context.Context, params *utils.PaginationParams) ([]*models.PricingExperiment, int64, error) {
+	filter := bson.M{}
+
+	total, err := r.collection.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to count pricing experiments: %w", err)
+	}
+
+	cursor, err := r.collection.Find(ctx, filter, params.GetSortOptions())
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to find pricing experiments: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var experiments []*models.PricingExperiment
+	for cursor.Next(ctx) {
+		var experiment models.PricingExperiment
+		if err := cursor.Decode(&experiment); err != nil {
+			return nil, 0, fmt.Errorf("failed to decode pricing experiment: %w", err)
+		}
+		experiments = append(experiments, &experiment)
+	}
+
+	return experiments, total, nil
+}
+
+// Lookup operations
+
+// GetRunning returns the experiments enrolling riders at the given time,
+// oldest first. Every quote asks, so the experiments that have not been killed
+// or ended are cached as a whole and filtered on every call.
+func (r *pricingExperimentRepository) GetRunning(ctx context.Context, at time.Time) ([]*models.PricingExperiment, error) {
+	var experiments []*models.PricingExperiment
+	cached := false
+	if r.cache != nil {
+		cached = r.cache.Get(ctx, livePricingExperimentsCacheKey, &experiments) == nil
+	}
+
+	if !cached {
+		filter := bson.M{
+			"is_killed": false,
+			"end_date":  bson.M{"$gt": at},
+		}
+		cursor, err := r.collection.Find(ctx, filter)
+		if err != nil {
+			return nil, fmt.Errorf("failed to find pricing experiments: %w", err)
+		}
+		defer cursor.Close(ctx)
+
+		for cursor.Next(ctx) {
+			var experiment models.PricingExperiment
+			if err := cursor.Decode(&experiment); err != nil {
+				return nil, fmt.Errorf("failed to decode pricing experiment: %w", err)
+			}
+			experiments = append(experiments, &experiment)
+		}
+
+		if r.cache != nil {
+			r.cache.Set(ctx, livePricingExperimentsCacheKey, experiments, 5*time.Minute)
+		}
+	}
+
+	var running []*models.PricingExperiment
+	for _, experiment := range experiments {
+		if experiment.IsRunning(at) {
+			running = append(running, experiment)
+		}
+	}
+
+	return running, nil
+}
+
+// Exposures
+func (r *pricingExperimentRepository) CreateExposure(ctx context.Context, exposure *models.PricingExperimentExposure) error {
+	exposure.ID = primitive.NewObjectID()
+	exposure.CreatedAt = time.Now()
+
+	_, err := r.exposures.InsertOne(ctx, exposure)
+	if err != nil {
+		return fmt.Errorf("failed to create pricing experiment exposure: %w", err)
+	}
+
+	return nil
+}
+
+// MarkConverted links the exposure of a quote to the ride booked with it.
+func (r *pricingExperimentRepository) MarkConverted(ctx context.Context, quoteID string, rideID primitive.ObjectID, at time.Time) error {
+	result, err := r.exposures.UpdateOne(
+		ctx,
+		bson.M{"quote_id": quoteID, "ride_id": nil},
+		bson.M{"$set": bson.M{
+			"ride_id":      rideID,
+			"converted_at": at,
+		}},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to mark pricing experiment exposure converted: %w", err)
+	}
+	if result.MatchedCount == 0 {
+		return fmt.Errorf("pricing experiment exposure not found")
+	}
+
+	return nil
+}
+
+// Reporting
+
+// GetArmStats counts, per arm, the quotes shown, the rides booked from them and
+// the rides completed, with the completed rides' final fares summed and
+// squared-summed for the revenue estimate.
+func (r *pricingExperimentRepository) GetArmStats(ctx context.Context, experimentID primitive.ObjectID) ([]map[string]interface{}, error) {
+	completed := bson.M{"$eq": bson.A{"$ride.status", models.RideStatusCompleted}}
+	revenue := bson.M{"$cond": bson.A{completed, bson.M{"$ifNull": bson.A{"$ride.final_fare", 0}}, 0}}
+
+	pipeline := mongo.Pipeline{
+		{{"$match", bson.M{"experiment_id": experimentID}}},
+		{{"$lookup", bson.M{
+			"from":         "rides",
+			"localField":   "ride_id",
+			"foreignField": "_id",
+			"as":           "ride",
+		}}},
+		{{"$addFields", bson.M{"ride": bson.M{"$arrayElemAt": bson.A{"$ride", 0}}}}},
+		{{"$addFields", bson.M{"revenue": revenue}}},
+		{{"$group", bson.M{
+			"_id":    "$arm",
+			"quotes": bson.M{"$sum": 1},
+			"rides": bson.M{"$sum": bson.M{
+				"$cond": bson.A{bson.M{"$ifNull": bson.A{"$ride_id", false}}, 1, 0},
+			}},
+			"completed":       bson.M{"$sum": bson.M{"$cond": bson.A{completed, 1, 0}}},
+			"revenue":         bson.M{"$sum": "$revenue"},
+			"revenue_squared": bson.M{"$sum": bson.M{"$multiply": bson.A{"$revenue", "$revenue"}}},
+		}}},
+		{{"$sort", bson.M{"_id": 1}}},
+	}
+
+	cursor, err := r.exposures.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get pricing experiment stats: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var results []map[string]interface{}
+	for cursor.Next(ctx) {
+		var result struct {
+			Arm            string  `bson:"_id"`
+			Quotes         int64   `bson:"quotes"`
+			Rides          int64   `bson:"rides"`
+			Completed      int64   `bson:"completed"`
+			Revenue        float64 `bson:"revenue"`
+			RevenueSquared float64 `bson:"revenue_squared"`
+		}
+		if err := cursor.Decode(&result); err != nil {
+			return nil, fmt.Errorf("failed to decode pricing experiment stats: %w", err)
+		}
+
+		results = append(results, map[string]interface{}{
+			"arm":             result.Arm,
+			"quotes":          result.Quotes,
+			"rides":           result.Rides,
+			"completed":       result.Completed,
+			"revenue":         result.Revenue,
+			"revenue_squared": result.RevenueSquared,
+		})
+	}
+
+	return results, nil
+}
+
+// Helper methods
+func (r *pricingExperimentRepository) invalidateLiveCache(ctx context.Context) {
+	if r.cache != nil {
+		r.cache.Delete(ctx, livePricingExperimentsCacheKey)
+	}
+}
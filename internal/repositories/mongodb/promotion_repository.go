@@ -10,6 +10,7 @@ import (
 	"goride/internal/repositories/interfaces"
 	"goride/internal/services"
 	"goride/internal/utils"
+	"goride/pkg/money"
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -347,12 +348,13 @@ func (r *promotionRepository) GetByType(ctx context.Context, promotionType model
 	return r.findPromotionsWithFilter(ctx, filter, params)
 }
 
-func (r *promotionRepository) GetApplicablePromotions(ctx context.Context, userType models.UserType, rideType string, amount float64) ([]*models.Promotion, error) {
+func (r *promotionRepository) GetApplicablePromotions(ctx context.Context, userType models.UserType, rideType string, amount money.Money) ([]*models.Promotion, error) {
 	filter := bson.M{
-		"status":          models.PromotionStatusActive,
-		"valid_from":      bson.M{"$lte": time.Now()},
-		"valid_until":     bson.M{"$gte": time.Now()},
-		"min_ride_amount": bson.M{"$lte": amount},
+		"status":                   models.PromotionStatusActive,
+		"valid_from":               bson.M{"$lte": time.Now()},
+		"valid_until":              bson.M{"$gte": time.Now()},
+		"min_ride_amount.amount":   bson.M{"$lte": amount.Amount},
+		"min_ride_amount.currency": bson.M{"$in": []string{amount.Currency, ""}},
 		"$or": []bson.M{
 			{"usage_limit": 0}, // No limit
 			{"$expr": bson.M{"$lt": []interface{}{"$used_count", "$usage_limit"}}},
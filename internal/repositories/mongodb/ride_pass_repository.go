@@ -0,0 +1,253 @@
+package mongodb
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"goride/internal/models"
+	"goride/internal/repositories/interfaces"
+	"goride/internal/utils"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type ridePassRepository struct {
+	plans         *mongo.Collection
+	subscriptions *mongo.Collection
+}
+
+func NewRidePassRepository(db *mongo.Database) interfaces.RidePassRepository {
+	return &ridePassRepository{
+		plans:         db.Collection("ride_pass_plans"),
+		subscriptions: db.Collection("ride_pass_subscriptions"),
+	}
+}
+
+// Plans
+func (r *ridePassRepository) CreatePlan(ctx context.Context, plan *models.RidePassPlan) error {
+	plan.ID = primitive.NewObjectID()
+	plan.CreatedAt = time.Now()
+	plan.UpdatedAt = time.Now()
+
+	_, err := r.plans.InsertOne(ctx, plan)
+	if err != nil {
+		return fmt.Errorf("failed to create ride pass plan: %w", err)
+	}
+
+	return nil
+}
+
+func (r *ridePassRepository) GetPlanByID(ctx context.Context, id primitive.ObjectID) (*models.RidePassPlan, error) {
+	var plan models.RidePassPlan
+	err := r.plans.FindOne(ctx, bson.M{"_id": id}).Decode(&plan)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, fmt.Errorf("ride pass plan not found")
+		}
+		return nil, fmt.Errorf("failed to get ride pass plan: %w", err)
+	}
+
+	return &plan, nil
+}
+
+func (r *ridePassRepository) UpdatePlan(ctx context.Context, id primitive.ObjectID, updates map[string]interface{}) error {
+	updates["updated_at"] = time.Now()
+
+	result, err := r.plans.UpdateOne(
+		ctx,
+		bson.M{"_id": id},
+		bson.M{"$set": updates},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update ride pass plan: %w", err)
+	}
+	if result.MatchedCount == 0 {
+		return fmt.Errorf("ride pass plan not found")
+	}
+
+	return nil
+}
+
+func (r *ridePassRepository) ListPlans(ctx context.Context, activeOnly bool, params *utils.PaginationParams) ([]*models.RidePassPlan, int64, error) {
+	filter := bson.M{}
+	if activeOnly {
+		filter["is_active"] = true
+	}
+
+	total, err := r.plans.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to count ride pass plans: %w", err)
+	}
+
+	cursor, err := r.plans.Find(ctx, filter, params.GetSortOptions())
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to find ride pass plans: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var plans []*models.RidePassPlan
+	for cursor.Next(ctx) {
+		var plan models.RidePassPlan
+		if err := cursor.Decode(&plan); err != nil {
+			return nil, 0, fmt.Errorf("failed to decode ride pass plan: %w", err)
+		}
+		plans = append(plans, &plan)
+	}
+
+	return plans, total, nil
+}
+
+// Subscriptions
+func (r *ridePassRepository) CreateSubscription(ctx context.Context, subscription *models.RidePassSubscription) error {
+	subscription.ID = primitive.NewObjectID()
+	subscription.CreatedAt = time.Now()
+	subscription.UpdatedAt = time.Now()
+
+	_, err := r.subscriptions.InsertOne(ctx, subscription)
+	if err != nil {
+		return fmt.Errorf("failed to create ride pass subscription: %w", err)
+	}
+
+	return nil
+}
+
+func (r *ridePassRepository) GetSubscriptionByID(ctx context.Context, id primitive.ObjectID) (*models.RidePassSubscription, error) {
+	var subscription models.RidePassSubscription
+	err := r.subscriptions.FindOne(ctx, bson.M{"_id": id}).Decode(&subscription)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, fmt.Errorf("ride pass subscription not found")
+		}
+		return nil, fmt.Errorf("failed to get ride pass subscription: %w", err)
+	}
+
+	return &subscription, nil
+}
+
+func (r *ridePassRepository) UpdateSubscription(ctx context.Context, id primitive.ObjectID, updates map[string]interface{}) error {
+	updates["updated_at"] = time.Now()
+
+	result, err := r.subscriptions.UpdateOne(
+		ctx,
+		bson.M{"_id": id},
+		bson.M{"$set": updates},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update ride pass subscription: %w", err)
+	}
+	if result.MatchedCount == 0 {
+		return fmt.Errorf("ride pass subscription not found")
+	}
+
+	return nil
+}
+
+// AppendPeriod records a billing period together with the updates that move
+// the subscription into it.
+func (r *ridePassRepository) AppendPeriod(ctx context.Context, id primitive.ObjectID, period *models.RidePassPeriod, updates map[string]interface{}) error {
+	updates["updated_at"] = time.Now()
+
+	result, err := r.subscriptions.UpdateOne(
+		ctx,
+		bson.M{"_id": id},
+		bson.M{
+			"$set":  updates,
+			"$push": bson.M{"periods": period},
+		},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to append ride pass period: %w", err)
+	}
+	if result.MatchedCount == 0 {
+		return fmt.Errorf("ride pass subscription not found")
+	}
+
+	return nil
+}
+
+// GetCurrentSubscriptions returns the rider's active, past due and pending
+// subscriptions, newest first. Riders hold at most one, so the list is empty
+// for riders without a pass rather than an error.
+func (r *ridePassRepository) GetCurrentSubscriptions(ctx context.Context, riderID primitive.ObjectID) ([]*models.RidePassSubscription, error) {
+	filter := bson.M{
+		"rider_id": riderID,
+		"status": bson.M{"$in": []models.RidePassStatus{
+			models.RidePassStatusActive,
+			models.RidePassStatusPastDue,
+			models.RidePassStatusPending,
+		}},
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}})
+
+	cursor, err := r.subscriptions.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find ride pass subscriptions: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	return decodeRidePassSubscriptions(ctx, cursor)
+}
+
+func (r *ridePassRepository) GetSubscriptionsByRider(ctx context.Context, riderID primitive.ObjectID, params *utils.PaginationParams) ([]*models.RidePassSubscription, int64, error) {
+	filter := bson.M{"rider_id": riderID}
+
+	total, err := r.subscriptions.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to count ride pass subscriptions: %w", err)
+	}
+
+	cursor, err := r.subscriptions.Find(ctx, filter, params.GetSortOptions())
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to find ride pass subscriptions: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	subscriptions, err := decodeRidePassSubscriptions(ctx, cursor)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return subscriptions, total, nil
+}
+
+// Billing
+
+// GetDueSubscriptions returns active and past due subscriptions whose current
+// period has ended, oldest first.
+func (r *ridePassRepository) GetDueSubscriptions(ctx context.Context, at time.Time, limit int) ([]*models.RidePassSubscription, error) {
+	filter := bson.M{
+		"status": bson.M{"$in": []models.RidePassStatus{
+			models.RidePassStatusActive,
+			models.RidePassStatusPastDue,
+		}},
+		"current_period_end": bson.M{"$lte": at},
+	}
+	opts := options.Find().
+		SetSort(bson.D{{Key: "current_period_end", Value: 1}}).
+		SetLimit(int64(limit))
+
+	cursor, err := r.subscriptions.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find due ride pass subscriptions: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	return decodeRidePassSubscriptions(ctx, cursor)
+}
+
+// Helper methods
+func decodeRidePassSubscriptions(ctx context.Context, cursor *mongo.Cursor) ([]*models.RidePassSubscription, error) {
+	var subscriptions []*models.RidePassSubscription
+	for cursor.Next(ctx) {
+		var subscription models.RidePassSubscription
+		if err := cursor.Decode(&subscription); err != nil {
+			return nil, fmt.Errorf("failed to decode ride pass subscription: %w", err)
+		}
+		subscriptions = append(subscriptions, &subscription)
+	}
+	return subscriptions, nil
+}
@@ -9,6 +9,7 @@ import (
 	"goride/internal/repositories/interfaces"
 	"goride/internal/services"
 	"goride/internal/utils"
+	"goride/pkg/money"
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -32,6 +33,8 @@ func NewRideRepository(db *mongo.Database, cache services.CacheService) interfac
 func (r *rideRepository) Create(ctx context.Context, ride *models.Ride) error {
 	ride.ID = primitive.NewObjectID()
 	ride.RequestedAt = time.Now()
+	ride.PickupLocation.AssignCell(utils.CellResolution)
+	ride.DropoffLocation.AssignCell(utils.CellResolution)
 
 	_, err := r.collection.InsertOne(ctx, ride)
 	if err != nil {
@@ -236,6 +239,27 @@ func (r *rideRepository) RemoveWaypoint(ctx context.Context, id primitive.Object
 	return nil
 }
 
+// History operations
+func (r *rideRepository) AddHistoryEntry(ctx context.Context, id primitive.ObjectID, entry *models.RideHistoryEntry) error {
+	if entry.CreatedAt.IsZero() {
+		entry.CreatedAt = time.Now()
+	}
+
+	_, err := r.collection.UpdateOne(
+		ctx,
+		bson.M{"_id": id},
+		bson.M{"$push": bson.M{"history": entry}},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to add ride history entry: %w", err)
+	}
+
+	// Invalidate cache
+	r.invalidateRideCache(ctx, id.Hex())
+
+	return nil
+}
+
 // Search and filtering
 func (r *rideRepository) GetByRider(ctx context.Context, riderID primitive.ObjectID, params *utils.PaginationParams) ([]*models.Ride, int64, error) {
 	filter := bson.M{"rider_id": riderID}
@@ -301,6 +325,27 @@ func (r *rideRepository) GetPendingRides(ctx context.Context) ([]*models.Ride, e
 	return rides, nil
 }
 
+func (r *rideRepository) GetUnsettledPoolRides(ctx context.Context) ([]*models.Ride, error) {
+	filter := bson.M{"pool_settlement_pending": true}
+
+	cursor, err := r.collection.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "completed_at", Value: 1}}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to find unsettled pool rides: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var rides []*models.Ride
+	for cursor.Next(ctx) {
+		var ride models.Ride
+		if err := cursor.Decode(&ride); err != nil {
+			return nil, fmt.Errorf("failed to decode ride: %w", err)
+		}
+		rides = append(rides, &ride)
+	}
+
+	return rides, nil
+}
+
 // Time-based queries
 func (r *rideRepository) GetRidesByDateRange(ctx context.Context, startDate, endDate time.Time, params *utils.PaginationParams) ([]*models.Ride, int64, error) {
 	filter := bson.M{
@@ -661,6 +706,63 @@ func (r *rideRepository) GetPeakHours(ctx context.Context, days int) ([]map[stri
 	return peakHours, nil
 }
 
+// GetRidePassSavings buckets the completed rides priced with a ride pass by
+// the billing periods the boundaries delimit, summing the pass discount. Each
+// bucket is keyed by the start of its period; periods without rides are left
+// out.
+func (r *rideRepository) GetRidePassSavings(ctx context.Context, subscriptionID primitive.ObjectID, boundaries []time.Time) ([]map[string]interface{}, error) {
+	if len(boundaries) < 2 {
+		return nil, nil
+	}
+
+	pipeline := mongo.Pipeline{
+		{{"$match", bson.M{
+			"status":                      models.RideStatusCompleted,
+			"fare_breakdown.ride_pass_id": subscriptionID,
+			"completed_at": bson.M{
+				"$gte": boundaries[0],
+				"$lt":  boundaries[len(boundaries)-1],
+			},
+		}}},
+		{{"$bucket", bson.M{
+			"groupBy":    "$completed_at",
+			"boundaries": boundaries,
+			"output": bson.M{
+				"rides":    bson.M{"$sum": 1},
+				"savings":  bson.M{"$sum": "$fare_breakdown.pass_discount.amount"},
+				"currency": bson.M{"$first": "$fare_breakdown.pass_discount.currency"},
+			},
+		}}},
+	}
+
+	cursor, err := r.collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get ride pass savings: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var savings []map[string]interface{}
+	for cursor.Next(ctx) {
+		var result struct {
+			PeriodStart time.Time `bson:"_id"`
+			Rides       int64     `bson:"rides"`
+			Savings     int64     `bson:"savings"`
+			Currency    string    `bson:"currency"`
+		}
+		if err := cursor.Decode(&result); err != nil {
+			return nil, fmt.Errorf("failed to decode ride pass savings: %w", err)
+		}
+
+		savings = append(savings, map[string]interface{}{
+			"period_start": result.PeriodStart,
+			"rides":        result.Rides,
+			"savings":      money.New(result.Savings, result.Currency),
+		})
+	}
+
+	return savings, nil
+}
+
 // Ratings
 func (r *rideRepository) UpdateRiderRating(ctx context.Context, id primitive.ObjectID, rating float64) error {
 	updates := map[string]interface{}{
@@ -716,15 +818,24 @@ func (r *rideRepository) findRidesWithFilter(ctx context.Context, filter bson.M,
 }
 
 // Cache operations
+
+// cachedRide carries the pickup PIN through the cache; the ride's own JSON
+// leaves it out so it never reaches an API response.
+type cachedRide struct {
+	*models.Ride
+	OTP string `json:"otp"`
+}
+
 func (r *rideRepository) cacheRide(ctx context.Context, ride *models.Ride) {
 	if r.cache != nil {
+		cached := &cachedRide{Ride: ride, OTP: ride.OTP}
 		cacheKey := fmt.Sprintf("ride:%s", ride.ID.Hex())
-		r.cache.Set(ctx, cacheKey, ride, 15*time.Minute)
+		r.cache.Set(ctx, cacheKey, cached, 15*time.Minute)
 
 		// Also cache by ride number
 		if ride.RideNumber != "" {
 			numberKey := fmt.Sprintf("ride_number_%s", ride.RideNumber)
-			r.cache.Set(ctx, numberKey, ride, 15*time.Minute)
+			r.cache.Set(ctx, numberKey, cached, 15*time.Minute)
 		}
 	}
 }
@@ -735,13 +846,14 @@ func (r *rideRepository) getRideFromCache(ctx context.Context, rideID string) *m
 	}
 
 	cacheKey := fmt.Sprintf("ride:%s", rideID)
-	var ride models.Ride
-	err := r.cache.Get(ctx, cacheKey, &ride)
+	cached := cachedRide{Ride: &models.Ride{}}
+	err := r.cache.Get(ctx, cacheKey, &cached)
 	if err != nil {
 		return nil
 	}
 
-	return &ride
+	cached.Ride.OTP = cached.OTP
+	return cached.Ride
 }
 
 func (r *rideRepository) invalidateRideCache(ctx context.Context, rideID string) {
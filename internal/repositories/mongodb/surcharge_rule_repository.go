@@ -0,0 +1,195 @@
+package mongodb
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"goride/internal/models"
+	"goride/internal/repositories/interfaces"
+	"goride/internal/services"
+	"goride/internal/utils"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type surchargeRuleRepository struct {
+	collection *mongo.Collection
+	cache      services.CacheService
+}
+
+func NewSurchargeRuleRepository(db *mongo.Database, cache services.CacheService) interfaces.SurchargeRuleRepository {
+	return &surchargeRuleRepository{
+		collection: db.Collection("surcharge_rules"),
+		cache:      cache,
+	}
+}
+
+// Basic CRUD operations
+func (r *surchargeRuleRepository) Create(ctx context.Context, rule *models.SurchargeRule) error {
+	rule.ID = primitive.NewObjectID()
+	rule.CreatedAt = time.Now()
+	rule.UpdatedAt = time.Now()
+
+	if rule.EffectiveFrom.IsZero() {
+		rule.EffectiveFrom = rule.CreatedAt
+	}
+
+	_, err := r.collection.InsertOne(ctx, rule)
+	if err != nil {
+		return fmt.Errorf("failed to create surcharge rule: %w", err)
+	}
+
+	r.invalidateActiveCache(ctx, rule.City)
+
+	return nil
+}
+
+func (r *surchargeRuleRepository) GetByID(ctx context.Context, id primitive.ObjectID) (*models.SurchargeRule, error) {
+	var rule models.SurchargeRule
+	err := r.collection.FindOne(ctx, bson.M{"_id": id}).Decode(&rule)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, fmt.Errorf("surcharge rule not found")
+		}
+		return nil, fmt.Errorf("failed to get surcharge rule: %w", err)
+	}
+
+	return &rule, nil
+}
+
+func (r *surchargeRuleRepository) Update(ctx context.Context, id primitive.ObjectID, updates map[string]interface{}) error {
+	existing, err := r.GetByID(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	updates["updated_at"] = time.Now()
+
+	_, err = r.collection.UpdateOne(
+		ctx,
+		bson.M{"_id": id},
+		bson.M{"$set": updates},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update surcharge rule: %w", err)
+	}
+
+	r.invalidateActiveCache(ctx, existing.City)
+
+	return nil
+}
+
+func (r *surchargeRuleRepository) Delete(ctx context.Context, id primitive.ObjectID) error {
+	existing, err := r.GetByID(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.collection.DeleteOne(ctx, bson.M{"_id": id})
+	if err != nil {
+		return fmt.Errorf("failed to delete surcharge rule: %w", err)
+	}
+
+	r.invalidateActiveCache(ctx, existing.City)
+
+	return nil
+}
+
+// Lookup operations
+
+// GetActive returns the rules of a city in force at the given time. The
+// city's active rules are cached as a whole and filtered by effective period
+// on every call.
+func (r *surchargeRuleRepository) GetActive(ctx context.Context, city string, at time.Time) ([]*models.SurchargeRule, error) {
+	cacheKey := activeSurchargeCacheKey(city)
+
+	var rules []*models.SurchargeRule
+	cached := false
+	if r.cache != nil {
+		cached = r.cache.Get(ctx, cacheKey, &rules) == nil
+	}
+
+	if !cached {
+		cursor, err := r.collection.Find(ctx, bson.M{
+			"city":      bson.M{"$regex": "^" + regexp.QuoteMeta(city) + "$", "$options": "i"},
+			"is_active": true,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to find surcharge rules: %w", err)
+		}
+		defer cursor.Close(ctx)
+
+		for cursor.Next(ctx) {
+			var rule models.SurchargeRule
+			if err := cursor.Decode(&rule); err != nil {
+				return nil, fmt.Errorf("failed to decode surcharge rule: %w", err)
+			}
+			rules = append(rules, &rule)
+		}
+
+		if r.cache != nil {
+			r.cache.Set(ctx, cacheKey, rules, 10*time.Minute)
+		}
+	}
+
+	var effective []*models.SurchargeRule
+	for _, rule := range rules {
+		if isSurchargeRuleEffective(rule, at) {
+			effective = append(effective, rule)
+		}
+	}
+
+	return effective, nil
+}
+
+func (r *surchargeRuleRepository) List(ctx context.Context, city string, params *utils.PaginationParams) ([]*models.SurchargeRule, int64, error) {
+	filter := bson.M{}
+	if city != "" {
+		filter["city"] = bson.M{"$regex": "^" + regexp.QuoteMeta(city) + "$", "$options": "i"}
+	}
+
+	total, err := r.collection.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to count surcharge rules: %w", err)
+	}
+
+	cursor, err := r.collection.Find(ctx, filter, params.GetSortOptions())
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to find surcharge rules: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var rules []*models.SurchargeRule
+	for cursor.Next(ctx) {
+		var rule models.SurchargeRule
+		if err := cursor.Decode(&rule); err != nil {
+			return nil, 0, fmt.Errorf("failed to decode surcharge rule: %w", err)
+		}
+		rules = append(rules, &rule)
+	}
+
+	return rules, total, nil
+}
+
+// Helper methods
+func (r *surchargeRuleRepository) invalidateActiveCache(ctx context.Context, city string) {
+	if r.cache != nil {
+		r.cache.Delete(ctx, activeSurchargeCacheKey(city))
+	}
+}
+
+func activeSurchargeCacheKey(city string) string {
+	return fmt.Sprintf("surcharge_rules:%s", strings.ToLower(city))
+}
+
+func isSurchargeRuleEffective(rule *models.SurchargeRule, at time.Time) bool {
+	if !rule.IsActive || rule.EffectiveFrom.After(at) {
+		return false
+	}
+	return rule.EffectiveUntil == nil || rule.EffectiveUntil.After(at)
+}
@@ -0,0 +1,217 @@
+package mongodb
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"goride/internal/models"
+	"goride/internal/repositories/interfaces"
+	"goride/internal/services"
+	"goride/internal/utils"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type surgePricingRepository struct {
+	collection *mongo.Collection
+	cache      services.CacheService
+}
+
+func NewSurgePricingRepository(db *mongo.Database, cache services.CacheService) interfaces.SurgePricingRepository {
+	return &surgePricingRepository{
+		collection: db.Collection("surge_pricing"),
+		cache:      cache,
+	}
+}
+
+// Basic CRUD operations
+func (r *surgePricingRepository) Create(ctx context.Context, surge *models.SurgePricing) error {
+	surge.ID = primitive.NewObjectID()
+	surge.CreatedAt = time.Now()
+	surge.UpdatedAt = time.Now()
+
+	if surge.StartTime.IsZero() {
+		surge.StartTime = surge.CreatedAt
+	}
+
+	_, err := r.collection.InsertOne(ctx, surge)
+	if err != nil {
+		return fmt.Errorf("failed to create surge pricing: %w", err)
+	}
+
+	r.invalidateActiveCache(ctx)
+
+	return nil
+}
+
+func (r *surgePricingRepository) GetByID(ctx context.Context, id primitive.ObjectID) (*models.SurgePricing, error) {
+	var surge models.SurgePricing
+	err := r.collection.FindOne(ctx, bson.M{"_id": id}).Decode(&surge)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, fmt.Errorf("surge pricing not found")
+		}
+		return nil, fmt.Errorf("failed to get surge pricing: %w", err)
+	}
+
+	return &surge, nil
+}
+
+func (r *surgePricingRepository) Update(ctx context.Context, id primitive.ObjectID, updates map[string]interface{}) error {
+	updates["updated_at"] = time.Now()
+
+	result, err := r.collection.UpdateOne(
+		ctx,
+		bson.M{"_id": id},
+		bson.M{"$set": updates},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update surge pricing: %w", err)
+	}
+
+	if result.MatchedCount == 0 {
+		return fmt.Errorf("surge pricing not found")
+	}
+
+	r.invalidateActiveCache(ctx)
+
+	return nil
+}
+
+// Lifecycle operations
+func (r *surgePricingRepository) End(ctx context.Context, id primitive.ObjectID, endTime time.Time) error {
+	return r.Update(ctx, id, map[string]interface{}{
+		"is_active": false,
+		"end_time":  endTime,
+	})
+}
+
+// Lookup operations
+func (r *surgePricingRepository) GetCurrent(ctx context.Context, geofenceID primitive.ObjectID) (*models.SurgePricing, error) {
+	opts := options.FindOne().SetSort(bson.D{{Key: "start_time", Value: -1}})
+
+	var surge models.SurgePricing
+	err := r.collection.FindOne(ctx, bson.M{
+		"geofence_id": geofenceID,
+		"is_active":   true,
+	}, opts).Decode(&surge)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, fmt.Errorf("surge pricing not found")
+		}
+		return nil, fmt.Errorf("failed to get current surge pricing: %w", err)
+	}
+
+	return &surge, nil
+}
+
+// GetLastEnded returns the geofence's most recently ended surge, which marks
+// when the zone went back to no surge if none is active.
+func (r *surgePricingRepository) GetLastEnded(ctx context.Context, geofenceID primitive.ObjectID) (*models.SurgePricing, error) {
+	opts := options.FindOne().SetSort(bson.D{{Key: "end_time", Value: -1}})
+
+	var surge models.SurgePricing
+	err := r.collection.FindOne(ctx, bson.M{
+		"geofence_id": geofenceID,
+		"is_active":   false,
+		"end_time":    bson.M{"$ne": nil},
+	}, opts).Decode(&surge)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, fmt.Errorf("surge pricing not found")
+		}
+		return nil, fmt.Errorf("failed to get last ended surge pricing: %w", err)
+	}
+
+	return &surge, nil
+}
+
+func (r *surgePricingRepository) GetActive(ctx context.Context) ([]*models.SurgePricing, error) {
+	cacheKey := utils.CacheSurgePricingPrefix + "active"
+	if r.cache != nil {
+		var cached []*models.SurgePricing
+		if err := r.cache.Get(ctx, cacheKey, &cached); err == nil {
+			return cached, nil
+		}
+	}
+
+	cursor, err := r.collection.Find(ctx, bson.M{"is_active": true})
+	if err != nil {
+		return nil, fmt.Errorf("failed to find active surge pricing: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var surges []*models.SurgePricing
+	for cursor.Next(ctx) {
+		var surge models.SurgePricing
+		if err := cursor.Decode(&surge); err != nil {
+			return nil, fmt.Errorf("failed to decode surge pricing: %w", err)
+		}
+		surges = append(surges, &surge)
+	}
+
+	if r.cache != nil {
+		r.cache.Set(ctx, cacheKey, surges, utils.SurgeUpdateInterval)
+	}
+
+	return surges, nil
+}
+
+func (r *surgePricingRepository) GetActiveByCell(ctx context.Context, cellID string) ([]*models.SurgePricing, error) {
+	cursor, err := r.collection.Find(ctx, bson.M{
+		"is_active": true,
+		"cell_ids":  cellID,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to find surge pricing for cell: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var surges []*models.SurgePricing
+	for cursor.Next(ctx) {
+		var surge models.SurgePricing
+		if err := cursor.Decode(&surge); err != nil {
+			return nil, fmt.Errorf("failed to decode surge pricing: %w", err)
+		}
+		surges = append(surges, &surge)
+	}
+
+	return surges, nil
+}
+
+func (r *surgePricingRepository) GetHistory(ctx context.Context, geofenceID primitive.ObjectID, params *utils.PaginationParams) ([]*models.SurgePricing, int64, error) {
+	filter := bson.M{"geofence_id": geofenceID}
+
+	total, err := r.collection.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to count surge pricing: %w", err)
+	}
+
+	cursor, err := r.collection.Find(ctx, filter, params.GetSortOptions())
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to find surge pricing: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var surges []*models.SurgePricing
+	for cursor.Next(ctx) {
+		var surge models.SurgePricing
+		if err := cursor.Decode(&surge); err != nil {
+			return nil, 0, fmt.Errorf("failed to decode surge pricing: %w", err)
+		}
+		surges = append(surges, &surge)
+	}
+
+	return surges, total, nil
+}
+
+// Cache operations
+func (r *surgePricingRepository) invalidateActiveCache(ctx context.Context) {
+	if r.cache != nil {
+		r.cache.Delete(ctx, utils.CacheSurgePricingPrefix+"active")
+	}
+}
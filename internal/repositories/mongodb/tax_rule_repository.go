@@ -0,0 +1,184 @@
+package mongodb
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"time"
+
+	"goride/internal/models"
+	"goride/internal/repositories/interfaces"
+	"goride/internal/services"
+	"goride/internal/utils"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const activeTaxRulesCacheKey = "tax_rules:active"
+
+type taxRuleRepository struct {
+	collection *mongo.Collection
+	cache      services.CacheService
+}
+
+func NewTaxRuleRepository(db *mongo.Database, cache services.CacheService) interfaces.TaxRuleRepository {
+	return &taxRuleRepository{
+		collection: db.Collection("tax_rules"),
+		cache:      cache,
+	}
+}
+
+// Basic CRUD operations
+func (r *taxRuleRepository) Create(ctx context.Context, rule *models.TaxRule) error {
+	rule.ID = primitive.NewObjectID()
+	rule.CreatedAt = time.Now()
+	rule.UpdatedAt = time.Now()
+
+	if rule.EffectiveFrom.IsZero() {
+		rule.EffectiveFrom = rule.CreatedAt
+	}
+
+	_, err := r.collection.InsertOne(ctx, rule)
+	if err != nil {
+		return fmt.Errorf("failed to create tax rule: %w", err)
+	}
+
+	r.invalidateActiveCache(ctx)
+
+	return nil
+}
+
+func (r *taxRuleRepository) GetByID(ctx context.Context, id primitive.ObjectID) (*models.TaxRule, error) {
+	var rule models.TaxRule
+	err := r.collection.FindOne(ctx, bson.M{"_id": id}).Decode(&rule)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, fmt.Errorf("tax rule not found")
+		}
+		return nil, fmt.Errorf("failed to get tax rule: %w", err)
+	}
+
+	return &rule, nil
+}
+
+func (r *taxRuleRepository) Update(ctx context.Context, id primitive.ObjectID, updates map[string]interface{}) error {
+	updates["updated_at"] = time.Now()
+
+	result, err := r.collection.UpdateOne(
+		ctx,
+		bson.M{"_id": id},
+		bson.M{"$set": updates},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update tax rule: %w", err)
+	}
+	if result.MatchedCount == 0 {
+		return fmt.Errorf("tax rule not found")
+	}
+
+	r.invalidateActiveCache(ctx)
+
+	return nil
+}
+
+func (r *taxRuleRepository) Delete(ctx context.Context, id primitive.ObjectID) error {
+	result, err := r.collection.DeleteOne(ctx, bson.M{"_id": id})
+	if err != nil {
+		return fmt.Errorf("failed to delete tax rule: %w", err)
+	}
+	if result.DeletedCount == 0 {
+		return fmt.Errorf("tax rule not found")
+	}
+
+	r.invalidateActiveCache(ctx)
+
+	return nil
+}
+
+// Lookup operations
+
+// GetActive returns every rule in force at the given time. Tax rules are few
+// and change rarely, so the active set is cached as a whole and filtered by
+// effective period on every call; matching a trip's jurisdiction is left to
+// the tax service.
+func (r *taxRuleRepository) GetActive(ctx context.Context, at time.Time) ([]*models.TaxRule, error) {
+	var rules []*models.TaxRule
+	cached := false
+	if r.cache != nil {
+		cached = r.cache.Get(ctx, activeTaxRulesCacheKey, &rules) == nil
+	}
+
+	if !cached {
+		cursor, err := r.collection.Find(ctx, bson.M{"is_active": true})
+		if err != nil {
+			return nil, fmt.Errorf("failed to find tax rules: %w", err)
+		}
+		defer cursor.Close(ctx)
+
+		for cursor.Next(ctx) {
+			var rule models.TaxRule
+			if err := cursor.Decode(&rule); err != nil {
+				return nil, fmt.Errorf("failed to decode tax rule: %w", err)
+			}
+			rules = append(rules, &rule)
+		}
+
+		if r.cache != nil {
+			r.cache.Set(ctx, activeTaxRulesCacheKey, rules, 10*time.Minute)
+		}
+	}
+
+	var effective []*models.TaxRule
+	for _, rule := range rules {
+		if isTaxRuleEffective(rule, at) {
+			effective = append(effective, rule)
+		}
+	}
+
+	return effective, nil
+}
+
+func (r *taxRuleRepository) List(ctx context.Context, country string, params *utils.PaginationParams) ([]*models.TaxRule, int64, error) {
+	filter := bson.M{}
+	if country != "" {
+		filter["country"] = bson.M{"$regex": "^" + regexp.QuoteMeta(country) + "$", "$options": "i"}
+	}
+
+	total, err := r.collection.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to count tax rules: %w", err)
+	}
+
+	cursor, err := r.collection.Find(ctx, filter, params.GetSortOptions())
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to find tax rules: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var rules []*models.TaxRule
+	for cursor.Next(ctx) {
+		var rule models.TaxRule
+		if err := cursor.Decode(&rule); err != nil {
+			return nil, 0, fmt.Errorf("failed to decode tax rule: %w", err)
+		}
+		rules = append(rules, &rule)
+	}
+
+	return rules, total, nil
+}
+
+// Helper methods
+func (r *taxRuleRepository) invalidateActiveCache(ctx context.Context) {
+	if r.cache != nil {
+		r.cache.Delete(ctx, activeTaxRulesCacheKey)
+	}
+}
+
+func isTaxRuleEffective(rule *models.TaxRule, at time.Time) bool {
+	if !rule.IsActive || rule.EffectiveFrom.After(at) {
+		return false
+	}
+	return rule.EffectiveUntil == nil || rule.EffectiveUntil.After(at)
+}
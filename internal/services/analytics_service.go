@@ -24,6 +24,7 @@ type AnalyticsService interface {
 	GetRideAnalytics(ctx context.Context, date time.Time, city string) (*models.RideAnalytics, error)
 	GetRideAnalyticsByDateRange(ctx context.Context, startDate, endDate time.Time, city string) ([]*models.RideAnalytics, error)
 	CalculateDailyRideStats(ctx context.Context, date time.Time, city string) error
+	GetRideAnalyticsByCell(ctx context.Context, cellID string, startDate, endDate time.Time) ([]*models.RideAnalytics, error)
 
 	// Dashboard Metrics
 	GetDashboardMetrics(ctx context.Context, days int) (map[string]interface{}, error)
@@ -42,6 +43,7 @@ type AnalyticsService interface {
 	GetAverageRideMetrics(ctx context.Context, days int) (map[string]interface{}, error)
 	GetPopularPickupAreas(ctx context.Context, city string, days int, limit int) ([]map[string]interface{}, error)
 	GetPopularDropoffAreas(ctx context.Context, city string, days int, limit int) ([]map[string]interface{}, error)
+	GetRideHeatmap(ctx context.Context, city string, days int, resolution int) ([]map[string]interface{}, error)
 
 	// Revenue Analytics
 	GetRevenueStats(ctx context.Context, days int) (map[string]interface{}, error)
@@ -209,11 +211,19 @@ func (s *analyticsService) CalculateDailyRideStats(ctx context.Context, date tim
 			"popular_routes":        analytics.PopularRoutes,
 			"updated_at":            time.Now(),
 		}
-		return s.analyticsRepo.UpdateRideAnalytics(ctx, date, city, updates)
+		if err := s.analyticsRepo.UpdateRideAnalytics(ctx, date, city, updates); err != nil {
+			return err
+		}
+	} else if err := s.analyticsRepo.CreateRideAnalytics(ctx, analytics); err != nil {
+		// Create new analytics
+		return err
 	}
 
-	// Create new analytics
-	return s.analyticsRepo.CreateRideAnalytics(ctx, analytics)
+	return s.calculateCellRideStats(ctx, date, city, cityRides)
+}
+
+func (s *analyticsService) GetRideAnalyticsByCell(ctx context.Context, cellID string, startDate, endDate time.Time) ([]*models.RideAnalytics, error) {
+	return s.analyticsRepo.GetRideAnalyticsByCell(ctx, cellID, startDate, endDate)
 }
 
 // Dashboard Metrics
@@ -339,6 +349,10 @@ func (s *analyticsService) GetPopularDropoffAreas(ctx context.Context, city stri
 	return s.analyticsRepo.GetPopularDropoffAreas(ctx, city, days, limit)
 }
 
+func (s *analyticsService) GetRideHeatmap(ctx context.Context, city string, days int, resolution int) ([]map[string]interface{}, error) {
+	return s.analyticsRepo.GetRideHeatmap(ctx, city, days, resolution)
+}
+
 // Revenue Analytics
 func (s *analyticsService) GetRevenueStats(ctx context.Context, days int) (map[string]interface{}, error) {
 	return s.analyticsRepo.GetRevenueStats(ctx, days)
@@ -529,6 +543,45 @@ func (s *analyticsService) calculateRideStatistics(rides []*models.Ride) map[str
 	}
 }
 
+// calculateCellRideStats writes a rollup per pickup cell alongside the
+// city-wide one, so zone metrics use the same cells as surge and heatmaps.
+func (s *analyticsService) calculateCellRideStats(ctx context.Context, date time.Time, city string, rides []*models.Ride) error {
+	cellRides := make(map[string][]*models.Ride)
+	for _, ride := range rides {
+		pickup := ride.PickupLocation
+		if pickup.CellID == "" {
+			pickup.AssignCell(utils.CellResolution)
+		}
+		if pickup.CellID != "" {
+			cellRides[pickup.CellID] = append(cellRides[pickup.CellID], ride)
+		}
+	}
+
+	for cellID, rides := range cellRides {
+		stats := s.calculateRideStatistics(rides)
+		analytics := &models.RideAnalytics{
+			Date:                date,
+			City:                city,
+			CellID:              cellID,
+			TotalRides:          stats["total_rides"].(int64),
+			CompletedRides:      stats["completed_rides"].(int64),
+			CancelledRides:      stats["cancelled_rides"].(int64),
+			TotalRevenue:        stats["total_revenue"].(float64),
+			AverageRideValue:    stats["average_ride_value"].(float64),
+			AverageRideTime:     stats["average_ride_time"].(float64),
+			AverageRideDistance: stats["average_ride_distance"].(float64),
+			PeakHours:           stats["peak_hours"].([]string),
+			PopularRoutes:       stats["popular_routes"].([]models.RouteStats),
+		}
+
+		if err := s.analyticsRepo.UpsertCellRideAnalytics(ctx, analytics); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 func (s *analyticsService) calculateGrowthRate(stats map[string]int64) float64 {
 	if current, exists := stats["current"]; exists {
 		if previous, exists := stats["previous"]; exists && previous > 0 {
@@ -0,0 +1,565 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"goride/internal/config"
+	"goride/internal/models"
+	"goride/internal/repositories/interfaces"
+	"goride/internal/utils"
+	"goride/pkg/logger"
+	"goride/pkg/money"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type CancellationPolicyService interface {
+	// Cancellation
+	PreviewCancellation(ctx context.Context, rideID, actorID primitive.ObjectID, cancelledBy string) (*CancellationDecision, error)
+	CancelRide(ctx context.Context, rideID, actorID primitive.ObjectID, cancelledBy, reason string) (*models.Ride, *CancellationDecision, error)
+
+	// Policy Management
+	CreatePolicy(ctx context.Context, policy *models.CancellationPolicy) error
+	UpdatePolicy(ctx context.Context, policyID primitive.ObjectID, updates map[string]interface{}) error
+	GetPolicy(ctx context.Context, city string, rideType models.RideType) (*models.CancellationPolicy, error)
+	ListPolicies(ctx context.Context, params *utils.PaginationParams) ([]*models.CancellationPolicy, int64, error)
+}
+
+// CancellationRule names the rule that decided a cancellation
+type CancellationRule string
+
+const (
+	CancellationRuleNotCharged       CancellationRule = "not_charged"
+	CancellationRuleBookingWindow    CancellationRule = "free_window_after_booking"
+	CancellationRuleAcceptanceWindow CancellationRule = "free_window_after_acceptance"
+	CancellationRuleETAIncrease      CancellationRule = "eta_increase_waiver"
+	CancellationRuleLoyaltyFlex      CancellationRule = "loyalty_cancellation_flex"
+	CancellationRuleRiderFee         CancellationRule = "rider_cancellation_fee"
+	CancellationRuleDriverFreeWindow CancellationRule = "driver_free_window"
+	CancellationRuleDriverPenalty    CancellationRule = "driver_cancellation_penalty"
+	CancellationRuleNoFeeConfigured  CancellationRule = "no_fee_configured"
+)
+
+// Ride history event recorded for every policy-driven cancellation
+const RideHistoryCancellationEvaluated = "cancellation_evaluated"
+
+// CancellationDecision is the outcome of the policy for a cancellation, with an
+// explanation that can be shown before the user confirms.
+type CancellationDecision struct {
+	RideID           primitive.ObjectID  `json:"ride_id"`
+	CancelledBy      string              `json:"cancelled_by"`
+	RideStatus       models.RideStatus   `json:"ride_status"`
+	Rule             CancellationRule    `json:"rule"`
+	Fee              money.Money         `json:"fee"`
+	DriverPenalty    money.Money         `json:"driver_penalty"`
+	Currency         string              `json:"currency"`
+	Waived           bool                `json:"waived"`
+	CountsTowardRate bool                `json:"counts_toward_rate"`
+	FreeUntil        *time.Time          `json:"free_until,omitempty"`
+	ETAIncrease      int                 `json:"eta_increase,omitempty"` // minutes
+	Explanation      string              `json:"explanation"`
+	PolicyID         *primitive.ObjectID `json:"policy_id,omitempty"`
+	EvaluatedAt      time.Time           `json:"evaluated_at"`
+}
+
+type cancellationPolicyService struct {
+	rideRepo          interfaces.RideRepository
+	riderRepo         interfaces.RiderRepository
+	driverRepo        interfaces.DriverRepository
+	policyRepo        interfaces.CancellationPolicyRepository
+	fareStructureRepo interfaces.FareStructureRepository
+	loyaltyRepo       interfaces.LoyaltyRepository
+	paymentRepo       interfaces.PaymentRepository
+	rideService       RideService
+	exchangeService   ExchangeRateService
+	walletService     WalletService
+	taxService        TaxService
+	cache             CacheService
+	config            *config.DispatchConfig
+	logger            *logger.Logger
+}
+
+func NewCancellationPolicyService(
+	rideRepo interfaces.RideRepository,
+	riderRepo interfaces.RiderRepository,
+	driverRepo interfaces.DriverRepository,
+	policyRepo interfaces.CancellationPolicyRepository,
+	fareStructureRepo interfaces.FareStructureRepository,
+	loyaltyRepo interfaces.LoyaltyRepository,
+	paymentRepo interfaces.PaymentRepository,
+	rideService RideService,
+	exchangeService ExchangeRateService,
+	walletService WalletService,
+	taxService TaxService,
+	cache CacheService,
+	config *config.DispatchConfig,
+	logger *logger.Logger,
+) CancellationPolicyService {
+	return &cancellationPolicyService{
+		rideRepo:          rideRepo,
+		riderRepo:         riderRepo,
+		driverRepo:        driverRepo,
+		policyRepo:        policyRepo,
+		fareStructureRepo: fareStructureRepo,
+		loyaltyRepo:       loyaltyRepo,
+		paymentRepo:       paymentRepo,
+		rideService:       rideService,
+		exchangeService:   exchangeService,
+		walletService:     walletService,
+		taxService:        taxService,
+		cache:             cache,
+		config:            config,
+		logger:            logger,
+	}
+}
+
+// Cancellation
+
+// PreviewCancellation evaluates the policy without cancelling, so the fee and
+// its explanation can be shown before the user confirms.
+func (s *cancellationPolicyService) PreviewCancellation(ctx context.Context, rideID, actorID primitive.ObjectID, cancelledBy string) (*CancellationDecision, error) {
+	_, decision, err := s.preview(ctx, rideID, actorID, cancelledBy)
+	return decision, err
+}
+
+// CancelRide re-evaluates the policy at the moment of cancellation, cancels
+// the ride and applies the resulting fee or driver penalty. The rider's fee is
+// charged by the ride service as the ride is cancelled, from the payment hold
+// when there is one; the driver's penalty is taken from their wallet.
+func (s *cancellationPolicyService) CancelRide(ctx context.Context, rideID, actorID primitive.ObjectID, cancelledBy, reason string) (*models.Ride, *CancellationDecision, error) {
+	ride, decision, err := s.preview(ctx, rideID, actorID, cancelledBy)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var driver *models.Driver
+	if ride.DriverID != nil {
+		driver, err = s.driverRepo.GetByID(ctx, *ride.DriverID)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to get driver: %w", err)
+		}
+	}
+
+	fee, err := s.cancellationFee(ctx, ride, driver, decision)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ride, err = s.rideService.CancelRideWithFee(ctx, rideID, reason, cancelledBy, fee)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := s.applyDecision(ctx, ride, driver, decision); err != nil {
+		s.logger.WithError(err).WithRideID(rideID).Error("Failed to apply cancellation decision")
+		return ride, decision, err
+	}
+
+	ride.CancellationFee = decision.Fee.Float64()
+
+	s.logger.WithRideID(rideID).
+		WithField("cancelled_by", cancelledBy).
+		WithField("rule", decision.Rule).
+		WithField("fee", decision.Fee.String()).
+		WithField("driver_penalty", decision.DriverPenalty.String()).
+		WithField("currency", decision.Currency).
+		Info("Cancellation policy applied")
+
+	return ride, decision, nil
+}
+
+// Policy Management
+func (s *cancellationPolicyService) CreatePolicy(ctx context.Context, policy *models.CancellationPolicy) error {
+	if policy.RiderFee.IsNegative() || policy.DriverPenalty.IsNegative() {
+		return fmt.Errorf("cancellation fees cannot be negative")
+	}
+	if policy.RiderFee.IsPositive() && policy.RiderFee.Currency == "" ||
+		policy.DriverPenalty.IsPositive() && policy.DriverPenalty.Currency == "" {
+		return fmt.Errorf("cancellation fees require a currency")
+	}
+
+	if err := s.policyRepo.Create(ctx, policy); err != nil {
+		return fmt.Errorf("failed to create cancellation policy: %w", err)
+	}
+
+	return nil
+}
+
+func (s *cancellationPolicyService) UpdatePolicy(ctx context.Context, policyID primitive.ObjectID, updates map[string]interface{}) error {
+	if err := s.policyRepo.Update(ctx, policyID, updates); err != nil {
+		return fmt.Errorf("failed to update cancellation policy: %w", err)
+	}
+
+	return nil
+}
+
+func (s *cancellationPolicyService) GetPolicy(ctx context.Context, city string, rideType models.RideType) (*models.CancellationPolicy, error) {
+	policy, err := s.policyRepo.GetPolicy(ctx, city, rideType)
+	if err != nil {
+		s.logger.WithField("city", city).
+			WithField("ride_type", rideType).
+			Debug("No cancellation policy configured, using default")
+		return defaultCancellationPolicy(), nil
+	}
+
+	return policy, nil
+}
+
+func (s *cancellationPolicyService) ListPolicies(ctx context.Context, params *utils.PaginationParams) ([]*models.CancellationPolicy, int64, error) {
+	return s.policyRepo.List(ctx, params)
+}
+
+// Helper methods
+func (s *cancellationPolicyService) preview(ctx context.Context, rideID, actorID primitive.ObjectID, cancelledBy string) (*models.Ride, *CancellationDecision, error) {
+	ride, err := s.rideService.GetRide(ctx, rideID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := validateCancellingActor(ride, actorID, cancelledBy); err != nil {
+		return nil, nil, err
+	}
+
+	if !s.rideService.CanTransition(ride.Status, models.RideStatusCancelled) {
+		return nil, nil, fmt.Errorf("ride in status %s cannot be cancelled", ride.Status)
+	}
+
+	return ride, s.evaluate(ctx, ride, cancelledBy, time.Now()), nil
+}
+
+func (s *cancellationPolicyService) evaluate(ctx context.Context, ride *models.Ride, cancelledBy string, now time.Time) *CancellationDecision {
+	policy, _ := s.GetPolicy(ctx, ride.PickupLocation.City, ride.RideType)
+
+	decision := &CancellationDecision{
+		RideID:        ride.ID,
+		CancelledBy:   cancelledBy,
+		RideStatus:    ride.Status,
+		Fee:           money.Zero(ride.Currency),
+		DriverPenalty: money.Zero(ride.Currency),
+		Currency:      ride.Currency,
+		EvaluatedAt:   now,
+	}
+	if !policy.ID.IsZero() {
+		decision.PolicyID = &policy.ID
+	}
+
+	switch cancelledBy {
+	case CancelledByRider:
+		s.evaluateRider(ctx, ride, policy, decision, now)
+	case CancelledByDriver:
+		s.evaluateDriver(ride, policy, decision, now)
+	default:
+		decision.Rule = CancellationRuleNotCharged
+		decision.Explanation = "This ride was cancelled by GoRide. No fee applies."
+	}
+
+	return decision
+}
+
+func (s *cancellationPolicyService) evaluateRider(ctx context.Context, ride *models.Ride, policy *models.CancellationPolicy, decision *CancellationDecision, now time.Time) {
+	fee := policy.RiderFee
+	if fareStructure, err := s.fareStructureRepo.GetActive(ctx, ride.PickupLocation.City, ride.RideType, now); err == nil {
+		decision.Currency = fareStructure.Currency
+		if !fee.IsPositive() {
+			fee = fareStructure.CancellationFee
+		}
+	}
+	if fee.Currency != "" {
+		decision.Currency = fee.Currency
+	}
+
+	bookingWindowEnd := ride.RequestedAt.Add(time.Duration(policy.RiderFreeWindowAfterBooking) * time.Minute)
+	freeUntil := bookingWindowEnd
+	if ride.AcceptedAt != nil {
+		acceptWindowEnd := ride.AcceptedAt.Add(time.Duration(policy.RiderFreeWindowAfterAccept) * time.Minute)
+		if acceptWindowEnd.After(freeUntil) {
+			freeUntil = acceptWindowEnd
+		}
+	}
+	decision.FreeUntil = &freeUntil
+
+	switch {
+	case !fee.IsPositive():
+		decision.Rule = CancellationRuleNoFeeConfigured
+		decision.Explanation = "You can cancel this ride for free."
+		return
+	case now.Before(bookingWindowEnd):
+		decision.Rule = CancellationRuleBookingWindow
+		decision.Explanation = fmt.Sprintf("You can cancel for free within %d minutes of booking.", policy.RiderFreeWindowAfterBooking)
+		return
+	case ride.AcceptedAt != nil && now.Before(freeUntil):
+		decision.Rule = CancellationRuleAcceptanceWindow
+		decision.Explanation = fmt.Sprintf("You can cancel for free within %d minutes of your driver accepting.", policy.RiderFreeWindowAfterAccept)
+		return
+	}
+
+	if increase := s.pickupETAIncrease(ctx, ride, now); policy.ETAIncreaseWaiver > 0 && increase > policy.ETAIncreaseWaiver {
+		decision.Rule = CancellationRuleETAIncrease
+		decision.Waived = true
+		decision.ETAIncrease = increase
+		decision.Explanation = fmt.Sprintf("Your driver is now %d minutes later than first estimated, so the %s cancellation fee is waived.",
+			increase, utils.FormatCurrency(fee.Float64(), decision.Currency))
+		return
+	}
+
+	if policy.HonorLoyaltyFlex {
+		if tier := s.getRiderTier(ctx, ride.RiderID); tier != nil && tier.CancellationFlex {
+			decision.Rule = CancellationRuleLoyaltyFlex
+			decision.Waived = true
+			decision.Explanation = fmt.Sprintf("Your %s membership includes flexible cancellation, so the %s cancellation fee is waived.",
+				tier.TierName, utils.FormatCurrency(fee.Float64(), decision.Currency))
+			return
+		}
+	}
+
+	decision.Rule = CancellationRuleRiderFee
+	decision.Fee = fee
+	decision.Explanation = fmt.Sprintf("A %s cancellation fee applies because the free cancellation window ended at %s.",
+		utils.FormatCurrency(fee.Float64(), decision.Currency), freeUntil.Format("15:04"))
+}
+
+func (s *cancellationPolicyService) evaluateDriver(ride *models.Ride, policy *models.CancellationPolicy, decision *CancellationDecision, now time.Time) {
+	if ride.AcceptedAt != nil {
+		freeUntil := ride.AcceptedAt.Add(time.Duration(policy.DriverFreeWindowAfterAccept) * time.Minute)
+		decision.FreeUntil = &freeUntil
+
+		if now.Before(freeUntil) {
+			decision.Rule = CancellationRuleDriverFreeWindow
+			decision.Explanation = fmt.Sprintf("You can cancel within %d minutes of accepting without a penalty.", policy.DriverFreeWindowAfterAccept)
+			return
+		}
+	}
+
+	decision.Rule = CancellationRuleDriverPenalty
+	decision.CountsTowardRate = true
+
+	if policy.DriverPenalty.IsPositive() {
+		decision.DriverPenalty = policy.DriverPenalty
+		decision.Currency = policy.DriverPenalty.Currency
+		decision.Explanation = fmt.Sprintf("A %s penalty applies and this cancellation counts toward your cancellation rate.",
+			utils.FormatCurrency(policy.DriverPenalty.Float64(), decision.Currency))
+	} else {
+		decision.Explanation = "This cancellation counts toward your cancellation rate."
+	}
+}
+
+// pickupETAIncrease returns how many minutes later the driver is now expected
+// at pickup compared with the ETA quoted at acceptance.
+func (s *cancellationPolicyService) pickupETAIncrease(ctx context.Context, ride *models.Ride, now time.Time) int {
+	if ride.Status != models.RideStatusAccepted || ride.AcceptedAt == nil || ride.DriverID == nil || ride.PickupETA <= 0 {
+		return 0
+	}
+
+	location, err := s.cache.GetDriverLocation(ctx, *ride.DriverID)
+	if err != nil || location == nil {
+		return 0
+	}
+
+	distance := utils.CalculateDistance(
+		location.Latitude(), location.Longitude(),
+		ride.PickupLocation.Latitude(), ride.PickupLocation.Longitude(),
+	)
+
+	quotedArrival := ride.AcceptedAt.Add(time.Duration(ride.PickupETA) * time.Minute)
+	expectedArrival := now.Add(time.Duration(utils.EstimateETAMinutes(distance, s.config.AverageSpeedKMH)) * time.Minute)
+
+	return int(expectedArrival.Sub(quotedArrival).Minutes())
+}
+
+// getRiderTier returns the highest loyalty tier the rider's points qualify for.
+func (s *cancellationPolicyService) getRiderTier(ctx context.Context, riderID primitive.ObjectID) *models.TierBenefit {
+	rider, err := s.riderRepo.GetByUserID(ctx, riderID)
+	if err != nil {
+		return nil
+	}
+
+	program, err := s.loyaltyRepo.GetActiveProgram(ctx)
+	if err != nil {
+		return nil
+	}
+
+	var tier *models.TierBenefit
+	for i := range program.TierBenefits {
+		benefit := &program.TierBenefits[i]
+		if rider.LoyaltyPoints >= int64(benefit.MinimumPoints) && (tier == nil || benefit.MinimumPoints > tier.MinimumPoints) {
+			tier = benefit
+		}
+	}
+
+	return tier
+}
+
+// cancellationFee builds the rider's cancellation fee payment, with its tax.
+// The fee compensates the driver when one was on the way. It is nil when the
+// decision charges no fee.
+func (s *cancellationPolicyService) cancellationFee(ctx context.Context, ride *models.Ride, driver *models.Driver, decision *CancellationDecision) (*models.Payment, error) {
+	if !decision.Fee.IsPositive() {
+		return nil, nil
+	}
+
+	pickup := ride.PickupLocation
+	taxes, err := s.taxService.CalculateTax(ctx, &TaxRequest{
+		Country:    pickup.Country,
+		Region:     pickup.State,
+		City:       pickup.City,
+		Location:   &pickup,
+		Currency:   decision.Fee.Currency,
+		Components: map[models.TaxComponent]money.Money{models.TaxComponentCancellationFee: decision.Fee},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to calculate cancellation fee tax: %w", err)
+	}
+	amount, err := decision.Fee.Add(taxes.Exclusive)
+	if err != nil {
+		return nil, fmt.Errorf("failed to total cancellation fee: %w", err)
+	}
+	taxAmount, err := taxes.Inclusive.Add(taxes.Exclusive)
+	if err != nil {
+		return nil, fmt.Errorf("failed to total cancellation fee tax: %w", err)
+	}
+	netFee, err := decision.Fee.Sub(taxes.Inclusive)
+	if err != nil {
+		return nil, fmt.Errorf("failed to total cancellation fee: %w", err)
+	}
+
+	fee := &models.Payment{
+		RideID:        ride.ID,
+		PayerID:       ride.RiderID,
+		PaymentMethod: models.PaymentMethodCreditCard,
+		PaymentType:   models.PaymentTypePenalty,
+		Status:        models.PaymentStatusPending,
+		Amount:        amount,
+		Currency:      amount.Currency,
+		TaxAmount:     taxAmount,
+		TaxLines:      taxes.Lines,
+	}
+	if driver != nil {
+		fee.PayeeID = driver.UserID
+		fee.DriverEarnings = netFee
+	} else {
+		fee.PlatformFee = netFee
+	}
+
+	return fee, nil
+}
+
+func (s *cancellationPolicyService) applyDecision(ctx context.Context, ride *models.Ride, driver *models.Driver, decision *CancellationDecision) error {
+	if decision.Fee.IsPositive() {
+		if err := s.rideRepo.Update(ctx, ride.ID, map[string]interface{}{
+			"cancellation_fee": decision.Fee.Float64(),
+		}); err != nil {
+			return fmt.Errorf("failed to record cancellation fee: %w", err)
+		}
+	}
+
+	if driver != nil && decision.DriverPenalty.IsPositive() {
+		if err := s.chargeDriverPenalty(ctx, ride, driver, decision.DriverPenalty); err != nil {
+			return err
+		}
+	}
+
+	if driver != nil && decision.CountsTowardRate {
+		cancellations := driver.TotalCancellations + 1
+		if err := s.driverRepo.Update(ctx, driver.ID, map[string]interface{}{
+			"total_cancellations": cancellations,
+			"cancellation_rate":   float64(cancellations) / float64(driver.TotalRides+cancellations),
+		}); err != nil {
+			return fmt.Errorf("failed to update driver cancellation rate: %w", err)
+		}
+	}
+
+	details := map[string]interface{}{
+		"rule":           decision.Rule,
+		"fee":            decision.Fee,
+		"driver_penalty": decision.DriverPenalty,
+		"waived":         decision.Waived,
+		"explanation":    decision.Explanation,
+	}
+	if decision.PolicyID != nil {
+		details["policy_id"] = decision.PolicyID.Hex()
+	}
+
+	entry := &models.RideHistoryEntry{
+		Event:     RideHistoryCancellationEvaluated,
+		ActorType: decision.CancelledBy,
+		Details:   details,
+	}
+	if decision.CancelledBy == CancelledByRider {
+		entry.ActorID = &ride.RiderID
+	} else if decision.CancelledBy == CancelledByDriver {
+		entry.ActorID = ride.DriverID
+	}
+
+	if err := s.rideRepo.AddHistoryEntry(ctx, ride.ID, entry); err != nil {
+		s.logger.WithError(err).WithRideID(ride.ID).Warn("Failed to record ride history")
+	}
+
+	return nil
+}
+
+// chargeDriverPenalty takes the driver's penalty from their wallet. The
+// payment takes the ride's first fine attempt, so the penalty is taken once
+// however often the decision is applied.
+func (s *cancellationPolicyService) chargeDriverPenalty(ctx context.Context, ride *models.Ride, driver *models.Driver, penalty money.Money) error {
+	now := time.Now()
+	fine := &models.Payment{
+		RideID:        ride.ID,
+		PayerID:       driver.UserID,
+		PaymentMethod: models.PaymentMethodWallet,
+		PaymentType:   models.PaymentTypeDriverFine,
+		Status:        models.PaymentStatusCompleted,
+		Amount:        penalty,
+		Currency:      penalty.Currency,
+		PlatformFee:   penalty,
+		ProcessedAt:   &now,
+	}
+	fine.SetAttempt(1)
+
+	if existing, err := s.paymentRepo.GetByIdempotencyKey(ctx, fine.IdempotencyKey); err == nil {
+		fine = existing
+	} else {
+		if err := s.exchangeService.SnapshotPayment(ctx, fine); err != nil {
+			s.logger.WithError(err).WithRideID(ride.ID).Warn("Driver penalty charged without an exchange rate snapshot")
+		}
+		if err := s.paymentRepo.Create(ctx, fine); err != nil {
+			return fmt.Errorf("failed to create driver penalty payment: %w", err)
+		}
+	}
+
+	// A penalty already posted returns its entry
+	if _, err := s.walletService.RecordPayment(ctx, fine); err != nil {
+		return fmt.Errorf("failed to post driver penalty: %w", err)
+	}
+
+	return nil
+}
+
+func validateCancellingActor(ride *models.Ride, actorID primitive.ObjectID, cancelledBy string) error {
+	switch cancelledBy {
+	case CancelledByRider:
+		if ride.RiderID != actorID {
+			return fmt.Errorf("ride does not belong to this rider")
+		}
+	case CancelledByDriver:
+		return validateRideDriver(ride, actorID)
+	case CancelledBySystem, CancelledByAdmin:
+	default:
+		return fmt.Errorf("invalid cancelling party: %s", cancelledBy)
+	}
+	return nil
+}
+
+// defaultCancellationPolicy applies when no policy is configured for a city
+// and ride type.
+func defaultCancellationPolicy() *models.CancellationPolicy {
+	return &models.CancellationPolicy{
+		RiderFreeWindowAfterBooking: 5,
+		RiderFreeWindowAfterAccept:  2,
+		ETAIncreaseWaiver:           5,
+		HonorLoyaltyFlex:            true,
+		DriverFreeWindowAfterAccept: 2,
+		IsActive:                    true,
+	}
+}
@@ -0,0 +1,235 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"goride/internal/config"
+	"goride/internal/models"
+	"goride/internal/repositories/interfaces"
+	"goride/pkg/money"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type fakePolicyRepo struct {
+	interfaces.CancellationPolicyRepository
+	policy *models.CancellationPolicy
+}
+
+func (r *fakePolicyRepo) GetPolicy(ctx context.Context, city string, rideType models.RideType) (*models.CancellationPolicy, error) {
+	return r.policy, nil
+}
+
+type fakeFareStructures struct {
+	interfaces.FareStructureRepository
+}
+
+func (fakeFareStructures) GetActive(ctx context.Context, city string, rideType models.RideType, at time.Time) (*models.FareStructure, error) {
+	return nil, fmt.Errorf("fare structure not found")
+}
+
+// fakeTax levies no tax.
+type fakeTax struct {
+	TaxService
+}
+
+func (fakeTax) CalculateTax(ctx context.Context, request *TaxRequest) (*TaxResult, error) {
+	return &TaxResult{Inclusive: money.Zero(request.Currency), Exclusive: money.Zero(request.Currency)}, nil
+}
+
+type cancellationFixture struct {
+	service  CancellationPolicyService
+	ride     *models.Ride
+	driver   *models.Driver
+	card     primitive.ObjectID
+	rides    *fakeRideRepo
+	payments *fakePaymentRepo
+	provider *fakeProvider
+	ledger   *fakeLedgerRepo
+	holds    PaymentHoldService
+}
+
+// newCancellationFixture sets up an accepted ride well past every free
+// window, under a policy charging riders $5 and drivers $10 to cancel.
+func newCancellationFixture(t *testing.T) *cancellationFixture {
+	t.Helper()
+
+	long := time.Now().Add(-time.Hour)
+	f := &cancellationFixture{
+		card:     primitive.NewObjectID(),
+		payments: newFakePaymentRepo(),
+		provider: newFakeProvider(),
+		ledger:   newFakeLedgerRepo(),
+		driver:   &models.Driver{ID: primitive.NewObjectID(), UserID: primitive.NewObjectID()},
+	}
+	f.ride = &models.Ride{
+		ID:            primitive.NewObjectID(),
+		RiderID:       primitive.NewObjectID(),
+		DriverID:      &f.driver.ID,
+		Status:        models.RideStatusAccepted,
+		EstimatedFare: 20,
+		Currency:      "USD",
+		RequestedAt:   long,
+		AcceptedAt:    &long,
+	}
+	stored := *f.ride
+	f.rides = &fakeRideRepo{rides: map[primitive.ObjectID]*models.Ride{f.ride.ID: &stored}}
+
+	riders := &fakeRiderRepo{riders: map[primitive.ObjectID]*models.Rider{
+		f.ride.RiderID: {UserID: f.ride.RiderID, DefaultPaymentID: &f.card},
+	}}
+	drivers := &fakeDriverRepo{drivers: map[primitive.ObjectID]*models.Driver{f.driver.ID: f.driver}}
+	policies := &fakePolicyRepo{policy: &models.CancellationPolicy{
+		RiderFee:      money.New(500, "USD"),
+		DriverPenalty: money.New(1000, "USD"),
+		IsActive:      true,
+	}}
+
+	cache := newFakeCache()
+	log := newTestLogger(t)
+	wallet := NewWalletService(f.ledger, fakeExchange{}, cache, nil, log)
+	f.holds = NewPaymentHoldService(f.payments, f.rides, riders, drivers, wallet, fakeExchange{}, nil,
+		f.provider, cache, &config.PaymentHoldConfig{BufferPercent: 20}, log)
+	rides := NewRideService(f.rides, riders, drivers, nil, nil, f.payments, f.provider, nil, nil,
+		fakeExchange{}, nil, f.holds, wallet, cache, nil, nil, nil, log)
+	f.service = NewCancellationPolicyService(f.rides, riders, drivers, policies, fakeFareStructures{}, nil,
+		f.payments, rides, fakeExchange{}, wallet, fakeTax{}, cache, &config.DispatchConfig{}, log)
+
+	return f
+}
+
+// postings gathers the postings of every ledger entry.
+func (f *cancellationFixture) postings() []models.LedgerPosting {
+	var postings []models.LedgerPosting
+	for _, entry := range f.ledger.postings {
+		postings = append(postings, entry...)
+	}
+	return postings
+}
+
+func TestCancelRideCollectsFees(t *testing.T) {
+	tests := []struct {
+		name        string
+		cancelledBy string
+		method      models.PaymentMethod
+		hold        bool
+		wantType    models.PaymentType
+		wantStatus  models.PaymentStatus
+		wantCapture bool
+		wantCharged bool
+		wantLedger  map[models.LedgerAccountType]int64
+	}{
+		{
+			name:        "rider fee is captured from the hold",
+			cancelledBy: CancelledByRider,
+			hold:        true,
+			wantType:    models.PaymentTypePenalty,
+			wantStatus:  models.PaymentStatusCompleted,
+			wantCapture: true,
+			wantLedger: map[models.LedgerAccountType]int64{
+				models.LedgerAccountPaymentClearing: -500,
+				models.LedgerAccountDriverWallet:    500,
+			},
+		},
+		{
+			name:        "rider fee without a hold is charged to the card",
+			cancelledBy: CancelledByRider,
+			wantType:    models.PaymentTypePenalty,
+			wantStatus:  models.PaymentStatusCompleted,
+			wantCharged: true,
+			wantLedger: map[models.LedgerAccountType]int64{
+				models.LedgerAccountPaymentClearing: -500,
+				models.LedgerAccountDriverWallet:    500,
+			},
+		},
+		{
+			name:        "rider fee on a wallet ride is debited from the wallet",
+			cancelledBy: CancelledByRider,
+			method:      models.PaymentMethodWallet,
+			wantType:    models.PaymentTypePenalty,
+			wantStatus:  models.PaymentStatusCompleted,
+			wantLedger: map[models.LedgerAccountType]int64{
+				models.LedgerAccountRiderWallet:  -500,
+				models.LedgerAccountDriverWallet: 500,
+			},
+		},
+		{
+			name:        "rider fee on a cash ride is recorded as uncollected",
+			cancelledBy: CancelledByRider,
+			method:      models.PaymentMethodCash,
+			wantType:    models.PaymentTypePenalty,
+			wantStatus:  models.PaymentStatusFailed,
+			wantLedger:  map[models.LedgerAccountType]int64{},
+		},
+		{
+			name:        "driver penalty is taken from the driver wallet",
+			cancelledBy: CancelledByDriver,
+			hold:        true,
+			wantType:    models.PaymentTypeDriverFine,
+			wantStatus:  models.PaymentStatusCompleted,
+			wantLedger: map[models.LedgerAccountType]int64{
+				models.LedgerAccountDriverWallet:    -1000,
+				models.LedgerAccountPlatformRevenue: 1000,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			f := newCancellationFixture(t)
+			stored := f.rides.rides[f.ride.ID]
+			stored.PaymentMethod = tt.method
+
+			var hold *models.Payment
+			if tt.hold {
+				var err error
+				if hold, err = f.holds.PlaceHold(ctx, stored); err != nil || hold == nil {
+					t.Fatalf("PlaceHold() = %v, %v; want a hold", hold, err)
+				}
+			}
+
+			actor := f.ride.RiderID
+			if tt.cancelledBy == CancelledByDriver {
+				actor = f.driver.ID
+			}
+			ride, _, err := f.service.CancelRide(ctx, f.ride.ID, actor, tt.cancelledBy, "changed plans")
+			if err != nil {
+				t.Fatalf("CancelRide() error = %v", err)
+			}
+			if ride.Status != models.RideStatusCancelled {
+				t.Errorf("ride status = %s, want cancelled", ride.Status)
+			}
+
+			var fees []*models.Payment
+			for _, id := range f.payments.order {
+				if p := f.payments.payments[id]; p.PaymentType == tt.wantType {
+					fees = append(fees, p)
+				}
+			}
+			if len(fees) != 1 || fees[0].Status != tt.wantStatus {
+				t.Fatalf("%s payments = %v, want one %s", tt.wantType, fees, tt.wantStatus)
+			}
+
+			if captured := len(f.provider.captures) == 1 && f.provider.captures[0].Amount.Amount == 500; captured != tt.wantCapture {
+				t.Errorf("fee captured from the hold = %v, want %v", captured, tt.wantCapture)
+			}
+			if tt.wantCapture && fees[0].ID != hold.ID {
+				t.Errorf("fee recorded on payment %s, want the hold %s", fees[0].ID.Hex(), hold.ID.Hex())
+			}
+			if charged := len(f.provider.requests) == 1; charged != tt.wantCharged {
+				t.Errorf("fee charged to the card = %v, want %v", charged, tt.wantCharged)
+			}
+			if hold != nil && !tt.wantCapture {
+				if got := f.payments.payments[hold.ID].Status; got != models.PaymentStatusVoided {
+					t.Errorf("hold status = %s, want voided", got)
+				}
+			}
+
+			assertPostings(t, f.postings(), tt.wantLedger)
+		})
+	}
+}
@@ -0,0 +1,232 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"goride/internal/config"
+	"goride/internal/models"
+	"goride/internal/repositories/interfaces"
+	"goride/pkg/exchange"
+	"goride/pkg/logger"
+	"goride/pkg/money"
+)
+
+type ExchangeRateService interface {
+	// Rates
+	GetRate(ctx context.Context, from, to string) (*models.ExchangeRate, error)
+	Convert(ctx context.Context, amount money.Money, to string) (money.Money, *models.ExchangeRate, error)
+
+	// Snapshots
+	SnapshotPayment(ctx context.Context, payment *models.Payment) error
+	SnapshotEntry(ctx context.Context, entry *models.LedgerEntry) error
+
+	// Reports
+	GetRevenueReport(ctx context.Context, startDate, endDate time.Time) (map[string]interface{}, error)
+}
+
+type exchangeRateService struct {
+	provider    exchange.ExchangeRateProvider
+	paymentRepo interfaces.PaymentRepository
+	config      *config.CurrencyConfig
+	logger      *logger.Logger
+}
+
+func NewExchangeRateService(
+	provider exchange.ExchangeRateProvider,
+	paymentRepo interfaces.PaymentRepository,
+	config *config.CurrencyConfig,
+	logger *logger.Logger,
+) ExchangeRateService {
+	return &exchangeRateService{
+		provider:    provider,
+		paymentRepo: paymentRepo,
+		config:      config,
+		logger:      logger,
+	}
+}
+
+// Rates
+func (s *exchangeRateService) GetRate(ctx context.Context, from, to string) (*models.ExchangeRate, error) {
+	rate, err := s.provider.GetRate(ctx, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get exchange rate from %s to %s: %w", from, to, err)
+	}
+
+	return &models.ExchangeRate{
+		From:   rate.From,
+		To:     rate.To,
+		Rate:   rate.Rate,
+		Source: rate.Source,
+		AsOf:   rate.AsOf,
+	}, nil
+}
+
+// Convert converts an amount into another currency, rounding to the target
+// currency's minor unit.
+func (s *exchangeRateService) Convert(ctx context.Context, amount money.Money, to string) (money.Money, *models.ExchangeRate, error) {
+	if amount.Currency == "" {
+		return money.Money{}, nil, fmt.Errorf("amount to convert has no currency")
+	}
+
+	rate, err := s.GetRate(ctx, amount.Currency, to)
+	if err != nil {
+		return money.Money{}, nil, err
+	}
+	return rate.Convert(amount), rate, nil
+}
+
+// Snapshots
+
+// SnapshotPayment records the rate from the payment's currency into the
+// reporting currency. It is taken once, when the payment is charged; refunds
+// and reports reuse it.
+func (s *exchangeRateService) SnapshotPayment(ctx context.Context, payment *models.Payment) error {
+	if payment.ExchangeRate != nil {
+		return nil
+	}
+
+	amount := payment.Amount
+	if amount.Currency == "" {
+		amount.Currency = defaultCurrency(payment.Currency)
+	}
+
+	reportingAmount, rate, err := s.Convert(ctx, amount, s.config.ReportingCurrency)
+	if err != nil {
+		return err
+	}
+
+	payment.ExchangeRate = rate
+	payment.ReportingCurrency = rate.To
+	payment.ReportingAmount = reportingAmount
+	return nil
+}
+
+// SnapshotEntry records the rate from a ledger entry's currency into the
+// reporting currency. The ledger applies it to each transaction it posts for
+// the entry.
+func (s *exchangeRateService) SnapshotEntry(ctx context.Context, entry *models.LedgerEntry) error {
+	if entry.ExchangeRate != nil {
+		return nil
+	}
+
+	rate, err := s.GetRate(ctx, defaultCurrency(entry.Currency), s.config.ReportingCurrency)
+	if err != nil {
+		return err
+	}
+
+	entry.ExchangeRate = rate
+	return nil
+}
+
+// Reports
+
+// GetRevenueReport lists revenue per transaction currency together with its
+// value in the reporting currency. Snapshotted payments use their charge-time
+// rate; older payments without a snapshot are converted at today's rate and
+// flagged as such.
+func (s *exchangeRateService) GetRevenueReport(ctx context.Context, startDate, endDate time.Time) (map[string]interface{}, error) {
+	groups, err := s.paymentRepo.GetRevenueByCurrency(ctx, startDate, endDate)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get revenue by currency: %w", err)
+	}
+
+	reportingCurrency := strings.ToUpper(s.config.ReportingCurrency)
+	byCurrency := make(map[string]map[string]interface{})
+	var order []string
+	totalReporting, totalRefundReporting := money.Zero(reportingCurrency), money.Zero(reportingCurrency)
+
+	for _, group := range groups {
+		currency := defaultCurrency(stringValue(group["currency"]))
+		amount := moneyValue(group["amount"], currency)
+		refundAmount := moneyValue(group["refund_amount"], currency)
+		reportingAmount := moneyValue(group["reporting_amount"], reportingCurrency)
+		refundReportingAmount := moneyValue(group["refund_reporting_amount"], reportingCurrency)
+
+		estimated := false
+		if snapshotCurrency := stringValue(group["reporting_currency"]); snapshotCurrency != reportingCurrency {
+			rate, err := s.GetRate(ctx, currency, reportingCurrency)
+			if err != nil {
+				s.logger.WithError(err).WithField("currency", currency).Warn("Revenue left out of reporting currency total")
+				continue
+			}
+			reportingAmount = rate.Convert(amount)
+			refundReportingAmount = rate.Convert(refundAmount)
+			estimated = true
+		}
+
+		line, exists := byCurrency[currency]
+		if !exists {
+			line = map[string]interface{}{
+				"currency":                  currency,
+				"payments":                  int64(0),
+				"amount":                    money.Zero(currency),
+				"refund_amount":             money.Zero(currency),
+				"reporting_amount":          money.Zero(reportingCurrency),
+				"refund_reporting_amount":   money.Zero(reportingCurrency),
+				"converted_at_current_rate": false,
+			}
+			byCurrency[currency] = line
+			order = append(order, currency)
+		}
+
+		// Amounts within a line share a currency, so the sums cannot fail
+		payments, _ := group["payments"].(int64)
+		line["payments"] = line["payments"].(int64) + payments
+		line["amount"], _ = line["amount"].(money.Money).Add(amount)
+		line["refund_amount"], _ = line["refund_amount"].(money.Money).Add(refundAmount)
+		line["reporting_amount"], _ = line["reporting_amount"].(money.Money).Add(reportingAmount)
+		line["refund_reporting_amount"], _ = line["refund_reporting_amount"].(money.Money).Add(refundReportingAmount)
+		if estimated {
+			line["converted_at_current_rate"] = true
+		}
+
+		totalReporting, _ = totalReporting.Add(reportingAmount)
+		totalRefundReporting, _ = totalRefundReporting.Add(refundReportingAmount)
+	}
+
+	currencies := make([]map[string]interface{}, 0, len(order))
+	for _, currency := range order {
+		currencies = append(currencies, byCurrency[currency])
+	}
+
+	netReporting, _ := totalReporting.Sub(totalRefundReporting)
+
+	return map[string]interface{}{
+		"reporting_currency":     reportingCurrency,
+		"currencies":             currencies,
+		"total_reporting_amount": totalReporting,
+		"total_refund_reporting": totalRefundReporting,
+		"net_reporting_amount":   netReporting,
+		"start_date":             startDate,
+		"end_date":               endDate,
+	}, nil
+}
+
+// Helper methods
+
+// defaultCurrency returns the currency of records written before currencies
+// were always set.
+func defaultCurrency(currency string) string {
+	if currency == "" {
+		return "USD"
+	}
+	return strings.ToUpper(currency)
+}
+
+func stringValue(value interface{}) string {
+	text, _ := value.(string)
+	return text
+}
+
+// moneyValue reads an amount from a report group, defaulting to zero in the
+// given currency.
+func moneyValue(value interface{}, currency string) money.Money {
+	amount, ok := value.(money.Money)
+	if !ok || amount.Currency == "" {
+		return money.New(amount.Amount, currency)
+	}
+	return amount
+}
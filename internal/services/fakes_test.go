@@ -0,0 +1,556 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"goride/internal/models"
+	"goride/internal/repositories/interfaces"
+	"goride/pkg/logger"
+	"goride/pkg/money"
+	"goride/pkg/payment"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// In-memory stand-ins for the repositories and services the payment flows
+// use. Each embeds the interface it fakes, so calling a method a test did not
+// expect panics instead of passing silently.
+
+func newTestLogger(t *testing.T) *logger.Logger {
+	t.Helper()
+	log, err := logger.NewLogger(&logger.Config{Level: "panic", Output: "stderr"})
+	if err != nil {
+		t.Fatalf("failed to create logger: %v", err)
+	}
+	return log
+}
+
+// applyUpdates sets fields on a stored document by their bson names, the way
+// a $set would.
+func applyUpdates(doc interface{}, updates map[string]interface{}) error {
+	data, err := bson.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	fields := bson.M{}
+	if err := bson.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	for key, value := range updates {
+		fields[key] = value
+	}
+	if data, err = bson.Marshal(fields); err != nil {
+		return err
+	}
+	return bson.Unmarshal(data, doc)
+}
+
+type fakeCache struct {
+	CacheService
+	mu     sync.Mutex
+	locked map[string]bool
+}
+
+func newFakeCache() *fakeCache {
+	return &fakeCache{locked: make(map[string]bool)}
+}
+
+func (c *fakeCache) Lock(ctx context.Context, key string, expiration time.Duration) (*DistributedLock, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.locked[key] {
+		return nil, fmt.Errorf("lock %s is held", key)
+	}
+	c.locked[key] = true
+	return &DistributedLock{Key: key, Expiration: expiration, CreatedAt: time.Now()}, nil
+}
+
+func (c *fakeCache) Unlock(ctx context.Context, lock *DistributedLock) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.locked, lock.Key)
+	return nil
+}
+
+type fakePaymentRepo struct {
+	interfaces.PaymentRepository
+	payments map[primitive.ObjectID]*models.Payment
+	order    []primitive.ObjectID
+}
+
+func newFakePaymentRepo() *fakePaymentRepo {
+	return &fakePaymentRepo{payments: make(map[primitive.ObjectID]*models.Payment)}
+}
+
+func (r *fakePaymentRepo) Create(ctx context.Context, p *models.Payment) error {
+	if p.IdempotencyKey != "" {
+		if _, err := r.GetByIdempotencyKey(ctx, p.IdempotencyKey); err == nil {
+			return fmt.Errorf("duplicate idempotency key %s", p.IdempotencyKey)
+		}
+	}
+	p.ID = primitive.NewObjectID()
+	p.CreatedAt = time.Now()
+	stored := *p
+	r.payments[p.ID] = &stored
+	r.order = append(r.order, p.ID)
+	return nil
+}
+
+func (r *fakePaymentRepo) CreateAttempt(ctx context.Context, p *models.Payment) error {
+	attempts := 0
+	for _, stored := range r.payments {
+		if strings.HasPrefix(stored.IdempotencyKey, p.IdempotencyPrefix()) {
+			attempts++
+		}
+	}
+	p.SetAttempt(attempts + 1)
+	return r.Create(ctx, p)
+}
+
+func (r *fakePaymentRepo) GetByID(ctx context.Context, id primitive.ObjectID) (*models.Payment, error) {
+	stored, ok := r.payments[id]
+	if !ok {
+		return nil, fmt.Errorf("payment not found")
+	}
+	p := *stored
+	return &p, nil
+}
+
+func (r *fakePaymentRepo) GetByIdempotencyKey(ctx context.Context, key string) (*models.Payment, error) {
+	for _, stored := range r.payments {
+		if stored.IdempotencyKey == key {
+			p := *stored
+			return &p, nil
+		}
+	}
+	return nil, fmt.Errorf("payment not found")
+}
+
+func (r *fakePaymentRepo) GetByTransactionID(ctx context.Context, transactionID string) (*models.Payment, error) {
+	for _, stored := range r.payments {
+		if stored.TransactionID == transactionID {
+			p := *stored
+			return &p, nil
+		}
+	}
+	return nil, fmt.Errorf("payment not found with transaction ID")
+}
+
+func (r *fakePaymentRepo) GetByRideID(ctx context.Context, rideID primitive.ObjectID) ([]*models.Payment, error) {
+	var payments []*models.Payment
+	for _, id := range r.order {
+		if stored := r.payments[id]; stored.RideID == rideID {
+			p := *stored
+			payments = append(payments, &p)
+		}
+	}
+	return payments, nil
+}
+
+func (r *fakePaymentRepo) GetAuthorizedPayments(ctx context.Context, authorizedBefore time.Time, limit int) ([]*models.Payment, error) {
+	var payments []*models.Payment
+	for _, id := range r.order {
+		stored := r.payments[id]
+		if stored.Status == models.PaymentStatusAuthorized && stored.AuthorizedAt != nil && stored.AuthorizedAt.Before(authorizedBefore) {
+			p := *stored
+			payments = append(payments, &p)
+		}
+	}
+	return payments, nil
+}
+
+func (r *fakePaymentRepo) Update(ctx context.Context, id primitive.ObjectID, updates map[string]interface{}) error {
+	stored, ok := r.payments[id]
+	if !ok {
+		return fmt.Errorf("payment not found")
+	}
+	return applyUpdates(stored, updates)
+}
+
+func (r *fakePaymentRepo) UpdateStatus(ctx context.Context, id primitive.ObjectID, status models.PaymentStatus) error {
+	return r.Update(ctx, id, map[string]interface{}{"status": status})
+}
+
+func (r *fakePaymentRepo) ProcessRefund(ctx context.Context, id primitive.ObjectID, refundAmount money.Money, reason string) error {
+	return r.Update(ctx, id, map[string]interface{}{
+		"status":        models.PaymentStatusRefunded,
+		"refund_amount": refundAmount,
+	})
+}
+
+// byPayer lists the stored payments of a payer in the order they were made.
+func (r *fakePaymentRepo) byPayer(payerID primitive.ObjectID) []*models.Payment {
+	var payments []*models.Payment
+	for _, id := range r.order {
+		if r.payments[id].PayerID == payerID {
+			payments = append(payments, r.payments[id])
+		}
+	}
+	return payments
+}
+
+// fakeProvider answers charges by payment method. A method without an answer
+// is charged successfully. Lookups of lost answers are answered by lookup.
+// Holds are authorized in full and captured with captureStatus; they are
+// raised only when raises is set. When closed is set, captures are refused as
+// already closed and lookups of the hold report it in that status.
+type fakeProvider struct {
+	payment.PaymentProvider
+	answers       map[string]func() (*payment.PaymentResponse, error)
+	requests      []*payment.PaymentRequest
+	lookup        func() (*payment.PaymentResponse, error)
+	authorized    []*payment.PaymentRequest
+	captures      []*payment.CaptureRequest
+	voided        []string
+	captureStatus string
+	raises        bool
+	closed        string
+}
+
+func newFakeProvider() *fakeProvider {
+	return &fakeProvider{
+		answers:       make(map[string]func() (*payment.PaymentResponse, error)),
+		captureStatus: "succeeded",
+	}
+}
+
+func (p *fakeProvider) Authorize(ctx context.Context, request *payment.PaymentRequest) (*payment.AuthorizationResponse, error) {
+	p.authorized = append(p.authorized, request)
+	return &payment.AuthorizationResponse{
+		AuthorizationID: fmt.Sprintf("auth_%d", len(p.authorized)),
+		Status:          payment.AuthorizationStatusAuthorized,
+		Amount:          request.Amount,
+	}, nil
+}
+
+func (p *fakeProvider) IncrementAuthorization(ctx context.Context, request *payment.IncrementAuthorizationRequest) (*payment.AuthorizationResponse, error) {
+	if !p.raises {
+		return nil, payment.ErrIncrementNotSupported
+	}
+	return &payment.AuthorizationResponse{
+		AuthorizationID: request.AuthorizationID,
+		Status:          payment.AuthorizationStatusAuthorized,
+		Amount:          request.Amount,
+	}, nil
+}
+
+func (p *fakeProvider) Capture(ctx context.Context, request *payment.CaptureRequest) (*payment.PaymentResponse, error) {
+	p.captures = append(p.captures, request)
+	if p.closed != "" {
+		return nil, fmt.Errorf("capture refused: %w", payment.ErrAuthorizationClosed)
+	}
+	return &payment.PaymentResponse{
+		TransactionID: "txn_" + request.AuthorizationID,
+		Status:        p.captureStatus,
+		Amount:        request.Amount,
+	}, nil
+}
+
+func (p *fakeProvider) Void(ctx context.Context, authorizationID string) (*payment.AuthorizationResponse, error) {
+	p.voided = append(p.voided, authorizationID)
+	return &payment.AuthorizationResponse{AuthorizationID: authorizationID, Status: payment.AuthorizationStatusVoided}, nil
+}
+
+func (p *fakeProvider) ProcessPayment(ctx context.Context, request *payment.PaymentRequest) (*payment.PaymentResponse, error) {
+	p.requests = append(p.requests, request)
+	if answer, ok := p.answers[request.PaymentMethodID]; ok {
+		return answer()
+	}
+	return &payment.PaymentResponse{
+		TransactionID: "txn_" + request.IdempotencyKey,
+		Status:        "succeeded",
+		Amount:        request.Amount,
+	}, nil
+}
+
+func (p *fakeProvider) GetPayment(ctx context.Context, request *payment.PaymentLookupRequest) (*payment.PaymentResponse, error) {
+	if request.AuthorizationID != "" {
+		return &payment.PaymentResponse{TransactionID: "txn_" + request.AuthorizationID, Status: p.closed}, nil
+	}
+	return p.lookup()
+}
+
+// ValidateWebhook accepts payloads signed "valid" and parses them as
+// ParseWebhook does.
+func (p *fakeProvider) ValidateWebhook(ctx context.Context, payload []byte, header http.Header) (*payment.WebhookEvent, error) {
+	if header.Get("Signature") != "valid" {
+		return nil, fmt.Errorf("signature does not match")
+	}
+	return p.ParseWebhook(payload)
+}
+
+// ParseWebhook reads a payload written as a JSON payment.WebhookEvent.
+func (p *fakeProvider) ParseWebhook(payload []byte) (*payment.WebhookEvent, error) {
+	var event payment.WebhookEvent
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return nil, err
+	}
+	return &event, nil
+}
+
+func declined() (*payment.PaymentResponse, error) {
+	return &payment.PaymentResponse{TransactionID: "txn_declined", Status: "declined"}, nil
+}
+
+func unanswered() (*payment.PaymentResponse, error) {
+	return nil, &payment.ProviderError{Provider: "test", StatusCode: 503, Body: "unavailable"}
+}
+
+type fakeExchange struct {
+	ExchangeRateService
+}
+
+func (fakeExchange) SnapshotPayment(ctx context.Context, p *models.Payment) error {
+	return nil
+}
+
+// SnapshotEntry reports entries without a rate at a fixed rate into EUR.
+func (fakeExchange) SnapshotEntry(ctx context.Context, entry *models.LedgerEntry) error {
+	if entry.ExchangeRate == nil {
+		entry.ExchangeRate = &models.ExchangeRate{From: entry.Currency, To: "EUR", Rate: 0.9, Source: "today"}
+	}
+	return nil
+}
+
+type fakeWallet struct {
+	WalletService
+	recorded []primitive.ObjectID
+	refunds  []string // references
+}
+
+func (w *fakeWallet) RecordPayment(ctx context.Context, p *models.Payment) (*models.LedgerEntry, error) {
+	if p.Status != models.PaymentStatusCompleted {
+		return nil, fmt.Errorf("payment is not completed")
+	}
+	for _, id := range w.recorded {
+		if id == p.ID {
+			return nil, fmt.Errorf("payment already recorded")
+		}
+	}
+	w.recorded = append(w.recorded, p.ID)
+	return &models.LedgerEntry{PaymentID: &p.ID}, nil
+}
+
+func (w *fakeWallet) RecordRefund(ctx context.Context, p *models.Payment, amount money.Money, reference string) (*models.LedgerEntry, error) {
+	for _, recorded := range w.refunds {
+		if recorded == reference {
+			return nil, fmt.Errorf("refund already recorded")
+		}
+	}
+	w.refunds = append(w.refunds, reference)
+	return &models.LedgerEntry{PaymentID: &p.ID, Reference: "refund:" + reference}, nil
+}
+
+type fakeRideRepo struct {
+	interfaces.RideRepository
+	rides map[primitive.ObjectID]*models.Ride
+}
+
+func (r *fakeRideRepo) GetByID(ctx context.Context, id primitive.ObjectID) (*models.Ride, error) {
+	stored, ok := r.rides[id]
+	if !ok {
+		return nil, fmt.Errorf("ride not found")
+	}
+	ride := *stored
+	return &ride, nil
+}
+
+func (r *fakeRideRepo) Update(ctx context.Context, id primitive.ObjectID, updates map[string]interface{}) error {
+	stored, ok := r.rides[id]
+	if !ok {
+		return fmt.Errorf("ride not found")
+	}
+	return applyUpdates(stored, updates)
+}
+
+func (r *fakeRideRepo) CancelRide(ctx context.Context, id primitive.ObjectID, reason, cancelledBy string) error {
+	return r.Update(ctx, id, map[string]interface{}{
+		"status":              models.RideStatusCancelled,
+		"cancellation_reason": reason,
+		"cancelled_by":        cancelledBy,
+		"cancelled_at":        time.Now(),
+	})
+}
+
+func (r *fakeRideRepo) AddHistoryEntry(ctx context.Context, id primitive.ObjectID, entry *models.RideHistoryEntry) error {
+	stored, ok := r.rides[id]
+	if !ok {
+		return fmt.Errorf("ride not found")
+	}
+	stored.History = append(stored.History, *entry)
+	return nil
+}
+
+type fakeDriverRepo struct {
+	interfaces.DriverRepository
+	drivers map[primitive.ObjectID]*models.Driver
+}
+
+func (r *fakeDriverRepo) GetByID(ctx context.Context, id primitive.ObjectID) (*models.Driver, error) {
+	stored, ok := r.drivers[id]
+	if !ok {
+		return nil, fmt.Errorf("driver not found")
+	}
+	driver := *stored
+	return &driver, nil
+}
+
+func (r *fakeDriverRepo) Update(ctx context.Context, id primitive.ObjectID, updates map[string]interface{}) error {
+	stored, ok := r.drivers[id]
+	if !ok {
+		return fmt.Errorf("driver not found")
+	}
+	return applyUpdates(stored, updates)
+}
+
+type fakeRiderRepo struct {
+	interfaces.RiderRepository
+	riders map[primitive.ObjectID]*models.Rider // by user ID
+}
+
+func (r *fakeRiderRepo) GetByUserID(ctx context.Context, userID primitive.ObjectID) (*models.Rider, error) {
+	rider, ok := r.riders[userID]
+	if !ok {
+		return nil, fmt.Errorf("rider not found")
+	}
+	return rider, nil
+}
+
+// fakeFareSplits settles every split with the same result.
+type fakeFareSplits struct {
+	FareSplitService
+	status  models.FareSplitStatus
+	err     error
+	settled int
+}
+
+func (s *fakeFareSplits) SettleSplit(ctx context.Context, rideID primitive.ObjectID) (*models.FareSplit, error) {
+	s.settled++
+	if s.err != nil {
+		return nil, s.err
+	}
+	return &models.FareSplit{RideID: rideID, Status: s.status}, nil
+}
+
+type fakeRidePasses struct {
+	RidePassService
+	settled []primitive.ObjectID
+}
+
+func (s *fakeRidePasses) SettlePayment(ctx context.Context, p *models.Payment) error {
+	s.settled = append(s.settled, p.ID)
+	return nil
+}
+
+type fakeFareSplitRepo struct {
+	interfaces.FareSplitRepository
+	splits map[primitive.ObjectID]*models.FareSplit // by ride ID
+}
+
+func (r *fakeFareSplitRepo) GetByRideID(ctx context.Context, rideID primitive.ObjectID) (*models.FareSplit, error) {
+	stored, ok := r.splits[rideID]
+	if !ok {
+		return nil, fmt.Errorf("fare split not found")
+	}
+	split := *stored
+	split.Participants = append([]models.FareSplitParticipant(nil), stored.Participants...)
+	return &split, nil
+}
+
+func (r *fakeFareSplitRepo) Update(ctx context.Context, id primitive.ObjectID, updates map[string]interface{}) error {
+	for _, stored := range r.splits {
+		if stored.ID == id {
+			return applyUpdates(stored, updates)
+		}
+	}
+	return fmt.Errorf("fare split not found")
+}
+
+// fakeLedgerRepo keeps the postings of each entry by its reference.
+type fakeLedgerRepo struct {
+	interfaces.LedgerRepository
+	entries  map[string]*models.LedgerEntry
+	postings map[string][]models.LedgerPosting
+}
+
+func newFakeLedgerRepo() *fakeLedgerRepo {
+	return &fakeLedgerRepo{
+		entries:  make(map[string]*models.LedgerEntry),
+		postings: make(map[string][]models.LedgerPosting),
+	}
+}
+
+func (r *fakeLedgerRepo) PostEntry(ctx context.Context, entry *models.LedgerEntry, postings []models.LedgerPosting) ([]*models.Transaction, error) {
+	if _, ok := r.entries[entry.Reference]; ok {
+		return nil, fmt.Errorf("duplicate ledger reference %s", entry.Reference)
+	}
+	entry.ID = primitive.NewObjectID()
+	entry.CreatedAt = time.Now()
+	r.entries[entry.Reference] = entry
+	r.postings[entry.Reference] = postings
+	return nil, nil
+}
+
+func (r *fakeLedgerRepo) GetEntryByReference(ctx context.Context, reference string) (*models.LedgerEntry, error) {
+	entry, ok := r.entries[reference]
+	if !ok {
+		return nil, fmt.Errorf("ledger entry not found")
+	}
+	return entry, nil
+}
+
+// fakeWebhookRepo stores one event per provider and event ID, as the unique
+// index does.
+type fakeWebhookRepo struct {
+	interfaces.PaymentWebhookRepository
+	events []*models.PaymentWebhookEvent
+}
+
+func (r *fakeWebhookRepo) CreateEvent(ctx context.Context, event *models.PaymentWebhookEvent) (bool, error) {
+	if _, err := r.GetEventByEventID(ctx, event.Provider, event.EventID); err == nil {
+		return false, nil
+	}
+	event.ID = primitive.NewObjectID()
+	event.CreatedAt = time.Now()
+	stored := *event
+	r.events = append(r.events, &stored)
+	return true, nil
+}
+
+func (r *fakeWebhookRepo) GetEventByEventID(ctx context.Context, provider, eventID string) (*models.PaymentWebhookEvent, error) {
+	for _, stored := range r.events {
+		if stored.Provider == provider && stored.EventID == eventID {
+			event := *stored
+			return &event, nil
+		}
+	}
+	return nil, fmt.Errorf("payment webhook event not found")
+}
+
+func (r *fakeWebhookRepo) UpdateEvent(ctx context.Context, id primitive.ObjectID, updates map[string]interface{}) error {
+	for _, stored := range r.events {
+		if stored.ID == id {
+			return applyUpdates(stored, updates)
+		}
+	}
+	return fmt.Errorf("payment webhook event not found")
+}
+
+func (r *fakeWebhookRepo) GetDueEvents(ctx context.Context, before time.Time, limit int) ([]*models.PaymentWebhookEvent, error) {
+	var events []*models.PaymentWebhookEvent
+	for _, stored := range r.events {
+		if stored.Status == models.PaymentWebhookStatusPending && !stored.NextAttemptAt.After(before) {
+			event := *stored
+			events = append(events, &event)
+		}
+	}
+	return events, nil
+}
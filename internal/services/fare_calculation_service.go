@@ -0,0 +1,864 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"goride/internal/config"
+	"goride/internal/models"
+	"goride/internal/repositories/interfaces"
+	"goride/internal/utils"
+	"goride/pkg/logger"
+	"goride/pkg/money"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type FareCalculationService interface {
+	// Fare Calculation
+	CalculateFare(ctx context.Context, request *FareCalculationRequest) (*models.FareBreakdown, error)
+	CalculateRideFare(ctx context.Context, ride *models.Ride, distanceKM float64, durationMinutes int, route FareRoute) (*models.FareBreakdown, error)
+
+	// Fare Structures
+	GetFareStructure(ctx context.Context, city string, rideType models.RideType, at time.Time) (*models.FareStructure, error)
+	CreateFareStructure(ctx context.Context, fareStructure *models.FareStructure) (*models.FareStructure, error)
+	ExpireFareStructure(ctx context.Context, id primitive.ObjectID, at time.Time) error
+	ListFareStructures(ctx context.Context, city string, params *utils.PaginationParams) ([]*models.FareStructure, int64, error)
+
+	// Surcharge Rules
+	CreateSurchargeRule(ctx context.Context, adminID primitive.ObjectID, rule *models.SurchargeRule) (*models.SurchargeRule, error)
+	ExpireSurchargeRule(ctx context.Context, id primitive.ObjectID, at time.Time) error
+	ListSurchargeRules(ctx context.Context, city string, params *utils.PaginationParams) ([]*models.SurchargeRule, int64, error)
+}
+
+// FareRoute selects the route a booked ride is checked against for tolls and
+// congestion zones.
+type FareRoute string
+
+const (
+	FareRoutePlanned FareRoute = "planned" // the ride's routed polyline
+	FareRouteActual  FareRoute = "actual"  // the driver's tracked locations
+)
+
+// FareCalculationRequest describes a trip to price. The fare structure in
+// effect at RequestedAt is used unless FareStructureID pins a specific one, as
+// it does for trips priced from a locked quote. A pricing experiment arm's
+// overrides are applied on top of the structure.
+type FareCalculationRequest struct {
+	City            string                              `json:"city" validate:"required"`
+	RideType        models.RideType                     `json:"ride_type" validate:"required"`
+	RequestedAt     time.Time                           `json:"requested_at"`
+	FareStructureID primitive.ObjectID                  `json:"fare_structure_id"`
+	Distance        float64                             `json:"distance"` // kilometers
+	Duration        int                                 `json:"duration"` // minutes
+	SurgeMultiplier float64                             `json:"surge_multiplier"`
+	WaitingTime     int                                 `json:"waiting_time"` // billable minutes, after the free window
+	TollAmount      money.Money                         `json:"toll_amount"`
+	PromoCode       string                              `json:"promo_code"`
+	RiderID         primitive.ObjectID                  `json:"rider_id"` // user ID the promotion is validated for
+	PickupLocation  *models.Location                    `json:"pickup_location"`
+	DropoffLocation *models.Location                    `json:"dropoff_location"`
+	Path            []utils.Point                       `json:"path"` // route followed, checked against toll and congestion geofences
+	Experiment      *models.PricingExperimentAssignment `json:"experiment"`
+}
+
+type fareCalculationService struct {
+	fareStructureRepo interfaces.FareStructureRepository
+	surchargeRepo     interfaces.SurchargeRuleRepository
+	geofenceRepo      interfaces.GeofenceRepository
+	locationRepo      interfaces.LocationRepository
+	promotionRepo     interfaces.PromotionRepository
+	taxService        TaxService
+	ridePassService   RidePassService
+	config            *config.PricingConfig
+	logger            *logger.Logger
+}
+
+func NewFareCalculationService(
+	fareStructureRepo interfaces.FareStructureRepository,
+	surchargeRepo interfaces.SurchargeRuleRepository,
+	geofenceRepo interfaces.GeofenceRepository,
+	locationRepo interfaces.LocationRepository,
+	promotionRepo interfaces.PromotionRepository,
+	taxService TaxService,
+	ridePassService RidePassService,
+	config *config.PricingConfig,
+	logger *logger.Logger,
+) FareCalculationService {
+	return &fareCalculationService{
+		fareStructureRepo: fareStructureRepo,
+		surchargeRepo:     surchargeRepo,
+		geofenceRepo:      geofenceRepo,
+		locationRepo:      locationRepo,
+		promotionRepo:     promotionRepo,
+		taxService:        taxService,
+		ridePassService:   ridePassService,
+		config:            config,
+		logger:            logger,
+	}
+}
+
+// Fare Calculation
+
+// CalculateFare prices a trip in a fixed order: metered fare, surge, booking
+// fee, minimum and maximum fare, waiting, tolls, geofence surcharges, ride
+// pass, promotion and finally tax. A fixed route replaces the metered fare,
+// surge, booking fee and fare limits with its flat fare. The driver earns the
+// commissioned share of the trip fare plus tolls; the platform keeps the
+// commission, the booking fee and the airport and congestion surcharges it
+// remits. Tax contained in a line under inclusive pricing is remitted, so it is
+// taken out of the share of whoever that line goes to.
+func (s *fareCalculationService) CalculateFare(ctx context.Context, request *FareCalculationRequest) (*models.FareBreakdown, error) {
+	if request.Distance < 0 || request.Duration < 0 || request.WaitingTime < 0 || request.TollAmount.IsNegative() {
+		return nil, fmt.Errorf("distance, duration, waiting time and tolls cannot be negative")
+	}
+
+	fareStructure, err := s.resolveFareStructure(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+
+	// Every amount is in the fare structure's currency; add keeps the first
+	// mismatch so it can be reported once the fare is totalled
+	currency := fareStructure.Currency
+	zero := money.Zero(currency)
+	var sumErr error
+	add := func(amounts ...money.Money) money.Money {
+		total, err := money.Sum(append([]money.Money{zero}, amounts...)...)
+		if err != nil && sumErr == nil {
+			sumErr = err
+		}
+		return total
+	}
+
+	// Per-unit rates can be finer than the minor unit, so each metered line is
+	// rounded once from its exact product
+	metered := func(rate float64, units float64) money.Money {
+		return money.FromMajor(rate*units, currency)
+	}
+
+	surge := request.SurgeMultiplier
+	if surge < 1 {
+		surge = 1
+	}
+
+	breakdown := &models.FareBreakdown{
+		FareStructureID: fareStructure.ID,
+		City:            fareStructure.City,
+		RideType:        fareStructure.RideType,
+		Currency:        currency,
+		Distance:        request.Distance,
+		Duration:        request.Duration,
+		BaseFare:        zero,
+		DistanceFare:    zero,
+		TimeFare:        zero,
+		BookingFee:      zero,
+		SurgeMultiplier: surge,
+		SurgeAmount:     zero,
+		FareAdjustment:  zero,
+		FixedFare:       zero,
+		WaitingTime:     request.WaitingTime,
+		WaitingCharge:   metered(fareStructure.WaitingTimeRate, float64(request.WaitingTime)),
+		TollAmount:      add(request.TollAmount),
+		SurchargeAmount: zero,
+		DiscountAmount:  zero,
+		PassDiscount:    zero,
+		CalculatedAt:    time.Now(),
+	}
+
+	pass := s.activeRidePass(ctx, request)
+
+	fixedRoute, surcharges := s.matchSurcharges(ctx, request, fareStructure.City, currency)
+
+	var tripFare money.Money
+	if fixedRoute != nil {
+		breakdown.SurgeMultiplier = 1
+		breakdown.FixedFare = add(fixedRoute.Amount)
+		breakdown.FixedFareRuleID = &fixedRoute.ID
+		tripFare = breakdown.FixedFare
+	} else {
+		breakdown.BaseFare = add(fareStructure.BaseFare)
+		breakdown.DistanceFare = metered(fareStructure.PricePerKM, request.Distance)
+		breakdown.TimeFare = metered(fareStructure.PricePerMinute, float64(request.Duration))
+		breakdown.BookingFee = add(fareStructure.BookingFee)
+
+		meteredFare := add(breakdown.BaseFare, breakdown.DistanceFare, breakdown.TimeFare)
+		breakdown.SurgeAmount = meteredFare.Multiply(surge - 1)
+
+		// The fare limits apply to what the rider pays, so a pass's surge cap
+		// and booking fee waiver save the difference between the trip fare
+		// and the fare repriced with them, each within the limits
+		withinLimits := func(fare money.Money) money.Money {
+			adjustment := zero
+			if below := add(fareStructure.MinimumFare, fare.Neg()); below.IsPositive() {
+				adjustment = below
+			}
+			if fareStructure.MaximumFare.IsPositive() {
+				if above := add(fare, fareStructure.MaximumFare.Neg()); above.IsPositive() {
+					adjustment = above.Neg()
+				}
+			}
+			return adjustment
+		}
+
+		tripFare = add(meteredFare, breakdown.SurgeAmount, breakdown.BookingFee)
+		breakdown.FareAdjustment = withinLimits(tripFare)
+		tripFare = add(tripFare, breakdown.FareAdjustment)
+
+		if pass != nil {
+			passSurge := surge
+			if surgeCap := pass.Benefits.SurgeCap; surgeCap >= 1 && surgeCap < passSurge {
+				passSurge = surgeCap
+			}
+			passFare := add(meteredFare, meteredFare.Multiply(passSurge-1))
+			if !pass.Benefits.WaiveBookingFee {
+				passFare = add(passFare, breakdown.BookingFee)
+			}
+			passFare = add(passFare, withinLimits(passFare))
+			if saved := add(tripFare, passFare.Neg()); saved.IsPositive() {
+				breakdown.PassDiscount = saved
+			}
+		}
+	}
+	tripFare = add(tripFare, breakdown.WaitingCharge)
+
+	// Tolls pass through to the driver, who pays them on the road; other
+	// surcharges are collected and remitted by the platform
+	tollSurcharges, remittedSurcharges := zero, zero
+	for _, surcharge := range surcharges {
+		breakdown.Surcharges = append(breakdown.Surcharges, surcharge)
+		breakdown.SurchargeAmount = add(breakdown.SurchargeAmount, surcharge.Amount)
+		if surcharge.Type == models.SurchargeTypeToll {
+			tollSurcharges = add(tollSurcharges, surcharge.Amount)
+		} else {
+			remittedSurcharges = add(remittedSurcharges, surcharge.Amount)
+		}
+	}
+
+	breakdown.Subtotal = add(tripFare, breakdown.TollAmount, breakdown.SurchargeAmount)
+
+	if pass != nil {
+		breakdown.PassDiscount = add(breakdown.PassDiscount, s.calculatePassDiscount(request, pass,
+			add(tripFare, breakdown.WaitingCharge.Neg(), breakdown.PassDiscount.Neg())))
+		breakdown.RidePassID = &pass.ID
+	}
+
+	// A promotion discounts what is left after the pass
+	if request.PromoCode != "" {
+		breakdown.DiscountAmount = s.calculateDiscount(ctx, request, add(breakdown.Subtotal, breakdown.PassDiscount.Neg()))
+		if breakdown.DiscountAmount.IsPositive() {
+			breakdown.PromoCode = strings.ToUpper(request.PromoCode)
+		}
+	}
+
+	// Charging a fare without its tax would leave it unremitted, so a failed
+	// lookup fails the fare rather than pricing it tax free
+	rideFare := add(tripFare, breakdown.BookingFee.Neg(), breakdown.WaitingCharge.Neg())
+	tolls := add(breakdown.TollAmount, tollSurcharges)
+	taxes, err := s.taxService.CalculateTax(ctx, s.taxRequest(request, currency, map[models.TaxComponent]money.Money{
+		models.TaxComponentRide:       rideFare,
+		models.TaxComponentBookingFee: breakdown.BookingFee,
+		models.TaxComponentWaiting:    breakdown.WaitingCharge,
+		models.TaxComponentToll:       tolls,
+		models.TaxComponentSurcharge:  remittedSurcharges,
+	}, add(breakdown.DiscountAmount, breakdown.PassDiscount)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to calculate tax: %w", err)
+	}
+	included := func(component models.TaxComponent) money.Money {
+		return add(taxes.InclusiveByComponent[component]).Neg()
+	}
+
+	breakdown.TaxRate = taxes.RateOn(models.TaxComponentRide)
+	breakdown.TaxLines = taxes.Lines
+	breakdown.TaxIncluded = add(taxes.Inclusive)
+	breakdown.TaxAmount = add(taxes.Inclusive, taxes.Exclusive)
+	breakdown.Total = add(breakdown.Subtotal, breakdown.DiscountAmount.Neg(), breakdown.PassDiscount.Neg(), taxes.Exclusive)
+
+	// Discounts and pass benefits are funded by the platform, so driver
+	// earnings are based on the undiscounted fare
+	driverFare := add(rideFare, breakdown.WaitingCharge, included(models.TaxComponentRide), included(models.TaxComponentWaiting))
+	commission := driverFare.Percent(s.config.PlatformCommission)
+	breakdown.PlatformFee = add(commission, breakdown.BookingFee, included(models.TaxComponentBookingFee),
+		remittedSurcharges, included(models.TaxComponentSurcharge))
+	breakdown.DriverEarnings = add(driverFare, commission.Neg(), tolls, included(models.TaxComponentToll))
+
+	if sumErr != nil {
+		return nil, fmt.Errorf("failed to total fare in %s: %w", currency, sumErr)
+	}
+
+	return breakdown, nil
+}
+
+// CalculateRideFare prices a booked ride over the given distance and duration.
+// Rides with a locked quote keep the quote's fare structure; other rides use
+// the structure in effect when they were requested. Surcharges are matched
+// against the ride's pickup and dropoff and the chosen route.
+func (s *fareCalculationService) CalculateRideFare(ctx context.Context, ride *models.Ride, distanceKM float64, durationMinutes int, route FareRoute) (*models.FareBreakdown, error) {
+	pickup, dropoff := ride.PickupLocation, ride.DropoffLocation
+	request := &FareCalculationRequest{
+		City:            ride.PickupLocation.City,
+		RideType:        ride.RideType,
+		RequestedAt:     ride.RequestedAt,
+		Distance:        distanceKM,
+		Duration:        durationMinutes,
+		SurgeMultiplier: ride.SurgeMultiplier,
+		WaitingTime:     ride.WaitingTime,
+		PromoCode:       ride.PromoCode,
+		RiderID:         ride.RiderID,
+		PickupLocation:  &pickup,
+		DropoffLocation: &dropoff,
+		Path:            s.ridePath(ctx, ride, route),
+		Experiment:      ride.Experiment,
+	}
+	if ride.FareQuote != nil {
+		request.FareStructureID = ride.FareQuote.FareStructureID
+		request.SurgeMultiplier = ride.FareQuote.SurgeMultiplier
+	}
+
+	return s.CalculateFare(ctx, request)
+}
+
+// Fare Structures
+func (s *fareCalculationService) GetFareStructure(ctx context.Context, city string, rideType models.RideType, at time.Time) (*models.FareStructure, error) {
+	fareStructure, err := s.fareStructureRepo.GetActive(ctx, city, rideType, at)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get fare structure: %w", err)
+	}
+	return fareStructure, nil
+}
+
+// CreateFareStructure adds a fare structure for a city and ride type. Any
+// open-ended structure it supersedes is closed off at the new EffectiveFrom so
+// that exactly one structure applies at any moment.
+func (s *fareCalculationService) CreateFareStructure(ctx context.Context, fareStructure *models.FareStructure) (*models.FareStructure, error) {
+	if fareStructure.Currency == "" {
+		fareStructure.Currency = "USD"
+	}
+	fareStructure.Currency = strings.ToUpper(fareStructure.Currency)
+
+	if err := validateFareStructure(fareStructure); err != nil {
+		return nil, err
+	}
+
+	// Zero amounts sent without a currency take the structure's
+	for _, amount := range fareStructureAmounts(fareStructure) {
+		if amount.Currency == "" {
+			*amount = money.Zero(fareStructure.Currency)
+		}
+	}
+
+	if fareStructure.EffectiveFrom.IsZero() {
+		fareStructure.EffectiveFrom = time.Now()
+	}
+	fareStructure.IsActive = true
+
+	current, err := s.fareStructureRepo.GetActive(ctx, fareStructure.City, fareStructure.RideType, fareStructure.EffectiveFrom)
+	if err == nil && current.EffectiveUntil == nil {
+		if err := s.fareStructureRepo.Update(ctx, current.ID, map[string]interface{}{
+			"effective_until": fareStructure.EffectiveFrom,
+		}); err != nil {
+			return nil, fmt.Errorf("failed to close previous fare structure: %w", err)
+		}
+	}
+
+	if err := s.fareStructureRepo.Create(ctx, fareStructure); err != nil {
+		return nil, fmt.Errorf("failed to create fare structure: %w", err)
+	}
+
+	s.logger.WithField("city", fareStructure.City).
+		WithField("ride_type", fareStructure.RideType).
+		WithField("effective_from", fareStructure.EffectiveFrom).
+		Info("Fare structure created")
+
+	return fareStructure, nil
+}
+
+// ExpireFareStructure ends a fare structure at the given time. Past trips keep
+// resolving to it, which keeps their receipts reproducible.
+func (s *fareCalculationService) ExpireFareStructure(ctx context.Context, id primitive.ObjectID, at time.Time) error {
+	fareStructure, err := s.fareStructureRepo.GetByID(ctx, id)
+	if err != nil {
+		return fmt.Errorf("failed to get fare structure: %w", err)
+	}
+
+	if at.Before(fareStructure.EffectiveFrom) {
+		return fmt.Errorf("fare structure cannot expire before it takes effect")
+	}
+
+	if err := s.fareStructureRepo.Update(ctx, id, map[string]interface{}{
+		"effective_until": at,
+	}); err != nil {
+		return fmt.Errorf("failed to expire fare structure: %w", err)
+	}
+
+	return nil
+}
+
+func (s *fareCalculationService) ListFareStructures(ctx context.Context, city string, params *utils.PaginationParams) ([]*models.FareStructure, int64, error) {
+	if city != "" {
+		return s.fareStructureRepo.GetByCity(ctx, city, params)
+	}
+	return s.fareStructureRepo.List(ctx, params)
+}
+
+// Surcharge Rules
+
+// CreateSurchargeRule adds a surcharge for a geofence. Rules take their city
+// from the geofence; changing a rule's amount is done by expiring it and
+// creating its replacement, so past trips keep resolving to the old one.
+func (s *fareCalculationService) CreateSurchargeRule(ctx context.Context, adminID primitive.ObjectID, rule *models.SurchargeRule) (*models.SurchargeRule, error) {
+	if err := validateSurchargeRule(rule); err != nil {
+		return nil, err
+	}
+
+	geofence, err := s.geofenceRepo.GetByID(ctx, rule.GeofenceID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get geofence: %w", err)
+	}
+	if rule.DestinationGeofenceID != nil {
+		if _, err := s.geofenceRepo.GetByID(ctx, *rule.DestinationGeofenceID); err != nil {
+			return nil, fmt.Errorf("failed to get destination geofence: %w", err)
+		}
+	}
+
+	if rule.EffectiveFrom.IsZero() {
+		rule.EffectiveFrom = time.Now()
+	}
+	rule.City = geofence.City
+	rule.IsActive = true
+	rule.CreatedBy = &adminID
+
+	if err := s.surchargeRepo.Create(ctx, rule); err != nil {
+		return nil, fmt.Errorf("failed to create surcharge rule: %w", err)
+	}
+
+	s.logger.WithUserID(adminID).
+		WithField("geofence_id", rule.GeofenceID.Hex()).
+		WithField("type", rule.Type).
+		WithField("amount", rule.Amount.String()).
+		WithField("currency", rule.Amount.Currency).
+		WithField("effective_from", rule.EffectiveFrom).
+		Info("Surcharge rule created")
+
+	return rule, nil
+}
+
+func (s *fareCalculationService) ExpireSurchargeRule(ctx context.Context, id primitive.ObjectID, at time.Time) error {
+	rule, err := s.surchargeRepo.GetByID(ctx, id)
+	if err != nil {
+		return fmt.Errorf("failed to get surcharge rule: %w", err)
+	}
+
+	if at.Before(rule.EffectiveFrom) {
+		return fmt.Errorf("surcharge rule cannot expire before it takes effect")
+	}
+
+	if err := s.surchargeRepo.Update(ctx, id, map[string]interface{}{
+		"effective_until": at,
+	}); err != nil {
+		return fmt.Errorf("failed to expire surcharge rule: %w", err)
+	}
+
+	return nil
+}
+
+func (s *fareCalculationService) ListSurchargeRules(ctx context.Context, city string, params *utils.PaginationParams) ([]*models.SurchargeRule, int64, error) {
+	return s.surchargeRepo.List(ctx, city, params)
+}
+
+// Helper methods
+
+func (s *fareCalculationService) resolveFareStructure(ctx context.Context, request *FareCalculationRequest) (*models.FareStructure, error) {
+	var fareStructure *models.FareStructure
+	if !request.FareStructureID.IsZero() {
+		pinned, err := s.fareStructureRepo.GetByID(ctx, request.FareStructureID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get fare structure: %w", err)
+		}
+		fareStructure = pinned
+	} else {
+		at := request.RequestedAt
+		if at.IsZero() {
+			at = time.Now()
+		}
+
+		current, err := s.GetFareStructure(ctx, request.City, request.RideType, at)
+		if err != nil {
+			return nil, err
+		}
+		fareStructure = current
+	}
+
+	if request.Experiment == nil || request.Experiment.Fare == nil {
+		return fareStructure, nil
+	}
+
+	// Pricing the arm's trip at the control's fare would skew the experiment,
+	// so an override that does not fit the structure fails the fare
+	for _, amount := range request.Experiment.Fare.Amounts() {
+		if !amount.SameCurrency(money.Zero(fareStructure.Currency)) {
+			return nil, fmt.Errorf("pricing experiment %s overrides fares in %s, not %s",
+				request.Experiment.Experiment, amount.Currency, fareStructure.Currency)
+		}
+	}
+	return request.Experiment.Fare.Apply(fareStructure), nil
+}
+
+// taxRequest describes a fare to the tax service. Taxes are those of the
+// pickup, in force when the trip was requested.
+func (s *fareCalculationService) taxRequest(request *FareCalculationRequest, currency string, components map[models.TaxComponent]money.Money, discount money.Money) *TaxRequest {
+	taxRequest := &TaxRequest{
+		City:       request.City,
+		Location:   request.PickupLocation,
+		At:         request.RequestedAt,
+		Currency:   currency,
+		Components: components,
+		Discount:   discount,
+	}
+	if request.PickupLocation != nil {
+		taxRequest.Country = request.PickupLocation.Country
+		taxRequest.Region = request.PickupLocation.State
+		if taxRequest.City == "" {
+			taxRequest.City = request.PickupLocation.City
+		}
+	}
+	return taxRequest
+}
+
+// activeRidePass returns the rider's pass if it covers the trip when it was
+// requested. A failed lookup prices the trip without the pass.
+func (s *fareCalculationService) activeRidePass(ctx context.Context, request *FareCalculationRequest) *models.RidePassSubscription {
+	if s.ridePassService == nil || request.RiderID.IsZero() {
+		return nil
+	}
+
+	at := request.RequestedAt
+	if at.IsZero() {
+		at = time.Now()
+	}
+
+	pass, err := s.ridePassService.GetActivePass(ctx, request.RiderID, request.City, request.RideType, at)
+	if err != nil {
+		s.logger.WithError(err).
+			WithUserID(request.RiderID).
+			Warn("Ride pass not applied to fare")
+		return nil
+	}
+	return pass
+}
+
+// calculatePassDiscount applies a pass's percentage discount to the trip fare
+// left after its other benefits. A per-ride cap in another currency than the
+// fare's leaves the discount out rather than applying it uncapped.
+func (s *fareCalculationService) calculatePassDiscount(request *FareCalculationRequest, pass *models.RidePassSubscription, tripFare money.Money) money.Money {
+	none := money.Zero(tripFare.Currency)
+	if pass.Benefits.DiscountPercent <= 0 || !tripFare.IsPositive() {
+		return none
+	}
+
+	maxDiscount := pass.Benefits.MaxDiscount
+	if maxDiscount.IsZero() {
+		maxDiscount = none
+	}
+	discount, err := utils.CalculateDiscount(tripFare, pass.Benefits.DiscountPercent, maxDiscount)
+	if err != nil {
+		s.logger.WithError(err).
+			WithUserID(request.RiderID).
+			WithField("subscription_id", pass.ID.Hex()).
+			Warn("Ride pass discount not applied to fare")
+		return none
+	}
+	return discount
+}
+
+// calculateDiscount applies a promotion to the subtotal. A promotion that no
+// longer validates, or whose amounts are in another currency, prices the trip
+// without a discount rather than failing it.
+func (s *fareCalculationService) calculateDiscount(ctx context.Context, request *FareCalculationRequest, subtotal money.Money) money.Money {
+	none := money.Zero(subtotal.Currency)
+	notApplied := func(err error) money.Money {
+		s.logger.WithError(err).
+			WithUserID(request.RiderID).
+			WithField("promo_code", request.PromoCode).
+			Warn("Promotion not applied to fare")
+		return none
+	}
+
+	promotion, err := s.promotionRepo.ValidateCode(ctx, strings.ToUpper(request.PromoCode), request.RiderID, string(request.RideType))
+	if err != nil {
+		return notApplied(err)
+	}
+
+	if promotion.MinRideAmount.IsPositive() {
+		comparison, err := subtotal.Compare(promotion.MinRideAmount)
+		if err != nil {
+			return notApplied(err)
+		}
+		if comparison < 0 {
+			return none
+		}
+	}
+
+	if len(promotion.TargetCities) > 0 {
+		matched := false
+		for _, city := range promotion.TargetCities {
+			if strings.EqualFold(city, request.City) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return none
+		}
+	}
+
+	discount := none
+	switch promotion.Type {
+	case models.PromotionTypePercentage:
+		discount, err = utils.CalculateDiscount(subtotal, promotion.DiscountValue, promotion.MaxDiscount)
+	case models.PromotionTypeFixed:
+		discount = promotion.DiscountAmount
+	case models.PromotionTypeFreeRide, models.PromotionTypeBOGO:
+		discount = subtotal
+		if promotion.MaxDiscount.IsPositive() {
+			discount, err = money.Min(discount, promotion.MaxDiscount)
+		}
+	}
+	if err == nil {
+		discount, err = money.Min(discount, subtotal)
+	}
+	if err != nil {
+		return notApplied(err)
+	}
+
+	return discount
+}
+
+// billableWaitingMinutes removes the fare structure's free window from the
+// minutes waited at pickup.
+func billableWaitingMinutes(fareStructure *models.FareStructure, waitedMinutes int) int {
+	billable := waitedMinutes - fareStructure.FreeWaitingTime
+	if billable < 0 {
+		return 0
+	}
+	return billable
+}
+
+// matchSurcharges returns the fixed route and surcharges that apply to a trip.
+// When several fixed routes match, the cheapest is used. Rules whose geofence
+// is inactive or whose amount is in another currency than the fare are
+// skipped, and a failed lookup prices the trip without surcharges rather than
+// failing it.
+func (s *fareCalculationService) matchSurcharges(ctx context.Context, request *FareCalculationRequest, city, currency string) (*models.SurchargeRule, []models.FareSurcharge) {
+	if request.PickupLocation == nil && request.DropoffLocation == nil && len(request.Path) == 0 {
+		return nil, nil
+	}
+
+	at := request.RequestedAt
+	if at.IsZero() {
+		at = time.Now()
+	}
+
+	rules, err := s.surchargeRepo.GetActive(ctx, city, at)
+	if err != nil {
+		s.logger.WithError(err).WithField("city", city).Warn("Surcharges not applied to fare")
+		return nil, nil
+	}
+	if len(rules) == 0 {
+		return nil, nil
+	}
+
+	geofenceList, err := s.geofenceRepo.GetActive(ctx)
+	if err != nil {
+		s.logger.WithError(err).WithField("city", city).Warn("Surcharges not applied to fare")
+		return nil, nil
+	}
+	geofences := make(map[primitive.ObjectID]*models.Geofence, len(geofenceList))
+	for _, geofence := range geofenceList {
+		geofences[geofence.ID] = geofence
+	}
+
+	contains := func(geofence *models.Geofence, location *models.Location) bool {
+		return location != nil && geofenceContains(geofence, location.Latitude(), location.Longitude())
+	}
+
+	var fixedRoute *models.SurchargeRule
+	var surcharges []models.FareSurcharge
+	for _, rule := range rules {
+		geofence, exists := geofences[rule.GeofenceID]
+		if !exists || !rule.AppliesTo(request.RideType) {
+			continue
+		}
+		if !rule.Amount.SameCurrency(money.Zero(currency)) {
+			s.logger.WithField("rule_id", rule.ID.Hex()).
+				WithField("currency", rule.Amount.Currency).
+				Warn("Surcharge rule skipped, currency differs from fare")
+			continue
+		}
+
+		var matched bool
+		switch rule.Type {
+		case models.SurchargeTypeAirportPickup:
+			matched = contains(geofence, request.PickupLocation)
+		case models.SurchargeTypeAirportDropoff:
+			matched = contains(geofence, request.DropoffLocation)
+		case models.SurchargeTypeCongestion:
+			matched = contains(geofence, request.PickupLocation) || contains(geofence, request.DropoffLocation) ||
+				geofenceIntersectsPath(geofence, request.Path)
+		case models.SurchargeTypeToll:
+			matched = geofenceIntersectsPath(geofence, request.Path)
+		case models.SurchargeTypeFixedRoute:
+			if rule.DestinationGeofenceID == nil {
+				continue
+			}
+			destination, exists := geofences[*rule.DestinationGeofenceID]
+			if !exists {
+				continue
+			}
+			matched = contains(geofence, request.PickupLocation) && contains(destination, request.DropoffLocation) ||
+				rule.Bidirectional && contains(destination, request.PickupLocation) && contains(geofence, request.DropoffLocation)
+			if matched && (fixedRoute == nil || rule.Amount.Amount < fixedRoute.Amount.Amount) {
+				fixedRoute = rule
+			}
+			continue
+		}
+
+		if matched {
+			surcharges = append(surcharges, models.FareSurcharge{
+				RuleID:     rule.ID,
+				Name:       rule.Name,
+				Type:       rule.Type,
+				GeofenceID: rule.GeofenceID,
+				Amount:     rule.Amount,
+			})
+		}
+	}
+
+	return fixedRoute, surcharges
+}
+
+// ridePath returns the route a ride is checked against for surcharges. The
+// planned route is the ride's own, or the one its quote was priced over; the
+// actual route falls back to the planned one when too few locations were
+// tracked.
+func (s *fareCalculationService) ridePath(ctx context.Context, ride *models.Ride, route FareRoute) []utils.Point {
+	if route == FareRouteActual {
+		history, err := s.locationRepo.GetRideLocationHistory(ctx, ride.ID)
+		if err != nil {
+			s.logger.WithError(err).WithRideID(ride.ID).Warn("Failed to load tracked route for fare")
+		}
+		if len(history) >= 2 {
+			path := make([]utils.Point, 0, len(history))
+			for _, entry := range history {
+				path = append(path, utils.Point{Lat: entry.Location.Latitude(), Lng: entry.Location.Longitude()})
+			}
+			return path
+		}
+	}
+
+	polyline := ""
+	switch {
+	case ride.Route != nil && ride.Route.EncodedPolyline != "":
+		polyline = ride.Route.EncodedPolyline
+	case ride.FareQuote != nil:
+		polyline = ride.FareQuote.EncodedPolyline
+	}
+	if polyline == "" {
+		return nil
+	}
+
+	path, err := utils.DecodePolyline(polyline)
+	if err != nil {
+		s.logger.WithError(err).WithRideID(ride.ID).Warn("Failed to decode planned route for fare")
+		return nil
+	}
+	return path
+}
+
+// geofenceIntersectsPath reports whether a route enters a geofence.
+func geofenceIntersectsPath(geofence *models.Geofence, path []utils.Point) bool {
+	if len(path) == 0 {
+		return false
+	}
+
+	switch geofence.Type {
+	case models.GeofenceTypeCircle:
+		if len(geofence.Coordinates) == 0 {
+			return false
+		}
+		return utils.PathIntersectsCircle(path, utils.NewPointFromCoordinates(geofence.Coordinates[0]), geofence.Radius)
+	case models.GeofenceTypePolygon:
+		return utils.PathIntersectsPolygon(path, geofencePolygon(geofence))
+	}
+	return false
+}
+
+func validateSurchargeRule(rule *models.SurchargeRule) error {
+	if rule.Name == "" || rule.GeofenceID.IsZero() {
+		return fmt.Errorf("name and geofence are required")
+	}
+	if rule.Amount.IsNegative() {
+		return fmt.Errorf("surcharge amount cannot be negative")
+	}
+	if rule.Amount.Currency == "" {
+		return fmt.Errorf("surcharge amount requires a currency")
+	}
+
+	switch rule.Type {
+	case models.SurchargeTypeAirportPickup, models.SurchargeTypeAirportDropoff,
+		models.SurchargeTypeCongestion, models.SurchargeTypeToll:
+	case models.SurchargeTypeFixedRoute:
+		if rule.DestinationGeofenceID == nil {
+			return fmt.Errorf("a fixed route requires a destination geofence")
+		}
+		if rule.Amount.IsZero() {
+			return fmt.Errorf("a fixed route requires a fare")
+		}
+	default:
+		return fmt.Errorf("invalid surcharge type: %s", rule.Type)
+	}
+
+	if rule.EffectiveUntil != nil && !rule.EffectiveUntil.After(rule.EffectiveFrom) {
+		return fmt.Errorf("effective until must be after effective from")
+	}
+	return nil
+}
+
+func validateFareStructure(fareStructure *models.FareStructure) error {
+	if fareStructure.City == "" || fareStructure.RideType == "" {
+		return fmt.Errorf("city and ride type are required")
+	}
+	if fareStructure.PricePerKM < 0 || fareStructure.PricePerMinute < 0 || fareStructure.WaitingTimeRate < 0 {
+		return fmt.Errorf("fare rates cannot be negative")
+	}
+	for _, amount := range fareStructureAmounts(fareStructure) {
+		if amount.IsNegative() {
+			return fmt.Errorf("fare amounts cannot be negative")
+		}
+		if !amount.SameCurrency(money.Zero(fareStructure.Currency)) {
+			return fmt.Errorf("fare amounts must be in %s", fareStructure.Currency)
+		}
+	}
+	if fareStructure.MaximumFare.IsPositive() && fareStructure.MaximumFare.Amount < fareStructure.MinimumFare.Amount {
+		return fmt.Errorf("maximum fare must not be below the minimum fare")
+	}
+	if fareStructure.EffectiveUntil != nil && !fareStructure.EffectiveUntil.After(fareStructure.EffectiveFrom) {
+		return fmt.Errorf("effective until must be after effective from")
+	}
+	return nil
+}
+
+// fareStructureAmounts lists the fixed amounts of a fare structure, as opposed
+// to its per-unit rates.
+func fareStructureAmounts(fareStructure *models.FareStructure) []*money.Money {
+	return []*money.Money{
+		&fareStructure.BaseFare,
+		&fareStructure.MinimumFare,
+		&fareStructure.MaximumFare,
+		&fareStructure.BookingFee,
+		&fareStructure.CancellationFee,
+	}
+}
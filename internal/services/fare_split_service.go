@@ -0,0 +1,774 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"goride/internal/models"
+	"goride/internal/repositories/interfaces"
+	"goride/pkg/logger"
+	"goride/pkg/money"
+	"goride/pkg/payment"
+	"goride/pkg/websocket"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type FareSplitService interface {
+	// Invitations
+	CreateSplit(ctx context.Context, rideID, requesterID primitive.ObjectID, request *FareSplitRequest) (*models.FareSplit, error)
+	RespondToInvite(ctx context.Context, splitID, userID primitive.ObjectID, accept bool) (*models.FareSplit, error)
+	GetSplit(ctx context.Context, rideID primitive.ObjectID) (*models.FareSplit, error)
+
+	// Settlement
+	SettleSplit(ctx context.Context, rideID primitive.ObjectID) (*models.FareSplit, error)
+	CoverUncollectedShares(ctx context.Context, rideID primitive.ObjectID, cover *models.Payment) (*models.FareSplit, error)
+	CancelSplit(ctx context.Context, rideID primitive.ObjectID) error
+}
+
+type FareSplitRequest struct {
+	Mode                models.FareSplitMode `json:"mode" validate:"required,oneof=equal custom"`
+	Invitees            []FareSplitInvitee   `json:"invitees" validate:"required,min=1"`
+	RequesterPercentage float64              `json:"requester_percentage"` // custom splits only
+}
+
+// FareSplitInvitee identifies an invited user by phone number or by their
+// rider referral code.
+type FareSplitInvitee struct {
+	Phone        string  `json:"phone"`
+	ReferralCode string  `json:"referral_code"`
+	Percentage   float64 `json:"percentage"` // custom splits only
+}
+
+// Fare split websocket events
+const (
+	FareSplitEventInvite    = "fare_split_invite"
+	FareSplitEventResponse  = "fare_split_response"
+	FareSplitEventSettled   = "fare_split_settled"
+	FareSplitEventCancelled = "fare_split_cancelled"
+)
+
+const (
+	fareSplitLockPrefix = "fare_splits:ride:"
+	fareSplitLockTTL    = time.Minute
+
+	maxFareSplitInvitees = 5
+	// percentageTolerance absorbs float error when custom percentages are
+	// checked to add up to 100
+	percentageTolerance = 0.01
+)
+
+type fareSplitService struct {
+	fareSplitRepo   interfaces.FareSplitRepository
+	rideRepo        interfaces.RideRepository
+	userRepo        interfaces.UserRepository
+	riderRepo       interfaces.RiderRepository
+	driverRepo      interfaces.DriverRepository
+	paymentRepo     interfaces.PaymentRepository
+	paymentProvider payment.PaymentProvider
+	exchangeService ExchangeRateService
+	walletService   WalletService
+	cache           CacheService
+	wsHandler       *websocket.Handler
+	logger          *logger.Logger
+}
+
+func NewFareSplitService(
+	fareSplitRepo interfaces.FareSplitRepository,
+	rideRepo interfaces.RideRepository,
+	userRepo interfaces.UserRepository,
+	riderRepo interfaces.RiderRepository,
+	driverRepo interfaces.DriverRepository,
+	paymentRepo interfaces.PaymentRepository,
+	paymentProvider payment.PaymentProvider,
+	exchangeService ExchangeRateService,
+	walletService WalletService,
+	cache CacheService,
+	wsHandler *websocket.Handler,
+	logger *logger.Logger,
+) FareSplitService {
+	return &fareSplitService{
+		fareSplitRepo:   fareSplitRepo,
+		rideRepo:        rideRepo,
+		userRepo:        userRepo,
+		riderRepo:       riderRepo,
+		driverRepo:      driverRepo,
+		paymentRepo:     paymentRepo,
+		paymentProvider: paymentProvider,
+		exchangeService: exchangeService,
+		walletService:   walletService,
+		cache:           cache,
+		wsHandler:       wsHandler,
+		logger:          logger,
+	}
+}
+
+// Invitations
+
+// CreateSplit opens a split on a ride that has not ended yet and invites the
+// given users. The requester takes part from the start; invitees only pay once
+// they accept.
+func (s *fareSplitService) CreateSplit(ctx context.Context, rideID, requesterID primitive.ObjectID, request *FareSplitRequest) (*models.FareSplit, error) {
+	ride, err := s.rideRepo.GetByID(ctx, rideID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get ride: %w", err)
+	}
+
+	if ride.RiderID != requesterID {
+		return nil, fmt.Errorf("ride does not belong to this rider")
+	}
+
+	switch ride.Status {
+	case models.RideStatusCompleted, models.RideStatusCancelled, models.RideStatusNoShow:
+		return nil, fmt.Errorf("fare of a %s ride cannot be split", ride.Status)
+	}
+
+	if ride.FareSplitID != nil {
+		return nil, fmt.Errorf("ride fare is already split")
+	}
+
+	if len(request.Invitees) == 0 || len(request.Invitees) > maxFareSplitInvitees {
+		return nil, fmt.Errorf("between 1 and %d riders can be invited", maxFareSplitInvitees)
+	}
+
+	requester, err := s.riderRepo.GetByUserID(ctx, requesterID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get rider: %w", err)
+	}
+
+	// The requester covers any share that cannot be collected
+	if requester.DefaultPaymentID == nil {
+		return nil, fmt.Errorf("a default payment method is required to split a fare")
+	}
+
+	if err := validateSplitPercentages(request); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	split := &models.FareSplit{
+		RideID:      rideID,
+		RequesterID: requesterID,
+		Mode:        request.Mode,
+		Status:      models.FareSplitStatusOpen,
+		Participants: []models.FareSplitParticipant{{
+			UserID:      requesterID,
+			IsRequester: true,
+			Percentage:  request.RequesterPercentage,
+			Status:      models.FareSplitParticipantAccepted,
+			InvitedAt:   now,
+			RespondedAt: &now,
+		}},
+	}
+
+	for _, invitee := range request.Invitees {
+		userID, err := s.resolveInvitee(ctx, invitee)
+		if err != nil {
+			return nil, err
+		}
+
+		if split.Participant(userID) != nil {
+			return nil, fmt.Errorf("each rider can only be invited once")
+		}
+
+		split.Participants = append(split.Participants, models.FareSplitParticipant{
+			UserID:       userID,
+			Phone:        invitee.Phone,
+			ReferralCode: invitee.ReferralCode,
+			Percentage:   invitee.Percentage,
+			Status:       models.FareSplitParticipantInvited,
+			InvitedAt:    now,
+		})
+	}
+
+	if split.Mode == models.FareSplitModeEqual {
+		for i := range split.Participants {
+			split.Participants[i].Percentage = 0
+		}
+	}
+
+	if err := s.fareSplitRepo.Create(ctx, split); err != nil {
+		return nil, fmt.Errorf("failed to create fare split: %w", err)
+	}
+
+	if err := s.rideRepo.Update(ctx, rideID, map[string]interface{}{
+		"fare_split_id": split.ID,
+	}); err != nil {
+		return nil, fmt.Errorf("failed to link fare split to ride: %w", err)
+	}
+
+	for _, participant := range split.Participants[1:] {
+		s.notify(participant.UserID, FareSplitEventInvite, split, map[string]interface{}{
+			"ride_number":  ride.RideNumber,
+			"requester_id": requesterID.Hex(),
+			"percentage":   participant.Percentage,
+		})
+	}
+
+	s.logger.WithRideID(rideID).
+		WithField("fare_split_id", split.ID.Hex()).
+		WithField("mode", split.Mode).
+		WithField("invitees", len(split.Participants)-1).
+		Info("Fare split created")
+
+	return split, nil
+}
+
+// RespondToInvite records an invitee's answer. Accepting requires a default
+// payment method, since that is what the share is charged to.
+func (s *fareSplitService) RespondToInvite(ctx context.Context, splitID, userID primitive.ObjectID, accept bool) (*models.FareSplit, error) {
+	split, err := s.fareSplitRepo.GetByID(ctx, splitID)
+	if err != nil {
+		return nil, err
+	}
+
+	if split.Status != models.FareSplitStatusOpen {
+		return nil, fmt.Errorf("fare split is no longer open")
+	}
+
+	// The shares are fixed once the ride is over, even while they are still
+	// being charged
+	ride, err := s.rideRepo.GetByID(ctx, split.RideID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get ride: %w", err)
+	}
+	switch ride.Status {
+	case models.RideStatusCompleted, models.RideStatusCancelled, models.RideStatusNoShow:
+		return nil, fmt.Errorf("fare split is no longer open")
+	}
+
+	status := models.FareSplitParticipantDeclined
+	if accept {
+		rider, err := s.riderRepo.GetByUserID(ctx, userID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get rider: %w", err)
+		}
+		if rider.DefaultPaymentID == nil {
+			return nil, fmt.Errorf("a default payment method is required to accept a fare split")
+		}
+		status = models.FareSplitParticipantAccepted
+	}
+
+	now := time.Now()
+	if err := s.fareSplitRepo.UpdateOpenParticipant(ctx, splitID, userID, models.FareSplitParticipantInvited, map[string]interface{}{
+		"status":       status,
+		"responded_at": now,
+	}); err != nil {
+		return nil, err
+	}
+
+	participant := split.Participant(userID)
+	participant.Status = status
+	participant.RespondedAt = &now
+
+	s.notify(split.RequesterID, FareSplitEventResponse, split, map[string]interface{}{
+		"user_id": userID.Hex(),
+		"status":  status,
+	})
+
+	return split, nil
+}
+
+func (s *fareSplitService) GetSplit(ctx context.Context, rideID primitive.ObjectID) (*models.FareSplit, error) {
+	return s.fareSplitRepo.GetByRideID(ctx, rideID)
+}
+
+// Settlement
+
+// SettleSplit charges every accepted participant their share of the completed
+// ride's fare, each to their own default payment method and as their own
+// payment. Shares of invitees who did not accept stay with the requester, and
+// a share whose charge fails is charged to the requester instead. Each charge
+// is saved on its participant as it is made, so settling again charges only
+// the shares not charged yet; the split is settled once every share is paid.
+func (s *fareSplitService) SettleSplit(ctx context.Context, rideID primitive.ObjectID) (*models.FareSplit, error) {
+	lock, err := s.cache.Lock(ctx, fareSplitLockPrefix+rideID.Hex(), fareSplitLockTTL)
+	if err != nil {
+		return nil, fmt.Errorf("fare split is already being settled")
+	}
+	defer s.cache.Unlock(ctx, lock)
+
+	ride, err := s.rideRepo.GetByID(ctx, rideID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get ride: %w", err)
+	}
+
+	if ride.Status != models.RideStatusCompleted {
+		return nil, fmt.Errorf("only completed rides can be settled")
+	}
+
+	split, err := s.fareSplitRepo.GetByRideID(ctx, rideID)
+	if err != nil {
+		return nil, err
+	}
+
+	switch split.Status {
+	case models.FareSplitStatusSettled:
+		return split, nil
+	case models.FareSplitStatusOpen:
+	default:
+		return nil, fmt.Errorf("fare split is already %s", split.Status)
+	}
+
+	template := &models.Payment{
+		RideID:      rideID,
+		FareSplitID: &split.ID,
+		PaymentType: models.PaymentTypeRide,
+	}
+	if ride.FareBreakdown != nil {
+		if err := ride.FareBreakdown.ApplyToPayment(template); err != nil {
+			return nil, fmt.Errorf("failed to build ride payment: %w", err)
+		}
+	} else {
+		template.Amount = money.FromMajor(ride.FinalFare, ride.Currency)
+		template.Currency = ride.Currency
+	}
+
+	if ride.DriverID != nil {
+		driver, err := s.driverRepo.GetByID(ctx, *ride.DriverID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get driver: %w", err)
+		}
+		template.PayeeID = driver.UserID
+	}
+
+	payers, ratios := splitRatios(split)
+	shares, err := allocatePayment(template, ratios)
+	if err != nil {
+		return nil, fmt.Errorf("failed to allocate fare shares: %w", err)
+	}
+
+	split.Total = template.Amount
+	paid := true
+	for i, index := range payers {
+		participant := &split.Participants[index]
+		participant.Share = shares[i].Amount
+
+		if err := s.settleShare(ctx, split, participant, shares[i]); err != nil {
+			return nil, err
+		}
+		paid = paid && participant.Paid()
+	}
+
+	if !paid {
+		if err := s.saveParticipants(ctx, split); err != nil {
+			return nil, err
+		}
+		s.logger.WithRideID(rideID).
+			WithField("fare_split_id", split.ID.Hex()).
+			Warn("Fare split has unpaid shares")
+		return split, nil
+	}
+
+	if err := s.closeSplit(ctx, split); err != nil {
+		return nil, err
+	}
+
+	s.logger.WithRideID(rideID).
+		WithField("fare_split_id", split.ID.Hex()).
+		WithField("total", split.Total.String()).
+		WithField("payers", len(payers)).
+		Info("Fare split settled")
+
+	return split, nil
+}
+
+// CoverUncollectedShares records a payment that paid for every share that
+// could not be charged, such as the fare captured from the ride's hold, and
+// settles the split when no share is left unpaid.
+func (s *fareSplitService) CoverUncollectedShares(ctx context.Context, rideID primitive.ObjectID, cover *models.Payment) (*models.FareSplit, error) {
+	lock, err := s.cache.Lock(ctx, fareSplitLockPrefix+rideID.Hex(), fareSplitLockTTL)
+	if err != nil {
+		return nil, fmt.Errorf("fare split is already being settled")
+	}
+	defer s.cache.Unlock(ctx, lock)
+
+	split, err := s.fareSplitRepo.GetByRideID(ctx, rideID)
+	if err != nil {
+		return nil, err
+	}
+	if split.Status != models.FareSplitStatusOpen {
+		return nil, fmt.Errorf("fare split is already %s", split.Status)
+	}
+
+	paid := true
+	for i := range split.Participants {
+		participant := &split.Participants[i]
+		if participant.Uncollected() {
+			participant.FallbackPaymentID = &cover.ID
+			participant.FallbackStatus = cover.Status
+		}
+		if participant.PaymentID != nil {
+			paid = paid && participant.Paid()
+		}
+	}
+
+	if !paid {
+		if err := s.saveParticipants(ctx, split); err != nil {
+			return nil, err
+		}
+		return split, nil
+	}
+
+	if err := s.closeSplit(ctx, split); err != nil {
+		return nil, err
+	}
+
+	s.logger.WithRideID(rideID).
+		WithField("fare_split_id", split.ID.Hex()).
+		WithField("payment_id", cover.ID.Hex()).
+		Info("Fare split settled with uncollected shares covered")
+
+	return split, nil
+}
+
+// CancelSplit closes an open split when the ride ends without a fare to
+// share. Cancellation and no-show fees stay with the requester.
+func (s *fareSplitService) CancelSplit(ctx context.Context, rideID primitive.ObjectID) error {
+	split, err := s.fareSplitRepo.GetByRideID(ctx, rideID)
+	if err != nil {
+		return err
+	}
+
+	if split.Status != models.FareSplitStatusOpen {
+		return nil
+	}
+
+	split.Status = models.FareSplitStatusCancelled
+	if err := s.fareSplitRepo.Update(ctx, split.ID, map[string]interface{}{
+		"status": split.Status,
+	}); err != nil {
+		return fmt.Errorf("failed to cancel fare split: %w", err)
+	}
+
+	for _, participant := range split.Participants[1:] {
+		if participant.Status == models.FareSplitParticipantDeclined {
+			continue
+		}
+		s.notify(participant.UserID, FareSplitEventCancelled, split, nil)
+	}
+
+	return nil
+}
+
+// Helper methods
+
+func (s *fareSplitService) resolveInvitee(ctx context.Context, invitee FareSplitInvitee) (primitive.ObjectID, error) {
+	phone := strings.TrimSpace(invitee.Phone)
+	code := strings.TrimSpace(invitee.ReferralCode)
+
+	switch {
+	case phone != "" && code != "":
+		return primitive.NilObjectID, fmt.Errorf("invite by phone or referral code, not both")
+	case phone != "":
+		user, err := s.userRepo.GetByPhone(ctx, phone)
+		if err != nil {
+			return primitive.NilObjectID, fmt.Errorf("no rider found with phone %s", phone)
+		}
+		if user.UserType != models.UserTypeRider {
+			return primitive.NilObjectID, fmt.Errorf("no rider found with phone %s", phone)
+		}
+		return user.ID, nil
+	case code != "":
+		rider, err := s.riderRepo.GetByReferralCode(ctx, code)
+		if err != nil {
+			return primitive.NilObjectID, fmt.Errorf("no rider found with referral code %s", code)
+		}
+		return rider.UserID, nil
+	default:
+		return primitive.NilObjectID, fmt.Errorf("invitee phone or referral code is required")
+	}
+}
+
+// settleShare charges a participant's share unless it was charged before, and
+// charges it to the requester when the participant's charge failed. Charges
+// already made are not sent again: their status is read back, so a charge the
+// recovery job has since settled is picked up. The participants are saved
+// after every charge.
+func (s *fareSplitService) settleShare(ctx context.Context, split *models.FareSplit, participant *models.FareSplitParticipant, share *models.Payment) error {
+	switch {
+	case participant.PaymentID == nil:
+		charged, err := s.chargeShare(ctx, split, participant.UserID, share)
+		if err != nil {
+			return err
+		}
+		participant.PaymentID = &charged.ID
+		setShareStatus(participant, charged)
+		if err := s.saveParticipants(ctx, split); err != nil {
+			return err
+		}
+	case participant.Status == models.FareSplitParticipantPending:
+		charged, err := s.paymentRepo.GetByID(ctx, *participant.PaymentID)
+		if err != nil {
+			return fmt.Errorf("failed to get fare share payment: %w", err)
+		}
+		setShareStatus(participant, charged)
+	}
+
+	if participant.Status != models.FareSplitParticipantFailed || participant.IsRequester {
+		return nil
+	}
+
+	switch {
+	case participant.FallbackPaymentID == nil:
+		fallback, err := s.chargeShare(ctx, split, split.Participants[0].UserID, share)
+		if err != nil {
+			return err
+		}
+		participant.FallbackPaymentID = &fallback.ID
+		participant.FallbackStatus = fallback.Status
+		if err := s.saveParticipants(ctx, split); err != nil {
+			return err
+		}
+
+		s.logger.WithRideID(split.RideID).
+			WithField("fare_split_id", split.ID.Hex()).
+			WithField("user_id", participant.UserID.Hex()).
+			WithField("fallback_status", fallback.Status).
+			Warn("Fare split share charged to requester after payment failure")
+	case participant.FallbackStatus == models.PaymentStatusPending:
+		fallback, err := s.paymentRepo.GetByID(ctx, *participant.FallbackPaymentID)
+		if err != nil {
+			return fmt.Errorf("failed to get fare share payment: %w", err)
+		}
+		participant.FallbackStatus = fallback.Status
+	}
+
+	return nil
+}
+
+// closeSplit marks a split whose shares are all paid as settled and tells
+// the participants.
+func (s *fareSplitService) closeSplit(ctx context.Context, split *models.FareSplit) error {
+	now := time.Now()
+	split.Status = models.FareSplitStatusSettled
+	split.SettledAt = &now
+
+	if err := s.fareSplitRepo.Update(ctx, split.ID, map[string]interface{}{
+		"status":       split.Status,
+		"total":        split.Total,
+		"participants": split.Participants,
+		"settled_at":   now,
+	}); err != nil {
+		return fmt.Errorf("failed to settle fare split: %w", err)
+	}
+
+	for _, participant := range split.Participants {
+		s.notify(participant.UserID, FareSplitEventSettled, split, map[string]interface{}{
+			"status": participant.Status,
+			"share":  participant.Share,
+		})
+	}
+
+	return nil
+}
+
+func (s *fareSplitService) saveParticipants(ctx context.Context, split *models.FareSplit) error {
+	if err := s.fareSplitRepo.Update(ctx, split.ID, map[string]interface{}{
+		"total":        split.Total,
+		"participants": split.Participants,
+	}); err != nil {
+		return fmt.Errorf("failed to save fare split participants: %w", err)
+	}
+	return nil
+}
+
+// chargeShare charges one share to the payer's default payment method and
+// records it as the payer's payment for the ride. A declined charge is
+// recorded as a failed payment rather than returned as an error.
+func (s *fareSplitService) chargeShare(ctx context.Context, split *models.FareSplit, payerID primitive.ObjectID, share *models.Payment) (*models.Payment, error) {
+	charge := *share
+	charge.ID = primitive.NilObjectID
+	charge.PayerID = payerID
+	charge.PaymentMethod = models.PaymentMethodCreditCard
+	charge.Status = models.PaymentStatusPending
+
+	if err := s.exchangeService.SnapshotPayment(ctx, &charge); err != nil {
+		s.logger.WithError(err).WithRideID(split.RideID).Warn("Fare share charged without an exchange rate snapshot")
+	}
+
+	rider, err := s.riderRepo.GetByUserID(ctx, payerID)
+	if err != nil || rider.DefaultPaymentID == nil {
+		now := time.Now()
+		charge.Status = models.PaymentStatusFailed
+		charge.FailureReason = "no default payment method"
+		if err != nil {
+			charge.FailureReason = fmt.Sprintf("failed to get rider: %v", err)
+		}
+		charge.FailedAt = &now
+
+		if err := s.paymentRepo.Create(ctx, &charge); err != nil {
+			return nil, fmt.Errorf("failed to create fare share payment: %w", err)
+		}
+		return &charge, nil
+	}
+
+	charge.PaymentMethodID = *rider.DefaultPaymentID
+	if err := sendPayment(ctx, s.paymentRepo, s.paymentProvider, s.logger, &charge, &payment.PaymentRequest{
+		PaymentMethodID: rider.DefaultPaymentID.Hex(),
+		Amount:          charge.Amount,
+		Description:     "Ride fare share",
+		CustomerID:      payerID.Hex(),
+		Metadata: map[string]interface{}{
+			"ride_id":       split.RideID.Hex(),
+			"fare_split_id": split.ID.Hex(),
+		},
+	}); err != nil {
+		return nil, fmt.Errorf("failed to create fare share payment: %w", err)
+	}
+
+	if charge.Status == models.PaymentStatusCompleted {
+		if _, err := s.walletService.RecordPayment(ctx, &charge); err != nil {
+			s.logger.WithError(err).
+				WithRideID(split.RideID).
+				WithField("payment_id", charge.ID.Hex()).
+				Error("Fare share charged but not posted to the ledger")
+		}
+	}
+
+	return &charge, nil
+}
+
+func (s *fareSplitService) notify(userID primitive.ObjectID, eventType string, split *models.FareSplit, data map[string]interface{}) {
+	if s.wsHandler == nil {
+		return
+	}
+
+	if data == nil {
+		data = map[string]interface{}{}
+	}
+	data["fare_split_id"] = split.ID.Hex()
+	data["ride_id"] = split.RideID.Hex()
+	data["mode"] = split.Mode
+
+	s.wsHandler.SendUserNotification(userID, eventType, data)
+}
+
+// setShareStatus records the outcome of a participant's own charge.
+func setShareStatus(participant *models.FareSplitParticipant, charged *models.Payment) {
+	switch charged.Status {
+	case models.PaymentStatusCompleted:
+		participant.Status = models.FareSplitParticipantCharged
+		participant.FailureReason = ""
+	case models.PaymentStatusFailed:
+		participant.Status = models.FareSplitParticipantFailed
+		participant.FailureReason = charged.FailureReason
+	default:
+		participant.Status = models.FareSplitParticipantPending
+	}
+}
+
+func validateSplitPercentages(request *FareSplitRequest) error {
+	switch request.Mode {
+	case models.FareSplitModeEqual:
+		return nil
+	case models.FareSplitModeCustom:
+	default:
+		return fmt.Errorf("invalid fare split mode: %s", request.Mode)
+	}
+
+	total := request.RequesterPercentage
+	if total <= 0 {
+		return fmt.Errorf("requester percentage must be positive")
+	}
+	for _, invitee := range request.Invitees {
+		if invitee.Percentage <= 0 {
+			return fmt.Errorf("invitee percentages must be positive")
+		}
+		total += invitee.Percentage
+	}
+
+	if math.Abs(total-100) > percentageTolerance {
+		return fmt.Errorf("split percentages must add up to 100, got %.2f", total)
+	}
+
+	return nil
+}
+
+// splitRatios returns the indexes of the participants who pay, the requester
+// first, and the ratio each pays. The requester takes over the percentages of
+// invitees who did not accept.
+func splitRatios(split *models.FareSplit) ([]int, []float64) {
+	payers := []int{0}
+	ratios := []float64{1}
+	if split.Mode == models.FareSplitModeCustom {
+		ratios[0] = split.Participants[0].Percentage
+	}
+
+	for i, participant := range split.Participants[1:] {
+		// Participants charged by an earlier settlement have left accepted
+		if participant.Status != models.FareSplitParticipantAccepted && participant.PaymentID == nil {
+			if split.Mode == models.FareSplitModeCustom {
+				ratios[0] += participant.Percentage
+			}
+			continue
+		}
+
+		ratio := 1.0
+		if split.Mode == models.FareSplitModeCustom {
+			ratio = participant.Percentage
+		}
+		payers = append(payers, i+1)
+		ratios = append(ratios, ratio)
+	}
+
+	return payers, ratios
+}
+
+// allocatePayment divides every amount on a payment by the given ratios, so
+// each share carries its part of the fare, surcharges, taxes and earnings and
+// the shares of each amount add up to the original.
+func allocatePayment(template *models.Payment, ratios []float64) ([]*models.Payment, error) {
+	shares := make([]*models.Payment, len(ratios))
+	for i := range shares {
+		share := *template
+		share.Surcharges = make([]models.FareSurcharge, len(template.Surcharges))
+		copy(share.Surcharges, template.Surcharges)
+		share.TaxLines = make([]models.TaxLine, len(template.TaxLines))
+		copy(share.TaxLines, template.TaxLines)
+		shares[i] = &share
+	}
+
+	amounts := func(p *models.Payment) []*money.Money {
+		fields := []*money.Money{
+			&p.Amount, &p.BaseFare, &p.DistanceFare, &p.TimeFare, &p.SurgeAmount,
+			&p.SurchargeAmount, &p.TipAmount, &p.TaxAmount, &p.DiscountAmount,
+			&p.PlatformFee, &p.DriverEarnings,
+		}
+		for i := range p.Surcharges {
+			fields = append(fields, &p.Surcharges[i].Amount)
+		}
+		for i := range p.TaxLines {
+			fields = append(fields, &p.TaxLines[i].TaxableAmount, &p.TaxLines[i].Amount)
+		}
+		return fields
+	}
+
+	for field, amount := range amounts(template) {
+		parts, err := amount.Allocate(ratios...)
+		if err != nil {
+			return nil, err
+		}
+		for i, share := range shares {
+			*amounts(share)[field] = parts[i]
+		}
+	}
+
+	return shares, nil
+}
+
+// providerPaymentStatus maps the status a payment provider reports for a
+// charge onto the payment status.
+func providerPaymentStatus(status string) models.PaymentStatus {
+	switch strings.ToLower(status) {
+	case "succeeded", "completed", "captured", "paid":
+		return models.PaymentStatusCompleted
+	case "failed", "canceled", "cancelled", "requires_payment_method", "declined":
+		return models.PaymentStatusFailed
+	default:
+		return models.PaymentStatusPending
+	}
+}
@@ -0,0 +1,243 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"goride/internal/models"
+	"goride/pkg/payment"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type fareSplitFixture struct {
+	service   FareSplitService
+	rideID    primitive.ObjectID
+	requester primitive.ObjectID
+	invitee   primitive.ObjectID
+	cards     map[primitive.ObjectID]primitive.ObjectID // user ID to default card
+	splits    *fakeFareSplitRepo
+	payments  *fakePaymentRepo
+	provider  *fakeProvider
+}
+
+// newFareSplitFixture sets up a completed $30 ride split equally between the
+// requester and one invitee who accepted; a second invitee never answered.
+func newFareSplitFixture(t *testing.T) *fareSplitFixture {
+	t.Helper()
+
+	f := &fareSplitFixture{
+		rideID:    primitive.NewObjectID(),
+		requester: primitive.NewObjectID(),
+		invitee:   primitive.NewObjectID(),
+		cards:     make(map[primitive.ObjectID]primitive.ObjectID),
+		payments:  newFakePaymentRepo(),
+		provider:  newFakeProvider(),
+	}
+
+	riders := &fakeRiderRepo{riders: make(map[primitive.ObjectID]*models.Rider)}
+	for _, userID := range []primitive.ObjectID{f.requester, f.invitee} {
+		card := primitive.NewObjectID()
+		f.cards[userID] = card
+		riders.riders[userID] = &models.Rider{UserID: userID, DefaultPaymentID: &card}
+	}
+
+	rides := &fakeRideRepo{rides: map[primitive.ObjectID]*models.Ride{
+		f.rideID: {
+			ID:        f.rideID,
+			RiderID:   f.requester,
+			Status:    models.RideStatusCompleted,
+			FinalFare: 30,
+			Currency:  "USD",
+		},
+	}}
+
+	f.splits = &fakeFareSplitRepo{splits: map[primitive.ObjectID]*models.FareSplit{
+		f.rideID: {
+			ID:          primitive.NewObjectID(),
+			RideID:      f.rideID,
+			RequesterID: f.requester,
+			Mode:        models.FareSplitModeEqual,
+			Status:      models.FareSplitStatusOpen,
+			Participants: []models.FareSplitParticipant{
+				{UserID: f.requester, IsRequester: true, Status: models.FareSplitParticipantAccepted},
+				{UserID: f.invitee, Status: models.FareSplitParticipantAccepted},
+				{UserID: primitive.NewObjectID(), Status: models.FareSplitParticipantInvited},
+			},
+		},
+	}}
+
+	f.service = NewFareSplitService(f.splits, rides, nil, riders, nil, f.payments, f.provider,
+		fakeExchange{}, &fakeWallet{}, newFakeCache(), nil, newTestLogger(t))
+
+	return f
+}
+
+func (f *fareSplitFixture) answer(userID primitive.ObjectID, answer func() (*payment.PaymentResponse, error)) {
+	f.provider.answers[f.cards[userID].Hex()] = answer
+}
+
+func (f *fareSplitFixture) payerStatuses(userID primitive.ObjectID) []models.PaymentStatus {
+	var statuses []models.PaymentStatus
+	for _, p := range f.payments.byPayer(userID) {
+		statuses = append(statuses, p.Status)
+	}
+	return statuses
+}
+
+func TestSettleSplit(t *testing.T) {
+	completed, failed, pending := models.PaymentStatusCompleted, models.PaymentStatusFailed, models.PaymentStatusPending
+
+	tests := []struct {
+		name            string
+		requesterAnswer func() (*payment.PaymentResponse, error)
+		inviteeAnswer   func() (*payment.PaymentResponse, error)
+		wantStatus      models.FareSplitStatus
+		wantInvitee     models.FareSplitParticipantStatus
+		wantFallback    models.PaymentStatus
+		wantRequester   []models.PaymentStatus
+		wantInviteePays []models.PaymentStatus
+		wantUncollected bool
+	}{
+		{
+			name:            "every share charged settles the split",
+			wantStatus:      models.FareSplitStatusSettled,
+			wantInvitee:     models.FareSplitParticipantCharged,
+			wantRequester:   []models.PaymentStatus{completed},
+			wantInviteePays: []models.PaymentStatus{completed},
+		},
+		{
+			name:            "declined share is charged to the requester",
+			inviteeAnswer:   declined,
+			wantStatus:      models.FareSplitStatusSettled,
+			wantInvitee:     models.FareSplitParticipantFailed,
+			wantFallback:    completed,
+			wantRequester:   []models.PaymentStatus{completed, completed},
+			wantInviteePays: []models.PaymentStatus{failed},
+		},
+		{
+			name:            "unanswered share keeps the split open without a fallback",
+			inviteeAnswer:   unanswered,
+			wantStatus:      models.FareSplitStatusOpen,
+			wantInvitee:     models.FareSplitParticipantPending,
+			wantRequester:   []models.PaymentStatus{completed},
+			wantInviteePays: []models.PaymentStatus{pending},
+		},
+		{
+			name:            "unanswered fallback keeps the split open",
+			inviteeAnswer:   declined,
+			requesterAnswer: unanswered,
+			wantStatus:      models.FareSplitStatusOpen,
+			wantInvitee:     models.FareSplitParticipantFailed,
+			wantFallback:    pending,
+			wantRequester:   []models.PaymentStatus{pending, pending},
+			wantInviteePays: []models.PaymentStatus{failed},
+		},
+		{
+			name:            "declined fallback leaves the share uncollected",
+			inviteeAnswer:   declined,
+			requesterAnswer: declined,
+			wantStatus:      models.FareSplitStatusOpen,
+			wantInvitee:     models.FareSplitParticipantFailed,
+			wantFallback:    failed,
+			wantRequester:   []models.PaymentStatus{failed, failed},
+			wantInviteePays: []models.PaymentStatus{failed},
+			wantUncollected: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFareSplitFixture(t)
+			if tt.requesterAnswer != nil {
+				f.answer(f.requester, tt.requesterAnswer)
+			}
+			if tt.inviteeAnswer != nil {
+				f.answer(f.invitee, tt.inviteeAnswer)
+			}
+
+			split, err := f.service.SettleSplit(context.Background(), f.rideID)
+			if err != nil {
+				t.Fatalf("SettleSplit() error = %v", err)
+			}
+
+			if split.Status != tt.wantStatus {
+				t.Errorf("split status = %s, want %s", split.Status, tt.wantStatus)
+			}
+			if stored := f.splits.splits[f.rideID]; stored.Status != tt.wantStatus {
+				t.Errorf("stored split status = %s, want %s", stored.Status, tt.wantStatus)
+			}
+
+			invitee := split.Participant(f.invitee)
+			if invitee.Status != tt.wantInvitee || invitee.FallbackStatus != tt.wantFallback {
+				t.Errorf("invitee = %s (fallback %q), want %s (fallback %q)", invitee.Status, invitee.FallbackStatus, tt.wantInvitee, tt.wantFallback)
+			}
+			if invitee.Uncollected() != tt.wantUncollected {
+				t.Errorf("invitee uncollected = %v, want %v", invitee.Uncollected(), tt.wantUncollected)
+			}
+			if invitee.Share.Amount != 1500 {
+				t.Errorf("invitee share = %s, want 15.00", invitee.Share)
+			}
+
+			assertStatuses(t, "requester payments", f.payerStatuses(f.requester), tt.wantRequester)
+			assertStatuses(t, "invitee payments", f.payerStatuses(f.invitee), tt.wantInviteePays)
+		})
+	}
+}
+
+// TestSettleSplitResumes settles a split whose share went unanswered again
+// once the charge has gone through, and checks nothing is charged twice.
+func TestSettleSplitResumes(t *testing.T) {
+	ctx := context.Background()
+	f := newFareSplitFixture(t)
+	f.answer(f.invitee, unanswered)
+
+	split, err := f.service.SettleSplit(ctx, f.rideID)
+	if err != nil {
+		t.Fatalf("first SettleSplit() error = %v", err)
+	}
+	if split.Status != models.FareSplitStatusOpen {
+		t.Fatalf("split status = %s after an unanswered share, want open", split.Status)
+	}
+
+	// The recovery job learns the charge went through
+	share := f.payments.byPayer(f.invitee)[0]
+	now := time.Now()
+	share.Status = models.PaymentStatusCompleted
+	share.ProcessedAt = &now
+
+	for i := 0; i < 2; i++ {
+		split, err = f.service.SettleSplit(ctx, f.rideID)
+		if err != nil {
+			t.Fatalf("SettleSplit() run %d error = %v", i+2, err)
+		}
+		if split.Status != models.FareSplitStatusSettled {
+			t.Fatalf("split status = %s on run %d, want settled", split.Status, i+2)
+		}
+	}
+
+	if got := len(f.provider.requests); got != 2 {
+		t.Errorf("provider charged %d times, want 2", got)
+	}
+	if invitee := split.Participant(f.invitee); invitee.Status != models.FareSplitParticipantCharged {
+		t.Errorf("invitee status = %s, want charged", invitee.Status)
+	}
+	if stored := f.splits.splits[f.rideID]; stored.Total.Amount != 3000 {
+		t.Errorf("stored split total = %s, want 30.00", stored.Total)
+	}
+}
+
+func assertStatuses(t *testing.T, what string, got, want []models.PaymentStatus) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Errorf("%s = %v, want %v", what, got, want)
+		return
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			t.Errorf("%s = %v, want %v", what, got, want)
+			return
+		}
+	}
+}
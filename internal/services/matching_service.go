@@ -0,0 +1,1115 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"goride/internal/config"
+	"goride/internal/models"
+	"goride/internal/repositories/interfaces"
+	"goride/internal/utils"
+	"goride/pkg/logger"
+	"goride/pkg/websocket"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type MatchingService interface {
+	// Dispatch
+	StartDispatch(ctx context.Context, ride *models.Ride, options *DispatchOptions) (*models.RideRequest, error)
+	CancelDispatch(ctx context.Context, rideID primitive.ObjectID) error
+	EscalateDispatch(ctx context.Context, rideID primitive.ObjectID, escalation *DispatchEscalation) error
+	GetRideRequest(ctx context.Context, rideID primitive.ObjectID) (*models.RideRequest, error)
+
+	// Driver Responses
+	AcceptOffer(ctx context.Context, rideID, driverID, vehicleID primitive.ObjectID) (*models.Ride, error)
+	RejectOffer(ctx context.Context, rideID, driverID primitive.ObjectID, reason string) error
+
+	// Candidate Ranking
+	RankCandidates(ctx context.Context, request *models.RideRequest, radiusKM float64) ([]*DriverCandidate, error)
+
+	// Batch Assignment
+	SetBatchMode(ctx context.Context, city string, enabled bool) error
+	IsBatchModeEnabled(ctx context.Context, city string) bool
+	GetDispatchMetrics(ctx context.Context, city string) (*DispatchMetrics, error)
+}
+
+type DispatchOptions struct {
+	MaxWaitTime  int    `json:"max_wait_time"` // minutes
+	ExpiryReason string `json:"expiry_reason"` // cancellation reason used when nobody accepts
+}
+
+// DispatchEscalation widens an in-flight dispatch. It is kept in the cache so
+// it reaches the dispatch loop whichever instance is running it.
+type DispatchEscalation struct {
+	RadiusKM    float64   `json:"radius_km"`
+	BonusAmount float64   `json:"bonus_amount"`
+	Reason      string    `json:"reason"`
+	EscalatedAt time.Time `json:"escalated_at"`
+}
+
+type DriverCandidate struct {
+	DriverID       primitive.ObjectID `json:"driver_id"`
+	UserID         primitive.ObjectID `json:"user_id"`
+	Location       *models.Location   `json:"location"`
+	DistanceKM     float64            `json:"distance_km"`
+	ETAMinutes     int                `json:"eta_minutes"`
+	Rating         float64            `json:"rating"`
+	AcceptanceRate float64            `json:"acceptance_rate"`
+	Score          float64            `json:"score"`
+}
+
+type DispatchModeMetrics struct {
+	Assignments      int64   `json:"assignments"`
+	AveragePickupETA float64 `json:"average_pickup_eta"` // minutes
+}
+
+type DispatchMetrics struct {
+	City       string              `json:"city"`
+	Sequential DispatchModeMetrics `json:"sequential"`
+	Batch      DispatchModeMetrics `json:"batch"`
+	// Minutes of pickup ETA saved per ride by batch mode; negative when it is slower
+	ETAImprovement float64 `json:"eta_improvement"`
+}
+
+// Dispatch modes
+const (
+	DispatchModeSequential = "sequential"
+	DispatchModeBatch      = "batch"
+)
+
+// Dispatch websocket events
+const (
+	DispatchEventOffer         = "ride_offer"
+	DispatchEventOfferTimeout  = "ride_offer_timeout"
+	DispatchEventOfferClosed   = "ride_offer_closed"
+	DispatchEventSearching     = "dispatch_searching"
+	DispatchEventRadiusWidened = "dispatch_radius_widened"
+	DispatchEventDriverFound   = "dispatch_driver_found"
+	DispatchEventEscalated     = "dispatch_escalated"
+	DispatchEventExpired       = "dispatch_expired"
+)
+
+const (
+	dispatchExpiredReason = "no_drivers_available"
+	offerTimeoutReason    = "timeout"
+
+	// dispatchLockTTL bounds how long a driver's answer may hold the dispatch
+	// lock; waiting for the lock gives up once it would have expired
+	dispatchLockTTL      = 30 * time.Second
+	dispatchPollInterval = 500 * time.Millisecond
+)
+
+type offerOutcome int
+
+const (
+	offerAccepted offerOutcome = iota
+	offerRejected
+	offerTimedOut
+	offerSkipped
+	offerAborted
+)
+
+type offerResponse struct {
+	DriverID primitive.ObjectID `json:"driver_id"`
+	Accepted bool               `json:"accepted"`
+	Reason   string             `json:"reason,omitempty"`
+}
+
+// dispatchOffer is the offer a driver currently holds, with the bonus that
+// was on it when it was made.
+type dispatchOffer struct {
+	Candidate   *DriverCandidate `json:"candidate"`
+	BonusAmount float64          `json:"bonus_amount"`
+}
+
+// dispatchState is the part of a dispatch that drivers and riders act on. It
+// is kept in the cache under the ride's dispatch lock, so an offer can be
+// answered, and a dispatch cancelled, from any instance. Only one driver
+// holds an offer at a time; the offer is cleared by whichever side settles it
+// first (driver response or offer timeout).
+type dispatchState struct {
+	Offer     *dispatchOffer `json:"offer,omitempty"`
+	Response  *offerResponse `json:"response,omitempty"`
+	Cancelled bool           `json:"cancelled"`
+	ExpiresAt time.Time      `json:"expires_at"`
+}
+
+// dispatchSession is the dispatch loop's own view of a ride's dispatch. It
+// belongs to the goroutine running the loop; everything other instances need
+// is in the dispatch state.
+type dispatchSession struct {
+	request      *models.RideRequest
+	city         string
+	mode         string
+	expiryReason string
+	bonusAmount  float64
+	ctx          context.Context
+	cancel       context.CancelFunc
+}
+
+type matchingService struct {
+	rideService RideService
+	holdService PaymentHoldService
+	driverRepo  interfaces.DriverRepository
+	cache       CacheService
+	wsHandler   *websocket.Handler
+	config      *config.DispatchConfig
+	logger      *logger.Logger
+
+	batches map[string][]*dispatchSession
+	mutex   sync.Mutex
+}
+
+func NewMatchingService(
+	rideService RideService,
+	holdService PaymentHoldService,
+	driverRepo interfaces.DriverRepository,
+	cache CacheService,
+	wsHandler *websocket.Handler,
+	config *config.DispatchConfig,
+	logger *logger.Logger,
+) MatchingService {
+	return &matchingService{
+		rideService: rideService,
+		holdService: holdService,
+		driverRepo:  driverRepo,
+		cache:       cache,
+		wsHandler:   wsHandler,
+		config:      config,
+		logger:      logger,
+		batches:     make(map[string][]*dispatchSession),
+	}
+}
+
+// Dispatch
+func (s *matchingService) StartDispatch(ctx context.Context, ride *models.Ride, options *DispatchOptions) (*models.RideRequest, error) {
+	if ride.Status != models.RideStatusRequested {
+		return nil, fmt.Errorf("ride is not awaiting a driver")
+	}
+
+	if options == nil {
+		options = &DispatchOptions{}
+	}
+
+	maxWaitTime := options.MaxWaitTime
+	if maxWaitTime <= 0 {
+		maxWaitTime = int(utils.RideRequestTimeout.Minutes())
+	}
+
+	expiryReason := options.ExpiryReason
+	if expiryReason == "" {
+		expiryReason = dispatchExpiredReason
+	}
+
+	// The fare is held on the rider's card before any driver is offered the ride
+	if _, err := s.holdService.PlaceHold(ctx, ride); err != nil {
+		return nil, fmt.Errorf("failed to hold ride fare: %w", err)
+	}
+
+	now := time.Now()
+	// The request shares the ride's ID so offers and responses can be keyed by ride
+	request := &models.RideRequest{
+		ID:                ride.ID,
+		RiderID:           ride.RiderID,
+		RideType:          ride.RideType,
+		PickupLocation:    ride.PickupLocation,
+		DropoffLocation:   ride.DropoffLocation,
+		Waypoints:         ride.Waypoints,
+		ScheduledTime:     ride.ScheduledTime,
+		EstimatedFare:     ride.EstimatedFare,
+		EstimatedDuration: ride.EstimatedDuration,
+		EstimatedDistance: ride.EstimatedDistance,
+		SurgeMultiplier:   ride.SurgeMultiplier,
+		SpecialRequests:   ride.SpecialRequests,
+		PromoCode:         ride.PromoCode,
+		IsShared:          ride.IsShared,
+		MaxWaitTime:       maxWaitTime,
+		NearbyDrivers:     []primitive.ObjectID{},
+		RequestedDrivers:  []primitive.ObjectID{},
+		RejectedDrivers:   []primitive.ObjectID{},
+		ExpiresAt:         now.Add(time.Duration(maxWaitTime) * time.Minute),
+		CreatedAt:         now,
+		UpdatedAt:         now,
+	}
+
+	// Dispatch outlives the caller's request, so it runs on its own deadline
+	dispatchCtx, cancel := context.WithDeadline(context.Background(), request.ExpiresAt)
+	session := &dispatchSession{
+		request:      request,
+		city:         ride.PickupLocation.City,
+		mode:         DispatchModeSequential,
+		expiryReason: expiryReason,
+		ctx:          dispatchCtx,
+		cancel:       cancel,
+	}
+	if s.IsBatchModeEnabled(ctx, session.city) {
+		session.mode = DispatchModeBatch
+	}
+
+	state := &dispatchState{ExpiresAt: request.ExpiresAt}
+	started, err := s.cache.SetNX(ctx, dispatchStateCacheKey(ride.ID), state, dispatchTTL(request.ExpiresAt))
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("failed to start dispatch: %w", err)
+	}
+	if !started {
+		cancel()
+		return nil, fmt.Errorf("dispatch already in progress for ride")
+	}
+
+	if err := s.saveRideRequest(ctx, request); err != nil {
+		s.endDispatch(session)
+		return nil, err
+	}
+	go s.watchDispatch(session)
+
+	s.logger.WithRideID(ride.ID).
+		WithField("max_wait_time", maxWaitTime).
+		WithField("mode", session.mode).
+		Info("Driver dispatch started")
+
+	if session.mode == DispatchModeBatch {
+		s.enqueueBatch(session)
+	} else {
+		go s.runDispatch(session)
+	}
+
+	return request, nil
+}
+
+// CancelDispatch marks the ride's dispatch cancelled; the instance running it
+// stops the dispatch once it sees the mark.
+func (s *matchingService) CancelDispatch(ctx context.Context, rideID primitive.ObjectID) error {
+	return s.updateDispatch(ctx, rideID, func(state *dispatchState) error {
+		state.Cancelled = true
+		return nil
+	})
+}
+
+func (s *matchingService) EscalateDispatch(ctx context.Context, rideID primitive.ObjectID, escalation *DispatchEscalation) error {
+	if escalation.RadiusKM <= 0 && escalation.BonusAmount <= 0 {
+		return fmt.Errorf("escalation must widen the radius or add a bonus")
+	}
+
+	escalation.EscalatedAt = time.Now()
+	if err := s.cache.Set(ctx, dispatchEscalationCacheKey(rideID), escalation, utils.MaxWaitTime*4); err != nil {
+		return fmt.Errorf("failed to escalate dispatch: %w", err)
+	}
+
+	s.logger.WithRideID(rideID).
+		WithField("radius_km", escalation.RadiusKM).
+		WithField("bonus_amount", escalation.BonusAmount).
+		WithField("reason", escalation.Reason).
+		Info("Driver dispatch escalated")
+
+	return nil
+}
+
+func (s *matchingService) GetRideRequest(ctx context.Context, rideID primitive.ObjectID) (*models.RideRequest, error) {
+	var request models.RideRequest
+	if err := s.cache.Get(ctx, rideRequestCacheKey(rideID), &request); err != nil {
+		return nil, fmt.Errorf("ride request not found")
+	}
+
+	return &request, nil
+}
+
+// Driver Responses
+func (s *matchingService) AcceptOffer(ctx context.Context, rideID, driverID, vehicleID primitive.ObjectID) (*models.Ride, error) {
+	var ride *models.Ride
+	err := s.updateDispatch(ctx, rideID, func(state *dispatchState) error {
+		offer, err := heldOffer(state, driverID)
+		if err != nil {
+			return err
+		}
+
+		if vehicleID.IsZero() {
+			driver, err := s.driverRepo.GetByID(ctx, driverID)
+			if err != nil {
+				return fmt.Errorf("failed to get driver: %w", err)
+			}
+			if len(driver.VehicleIDs) == 0 {
+				return fmt.Errorf("driver has no registered vehicle")
+			}
+			vehicleID = driver.VehicleIDs[0]
+		}
+
+		if ride, err = s.rideService.AcceptRide(ctx, rideID, driverID, vehicleID); err != nil {
+			return err
+		}
+
+		if err := s.driverRepo.UpdateAvailability(ctx, driverID, false); err != nil {
+			s.logger.WithError(err).WithField("driver_id", driverID.Hex()).Warn("Failed to mark driver unavailable")
+		}
+
+		if err := s.rideService.RecordPickupETA(ctx, rideID, offer.Candidate.ETAMinutes); err != nil {
+			s.logger.WithError(err).WithRideID(rideID).Warn("Failed to record pickup ETA")
+		}
+		ride.PickupETA = offer.Candidate.ETAMinutes
+
+		if offer.BonusAmount > 0 {
+			if err := s.rideService.RecordDriverBonus(ctx, rideID, offer.BonusAmount); err != nil {
+				s.logger.WithError(err).WithRideID(rideID).Error("Failed to record driver bonus")
+			}
+			ride.DriverBonus = offer.BonusAmount
+		}
+
+		state.Offer = nil
+		state.Response = &offerResponse{DriverID: driverID, Accepted: true}
+		return nil
+	})
+	if err != nil && ride != nil {
+		// The ride is the driver's; the dispatch will withdraw the offer and
+		// find the ride already taken
+		s.logger.WithError(err).WithRideID(rideID).Error("Ride accepted but the dispatch was not told")
+		return ride, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return ride, nil
+}
+
+func (s *matchingService) RejectOffer(ctx context.Context, rideID, driverID primitive.ObjectID, reason string) error {
+	return s.updateDispatch(ctx, rideID, func(state *dispatchState) error {
+		if _, err := heldOffer(state, driverID); err != nil {
+			return err
+		}
+
+		state.Offer = nil
+		state.Response = &offerResponse{DriverID: driverID, Reason: reason}
+		return nil
+	})
+}
+
+// Candidate Ranking
+func (s *matchingService) RankCandidates(ctx context.Context, request *models.RideRequest, radiusKM float64) ([]*DriverCandidate, error) {
+	nearby, err := s.cache.GetNearbyDrivers(ctx, &request.PickupLocation, radiusKM, "km")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get nearby drivers: %w", err)
+	}
+
+	excluded := make(map[primitive.ObjectID]bool)
+	for _, id := range request.RequestedDrivers {
+		excluded[id] = true
+	}
+	for _, id := range request.RejectedDrivers {
+		excluded[id] = true
+	}
+
+	maxETA := utils.EstimateETAMinutes(radiusKM, s.config.AverageSpeedKMH)
+	if maxETA < 1 {
+		maxETA = 1
+	}
+
+	var candidates []*DriverCandidate
+	for _, location := range nearby {
+		if excluded[location.DriverID] {
+			continue
+		}
+
+		driver, err := s.driverRepo.GetByID(ctx, location.DriverID)
+		if err != nil || driver == nil {
+			continue
+		}
+		if !driver.IsAvailable || driver.Status != models.DriverStatusOnline {
+			continue
+		}
+
+		candidates = append(candidates, s.newDriverCandidate(driver, location, maxETA))
+		request.NearbyDrivers = appendUniqueObjectID(request.NearbyDrivers, driver.ID)
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].Score > candidates[j].Score
+	})
+
+	return candidates, nil
+}
+
+// Batch Assignment
+func (s *matchingService) SetBatchMode(ctx context.Context, city string, enabled bool) error {
+	if city == "" {
+		return fmt.Errorf("city is required")
+	}
+
+	if err := s.cache.Set(ctx, batchModeCacheKey(city), enabled, 0); err != nil {
+		return fmt.Errorf("failed to set batch mode: %w", err)
+	}
+
+	s.logger.WithField("city", city).
+		WithField("enabled", enabled).
+		Info("Batch dispatch mode updated")
+
+	return nil
+}
+
+func (s *matchingService) IsBatchModeEnabled(ctx context.Context, city string) bool {
+	if city == "" {
+		return false
+	}
+
+	// Runtime overrides take precedence over the configured city list
+	var enabled bool
+	if err := s.cache.Get(ctx, batchModeCacheKey(city), &enabled); err == nil {
+		return enabled
+	}
+
+	for _, batchCity := range s.config.BatchCities {
+		if strings.EqualFold(strings.TrimSpace(batchCity), city) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (s *matchingService) GetDispatchMetrics(ctx context.Context, city string) (*DispatchMetrics, error) {
+	metrics := &DispatchMetrics{
+		City:       city,
+		Sequential: s.getModeMetrics(ctx, city, DispatchModeSequential),
+		Batch:      s.getModeMetrics(ctx, city, DispatchModeBatch),
+	}
+
+	if metrics.Sequential.Assignments > 0 && metrics.Batch.Assignments > 0 {
+		metrics.ETAImprovement = metrics.Sequential.AveragePickupETA - metrics.Batch.AveragePickupETA
+	}
+
+	return metrics, nil
+}
+
+// Helper methods
+
+// runDispatch offers the ride to one ranked candidate at a time, widening the
+// search radius once a radius is exhausted, until a driver accepts or the
+// request expires.
+func (s *matchingService) runDispatch(session *dispatchSession) {
+	defer s.endDispatch(session)
+
+	ctx := session.ctx
+	request := session.request
+	radius := s.config.InitialRadiusKM
+
+	for ctx.Err() == nil {
+		radius = s.applyEscalation(ctx, session, radius)
+
+		candidates, err := s.RankCandidates(ctx, request, radius)
+		if err != nil {
+			s.logger.WithError(err).WithRideID(request.ID).Warn("Failed to rank dispatch candidates")
+		}
+
+		s.notifyRider(request, DispatchEventSearching, map[string]interface{}{
+			"radius_km":  radius,
+			"candidates": len(candidates),
+		})
+
+		offers := 0
+		for _, candidate := range candidates {
+			if offers >= s.config.MaxOffersPerRadius {
+				break
+			}
+
+			switch s.offerToDriver(ctx, session, candidate) {
+			case offerAccepted:
+				s.completeDispatch(session, candidate)
+				return
+			case offerAborted:
+				s.finishDispatch(session, ctx.Err())
+				return
+			case offerSkipped:
+				continue
+			}
+			offers++
+		}
+
+		if radius < s.config.MaxRadiusKM {
+			radius = utils.MinFloat64(radius+s.config.RadiusStepKM, s.config.MaxRadiusKM)
+			s.notifyRider(request, DispatchEventRadiusWidened, map[string]interface{}{
+				"radius_km": radius,
+			})
+			continue
+		}
+
+		if offers == 0 {
+			// Nobody left to ask at the widest radius; wait for drivers to come online
+			select {
+			case <-ctx.Done():
+			case <-time.After(s.config.OfferTimeout):
+			}
+		}
+	}
+
+	s.finishDispatch(session, ctx.Err())
+}
+
+// enqueueBatch holds a request until the city's batch window closes. The first
+// request in an empty window schedules the flush.
+func (s *matchingService) enqueueBatch(session *dispatchSession) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	city := session.city
+	s.batches[city] = append(s.batches[city], session)
+	if len(s.batches[city]) == 1 {
+		time.AfterFunc(s.config.BatchWindow, func() {
+			s.flushBatch(city)
+		})
+	}
+}
+
+func (s *matchingService) flushBatch(city string) {
+	s.mutex.Lock()
+	sessions := s.batches[city]
+	delete(s.batches, city)
+	s.mutex.Unlock()
+
+	if len(sessions) < s.config.MinBatchSize {
+		s.fallBackToSequential(sessions...)
+		return
+	}
+
+	s.assignBatch(city, sessions)
+}
+
+// assignBatch pairs the batched requests with available drivers so that the
+// total pickup ETA is minimal, then offers each ride to its assigned driver.
+// Requests left without a feasible driver continue with sequential offers.
+func (s *matchingService) assignBatch(city string, sessions []*dispatchSession) {
+	ctx := context.Background()
+
+	available, err := s.getAvailableDrivers(ctx)
+	if err != nil {
+		s.logger.WithError(err).WithField("city", city).Warn("Failed to load drivers for batch, falling back to sequential dispatch")
+		s.fallBackToSequential(sessions...)
+		return
+	}
+
+	maxETA := utils.EstimateETAMinutes(s.config.MaxRadiusKM, s.config.AverageSpeedKMH)
+	var drivers []*models.Driver
+	driverColumns := make(map[primitive.ObjectID]int)
+	rowCandidates := make([]map[primitive.ObjectID]*DriverCandidate, len(sessions))
+
+	for i, session := range sessions {
+		rowCandidates[i] = make(map[primitive.ObjectID]*DriverCandidate)
+
+		nearby, err := s.cache.GetNearbyDrivers(ctx, &session.request.PickupLocation, s.config.MaxRadiusKM, "km")
+		if err != nil {
+			s.logger.WithError(err).WithRideID(session.request.ID).Warn("Failed to get nearby drivers for batch")
+			continue
+		}
+
+		for _, location := range nearby {
+			driver, exists := available[location.DriverID]
+			if !exists {
+				continue
+			}
+
+			if _, exists := driverColumns[driver.ID]; !exists {
+				driverColumns[driver.ID] = len(drivers)
+				drivers = append(drivers, driver)
+			}
+			rowCandidates[i][driver.ID] = s.newDriverCandidate(driver, location, maxETA)
+			session.request.NearbyDrivers = appendUniqueObjectID(session.request.NearbyDrivers, driver.ID)
+		}
+	}
+
+	cost := make([][]float64, len(sessions))
+	for i := range sessions {
+		cost[i] = make([]float64, len(drivers))
+		for j, driver := range drivers {
+			cost[i][j] = utils.AssignmentInfeasibleCost
+			if candidate, exists := rowCandidates[i][driver.ID]; exists {
+				cost[i][j] = candidate.DistanceKM / s.config.AverageSpeedKMH * 60
+			}
+		}
+	}
+
+	assignment := utils.SolveAssignment(cost)
+
+	assigned := 0
+	totalETA := 0
+	for i, session := range sessions {
+		if assignment[i] < 0 {
+			s.fallBackToSequential(session)
+			continue
+		}
+
+		candidate := rowCandidates[i][drivers[assignment[i]].ID]
+		assigned++
+		totalETA += candidate.ETAMinutes
+		go s.runBatchOffer(session, candidate)
+	}
+
+	s.logger.WithField("city", city).
+		WithField("requests", len(sessions)).
+		WithField("drivers", len(drivers)).
+		WithField("assigned", assigned).
+		WithField("total_pickup_eta", totalETA).
+		Info("Batch dispatch solved")
+}
+
+// runBatchOffer offers a ride to the driver chosen by the batch solver. If that
+// driver declines or times out the ride carries on with sequential offers.
+func (s *matchingService) runBatchOffer(session *dispatchSession, candidate *DriverCandidate) {
+	switch s.offerToDriver(session.ctx, session, candidate) {
+	case offerAccepted:
+		s.completeDispatch(session, candidate)
+		s.endDispatch(session)
+		return
+	case offerAborted:
+		s.finishDispatch(session, session.ctx.Err())
+		s.endDispatch(session)
+		return
+	}
+
+	s.fallBackToSequential(session)
+}
+
+func (s *matchingService) fallBackToSequential(sessions ...*dispatchSession) {
+	for _, session := range sessions {
+		session.mode = DispatchModeSequential
+		go s.runDispatch(session)
+	}
+}
+
+func (s *matchingService) getAvailableDrivers(ctx context.Context) (map[primitive.ObjectID]*models.Driver, error) {
+	available := make(map[primitive.ObjectID]*models.Driver)
+	params := &utils.PaginationParams{
+		Page:     1,
+		PageSize: utils.Min(s.config.MaxBatchDrivers, utils.MaxPageSize),
+	}
+
+	for len(available) < s.config.MaxBatchDrivers {
+		drivers, total, err := s.driverRepo.GetAvailableDrivers(ctx, params)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get available drivers: %w", err)
+		}
+
+		for _, driver := range drivers {
+			available[driver.ID] = driver
+		}
+
+		if len(drivers) == 0 || int64(params.Page*params.PageSize) >= total {
+			break
+		}
+		params.Page++
+	}
+
+	return available, nil
+}
+
+func (s *matchingService) completeDispatch(session *dispatchSession, candidate *DriverCandidate) {
+	request := session.request
+
+	s.notifyRider(request, DispatchEventDriverFound, map[string]interface{}{
+		"driver_id":   candidate.DriverID.Hex(),
+		"eta_minutes": candidate.ETAMinutes,
+	})
+	s.wsHandler.SendDriverBroadcast(DispatchEventOfferClosed, map[string]interface{}{
+		"ride_id": request.ID.Hex(),
+	})
+
+	s.recordPickupETA(session.city, session.mode, candidate.ETAMinutes)
+}
+
+func (s *matchingService) recordPickupETA(city, mode string, etaMinutes int) {
+	ctx := context.Background()
+	key := dispatchMetricsCacheKey(city, mode)
+
+	if _, err := s.cache.Increment(ctx, key+":count", 1, 0); err != nil {
+		s.logger.WithError(err).WithField("mode", mode).Warn("Failed to record dispatch metric")
+		return
+	}
+	s.cache.Increment(ctx, key+":eta_minutes", int64(etaMinutes), 0)
+}
+
+func (s *matchingService) getModeMetrics(ctx context.Context, city, mode string) DispatchModeMetrics {
+	key := dispatchMetricsCacheKey(city, mode)
+
+	var count, etaMinutes int64
+	s.cache.Get(ctx, key+":count", &count)
+	s.cache.Get(ctx, key+":eta_minutes", &etaMinutes)
+
+	metrics := DispatchModeMetrics{Assignments: count}
+	if count > 0 {
+		metrics.AveragePickupETA = float64(etaMinutes) / float64(count)
+	}
+
+	return metrics
+}
+
+func (s *matchingService) newDriverCandidate(driver *models.Driver, location *DriverLocationData, maxETA int) *DriverCandidate {
+	candidate := &DriverCandidate{
+		DriverID:       driver.ID,
+		UserID:         driver.UserID,
+		Location:       location.Location,
+		DistanceKM:     location.Distance,
+		ETAMinutes:     utils.EstimateETAMinutes(location.Distance, s.config.AverageSpeedKMH),
+		Rating:         driver.Rating,
+		AcceptanceRate: driver.AcceptanceRate,
+	}
+	candidate.Score = s.scoreCandidate(candidate, driver.TotalRatings, maxETA)
+
+	return candidate
+}
+
+func (s *matchingService) offerToDriver(ctx context.Context, session *dispatchSession, candidate *DriverCandidate) offerOutcome {
+	request := session.request
+
+	// A driver can only hold one offer at a time across all dispatches
+	reservationKey := fmt.Sprintf("driver_offer:%s", candidate.DriverID.Hex())
+	reserved, err := s.cache.SetNX(ctx, reservationKey, request.ID.Hex(), s.config.OfferTimeout)
+	if err != nil || !reserved {
+		return offerSkipped
+	}
+	defer s.cache.Delete(context.Background(), reservationKey)
+
+	offerExpiresAt := time.Now().Add(s.config.OfferTimeout)
+
+	var cancelled bool
+	if err := s.updateDispatch(ctx, request.ID, func(state *dispatchState) error {
+		if cancelled = state.Cancelled; cancelled {
+			return nil
+		}
+		state.Offer = &dispatchOffer{Candidate: candidate, BonusAmount: session.bonusAmount}
+		state.Response = nil
+		return nil
+	}); err != nil {
+		s.logger.WithError(err).WithRideID(request.ID).WithField("driver_id", candidate.DriverID.Hex()).Warn("Failed to record ride offer")
+		return offerSkipped
+	}
+	if cancelled {
+		session.cancel()
+		return offerAborted
+	}
+
+	request.RequestedDrivers = append(request.RequestedDrivers, candidate.DriverID)
+	request.UpdatedAt = time.Now()
+	s.persistRideRequest(request)
+
+	s.wsHandler.SendUserNotification(candidate.UserID, DispatchEventOffer, map[string]interface{}{
+		"ride_id":          request.ID.Hex(),
+		"ride_type":        request.RideType,
+		"pickup_location":  request.PickupLocation,
+		"dropoff_location": request.DropoffLocation,
+		"estimated_fare":   request.EstimatedFare,
+		"surge_multiplier": request.SurgeMultiplier,
+		"distance_km":      candidate.DistanceKM,
+		"eta_minutes":      candidate.ETAMinutes,
+		"bonus_amount":     session.bonusAmount,
+		"offer_expires_at": offerExpiresAt,
+	})
+
+	timer := time.NewTimer(s.config.OfferTimeout)
+	defer timer.Stop()
+	ticker := time.NewTicker(dispatchPollInterval)
+	defer ticker.Stop()
+
+	// The driver may answer on any instance, so the answer is polled from the
+	// dispatch state until the offer times out or the dispatch ends
+	var response *offerResponse
+	aborted := false
+wait:
+	for {
+		select {
+		case <-ticker.C:
+			if response = s.offerResponse(ctx, request.ID, candidate.DriverID); response != nil {
+				break wait
+			}
+		case <-timer.C:
+			response = s.withdrawOffer(request.ID, candidate.DriverID)
+			break wait
+		case <-ctx.Done():
+			aborted = true
+			response = s.withdrawOffer(request.ID, candidate.DriverID)
+			break wait
+		}
+	}
+
+	switch {
+	case response != nil && response.Accepted:
+		return offerAccepted
+	case response != nil:
+		s.recordRejection(session, response.DriverID, response.Reason)
+		return offerRejected
+	case aborted:
+		s.wsHandler.SendUserNotification(candidate.UserID, DispatchEventOfferClosed, map[string]interface{}{
+			"ride_id": request.ID.Hex(),
+		})
+		return offerAborted
+	}
+
+	s.recordRejection(session, candidate.DriverID, offerTimeoutReason)
+	s.wsHandler.SendUserNotification(candidate.UserID, DispatchEventOfferTimeout, map[string]interface{}{
+		"ride_id": request.ID.Hex(),
+	})
+	s.notifyRider(request, DispatchEventOfferTimeout, map[string]interface{}{
+		"drivers_asked": len(request.RequestedDrivers),
+	})
+	return offerTimedOut
+}
+
+// offerResponse returns the driver's answer to their offer, if they have
+// given one.
+func (s *matchingService) offerResponse(ctx context.Context, rideID, driverID primitive.ObjectID) *offerResponse {
+	var state dispatchState
+	if err := s.cache.Get(ctx, dispatchStateCacheKey(rideID), &state); err != nil {
+		return nil
+	}
+	if state.Response == nil || state.Response.DriverID != driverID {
+		return nil
+	}
+	return state.Response
+}
+
+// withdrawOffer takes back the driver's offer if it is still outstanding. A
+// driver who answered while it was being withdrawn keeps their answer, which
+// is returned.
+func (s *matchingService) withdrawOffer(rideID, driverID primitive.ObjectID) *offerResponse {
+	var response *offerResponse
+	err := s.updateDispatch(context.Background(), rideID, func(state *dispatchState) error {
+		if state.Response != nil && state.Response.DriverID == driverID {
+			response = state.Response
+			return nil
+		}
+		if state.Offer != nil && state.Offer.Candidate.DriverID == driverID {
+			state.Offer = nil
+		}
+		return nil
+	})
+	if err != nil {
+		s.logger.WithError(err).WithRideID(rideID).WithField("driver_id", driverID.Hex()).Warn("Failed to withdraw ride offer")
+	}
+	return response
+}
+
+func (s *matchingService) recordRejection(session *dispatchSession, driverID primitive.ObjectID, reason string) {
+	request := session.request
+	request.RejectedDrivers = appendUniqueObjectID(request.RejectedDrivers, driverID)
+	request.UpdatedAt = time.Now()
+	s.persistRideRequest(request)
+
+	s.logger.WithRideID(request.ID).
+		WithField("driver_id", driverID.Hex()).
+		WithField("reason", reason).
+		Info("Ride offer declined")
+}
+
+// finishDispatch handles a dispatch that ended without a driver. A deadline
+// means the request expired and the ride is cancelled on the rider's behalf;
+// an explicit cancellation leaves the ride to whoever cancelled the dispatch.
+func (s *matchingService) finishDispatch(session *dispatchSession, cause error) {
+	request := session.request
+	ctx := context.Background()
+
+	request.UpdatedAt = time.Now()
+	s.persistRideRequest(request)
+
+	if cause != context.DeadlineExceeded {
+		s.logger.WithRideID(request.ID).Info("Driver dispatch cancelled")
+		return
+	}
+
+	// A driver whose acceptance never reached the dispatch still has the ride
+	if ride, err := s.rideService.GetRide(ctx, request.ID); err == nil && ride.Status != models.RideStatusRequested {
+		return
+	}
+
+	if _, err := s.rideService.CancelRide(ctx, request.ID, session.expiryReason, CancelledBySystem); err != nil {
+		s.logger.WithError(err).WithRideID(request.ID).Warn("Failed to cancel expired ride request")
+	}
+
+	s.notifyRider(request, DispatchEventExpired, map[string]interface{}{
+		"reason":        session.expiryReason,
+		"drivers_asked": len(request.RequestedDrivers),
+	})
+
+	s.logger.WithRideID(request.ID).
+		WithField("drivers_asked", len(request.RequestedDrivers)).
+		Warn("Ride request expired without a driver")
+}
+
+// applyEscalation picks up an escalation recorded for the ride and returns the
+// radius the next search round should use.
+func (s *matchingService) applyEscalation(ctx context.Context, session *dispatchSession, radius float64) float64 {
+	var escalation DispatchEscalation
+	if err := s.cache.Get(ctx, dispatchEscalationCacheKey(session.request.ID), &escalation); err != nil {
+		return radius
+	}
+
+	if escalation.BonusAmount == session.bonusAmount && escalation.RadiusKM <= radius {
+		return radius
+	}
+
+	session.bonusAmount = escalation.BonusAmount
+	if escalation.RadiusKM > radius {
+		radius = escalation.RadiusKM
+	}
+
+	s.notifyRider(session.request, DispatchEventEscalated, map[string]interface{}{
+		"radius_km":    radius,
+		"bonus_amount": escalation.BonusAmount,
+	})
+
+	return radius
+}
+
+func (s *matchingService) scoreCandidate(candidate *DriverCandidate, totalRatings int64, maxETA int) float64 {
+	etaScore := 1 - utils.MinFloat64(float64(candidate.ETAMinutes)/float64(maxETA), 1)
+
+	// Unrated drivers get a neutral rating so they are not starved of offers
+	ratingScore := 0.5
+	if totalRatings > 0 {
+		ratingScore = candidate.Rating / utils.MaxDriverRating
+	}
+
+	acceptanceScore := utils.MaxFloat64(0, utils.MinFloat64(candidate.AcceptanceRate, 1))
+
+	return s.config.ETAWeight*etaScore +
+		s.config.RatingWeight*ratingScore +
+		s.config.AcceptanceWeight*acceptanceScore
+}
+
+func (s *matchingService) notifyRider(request *models.RideRequest, eventType string, data map[string]interface{}) {
+	data["ride_id"] = request.ID.Hex()
+	data["expires_at"] = request.ExpiresAt
+	s.wsHandler.SendUserNotification(request.RiderID, eventType, data)
+}
+
+func (s *matchingService) saveRideRequest(ctx context.Context, request *models.RideRequest) error {
+	if err := s.cache.Set(ctx, rideRequestCacheKey(request.ID), request, dispatchTTL(request.ExpiresAt)); err != nil {
+		return fmt.Errorf("failed to save ride request: %w", err)
+	}
+	return nil
+}
+
+func (s *matchingService) persistRideRequest(request *models.RideRequest) {
+	if err := s.saveRideRequest(context.Background(), request); err != nil {
+		s.logger.WithError(err).WithRideID(request.ID).Warn("Failed to persist ride request")
+	}
+}
+
+// updateDispatch applies update to the ride's dispatch state under the
+// dispatch lock and saves it. An update that fails leaves the state as it was.
+func (s *matchingService) updateDispatch(ctx context.Context, rideID primitive.ObjectID, update func(state *dispatchState) error) error {
+	lock, err := s.lockDispatch(ctx, rideID)
+	if err != nil {
+		return fmt.Errorf("failed to lock dispatch: %w", err)
+	}
+	defer s.cache.Unlock(context.Background(), lock)
+
+	var state dispatchState
+	if err := s.cache.Get(ctx, dispatchStateCacheKey(rideID), &state); err != nil {
+		return fmt.Errorf("no active dispatch for ride")
+	}
+
+	if err := update(&state); err != nil {
+		return err
+	}
+
+	if err := s.cache.Set(ctx, dispatchStateCacheKey(rideID), &state, dispatchTTL(state.ExpiresAt)); err != nil {
+		return fmt.Errorf("failed to save dispatch: %w", err)
+	}
+	return nil
+}
+
+// lockDispatch takes the ride's dispatch lock, waiting while another instance
+// holds it until that lock would have expired.
+func (s *matchingService) lockDispatch(ctx context.Context, rideID primitive.ObjectID) (*DistributedLock, error) {
+	deadline := time.Now().Add(dispatchLockTTL)
+	for {
+		lock, err := s.cache.Lock(ctx, dispatchLockKey(rideID), dispatchLockTTL)
+		if err == nil || time.Now().After(deadline) {
+			return lock, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(dispatchPollInterval / 5):
+		}
+	}
+}
+
+// watchDispatch stops the session once its dispatch is cancelled, which may
+// happen on any instance.
+func (s *matchingService) watchDispatch(session *dispatchSession) {
+	ticker := time.NewTicker(dispatchPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-session.ctx.Done():
+			return
+		case <-ticker.C:
+			var state dispatchState
+			if err := s.cache.Get(session.ctx, dispatchStateCacheKey(session.request.ID), &state); err == nil && state.Cancelled {
+				session.cancel()
+				return
+			}
+		}
+	}
+}
+
+func (s *matchingService) endDispatch(session *dispatchSession) {
+	session.cancel()
+	if err := s.cache.Delete(context.Background(), dispatchStateCacheKey(session.request.ID)); err != nil {
+		s.logger.WithError(err).WithRideID(session.request.ID).Warn("Failed to clear dispatch state")
+	}
+}
+
+// heldOffer returns the offer the driver holds, or an error when the offer
+// has been settled or the dispatch cancelled.
+func heldOffer(state *dispatchState, driverID primitive.ObjectID) (*dispatchOffer, error) {
+	if state.Cancelled || state.Offer == nil || state.Offer.Candidate.DriverID != driverID {
+		return nil, fmt.Errorf("offer is no longer available")
+	}
+	return state.Offer, nil
+}
+
+// dispatchTTL keeps dispatch records a while past the request's expiry.
+func dispatchTTL(expiresAt time.Time) time.Duration {
+	return time.Until(expiresAt) + utils.RideRequestTimeout
+}
+
+func rideRequestCacheKey(rideID primitive.ObjectID) string {
+	return fmt.Sprintf("ride_request:%s", rideID.Hex())
+}
+
+func dispatchStateCacheKey(rideID primitive.ObjectID) string {
+	return fmt.Sprintf("dispatch_state:%s", rideID.Hex())
+}
+
+func dispatchLockKey(rideID primitive.ObjectID) string {
+	return fmt.Sprintf("dispatch:%s", rideID.Hex())
+}
+
+func dispatchEscalationCacheKey(rideID primitive.ObjectID) string {
+	return fmt.Sprintf("dispatch_escalation:%s", rideID.Hex())
+}
+
+func batchModeCacheKey(city string) string {
+	return fmt.Sprintf("dispatch_batch_mode:%s", strings.ToLower(city))
+}
+
+func dispatchMetricsCacheKey(city, mode string) string {
+	if city == "" {
+		city = "unknown"
+	}
+	return fmt.Sprintf("dispatch_metrics:%s:%s", strings.ToLower(city), mode)
+}
+
+func appendUniqueObjectID(ids []primitive.ObjectID, id primitive.ObjectID) []primitive.ObjectID {
+	for _, existing := range ids {
+		if existing == id {
+			return ids
+		}
+	}
+	return append(ids, id)
+}
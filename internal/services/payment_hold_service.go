@@ -0,0 +1,724 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"goride/internal/config"
+	"goride/internal/models"
+	"goride/internal/repositories/interfaces"
+	"goride/pkg/logger"
+	"goride/pkg/money"
+	"goride/pkg/payment"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type PaymentHoldService interface {
+	// Worker
+	Start(ctx context.Context)
+
+	// Holds
+	PlaceHold(ctx context.Context, ride *models.Ride) (*models.Payment, error)
+	GetHold(ctx context.Context, rideID primitive.ObjectID) (*models.Payment, error)
+	CaptureFare(ctx context.Context, ride *models.Ride) ([]*models.Payment, error)
+	CaptureCharge(ctx context.Context, rideID primitive.ObjectID, charge *models.Payment) ([]*models.Payment, error)
+	ReleaseHold(ctx context.Context, rideID primitive.ObjectID, reason string) error
+}
+
+// Reasons recorded on released holds
+const (
+	HoldReleaseRideCancelled = "ride_cancelled"
+	HoldReleaseNoShow        = "rider_no_show"
+	HoldReleaseFareSplit     = "fare_split"
+	HoldReleaseNoFare        = "no_fare"
+	HoldReleaseExpired       = "hold_expired"
+)
+
+const (
+	paymentHoldSweepLock  = "payment_holds:sweep"
+	paymentHoldLockPrefix = "payment_holds:ride:"
+	paymentHoldLockTTL    = 30 * time.Second
+	paymentHoldSweepBatch = 100
+)
+
+type paymentHoldService struct {
+	paymentRepo      interfaces.PaymentRepository
+	rideRepo         interfaces.RideRepository
+	riderRepo        interfaces.RiderRepository
+	driverRepo       interfaces.DriverRepository
+	walletService    WalletService
+	exchangeService  ExchangeRateService
+	fareSplitService FareSplitService
+	paymentProvider  payment.PaymentProvider
+	cache            CacheService
+	config           *config.PaymentHoldConfig
+	logger           *logger.Logger
+}
+
+func NewPaymentHoldService(
+	paymentRepo interfaces.PaymentRepository,
+	rideRepo interfaces.RideRepository,
+	riderRepo interfaces.RiderRepository,
+	driverRepo interfaces.DriverRepository,
+	walletService WalletService,
+	exchangeService ExchangeRateService,
+	fareSplitService FareSplitService,
+	paymentProvider payment.PaymentProvider,
+	cache CacheService,
+	config *config.PaymentHoldConfig,
+	logger *logger.Logger,
+) PaymentHoldService {
+	return &paymentHoldService{
+		paymentRepo:      paymentRepo,
+		rideRepo:         rideRepo,
+		riderRepo:        riderRepo,
+		driverRepo:       driverRepo,
+		walletService:    walletService,
+		exchangeService:  exchangeService,
+		fareSplitService: fareSplitService,
+		paymentProvider:  paymentProvider,
+		cache:            cache,
+		config:           config,
+		logger:           logger,
+	}
+}
+
+// Worker
+
+// Start sweeps open holds until the context is cancelled: holds on rides that
+// ended without being settled are captured or released, and holds close to
+// lapsing are released.
+func (s *paymentHoldService) Start(ctx context.Context) {
+	ticker := time.NewTicker(s.config.CheckInterval)
+	defer ticker.Stop()
+
+	s.logger.WithField("interval", s.config.CheckInterval.String()).Info("Payment hold worker started")
+
+	for {
+		select {
+		case <-ctx.Done():
+			s.logger.Info("Payment hold worker stopped")
+			return
+		case <-ticker.C:
+			lock, err := s.cache.Lock(ctx, paymentHoldSweepLock, s.config.CheckInterval)
+			if err != nil {
+				// Another instance holds the sweep
+				continue
+			}
+
+			if err := s.sweepHolds(ctx); err != nil {
+				s.logger.WithError(err).Error("Failed to sweep payment holds")
+			}
+
+			s.cache.Unlock(ctx, lock)
+		}
+	}
+}
+
+// Holds
+
+// PlaceHold authorizes the estimated fare, plus a buffer for the trip running
+// long, on the rider's default card. Riders without a card pay in cash and
+// get no hold, so nil is returned. Placing a hold twice returns the first.
+func (s *paymentHoldService) PlaceHold(ctx context.Context, ride *models.Ride) (*models.Payment, error) {
+	if hold, err := s.findHold(ctx, ride.ID); err != nil || hold != nil {
+		return hold, err
+	}
+
+	// Cash is paid to the driver and wallets are debited at completion, so
+	// only card rides have anything to hold
+	if ride.PaymentMethod == models.PaymentMethodCash || ride.PaymentMethod == models.PaymentMethodWallet {
+		return nil, nil
+	}
+
+	methodID, method, err := s.ridePaymentMethod(ctx, ride)
+	if err != nil {
+		return nil, err
+	}
+	if methodID == nil {
+		return nil, nil
+	}
+
+	amount := s.holdAmount(ride)
+	if !amount.IsPositive() {
+		return nil, fmt.Errorf("ride has no fare estimate to hold")
+	}
+
+	// Keyed by ride and card, so a retried hold is placed once
+	response, err := s.paymentProvider.Authorize(ctx, &payment.PaymentRequest{
+		PaymentMethodID: methodID.Hex(),
+		Amount:          amount,
+		Description:     "Ride fare hold",
+		CustomerID:      ride.RiderID.Hex(),
+		IdempotencyKey:  fmt.Sprintf("%s:hold:%s", ride.ID.Hex(), methodID.Hex()),
+		Metadata: map[string]interface{}{
+			"ride_id": ride.ID.Hex(),
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to authorize payment: %w", err)
+	}
+	if response.Status != payment.AuthorizationStatusAuthorized {
+		return nil, fmt.Errorf("payment method was declined: authorization %s", response.Status)
+	}
+
+	authorized := response.Amount
+	if !authorized.IsPositive() {
+		authorized = amount
+	}
+
+	now := time.Now()
+	hold := &models.Payment{
+		RideID:           ride.ID,
+		PayerID:          ride.RiderID,
+		PaymentMethodID:  *methodID,
+		PaymentMethod:    method,
+		PaymentType:      models.PaymentTypeRide,
+		Status:           models.PaymentStatusAuthorized,
+		Amount:           amount,
+		Currency:         amount.Currency,
+		AuthorizationID:  response.AuthorizationID,
+		AuthorizedAmount: authorized,
+		AuthorizedAt:     &now,
+	}
+	if err := s.paymentRepo.Create(ctx, hold); err != nil {
+		// Without a record nothing would ever release the hold
+		if _, voidErr := s.paymentProvider.Void(ctx, response.AuthorizationID); voidErr != nil {
+			s.logger.WithError(voidErr).WithRideID(ride.ID).
+				WithField("authorization_id", response.AuthorizationID).
+				Error("Failed to void unrecorded payment hold")
+		}
+		return nil, fmt.Errorf("failed to record payment hold: %w", err)
+	}
+
+	if err := s.rideRepo.Update(ctx, ride.ID, map[string]interface{}{
+		"payment_id": hold.ID,
+	}); err != nil {
+		s.logger.WithError(err).WithRideID(ride.ID).Warn("Failed to link payment hold to ride")
+	}
+	ride.PaymentID = &hold.ID
+
+	s.logger.WithRideID(ride.ID).
+		WithField("payment_id", hold.ID.Hex()).
+		WithField("amount", authorized.String()).
+		WithField("currency", authorized.Currency).
+		Info("Payment hold placed")
+
+	return hold, nil
+}
+
+func (s *paymentHoldService) GetHold(ctx context.Context, rideID primitive.ObjectID) (*models.Payment, error) {
+	hold, err := s.findHold(ctx, rideID)
+	if err != nil {
+		return nil, err
+	}
+	if hold == nil {
+		return nil, fmt.Errorf("no open payment hold for ride")
+	}
+	return hold, nil
+}
+
+// CaptureFare charges the final fare of a completed ride to its hold.
+func (s *paymentHoldService) CaptureFare(ctx context.Context, ride *models.Ride) ([]*models.Payment, error) {
+	charge, err := s.fareCharge(ctx, ride)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.CaptureCharge(ctx, ride.ID, charge)
+}
+
+// CaptureCharge captures a charge against the ride's hold. The charge carries
+// the amount and its breakdown, which are written onto the hold's payment.
+// When the charge is above the hold, the hold is raised first; if the provider
+// cannot raise it, the hold is captured in full and the rest charged to the
+// same card as a second payment. Whatever is not captured is released. Rides
+// without an open hold return nil.
+func (s *paymentHoldService) CaptureCharge(ctx context.Context, rideID primitive.ObjectID, charge *models.Payment) ([]*models.Payment, error) {
+	lock, err := s.cache.Lock(ctx, paymentHoldLockPrefix+rideID.Hex(), paymentHoldLockTTL)
+	if err != nil {
+		return nil, fmt.Errorf("payment hold is already being settled")
+	}
+	defer s.cache.Unlock(ctx, lock)
+
+	hold, err := s.findHold(ctx, rideID)
+	if err != nil || hold == nil {
+		return nil, err
+	}
+
+	if !charge.Amount.IsPositive() {
+		return nil, s.releaseHold(ctx, hold, HoldReleaseNoFare)
+	}
+
+	held := hold.AuthorizedAmount
+	over, err := charge.Amount.Compare(held)
+	if err != nil {
+		return nil, fmt.Errorf("charge does not match the hold currency: %w", err)
+	}
+	if over > 0 {
+		held = s.raiseHold(ctx, hold, charge.Amount)
+	}
+
+	captureAmount, err := money.Min(charge.Amount, held)
+	if err != nil {
+		return nil, err
+	}
+	remainder, err := charge.Amount.Sub(captureAmount)
+	if err != nil {
+		return nil, err
+	}
+
+	shares := []*models.Payment{charge}
+	if remainder.IsPositive() {
+		shares, err = allocatePayment(charge, []float64{float64(captureAmount.Amount), float64(remainder.Amount)})
+		if err != nil {
+			return nil, fmt.Errorf("failed to split charge over the hold: %w", err)
+		}
+	}
+
+	response, err := s.capture(ctx, hold, captureAmount)
+	if err != nil {
+		return nil, err
+	}
+	if response.Status == payment.AuthorizationStatusVoided {
+		return s.chargeLapsedHold(ctx, hold, charge)
+	}
+
+	captured := s.capturedPayment(hold, shares[0], response)
+	if err := s.exchangeService.SnapshotPayment(ctx, captured); err != nil {
+		s.logger.WithError(err).WithRideID(rideID).Warn("Payment hold captured without an exchange rate snapshot")
+	}
+	if err := s.paymentRepo.Update(ctx, hold.ID, capturedUpdates(captured)); err != nil {
+		return nil, fmt.Errorf("failed to record captured payment: %w", err)
+	}
+	s.recordInLedger(ctx, captured)
+
+	s.logger.WithRideID(rideID).
+		WithField("payment_id", captured.ID.Hex()).
+		WithField("amount", captureAmount.String()).
+		WithField("authorized", held.String()).
+		WithField("currency", captureAmount.Currency).
+		Info("Payment hold captured")
+
+	payments := []*models.Payment{captured}
+	if remainder.IsPositive() && captured.Status != models.PaymentStatusFailed {
+		extra, err := s.chargeRemainder(ctx, hold, shares[1], "Ride fare above the hold")
+		if err != nil {
+			return payments, err
+		}
+		payments = append(payments, extra)
+	}
+
+	return payments, nil
+}
+
+// ReleaseHold voids the ride's open hold so the rider's card is no longer
+// held. Rides without an open hold are left alone.
+func (s *paymentHoldService) ReleaseHold(ctx context.Context, rideID primitive.ObjectID, reason string) error {
+	lock, err := s.cache.Lock(ctx, paymentHoldLockPrefix+rideID.Hex(), paymentHoldLockTTL)
+	if err != nil {
+		return fmt.Errorf("payment hold is already being settled")
+	}
+	defer s.cache.Unlock(ctx, lock)
+
+	hold, err := s.findHold(ctx, rideID)
+	if err != nil || hold == nil {
+		return err
+	}
+
+	return s.releaseHold(ctx, hold, reason)
+}
+
+// Helper methods
+
+// ridePaymentMethod returns the card a ride is paid with: the one chosen at
+// booking, or the rider's default when the ride did not name one. The ID is
+// nil when the rider has no card to charge.
+func (s *paymentHoldService) ridePaymentMethod(ctx context.Context, ride *models.Ride) (*primitive.ObjectID, models.PaymentMethod, error) {
+	method := ride.PaymentMethod
+	if method == "" {
+		method = models.PaymentMethodCreditCard
+	}
+	if ride.PaymentMethodID != nil {
+		return ride.PaymentMethodID, method, nil
+	}
+
+	rider, err := s.riderRepo.GetByUserID(ctx, ride.RiderID)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to get rider: %w", err)
+	}
+	return rider.DefaultPaymentID, method, nil
+}
+
+// findHold returns the ride's open hold, or nil when it has none.
+func (s *paymentHoldService) findHold(ctx context.Context, rideID primitive.ObjectID) (*models.Payment, error) {
+	payments, err := s.paymentRepo.GetByRideID(ctx, rideID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get ride payments: %w", err)
+	}
+
+	var hold *models.Payment
+	for _, p := range payments {
+		if p.Status != models.PaymentStatusAuthorized {
+			continue
+		}
+		if hold == nil || p.CreatedAt.After(hold.CreatedAt) {
+			hold = p
+		}
+	}
+
+	return hold, nil
+}
+
+// holdAmount is the locked quote, or the estimate for rides booked without
+// one, raised by the configured buffer.
+func (s *paymentHoldService) holdAmount(ride *models.Ride) money.Money {
+	estimate := money.FromMajor(ride.EstimatedFare, ride.Currency)
+	if ride.FareQuote != nil && ride.FareQuote.Fare.IsPositive() {
+		estimate = ride.FareQuote.Fare
+	}
+
+	return estimate.Percent(100 + s.config.BufferPercent)
+}
+
+// raiseHold asks the provider to hold the full charge and returns what is
+// held afterwards. A refused raise leaves the hold as it was.
+func (s *paymentHoldService) raiseHold(ctx context.Context, hold *models.Payment, amount money.Money) money.Money {
+	response, err := s.paymentProvider.IncrementAuthorization(ctx, &payment.IncrementAuthorizationRequest{
+		AuthorizationID: hold.AuthorizationID,
+		Amount:          amount,
+	})
+	if err != nil || response.Status != payment.AuthorizationStatusAuthorized {
+		if err != nil && !errors.Is(err, payment.ErrIncrementNotSupported) {
+			s.logger.WithError(err).WithRideID(hold.RideID).Warn("Failed to raise payment hold")
+		}
+		return hold.AuthorizedAmount
+	}
+
+	// Some providers replace the authorization when raising it
+	hold.AuthorizationID = response.AuthorizationID
+	hold.AuthorizedAmount = amount
+	if err := s.paymentRepo.Update(ctx, hold.ID, map[string]interface{}{
+		"authorization_id":  hold.AuthorizationID,
+		"authorized_amount": hold.AuthorizedAmount,
+	}); err != nil {
+		s.logger.WithError(err).WithRideID(hold.RideID).Warn("Failed to record raised payment hold")
+	}
+
+	return amount
+}
+
+// capturedPayment is the hold's payment once captured: the charge's amount
+// and breakdown, paid with the hold's card.
+func (s *paymentHoldService) capturedPayment(hold, charge *models.Payment, response *payment.PaymentResponse) *models.Payment {
+	now := time.Now()
+
+	captured := *charge
+	captured.ID = hold.ID
+	captured.PayerID = hold.PayerID
+	captured.PaymentMethod = hold.PaymentMethod
+	captured.PaymentMethodID = hold.PaymentMethodID
+	captured.AuthorizationID = hold.AuthorizationID
+	captured.AuthorizedAmount = hold.AuthorizedAmount
+	captured.AuthorizedAt = hold.AuthorizedAt
+	captured.CreatedAt = hold.CreatedAt
+	captured.TransactionID = response.TransactionID
+	captured.ExternalID = response.TransactionID
+	captured.Status = providerPaymentStatus(response.Status)
+	switch captured.Status {
+	case models.PaymentStatusCompleted:
+		captured.ProcessedAt = &now
+	case models.PaymentStatusFailed:
+		captured.FailureReason = fmt.Sprintf("capture %s", response.Status)
+		captured.FailedAt = &now
+	}
+
+	return &captured
+}
+
+// capture captures the hold. A capture sent again after its answer was lost
+// finds the authorization closed, so the provider's record of what became of
+// it is returned instead: the capture that went through, or a voided hold.
+func (s *paymentHoldService) capture(ctx context.Context, hold *models.Payment, amount money.Money) (*payment.PaymentResponse, error) {
+	response, err := s.paymentProvider.Capture(ctx, &payment.CaptureRequest{
+		AuthorizationID: hold.AuthorizationID,
+		Amount:          amount,
+	})
+	if err == nil {
+		return response, nil
+	}
+	if !errors.Is(err, payment.ErrAuthorizationClosed) {
+		return nil, fmt.Errorf("failed to capture payment hold: %w", err)
+	}
+
+	response, err = s.paymentProvider.GetPayment(ctx, &payment.PaymentLookupRequest{
+		AuthorizationID: hold.AuthorizationID,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up closed payment hold: %w", err)
+	}
+	if response.Status != payment.AuthorizationStatusVoided && providerPaymentStatus(response.Status) != models.PaymentStatusCompleted {
+		return nil, fmt.Errorf("payment hold closed as %s", response.Status)
+	}
+
+	s.logger.WithRideID(hold.RideID).
+		WithField("payment_id", hold.ID.Hex()).
+		WithField("status", response.Status).
+		Warn("Payment hold was already closed at the provider")
+
+	return response, nil
+}
+
+// chargeLapsedHold records a hold the provider voided before it could be
+// captured, and charges the whole charge to the hold's card instead.
+func (s *paymentHoldService) chargeLapsedHold(ctx context.Context, hold, charge *models.Payment) ([]*models.Payment, error) {
+	if err := s.paymentRepo.Update(ctx, hold.ID, map[string]interface{}{
+		"status":         models.PaymentStatusVoided,
+		"failure_reason": HoldReleaseExpired,
+		"voided_at":      time.Now(),
+	}); err != nil {
+		return nil, fmt.Errorf("failed to record lapsed payment hold: %w", err)
+	}
+
+	extra, err := s.chargeRemainder(ctx, hold, charge, "Ride fare after the hold lapsed")
+	if err != nil {
+		return nil, err
+	}
+	return []*models.Payment{extra}, nil
+}
+
+// chargeRemainder charges the part of a charge the hold did not cover to the
+// hold's card. A declined charge is recorded as a failed payment and one the
+// provider did not answer stays pending until recovered.
+func (s *paymentHoldService) chargeRemainder(ctx context.Context, hold, share *models.Payment, description string) (*models.Payment, error) {
+	extra := *share
+	extra.ID = primitive.NilObjectID
+	extra.PayerID = hold.PayerID
+	extra.PaymentMethod = hold.PaymentMethod
+	extra.PaymentMethodID = hold.PaymentMethodID
+	extra.Status = models.PaymentStatusPending
+
+	if err := s.exchangeService.SnapshotPayment(ctx, &extra); err != nil {
+		s.logger.WithError(err).WithRideID(hold.RideID).Warn("Fare remainder charged without an exchange rate snapshot")
+	}
+
+	if err := sendPayment(ctx, s.paymentRepo, s.paymentProvider, s.logger, &extra, &payment.PaymentRequest{
+		PaymentMethodID: hold.PaymentMethodID.Hex(),
+		Amount:          extra.Amount,
+		Description:     description,
+		CustomerID:      hold.PayerID.Hex(),
+		Metadata: map[string]interface{}{
+			"ride_id":    hold.RideID.Hex(),
+			"payment_id": hold.ID.Hex(),
+		},
+	}); err != nil {
+		return nil, fmt.Errorf("failed to record fare remainder payment: %w", err)
+	}
+	s.recordInLedger(ctx, &extra)
+
+	if extra.Status == models.PaymentStatusFailed {
+		s.logger.WithRideID(hold.RideID).
+			WithField("payment_id", extra.ID.Hex()).
+			WithField("amount", extra.Amount.String()).
+			WithField("reason", extra.FailureReason).
+			Warn("Fare above the payment hold could not be charged")
+	}
+
+	return &extra, nil
+}
+
+func (s *paymentHoldService) releaseHold(ctx context.Context, hold *models.Payment, reason string) error {
+	if _, err := s.paymentProvider.Void(ctx, hold.AuthorizationID); err != nil {
+		return fmt.Errorf("failed to void payment hold: %w", err)
+	}
+
+	if err := s.paymentRepo.Update(ctx, hold.ID, map[string]interface{}{
+		"status":         models.PaymentStatusVoided,
+		"failure_reason": reason,
+		"voided_at":      time.Now(),
+	}); err != nil {
+		return fmt.Errorf("failed to record released payment hold: %w", err)
+	}
+
+	s.logger.WithRideID(hold.RideID).
+		WithField("payment_id", hold.ID.Hex()).
+		WithField("reason", reason).
+		Info("Payment hold released")
+
+	return nil
+}
+
+// fareCharge builds the ride payment for a completed ride from its itemized
+// fare, or from the final fare when it was not itemized.
+func (s *paymentHoldService) fareCharge(ctx context.Context, ride *models.Ride) (*models.Payment, error) {
+	charge := &models.Payment{
+		RideID:      ride.ID,
+		PayerID:     ride.RiderID,
+		PaymentType: models.PaymentTypeRide,
+	}
+	if ride.FareBreakdown != nil {
+		if err := ride.FareBreakdown.ApplyToPayment(charge); err != nil {
+			return nil, fmt.Errorf("failed to build ride payment: %w", err)
+		}
+	} else {
+		charge.Amount = money.FromMajor(ride.FinalFare, ride.Currency)
+		charge.Currency = ride.Currency
+	}
+
+	if ride.DriverID != nil {
+		driver, err := s.driverRepo.GetByID(ctx, *ride.DriverID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get driver: %w", err)
+		}
+		charge.PayeeID = driver.UserID
+	}
+
+	return charge, nil
+}
+
+func (s *paymentHoldService) recordInLedger(ctx context.Context, p *models.Payment) {
+	if p.Status != models.PaymentStatusCompleted {
+		return
+	}
+
+	if _, err := s.walletService.RecordPayment(ctx, p); err != nil {
+		s.logger.WithError(err).
+			WithRideID(p.RideID).
+			WithField("payment_id", p.ID.Hex()).
+			Error("Ride payment captured but not posted to the ledger")
+	}
+}
+
+// sweepHolds settles holds the ride lifecycle left open: the ride was
+// cancelled or completed but releasing or capturing failed, a split fare
+// still has unpaid shares, or the ride has run so long the hold is about to
+// lapse. A pooled ride is captured only once the pool has priced its share.
+func (s *paymentHoldService) sweepHolds(ctx context.Context) error {
+	now := time.Now()
+	holds, err := s.paymentRepo.GetAuthorizedPayments(ctx, now.Add(-s.config.GracePeriod), paymentHoldSweepBatch)
+	if err != nil {
+		return fmt.Errorf("failed to get open payment holds: %w", err)
+	}
+
+	for _, hold := range holds {
+		ride, err := s.rideRepo.GetByID(ctx, hold.RideID)
+		if err != nil {
+			s.logger.WithError(err).WithRideID(hold.RideID).Warn("Failed to get ride for payment hold")
+			continue
+		}
+
+		switch {
+		case ride.Status == models.RideStatusCancelled:
+			err = s.ReleaseHold(ctx, ride.ID, HoldReleaseRideCancelled)
+		case ride.Status == models.RideStatusNoShow:
+			err = s.ReleaseHold(ctx, ride.ID, HoldReleaseNoShow)
+		case ride.Status == models.RideStatusCompleted && ride.FareSplitID != nil:
+			err = s.settleSplitHold(ctx, ride, hold, now)
+		case ride.Status == models.RideStatusCompleted && isPooledRide(ride) && ride.FareBreakdown == nil:
+			continue // the meter fare is the whole pool's; wait for the share
+		case ride.Status == models.RideStatusCompleted:
+			_, err = s.CaptureFare(ctx, ride)
+		case hold.AuthorizedAt != nil && now.Sub(*hold.AuthorizedAt) > s.config.MaxAge:
+			err = s.ReleaseHold(ctx, ride.ID, HoldReleaseExpired)
+		}
+		if err != nil {
+			s.logger.WithError(err).
+				WithRideID(ride.ID).
+				WithField("payment_id", hold.ID.Hex()).
+				WithField("ride_status", ride.Status).
+				Error("Failed to settle payment hold")
+		}
+	}
+
+	return nil
+}
+
+// settleSplitHold settles a split fare again, which charges only the shares
+// not paid yet, and releases the hold once every share is paid. When the hold
+// is about to lapse, the shares that could not be charged are captured from
+// it instead; shares still waiting for the provider are left to settle on
+// their own.
+func (s *paymentHoldService) settleSplitHold(ctx context.Context, ride *models.Ride, hold *models.Payment, now time.Time) error {
+	split, err := s.fareSplitService.SettleSplit(ctx, ride.ID)
+	if err != nil {
+		return fmt.Errorf("failed to settle fare split: %w", err)
+	}
+	if split.Status == models.FareSplitStatusSettled {
+		return s.ReleaseHold(ctx, ride.ID, HoldReleaseFareSplit)
+	}
+	if hold.AuthorizedAt == nil || now.Sub(*hold.AuthorizedAt) <= s.config.MaxAge {
+		return nil
+	}
+
+	uncollected := money.Zero(split.Total.Currency)
+	for _, participant := range split.Participants {
+		if participant.Uncollected() {
+			if uncollected, err = uncollected.Add(participant.Share); err != nil {
+				return err
+			}
+		}
+	}
+	if !uncollected.IsPositive() {
+		return s.ReleaseHold(ctx, ride.ID, HoldReleaseExpired)
+	}
+
+	charge, err := s.fareCharge(ctx, ride)
+	if err != nil {
+		return err
+	}
+	charge.FareSplitID = &split.ID
+	if rest, err := charge.Amount.Sub(uncollected); err != nil {
+		return err
+	} else if rest.IsPositive() {
+		shares, err := allocatePayment(charge, []float64{float64(uncollected.Amount), float64(rest.Amount)})
+		if err != nil {
+			return fmt.Errorf("failed to allocate uncollected shares: %w", err)
+		}
+		charge = shares[0]
+	}
+
+	captured, err := s.CaptureCharge(ctx, ride.ID, charge)
+	if err != nil || len(captured) == 0 {
+		return err
+	}
+
+	_, err = s.fareSplitService.CoverUncollectedShares(ctx, ride.ID, captured[0])
+	return err
+}
+
+// capturedUpdates lists the fields a capture writes onto the hold's payment.
+func capturedUpdates(p *models.Payment) map[string]interface{} {
+	return map[string]interface{}{
+		"payee_id":           p.PayeeID,
+		"transaction_id":     p.TransactionID,
+		"external_id":        p.ExternalID,
+		"authorization_id":   p.AuthorizationID,
+		"authorized_amount":  p.AuthorizedAmount,
+		"payment_type":       p.PaymentType,
+		"status":             p.Status,
+		"amount":             p.Amount,
+		"currency":           p.Currency,
+		"base_fare":          p.BaseFare,
+		"distance_fare":      p.DistanceFare,
+		"time_fare":          p.TimeFare,
+		"surge_amount":       p.SurgeAmount,
+		"surcharges":         p.Surcharges,
+		"surcharge_amount":   p.SurchargeAmount,
+		"tip_amount":         p.TipAmount,
+		"tax_amount":         p.TaxAmount,
+		"tax_lines":          p.TaxLines,
+		"discount_amount":    p.DiscountAmount,
+		"platform_fee":       p.PlatformFee,
+		"driver_earnings":    p.DriverEarnings,
+		"promo_code":         p.PromoCode,
+		"failure_reason":     p.FailureReason,
+		"exchange_rate":      p.ExchangeRate,
+		"reporting_currency": p.ReportingCurrency,
+		"reporting_amount":   p.ReportingAmount,
+		"processed_at":       p.ProcessedAt,
+		"failed_at":          p.FailedAt,
+	}
+}
@@ -0,0 +1,414 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"goride/internal/config"
+	"goride/internal/models"
+	"goride/pkg/money"
+	"goride/pkg/payment"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type paymentHoldFixture struct {
+	service  *paymentHoldService
+	ride     *models.Ride
+	card     primitive.ObjectID
+	rides    *fakeRideRepo
+	riders   *fakeRiderRepo
+	payments *fakePaymentRepo
+	provider *fakeProvider
+	splits   *fakeFareSplits
+}
+
+// newPaymentHoldFixture sets up a $20 ride booked by a rider whose default
+// card is card. Holds carry a 20% buffer, so a hold on it is $24.
+func newPaymentHoldFixture(t *testing.T) *paymentHoldFixture {
+	t.Helper()
+
+	f := &paymentHoldFixture{
+		card:     primitive.NewObjectID(),
+		payments: newFakePaymentRepo(),
+		provider: newFakeProvider(),
+		splits:   &fakeFareSplits{},
+	}
+
+	f.ride = &models.Ride{
+		ID:            primitive.NewObjectID(),
+		RiderID:       primitive.NewObjectID(),
+		Status:        models.RideStatusAccepted,
+		EstimatedFare: 20,
+		Currency:      "USD",
+	}
+	stored := *f.ride
+	f.rides = &fakeRideRepo{rides: map[primitive.ObjectID]*models.Ride{f.ride.ID: &stored}}
+	f.riders = &fakeRiderRepo{riders: map[primitive.ObjectID]*models.Rider{
+		f.ride.RiderID: {UserID: f.ride.RiderID, DefaultPaymentID: &f.card},
+	}}
+
+	cfg := &config.PaymentHoldConfig{BufferPercent: 20, GracePeriod: time.Minute, MaxAge: 6 * 24 * time.Hour}
+	f.service = NewPaymentHoldService(f.payments, f.rides, f.riders, nil, &fakeWallet{}, fakeExchange{},
+		f.splits, f.provider, newFakeCache(), cfg, newTestLogger(t)).(*paymentHoldService)
+
+	return f
+}
+
+// placeHold places the ride's hold and backdates it by age.
+func (f *paymentHoldFixture) placeHold(t *testing.T, age time.Duration) *models.Payment {
+	t.Helper()
+
+	hold, err := f.service.PlaceHold(context.Background(), f.ride)
+	if err != nil || hold == nil {
+		t.Fatalf("PlaceHold() = %v, %v; want a hold", hold, err)
+	}
+	authorizedAt := time.Now().Add(-age)
+	f.payments.payments[hold.ID].AuthorizedAt = &authorizedAt
+	return hold
+}
+
+func TestPlaceHold(t *testing.T) {
+	chosen := primitive.NewObjectID()
+
+	tests := []struct {
+		name       string
+		method     models.PaymentMethod
+		methodID   *primitive.ObjectID
+		noCard     bool
+		wantHold   bool
+		wantCard   string // "default" or "chosen"
+		wantMethod models.PaymentMethod
+	}{
+		{
+			name:       "card ride is held on the rider's default card",
+			wantHold:   true,
+			wantCard:   "default",
+			wantMethod: models.PaymentMethodCreditCard,
+		},
+		{
+			name:       "ride booked with a card is held on that card",
+			method:     models.PaymentMethodDebitCard,
+			methodID:   &chosen,
+			wantHold:   true,
+			wantCard:   "chosen",
+			wantMethod: models.PaymentMethodDebitCard,
+		},
+		{
+			name:   "cash ride gets no hold",
+			method: models.PaymentMethodCash,
+		},
+		{
+			name:   "wallet ride gets no hold",
+			method: models.PaymentMethodWallet,
+		},
+		{
+			name:   "rider without a card gets no hold",
+			noCard: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newPaymentHoldFixture(t)
+			f.ride.PaymentMethod = tt.method
+			f.ride.PaymentMethodID = tt.methodID
+			if tt.noCard {
+				f.riders.riders[f.ride.RiderID].DefaultPaymentID = nil
+			}
+
+			hold, err := f.service.PlaceHold(context.Background(), f.ride)
+			if err != nil {
+				t.Fatalf("PlaceHold() error = %v", err)
+			}
+
+			if !tt.wantHold {
+				if hold != nil || len(f.provider.authorized) != 0 {
+					t.Errorf("PlaceHold() authorized %d holds, want none", len(f.provider.authorized))
+				}
+				return
+			}
+
+			card := f.card
+			if tt.wantCard == "chosen" {
+				card = chosen
+			}
+			if hold == nil {
+				t.Fatal("PlaceHold() = nil, want a hold")
+			}
+			if hold.Status != models.PaymentStatusAuthorized || hold.AuthorizedAmount.Amount != 2400 {
+				t.Errorf("hold = %s for %s, want authorized for 24.00", hold.Status, hold.AuthorizedAmount)
+			}
+			if hold.PaymentMethodID != card || hold.PaymentMethod != tt.wantMethod {
+				t.Errorf("hold is on %s (%s), want %s (%s)", hold.PaymentMethodID.Hex(), hold.PaymentMethod, card.Hex(), tt.wantMethod)
+			}
+			if linked := f.rides.rides[f.ride.ID].PaymentID; linked == nil || *linked != hold.ID {
+				t.Errorf("ride payment = %v, want the hold %s", linked, hold.ID.Hex())
+			}
+
+			if key := f.provider.authorized[0].IdempotencyKey; key != f.ride.ID.Hex()+":hold:"+card.Hex() {
+				t.Errorf("hold authorized with key %q, want one for the ride and card", key)
+			}
+
+			again, err := f.service.PlaceHold(context.Background(), f.ride)
+			if err != nil || again == nil || again.ID != hold.ID || len(f.provider.authorized) != 1 {
+				t.Errorf("second PlaceHold() = %v, %v after %d authorizations; want the first hold", again, err, len(f.provider.authorized))
+			}
+		})
+	}
+}
+
+func TestCaptureCharge(t *testing.T) {
+	tests := []struct {
+		name          string
+		charge        int64
+		raises        bool
+		captureStatus string
+		closed        string
+		wantCaptured  int64
+		wantPayments  []int64
+		wantStatuses  []models.PaymentStatus
+		wantHold      models.PaymentStatus
+		wantVoided    bool
+	}{
+		{
+			name:         "charge within the hold is captured",
+			charge:       2000,
+			wantCaptured: 2000,
+			wantPayments: []int64{2000},
+			wantStatuses: []models.PaymentStatus{models.PaymentStatusCompleted},
+		},
+		{
+			name:         "charge above the hold raises it",
+			charge:       3000,
+			raises:       true,
+			wantCaptured: 3000,
+			wantPayments: []int64{3000},
+			wantStatuses: []models.PaymentStatus{models.PaymentStatusCompleted},
+		},
+		{
+			name:         "charge above a hold that cannot be raised charges the rest",
+			charge:       3000,
+			wantCaptured: 2400,
+			wantPayments: []int64{2400, 600},
+			wantStatuses: []models.PaymentStatus{models.PaymentStatusCompleted, models.PaymentStatusCompleted},
+		},
+		{
+			name:          "declined capture charges nothing more",
+			charge:        3000,
+			captureStatus: "declined",
+			wantCaptured:  2400,
+			wantPayments:  []int64{2400},
+			wantStatuses:  []models.PaymentStatus{models.PaymentStatusFailed},
+		},
+		{
+			name:         "retried capture that already went through is recorded",
+			charge:       2000,
+			closed:       "succeeded",
+			wantCaptured: 2000,
+			wantPayments: []int64{2000},
+			wantStatuses: []models.PaymentStatus{models.PaymentStatusCompleted},
+		},
+		{
+			name:         "capture of a lapsed hold charges the card",
+			charge:       2000,
+			closed:       payment.AuthorizationStatusVoided,
+			wantCaptured: 2000,
+			wantPayments: []int64{2000},
+			wantStatuses: []models.PaymentStatus{models.PaymentStatusCompleted},
+			wantHold:     models.PaymentStatusVoided,
+		},
+		{
+			name:       "no fare releases the hold",
+			charge:     0,
+			wantVoided: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newPaymentHoldFixture(t)
+			f.provider.raises = tt.raises
+			f.provider.closed = tt.closed
+			if tt.captureStatus != "" {
+				f.provider.captureStatus = tt.captureStatus
+			}
+			hold := f.placeHold(t, 0)
+
+			charge := &models.Payment{
+				RideID:      f.ride.ID,
+				PayerID:     f.ride.RiderID,
+				PaymentType: models.PaymentTypeRide,
+				Amount:      money.New(tt.charge, "USD"),
+				Currency:    "USD",
+			}
+			payments, err := f.service.CaptureCharge(context.Background(), f.ride.ID, charge)
+			if err != nil {
+				t.Fatalf("CaptureCharge() error = %v", err)
+			}
+
+			if tt.wantVoided {
+				if stored := f.payments.payments[hold.ID]; stored.Status != models.PaymentStatusVoided || stored.FailureReason != HoldReleaseNoFare {
+					t.Errorf("hold = %s (%s), want voided (%s)", stored.Status, stored.FailureReason, HoldReleaseNoFare)
+				}
+				if len(payments) != 0 || len(f.provider.captures) != 0 {
+					t.Errorf("captured %d times, want none", len(f.provider.captures))
+				}
+				return
+			}
+
+			if len(f.provider.captures) != 1 || f.provider.captures[0].Amount.Amount != tt.wantCaptured {
+				t.Fatalf("captures = %v, want one of %d", f.provider.captures, tt.wantCaptured)
+			}
+			if len(payments) != len(tt.wantPayments) {
+				t.Fatalf("CaptureCharge() returned %d payments, want %d", len(payments), len(tt.wantPayments))
+			}
+			for i, p := range payments {
+				if p.Amount.Amount != tt.wantPayments[i] || p.Status != tt.wantStatuses[i] {
+					t.Errorf("payment %d = %s %s, want %d %s", i, p.Amount, p.Status, tt.wantPayments[i], tt.wantStatuses[i])
+				}
+				if p.PaymentMethodID != f.card {
+					t.Errorf("payment %d charged to %s, want the hold's card", i, p.PaymentMethodID.Hex())
+				}
+			}
+			wantHold := tt.wantHold
+			if wantHold == "" {
+				wantHold = tt.wantStatuses[0]
+			}
+			if stored := f.payments.payments[hold.ID]; stored.Status != wantHold {
+				t.Errorf("stored hold status = %s, want %s", stored.Status, wantHold)
+			}
+		})
+	}
+}
+
+func TestSweepHolds(t *testing.T) {
+	splitID := primitive.NewObjectID()
+
+	tests := []struct {
+		name        string
+		status      models.RideStatus
+		fareSplitID *primitive.ObjectID
+		split       fakeFareSplits
+		pooled      bool
+		share       *models.FareBreakdown
+		age         time.Duration
+		wantStatus  models.PaymentStatus
+		wantReason  string
+		wantCapture int64
+	}{
+		{
+			name:       "cancelled ride releases the hold",
+			status:     models.RideStatusCancelled,
+			age:        time.Hour,
+			wantStatus: models.PaymentStatusVoided,
+			wantReason: HoldReleaseRideCancelled,
+		},
+		{
+			name:       "no-show releases the hold",
+			status:     models.RideStatusNoShow,
+			age:        time.Hour,
+			wantStatus: models.PaymentStatusVoided,
+			wantReason: HoldReleaseNoShow,
+		},
+		{
+			name:        "completed ride captures the fare",
+			status:      models.RideStatusCompleted,
+			age:         time.Hour,
+			wantStatus:  models.PaymentStatusCompleted,
+			wantCapture: 1800,
+		},
+		{
+			name:       "pooled ride keeps the hold until its share is priced",
+			status:     models.RideStatusCompleted,
+			pooled:     true,
+			age:        time.Hour,
+			wantStatus: models.PaymentStatusAuthorized,
+		},
+		{
+			name:        "pooled ride captures its share",
+			status:      models.RideStatusCompleted,
+			pooled:      true,
+			share:       &models.FareBreakdown{Total: money.New(900, "USD")},
+			age:         time.Hour,
+			wantStatus:  models.PaymentStatusCompleted,
+			wantCapture: 900,
+		},
+		{
+			name:        "settled split releases the hold",
+			status:      models.RideStatusCompleted,
+			fareSplitID: &splitID,
+			split:       fakeFareSplits{status: models.FareSplitStatusSettled},
+			age:         time.Hour,
+			wantStatus:  models.PaymentStatusVoided,
+			wantReason:  HoldReleaseFareSplit,
+		},
+		{
+			name:        "open split keeps the hold",
+			status:      models.RideStatusCompleted,
+			fareSplitID: &splitID,
+			split:       fakeFareSplits{status: models.FareSplitStatusOpen},
+			age:         time.Hour,
+			wantStatus:  models.PaymentStatusAuthorized,
+		},
+		{
+			name:        "failed split settlement keeps the hold",
+			status:      models.RideStatusCompleted,
+			fareSplitID: &splitID,
+			split:       fakeFareSplits{err: errors.New("provider unavailable")},
+			age:         7 * 24 * time.Hour,
+			wantStatus:  models.PaymentStatusAuthorized,
+		},
+		{
+			name:       "ride in progress keeps a young hold",
+			status:     models.RideStatusInProgress,
+			age:        time.Hour,
+			wantStatus: models.PaymentStatusAuthorized,
+		},
+		{
+			name:       "ride in progress releases a hold about to lapse",
+			status:     models.RideStatusInProgress,
+			age:        7 * 24 * time.Hour,
+			wantStatus: models.PaymentStatusVoided,
+			wantReason: HoldReleaseExpired,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newPaymentHoldFixture(t)
+			*f.splits = tt.split
+			hold := f.placeHold(t, tt.age)
+
+			stored := f.rides.rides[f.ride.ID]
+			stored.Status = tt.status
+			stored.FareSplitID = tt.fareSplitID
+			stored.FinalFare = 18
+			if tt.pooled {
+				stored.IsShared = true
+				stored.SharedWith = []primitive.ObjectID{primitive.NewObjectID()}
+			}
+			if tt.share != nil {
+				stored.FareBreakdown = tt.share
+				stored.FinalFare = tt.share.Total.Float64()
+			}
+
+			if err := f.service.sweepHolds(context.Background()); err != nil {
+				t.Fatalf("sweepHolds() error = %v", err)
+			}
+
+			got := f.payments.payments[hold.ID]
+			if got.Status != tt.wantStatus || got.FailureReason != tt.wantReason {
+				t.Errorf("hold = %s (%q), want %s (%q)", got.Status, got.FailureReason, tt.wantStatus, tt.wantReason)
+			}
+			if tt.fareSplitID != nil && f.splits.settled != 1 {
+				t.Errorf("split settled %d times, want once", f.splits.settled)
+			}
+			if tt.wantCapture != 0 && (len(f.provider.captures) != 1 || f.provider.captures[0].Amount.Amount != tt.wantCapture) {
+				t.Errorf("captures = %v, want one of %d", f.provider.captures, tt.wantCapture)
+			}
+		})
+	}
+}
@@ -0,0 +1,263 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"goride/internal/config"
+	"goride/internal/models"
+	"goride/internal/repositories/interfaces"
+	"goride/pkg/logger"
+	"goride/pkg/payment"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type PaymentRecoveryService interface {
+	// Recovery
+	Start(ctx context.Context)
+	RecoverPayment(ctx context.Context, paymentID primitive.ObjectID) (*models.Payment, error)
+}
+
+const (
+	paymentRecoveryLock  = "payments:recovery"
+	paymentRecoveryBatch = 100
+)
+
+type paymentRecoveryService struct {
+	paymentRepo      interfaces.PaymentRepository
+	walletService    WalletService
+	fareSplitService FareSplitService
+	ridePassService  RidePassService
+	paymentProvider  payment.PaymentProvider
+	cache            CacheService
+	config           *config.RecoveryConfig
+	logger           *logger.Logger
+}
+
+func NewPaymentRecoveryService(
+	paymentRepo interfaces.PaymentRepository,
+	walletService WalletService,
+	fareSplitService FareSplitService,
+	ridePassService RidePassService,
+	paymentProvider payment.PaymentProvider,
+	cache CacheService,
+	config *config.RecoveryConfig,
+	logger *logger.Logger,
+) PaymentRecoveryService {
+	return &paymentRecoveryService{
+		paymentRepo:      paymentRepo,
+		walletService:    walletService,
+		fareSplitService: fareSplitService,
+		ridePassService:  ridePassService,
+		paymentProvider:  paymentProvider,
+		cache:            cache,
+		config:           config,
+		logger:           logger,
+	}
+}
+
+// Recovery
+
+// Start settles payments left pending because the provider's answer was lost,
+// until the context is cancelled.
+func (s *paymentRecoveryService) Start(ctx context.Context) {
+	ticker := time.NewTicker(s.config.Interval)
+	defer ticker.Stop()
+
+	s.logger.WithField("interval", s.config.Interval.String()).Info("Payment recovery worker started")
+
+	for {
+		select {
+		case <-ctx.Done():
+			s.logger.Info("Payment recovery worker stopped")
+			return
+		case <-ticker.C:
+			lock, err := s.cache.Lock(ctx, paymentRecoveryLock, s.config.Interval)
+			if err != nil {
+				// Another instance holds the run
+				continue
+			}
+
+			if err := s.recoverPending(ctx); err != nil {
+				s.logger.WithError(err).Error("Failed to recover pending payments")
+			}
+
+			s.cache.Unlock(ctx, lock)
+		}
+	}
+}
+
+// RecoverPayment asks the provider what became of a pending payment and
+// records the answer.
+func (s *paymentRecoveryService) RecoverPayment(ctx context.Context, paymentID primitive.ObjectID) (*models.Payment, error) {
+	p, err := s.paymentRepo.GetByID(ctx, paymentID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get payment: %w", err)
+	}
+	if p.Status != models.PaymentStatusPending {
+		return nil, fmt.Errorf("payment is %s, not pending", p.Status)
+	}
+	if p.IdempotencyKey == "" && p.TransactionID == "" {
+		return nil, fmt.Errorf("payment was not sent to a provider")
+	}
+
+	if err := s.recoverPayment(ctx, p); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Helper methods
+func (s *paymentRecoveryService) recoverPending(ctx context.Context) error {
+	payments, err := s.paymentRepo.GetPendingAttempts(ctx, time.Now().Add(-s.config.Delay), paymentRecoveryBatch)
+	if err != nil {
+		return fmt.Errorf("failed to get pending payments: %w", err)
+	}
+
+	for _, p := range payments {
+		if err := s.recoverPayment(ctx, p); err != nil {
+			s.logger.WithError(err).
+				WithField("payment_id", p.ID.Hex()).
+				Warn("Failed to recover pending payment")
+		}
+	}
+
+	return nil
+}
+
+// recoverPayment settles a pending payment to what the provider holds. A
+// payment the provider has never seen is failed once it is old enough that
+// the provider's search would have found it; until then it stays pending.
+func (s *paymentRecoveryService) recoverPayment(ctx context.Context, p *models.Payment) error {
+	now := time.Now()
+	response, err := s.paymentProvider.GetPayment(ctx, &payment.PaymentLookupRequest{
+		TransactionID:  p.TransactionID,
+		IdempotencyKey: p.IdempotencyKey,
+		CreatedAt:      p.CreatedAt.Unix(),
+	})
+	switch {
+	case errors.Is(err, payment.ErrPaymentNotFound):
+		if now.Sub(p.CreatedAt) < s.config.NotFoundAfter {
+			return nil
+		}
+		p.Status = models.PaymentStatusFailed
+		p.FailureReason = "payment never reached the provider"
+		p.FailedAt = &now
+	case err != nil:
+		return fmt.Errorf("failed to look up payment: %w", err)
+	default:
+		applyPaymentResult(p, response, nil, now)
+		if p.Status == models.PaymentStatusPending {
+			return nil
+		}
+	}
+
+	if err := s.paymentRepo.Update(ctx, p.ID, paymentResultUpdates(p)); err != nil {
+		return fmt.Errorf("failed to update payment: %w", err)
+	}
+
+	s.logger.WithField("payment_id", p.ID.Hex()).
+		WithField("status", string(p.Status)).
+		Info("Pending payment recovered")
+
+	if p.Status == models.PaymentStatusCompleted {
+		// Refused if the payment was already posted
+		if _, err := s.walletService.RecordPayment(ctx, p); err != nil {
+			s.logger.WithError(err).
+				WithField("payment_id", p.ID.Hex()).
+				Warn("Recovered payment not posted to the ledger")
+		}
+	}
+
+	settleDependents(ctx, s.fareSplitService, s.ridePassService, s.logger, p)
+	return nil
+}
+
+// sendPayment stores a charge as pending under its next attempt, sends it to
+// the provider with the attempt's idempotency key and records the answer on
+// it. An error is returned only when the charge cannot be stored, in which
+// case nothing was sent. If the answer cannot be saved the charge stays
+// pending and the recovery job settles it.
+func sendPayment(ctx context.Context, paymentRepo interfaces.PaymentRepository, provider payment.PaymentProvider, log *logger.Logger, charge *models.Payment, request *payment.PaymentRequest) error {
+	if err := paymentRepo.CreateAttempt(ctx, charge); err != nil {
+		return err
+	}
+
+	request.IdempotencyKey = charge.IdempotencyKey
+	response, err := provider.ProcessPayment(ctx, request)
+	applyPaymentResult(charge, response, err, time.Now())
+
+	if err := paymentRepo.Update(ctx, charge.ID, paymentResultUpdates(charge)); err != nil {
+		log.WithError(err).
+			WithField("payment_id", charge.ID.Hex()).
+			WithField("status", string(charge.Status)).
+			Error("Payment sent but its outcome not saved")
+	}
+
+	return nil
+}
+
+// settleDependents passes a payment that has left pending on to what was
+// waiting for its outcome: the fare split it is a share of, which charges the
+// requester if it failed, or the ride pass it pays for. Failures are logged;
+// open fare splits are settled again by the payment hold sweep.
+func settleDependents(ctx context.Context, fareSplitService FareSplitService, ridePassService RidePassService, log *logger.Logger, p *models.Payment) {
+	if p.FareSplitID != nil {
+		if _, err := fareSplitService.SettleSplit(ctx, p.RideID); err != nil {
+			log.WithError(err).
+				WithRideID(p.RideID).
+				WithField("payment_id", p.ID.Hex()).
+				Warn("Failed to settle fare split after payment outcome")
+		}
+	}
+
+	if p.PaymentType == models.PaymentTypeSubscription {
+		if err := ridePassService.SettlePayment(ctx, p); err != nil {
+			log.WithError(err).
+				WithUserID(p.PayerID).
+				WithField("payment_id", p.ID.Hex()).
+				Warn("Failed to apply ride pass payment outcome")
+		}
+	}
+}
+
+// applyPaymentResult records a provider's answer to a charge on the payment.
+// A transient error leaves the payment pending: the provider may still have
+// taken the money, and the recovery job finds out.
+func applyPaymentResult(p *models.Payment, response *payment.PaymentResponse, err error, now time.Time) {
+	switch {
+	case err != nil && payment.IsTransient(err):
+		p.Status = models.PaymentStatusPending
+		p.FailureReason = err.Error()
+	case err != nil:
+		p.Status = models.PaymentStatusFailed
+		p.FailureReason = err.Error()
+		p.FailedAt = &now
+	default:
+		p.TransactionID = response.TransactionID
+		p.ExternalID = response.TransactionID
+		p.FailureReason = ""
+		p.Status = providerPaymentStatus(response.Status)
+		switch p.Status {
+		case models.PaymentStatusCompleted:
+			p.ProcessedAt = &now
+		case models.PaymentStatusFailed:
+			p.FailureReason = fmt.Sprintf("payment %s", response.Status)
+			p.FailedAt = &now
+		}
+	}
+}
+
+func paymentResultUpdates(p *models.Payment) map[string]interface{} {
+	return map[string]interface{}{
+		"status":         p.Status,
+		"transaction_id": p.TransactionID,
+		"external_id":    p.ExternalID,
+		"failure_reason": p.FailureReason,
+		"processed_at":   p.ProcessedAt,
+		"failed_at":      p.FailedAt,
+	}
+}
@@ -0,0 +1,239 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"goride/internal/config"
+	"goride/internal/models"
+	"goride/pkg/money"
+	"goride/pkg/payment"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestApplyPaymentResult(t *testing.T) {
+	now := time.Now()
+
+	tests := []struct {
+		name          string
+		response      *payment.PaymentResponse
+		err           error
+		wantStatus    models.PaymentStatus
+		wantProcessed bool
+		wantFailed    bool
+	}{
+		{
+			name:       "unanswered charge stays pending",
+			err:        &payment.ProviderError{Provider: "test", StatusCode: 503, Body: "unavailable"},
+			wantStatus: models.PaymentStatusPending,
+		},
+		{
+			name:       "rejected request fails",
+			err:        &payment.ProviderError{Provider: "test", StatusCode: 400, Body: "invalid card"},
+			wantStatus: models.PaymentStatusFailed,
+			wantFailed: true,
+		},
+		{
+			name:          "succeeded charge completes",
+			response:      &payment.PaymentResponse{TransactionID: "txn_1", Status: "succeeded"},
+			wantStatus:    models.PaymentStatusCompleted,
+			wantProcessed: true,
+		},
+		{
+			name:       "declined charge fails",
+			response:   &payment.PaymentResponse{TransactionID: "txn_1", Status: "declined"},
+			wantStatus: models.PaymentStatusFailed,
+			wantFailed: true,
+		},
+		{
+			name:       "processing charge stays pending",
+			response:   &payment.PaymentResponse{TransactionID: "txn_1", Status: "processing"},
+			wantStatus: models.PaymentStatusPending,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &models.Payment{Status: models.PaymentStatusPending}
+			applyPaymentResult(p, tt.response, tt.err, now)
+
+			if p.Status != tt.wantStatus {
+				t.Errorf("status = %s, want %s", p.Status, tt.wantStatus)
+			}
+			if (p.ProcessedAt != nil) != tt.wantProcessed || (p.FailedAt != nil) != tt.wantFailed {
+				t.Errorf("processed at %v, failed at %v; want processed %v, failed %v", p.ProcessedAt, p.FailedAt, tt.wantProcessed, tt.wantFailed)
+			}
+			if tt.response != nil && p.TransactionID != tt.response.TransactionID {
+				t.Errorf("transaction = %q, want %q", p.TransactionID, tt.response.TransactionID)
+			}
+		})
+	}
+}
+
+// TestSendPaymentAttempts sends a charge the provider does not answer and
+// then sends it again, and checks each attempt goes out under its own key.
+func TestSendPaymentAttempts(t *testing.T) {
+	ctx := context.Background()
+	payments := newFakePaymentRepo()
+	provider := newFakeProvider()
+	card := primitive.NewObjectID()
+	rideID := primitive.NewObjectID()
+
+	tests := []struct {
+		answer     func() (*payment.PaymentResponse, error)
+		wantStatus models.PaymentStatus
+		wantKey    string
+	}{
+		{answer: unanswered, wantStatus: models.PaymentStatusPending, wantKey: rideID.Hex() + ":ride:1"},
+		{answer: declined, wantStatus: models.PaymentStatusFailed, wantKey: rideID.Hex() + ":ride:2"},
+		{wantStatus: models.PaymentStatusCompleted, wantKey: rideID.Hex() + ":ride:3"},
+	}
+
+	for i, tt := range tests {
+		delete(provider.answers, card.Hex())
+		if tt.answer != nil {
+			provider.answers[card.Hex()] = tt.answer
+		}
+
+		charge := &models.Payment{
+			RideID:      rideID,
+			PayerID:     primitive.NewObjectID(),
+			PaymentType: models.PaymentTypeRide,
+			Amount:      money.New(2000, "USD"),
+			Status:      models.PaymentStatusPending,
+		}
+		if err := sendPayment(ctx, payments, provider, newTestLogger(t), charge, &payment.PaymentRequest{
+			PaymentMethodID: card.Hex(),
+			Amount:          charge.Amount,
+		}); err != nil {
+			t.Fatalf("attempt %d: sendPayment() error = %v", i+1, err)
+		}
+
+		if charge.IdempotencyKey != tt.wantKey || provider.requests[i].IdempotencyKey != tt.wantKey {
+			t.Errorf("attempt %d stored under %q and sent with %q, want %q", i+1, charge.IdempotencyKey, provider.requests[i].IdempotencyKey, tt.wantKey)
+		}
+		if stored := payments.payments[charge.ID]; stored.Status != tt.wantStatus {
+			t.Errorf("attempt %d status = %s, want %s", i+1, stored.Status, tt.wantStatus)
+		}
+	}
+}
+
+func TestRecoverPayment(t *testing.T) {
+	found := func(status string) func() (*payment.PaymentResponse, error) {
+		return func() (*payment.PaymentResponse, error) {
+			return &payment.PaymentResponse{TransactionID: "txn_1", Status: status}, nil
+		}
+	}
+	notFound := func() (*payment.PaymentResponse, error) { return nil, payment.ErrPaymentNotFound }
+
+	tests := []struct {
+		name        string
+		paymentType models.PaymentType
+		lookup      func() (*payment.PaymentResponse, error)
+		age         time.Duration
+		wantErr     bool
+		wantStatus  models.PaymentStatus
+		wantPosted  bool
+		wantSettled bool
+	}{
+		{
+			name:        "charge the provider took completes",
+			lookup:      found("succeeded"),
+			wantStatus:  models.PaymentStatusCompleted,
+			wantPosted:  true,
+			wantSettled: true,
+		},
+		{
+			name:        "charge the provider declined fails",
+			lookup:      found("declined"),
+			wantStatus:  models.PaymentStatusFailed,
+			wantSettled: true,
+		},
+		{
+			name:       "charge still processing stays pending",
+			lookup:     found("processing"),
+			wantStatus: models.PaymentStatusPending,
+		},
+		{
+			name:       "recent charge the provider has not seen stays pending",
+			lookup:     notFound,
+			age:        time.Minute,
+			wantStatus: models.PaymentStatusPending,
+		},
+		{
+			name:        "old charge the provider never saw fails",
+			lookup:      notFound,
+			age:         2 * time.Hour,
+			wantStatus:  models.PaymentStatusFailed,
+			wantSettled: true,
+		},
+		{
+			name:       "failed lookup leaves the charge pending",
+			lookup:     unanswered,
+			wantErr:    true,
+			wantStatus: models.PaymentStatusPending,
+		},
+		{
+			name:        "recovered ride pass charge settles the pass",
+			paymentType: models.PaymentTypeSubscription,
+			lookup:      found("succeeded"),
+			wantStatus:  models.PaymentStatusCompleted,
+			wantPosted:  true,
+			wantSettled: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			payments := newFakePaymentRepo()
+			provider := newFakeProvider()
+			provider.lookup = tt.lookup
+			wallet := &fakeWallet{}
+			splits := &fakeFareSplits{status: models.FareSplitStatusSettled}
+			passes := &fakeRidePasses{}
+			service := NewPaymentRecoveryService(payments, wallet, splits, passes, provider, newFakeCache(),
+				&config.RecoveryConfig{NotFoundAfter: time.Hour}, newTestLogger(t))
+
+			p := &models.Payment{
+				RideID:      primitive.NewObjectID(),
+				PayerID:     primitive.NewObjectID(),
+				PaymentType: models.PaymentTypeRide,
+				Amount:      money.New(1500, "USD"),
+				Status:      models.PaymentStatusPending,
+			}
+			if tt.paymentType != "" {
+				p.PaymentType = tt.paymentType
+				p.RideID = primitive.NilObjectID
+			} else {
+				splitID := primitive.NewObjectID()
+				p.FareSplitID = &splitID
+			}
+			if err := payments.CreateAttempt(context.Background(), p); err != nil {
+				t.Fatalf("CreateAttempt() error = %v", err)
+			}
+			payments.payments[p.ID].CreatedAt = time.Now().Add(-tt.age)
+
+			_, err := service.RecoverPayment(context.Background(), p.ID)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("RecoverPayment() error = %v, want error %v", err, tt.wantErr)
+			}
+
+			if stored := payments.payments[p.ID]; stored.Status != tt.wantStatus {
+				t.Errorf("status = %s, want %s", stored.Status, tt.wantStatus)
+			}
+			if posted := len(wallet.recorded) == 1; posted != tt.wantPosted {
+				t.Errorf("posted to the ledger = %v, want %v", posted, tt.wantPosted)
+			}
+			settled := splits.settled == 1 || len(passes.settled) == 1
+			if settled != tt.wantSettled {
+				t.Errorf("dependents settled = %v, want %v", settled, tt.wantSettled)
+			}
+
+			if _, err := service.RecoverPayment(context.Background(), p.ID); tt.wantStatus != models.PaymentStatusPending && err == nil {
+				t.Error("second RecoverPayment() of a settled payment succeeded, want an error")
+			}
+		})
+	}
+}
@@ -0,0 +1,451 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"goride/internal/config"
+	"goride/internal/models"
+	"goride/internal/repositories/interfaces"
+	"goride/internal/utils"
+	"goride/pkg/logger"
+	"goride/pkg/payment"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	// ErrUnknownPaymentProvider is returned for webhooks addressed to a
+	// provider that is not configured.
+	ErrUnknownPaymentProvider = errors.New("unknown payment provider")
+
+	// ErrInvalidPaymentWebhook is returned for webhooks whose signature does
+	// not verify or whose payload cannot be read.
+	ErrInvalidPaymentWebhook = errors.New("invalid payment webhook")
+)
+
+type PaymentWebhookService interface {
+	// Ingestion
+	ReceiveEvent(ctx context.Context, provider string, payload []byte, header http.Header) (*models.PaymentWebhookEvent, error)
+
+	// Processing
+	Start(ctx context.Context)
+
+	// Administration
+	GetEvent(ctx context.Context, id primitive.ObjectID) (*models.PaymentWebhookEvent, error)
+	GetEvents(ctx context.Context, status models.PaymentWebhookStatus, params *utils.PaginationParams) ([]*models.PaymentWebhookEvent, int64, error)
+	ReplayEvent(ctx context.Context, id, adminID primitive.ObjectID) (*models.PaymentWebhookEvent, error)
+}
+
+const (
+	paymentWebhookLock    = "payments:webhooks"
+	paymentWebhookLockTTL = time.Minute
+	paymentWebhookBatch   = 100
+)
+
+type paymentWebhookService struct {
+	webhookRepo      interfaces.PaymentWebhookRepository
+	paymentRepo      interfaces.PaymentRepository
+	walletService    WalletService
+	fareSplitService FareSplitService
+	ridePassService  RidePassService
+	providers        map[string]payment.PaymentProvider // by the name in the webhook URL
+	cache            CacheService
+	config           *config.WebhookConfig
+	logger           *logger.Logger
+}
+
+func NewPaymentWebhookService(
+	webhookRepo interfaces.PaymentWebhookRepository,
+	paymentRepo interfaces.PaymentRepository,
+	walletService WalletService,
+	fareSplitService FareSplitService,
+	ridePassService RidePassService,
+	providers map[string]payment.PaymentProvider,
+	cache CacheService,
+	config *config.WebhookConfig,
+	logger *logger.Logger,
+) PaymentWebhookService {
+	return &paymentWebhookService{
+		webhookRepo:      webhookRepo,
+		paymentRepo:      paymentRepo,
+		walletService:    walletService,
+		fareSplitService: fareSplitService,
+		ridePassService:  ridePassService,
+		providers:        providers,
+		cache:            cache,
+		config:           config,
+		logger:           logger,
+	}
+}
+
+// Ingestion
+
+// ReceiveEvent verifies a webhook and stores it for the worker to process.
+// An event the provider delivers again is not stored twice; the stored event
+// is returned instead.
+func (s *paymentWebhookService) ReceiveEvent(ctx context.Context, provider string, payload []byte, header http.Header) (*models.PaymentWebhookEvent, error) {
+	provider = strings.ToLower(provider)
+	paymentProvider, ok := s.providers[provider]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownPaymentProvider, provider)
+	}
+
+	parsed, err := paymentProvider.ValidateWebhook(ctx, payload, header)
+	if err != nil {
+		if payment.IsTransient(err) {
+			return nil, fmt.Errorf("failed to verify payment webhook: %w", err)
+		}
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPaymentWebhook, err)
+	}
+	if parsed.EventID == "" {
+		return nil, fmt.Errorf("%w: event has no ID", ErrInvalidPaymentWebhook)
+	}
+
+	event := &models.PaymentWebhookEvent{
+		Provider:      provider,
+		EventID:       parsed.EventID,
+		EventType:     parsed.EventType,
+		Payload:       string(payload),
+		Status:        models.PaymentWebhookStatusPending,
+		NextAttemptAt: time.Now(),
+	}
+	created, err := s.webhookRepo.CreateEvent(ctx, event)
+	if err != nil {
+		return nil, err
+	}
+	if !created {
+		return s.webhookRepo.GetEventByEventID(ctx, provider, parsed.EventID)
+	}
+
+	s.logger.WithField("provider", provider).
+		WithField("event_id", event.EventID).
+		WithField("event_type", event.EventType).
+		Info("Payment webhook received")
+
+	return event, nil
+}
+
+// Processing
+
+// Start processes stored webhooks as they come due until the context is
+// cancelled.
+func (s *paymentWebhookService) Start(ctx context.Context) {
+	ticker := time.NewTicker(s.config.PollInterval)
+	defer ticker.Stop()
+
+	s.logger.WithField("interval", s.config.PollInterval.String()).Info("Payment webhook worker started")
+
+	for {
+		select {
+		case <-ctx.Done():
+			s.logger.Info("Payment webhook worker stopped")
+			return
+		case <-ticker.C:
+			lock, err := s.cache.Lock(ctx, paymentWebhookLock, paymentWebhookLockTTL)
+			if err != nil {
+				// Another instance holds the run
+				continue
+			}
+
+			if err := s.processDue(ctx); err != nil {
+				s.logger.WithError(err).Error("Failed to process payment webhooks")
+			}
+
+			s.cache.Unlock(ctx, lock)
+		}
+	}
+}
+
+// Administration
+func (s *paymentWebhookService) GetEvent(ctx context.Context, id primitive.ObjectID) (*models.PaymentWebhookEvent, error) {
+	return s.webhookRepo.GetEventByID(ctx, id)
+}
+
+func (s *paymentWebhookService) GetEvents(ctx context.Context, status models.PaymentWebhookStatus, params *utils.PaginationParams) ([]*models.PaymentWebhookEvent, int64, error) {
+	return s.webhookRepo.GetEventsByStatus(ctx, status, params)
+}
+
+// ReplayEvent queues a stored event to be processed again from its first
+// attempt. Applying an event twice leaves the payment as it was, so processed
+// events may be replayed as well as failed ones.
+func (s *paymentWebhookService) ReplayEvent(ctx context.Context, id, adminID primitive.ObjectID) (*models.PaymentWebhookEvent, error) {
+	event, err := s.webhookRepo.GetEventByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if event.Status == models.PaymentWebhookStatusPending {
+		return nil, fmt.Errorf("payment webhook event is already queued")
+	}
+
+	now := time.Now()
+	if err := s.webhookRepo.UpdateEvent(ctx, id, map[string]interface{}{
+		"status":          models.PaymentWebhookStatusPending,
+		"attempts":        0,
+		"last_error":      "",
+		"next_attempt_at": now,
+		"replayed_by":     adminID,
+		"replayed_at":     now,
+	}); err != nil {
+		return nil, err
+	}
+
+	s.logger.WithUserID(adminID).
+		WithField("event_id", event.EventID).
+		WithField("provider", event.Provider).
+		Info("Payment webhook replayed")
+
+	return s.webhookRepo.GetEventByID(ctx, id)
+}
+
+// Helper methods
+func (s *paymentWebhookService) processDue(ctx context.Context) error {
+	events, err := s.webhookRepo.GetDueEvents(ctx, time.Now(), paymentWebhookBatch)
+	if err != nil {
+		return fmt.Errorf("failed to get due payment webhooks: %w", err)
+	}
+
+	for _, event := range events {
+		s.processEvent(ctx, event)
+	}
+
+	return nil
+}
+
+// processEvent applies an event and records the outcome. A failed attempt is
+// retried with backoff until the attempts run out, when the event is left
+// failed for an admin to replay.
+func (s *paymentWebhookService) processEvent(ctx context.Context, event *models.PaymentWebhookEvent) {
+	status, paymentID, err := s.applyEvent(ctx, event)
+
+	now := time.Now()
+	attempts := event.Attempts + 1
+	updates := map[string]interface{}{
+		"attempts":   attempts,
+		"payment_id": paymentID,
+		"last_error": "",
+	}
+	switch {
+	case err == nil:
+		updates["status"] = status
+		updates["processed_at"] = now
+	case attempts >= s.config.MaxAttempts:
+		updates["status"] = models.PaymentWebhookStatusFailed
+		updates["last_error"] = err.Error()
+	default:
+		policy := payment.RetryPolicy{
+			MaxAttempts: s.config.MaxAttempts,
+			BaseDelay:   s.config.BaseDelay,
+			MaxDelay:    s.config.MaxDelay,
+		}
+		updates["last_error"] = err.Error()
+		updates["next_attempt_at"] = now.Add(policy.Backoff(attempts))
+	}
+
+	if err != nil {
+		s.logger.WithError(err).
+			WithField("event_id", event.EventID).
+			WithField("provider", event.Provider).
+			WithField("attempts", attempts).
+			Warn("Failed to process payment webhook")
+	}
+
+	if err := s.webhookRepo.UpdateEvent(ctx, event.ID, updates); err != nil {
+		s.logger.WithError(err).
+			WithField("event_id", event.EventID).
+			Error("Payment webhook processed but its outcome not saved")
+	}
+}
+
+// applyEvent parses a stored event again and applies it to the payment it is
+// about. Events that mean nothing for a payment are ignored.
+func (s *paymentWebhookService) applyEvent(ctx context.Context, event *models.PaymentWebhookEvent) (models.PaymentWebhookStatus, *primitive.ObjectID, error) {
+	paymentProvider, ok := s.providers[event.Provider]
+	if !ok {
+		return "", nil, fmt.Errorf("%w: %s", ErrUnknownPaymentProvider, event.Provider)
+	}
+
+	parsed, err := paymentProvider.ParseWebhook([]byte(event.Payload))
+	if err != nil {
+		return "", nil, err
+	}
+	if parsed.Action == payment.WebhookActionNone {
+		return models.PaymentWebhookStatusIgnored, nil, nil
+	}
+
+	p, err := s.findPayment(ctx, parsed)
+	if err != nil {
+		return "", nil, err
+	}
+
+	switch parsed.Action {
+	case payment.WebhookActionPaymentSucceeded:
+		err = s.paymentSucceeded(ctx, p, parsed)
+	case payment.WebhookActionPaymentFailed:
+		err = s.paymentFailed(ctx, p, parsed)
+	case payment.WebhookActionPaymentRefunded:
+		err = s.paymentRefunded(ctx, p, parsed)
+	case payment.WebhookActionDisputeOpened:
+		err = s.disputeOpened(ctx, p, parsed)
+	}
+	if err != nil {
+		return "", &p.ID, err
+	}
+
+	return models.PaymentWebhookStatusProcessed, &p.ID, nil
+}
+
+// findPayment finds the payment an event is about by the IDs it carries,
+// then by the idempotency key for a payment whose answer was lost before its
+// transaction ID was saved. The event may arrive before the payment is saved,
+// so not finding it is an error to retry.
+func (s *paymentWebhookService) findPayment(ctx context.Context, event *payment.WebhookEvent) (*models.Payment, error) {
+	for _, transactionID := range event.TransactionIDs {
+		if p, err := s.paymentRepo.GetByTransactionID(ctx, transactionID); err == nil {
+			return s.paymentRepo.GetByID(ctx, p.ID)
+		}
+	}
+	if event.IdempotencyKey != "" {
+		if p, err := s.paymentRepo.GetByIdempotencyKey(ctx, event.IdempotencyKey); err == nil {
+			return p, nil
+		}
+	}
+
+	return nil, fmt.Errorf("no payment found for transaction %s", strings.Join(event.TransactionIDs, ", "))
+}
+
+// paymentSucceeded completes a pending payment. A payment we took for failed
+// is completed too, since the provider holds the money.
+func (s *paymentWebhookService) paymentSucceeded(ctx context.Context, p *models.Payment, event *payment.WebhookEvent) error {
+	switch p.Status {
+	case models.PaymentStatusPending:
+	case models.PaymentStatusFailed:
+		s.logger.WithField("payment_id", p.ID.Hex()).
+			WithField("reason", p.FailureReason).
+			Warn("Payment recorded as failed succeeded with the provider")
+	default:
+		return nil
+	}
+
+	updates := map[string]interface{}{"failure_reason": ""}
+	if p.TransactionID == "" && len(event.TransactionIDs) > 0 {
+		updates["transaction_id"] = event.TransactionIDs[0]
+		updates["external_id"] = event.TransactionIDs[0]
+	}
+	if err := s.paymentRepo.Update(ctx, p.ID, updates); err != nil {
+		return err
+	}
+	if err := s.paymentRepo.UpdateStatus(ctx, p.ID, models.PaymentStatusCompleted); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	p.Status = models.PaymentStatusCompleted
+	p.FailureReason = ""
+	p.ProcessedAt = &now
+	// Refused if the payment was already posted
+	if _, err := s.walletService.RecordPayment(ctx, p); err != nil {
+		s.logger.WithError(err).
+			WithField("payment_id", p.ID.Hex()).
+			Warn("Payment completed by webhook not posted to the ledger")
+	}
+
+	settleDependents(ctx, s.fareSplitService, s.ridePassService, s.logger, p)
+	return nil
+}
+
+// paymentFailed fails a payment still waiting for its outcome. A failure
+// reported for a settled payment was followed by a later attempt and is
+// ignored.
+func (s *paymentWebhookService) paymentFailed(ctx context.Context, p *models.Payment, event *payment.WebhookEvent) error {
+	if p.Status != models.PaymentStatusPending {
+		return nil
+	}
+
+	reason := event.Reason
+	if reason == "" {
+		reason = fmt.Sprintf("payment failed (%s)", event.EventType)
+	}
+	updates := map[string]interface{}{"failure_reason": reason}
+	if p.TransactionID == "" && len(event.TransactionIDs) > 0 {
+		updates["transaction_id"] = event.TransactionIDs[0]
+		updates["external_id"] = event.TransactionIDs[0]
+	}
+	if err := s.paymentRepo.Update(ctx, p.ID, updates); err != nil {
+		return err
+	}
+	if err := s.paymentRepo.UpdateStatus(ctx, p.ID, models.PaymentStatusFailed); err != nil {
+		return err
+	}
+
+	p.Status = models.PaymentStatusFailed
+	p.FailureReason = reason
+	settleDependents(ctx, s.fareSplitService, s.ridePassService, s.logger, p)
+	return nil
+}
+
+// paymentRefunded records refunds made with the provider, from our own
+// refunds or from its dashboard. Events carry the total refunded, so only
+// the part not recorded yet is posted, and a refund we recorded when we made
+// it is not posted again.
+func (s *paymentWebhookService) paymentRefunded(ctx context.Context, p *models.Payment, event *payment.WebhookEvent) error {
+	if !event.Amount.IsPositive() {
+		return fmt.Errorf("refund event carries no refunded total")
+	}
+	switch p.Status {
+	case models.PaymentStatusCompleted, models.PaymentStatusRefunded:
+	default:
+		return fmt.Errorf("cannot refund a %s payment", p.Status)
+	}
+
+	recorded := p.RefundAmount
+	if recorded.Currency == "" {
+		recorded.Currency = p.Amount.Currency
+	}
+	unrecorded, err := event.Amount.Sub(recorded)
+	if err != nil {
+		return err
+	}
+	if !unrecorded.IsPositive() {
+		return nil
+	}
+
+	// Keyed by the total like our own refunds, so the ledger takes it once
+	if _, err := s.walletService.RecordRefund(ctx, p, unrecorded, fmt.Sprintf("%s:%d", p.ID.Hex(), event.Amount.Amount)); err != nil {
+		s.logger.WithError(err).
+			WithField("payment_id", p.ID.Hex()).
+			Error("Provider refund not posted to the ledger")
+	}
+
+	return s.paymentRepo.ProcessRefund(ctx, p.ID, event.Amount, "Refunded with the provider")
+}
+
+// disputeOpened records a chargeback on the payment. The money stays where
+// it is until the dispute is decided.
+func (s *paymentWebhookService) disputeOpened(ctx context.Context, p *models.Payment, event *payment.WebhookEvent) error {
+	if p.DisputeID != "" && p.DisputeID == event.ObjectID {
+		return nil
+	}
+
+	if err := s.paymentRepo.Update(ctx, p.ID, map[string]interface{}{
+		"dispute_id":      event.ObjectID,
+		"disputed_amount": event.Amount,
+		"dispute_reason":  event.Reason,
+		"disputed_at":     time.Now(),
+	}); err != nil {
+		return err
+	}
+
+	s.logger.WithRideID(p.RideID).
+		WithField("payment_id", p.ID.Hex()).
+		WithField("dispute_id", event.ObjectID).
+		WithField("amount", event.Amount.String()).
+		WithField("reason", event.Reason).
+		Warn("Payment disputed with the provider")
+
+	return nil
+}
@@ -0,0 +1,281 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+
+	"goride/internal/config"
+	"goride/internal/models"
+	"goride/pkg/money"
+	"goride/pkg/payment"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type paymentWebhookFixture struct {
+	service  *paymentWebhookService
+	events   *fakeWebhookRepo
+	payments *fakePaymentRepo
+	wallet   *fakeWallet
+}
+
+func newPaymentWebhookFixture(t *testing.T) *paymentWebhookFixture {
+	t.Helper()
+
+	f := &paymentWebhookFixture{
+		events:   &fakeWebhookRepo{},
+		payments: newFakePaymentRepo(),
+		wallet:   &fakeWallet{},
+	}
+	providers := map[string]payment.PaymentProvider{
+		"stripe": newFakeProvider(),
+		"paypal": newFakeProvider(),
+	}
+	f.service = NewPaymentWebhookService(f.events, f.payments, f.wallet, &fakeFareSplits{}, &fakeRidePasses{},
+		providers, newFakeCache(), &config.WebhookConfig{MaxAttempts: 5}, newTestLogger(t)).(*paymentWebhookService)
+
+	return f
+}
+
+func (f *paymentWebhookFixture) deliver(t *testing.T, provider string, event payment.WebhookEvent) (*models.PaymentWebhookEvent, error) {
+	t.Helper()
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		t.Fatalf("failed to marshal webhook: %v", err)
+	}
+	header := http.Header{}
+	header.Set("Signature", "valid")
+	return f.service.ReceiveEvent(context.Background(), provider, payload, header)
+}
+
+func TestReceiveEventDuplicates(t *testing.T) {
+	type delivery struct {
+		provider string
+		eventID  string
+	}
+
+	tests := []struct {
+		name       string
+		deliveries []delivery
+		wantStored int
+	}{
+		{
+			name:       "new event is stored",
+			deliveries: []delivery{{"stripe", "evt_1"}},
+			wantStored: 1,
+		},
+		{
+			name:       "redelivered event is stored once",
+			deliveries: []delivery{{"stripe", "evt_1"}, {"stripe", "evt_1"}, {"stripe", "evt_1"}},
+			wantStored: 1,
+		},
+		{
+			name:       "provider name is not case sensitive",
+			deliveries: []delivery{{"stripe", "evt_1"}, {"Stripe", "evt_1"}},
+			wantStored: 1,
+		},
+		{
+			name:       "same event ID from another provider is another event",
+			deliveries: []delivery{{"stripe", "evt_1"}, {"paypal", "evt_1"}},
+			wantStored: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newPaymentWebhookFixture(t)
+
+			stored := make(map[string]primitive.ObjectID)
+			for i, d := range tt.deliveries {
+				event, err := f.deliver(t, d.provider, payment.WebhookEvent{EventID: d.eventID, EventType: "charge.succeeded"})
+				if err != nil {
+					t.Fatalf("delivery %d: ReceiveEvent() error = %v", i+1, err)
+				}
+				if event.Status != models.PaymentWebhookStatusPending {
+					t.Errorf("delivery %d: status = %s, want pending", i+1, event.Status)
+				}
+
+				key := event.Provider + ":" + event.EventID
+				if id, ok := stored[key]; ok && id != event.ID {
+					t.Errorf("delivery %d returned event %s, want the stored %s", i+1, event.ID.Hex(), id.Hex())
+				}
+				stored[key] = event.ID
+			}
+
+			if len(f.events.events) != tt.wantStored {
+				t.Errorf("stored %d events, want %d", len(f.events.events), tt.wantStored)
+			}
+		})
+	}
+}
+
+func TestReceiveEventRejects(t *testing.T) {
+	tests := []struct {
+		name      string
+		provider  string
+		signature string
+		eventID   string
+		wantErr   error
+	}{
+		{
+			name:      "unknown provider",
+			provider:  "acme",
+			signature: "valid",
+			eventID:   "evt_1",
+			wantErr:   ErrUnknownPaymentProvider,
+		},
+		{
+			name:      "bad signature",
+			provider:  "stripe",
+			signature: "forged",
+			eventID:   "evt_1",
+			wantErr:   ErrInvalidPaymentWebhook,
+		},
+		{
+			name:      "event without an ID",
+			provider:  "stripe",
+			signature: "valid",
+			wantErr:   ErrInvalidPaymentWebhook,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newPaymentWebhookFixture(t)
+
+			payload, _ := json.Marshal(payment.WebhookEvent{EventID: tt.eventID})
+			header := http.Header{}
+			header.Set("Signature", tt.signature)
+
+			if _, err := f.service.ReceiveEvent(context.Background(), tt.provider, payload, header); !errors.Is(err, tt.wantErr) {
+				t.Errorf("ReceiveEvent() error = %v, want %v", err, tt.wantErr)
+			}
+			if len(f.events.events) != 0 {
+				t.Errorf("stored %d events, want none", len(f.events.events))
+			}
+		})
+	}
+}
+
+// TestProcessDuplicateEvents processes events that report the same outcome
+// more than once, as providers do, and checks each outcome is applied once.
+func TestProcessDuplicateEvents(t *testing.T) {
+	succeeded := payment.WebhookEvent{Action: payment.WebhookActionPaymentSucceeded, EventType: "charge.succeeded"}
+	failed := payment.WebhookEvent{Action: payment.WebhookActionPaymentFailed, EventType: "charge.failed"}
+	refunded := func(amount int64) payment.WebhookEvent {
+		return payment.WebhookEvent{Action: payment.WebhookActionPaymentRefunded, EventType: "charge.refunded", Amount: money.New(amount, "USD")}
+	}
+
+	tests := []struct {
+		name        string
+		status      models.PaymentStatus
+		events      []payment.WebhookEvent
+		wantStatus  models.PaymentStatus
+		wantPosted  int
+		wantRefunds int
+		wantRefund  int64
+	}{
+		{
+			name:       "success reported twice completes the payment once",
+			status:     models.PaymentStatusPending,
+			events:     []payment.WebhookEvent{succeeded, succeeded},
+			wantStatus: models.PaymentStatusCompleted,
+			wantPosted: 1,
+		},
+		{
+			name:       "failure after success is ignored",
+			status:     models.PaymentStatusPending,
+			events:     []payment.WebhookEvent{succeeded, failed},
+			wantStatus: models.PaymentStatusCompleted,
+			wantPosted: 1,
+		},
+		{
+			name:        "refund reported twice is posted once",
+			status:      models.PaymentStatusCompleted,
+			events:      []payment.WebhookEvent{refunded(500), refunded(500)},
+			wantStatus:  models.PaymentStatusRefunded,
+			wantRefunds: 1,
+			wantRefund:  500,
+		},
+		{
+			name:        "growing refund posts only the difference",
+			status:      models.PaymentStatusCompleted,
+			events:      []payment.WebhookEvent{refunded(300), refunded(500)},
+			wantStatus:  models.PaymentStatusRefunded,
+			wantRefunds: 2,
+			wantRefund:  500,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newPaymentWebhookFixture(t)
+
+			p := &models.Payment{
+				PayerID:       primitive.NewObjectID(),
+				PaymentType:   models.PaymentTypeRide,
+				Amount:        money.New(2000, "USD"),
+				Status:        tt.status,
+				TransactionID: "txn_1",
+			}
+			if err := f.payments.Create(context.Background(), p); err != nil {
+				t.Fatalf("Create() error = %v", err)
+			}
+
+			for i, event := range tt.events {
+				event.EventID = primitive.NewObjectID().Hex()
+				event.TransactionIDs = []string{"txn_1"}
+				if _, err := f.deliver(t, "stripe", event); err != nil {
+					t.Fatalf("delivery %d: ReceiveEvent() error = %v", i+1, err)
+				}
+			}
+			if err := f.service.processDue(context.Background()); err != nil {
+				t.Fatalf("processDue() error = %v", err)
+			}
+
+			for _, event := range f.events.events {
+				if event.Status != models.PaymentWebhookStatusProcessed || event.LastError != "" {
+					t.Errorf("event %s = %s (%q), want processed", event.EventID, event.Status, event.LastError)
+				}
+			}
+
+			stored := f.payments.payments[p.ID]
+			if stored.Status != tt.wantStatus {
+				t.Errorf("payment status = %s, want %s", stored.Status, tt.wantStatus)
+			}
+			if stored.RefundAmount.Amount != tt.wantRefund {
+				t.Errorf("refunded = %s, want %d", stored.RefundAmount, tt.wantRefund)
+			}
+			if len(f.wallet.recorded) != tt.wantPosted || len(f.wallet.refunds) != tt.wantRefunds {
+				t.Errorf("posted %d payments and %d refunds, want %d and %d", len(f.wallet.recorded), len(f.wallet.refunds), tt.wantPosted, tt.wantRefunds)
+			}
+		})
+	}
+}
+
+// TestProcessEventBeforePayment processes an event that arrives before its
+// payment is saved, and checks it is retried rather than dropped.
+func TestProcessEventBeforePayment(t *testing.T) {
+	f := newPaymentWebhookFixture(t)
+
+	event, err := f.deliver(t, "stripe", payment.WebhookEvent{
+		EventID:        "evt_1",
+		Action:         payment.WebhookActionPaymentSucceeded,
+		TransactionIDs: []string{"txn_unknown"},
+	})
+	if err != nil {
+		t.Fatalf("ReceiveEvent() error = %v", err)
+	}
+	if err := f.service.processDue(context.Background()); err != nil {
+		t.Fatalf("processDue() error = %v", err)
+	}
+
+	stored := f.events.events[0]
+	if stored.ID != event.ID || stored.Status != models.PaymentWebhookStatusPending || stored.Attempts != 1 || stored.LastError == "" {
+		t.Errorf("event = %s after %d attempts (%q), want pending after 1 attempt with an error", stored.Status, stored.Attempts, stored.LastError)
+	}
+}
@@ -0,0 +1,778 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"goride/internal/config"
+	"goride/internal/models"
+	"goride/internal/repositories/interfaces"
+	"goride/internal/utils"
+	"goride/pkg/logger"
+	"goride/pkg/money"
+	"goride/pkg/payment"
+	"goride/pkg/websocket"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type PayoutService interface {
+	// Batches
+	Start(ctx context.Context)
+	RunBatch(ctx context.Context) (*models.PayoutBatch, error)
+	ListBatches(ctx context.Context, params *utils.PaginationParams) ([]*models.PayoutBatch, int64, error)
+	GetBatchPayouts(ctx context.Context, batchID primitive.ObjectID, params *utils.PaginationParams) ([]*models.Payout, int64, error)
+
+	// Payouts
+	GetPayouts(ctx context.Context, driverID primitive.ObjectID, params *utils.PaginationParams) ([]*models.Payout, int64, error)
+	GetPayout(ctx context.Context, driverID, payoutID primitive.ObjectID) (*models.Payout, error)
+
+	// Instant cash-out
+	QuoteCashOut(ctx context.Context, driverID primitive.ObjectID, amount money.Money) (*CashOutQuote, error)
+	CashOut(ctx context.Context, driverID primitive.ObjectID, amount money.Money) (*models.Payout, error)
+}
+
+// CashOutQuote is what an instant cash-out of an amount would send and cost,
+// and how much the driver may still cash out today.
+type CashOutQuote struct {
+	Requested      money.Money `json:"requested"` // taken from the wallet
+	Fee            money.Money `json:"fee"`
+	Amount         money.Money `json:"amount"`    // sent to the bank
+	Available      money.Money `json:"available"` // most the wallet allows right now
+	RemainingToday money.Money `json:"remaining_today"`
+	CashOutsLeft   int         `json:"cash_outs_left"`
+}
+
+// Payout websocket events
+const (
+	PayoutEventSent     = "payout_sent"
+	PayoutEventFailed   = "payout_failed"
+	PayoutEventReturned = "payout_returned"
+)
+
+const (
+	payoutLock        = "payouts:run"
+	cashOutLockPrefix = "payouts:cash_out:"
+
+	// maxPayoutAttempts bounds the requests for a payout the provider could not
+	// be reached about. The reference keeps retries from paying twice.
+	maxPayoutAttempts = 5
+	payoutTrackBatch  = 100
+)
+
+type payoutService struct {
+	payoutRepo      interfaces.PayoutRepository
+	driverRepo      interfaces.DriverRepository
+	ledgerRepo      interfaces.LedgerRepository
+	walletService   WalletService
+	exchangeService ExchangeRateService
+	payoutProvider  payment.PayoutProvider
+	cache           CacheService
+	wsHandler       *websocket.Handler
+	config          *config.PayoutConfig
+	logger          *logger.Logger
+}
+
+func NewPayoutService(
+	payoutRepo interfaces.PayoutRepository,
+	driverRepo interfaces.DriverRepository,
+	ledgerRepo interfaces.LedgerRepository,
+	walletService WalletService,
+	exchangeService ExchangeRateService,
+	payoutProvider payment.PayoutProvider,
+	cache CacheService,
+	wsHandler *websocket.Handler,
+	config *config.PayoutConfig,
+	logger *logger.Logger,
+) PayoutService {
+	return &payoutService{
+		payoutRepo:      payoutRepo,
+		driverRepo:      driverRepo,
+		ledgerRepo:      ledgerRepo,
+		walletService:   walletService,
+		exchangeService: exchangeService,
+		payoutProvider:  payoutProvider,
+		cache:           cache,
+		wsHandler:       wsHandler,
+		config:          config,
+		logger:          logger,
+	}
+}
+
+// Batches
+
+// Start runs a payout batch whenever a period has passed since the last one
+// and tracks payouts already made, until the context is cancelled.
+func (s *payoutService) Start(ctx context.Context) {
+	ticker := time.NewTicker(s.config.CheckInterval)
+	defer ticker.Stop()
+
+	s.logger.WithField("interval", s.config.CheckInterval.String()).
+		WithField("schedule", s.config.Schedule.String()).
+		Info("Payout worker started")
+
+	for {
+		select {
+		case <-ctx.Done():
+			s.logger.Info("Payout worker stopped")
+			return
+		case <-ticker.C:
+			lock, err := s.cache.Lock(ctx, payoutLock, s.config.CheckInterval)
+			if err != nil {
+				// Another instance holds the run
+				continue
+			}
+
+			if s.batchDue(ctx) {
+				if _, err := s.runBatch(ctx); err != nil {
+					s.logger.WithError(err).Error("Failed to run payout batch")
+				}
+			}
+			if err := s.trackPayouts(ctx); err != nil {
+				s.logger.WithError(err).Error("Failed to track payouts")
+			}
+
+			s.cache.Unlock(ctx, lock)
+		}
+	}
+}
+
+// RunBatch pays every driver what they are owed now rather than waiting for
+// the schedule.
+func (s *payoutService) RunBatch(ctx context.Context) (*models.PayoutBatch, error) {
+	lock, err := s.cache.Lock(ctx, payoutLock, s.config.CheckInterval)
+	if err != nil {
+		return nil, fmt.Errorf("a payout run is already in progress")
+	}
+	defer s.cache.Unlock(ctx, lock)
+
+	return s.runBatch(ctx)
+}
+
+func (s *payoutService) ListBatches(ctx context.Context, params *utils.PaginationParams) ([]*models.PayoutBatch, int64, error) {
+	return s.payoutRepo.ListBatches(ctx, params)
+}
+
+func (s *payoutService) GetBatchPayouts(ctx context.Context, batchID primitive.ObjectID, params *utils.PaginationParams) ([]*models.Payout, int64, error) {
+	return s.payoutRepo.GetPayoutsByBatch(ctx, batchID, params)
+}
+
+// Payouts
+func (s *payoutService) GetPayouts(ctx context.Context, driverID primitive.ObjectID, params *utils.PaginationParams) ([]*models.Payout, int64, error) {
+	return s.payoutRepo.GetPayoutsByDriver(ctx, driverID, params)
+}
+
+func (s *payoutService) GetPayout(ctx context.Context, driverID, payoutID primitive.ObjectID) (*models.Payout, error) {
+	payout, err := s.payoutRepo.GetPayoutByID(ctx, payoutID)
+	if err != nil {
+		return nil, err
+	}
+	if payout.DriverID != driverID {
+		return nil, fmt.Errorf("payout not found")
+	}
+	return payout, nil
+}
+
+// Instant cash-out
+
+// QuoteCashOut prices an instant cash-out of the given amount from the
+// driver's wallet and checks it against the daily caps and fraud checks.
+func (s *payoutService) QuoteCashOut(ctx context.Context, driverID primitive.ObjectID, amount money.Money) (*CashOutQuote, error) {
+	quote, _, err := s.quoteCashOut(ctx, driverID, amount)
+	return quote, err
+}
+
+// CashOut sends part of the driver's wallet to their bank right away, less
+// the instant fee.
+func (s *payoutService) CashOut(ctx context.Context, driverID primitive.ObjectID, amount money.Money) (*models.Payout, error) {
+	// One cash-out at a time per driver, so the daily caps hold
+	lock, err := s.cache.Lock(ctx, cashOutLockPrefix+driverID.Hex(), time.Minute)
+	if err != nil {
+		return nil, fmt.Errorf("a cash-out is already in progress")
+	}
+	defer s.cache.Unlock(ctx, lock)
+
+	quote, driver, err := s.quoteCashOut(ctx, driverID, amount)
+	if err != nil {
+		return nil, err
+	}
+
+	payout := &models.Payout{
+		DriverID:    driverID,
+		Type:        models.PayoutTypeInstant,
+		Status:      models.PayoutStatusPending,
+		Fee:         quote.Fee,
+		Amount:      quote.Amount,
+		BankAccount: *driver.BankAccount,
+		Reference:   "cash_out:" + primitive.NewObjectID().Hex(),
+	}
+	if err := s.payoutRepo.CreatePayout(ctx, payout); err != nil {
+		return nil, fmt.Errorf("failed to create payout: %w", err)
+	}
+
+	s.logger.WithUserID(driverID).
+		WithField("payout_id", payout.ID.Hex()).
+		WithField("amount", payout.Amount.String()).
+		WithField("fee", payout.Fee.String()).
+		Info("Instant cash-out requested")
+
+	return s.send(ctx, payout)
+}
+
+// Helper methods
+
+// batchDue reports whether a scheduled period has passed since the last
+// batch.
+func (s *payoutService) batchDue(ctx context.Context) bool {
+	latest, err := s.payoutRepo.GetLatestBatch(ctx)
+	if err != nil {
+		// No batch has run yet
+		return true
+	}
+	return !time.Now().Before(latest.PeriodEnd.Add(s.config.Schedule))
+}
+
+// runBatch settles the cash drivers collected, so the commission owed on it
+// comes off their payout, then pays out every driver wallet in credit. A
+// period starts when the previous batch completed, leaving that batch's own
+// payouts out of it.
+func (s *payoutService) runBatch(ctx context.Context) (*models.PayoutBatch, error) {
+	cashAccounts, err := s.ledgerRepo.GetAccountsByType(ctx, models.LedgerAccountCashInTransit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get cash in transit: %w", err)
+	}
+	for _, account := range cashAccounts {
+		if account.Balance.IsZero() {
+			continue
+		}
+		if _, err := s.walletService.SettleCash(ctx, account.UserID, account.Currency); err != nil {
+			s.logger.WithError(err).
+				WithUserID(account.UserID).
+				Error("Failed to settle driver cash")
+		}
+	}
+
+	now := time.Now()
+	batch := &models.PayoutBatch{
+		PeriodStart: now.Add(-s.config.Schedule),
+		PeriodEnd:   now,
+		Status:      models.PayoutBatchStatusProcessing,
+	}
+	if latest, err := s.payoutRepo.GetLatestBatch(ctx); err == nil {
+		batch.PeriodStart = latest.PeriodEnd
+		if latest.CompletedAt != nil {
+			batch.PeriodStart = *latest.CompletedAt
+		}
+	}
+	if err := s.payoutRepo.CreateBatch(ctx, batch); err != nil {
+		return nil, fmt.Errorf("failed to create payout batch: %w", err)
+	}
+
+	wallets, err := s.ledgerRepo.GetAccountsByType(ctx, models.LedgerAccountDriverWallet)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get driver wallets: %w", err)
+	}
+
+	totals := make(map[string]money.Money)
+	for _, wallet := range wallets {
+		payout, err := s.payWallet(ctx, batch, wallet)
+		switch {
+		case err != nil:
+			batch.Failed++
+			s.logger.WithError(err).
+				WithUserID(wallet.UserID).
+				WithField("batch_id", batch.ID.Hex()).
+				Error("Failed to pay out driver wallet")
+		case payout == nil:
+			batch.Skipped++
+		case payout.Status == models.PayoutStatusFailed:
+			batch.Failed++
+		default:
+			batch.Payouts++
+			if total, err := totals[payout.Amount.Currency].Add(payout.Amount); err == nil {
+				totals[payout.Amount.Currency] = total
+			}
+		}
+	}
+
+	completedAt := time.Now()
+	batch.Status = models.PayoutBatchStatusCompleted
+	batch.CompletedAt = &completedAt
+	batch.Totals = nil
+	for _, total := range totals {
+		batch.Totals = append(batch.Totals, total)
+	}
+
+	if err := s.payoutRepo.UpdateBatch(ctx, batch.ID, map[string]interface{}{
+		"status":       batch.Status,
+		"payouts":      batch.Payouts,
+		"failed":       batch.Failed,
+		"skipped":      batch.Skipped,
+		"totals":       batch.Totals,
+		"completed_at": batch.CompletedAt,
+	}); err != nil {
+		return nil, err
+	}
+
+	s.logger.WithField("batch_id", batch.ID.Hex()).
+		WithField("payouts", batch.Payouts).
+		WithField("failed", batch.Failed).
+		WithField("skipped", batch.Skipped).
+		Info("Payout batch completed")
+
+	return batch, nil
+}
+
+// payWallet pays out a driver wallet's balance in a batch. Wallets that owe
+// the platform, hold less than the minimum or belong to a driver without a
+// verified bank account are skipped, and their balance carries over.
+func (s *payoutService) payWallet(ctx context.Context, batch *models.PayoutBatch, wallet *models.Wallet) (*models.Payout, error) {
+	if !wallet.Balance.IsPositive() {
+		return nil, nil
+	}
+
+	minimum, err := s.amountIn(ctx, s.config.MinimumAmount, wallet.Currency)
+	if err != nil {
+		return nil, err
+	}
+	if comparison, err := wallet.Balance.Compare(minimum); err != nil || comparison < 0 {
+		return nil, err
+	}
+
+	driver, err := s.driverRepo.GetByUserID(ctx, wallet.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get driver: %w", err)
+	}
+	if driver.BankAccount == nil || !driver.BankAccount.IsVerified {
+		s.logger.WithUserID(wallet.UserID).
+			Info("Payout skipped: no verified bank account")
+		return nil, nil
+	}
+
+	activity, err := s.ledgerRepo.GetAccountActivity(ctx, wallet.ID, batch.PeriodStart, batch.PeriodEnd)
+	if err != nil {
+		return nil, err
+	}
+
+	payout := &models.Payout{
+		DriverID:    wallet.UserID,
+		BatchID:     &batch.ID,
+		Type:        models.PayoutTypeScheduled,
+		Status:      models.PayoutStatusPending,
+		Fee:         money.Zero(wallet.Currency),
+		Amount:      wallet.Balance,
+		BankAccount: *driver.BankAccount,
+		Reference:   fmt.Sprintf("payout:%s:%s", batch.ID.Hex(), wallet.ID.Hex()),
+		PeriodStart: &batch.PeriodStart,
+		PeriodEnd:   &batch.PeriodEnd,
+	}
+	if err := explainPayout(payout, activity); err != nil {
+		return nil, fmt.Errorf("failed to break down payout: %w", err)
+	}
+
+	if err := s.payoutRepo.CreatePayout(ctx, payout); err != nil {
+		return nil, fmt.Errorf("failed to create payout: %w", err)
+	}
+
+	return s.send(ctx, payout)
+}
+
+// send takes a pending payout from the driver's wallet and hands it to the
+// provider. Both steps are keyed by the payout reference, so a payout left
+// pending by a crash or an unreachable provider is sent again safely.
+func (s *payoutService) send(ctx context.Context, payout *models.Payout) (*models.Payout, error) {
+	if payout.EntryID == nil {
+		entry, err := s.walletService.Withdraw(ctx, payout.DriverID, payout.Amount, payout.Fee, payout.Reference)
+		if err != nil {
+			// Nothing was taken from the wallet
+			return s.fail(ctx, payout, models.PayoutStatusFailed, fmt.Sprintf("wallet could not be debited: %v", err))
+		}
+		payout.EntryID = &entry.ID
+	}
+
+	payout.Attempts++
+	response, err := s.payoutProvider.CreatePayout(ctx, &payment.PayoutRequest{
+		Reference:   payout.Reference,
+		Amount:      payout.Amount,
+		Instant:     payout.Type == models.PayoutTypeInstant,
+		Destination: bankDestination(payout.BankAccount),
+		Description: "Driver earnings",
+		Metadata: map[string]interface{}{
+			"payout_id": payout.ID.Hex(),
+			"driver_id": payout.DriverID.Hex(),
+		},
+	})
+	if err != nil {
+		if payout.Attempts >= maxPayoutAttempts {
+			return s.fail(ctx, payout, models.PayoutStatusFailed, fmt.Sprintf("provider unreachable: %v", err))
+		}
+
+		// Left pending for the tracker to send again
+		if updateErr := s.payoutRepo.UpdatePayout(ctx, payout.ID, models.PayoutStatusPending, map[string]interface{}{
+			"entry_id":       payout.EntryID,
+			"attempts":       payout.Attempts,
+			"failure_reason": err.Error(),
+		}); updateErr != nil {
+			return nil, updateErr
+		}
+		return nil, fmt.Errorf("failed to send payout: %w", err)
+	}
+
+	payout.ProviderPayoutID = response.PayoutID
+	if response.Status == payment.PayoutStatusFailed || response.Status == payment.PayoutStatusReturned {
+		return s.fail(ctx, payout, models.PayoutStatusFailed, response.FailureReason)
+	}
+
+	now := time.Now()
+	if err := s.payoutRepo.UpdatePayout(ctx, payout.ID, models.PayoutStatusPending, map[string]interface{}{
+		"status":             models.PayoutStatusSent,
+		"entry_id":           payout.EntryID,
+		"attempts":           payout.Attempts,
+		"provider_payout_id": payout.ProviderPayoutID,
+		"failure_reason":     "",
+		"sent_at":            now,
+	}); err != nil {
+		return nil, err
+	}
+	payout.Status = models.PayoutStatusSent
+	payout.FailureReason = ""
+	payout.SentAt = &now
+
+	s.notify(payout, PayoutEventSent)
+	return payout, nil
+}
+
+// fail closes a payout that did not reach the driver and puts anything taken
+// from their wallet back. A pending payout fails; a sent one is returned.
+func (s *payoutService) fail(ctx context.Context, payout *models.Payout, status models.PayoutStatus, reason string) (*models.Payout, error) {
+	now := time.Now()
+	updates := map[string]interface{}{
+		"status":             status,
+		"entry_id":           payout.EntryID,
+		"attempts":           payout.Attempts,
+		"provider_payout_id": payout.ProviderPayoutID,
+		"failure_reason":     reason,
+	}
+
+	if payout.EntryID != nil {
+		// Keyed by the reference, so a reversal is posted once
+		reversal, err := s.walletService.ReverseWithdrawal(ctx, payout.DriverID, payout.Amount, payout.Fee, payout.Reference)
+		if err != nil {
+			return nil, fmt.Errorf("failed to reverse payout withdrawal: %w", err)
+		}
+		payout.ReversalEntryID = &reversal.ID
+		updates["reversal_entry_id"] = reversal.ID
+	}
+
+	from := payout.Status
+	event := PayoutEventFailed
+	if status == models.PayoutStatusReturned {
+		payout.ReturnedAt = &now
+		updates["returned_at"] = now
+		event = PayoutEventReturned
+	} else {
+		payout.FailedAt = &now
+		updates["failed_at"] = now
+	}
+
+	if err := s.payoutRepo.UpdatePayout(ctx, payout.ID, from, updates); err != nil {
+		return nil, err
+	}
+	payout.Status = status
+	payout.FailureReason = reason
+
+	s.logger.WithUserID(payout.DriverID).
+		WithField("payout_id", payout.ID.Hex()).
+		WithField("status", status).
+		WithField("reason", reason).
+		Warn("Payout did not reach the driver")
+
+	s.notify(payout, event)
+	return payout, nil
+}
+
+// trackPayouts sends again the payouts left pending and asks the provider
+// about payouts sent within the return window, returning those the bank sent
+// back to the driver's wallet.
+func (s *payoutService) trackPayouts(ctx context.Context) error {
+	now := time.Now()
+	before := now.Add(-s.config.CheckInterval)
+
+	pending, err := s.payoutRepo.GetPayoutsByStatus(ctx, models.PayoutStatusPending, time.Time{}, before, payoutTrackBatch)
+	if err != nil {
+		return err
+	}
+	for _, payout := range pending {
+		if _, err := s.send(ctx, payout); err != nil {
+			s.logger.WithError(err).
+				WithField("payout_id", payout.ID.Hex()).
+				Error("Failed to send pending payout")
+		}
+	}
+
+	sent, err := s.payoutRepo.GetPayoutsByStatus(ctx, models.PayoutStatusSent, now.Add(-s.config.ReturnWindow), before, payoutTrackBatch)
+	if err != nil {
+		return err
+	}
+	for _, payout := range sent {
+		response, err := s.payoutProvider.GetPayout(ctx, payout.ProviderPayoutID)
+		if err != nil {
+			s.logger.WithError(err).
+				WithField("payout_id", payout.ID.Hex()).
+				Error("Failed to get payout from provider")
+			continue
+		}
+
+		switch response.Status {
+		case payment.PayoutStatusFailed, payment.PayoutStatusReturned:
+			_, err = s.fail(ctx, payout, models.PayoutStatusReturned, response.FailureReason)
+		default:
+			// Checked again after the next interval
+			err = s.payoutRepo.UpdatePayout(ctx, payout.ID, models.PayoutStatusSent, map[string]interface{}{})
+		}
+		if err != nil {
+			s.logger.WithError(err).
+				WithField("payout_id", payout.ID.Hex()).
+				Error("Failed to track payout")
+		}
+	}
+
+	return nil
+}
+
+// quoteCashOut prices a cash-out and runs every check it must pass.
+func (s *payoutService) quoteCashOut(ctx context.Context, driverID primitive.ObjectID, requested money.Money) (*CashOutQuote, *models.Driver, error) {
+	requested.Currency = strings.ToUpper(requested.Currency)
+	if !requested.IsPositive() {
+		return nil, nil, fmt.Errorf("cash-out amount must be positive")
+	}
+	currency := requested.Currency
+
+	driver, err := s.driverRepo.GetByUserID(ctx, driverID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get driver: %w", err)
+	}
+	if err := s.checkCashOutRisk(driver); err != nil {
+		s.logger.WithUserID(driverID).
+			WithField("amount", requested.String()).
+			WithField("reason", err.Error()).
+			Warn("Instant cash-out refused")
+		return nil, nil, err
+	}
+
+	minimum, err := s.amountIn(ctx, s.config.InstantMinimum, currency)
+	if err != nil {
+		return nil, nil, err
+	}
+	if comparison, err := requested.Compare(minimum); err != nil || comparison < 0 {
+		return nil, nil, fmt.Errorf("cash-outs start at %s", minimum)
+	}
+
+	feeMinimum, err := s.amountIn(ctx, s.config.InstantFeeMinimum, currency)
+	if err != nil {
+		return nil, nil, err
+	}
+	fee, err := money.Max(requested.Percent(s.config.InstantFeePercent), feeMinimum)
+	if err != nil {
+		return nil, nil, err
+	}
+	amount, err := requested.Sub(fee)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !amount.IsPositive() {
+		return nil, nil, fmt.Errorf("cash-out does not cover the %s fee", fee)
+	}
+
+	// Daily caps count every cash-out today that was not refused
+	dailyLimit, err := s.amountIn(ctx, s.config.InstantDailyLimit, currency)
+	if err != nil {
+		return nil, nil, err
+	}
+	now := time.Now()
+	today, err := s.payoutRepo.GetInstantPayoutsSince(ctx, driverID, now.Truncate(24*time.Hour))
+	if err != nil {
+		return nil, nil, err
+	}
+	remaining, cashOuts := dailyLimit, 0
+	for _, payout := range today {
+		if payout.Status == models.PayoutStatusFailed || payout.Amount.Currency != currency {
+			continue
+		}
+		cashOuts++
+		if remaining, err = money.Sum(remaining, payout.Amount.Neg(), payout.Fee.Neg()); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	available, err := s.cashOutAvailable(ctx, driverID, currency, now)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	quote := &CashOutQuote{
+		Requested:      requested,
+		Fee:            fee,
+		Amount:         amount,
+		Available:      available,
+		RemainingToday: remaining,
+		CashOutsLeft:   s.config.InstantDailyCount - cashOuts,
+	}
+	if quote.CashOutsLeft < 0 {
+		quote.CashOutsLeft = 0
+	}
+
+	switch {
+	case quote.CashOutsLeft == 0:
+		return nil, nil, fmt.Errorf("daily limit of %d cash-outs reached", s.config.InstantDailyCount)
+	case requested.Amount > remaining.Amount:
+		return nil, nil, fmt.Errorf("cash-out exceeds the %s left today", remaining)
+	case requested.Amount > available.Amount:
+		return nil, nil, fmt.Errorf("cash-out exceeds the %s available", available)
+	}
+
+	return quote, driver, nil
+}
+
+// checkCashOutRisk refuses instant cash-outs to drivers the platform cannot
+// yet trust to be paid before their earnings settle.
+func (s *payoutService) checkCashOutRisk(driver *models.Driver) error {
+	switch {
+	case driver.Status == models.DriverStatusSuspended:
+		return fmt.Errorf("suspended drivers cannot cash out")
+	case driver.ApprovedAt == nil || time.Since(*driver.ApprovedAt) < s.config.InstantMinAge:
+		return fmt.Errorf("instant cash-out is available %s after approval", s.config.InstantMinAge)
+	case driver.TotalRides < s.config.InstantMinRides:
+		return fmt.Errorf("instant cash-out is available after %d rides", s.config.InstantMinRides)
+	case driver.BankAccount == nil || !driver.BankAccount.IsVerified:
+		return fmt.Errorf("a verified bank account is required to cash out")
+	}
+	return nil
+}
+
+// cashOutAvailable is the wallet balance less the cash the driver holds for
+// the platform and less the part of the last day's earnings held back until
+// they settle.
+func (s *payoutService) cashOutAvailable(ctx context.Context, driverID primitive.ObjectID, currency string, now time.Time) (money.Money, error) {
+	available := money.Zero(currency)
+
+	wallet, err := s.walletService.GetWallet(ctx, driverID, models.LedgerAccountDriverWallet, currency)
+	if err != nil {
+		// No wallet yet, nothing to cash out
+		return available, nil
+	}
+	available = wallet.Balance
+
+	if cash, err := s.walletService.GetWallet(ctx, driverID, models.LedgerAccountCashInTransit, currency); err == nil {
+		if available, err = available.Add(cash.Balance); err != nil {
+			return money.Money{}, err
+		}
+	}
+
+	activity, err := s.ledgerRepo.GetAccountActivity(ctx, wallet.ID, now.Add(-24*time.Hour), now)
+	if err != nil {
+		return money.Money{}, err
+	}
+	for _, line := range activity {
+		// Cash fares are already in the driver's hands
+		if line.EntryType != models.LedgerEntryRidePayment || line.PaymentMethod == models.PaymentMethodCash || !line.Amount.IsPositive() {
+			continue
+		}
+		held := line.Amount.Percent(100 - s.config.InstantMaxShare)
+		if available, err = available.Sub(held); err != nil {
+			return money.Money{}, err
+		}
+	}
+
+	if available.IsNegative() {
+		return money.Zero(currency), nil
+	}
+	return available, nil
+}
+
+// amountIn returns an amount configured in the payout currency in another
+// currency.
+func (s *payoutService) amountIn(ctx context.Context, value float64, currency string) (money.Money, error) {
+	amount := money.FromMajor(value, s.config.Currency)
+	if amount.Currency == currency {
+		return amount, nil
+	}
+
+	converted, _, err := s.exchangeService.Convert(ctx, amount, currency)
+	if err != nil {
+		return money.Money{}, fmt.Errorf("failed to convert payout limit: %w", err)
+	}
+	return converted, nil
+}
+
+func (s *payoutService) notify(payout *models.Payout, eventType string) {
+	if s.wsHandler == nil {
+		return
+	}
+
+	s.wsHandler.SendUserNotification(payout.DriverID, eventType, map[string]interface{}{
+		"payout_id":      payout.ID.Hex(),
+		"type":           payout.Type,
+		"amount":         payout.Amount,
+		"fee":            payout.Fee,
+		"failure_reason": payout.FailureReason,
+	})
+}
+
+// explainPayout breaks a scheduled payout down from the wallet's activity in
+// its period. Cash rides credit the driver's earnings while the driver keeps
+// the fare, so the commission owed on them is the cash settled less those
+// earnings. Whatever the period's activity does not explain was carried over.
+func explainPayout(payout *models.Payout, activity []models.LedgerActivity) error {
+	currency := payout.Amount.Currency
+	payout.Earnings = money.Zero(currency)
+	payout.Adjustments = money.Zero(currency)
+	payout.CashedOut = money.Zero(currency)
+	cashEarnings, cashSettled := money.Zero(currency), money.Zero(currency)
+
+	var err error
+	for _, line := range activity {
+		switch line.EntryType {
+		case models.LedgerEntryRidePayment:
+			if line.PaymentMethod == models.PaymentMethodCash {
+				cashEarnings, err = cashEarnings.Add(line.Amount)
+			} else {
+				payout.Earnings, err = payout.Earnings.Add(line.Amount)
+			}
+		case models.LedgerEntryCashSettlement:
+			cashSettled, err = cashSettled.Sub(line.Amount)
+		case models.LedgerEntryAdjustment:
+			payout.Adjustments, err = payout.Adjustments.Add(line.Amount)
+		case models.LedgerEntryWithdrawal, models.LedgerEntryWithdrawalReversal:
+			payout.CashedOut, err = payout.CashedOut.Sub(line.Amount)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if payout.CashCommission, err = cashSettled.Sub(cashEarnings); err != nil {
+		return err
+	}
+	payout.CarriedOver, err = money.Sum(
+		payout.Amount,
+		payout.Earnings.Neg(),
+		payout.CashCommission,
+		payout.Adjustments.Neg(),
+		payout.CashedOut,
+	)
+	return err
+}
+
+// bankDestination is where a payout to the bank account is sent.
+func bankDestination(account models.BankAccount) *payment.BankDestination {
+	return &payment.BankDestination{
+		AccountNumber: account.AccountNumber,
+		RoutingNumber: account.RoutingNumber,
+		AccountName:   account.AccountName,
+		BankName:      account.BankName,
+		AccountType:   account.AccountType,
+	}
+}
@@ -0,0 +1,559 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"strings"
+	"time"
+
+	"goride/internal/models"
+	"goride/internal/repositories/interfaces"
+	"goride/internal/utils"
+	"goride/pkg/logger"
+	"goride/pkg/money"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type PricingExperimentService interface {
+	// Experiments
+	CreateExperiment(ctx context.Context, adminID primitive.ObjectID, experiment *models.PricingExperiment) (*models.PricingExperiment, error)
+	GetExperiment(ctx context.Context, id primitive.ObjectID) (*models.PricingExperiment, error)
+	ListExperiments(ctx context.Context, params *utils.PaginationParams) ([]*models.PricingExperiment, int64, error)
+	SetTrafficAllocation(ctx context.Context, adminID, id primitive.ObjectID, allocation float64) error
+	KillExperiment(ctx context.Context, adminID, id primitive.ObjectID, reason string) error
+
+	// Assignment
+	Assign(ctx context.Context, riderID primitive.ObjectID, city string, rideType models.RideType, at time.Time) (*models.PricingExperimentAssignment, error)
+	RecordExposure(ctx context.Context, quote *models.FareQuote) error
+	RecordConversion(ctx context.Context, quote *models.FareQuote, rideID primitive.ObjectID) error
+
+	// Reporting
+	GetReport(ctx context.Context, id primitive.ObjectID) (*PricingExperimentReport, error)
+}
+
+// PricingExperimentReport compares the arms of an experiment. Revenue is the
+// final fare of completed rides, in the experiment's currency.
+type PricingExperimentReport struct {
+	ExperimentID      primitive.ObjectID     `json:"experiment_id"`
+	Name              string                 `json:"name"`
+	Currency          string                 `json:"currency"`
+	IsRunning         bool                   `json:"is_running"`
+	IsKilled          bool                   `json:"is_killed"`
+	StartDate         time.Time              `json:"start_date"`
+	EndDate           time.Time              `json:"end_date"`
+	TrafficAllocation float64                `json:"traffic_allocation"`
+	Arms              []*ExperimentArmResult `json:"arms"`
+	GeneratedAt       time.Time              `json:"generated_at"`
+}
+
+// ExperimentArmResult holds an arm's metrics and, for treatment arms, their
+// difference to the control arm.
+type ExperimentArmResult struct {
+	Arm             string              `json:"arm"`
+	IsControl       bool                `json:"is_control"`
+	Quotes          int64               `json:"quotes"`
+	Rides           int64               `json:"rides"`
+	Completed       int64               `json:"completed"`
+	Revenue         money.Money         `json:"revenue"`
+	Conversion      *MetricEstimate     `json:"conversion"`        // share of quotes booked
+	CompletionRate  *MetricEstimate     `json:"completion_rate"`   // share of booked rides completed
+	RevenuePerQuote *MetricEstimate     `json:"revenue_per_quote"` // major units
+	VsControl       *ExperimentArmDelta `json:"vs_control,omitempty"`
+}
+
+type ExperimentArmDelta struct {
+	Conversion      *MetricEstimate `json:"conversion"`
+	CompletionRate  *MetricEstimate `json:"completion_rate"`
+	RevenuePerQuote *MetricEstimate `json:"revenue_per_quote"`
+}
+
+// MetricEstimate is a point estimate with its 95% confidence interval.
+type MetricEstimate struct {
+	Value float64 `json:"value"`
+	Lower float64 `json:"lower"`
+	Upper float64 `json:"upper"`
+
+	standardError float64
+}
+
+const (
+	// experimentBuckets is the resolution of traffic allocation and arm
+	// weights: 0.01 percent
+	experimentBuckets = 10000
+	// confidenceZ is the normal quantile of a two-sided 95% interval
+	confidenceZ = 1.96
+)
+
+type pricingExperimentService struct {
+	experimentRepo interfaces.PricingExperimentRepository
+	fareService    FareCalculationService
+	logger         *logger.Logger
+}
+
+func NewPricingExperimentService(
+	experimentRepo interfaces.PricingExperimentRepository,
+	fareService FareCalculationService,
+	logger *logger.Logger,
+) PricingExperimentService {
+	return &pricingExperimentService{
+		experimentRepo: experimentRepo,
+		fareService:    fareService,
+		logger:         logger,
+	}
+}
+
+// Experiments
+
+// CreateExperiment schedules an experiment. Every targeted city and ride type
+// has to be priced in one currency, which fare overrides and the revenue
+// report are in.
+func (s *pricingExperimentService) CreateExperiment(ctx context.Context, adminID primitive.ObjectID, experiment *models.PricingExperiment) (*models.PricingExperiment, error) {
+	if experiment.StartDate.IsZero() {
+		experiment.StartDate = time.Now()
+	}
+
+	if err := validatePricingExperiment(experiment); err != nil {
+		return nil, err
+	}
+
+	currency := ""
+	for _, city := range experiment.Cities {
+		for _, rideType := range experiment.RideTypes {
+			fareStructure, err := s.fareService.GetFareStructure(ctx, city, rideType, experiment.StartDate)
+			if err != nil {
+				return nil, fmt.Errorf("no fare structure for %s in %s: %w", rideType, city, err)
+			}
+			if currency != "" && fareStructure.Currency != currency {
+				return nil, fmt.Errorf("experiment cities must share a currency, found %s and %s", currency, fareStructure.Currency)
+			}
+			currency = fareStructure.Currency
+		}
+	}
+	experiment.Currency = currency
+
+	for _, arm := range experiment.Arms {
+		if arm.Fare == nil {
+			continue
+		}
+		for _, amount := range arm.Fare.Amounts() {
+			if amount.Currency == "" && amount.IsZero() {
+				*amount = money.Zero(currency)
+			}
+			if !amount.SameCurrency(money.Zero(currency)) {
+				return nil, fmt.Errorf("arm %s overrides fares in %s, experiment is priced in %s", arm.Name, amount.Currency, currency)
+			}
+		}
+	}
+
+	experiment.IsKilled = false
+	experiment.CreatedBy = &adminID
+
+	if err := s.experimentRepo.Create(ctx, experiment); err != nil {
+		return nil, fmt.Errorf("failed to create pricing experiment: %w", err)
+	}
+
+	s.logger.WithUserID(adminID).
+		WithField("experiment_id", experiment.ID.Hex()).
+		WithField("name", experiment.Name).
+		WithField("arms", len(experiment.Arms)).
+		WithField("traffic_allocation", experiment.TrafficAllocation).
+		WithField("start_date", experiment.StartDate).
+		WithField("end_date", experiment.EndDate).
+		Info("Pricing experiment created")
+
+	return experiment, nil
+}
+
+func (s *pricingExperimentService) GetExperiment(ctx context.Context, id primitive.ObjectID) (*models.PricingExperiment, error) {
+	return s.experimentRepo.GetByID(ctx, id)
+}
+
+func (s *pricingExperimentService) ListExperiments(ctx context.Context, params *utils.PaginationParams) ([]*models.PricingExperiment, int64, error) {
+	return s.experimentRepo.List(ctx, params)
+}
+
+// SetTrafficAllocation changes the share of riders enrolled. Riders keep their
+// arm: raising the allocation only adds riders, and lowering it only removes
+// them.
+func (s *pricingExperimentService) SetTrafficAllocation(ctx context.Context, adminID, id primitive.ObjectID, allocation float64) error {
+	if allocation < 0 || allocation > 100 {
+		return fmt.Errorf("traffic allocation must be between 0 and 100 percent")
+	}
+
+	experiment, err := s.experimentRepo.GetByID(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if experiment.IsKilled {
+		return fmt.Errorf("pricing experiment has been killed")
+	}
+
+	if err := s.experimentRepo.Update(ctx, id, map[string]interface{}{
+		"traffic_allocation": allocation,
+	}); err != nil {
+		return fmt.Errorf("failed to update traffic allocation: %w", err)
+	}
+
+	s.logger.WithUserID(adminID).
+		WithField("experiment_id", id.Hex()).
+		WithField("previous_allocation", experiment.TrafficAllocation).
+		WithField("traffic_allocation", allocation).
+		Info("Pricing experiment traffic allocation changed")
+
+	return nil
+}
+
+// KillExperiment stops an experiment at once. New quotes are priced normally;
+// rides already booked in an arm keep its price.
+func (s *pricingExperimentService) KillExperiment(ctx context.Context, adminID, id primitive.ObjectID, reason string) error {
+	if reason == "" {
+		return fmt.Errorf("a reason is required to kill a pricing experiment")
+	}
+
+	experiment, err := s.experimentRepo.GetByID(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if experiment.IsKilled {
+		return nil
+	}
+
+	if err := s.experimentRepo.Update(ctx, id, map[string]interface{}{
+		"is_killed":   true,
+		"killed_at":   time.Now(),
+		"killed_by":   adminID,
+		"kill_reason": reason,
+	}); err != nil {
+		return fmt.Errorf("failed to kill pricing experiment: %w", err)
+	}
+
+	s.logger.WithUserID(adminID).
+		WithField("experiment_id", id.Hex()).
+		WithField("reason", reason).
+		Warn("Pricing experiment killed")
+
+	return nil
+}
+
+// Assignment
+
+// Assign returns the arm a rider is priced under, or nil when no running
+// experiment enrolls them. Where experiments overlap the oldest one wins, so a
+// quote is never in more than one.
+func (s *pricingExperimentService) Assign(ctx context.Context, riderID primitive.ObjectID, city string, rideType models.RideType, at time.Time) (*models.PricingExperimentAssignment, error) {
+	experiments, err := s.experimentRepo.GetRunning(ctx, at)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get running pricing experiments: %w", err)
+	}
+
+	var oldest *models.PricingExperiment
+	for _, experiment := range experiments {
+		if !experiment.AppliesTo(city, rideType) {
+			continue
+		}
+		if experimentBucket("traffic", experiment.ID, riderID) >= int(math.Round(experiment.TrafficAllocation*100)) {
+			continue
+		}
+		if oldest == nil || experiment.StartDate.Before(oldest.StartDate) {
+			oldest = experiment
+		}
+	}
+	if oldest == nil {
+		return nil, nil
+	}
+
+	arm := assignArm(oldest, riderID)
+	if arm == nil {
+		return nil, nil
+	}
+
+	return &models.PricingExperimentAssignment{
+		ExperimentID: oldest.ID,
+		Experiment:   oldest.Name,
+		Arm:          arm.Name,
+		Fare:         arm.Fare,
+		Surge:        arm.Surge,
+	}, nil
+}
+
+// RecordExposure counts a quote priced under an experiment arm.
+func (s *pricingExperimentService) RecordExposure(ctx context.Context, quote *models.FareQuote) error {
+	if quote.Experiment == nil {
+		return nil
+	}
+
+	return s.experimentRepo.CreateExposure(ctx, &models.PricingExperimentExposure{
+		ExperimentID:    quote.Experiment.ExperimentID,
+		Arm:             quote.Experiment.Arm,
+		RiderID:         quote.RiderID,
+		QuoteID:         quote.QuoteID,
+		Fare:            quote.Fare,
+		SurgeMultiplier: quote.SurgeMultiplier,
+	})
+}
+
+// RecordConversion counts a quote that was booked as a ride.
+func (s *pricingExperimentService) RecordConversion(ctx context.Context, quote *models.FareQuote, rideID primitive.ObjectID) error {
+	if quote.Experiment == nil {
+		return nil
+	}
+
+	return s.experimentRepo.MarkConverted(ctx, quote.QuoteID, rideID, time.Now())
+}
+
+// Reporting
+
+// GetReport compares conversion from quote to booking, completion of booked
+// rides and revenue per quote across arms. Intervals are 95%: Wilson intervals
+// for the rates and normal intervals for revenue and for the differences to
+// the control arm.
+func (s *pricingExperimentService) GetReport(ctx context.Context, id primitive.ObjectID) (*PricingExperimentReport, error) {
+	experiment, err := s.experimentRepo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	stats, err := s.experimentRepo.GetArmStats(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get pricing experiment stats: %w", err)
+	}
+
+	byArm := make(map[string]map[string]interface{}, len(stats))
+	for _, stat := range stats {
+		byArm[stringValue(stat["arm"])] = stat
+	}
+
+	now := time.Now()
+	report := &PricingExperimentReport{
+		ExperimentID:      experiment.ID,
+		Name:              experiment.Name,
+		Currency:          experiment.Currency,
+		IsRunning:         experiment.IsRunning(now),
+		IsKilled:          experiment.IsKilled,
+		StartDate:         experiment.StartDate,
+		EndDate:           experiment.EndDate,
+		TrafficAllocation: experiment.TrafficAllocation,
+		GeneratedAt:       now,
+	}
+
+	var control *ExperimentArmResult
+	for _, arm := range experiment.Arms {
+		stat := byArm[arm.Name]
+		quotes, _ := stat["quotes"].(int64)
+		rides, _ := stat["rides"].(int64)
+		completed, _ := stat["completed"].(int64)
+		revenue, _ := stat["revenue"].(float64)
+		revenueSquared, _ := stat["revenue_squared"].(float64)
+
+		result := &ExperimentArmResult{
+			Arm:             arm.Name,
+			IsControl:       arm.IsControl,
+			Quotes:          quotes,
+			Rides:           rides,
+			Completed:       completed,
+			Revenue:         money.FromMajor(revenue, experiment.Currency),
+			Conversion:      proportionEstimate(rides, quotes),
+			CompletionRate:  proportionEstimate(completed, rides),
+			RevenuePerQuote: meanEstimate(revenue, revenueSquared, quotes),
+		}
+		if arm.IsControl {
+			control = result
+		}
+		report.Arms = append(report.Arms, result)
+	}
+
+	if control != nil {
+		for _, result := range report.Arms {
+			if result.IsControl {
+				continue
+			}
+			result.VsControl = &ExperimentArmDelta{
+				Conversion:      differenceEstimate(result.Conversion, control.Conversion),
+				CompletionRate:  differenceEstimate(result.CompletionRate, control.CompletionRate),
+				RevenuePerQuote: differenceEstimate(result.RevenuePerQuote, control.RevenuePerQuote),
+			}
+		}
+	}
+
+	return report, nil
+}
+
+// Helper methods
+
+func validatePricingExperiment(experiment *models.PricingExperiment) error {
+	if strings.TrimSpace(experiment.Name) == "" {
+		return fmt.Errorf("experiment name is required")
+	}
+	if len(experiment.Cities) == 0 || len(experiment.RideTypes) == 0 {
+		return fmt.Errorf("experiment cities and ride types are required")
+	}
+	if !experiment.EndDate.After(experiment.StartDate) {
+		return fmt.Errorf("end date must be after start date")
+	}
+	if experiment.TrafficAllocation < 0 || experiment.TrafficAllocation > 100 {
+		return fmt.Errorf("traffic allocation must be between 0 and 100 percent")
+	}
+	if len(experiment.Arms) < 2 {
+		return fmt.Errorf("an experiment needs a control arm and at least one treatment arm")
+	}
+
+	names := make(map[string]bool, len(experiment.Arms))
+	controls := 0
+	weight := 0.0
+	for _, arm := range experiment.Arms {
+		if arm.Name == "" || names[arm.Name] {
+			return fmt.Errorf("arm names must be present and unique")
+		}
+		names[arm.Name] = true
+
+		if arm.Weight <= 0 {
+			return fmt.Errorf("arm %s needs a positive weight", arm.Name)
+		}
+		weight += arm.Weight
+
+		if arm.IsControl {
+			controls++
+			if arm.Fare != nil || arm.Surge != nil {
+				return fmt.Errorf("the control arm cannot override pricing")
+			}
+			continue
+		}
+		if arm.Fare == nil && arm.Surge == nil {
+			return fmt.Errorf("arm %s overrides neither fares nor surge", arm.Name)
+		}
+		if err := validateArmOverrides(&arm); err != nil {
+			return err
+		}
+	}
+
+	if controls != 1 {
+		return fmt.Errorf("an experiment needs exactly one control arm")
+	}
+	if math.Abs(weight-100) > percentageTolerance {
+		return fmt.Errorf("arm weights must add up to 100, got %.2f", weight)
+	}
+
+	return nil
+}
+
+func validateArmOverrides(arm *models.PricingExperimentArm) error {
+	if fare := arm.Fare; fare != nil {
+		if fare.PricePerKM != nil && *fare.PricePerKM < 0 || fare.PricePerMinute != nil && *fare.PricePerMinute < 0 {
+			return fmt.Errorf("arm %s fare rates cannot be negative", arm.Name)
+		}
+		for _, amount := range fare.Amounts() {
+			if amount.IsNegative() {
+				return fmt.Errorf("arm %s fare amounts cannot be negative", arm.Name)
+			}
+		}
+	}
+
+	if surge := arm.Surge; surge != nil {
+		if len(surge.Curve) == 0 {
+			return fmt.Errorf("arm %s surge curve needs at least one point", arm.Name)
+		}
+		for _, point := range surge.Curve {
+			if point.Ratio < 0 || point.Multiplier < utils.MinSurgeMultiplier || point.Multiplier > utils.MaxSurgeMultiplier {
+				return fmt.Errorf("arm %s surge multipliers must be between %.1f and %.1f", arm.Name, utils.MinSurgeMultiplier, utils.MaxSurgeMultiplier)
+			}
+		}
+		if surge.MaxMultiplier < 0 || surge.MaxMultiplier > utils.MaxSurgeMultiplier {
+			return fmt.Errorf("arm %s maximum surge cannot exceed %.1f", arm.Name, utils.MaxSurgeMultiplier)
+		}
+	}
+
+	return nil
+}
+
+// experimentBucket hashes a rider into one of experimentBuckets buckets. The
+// salt separates the enrollment draw from the arm draw, so changing the
+// traffic allocation never moves an enrolled rider to another arm.
+func experimentBucket(salt string, experimentID, riderID primitive.ObjectID) int {
+	hash := fnv.New64a()
+	hash.Write([]byte(salt + ":" + experimentID.Hex() + ":" + riderID.Hex()))
+	return int(hash.Sum64() % experimentBuckets)
+}
+
+// assignArm picks a rider's arm by walking the cumulative arm weights.
+func assignArm(experiment *models.PricingExperiment, riderID primitive.ObjectID) *models.PricingExperimentArm {
+	bucket := experimentBucket("arm", experiment.ID, riderID)
+
+	cumulative := 0.0
+	for i := range experiment.Arms {
+		cumulative += experiment.Arms[i].Weight
+		if bucket < int(math.Round(cumulative*100)) {
+			return &experiment.Arms[i]
+		}
+	}
+
+	// Weights that add up to a hair under 100 leave the top buckets to the
+	// last arm
+	if len(experiment.Arms) == 0 {
+		return nil
+	}
+	return &experiment.Arms[len(experiment.Arms)-1]
+}
+
+// proportionEstimate returns a rate with its Wilson score interval, which
+// stays within 0 and 1 and behaves for small samples.
+func proportionEstimate(successes, trials int64) *MetricEstimate {
+	if trials <= 0 {
+		return &MetricEstimate{}
+	}
+
+	n := float64(trials)
+	p := float64(successes) / n
+	z2 := confidenceZ * confidenceZ
+
+	center := (p + z2/(2*n)) / (1 + z2/n)
+	margin := confidenceZ * math.Sqrt(p*(1-p)/n+z2/(4*n*n)) / (1 + z2/n)
+
+	return &MetricEstimate{
+		Value:         p,
+		Lower:         math.Max(0, center-margin),
+		Upper:         math.Min(1, center+margin),
+		standardError: math.Sqrt(p * (1 - p) / n),
+	}
+}
+
+// meanEstimate returns the mean of n values, given their sum and sum of
+// squares, with a normal interval.
+func meanEstimate(sum, sumSquares float64, count int64) *MetricEstimate {
+	if count <= 0 {
+		return &MetricEstimate{}
+	}
+
+	n := float64(count)
+	mean := sum / n
+	variance := 0.0
+	if count > 1 {
+		variance = math.Max(0, (sumSquares-n*mean*mean)/(n-1))
+	}
+	standardError := math.Sqrt(variance / n)
+
+	return &MetricEstimate{
+		Value:         mean,
+		Lower:         mean - confidenceZ*standardError,
+		Upper:         mean + confidenceZ*standardError,
+		standardError: standardError,
+	}
+}
+
+// differenceEstimate returns treatment minus control, treating the arms as
+// independent samples.
+func differenceEstimate(treatment, control *MetricEstimate) *MetricEstimate {
+	difference := treatment.Value - control.Value
+	standardError := math.Sqrt(treatment.standardError*treatment.standardError + control.standardError*control.standardError)
+
+	return &MetricEstimate{
+		Value:         difference,
+		Lower:         difference - confidenceZ*standardError,
+		Upper:         difference + confidenceZ*standardError,
+		standardError: standardError,
+	}
+}
@@ -0,0 +1,966 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"goride/internal/config"
+	"goride/internal/models"
+	"goride/internal/repositories/interfaces"
+	"goride/internal/utils"
+	"goride/pkg/logger"
+	"goride/pkg/money"
+	"goride/pkg/payment"
+	"goride/pkg/websocket"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type RidePassService interface {
+	// Plans
+	CreatePlan(ctx context.Context, adminID primitive.ObjectID, plan *models.RidePassPlan) (*models.RidePassPlan, error)
+	DeactivatePlan(ctx context.Context, planID primitive.ObjectID) error
+	ListPlans(ctx context.Context, activeOnly bool, params *utils.PaginationParams) ([]*models.RidePassPlan, int64, error)
+
+	// Subscriptions
+	Subscribe(ctx context.Context, riderID, planID primitive.ObjectID) (*models.RidePassSubscription, error)
+	ChangePlan(ctx context.Context, riderID, planID primitive.ObjectID) (*models.RidePassSubscription, error)
+	CancelSubscription(ctx context.Context, riderID primitive.ObjectID, immediately bool) (*models.RidePassSubscription, error)
+	GetSubscription(ctx context.Context, riderID primitive.ObjectID) (*models.RidePassSubscription, error)
+
+	// Benefits
+	GetActivePass(ctx context.Context, riderID primitive.ObjectID, city string, rideType models.RideType, at time.Time) (*models.RidePassSubscription, error)
+
+	// Billing
+	Start(ctx context.Context)
+	ProcessRenewals(ctx context.Context) error
+	SettlePayment(ctx context.Context, p *models.Payment) error
+
+	// Savings
+	GetSavings(ctx context.Context, riderID, subscriptionID primitive.ObjectID) (*RidePassSavings, error)
+}
+
+// RidePassSavings sets what a subscriber paid for each billing period against
+// what the pass saved them on rides completed in it.
+type RidePassSavings struct {
+	SubscriptionID primitive.ObjectID      `json:"subscription_id"`
+	PlanName       string                  `json:"plan_name"`
+	Periods        []RidePassPeriodSavings `json:"periods"`
+	TotalPaid      money.Money             `json:"total_paid"`
+	TotalSavings   money.Money             `json:"total_savings"`
+}
+
+type RidePassPeriodSavings struct {
+	Start   time.Time   `json:"start"`
+	End     time.Time   `json:"end"`
+	Paid    money.Money `json:"paid"` // charged less refunds
+	Rides   int64       `json:"rides"`
+	Savings money.Money `json:"savings"`
+}
+
+// Ride pass websocket events
+const (
+	RidePassEventRenewed       = "ride_pass_renewed"
+	RidePassEventPaymentFailed = "ride_pass_payment_failed"
+	RidePassEventExpired       = "ride_pass_expired"
+)
+
+const (
+	ridePassRenewalLock     = "ride_pass:renewals"
+	ridePassRiderLockPrefix = "ride_pass:rider:"
+	ridePassRiderLockTTL    = 30 * time.Second
+)
+
+type ridePassService struct {
+	ridePassRepo    interfaces.RidePassRepository
+	riderRepo       interfaces.RiderRepository
+	rideRepo        interfaces.RideRepository
+	paymentRepo     interfaces.PaymentRepository
+	paymentProvider payment.PaymentProvider
+	exchangeService ExchangeRateService
+	walletService   WalletService
+	cache           CacheService
+	wsHandler       *websocket.Handler
+	config          *config.RidePassConfig
+	logger          *logger.Logger
+}
+
+func NewRidePassService(
+	ridePassRepo interfaces.RidePassRepository,
+	riderRepo interfaces.RiderRepository,
+	rideRepo interfaces.RideRepository,
+	paymentRepo interfaces.PaymentRepository,
+	paymentProvider payment.PaymentProvider,
+	exchangeService ExchangeRateService,
+	walletService WalletService,
+	cache CacheService,
+	wsHandler *websocket.Handler,
+	config *config.RidePassConfig,
+	logger *logger.Logger,
+) RidePassService {
+	return &ridePassService{
+		ridePassRepo:    ridePassRepo,
+		riderRepo:       riderRepo,
+		rideRepo:        rideRepo,
+		paymentRepo:     paymentRepo,
+		paymentProvider: paymentProvider,
+		exchangeService: exchangeService,
+		walletService:   walletService,
+		cache:           cache,
+		wsHandler:       wsHandler,
+		config:          config,
+		logger:          logger,
+	}
+}
+
+// Plans
+func (s *ridePassService) CreatePlan(ctx context.Context, adminID primitive.ObjectID, plan *models.RidePassPlan) (*models.RidePassPlan, error) {
+	plan.Price.Currency = strings.ToUpper(plan.Price.Currency)
+	if plan.Benefits.MaxDiscount.Currency == "" {
+		plan.Benefits.MaxDiscount = money.Zero(plan.Price.Currency)
+	}
+
+	if err := validateRidePassPlan(plan); err != nil {
+		return nil, err
+	}
+
+	plan.IsActive = true
+	plan.CreatedBy = &adminID
+
+	if err := s.ridePassRepo.CreatePlan(ctx, plan); err != nil {
+		return nil, fmt.Errorf("failed to create ride pass plan: %w", err)
+	}
+
+	s.logger.WithUserID(adminID).
+		WithField("plan_id", plan.ID.Hex()).
+		WithField("price", plan.Price.String()).
+		WithField("currency", plan.Price.Currency).
+		WithField("interval", plan.Interval).
+		Info("Ride pass plan created")
+
+	return plan, nil
+}
+
+// DeactivatePlan stops new subscriptions to a plan. Current subscribers keep
+// their pass until the end of the period they paid for; it is not renewed.
+func (s *ridePassService) DeactivatePlan(ctx context.Context, planID primitive.ObjectID) error {
+	if err := s.ridePassRepo.UpdatePlan(ctx, planID, map[string]interface{}{
+		"is_active": false,
+	}); err != nil {
+		return fmt.Errorf("failed to deactivate ride pass plan: %w", err)
+	}
+	return nil
+}
+
+func (s *ridePassService) ListPlans(ctx context.Context, activeOnly bool, params *utils.PaginationParams) ([]*models.RidePassPlan, int64, error) {
+	return s.ridePassRepo.ListPlans(ctx, activeOnly, params)
+}
+
+// Subscriptions
+
+// Subscribe charges the plan's price to the rider's default payment method
+// and starts the first billing period. No subscription is created when the
+// charge fails; one the provider has not confirmed leaves the pass pending,
+// without benefits, until it is.
+func (s *ridePassService) Subscribe(ctx context.Context, riderID, planID primitive.ObjectID) (*models.RidePassSubscription, error) {
+	lock, err := s.lockRider(ctx, riderID)
+	if err != nil {
+		return nil, err
+	}
+	defer s.cache.Unlock(ctx, lock)
+
+	plan, err := s.activePlan(ctx, planID)
+	if err != nil {
+		return nil, err
+	}
+
+	current, err := s.ridePassRepo.GetCurrentSubscriptions(ctx, riderID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get ride pass subscriptions: %w", err)
+	}
+	if len(current) > 0 {
+		return nil, fmt.Errorf("rider already has a ride pass")
+	}
+
+	charge, err := s.charge(ctx, riderID, plan.Price, map[string]interface{}{
+		"plan_id": plan.ID.Hex(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if charge.Status == models.PaymentStatusFailed {
+		return nil, fmt.Errorf("ride pass payment failed: %s", charge.FailureReason)
+	}
+
+	now := time.Now()
+	subscription := &models.RidePassSubscription{
+		RiderID:            riderID,
+		Status:             models.RidePassStatusActive,
+		PaymentMethodID:    charge.PaymentMethodID,
+		CurrentPeriodStart: now,
+		CurrentPeriodEnd:   plan.Interval.Next(now),
+	}
+	if charge.Status == models.PaymentStatusPending {
+		subscription.Status = models.RidePassStatusPending
+		subscription.PendingPaymentID = &charge.ID
+	}
+	applyRidePassPlan(subscription, plan)
+	subscription.Periods = []models.RidePassPeriod{{
+		Start:     subscription.CurrentPeriodStart,
+		End:       subscription.CurrentPeriodEnd,
+		PlanID:    plan.ID,
+		Amount:    charge.Amount,
+		Credit:    money.Zero(plan.Price.Currency),
+		Refunded:  money.Zero(plan.Price.Currency),
+		PaymentID: &charge.ID,
+	}}
+
+	if err := s.ridePassRepo.CreateSubscription(ctx, subscription); err != nil {
+		return nil, fmt.Errorf("failed to create ride pass subscription: %w", err)
+	}
+
+	s.logger.WithUserID(riderID).
+		WithField("subscription_id", subscription.ID.Hex()).
+		WithField("plan_id", plan.ID.Hex()).
+		WithField("status", subscription.Status).
+		Info("Ride pass subscribed")
+
+	return subscription, nil
+}
+
+// ChangePlan moves a subscriber to another plan at once. The unused part of
+// the current period is credited against the new plan's price; a credit
+// larger than the price is refunded to the payment of the current period.
+// The plan is only changed once the charge is confirmed; should a charge the
+// provider did not answer go through later, it is refunded.
+func (s *ridePassService) ChangePlan(ctx context.Context, riderID, planID primitive.ObjectID) (*models.RidePassSubscription, error) {
+	lock, err := s.lockRider(ctx, riderID)
+	if err != nil {
+		return nil, err
+	}
+	defer s.cache.Unlock(ctx, lock)
+
+	subscription, err := s.GetSubscription(ctx, riderID)
+	if err != nil {
+		return nil, err
+	}
+	switch subscription.Status {
+	case models.RidePassStatusActive:
+	case models.RidePassStatusPending:
+		return nil, fmt.Errorf("ride pass payment is not confirmed yet")
+	default:
+		return nil, fmt.Errorf("ride pass payment is past due")
+	}
+	if subscription.PlanID == planID {
+		return nil, fmt.Errorf("rider is already on this plan")
+	}
+
+	plan, err := s.activePlan(ctx, planID)
+	if err != nil {
+		return nil, err
+	}
+	if !plan.Price.SameCurrency(subscription.Price) {
+		return nil, fmt.Errorf("ride pass plan is priced in %s, not %s", plan.Price.Currency, subscription.Price.Currency)
+	}
+
+	now := time.Now()
+	credit := subscription.Price.Multiply(unusedFraction(subscription.CurrentPeriodStart, subscription.CurrentPeriodEnd, now))
+	due, err := plan.Price.Sub(credit)
+	if err != nil {
+		return nil, err
+	}
+
+	period := models.RidePassPeriod{
+		Start:    now,
+		End:      plan.Interval.Next(now),
+		PlanID:   plan.ID,
+		Amount:   money.Zero(plan.Price.Currency),
+		Credit:   credit,
+		Refunded: money.Zero(plan.Price.Currency),
+	}
+
+	if due.IsPositive() {
+		charge, err := s.charge(ctx, riderID, due, map[string]interface{}{
+			"plan_id":         plan.ID.Hex(),
+			"subscription_id": subscription.ID.Hex(),
+		})
+		if err != nil {
+			return nil, err
+		}
+		switch charge.Status {
+		case models.PaymentStatusFailed:
+			return nil, fmt.Errorf("ride pass payment failed: %s", charge.FailureReason)
+		case models.PaymentStatusPending:
+			return nil, fmt.Errorf("ride pass payment could not be confirmed, the plan was not changed")
+		}
+		period.Amount = charge.Amount
+		period.PaymentID = &charge.ID
+	}
+
+	// The closing period is updated before the new one is pushed; MongoDB
+	// does not allow both on the periods array in a single update
+	closing, err := s.closePeriod(ctx, subscription, now, due.Neg(), "ride pass plan change")
+	if err != nil {
+		return nil, err
+	}
+	if err := s.ridePassRepo.UpdateSubscription(ctx, subscription.ID, closing); err != nil {
+		return nil, fmt.Errorf("failed to close ride pass period: %w", err)
+	}
+
+	subscription.CurrentPeriodStart = period.Start
+	subscription.CurrentPeriodEnd = period.End
+	subscription.CancelAtPeriodEnd = false
+	subscription.CancelledAt = nil
+	applyRidePassPlan(subscription, plan)
+
+	if err := s.ridePassRepo.AppendPeriod(ctx, subscription.ID, &period, map[string]interface{}{
+		"plan_id":              subscription.PlanID,
+		"plan_name":            subscription.PlanName,
+		"price":                subscription.Price,
+		"interval":             subscription.Interval,
+		"grace_period_days":    subscription.GracePeriodDays,
+		"benefits":             subscription.Benefits,
+		"current_period_start": subscription.CurrentPeriodStart,
+		"current_period_end":   subscription.CurrentPeriodEnd,
+		"cancel_at_period_end": false,
+		"cancelled_at":         nil,
+	}); err != nil {
+		return nil, fmt.Errorf("failed to change ride pass plan: %w", err)
+	}
+
+	return s.ridePassRepo.GetSubscriptionByID(ctx, subscription.ID)
+}
+
+// CancelSubscription ends a pass at the end of the period paid for, or at once
+// with the unused part of the period refunded. A pass past due or pending has
+// nothing to refund and is always cancelled at once; a pending charge that
+// goes through afterwards is refunded.
+func (s *ridePassService) CancelSubscription(ctx context.Context, riderID primitive.ObjectID, immediately bool) (*models.RidePassSubscription, error) {
+	lock, err := s.lockRider(ctx, riderID)
+	if err != nil {
+		return nil, err
+	}
+	defer s.cache.Unlock(ctx, lock)
+
+	subscription, err := s.GetSubscription(ctx, riderID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	var updates map[string]interface{}
+	if immediately || subscription.Status != models.RidePassStatusActive {
+		refund := money.Zero(subscription.Price.Currency)
+		if subscription.Status == models.RidePassStatusActive {
+			refund = subscription.Price.Multiply(unusedFraction(subscription.CurrentPeriodStart, subscription.CurrentPeriodEnd, now))
+		}
+
+		updates, err = s.closePeriod(ctx, subscription, now, refund, "ride pass cancelled")
+		if err != nil {
+			return nil, err
+		}
+		updates["status"] = models.RidePassStatusCancelled
+		updates["current_period_end"] = now
+		updates["grace_until"] = nil
+	} else {
+		updates = map[string]interface{}{
+			"cancel_at_period_end": true,
+		}
+	}
+	updates["cancelled_at"] = now
+
+	if err := s.ridePassRepo.UpdateSubscription(ctx, subscription.ID, updates); err != nil {
+		return nil, fmt.Errorf("failed to cancel ride pass subscription: %w", err)
+	}
+
+	s.logger.WithUserID(riderID).
+		WithField("subscription_id", subscription.ID.Hex()).
+		WithField("immediately", immediately).
+		Info("Ride pass cancelled")
+
+	return s.ridePassRepo.GetSubscriptionByID(ctx, subscription.ID)
+}
+
+func (s *ridePassService) GetSubscription(ctx context.Context, riderID primitive.ObjectID) (*models.RidePassSubscription, error) {
+	subscriptions, err := s.ridePassRepo.GetCurrentSubscriptions(ctx, riderID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get ride pass subscriptions: %w", err)
+	}
+	if len(subscriptions) == 0 {
+		return nil, fmt.Errorf("rider has no ride pass")
+	}
+	return subscriptions[0], nil
+}
+
+// Benefits
+
+// GetActivePass returns the rider's pass when its benefits cover a ride in the
+// city and ride type at the given time, and nil otherwise.
+func (s *ridePassService) GetActivePass(ctx context.Context, riderID primitive.ObjectID, city string, rideType models.RideType, at time.Time) (*models.RidePassSubscription, error) {
+	subscriptions, err := s.ridePassRepo.GetCurrentSubscriptions(ctx, riderID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get ride pass subscriptions: %w", err)
+	}
+
+	for _, subscription := range subscriptions {
+		if subscription.IsEntitled(at) && subscription.Benefits.AppliesTo(city, rideType) {
+			return subscription, nil
+		}
+	}
+	return nil, nil
+}
+
+// Billing
+
+// Start runs the renewal worker until the context is cancelled.
+func (s *ridePassService) Start(ctx context.Context) {
+	ticker := time.NewTicker(s.config.RenewalInterval)
+	defer ticker.Stop()
+
+	s.logger.WithField("interval", s.config.RenewalInterval.String()).
+		Info("Ride pass renewal worker started")
+
+	for {
+		select {
+		case <-ctx.Done():
+			s.logger.Info("Ride pass renewal worker stopped")
+			return
+		case <-ticker.C:
+			if err := s.ProcessRenewals(ctx); err != nil {
+				s.logger.WithError(err).Error("Failed to process ride pass renewals")
+			}
+		}
+	}
+}
+
+// ProcessRenewals bills subscriptions whose period has ended. A failed charge
+// puts the pass past due and is retried every RetryInterval until the grace
+// period runs out, when the pass expires. Passes cancelled at period end and
+// passes on a deactivated plan expire instead of renewing.
+func (s *ridePassService) ProcessRenewals(ctx context.Context) error {
+	lock, err := s.cache.Lock(ctx, ridePassRenewalLock, s.config.RenewalInterval)
+	if err != nil {
+		// Another instance holds the run
+		return nil
+	}
+	defer s.cache.Unlock(ctx, lock)
+
+	now := time.Now()
+	due, err := s.ridePassRepo.GetDueSubscriptions(ctx, now, s.config.RenewalBatch)
+	if err != nil {
+		return fmt.Errorf("failed to get due ride pass subscriptions: %w", err)
+	}
+
+	for _, subscription := range due {
+		if err := s.renew(ctx, subscription, now); err != nil {
+			s.logger.WithError(err).
+				WithUserID(subscription.RiderID).
+				WithField("subscription_id", subscription.ID.Hex()).
+				Error("Failed to renew ride pass")
+		}
+	}
+
+	return nil
+}
+
+// SettlePayment applies the outcome of a ride pass charge that was pending
+// once the provider answers: a pending pass is activated or, if the charge
+// failed, expired, and a renewal is completed or put past due. A confirmed
+// charge no pass is waiting for, such as one for a refused plan change, is
+// refunded.
+func (s *ridePassService) SettlePayment(ctx context.Context, p *models.Payment) error {
+	if p.PaymentType != models.PaymentTypeSubscription || p.Status == models.PaymentStatusPending {
+		return nil
+	}
+
+	subscriptions, err := s.ridePassRepo.GetCurrentSubscriptions(ctx, p.PayerID)
+	if err != nil {
+		return fmt.Errorf("failed to get ride pass subscriptions: %w", err)
+	}
+
+	var subscription *models.RidePassSubscription
+	for _, current := range subscriptions {
+		if current.PendingPaymentID != nil && *current.PendingPaymentID == p.ID {
+			subscription = current
+		}
+	}
+
+	switch {
+	case subscription == nil:
+		if p.Status != models.PaymentStatusCompleted {
+			return nil
+		}
+		s.logger.WithUserID(p.PayerID).
+			WithField("payment_id", p.ID.Hex()).
+			Warn("Refunding ride pass payment no pass was waiting for")
+		return s.refund(ctx, p, p.Amount, p.Amount, "ride pass payment not applied")
+	case subscription.Status == models.RidePassStatusPending:
+		return s.activate(ctx, subscription, p)
+	default:
+		return s.applyRenewal(ctx, subscription, p, time.Now())
+	}
+}
+
+// Savings
+
+// GetSavings reports, for each billing period of a subscription, what the
+// rider paid and what the pass saved on the rides they completed in it.
+func (s *ridePassService) GetSavings(ctx context.Context, riderID, subscriptionID primitive.ObjectID) (*RidePassSavings, error) {
+	subscription, err := s.ridePassRepo.GetSubscriptionByID(ctx, subscriptionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get ride pass subscription: %w", err)
+	}
+	if subscription.RiderID != riderID {
+		return nil, fmt.Errorf("ride pass subscription not found")
+	}
+
+	currency := subscription.Price.Currency
+	savings := &RidePassSavings{
+		SubscriptionID: subscription.ID,
+		PlanName:       subscription.PlanName,
+		TotalPaid:      money.Zero(currency),
+		TotalSavings:   money.Zero(currency),
+	}
+	if len(subscription.Periods) == 0 {
+		return savings, nil
+	}
+
+	// Periods follow each other, so their starts and the last end delimit
+	// them; a period closed the moment it began adds no boundary
+	var boundaries []time.Time
+	for _, period := range subscription.Periods {
+		if len(boundaries) == 0 || period.Start.After(boundaries[len(boundaries)-1]) {
+			boundaries = append(boundaries, period.Start)
+		}
+	}
+	if end := subscription.Periods[len(subscription.Periods)-1].End; end.After(boundaries[len(boundaries)-1]) {
+		boundaries = append(boundaries, end)
+	}
+
+	buckets, err := s.rideRepo.GetRidePassSavings(ctx, subscription.ID, boundaries)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get ride pass savings: %w", err)
+	}
+	byStart := make(map[int64]map[string]interface{}, len(buckets))
+	for _, bucket := range buckets {
+		if start, ok := bucket["period_start"].(time.Time); ok {
+			byStart[start.UnixMilli()] = bucket
+		}
+	}
+
+	for _, period := range subscription.Periods {
+		paid, err := period.Amount.Sub(period.Refunded)
+		if err != nil {
+			return nil, err
+		}
+
+		line := RidePassPeriodSavings{
+			Start:   period.Start,
+			End:     period.End,
+			Paid:    paid,
+			Savings: money.Zero(currency),
+		}
+		if bucket, ok := byStart[period.Start.UnixMilli()]; ok && period.End.After(period.Start) {
+			line.Rides, _ = bucket["rides"].(int64)
+			if saved, ok := bucket["savings"].(money.Money); ok && saved.SameCurrency(line.Savings) {
+				line.Savings = saved
+			}
+		}
+
+		savings.Periods = append(savings.Periods, line)
+		savings.TotalPaid, _ = savings.TotalPaid.Add(line.Paid)
+		savings.TotalSavings, _ = savings.TotalSavings.Add(line.Savings)
+	}
+
+	return savings, nil
+}
+
+// Helper methods
+
+func (s *ridePassService) activePlan(ctx context.Context, planID primitive.ObjectID) (*models.RidePassPlan, error) {
+	plan, err := s.ridePassRepo.GetPlanByID(ctx, planID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get ride pass plan: %w", err)
+	}
+	if !plan.IsActive {
+		return nil, fmt.Errorf("ride pass plan is not available")
+	}
+	return plan, nil
+}
+
+// lockRider serializes the changes to a rider's ride pass, so a plan change,
+// a cancellation and a renewal never work from the same stale subscription.
+func (s *ridePassService) lockRider(ctx context.Context, riderID primitive.ObjectID) (*DistributedLock, error) {
+	lock, err := s.cache.Lock(ctx, ridePassRiderLockPrefix+riderID.Hex(), ridePassRiderLockTTL)
+	if err != nil {
+		return nil, fmt.Errorf("ride pass is being updated, please retry: %w", err)
+	}
+	return lock, nil
+}
+
+// renew bills one due subscription. A subscription the rider is changing is
+// left for the next run.
+func (s *ridePassService) renew(ctx context.Context, subscription *models.RidePassSubscription, now time.Time) error {
+	lock, err := s.lockRider(ctx, subscription.RiderID)
+	if err != nil {
+		return nil
+	}
+	defer s.cache.Unlock(ctx, lock)
+
+	// Reload it, as the rider may have changed it since it was listed as due
+	subscription, err = s.ridePassRepo.GetSubscriptionByID(ctx, subscription.ID)
+	if err != nil {
+		return fmt.Errorf("failed to get ride pass subscription: %w", err)
+	}
+	switch subscription.Status {
+	case models.RidePassStatusActive, models.RidePassStatusPastDue:
+	default:
+		return nil
+	}
+	if now.Before(subscription.CurrentPeriodEnd) {
+		return nil
+	}
+
+	switch {
+	case subscription.CancelAtPeriodEnd:
+		return s.expire(ctx, subscription, "cancelled")
+	case subscription.Status == models.RidePassStatusPastDue &&
+		subscription.GraceUntil != nil && !now.Before(*subscription.GraceUntil):
+		return s.expire(ctx, subscription, "payment failed")
+	case subscription.PendingPaymentID != nil:
+		// The last charge is still waiting for the provider's answer
+		return nil
+	case subscription.LastRenewalAttempt != nil && now.Sub(*subscription.LastRenewalAttempt) < s.config.RetryInterval:
+		return nil
+	}
+
+	plan, err := s.ridePassRepo.GetPlanByID(ctx, subscription.PlanID)
+	if err != nil {
+		return fmt.Errorf("failed to get ride pass plan: %w", err)
+	}
+	if !plan.IsActive {
+		return s.expire(ctx, subscription, "plan discontinued")
+	}
+
+	charge, err := s.charge(ctx, subscription.RiderID, subscription.Price, map[string]interface{}{
+		"plan_id":         subscription.PlanID.Hex(),
+		"subscription_id": subscription.ID.Hex(),
+	})
+	if err != nil {
+		return err
+	}
+
+	if charge.Status == models.PaymentStatusPending {
+		if err := s.ridePassRepo.UpdateSubscription(ctx, subscription.ID, map[string]interface{}{
+			"pending_payment_id":   charge.ID,
+			"last_renewal_attempt": now,
+		}); err != nil {
+			return fmt.Errorf("failed to record pending ride pass renewal: %w", err)
+		}
+		return nil
+	}
+
+	return s.applyRenewal(ctx, subscription, charge, now)
+}
+
+// applyRenewal starts the next period of a subscription its renewal charge
+// paid for, or puts the pass past due when the charge failed.
+func (s *ridePassService) applyRenewal(ctx context.Context, subscription *models.RidePassSubscription, charge *models.Payment, now time.Time) error {
+	if charge.Status == models.PaymentStatusFailed {
+		graceUntil := subscription.CurrentPeriodEnd.AddDate(0, 0, subscription.GracePeriodDays)
+		if !now.Before(graceUntil) {
+			return s.expire(ctx, subscription, "payment failed")
+		}
+
+		if err := s.ridePassRepo.UpdateSubscription(ctx, subscription.ID, map[string]interface{}{
+			"status":               models.RidePassStatusPastDue,
+			"grace_until":          graceUntil,
+			"renewal_attempts":     subscription.RenewalAttempts + 1,
+			"last_renewal_attempt": now,
+			"pending_payment_id":   nil,
+		}); err != nil {
+			return fmt.Errorf("failed to mark ride pass past due: %w", err)
+		}
+
+		s.notify(subscription, RidePassEventPaymentFailed, map[string]interface{}{
+			"reason":      charge.FailureReason,
+			"grace_until": graceUntil,
+		})
+		return nil
+	}
+
+	// Renewals run on from the previous period so that a payment recovered
+	// in the grace period pays for the days already used; a pass that fell
+	// more than a period behind starts afresh
+	start := subscription.CurrentPeriodEnd
+	if !subscription.Interval.Next(start).After(now) {
+		start = now
+	}
+
+	period := &models.RidePassPeriod{
+		Start:     start,
+		End:       subscription.Interval.Next(start),
+		PlanID:    subscription.PlanID,
+		Amount:    charge.Amount,
+		Credit:    money.Zero(charge.Amount.Currency),
+		Refunded:  money.Zero(charge.Amount.Currency),
+		PaymentID: &charge.ID,
+	}
+	if err := s.ridePassRepo.AppendPeriod(ctx, subscription.ID, period, map[string]interface{}{
+		"status":               models.RidePassStatusActive,
+		"current_period_start": period.Start,
+		"current_period_end":   period.End,
+		"grace_until":          nil,
+		"renewal_attempts":     0,
+		"last_renewal_attempt": now,
+		"pending_payment_id":   nil,
+	}); err != nil {
+		return fmt.Errorf("failed to renew ride pass: %w", err)
+	}
+
+	s.notify(subscription, RidePassEventRenewed, map[string]interface{}{
+		"amount":     charge.Amount.String(),
+		"currency":   charge.Amount.Currency,
+		"period_end": period.End,
+	})
+	return nil
+}
+
+// activate starts a pending pass once its first charge is confirmed, or
+// expires it when the charge failed.
+func (s *ridePassService) activate(ctx context.Context, subscription *models.RidePassSubscription, charge *models.Payment) error {
+	if charge.Status == models.PaymentStatusFailed {
+		s.notify(subscription, RidePassEventPaymentFailed, map[string]interface{}{
+			"reason": charge.FailureReason,
+		})
+		return s.expire(ctx, subscription, "payment failed")
+	}
+
+	if err := s.ridePassRepo.UpdateSubscription(ctx, subscription.ID, map[string]interface{}{
+		"status":             models.RidePassStatusActive,
+		"pending_payment_id": nil,
+	}); err != nil {
+		return fmt.Errorf("failed to activate ride pass: %w", err)
+	}
+
+	s.logger.WithUserID(subscription.RiderID).
+		WithField("subscription_id", subscription.ID.Hex()).
+		Info("Ride pass payment confirmed")
+	return nil
+}
+
+func (s *ridePassService) expire(ctx context.Context, subscription *models.RidePassSubscription, reason string) error {
+	if err := s.ridePassRepo.UpdateSubscription(ctx, subscription.ID, map[string]interface{}{
+		"status":             models.RidePassStatusExpired,
+		"grace_until":        nil,
+		"pending_payment_id": nil,
+	}); err != nil {
+		return fmt.Errorf("failed to expire ride pass: %w", err)
+	}
+
+	s.notify(subscription, RidePassEventExpired, map[string]interface{}{
+		"reason": reason,
+	})
+	return nil
+}
+
+// closePeriod ends the current billing period at the given time and refunds
+// up to the given amount to its payment. The refund is capped at what the
+// period was charged and has not been refunded yet. It returns the updates
+// recording the closed period.
+func (s *ridePassService) closePeriod(ctx context.Context, subscription *models.RidePassSubscription, at time.Time, refund money.Money, reason string) (map[string]interface{}, error) {
+	updates := map[string]interface{}{}
+	if len(subscription.Periods) == 0 {
+		return updates, nil
+	}
+
+	index := len(subscription.Periods) - 1
+	period := subscription.Periods[index]
+	if at.Before(period.End) {
+		updates[fmt.Sprintf("periods.%d.end", index)] = at
+	}
+
+	if !refund.IsPositive() || period.PaymentID == nil {
+		return updates, nil
+	}
+
+	refundable, err := period.Amount.Sub(period.Refunded)
+	if err != nil {
+		return nil, err
+	}
+	if comparison, err := refund.Compare(refundable); err != nil {
+		return nil, err
+	} else if comparison > 0 {
+		s.logger.WithUserID(subscription.RiderID).
+			WithField("subscription_id", subscription.ID.Hex()).
+			WithField("credit", refund.String()).
+			WithField("refundable", refundable.String()).
+			Warn("Ride pass credit exceeds the refundable amount")
+		refund = refundable
+	}
+	if !refund.IsPositive() {
+		return updates, nil
+	}
+
+	charge, err := s.paymentRepo.GetByID(ctx, *period.PaymentID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get ride pass payment: %w", err)
+	}
+
+	refunded, err := period.Refunded.Add(refund)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.refund(ctx, charge, refund, refunded, reason); err != nil {
+		return nil, err
+	}
+
+	updates[fmt.Sprintf("periods.%d.refunded", index)] = refunded
+	return updates, nil
+}
+
+// refund refunds an amount of a ride pass payment, bringing the total
+// refunded on it to the given total.
+func (s *ridePassService) refund(ctx context.Context, charge *models.Payment, amount, refunded money.Money, reason string) error {
+	if _, err := s.paymentProvider.RefundPayment(ctx, &payment.RefundRequest{
+		TransactionID:  charge.TransactionID,
+		Amount:         amount,
+		Reason:         reason,
+		IdempotencyKey: models.RefundIdempotencyKey(charge, refunded),
+	}); err != nil {
+		return fmt.Errorf("failed to refund ride pass payment: %w", err)
+	}
+	if err := s.paymentRepo.ProcessRefund(ctx, charge.ID, refunded, reason); err != nil {
+		s.logger.WithError(err).
+			WithField("payment_id", charge.ID.Hex()).
+			Error("Ride pass refund issued but not recorded on payment")
+	}
+	if _, err := s.walletService.RecordRefund(ctx, charge, amount, fmt.Sprintf("%s:%d", charge.ID.Hex(), refunded.Amount)); err != nil {
+		s.logger.WithError(err).
+			WithField("payment_id", charge.ID.Hex()).
+			Error("Ride pass refund issued but not posted to the ledger")
+	}
+	return nil
+}
+
+// charge bills the rider's default payment method and records the payment,
+// failed or not. A charge the provider did not answer stays pending until
+// recovered. An error is returned only when the payment cannot be recorded.
+func (s *ridePassService) charge(ctx context.Context, riderID primitive.ObjectID, amount money.Money, metadata map[string]interface{}) (*models.Payment, error) {
+	charge := &models.Payment{
+		PayerID:       riderID,
+		PaymentMethod: models.PaymentMethodCreditCard,
+		PaymentType:   models.PaymentTypeSubscription,
+		Status:        models.PaymentStatusPending,
+		Amount:        amount,
+		Currency:      amount.Currency,
+	}
+
+	if err := s.exchangeService.SnapshotPayment(ctx, charge); err != nil {
+		s.logger.WithError(err).WithUserID(riderID).Warn("Ride pass charged without an exchange rate snapshot")
+	}
+
+	rider, err := s.riderRepo.GetByUserID(ctx, riderID)
+	if err != nil || rider.DefaultPaymentID == nil {
+		now := time.Now()
+		charge.Status = models.PaymentStatusFailed
+		charge.FailureReason = "no default payment method"
+		if err != nil {
+			charge.FailureReason = fmt.Sprintf("failed to get rider: %v", err)
+		}
+		charge.FailedAt = &now
+
+		if err := s.paymentRepo.Create(ctx, charge); err != nil {
+			return nil, fmt.Errorf("failed to create ride pass payment: %w", err)
+		}
+		return charge, nil
+	}
+
+	charge.PaymentMethodID = *rider.DefaultPaymentID
+	if err := sendPayment(ctx, s.paymentRepo, s.paymentProvider, s.logger, charge, &payment.PaymentRequest{
+		PaymentMethodID: rider.DefaultPaymentID.Hex(),
+		Amount:          amount,
+		Description:     "Ride pass",
+		CustomerID:      riderID.Hex(),
+		Metadata:        metadata,
+	}); err != nil {
+		return nil, fmt.Errorf("failed to create ride pass payment: %w", err)
+	}
+
+	if charge.Status == models.PaymentStatusCompleted {
+		if _, err := s.walletService.RecordPayment(ctx, charge); err != nil {
+			s.logger.WithError(err).
+				WithUserID(riderID).
+				WithField("payment_id", charge.ID.Hex()).
+				Error("Ride pass charged but not posted to the ledger")
+		}
+	}
+
+	return charge, nil
+}
+
+func (s *ridePassService) notify(subscription *models.RidePassSubscription, eventType string, data map[string]interface{}) {
+	if s.wsHandler == nil {
+		return
+	}
+
+	data["subscription_id"] = subscription.ID.Hex()
+	data["plan_name"] = subscription.PlanName
+	s.wsHandler.SendUserNotification(subscription.RiderID, eventType, data)
+}
+
+// applyRidePassPlan copies the plan's terms onto a subscription.
+func applyRidePassPlan(subscription *models.RidePassSubscription, plan *models.RidePassPlan) {
+	subscription.PlanID = plan.ID
+	subscription.PlanName = plan.Name
+	subscription.Price = plan.Price
+	subscription.Interval = plan.Interval
+	subscription.GracePeriodDays = plan.GracePeriodDays
+	subscription.Benefits = plan.Benefits
+}
+
+// unusedFraction is the share of a period still ahead at the given time.
+func unusedFraction(start, end, at time.Time) float64 {
+	length := end.Sub(start)
+	switch {
+	case length <= 0 || !at.Before(end):
+		return 0
+	case at.Before(start):
+		return 1
+	default:
+		return float64(end.Sub(at)) / float64(length)
+	}
+}
+
+func validateRidePassPlan(plan *models.RidePassPlan) error {
+	benefits := plan.Benefits
+	switch {
+	case plan.Name == "":
+		return fmt.Errorf("ride pass plan name is required")
+	case !plan.Price.IsPositive():
+		return fmt.Errorf("ride pass plan price must be positive")
+	case plan.GracePeriodDays < 0:
+		return fmt.Errorf("grace period cannot be negative")
+	case benefits.DiscountPercent < 0 || benefits.DiscountPercent > 100:
+		return fmt.Errorf("discount percent must be between 0 and 100")
+	case benefits.MaxDiscount.IsNegative():
+		return fmt.Errorf("maximum discount cannot be negative")
+	case !benefits.MaxDiscount.SameCurrency(plan.Price):
+		return fmt.Errorf("maximum discount must be in the plan currency %s", plan.Price.Currency)
+	case benefits.SurgeCap != 0 && benefits.SurgeCap < 1:
+		return fmt.Errorf("surge cap must be at least 1")
+	case benefits.DiscountPercent == 0 && !benefits.WaiveBookingFee && benefits.SurgeCap == 0:
+		return fmt.Errorf("ride pass plan must have at least one benefit")
+	}
+
+	switch plan.Interval {
+	case models.RidePassIntervalWeek, models.RidePassIntervalMonth, models.RidePassIntervalYear:
+	default:
+		return fmt.Errorf("invalid ride pass interval: %s", plan.Interval)
+	}
+
+	return nil
+}
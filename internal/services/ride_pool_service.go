@@ -0,0 +1,1068 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"goride/internal/config"
+	"goride/internal/models"
+	"goride/internal/repositories/interfaces"
+	"goride/internal/utils"
+	"goride/pkg/logger"
+	"goride/pkg/money"
+	"goride/pkg/websocket"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type RidePoolService interface {
+	// Worker
+	Start(ctx context.Context)
+
+	// Pool Matching
+	FindPoolMatch(ctx context.Context, ride *models.Ride) (*PoolMatch, error)
+	JoinPool(ctx context.Context, ride *models.Ride) (*PoolMatch, error)
+
+	// Stop Management
+	GetPoolStops(ctx context.Context, rideID primitive.ObjectID) ([]models.RouteStop, error)
+	CompleteStop(ctx context.Context, rideID primitive.ObjectID, stopIndex int) error
+	RefreshPoolETAs(ctx context.Context, rideID primitive.ObjectID) error
+	CompleteRide(ctx context.Context, rideID, driverID primitive.ObjectID, actualDistance float64, actualDuration int, actualFare float64) (*models.Ride, error)
+
+	// Fare Split
+	SplitPoolFare(ctx context.Context, rideID primitive.ObjectID, totalFare money.Money) ([]*PoolFareShare, error)
+}
+
+type PoolMatch struct {
+	AnchorRideID primitive.ObjectID `json:"anchor_ride_id"`
+	DriverID     primitive.ObjectID `json:"driver_id"`
+	VehicleID    primitive.ObjectID `json:"vehicle_id"`
+	Stops        []models.RouteStop `json:"stops"`
+	PickupIndex  int                `json:"pickup_index"`
+	DropoffIndex int                `json:"dropoff_index"`
+	AddedMinutes float64            `json:"added_minutes"` // extra driving time the insertion costs the pool
+	PickupETA    *time.Time         `json:"pickup_eta"`
+	DropoffETA   *time.Time         `json:"dropoff_eta"`
+}
+
+type PoolFareShare struct {
+	RideID     primitive.ObjectID `json:"ride_id"`
+	RiderID    primitive.ObjectID `json:"rider_id"`
+	DistanceKM float64            `json:"distance_km"`
+	Fare       money.Money        `json:"fare"`
+}
+
+// Pool websocket events
+const (
+	PoolEventETAUpdate    = "pool_eta_update"
+	PoolEventRouteUpdated = "pool_route_updated"
+)
+
+const (
+	poolLockTTL        = 10 * time.Second
+	poolSettlementLock = "ride_pool:settlement"
+)
+
+// poolInsertion is a candidate stop order for a pool with the new rider added.
+type poolInsertion struct {
+	stops        []models.RouteStop
+	pickupIndex  int
+	dropoffIndex int
+	addedMinutes float64
+}
+
+// poolRideWindow holds the minutes from now at which a ride's stops are reached.
+type poolRideWindow struct {
+	pickup    float64
+	hasPickup bool
+	dropoff   float64
+}
+
+type ridePoolService struct {
+	rideRepo     interfaces.RideRepository
+	driverRepo   interfaces.DriverRepository
+	vehicleRepo  interfaces.VehicleRepository
+	locationRepo interfaces.LocationRepository
+	rideService  RideService
+	fareService  FareCalculationService
+	cache        CacheService
+	wsHandler    *websocket.Handler
+	config       *config.PoolConfig
+	logger       *logger.Logger
+}
+
+func NewRidePoolService(
+	rideRepo interfaces.RideRepository,
+	driverRepo interfaces.DriverRepository,
+	vehicleRepo interfaces.VehicleRepository,
+	locationRepo interfaces.LocationRepository,
+	rideService RideService,
+	fareService FareCalculationService,
+	cache CacheService,
+	wsHandler *websocket.Handler,
+	config *config.PoolConfig,
+	logger *logger.Logger,
+) RidePoolService {
+	return &ridePoolService{
+		rideRepo:     rideRepo,
+		driverRepo:   driverRepo,
+		vehicleRepo:  vehicleRepo,
+		locationRepo: locationRepo,
+		rideService:  rideService,
+		fareService:  fareService,
+		cache:        cache,
+		wsHandler:    wsHandler,
+		config:       config,
+		logger:       logger,
+	}
+}
+
+// Worker
+
+// Start charges unsettled pools again until the context is cancelled, so a
+// pool whose settlement failed is charged once whatever failed recovers.
+func (s *ridePoolService) Start(ctx context.Context) {
+	ticker := time.NewTicker(s.config.SettlementInterval)
+	defer ticker.Stop()
+
+	s.logger.WithField("interval", s.config.SettlementInterval.String()).Info("Pool settlement worker started")
+
+	for {
+		select {
+		case <-ctx.Done():
+			s.logger.Info("Pool settlement worker stopped")
+			return
+		case <-ticker.C:
+			lock, err := s.cache.Lock(ctx, poolSettlementLock, s.config.SettlementInterval)
+			if err != nil {
+				// Another instance holds the sweep
+				continue
+			}
+
+			if err := s.settleUnsettledPools(ctx); err != nil {
+				s.logger.WithError(err).Error("Failed to settle shared ride fares")
+			}
+
+			s.cache.Unlock(ctx, lock)
+		}
+	}
+}
+
+// Pool Matching
+
+// FindPoolMatch returns the cheapest detour-bounded insertion of the ride into
+// a nearby shared ride, or nil when no pool can take it.
+func (s *ridePoolService) FindPoolMatch(ctx context.Context, ride *models.Ride) (*PoolMatch, error) {
+	if !ride.IsShared && ride.RideType != models.RideTypeShared {
+		return nil, fmt.Errorf("ride is not a shared ride")
+	}
+	if ride.Status != models.RideStatusRequested {
+		return nil, fmt.Errorf("ride is not awaiting a driver")
+	}
+
+	nearby, err := s.rideRepo.GetNearbyRides(ctx, ride.PickupLocation.Latitude(), ride.PickupLocation.Longitude(), s.config.SearchRadiusKM)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get nearby rides: %w", err)
+	}
+
+	var best *PoolMatch
+	seenDrivers := make(map[primitive.ObjectID]bool)
+	for _, anchor := range nearby {
+		if anchor.ID == ride.ID || !anchor.IsShared || anchor.DriverID == nil {
+			continue
+		}
+		if anchor.Status != models.RideStatusAccepted && anchor.Status != models.RideStatusInProgress {
+			continue
+		}
+
+		// Every member of a pool carries the same plan, so one ride per driver is enough
+		if seenDrivers[*anchor.DriverID] {
+			continue
+		}
+		seenDrivers[*anchor.DriverID] = true
+
+		match, err := s.evaluatePool(ctx, ride, anchor)
+		if err != nil {
+			s.logger.WithError(err).WithRideID(anchor.ID).Warn("Failed to evaluate shared ride for pooling")
+			continue
+		}
+
+		if match != nil && (best == nil || match.AddedMinutes < best.AddedMinutes) {
+			best = match
+		}
+	}
+
+	return best, nil
+}
+
+// JoinPool inserts the ride into the best pool and assigns it that pool's
+// driver. It returns nil when no pool can take the ride, in which case the
+// caller should dispatch it as a new shared ride.
+func (s *ridePoolService) JoinPool(ctx context.Context, ride *models.Ride) (*PoolMatch, error) {
+	match, err := s.FindPoolMatch(ctx, ride)
+	if err != nil || match == nil {
+		return nil, err
+	}
+
+	lock, err := s.cache.Lock(ctx, poolLockKey(match.DriverID), poolLockTTL)
+	if err != nil {
+		return nil, fmt.Errorf("shared ride is being updated, please retry: %w", err)
+	}
+	defer s.cache.Unlock(ctx, lock)
+
+	// Re-evaluate against the latest plan now that the pool is locked
+	anchor, err := s.rideRepo.GetByID(ctx, match.AnchorRideID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get shared ride: %w", err)
+	}
+	match, err = s.evaluatePool(ctx, ride, anchor)
+	if err != nil || match == nil {
+		return nil, err
+	}
+
+	if _, err := s.rideService.AcceptRide(ctx, ride.ID, match.DriverID, match.VehicleID); err != nil {
+		return nil, err
+	}
+
+	origin := s.driverOrigin(ctx, anchor, match.Stops)
+	s.publishETAs(match.Stops, origin)
+	if err := s.savePlan(ctx, match.Stops, origin); err != nil {
+		return nil, err
+	}
+	s.notifyDriver(ctx, match.DriverID, match.Stops)
+
+	s.logger.WithRideID(ride.ID).
+		WithField("anchor_ride_id", match.AnchorRideID.Hex()).
+		WithField("added_minutes", match.AddedMinutes).
+		Info("Rider joined shared ride")
+
+	return match, nil
+}
+
+// Stop Management
+func (s *ridePoolService) GetPoolStops(ctx context.Context, rideID primitive.ObjectID) ([]models.RouteStop, error) {
+	ride, err := s.rideRepo.GetByID(ctx, rideID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get ride: %w", err)
+	}
+
+	return poolStops(ride), nil
+}
+
+func (s *ridePoolService) CompleteStop(ctx context.Context, rideID primitive.ObjectID, stopIndex int) error {
+	ride, err := s.rideRepo.GetByID(ctx, rideID)
+	if err != nil {
+		return fmt.Errorf("failed to get ride: %w", err)
+	}
+	if ride.DriverID == nil {
+		return fmt.Errorf("ride has no driver assigned")
+	}
+
+	lock, err := s.cache.Lock(ctx, poolLockKey(*ride.DriverID), poolLockTTL)
+	if err != nil {
+		return fmt.Errorf("shared ride is being updated, please retry: %w", err)
+	}
+	defer s.cache.Unlock(ctx, lock)
+
+	stops := poolStops(ride)
+	completed, _ := splitPoolStops(stops)
+	if stopIndex != len(completed) {
+		return fmt.Errorf("stops must be completed in order, next stop is %d", len(completed))
+	}
+	if stopIndex >= len(stops) {
+		return fmt.Errorf("invalid stop index")
+	}
+
+	now := time.Now()
+	stops[stopIndex].CompletedAt = &now
+
+	origin := stops[stopIndex].Location
+	s.publishETAs(stops, origin)
+
+	return s.savePlan(ctx, stops, origin)
+}
+
+func (s *ridePoolService) RefreshPoolETAs(ctx context.Context, rideID primitive.ObjectID) error {
+	ride, err := s.rideRepo.GetByID(ctx, rideID)
+	if err != nil {
+		return fmt.Errorf("failed to get ride: %w", err)
+	}
+
+	stops := poolStops(ride)
+	origin := s.driverOrigin(ctx, ride, stops)
+	s.publishETAs(stops, origin)
+
+	return s.savePlan(ctx, stops, origin)
+}
+
+// CompleteRide completes one ride of a pool. Pooled rides are not charged on
+// their own; once the last member ride has ended, the pool is priced as a
+// single trip and each rider is charged their share of it. The ride stays
+// marked unsettled until that succeeds, and the worker retries it until then.
+func (s *ridePoolService) CompleteRide(ctx context.Context, rideID, driverID primitive.ObjectID, actualDistance float64, actualDuration int, actualFare float64) (*models.Ride, error) {
+	ride, err := s.rideService.CompleteRide(ctx, rideID, driverID, actualDistance, actualDuration, actualFare)
+	if err != nil {
+		return nil, err
+	}
+	if !isPooledRide(ride) {
+		return ride, nil
+	}
+
+	// Mark the ride before settling, so a settlement cut short by a crash
+	// is retried as well
+	if err := s.rideRepo.Update(ctx, ride.ID, map[string]interface{}{
+		"pool_settlement_pending": true,
+		"updated_at":              time.Now(),
+	}); err != nil {
+		return nil, fmt.Errorf("failed to mark shared ride for fare settlement: %w", err)
+	}
+	ride.PoolSettlementPending = true
+
+	if err := s.settlePool(ctx, ride); err != nil {
+		s.logger.WithError(err).WithRideID(ride.ID).Warn("Failed to settle shared ride fare, will retry")
+	}
+
+	return ride, nil
+}
+
+// Fare Split
+
+// SplitPoolFare divides the pool's total fare between its riders in proportion
+// to the distance each of them spent on board, measured from the driver's
+// tracked locations between stops.
+func (s *ridePoolService) SplitPoolFare(ctx context.Context, rideID primitive.ObjectID, totalFare money.Money) ([]*PoolFareShare, error) {
+	ride, err := s.rideRepo.GetByID(ctx, rideID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get ride: %w", err)
+	}
+
+	stops := poolStops(ride)
+	members, err := s.poolMembers(ctx, stops)
+	if err != nil {
+		return nil, err
+	}
+
+	visited := visitedPoolStops(stops, members)
+	legs, _ := s.trackPool(ctx, ride, visited)
+
+	shares, _, err := splitPoolFare(visited, legs, totalFare)
+	return shares, err
+}
+
+// Helper methods
+
+// settleUnsettledPools settles every pool with a ride still marked unsettled.
+func (s *ridePoolService) settleUnsettledPools(ctx context.Context) error {
+	rides, err := s.rideRepo.GetUnsettledPoolRides(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get unsettled shared rides: %w", err)
+	}
+
+	for _, ride := range rides {
+		if err := s.settlePool(ctx, ride); err != nil {
+			s.logger.WithError(err).WithRideID(ride.ID).Error("Failed to settle shared ride fare")
+		}
+	}
+
+	return nil
+}
+
+// settlePool settles the pool of a completed ride under the pool's lock and
+// clears the ride's unsettled mark once every share has been charged.
+func (s *ridePoolService) settlePool(ctx context.Context, ride *models.Ride) error {
+	if ride.DriverID == nil {
+		return fmt.Errorf("shared ride has no driver")
+	}
+
+	lock, err := s.cache.Lock(ctx, poolLockKey(*ride.DriverID), poolLockTTL)
+	if err != nil {
+		return fmt.Errorf("failed to lock shared ride: %w", err)
+	}
+	defer s.cache.Unlock(ctx, lock)
+
+	if err := s.settlePoolFare(ctx, ride); err != nil {
+		return err
+	}
+
+	if err := s.rideRepo.Update(ctx, ride.ID, map[string]interface{}{
+		"pool_settlement_pending": false,
+		"updated_at":              time.Now(),
+	}); err != nil {
+		return fmt.Errorf("failed to clear shared ride settlement: %w", err)
+	}
+	ride.PoolSettlementPending = false
+
+	return nil
+}
+
+// settlePoolFare prices a finished pool as one trip over the driver's tracked
+// route and charges each rider the share of it they rode. It waits until every
+// member ride has ended, and skips rides that already carry a final fare, so
+// it can be run again after any of the charges fails.
+func (s *ridePoolService) settlePoolFare(ctx context.Context, ride *models.Ride) error {
+	stops := poolStops(ride)
+	members, err := s.poolMembers(ctx, stops)
+	if err != nil {
+		return err
+	}
+	for _, member := range members {
+		switch member.Status {
+		case models.RideStatusCompleted, models.RideStatusCancelled, models.RideStatusNoShow:
+		default:
+			return nil // the last member to finish settles the pool
+		}
+	}
+
+	visited := visitedPoolStops(stops, members)
+	if len(visited) < 2 {
+		return fmt.Errorf("shared ride has no completed trip")
+	}
+	legs, path := s.trackPool(ctx, ride, visited)
+
+	// Price from the ride that started the pool; promotions and passes belong
+	// to a single rider, so none are applied to the shared fare
+	anchor := members[visited[0].RideID]
+	first, last := visited[0], visited[len(visited)-1]
+	request := &FareCalculationRequest{
+		City:            anchor.PickupLocation.City,
+		RideType:        anchor.RideType,
+		RequestedAt:     anchor.RequestedAt,
+		Duration:        int(last.CompletedAt.Sub(*first.CompletedAt).Minutes()),
+		SurgeMultiplier: anchor.SurgeMultiplier,
+		PickupLocation:  &first.Location,
+		DropoffLocation: &last.Location,
+		Path:            path,
+	}
+	if anchor.FareQuote != nil {
+		request.FareStructureID = anchor.FareQuote.FareStructureID
+		request.SurgeMultiplier = anchor.FareQuote.SurgeMultiplier
+	}
+	for _, km := range legs {
+		request.Distance += km
+	}
+	for _, member := range members {
+		request.WaitingTime += member.WaitingTime
+	}
+
+	breakdown, err := s.fareService.CalculateFare(ctx, request)
+	if err != nil {
+		return fmt.Errorf("failed to calculate shared ride fare: %w", err)
+	}
+
+	shares, portions, err := splitPoolFare(visited, legs, breakdown.Total)
+	if err != nil {
+		return err
+	}
+	parts, err := allocateFareBreakdown(breakdown, portions)
+	if err != nil {
+		return fmt.Errorf("failed to split shared ride fare: %w", err)
+	}
+
+	failed := 0
+	for i, share := range shares {
+		member := members[share.RideID]
+		if member.Status != models.RideStatusCompleted || member.FareBreakdown != nil {
+			continue
+		}
+
+		parts[i].Distance = share.DistanceKM
+		if _, err := s.rideService.ChargePooledRide(ctx, member.ID, parts[i]); err != nil {
+			s.logger.WithError(err).WithRideID(member.ID).Error("Failed to charge shared ride fare")
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("failed to charge %d shared ride fares", failed)
+	}
+
+	return nil
+}
+
+// poolMembers loads every ride with a stop in the pool's plan.
+func (s *ridePoolService) poolMembers(ctx context.Context, stops []models.RouteStop) (map[primitive.ObjectID]*models.Ride, error) {
+	members := make(map[primitive.ObjectID]*models.Ride)
+	for _, stop := range stops {
+		if members[stop.RideID] != nil {
+			continue
+		}
+		member, err := s.rideRepo.GetByID(ctx, stop.RideID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get shared ride: %w", err)
+		}
+		members[stop.RideID] = member
+	}
+	return members, nil
+}
+
+// trackPool returns the distance driven into each visited stop, from the
+// driver's location history between it and the stop before, and the tracked
+// path. A leg with no tracked locations falls back to its estimated distance.
+func (s *ridePoolService) trackPool(ctx context.Context, ride *models.Ride, visited []models.RouteStop) ([]float64, []utils.Point) {
+	legs := make([]float64, len(visited))
+	if len(visited) == 0 {
+		return legs, nil
+	}
+
+	var history []*models.LocationHistory
+	if ride.DriverID != nil {
+		driver, err := s.driverRepo.GetByID(ctx, *ride.DriverID)
+		if err == nil {
+			history, err = s.locationRepo.GetUserLocationsByDateRange(ctx, driver.UserID, *visited[0].CompletedAt, *visited[len(visited)-1].CompletedAt)
+		}
+		if err != nil {
+			s.logger.WithError(err).WithRideID(ride.ID).Warn("Failed to load tracked route for shared ride")
+		}
+	}
+
+	path := make([]utils.Point, 0, len(history)+len(visited))
+	path = append(path, utils.Point{Lat: visited[0].Location.Latitude(), Lng: visited[0].Location.Longitude()})
+
+	next := 0
+	for i := 1; i < len(visited); i++ {
+		previous := visited[i-1].Location
+		tracked := false
+		for ; next < len(history) && !history[next].CreatedAt.After(*visited[i].CompletedAt); next++ {
+			point := history[next].Location
+			legs[i] += utils.CalculateDistance(previous.Latitude(), previous.Longitude(), point.Latitude(), point.Longitude())
+			path = append(path, utils.Point{Lat: point.Latitude(), Lng: point.Longitude()})
+			previous = point
+			tracked = true
+		}
+
+		stop := visited[i].Location
+		if tracked {
+			legs[i] += utils.CalculateDistance(previous.Latitude(), previous.Longitude(), stop.Latitude(), stop.Longitude())
+		} else {
+			legs[i] = s.legDistance(previous, stop)
+		}
+		path = append(path, utils.Point{Lat: stop.Latitude(), Lng: stop.Longitude()})
+	}
+
+	return legs, path
+}
+
+func (s *ridePoolService) evaluatePool(ctx context.Context, ride, anchor *models.Ride) (*PoolMatch, error) {
+	if anchor.DriverID == nil || anchor.VehicleID == nil {
+		return nil, nil
+	}
+
+	vehicle, err := s.vehicleRepo.GetByID(ctx, *anchor.VehicleID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get vehicle: %w", err)
+	}
+
+	stops := poolStops(anchor)
+	origin := s.driverOrigin(ctx, anchor, stops)
+
+	pickup := models.RouteStop{
+		RideID:   ride.ID,
+		RiderID:  ride.RiderID,
+		Type:     models.RouteStopTypePickup,
+		Location: ride.PickupLocation,
+	}
+	dropoff := models.RouteStop{
+		RideID:   ride.ID,
+		RiderID:  ride.RiderID,
+		Type:     models.RouteStopTypeDropoff,
+		Location: ride.DropoffLocation,
+	}
+
+	insertion := s.evaluateInsertion(origin, stops, pickup, dropoff, vehicle.Capacity)
+	if insertion == nil {
+		return nil, nil
+	}
+
+	s.setETAs(insertion.stops, origin)
+
+	return &PoolMatch{
+		AnchorRideID: anchor.ID,
+		DriverID:     *anchor.DriverID,
+		VehicleID:    *anchor.VehicleID,
+		Stops:        insertion.stops,
+		PickupIndex:  insertion.pickupIndex,
+		DropoffIndex: insertion.dropoffIndex,
+		AddedMinutes: insertion.addedMinutes,
+		PickupETA:    insertion.stops[insertion.pickupIndex].ETA,
+		DropoffETA:   insertion.stops[insertion.dropoffIndex].ETA,
+	}, nil
+}
+
+// evaluateInsertion tries every position for the new pickup and dropoff among
+// the pool's remaining stops and keeps the order that adds the least driving
+// time while respecting capacity and every rider's detour limit. Detours are
+// measured against each rider's direct route, so a rider cannot be detoured a
+// little at a time by successive insertions.
+func (s *ridePoolService) evaluateInsertion(origin models.Location, stops []models.RouteStop, pickup, dropoff models.RouteStop, capacity int) *poolInsertion {
+	completed, remaining := splitPoolStops(stops)
+	direct, boarded := s.poolRiderRoutes(stops, time.Now())
+
+	baseline := s.arrivalMinutes(origin, remaining)
+	baselineEnd := 0.0
+	if len(baseline) > 0 {
+		baselineEnd = baseline[len(baseline)-1]
+	}
+	baselineWindows := poolRideWindows(remaining, baseline)
+	directMinutes := s.legMinutes(pickup.Location, dropoff.Location)
+	onboard := onboardCount(completed)
+
+	var best *poolInsertion
+	for i := 0; i <= len(remaining); i++ {
+		for j := i; j <= len(remaining); j++ {
+			candidate := make([]models.RouteStop, 0, len(remaining)+2)
+			candidate = append(candidate, remaining[:i]...)
+			candidate = append(candidate, pickup)
+			candidate = append(candidate, remaining[i:j]...)
+			candidate = append(candidate, dropoff)
+			candidate = append(candidate, remaining[j:]...)
+
+			if !withinCapacity(candidate, onboard, capacity) {
+				continue
+			}
+
+			times := s.arrivalMinutes(origin, candidate)
+			windows := poolRideWindows(candidate, times)
+
+			allowed := true
+			for rideID, before := range baselineWindows {
+				// Stops that only get closer never push a rider past the limit
+				trip := boarded[rideID] + windows[rideID].duration()
+				if trip > boarded[rideID]+before.duration() && !s.detourAllowed(direct[rideID], trip) {
+					allowed = false
+					break
+				}
+			}
+			if !allowed || !s.detourAllowed(directMinutes, windows[pickup.RideID].duration()) {
+				continue
+			}
+
+			added := times[len(times)-1] - baselineEnd
+			if best == nil || added < best.addedMinutes {
+				full := make([]models.RouteStop, 0, len(completed)+len(candidate))
+				full = append(full, completed...)
+				full = append(full, candidate...)
+
+				best = &poolInsertion{
+					stops:        full,
+					pickupIndex:  len(completed) + i,
+					dropoffIndex: len(completed) + j + 1,
+					addedMinutes: added,
+				}
+			}
+		}
+	}
+
+	return best
+}
+
+func (s *ridePoolService) detourAllowed(beforeMinutes, afterMinutes float64) bool {
+	detour := afterMinutes - beforeMinutes
+	if detour <= 0 {
+		return true
+	}
+	if detour > s.config.MaxDetourMinutes {
+		return false
+	}
+	if beforeMinutes > 0 && detour/beforeMinutes*100 > s.config.MaxDetourPercent {
+		return false
+	}
+	return true
+}
+
+// poolRiderRoutes returns each pooled rider's direct driving minutes from
+// pickup to dropoff and, for riders already on board, the minutes since they
+// were picked up.
+func (s *ridePoolService) poolRiderRoutes(stops []models.RouteStop, now time.Time) (map[primitive.ObjectID]float64, map[primitive.ObjectID]float64) {
+	pickups := make(map[primitive.ObjectID]models.RouteStop)
+	direct := make(map[primitive.ObjectID]float64)
+	boarded := make(map[primitive.ObjectID]float64)
+
+	for _, stop := range stops {
+		if stop.Type == models.RouteStopTypePickup {
+			pickups[stop.RideID] = stop
+			if stop.CompletedAt != nil {
+				boarded[stop.RideID] = now.Sub(*stop.CompletedAt).Minutes()
+			}
+			continue
+		}
+		if pickup, ok := pickups[stop.RideID]; ok {
+			direct[stop.RideID] = s.legMinutes(pickup.Location, stop.Location)
+		}
+	}
+
+	return direct, boarded
+}
+
+// arrivalMinutes returns the minutes from now at which each stop is reached
+// when driving them in order from origin.
+func (s *ridePoolService) arrivalMinutes(origin models.Location, stops []models.RouteStop) []float64 {
+	times := make([]float64, len(stops))
+	elapsed := 0.0
+	previous := origin
+
+	for i, stop := range stops {
+		elapsed += s.legMinutes(previous, stop.Location)
+		times[i] = elapsed
+		previous = stop.Location
+	}
+
+	return times
+}
+
+func (s *ridePoolService) legDistance(from, to models.Location) float64 {
+	return utils.CalculateDistance(from.Latitude(), from.Longitude(), to.Latitude(), to.Longitude()) * s.config.RoadFactor
+}
+
+func (s *ridePoolService) legMinutes(from, to models.Location) float64 {
+	return s.legDistance(from, to) / s.config.AverageSpeedKMH * 60
+}
+
+func (s *ridePoolService) setETAs(stops []models.RouteStop, origin models.Location) {
+	_, remaining := splitPoolStops(stops)
+	offset := len(stops) - len(remaining)
+	now := time.Now()
+
+	for i, minutes := range s.arrivalMinutes(origin, remaining) {
+		eta := now.Add(time.Duration(minutes * float64(time.Minute)))
+		stops[offset+i].ETA = &eta
+	}
+}
+
+// publishETAs refreshes the stop ETAs and sends each pooled rider only the
+// ETAs for their own pickup and dropoff.
+func (s *ridePoolService) publishETAs(stops []models.RouteStop, origin models.Location) {
+	s.setETAs(stops, origin)
+
+	updates := make(map[primitive.ObjectID]map[string]interface{})
+	riders := make(map[primitive.ObjectID]primitive.ObjectID)
+	for _, stop := range stops {
+		if stop.CompletedAt != nil {
+			continue
+		}
+		if updates[stop.RideID] == nil {
+			updates[stop.RideID] = map[string]interface{}{
+				"ride_id": stop.RideID.Hex(),
+			}
+			riders[stop.RideID] = stop.RiderID
+		}
+		updates[stop.RideID][string(stop.Type)+"_eta"] = stop.ETA
+	}
+
+	for rideID, data := range updates {
+		s.wsHandler.SendRideUpdate(rideID, PoolEventETAUpdate, data)
+		s.wsHandler.SendUserNotification(riders[rideID], PoolEventETAUpdate, data)
+	}
+}
+
+// savePlan writes the pool's stop order to every member ride so each of them
+// carries the full plan in its route and waypoints.
+func (s *ridePoolService) savePlan(ctx context.Context, stops []models.RouteStop, origin models.Location) error {
+	_, remaining := splitPoolStops(stops)
+
+	waypoints := make([]models.Location, 0, len(remaining))
+	for _, stop := range remaining {
+		waypoints = append(waypoints, stop.Location)
+	}
+
+	distance := 0.0
+	previous := origin
+	for _, location := range waypoints {
+		distance += s.legDistance(previous, location)
+		previous = location
+	}
+
+	var members []primitive.ObjectID
+	for _, stop := range stops {
+		members = appendUniqueObjectID(members, stop.RideID)
+	}
+
+	now := time.Now()
+	for _, rideID := range members {
+		sharedWith := make([]primitive.ObjectID, 0, len(members)-1)
+		for _, other := range members {
+			if other != rideID {
+				sharedWith = append(sharedWith, other)
+			}
+		}
+
+		route := &models.Route{
+			RideID:        rideID,
+			StartLocation: origin,
+			EndLocation:   previous,
+			Waypoints:     waypoints,
+			Distance:      distance,
+			Duration:      int(distance / s.config.AverageSpeedKMH * 3600),
+			Stops:         stops,
+			CreatedAt:     now,
+		}
+
+		updates := map[string]interface{}{
+			"route":       route,
+			"waypoints":   waypoints,
+			"shared_with": sharedWith,
+			"is_shared":   true,
+			"updated_at":  now,
+		}
+		if err := s.rideRepo.Update(ctx, rideID, updates); err != nil {
+			return fmt.Errorf("failed to update shared ride plan: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func (s *ridePoolService) notifyDriver(ctx context.Context, driverID primitive.ObjectID, stops []models.RouteStop) {
+	driver, err := s.driverRepo.GetByID(ctx, driverID)
+	if err != nil {
+		s.logger.WithError(err).WithField("driver_id", driverID.Hex()).Warn("Failed to notify driver of pool route")
+		return
+	}
+
+	s.wsHandler.SendUserNotification(driver.UserID, PoolEventRouteUpdated, map[string]interface{}{
+		"stops": stops,
+	})
+}
+
+// driverOrigin is where ETAs are measured from: the driver's last known
+// position, or the next stop when the position is unavailable.
+func (s *ridePoolService) driverOrigin(ctx context.Context, ride *models.Ride, stops []models.RouteStop) models.Location {
+	if ride.DriverID != nil {
+		if location, err := s.cache.GetDriverLocation(ctx, *ride.DriverID); err == nil && location != nil {
+			return *location
+		}
+	}
+
+	if _, remaining := splitPoolStops(stops); len(remaining) > 0 {
+		return remaining[0].Location
+	}
+
+	return ride.PickupLocation
+}
+
+func (w *poolRideWindow) duration() float64 {
+	if w == nil {
+		return 0
+	}
+	if w.hasPickup {
+		return w.dropoff - w.pickup
+	}
+	return w.dropoff
+}
+
+// poolStops returns the ride's stop plan, deriving it from the pickup and
+// dropoff for a ride that has not been pooled yet.
+func poolStops(ride *models.Ride) []models.RouteStop {
+	if ride.Route != nil && len(ride.Route.Stops) > 0 {
+		stops := make([]models.RouteStop, len(ride.Route.Stops))
+		copy(stops, ride.Route.Stops)
+		return stops
+	}
+
+	pickup := models.RouteStop{
+		RideID:   ride.ID,
+		RiderID:  ride.RiderID,
+		Type:     models.RouteStopTypePickup,
+		Location: ride.PickupLocation,
+	}
+	if ride.Status == models.RideStatusInProgress {
+		pickup.CompletedAt = ride.StartedAt
+	}
+
+	dropoff := models.RouteStop{
+		RideID:   ride.ID,
+		RiderID:  ride.RiderID,
+		Type:     models.RouteStopTypeDropoff,
+		Location: ride.DropoffLocation,
+	}
+
+	return []models.RouteStop{pickup, dropoff}
+}
+
+// splitPoolStops separates visited stops from those still ahead. Stops are
+// completed in order, so the visited ones always form a prefix.
+func splitPoolStops(stops []models.RouteStop) ([]models.RouteStop, []models.RouteStop) {
+	for i, stop := range stops {
+		if stop.CompletedAt == nil {
+			return stops[:i], stops[i:]
+		}
+	}
+	return stops, nil
+}
+
+// visitedPoolStops returns the stops the pool actually visited, in the order
+// they were reached. A stop the driver did not mark is taken as reached when
+// its ride started or completed.
+func visitedPoolStops(stops []models.RouteStop, members map[primitive.ObjectID]*models.Ride) []models.RouteStop {
+	visited := make([]models.RouteStop, 0, len(stops))
+	for _, stop := range stops {
+		if member := members[stop.RideID]; stop.CompletedAt == nil && member != nil {
+			if stop.Type == models.RouteStopTypePickup {
+				stop.CompletedAt = member.StartedAt
+			} else if member.Status == models.RideStatusCompleted {
+				stop.CompletedAt = member.CompletedAt
+			}
+		}
+		if stop.CompletedAt != nil {
+			visited = append(visited, stop)
+		}
+	}
+
+	sort.SliceStable(visited, func(i, j int) bool {
+		return visited[i].CompletedAt.Before(*visited[j].CompletedAt)
+	})
+	return visited
+}
+
+// splitPoolFare divides a fare between the riders of the visited stops in
+// proportion to the distance each was on board, given the distance driven into
+// each stop. It also returns the ratios used, so other amounts can be divided
+// the same way.
+func splitPoolFare(visited []models.RouteStop, legs []float64, totalFare money.Money) ([]*PoolFareShare, []float64, error) {
+	var shares []*PoolFareShare
+	shareByRide := make(map[primitive.ObjectID]*PoolFareShare)
+	onboard := make(map[primitive.ObjectID]bool)
+
+	for i, stop := range visited {
+		for id := range onboard {
+			shareByRide[id].DistanceKM += legs[i]
+		}
+
+		if _, exists := shareByRide[stop.RideID]; !exists {
+			share := &PoolFareShare{RideID: stop.RideID, RiderID: stop.RiderID}
+			shareByRide[stop.RideID] = share
+			shares = append(shares, share)
+		}
+
+		if stop.Type == models.RouteStopTypePickup {
+			onboard[stop.RideID] = true
+		} else {
+			delete(onboard, stop.RideID)
+		}
+	}
+
+	if len(shares) == 0 {
+		return nil, nil, fmt.Errorf("ride has no pooled stops")
+	}
+
+	totalKM := 0.0
+	for _, share := range shares {
+		totalKM += share.DistanceKM
+	}
+
+	// Allocate in minor units so the shares always add up to the total fare
+	portions := make([]float64, len(shares))
+	for i, share := range shares {
+		portions[i] = 1
+		if totalKM > 0 {
+			portions[i] = share.DistanceKM
+		}
+	}
+	fares, err := totalFare.Allocate(portions...)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to split fare: %w", err)
+	}
+	for i, share := range shares {
+		share.Fare = fares[i]
+	}
+
+	return shares, portions, nil
+}
+
+// allocateFareBreakdown divides every amount on a fare breakdown by the given
+// ratios, so the receipts of the shares add up to the original.
+func allocateFareBreakdown(breakdown *models.FareBreakdown, ratios []float64) ([]*models.FareBreakdown, error) {
+	shares := make([]*models.FareBreakdown, len(ratios))
+	for i := range shares {
+		share := *breakdown
+		share.Surcharges = make([]models.FareSurcharge, len(breakdown.Surcharges))
+		copy(share.Surcharges, breakdown.Surcharges)
+		share.TaxLines = make([]models.TaxLine, len(breakdown.TaxLines))
+		copy(share.TaxLines, breakdown.TaxLines)
+		shares[i] = &share
+	}
+
+	amounts := func(b *models.FareBreakdown) []*money.Money {
+		fields := []*money.Money{
+			&b.BaseFare, &b.DistanceFare, &b.TimeFare, &b.BookingFee, &b.SurgeAmount,
+			&b.FareAdjustment, &b.FixedFare, &b.WaitingCharge, &b.TollAmount,
+			&b.SurchargeAmount, &b.Subtotal, &b.DiscountAmount, &b.PassDiscount,
+			&b.TaxAmount, &b.TaxIncluded, &b.Total, &b.PlatformFee, &b.DriverEarnings,
+		}
+		for i := range b.Surcharges {
+			fields = append(fields, &b.Surcharges[i].Amount)
+		}
+		for i := range b.TaxLines {
+			fields = append(fields, &b.TaxLines[i].TaxableAmount, &b.TaxLines[i].Amount)
+		}
+		return fields
+	}
+
+	for field, amount := range amounts(breakdown) {
+		parts, err := amount.Allocate(ratios...)
+		if err != nil {
+			return nil, err
+		}
+		for i, share := range shares {
+			*amounts(share)[field] = parts[i]
+		}
+	}
+
+	return shares, nil
+}
+
+func poolRideWindows(stops []models.RouteStop, times []float64) map[primitive.ObjectID]*poolRideWindow {
+	windows := make(map[primitive.ObjectID]*poolRideWindow)
+	for i, stop := range stops {
+		window := windows[stop.RideID]
+		if window == nil {
+			window = &poolRideWindow{}
+			windows[stop.RideID] = window
+		}
+
+		if stop.Type == models.RouteStopTypePickup {
+			window.pickup = times[i]
+			window.hasPickup = true
+		} else {
+			window.dropoff = times[i]
+		}
+	}
+	return windows
+}
+
+func onboardCount(completed []models.RouteStop) int {
+	count := 0
+	for _, stop := range completed {
+		if stop.Type == models.RouteStopTypePickup {
+			count++
+		} else {
+			count--
+		}
+	}
+	return count
+}
+
+func withinCapacity(stops []models.RouteStop, onboard, capacity int) bool {
+	load := onboard
+	for _, stop := range stops {
+		if stop.Type == models.RouteStopTypePickup {
+			load++
+			if load > capacity {
+				return false
+			}
+		} else {
+			load--
+		}
+	}
+	return true
+}
+
+// isPooledRide reports whether a ride shared the vehicle with other riders. A
+// shared ride nobody joined is priced and charged like any other ride.
+func isPooledRide(ride *models.Ride) bool {
+	return ride.IsShared && len(ride.SharedWith) > 0
+}
+
+func poolLockKey(driverID primitive.ObjectID) string {
+	return fmt.Sprintf("ride_pool:%s", driverID.Hex())
+}
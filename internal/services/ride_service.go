@@ -0,0 +1,1143 @@
+package services
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"time"
+
+	"goride/internal/config"
+	"goride/internal/models"
+	"goride/internal/repositories/interfaces"
+	"goride/internal/utils"
+	"goride/pkg/logger"
+	"goride/pkg/money"
+	"goride/pkg/payment"
+	"goride/pkg/websocket"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type RideService interface {
+	// Ride Retrieval
+	GetRide(ctx context.Context, rideID primitive.ObjectID) (*models.Ride, error)
+
+	RecordPickupETA(ctx context.Context, rideID primitive.ObjectID, etaMinutes int) error
+	RecordDriverBonus(ctx context.Context, rideID primitive.ObjectID, bonus float64) error
+
+	// Lifecycle Transitions
+	AcceptRide(ctx context.Context, rideID, driverID, vehicleID primitive.ObjectID) (*models.Ride, error)
+	MarkDriverArrived(ctx context.Context, rideID, driverID primitive.ObjectID) (*models.Ride, error)
+	StartRide(ctx context.Context, rideID, driverID primitive.ObjectID, pin string) (*models.Ride, error)
+	CompleteRide(ctx context.Context, rideID, driverID primitive.ObjectID, actualDistance float64, actualDuration int, actualFare float64) (*models.Ride, error)
+	CancelRide(ctx context.Context, rideID primitive.ObjectID, reason, cancelledBy string) (*models.Ride, error)
+	CancelRideWithFee(ctx context.Context, rideID primitive.ObjectID, reason, cancelledBy string, fee *models.Payment) (*models.Ride, error)
+	MarkNoShow(ctx context.Context, rideID, driverID primitive.ObjectID) (*models.Ride, error)
+
+	// Pooled Fares
+	ChargePooledRide(ctx context.Context, rideID primitive.ObjectID, breakdown *models.FareBreakdown) (*models.Ride, error)
+
+	// Transition Rules
+	CanTransition(from, to models.RideStatus) bool
+	GetAllowedTransitions(status models.RideStatus) []models.RideStatus
+
+	// Waiting Time
+	GetWaitingStatus(ctx context.Context, rideID primitive.ObjectID) (*WaitingStatus, error)
+
+	// Pickup PIN
+	GetRidePIN(ctx context.Context, rideID, riderID primitive.ObjectID) (string, error)
+	SetPINPreference(ctx context.Context, riderID primitive.ObjectID, alwaysRequire bool) error
+}
+
+// RideEventType identifies the websocket event emitted for a ride transition.
+type RideEventType string
+
+const (
+	RideEventAccepted      RideEventType = utils.EventRideAccepted
+	RideEventDriverArrived RideEventType = utils.EventRideDriverArrived
+	RideEventStarted       RideEventType = utils.EventRideStarted
+	RideEventCompleted     RideEventType = utils.EventRideCompleted
+	RideEventCancelled     RideEventType = utils.EventRideCancelled
+	RideEventNoShow        RideEventType = utils.EventRideNoShow
+)
+
+// Cancellation parties accepted by CancelRide
+const (
+	CancelledByRider  = "rider"
+	CancelledByDriver = "driver"
+	CancelledBySystem = "system"
+	CancelledByAdmin  = "admin"
+)
+
+// Pickup PIN websocket events and ride history entries
+const (
+	RideEventPIN              = "ride_pin"
+	RideHistoryPINSafetyEvent = "pickup_pin_safety_event"
+)
+
+const (
+	rideTransitionLockTTL = 10 * time.Second
+	noShowReason          = "rider_no_show"
+	ridePINFailureTTL     = 24 * time.Hour
+)
+
+// rideTransitions lists, for every status, the statuses a ride may move to next.
+// Completed, cancelled and no_show are terminal.
+var rideTransitions = map[models.RideStatus][]models.RideStatus{
+	models.RideStatusRequested: {
+		models.RideStatusAccepted,
+		models.RideStatusCancelled,
+	},
+	models.RideStatusAccepted: {
+		models.RideStatusDriverArrived,
+		models.RideStatusCancelled,
+	},
+	models.RideStatusDriverArrived: {
+		models.RideStatusInProgress,
+		models.RideStatusCancelled,
+		models.RideStatusNoShow,
+	},
+	models.RideStatusInProgress: {
+		models.RideStatusCompleted,
+	},
+}
+
+var rideTransitionEvents = map[models.RideStatus]RideEventType{
+	models.RideStatusAccepted:      RideEventAccepted,
+	models.RideStatusDriverArrived: RideEventDriverArrived,
+	models.RideStatusInProgress:    RideEventStarted,
+	models.RideStatusCompleted:     RideEventCompleted,
+	models.RideStatusCancelled:     RideEventCancelled,
+	models.RideStatusNoShow:        RideEventNoShow,
+}
+
+// WaitingStatus describes the waiting timer that starts when the driver
+// arrives at pickup.
+type WaitingStatus struct {
+	RideID            primitive.ObjectID `json:"ride_id"`
+	DriverArrivedAt   time.Time          `json:"driver_arrived_at"`
+	WaitedMinutes     int                `json:"waited_minutes"`
+	FreeMinutes       int                `json:"free_minutes"`
+	BillableMinutes   int                `json:"billable_minutes"`
+	RatePerMinute     float64            `json:"rate_per_minute"`
+	Charge            money.Money        `json:"charge"`
+	Currency          string             `json:"currency"`
+	NoShowAvailableAt time.Time          `json:"no_show_available_at"`
+	NoShowFee         money.Money        `json:"no_show_fee"`
+}
+
+type rideService struct {
+	rideRepo          interfaces.RideRepository
+	riderRepo         interfaces.RiderRepository
+	driverRepo        interfaces.DriverRepository
+	emergencyRepo     interfaces.EmergencyRepository
+	fareStructureRepo interfaces.FareStructureRepository
+	paymentRepo       interfaces.PaymentRepository
+	paymentProvider   payment.PaymentProvider
+	pricingService    UpfrontPricingService
+	fareService       FareCalculationService
+	exchangeService   ExchangeRateService
+	fareSplitService  FareSplitService
+	holdService       PaymentHoldService
+	walletService     WalletService
+	cache             CacheService
+	wsHandler         *websocket.Handler
+	pinConfig         *config.RidePINConfig
+	waitingConfig     *config.WaitingConfig
+	logger            *logger.Logger
+}
+
+func NewRideService(
+	rideRepo interfaces.RideRepository,
+	riderRepo interfaces.RiderRepository,
+	driverRepo interfaces.DriverRepository,
+	emergencyRepo interfaces.EmergencyRepository,
+	fareStructureRepo interfaces.FareStructureRepository,
+	paymentRepo interfaces.PaymentRepository,
+	paymentProvider payment.PaymentProvider,
+	pricingService UpfrontPricingService,
+	fareService FareCalculationService,
+	exchangeService ExchangeRateService,
+	fareSplitService FareSplitService,
+	holdService PaymentHoldService,
+	walletService WalletService,
+	cache CacheService,
+	wsHandler *websocket.Handler,
+	pinConfig *config.RidePINConfig,
+	waitingConfig *config.WaitingConfig,
+	logger *logger.Logger,
+) RideService {
+	return &rideService{
+		rideRepo:          rideRepo,
+		riderRepo:         riderRepo,
+		driverRepo:        driverRepo,
+		emergencyRepo:     emergencyRepo,
+		fareStructureRepo: fareStructureRepo,
+		paymentRepo:       paymentRepo,
+		paymentProvider:   paymentProvider,
+		pricingService:    pricingService,
+		fareService:       fareService,
+		exchangeService:   exchangeService,
+		fareSplitService:  fareSplitService,
+		holdService:       holdService,
+		walletService:     walletService,
+		cache:             cache,
+		wsHandler:         wsHandler,
+		pinConfig:         pinConfig,
+		waitingConfig:     waitingConfig,
+		logger:            logger,
+	}
+}
+
+// Ride Retrieval
+func (s *rideService) GetRide(ctx context.Context, rideID primitive.ObjectID) (*models.Ride, error) {
+	ride, err := s.rideRepo.GetByID(ctx, rideID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get ride: %w", err)
+	}
+	if ride == nil {
+		return nil, fmt.Errorf("ride not found")
+	}
+
+	return ride, nil
+}
+
+// RecordPickupETA stores the pickup ETA quoted to the rider when the driver
+// accepted, so later cancellations can tell whether it has slipped.
+func (s *rideService) RecordPickupETA(ctx context.Context, rideID primitive.ObjectID, etaMinutes int) error {
+	if err := s.rideRepo.Update(ctx, rideID, map[string]interface{}{
+		"pickup_eta": etaMinutes,
+	}); err != nil {
+		return fmt.Errorf("failed to record pickup ETA: %w", err)
+	}
+
+	return nil
+}
+
+// RecordDriverBonus stores the escalation bonus offered with the offer the
+// driver accepted, so it can be paid when the ride completes.
+func (s *rideService) RecordDriverBonus(ctx context.Context, rideID primitive.ObjectID, bonus float64) error {
+	if err := s.rideRepo.Update(ctx, rideID, map[string]interface{}{
+		"driver_bonus": bonus,
+	}); err != nil {
+		return fmt.Errorf("failed to record driver bonus: %w", err)
+	}
+
+	return nil
+}
+
+// Lifecycle Transitions
+func (s *rideService) AcceptRide(ctx context.Context, rideID, driverID, vehicleID primitive.ObjectID) (*models.Ride, error) {
+	ride, err := s.transition(ctx, rideID, models.RideStatusAccepted, func(ride *models.Ride, now time.Time) error {
+		if err := s.rideRepo.AssignDriver(ctx, rideID, driverID, vehicleID); err != nil {
+			return fmt.Errorf("failed to assign driver: %w", err)
+		}
+
+		pin := utils.GenerateRandomNumericString(s.pinConfig.Length)
+		pinRequired := s.isPINRequired(ctx, ride, now)
+		if err := s.rideRepo.Update(ctx, rideID, map[string]interface{}{
+			"otp":          pin,
+			"pin_required": pinRequired,
+		}); err != nil {
+			return fmt.Errorf("failed to set pickup PIN: %w", err)
+		}
+
+		ride.DriverID = &driverID
+		ride.VehicleID = &vehicleID
+		ride.AcceptedAt = &now
+		ride.OTP = pin
+		ride.PINRequired = pinRequired
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.sendPINToRider(ride)
+
+	return ride, nil
+}
+
+func (s *rideService) MarkDriverArrived(ctx context.Context, rideID, driverID primitive.ObjectID) (*models.Ride, error) {
+	return s.transition(ctx, rideID, models.RideStatusDriverArrived, func(ride *models.Ride, now time.Time) error {
+		if err := validateRideDriver(ride, driverID); err != nil {
+			return err
+		}
+
+		if err := s.rideRepo.UpdateStatus(ctx, rideID, models.RideStatusDriverArrived); err != nil {
+			return fmt.Errorf("failed to update ride status: %w", err)
+		}
+
+		ride.DriverArrivedAt = &now
+		return nil
+	})
+}
+
+func (s *rideService) StartRide(ctx context.Context, rideID, driverID primitive.ObjectID, pin string) (*models.Ride, error) {
+	return s.transition(ctx, rideID, models.RideStatusInProgress, func(ride *models.Ride, now time.Time) error {
+		if err := validateRideDriver(ride, driverID); err != nil {
+			return err
+		}
+
+		if err := s.verifyPickupPIN(ctx, ride, pin, now); err != nil {
+			return err
+		}
+
+		if err := s.rideRepo.StartRide(ctx, rideID); err != nil {
+			return fmt.Errorf("failed to start ride: %w", err)
+		}
+
+		// The waiting timer stops when the trip starts
+		if status := s.calculateWaiting(ctx, ride, now); status != nil && status.Charge.IsPositive() {
+			estimatedFare, err := money.FromMajor(ride.EstimatedFare, status.Currency).Add(status.Charge)
+			if err != nil {
+				return fmt.Errorf("failed to add waiting charge: %w", err)
+			}
+
+			if err := s.rideRepo.Update(ctx, rideID, map[string]interface{}{
+				"waiting_time":   status.BillableMinutes,
+				"waiting_charge": status.Charge.Float64(),
+				"estimated_fare": estimatedFare.Float64(),
+			}); err != nil {
+				return fmt.Errorf("failed to record waiting charge: %w", err)
+			}
+
+			ride.WaitingTime = status.BillableMinutes
+			ride.WaitingCharge = status.Charge.Float64()
+			ride.EstimatedFare = estimatedFare.Float64()
+		}
+
+		ride.StartedAt = &now
+		return nil
+	})
+}
+
+// CompleteRide records the metered trip. Waiting charges accrued at pickup are
+// added on top of actualFare. Rides with a locked quote are then reconciled to
+// decide the final fare, and other rides are priced from the measured distance
+// and duration so the receipt matches the fare structure. A split fare is
+// charged to its participants once the final fare is known, and any
+// escalation bonus the driver accepted the ride with is paid to them. Pooled
+// rides are priced and charged with the rest of their pool instead, see
+// RidePoolService.CompleteRide.
+func (s *rideService) CompleteRide(ctx context.Context, rideID, driverID primitive.ObjectID, actualDistance float64, actualDuration int, actualFare float64) (*models.Ride, error) {
+	ride, err := s.transition(ctx, rideID, models.RideStatusCompleted, func(ride *models.Ride, now time.Time) error {
+		if err := validateRideDriver(ride, driverID); err != nil {
+			return err
+		}
+
+		actualFare += ride.WaitingCharge
+
+		if err := s.rideRepo.CompleteRide(ctx, rideID, actualDistance, actualDuration, actualFare); err != nil {
+			return fmt.Errorf("failed to complete ride: %w", err)
+		}
+
+		// The meter reading stands until the fare is priced below
+		if err := s.rideRepo.Update(ctx, rideID, map[string]interface{}{
+			"final_fare": actualFare,
+		}); err != nil {
+			return fmt.Errorf("failed to record final fare: %w", err)
+		}
+
+		ride.CompletedAt = &now
+		ride.ActualDistance = actualDistance
+		ride.ActualDuration = actualDuration
+		ride.ActualFare = actualFare
+		ride.FinalFare = actualFare
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if !isPooledRide(ride) {
+		s.priceCompletedRide(ctx, ride)
+		s.chargeCompletedRide(ctx, ride)
+	}
+	s.payDriverBonus(ctx, ride)
+
+	return ride, nil
+}
+
+func (s *rideService) CancelRide(ctx context.Context, rideID primitive.ObjectID, reason, cancelledBy string) (*models.Ride, error) {
+	return s.CancelRideWithFee(ctx, rideID, reason, cancelledBy, nil)
+}
+
+// CancelRideWithFee cancels a ride and charges the rider the given fee, built
+// by the cancellation policy. The fee is charged once the cancellation is
+// saved and before the payment hold is released, so it can be captured from
+// the hold.
+func (s *rideService) CancelRideWithFee(ctx context.Context, rideID primitive.ObjectID, reason, cancelledBy string, fee *models.Payment) (*models.Ride, error) {
+	switch cancelledBy {
+	case CancelledByRider, CancelledByDriver, CancelledBySystem, CancelledByAdmin:
+	default:
+		return nil, fmt.Errorf("invalid cancelling party: %s", cancelledBy)
+	}
+
+	ride, err := s.transition(ctx, rideID, models.RideStatusCancelled, func(ride *models.Ride, now time.Time) error {
+		if err := s.rideRepo.CancelRide(ctx, rideID, reason, cancelledBy); err != nil {
+			return fmt.Errorf("failed to cancel ride: %w", err)
+		}
+
+		ride.CancelledAt = &now
+		ride.CancellationReason = reason
+		ride.CancelledBy = cancelledBy
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if fee != nil {
+		s.chargeRiderFee(ctx, ride, fee, "Ride cancellation fee")
+	}
+	s.cancelFareSplit(ctx, ride)
+	s.releasePaymentHold(ctx, ride, HoldReleaseRideCancelled)
+
+	return ride, nil
+}
+
+// MarkNoShow lets the driver give up on a rider once the no-show wait time has
+// passed since arrival. The driver has to be at the pickup, and the rider is
+// charged the no-show fee, which is credited to the driver.
+func (s *rideService) MarkNoShow(ctx context.Context, rideID, driverID primitive.ObjectID) (*models.Ride, error) {
+	var fee money.Money
+	ride, err := s.transition(ctx, rideID, models.RideStatusNoShow, func(ride *models.Ride, now time.Time) error {
+		if err := validateRideDriver(ride, driverID); err != nil {
+			return err
+		}
+
+		if err := s.validateNoShow(ctx, ride, now); err != nil {
+			return err
+		}
+
+		var err error
+		fee, err = s.noShowFee(ctx, ride)
+		if err != nil {
+			return err
+		}
+
+		updates := map[string]interface{}{
+			"status":              models.RideStatusNoShow,
+			"cancelled_at":        now,
+			"cancellation_reason": noShowReason,
+			"cancelled_by":        CancelledByDriver,
+			"no_show_fee":         fee.Float64(),
+			"updated_at":          now,
+		}
+		if err := s.rideRepo.Update(ctx, rideID, updates); err != nil {
+			return fmt.Errorf("failed to mark ride as no-show: %w", err)
+		}
+
+		ride.CancelledAt = &now
+		ride.CancellationReason = noShowReason
+		ride.CancelledBy = CancelledByDriver
+		ride.NoShowFee = fee.Float64()
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// The fee is charged once the no-show is saved, so a charge can never
+	// outlive a transition that failed
+	s.chargeNoShowFee(ctx, ride, fee)
+	s.cancelFareSplit(ctx, ride)
+	s.releasePaymentHold(ctx, ride, HoldReleaseNoShow)
+
+	return ride, nil
+}
+
+// Pooled Fares
+
+// ChargePooledRide records a completed pooled ride's share of its pool's fare
+// as its final fare and charges it like any other completed ride.
+func (s *rideService) ChargePooledRide(ctx context.Context, rideID primitive.ObjectID, breakdown *models.FareBreakdown) (*models.Ride, error) {
+	ride, err := s.GetRide(ctx, rideID)
+	if err != nil {
+		return nil, err
+	}
+	if ride.Status != models.RideStatusCompleted {
+		return nil, fmt.Errorf("only completed rides can be charged")
+	}
+	if !isPooledRide(ride) {
+		return nil, fmt.Errorf("ride is not pooled")
+	}
+
+	if err := s.rideRepo.Update(ctx, rideID, map[string]interface{}{
+		"final_fare":     breakdown.Total.Float64(),
+		"fare_breakdown": breakdown,
+	}); err != nil {
+		return nil, fmt.Errorf("failed to record fare breakdown: %w", err)
+	}
+	ride.FinalFare = breakdown.Total.Float64()
+	ride.FareBreakdown = breakdown
+
+	s.chargeCompletedRide(ctx, ride)
+
+	return ride, nil
+}
+
+// Transition Rules
+func (s *rideService) CanTransition(from, to models.RideStatus) bool {
+	for _, next := range rideTransitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *rideService) GetAllowedTransitions(status models.RideStatus) []models.RideStatus {
+	allowed := make([]models.RideStatus, len(rideTransitions[status]))
+	copy(allowed, rideTransitions[status])
+	return allowed
+}
+
+// Waiting Time
+func (s *rideService) GetWaitingStatus(ctx context.Context, rideID primitive.ObjectID) (*WaitingStatus, error) {
+	ride, err := s.GetRide(ctx, rideID)
+	if err != nil {
+		return nil, err
+	}
+
+	if ride.DriverArrivedAt == nil {
+		return nil, fmt.Errorf("driver has not arrived at pickup")
+	}
+
+	// Once the trip has started the timer is frozen at the start time
+	until := time.Now()
+	if ride.StartedAt != nil {
+		until = *ride.StartedAt
+	}
+
+	status := s.calculateWaiting(ctx, ride, until)
+	if status == nil {
+		return nil, fmt.Errorf("no fare structure available for waiting charges")
+	}
+
+	return status, nil
+}
+
+// Pickup PIN
+func (s *rideService) GetRidePIN(ctx context.Context, rideID, riderID primitive.ObjectID) (string, error) {
+	ride, err := s.GetRide(ctx, rideID)
+	if err != nil {
+		return "", err
+	}
+
+	if ride.RiderID != riderID {
+		return "", fmt.Errorf("ride does not belong to this rider")
+	}
+
+	if ride.OTP == "" {
+		return "", fmt.Errorf("pickup PIN is not available until a driver accepts the ride")
+	}
+
+	return ride.OTP, nil
+}
+
+func (s *rideService) SetPINPreference(ctx context.Context, riderID primitive.ObjectID, alwaysRequire bool) error {
+	rider, err := s.riderRepo.GetByUserID(ctx, riderID)
+	if err != nil {
+		return fmt.Errorf("failed to get rider: %w", err)
+	}
+
+	updates := map[string]interface{}{
+		"ride_preferences.always_require_pin": alwaysRequire,
+	}
+	if rider.RidePreferences == nil {
+		updates = map[string]interface{}{
+			"ride_preferences": &models.RidePreferences{AlwaysRequirePIN: alwaysRequire},
+		}
+	}
+
+	if err := s.riderRepo.Update(ctx, rider.ID, updates); err != nil {
+		return fmt.Errorf("failed to update PIN preference: %w", err)
+	}
+
+	return nil
+}
+
+// Helper methods
+
+// transition serializes status changes per ride, checks the move against the
+// transition table, runs apply to persist it and then emits the ride event.
+func (s *rideService) transition(ctx context.Context, rideID primitive.ObjectID, to models.RideStatus, apply func(ride *models.Ride, now time.Time) error) (*models.Ride, error) {
+	lock, err := s.cache.Lock(ctx, fmt.Sprintf("ride_transition:%s", rideID.Hex()), rideTransitionLockTTL)
+	if err != nil {
+		return nil, fmt.Errorf("ride is being updated, please retry: %w", err)
+	}
+	defer s.cache.Unlock(ctx, lock)
+
+	ride, err := s.GetRide(ctx, rideID)
+	if err != nil {
+		return nil, err
+	}
+
+	from := ride.Status
+	if !s.CanTransition(from, to) {
+		return nil, fmt.Errorf("invalid ride status transition from %s to %s", from, to)
+	}
+
+	now := time.Now()
+	if err := apply(ride, now); err != nil {
+		return nil, err
+	}
+
+	ride.Status = to
+	ride.UpdatedAt = now
+
+	s.logger.WithRideID(ride.ID).
+		WithField("from_status", from).
+		WithField("to_status", to).
+		Info("Ride status changed")
+
+	s.emitRideEvent(ride, from)
+
+	return ride, nil
+}
+
+func (s *rideService) emitRideEvent(ride *models.Ride, from models.RideStatus) {
+	if s.wsHandler == nil {
+		return
+	}
+
+	eventType, exists := rideTransitionEvents[ride.Status]
+	if !exists {
+		return
+	}
+
+	data := map[string]interface{}{
+		"ride_id":         ride.ID.Hex(),
+		"ride_number":     ride.RideNumber,
+		"status":          ride.Status,
+		"previous_status": from,
+		"updated_at":      ride.UpdatedAt,
+	}
+	if ride.DriverID != nil {
+		data["driver_id"] = ride.DriverID.Hex()
+	}
+
+	switch ride.Status {
+	case models.RideStatusAccepted:
+		data["vehicle_id"] = ride.VehicleID.Hex()
+		data["accepted_at"] = ride.AcceptedAt
+	case models.RideStatusDriverArrived:
+		data["driver_arrived_at"] = ride.DriverArrivedAt
+	case models.RideStatusInProgress:
+		data["started_at"] = ride.StartedAt
+	case models.RideStatusCompleted:
+		data["completed_at"] = ride.CompletedAt
+		data["actual_distance"] = ride.ActualDistance
+		data["actual_duration"] = ride.ActualDuration
+		data["actual_fare"] = ride.ActualFare
+		data["waiting_charge"] = ride.WaitingCharge
+	case models.RideStatusCancelled, models.RideStatusNoShow:
+		data["cancelled_at"] = ride.CancelledAt
+		data["cancellation_reason"] = ride.CancellationReason
+		data["cancelled_by"] = ride.CancelledBy
+		if ride.NoShowFee > 0 {
+			data["no_show_fee"] = ride.NoShowFee
+		}
+	}
+
+	s.wsHandler.SendRideUpdate(ride.ID, string(eventType), data)
+
+	// The rider may not have joined the ride room yet, so notify them directly too
+	s.wsHandler.SendUserNotification(ride.RiderID, string(eventType), data)
+}
+
+// priceCompletedRide sets the final fare of a completed ride. Rides with a
+// locked quote are reconciled against it; the rest are priced from the
+// measured trip. Failures are logged and leave the meter reading in place.
+func (s *rideService) priceCompletedRide(ctx context.Context, ride *models.Ride) {
+	if ride.FareQuote != nil {
+		reconciliation, err := s.pricingService.ReconcileFare(ctx, ride.ID)
+		if err != nil {
+			s.logger.WithError(err).WithRideID(ride.ID).Error("Failed to reconcile upfront fare")
+			return
+		}
+		ride.FareReconciliation = reconciliation
+		ride.FinalFare = reconciliation.ChargedFare.Float64()
+		return
+	}
+
+	breakdown, err := s.fareService.CalculateRideFare(ctx, ride, ride.ActualDistance, ride.ActualDuration, FareRouteActual)
+	if err != nil {
+		s.logger.WithError(err).WithRideID(ride.ID).Error("Failed to calculate ride fare")
+		return
+	}
+
+	if err := s.rideRepo.Update(ctx, ride.ID, map[string]interface{}{
+		"final_fare":     breakdown.Total.Float64(),
+		"fare_breakdown": breakdown,
+	}); err != nil {
+		s.logger.WithError(err).WithRideID(ride.ID).Error("Failed to record fare breakdown")
+		return
+	}
+
+	ride.FinalFare = breakdown.Total.Float64()
+	ride.FareBreakdown = breakdown
+}
+
+// chargeCompletedRide charges the final fare: split fares are charged to
+// each participant and the hold released once every share is paid, the rest
+// are captured from the hold. Failures are logged; the hold sweep retries
+// open holds.
+func (s *rideService) chargeCompletedRide(ctx context.Context, ride *models.Ride) {
+	if ride.FareSplitID != nil {
+		split, err := s.fareSplitService.SettleSplit(ctx, ride.ID)
+		if err != nil {
+			s.logger.WithError(err).WithRideID(ride.ID).Error("Failed to settle fare split")
+			return
+		}
+		if split.Status == models.FareSplitStatusSettled {
+			s.releasePaymentHold(ctx, ride, HoldReleaseFareSplit)
+		}
+		return
+	}
+
+	if _, err := s.holdService.CaptureFare(ctx, ride); err != nil {
+		s.logger.WithError(err).WithRideID(ride.ID).Error("Failed to capture ride fare")
+	}
+}
+
+// payDriverBonus credits the driver's wallet with the ride's escalation
+// bonus, funded by the platform. The payment takes the ride's first bonus
+// attempt, so the bonus is paid once however often this runs.
+func (s *rideService) payDriverBonus(ctx context.Context, ride *models.Ride) {
+	if ride.DriverBonus <= 0 || ride.DriverID == nil {
+		return
+	}
+
+	driver, err := s.driverRepo.GetByID(ctx, *ride.DriverID)
+	if err != nil {
+		s.logger.WithError(err).WithRideID(ride.ID).Error("Failed to get driver for ride bonus")
+		return
+	}
+
+	now := time.Now()
+	amount := money.FromMajor(ride.DriverBonus, ride.Currency)
+	bonus := &models.Payment{
+		RideID:         ride.ID,
+		PayeeID:        driver.UserID,
+		PaymentMethod:  models.PaymentMethodWallet,
+		PaymentType:    models.PaymentTypeBonus,
+		Status:         models.PaymentStatusCompleted,
+		Amount:         amount,
+		Currency:       amount.Currency,
+		DriverEarnings: amount,
+		ProcessedAt:    &now,
+	}
+	bonus.SetAttempt(1)
+
+	if err := s.exchangeService.SnapshotPayment(ctx, bonus); err != nil {
+		s.logger.WithError(err).WithRideID(ride.ID).Warn("Ride bonus paid without an exchange rate snapshot")
+	}
+	if err := s.paymentRepo.Create(ctx, bonus); err != nil {
+		s.logger.WithError(err).WithRideID(ride.ID).Error("Failed to record ride bonus")
+		return
+	}
+	if _, err := s.walletService.RecordPayment(ctx, bonus); err != nil {
+		s.logger.WithError(err).
+			WithRideID(ride.ID).
+			WithField("payment_id", bonus.ID.Hex()).
+			Error("Ride bonus recorded but not posted to the ledger")
+		return
+	}
+
+	s.logger.WithRideID(ride.ID).
+		WithField("driver_id", ride.DriverID.Hex()).
+		WithField("amount", amount.String()).
+		Info("Ride bonus paid to driver")
+}
+
+// releasePaymentHold releases the hold of a ride that ended without its fare
+// being captured from it.
+func (s *rideService) releasePaymentHold(ctx context.Context, ride *models.Ride, reason string) {
+	if err := s.holdService.ReleaseHold(ctx, ride.ID, reason); err != nil {
+		s.logger.WithError(err).WithRideID(ride.ID).Error("Failed to release payment hold")
+	}
+}
+
+// cancelFareSplit closes the fare split of a ride that ended without a fare.
+func (s *rideService) cancelFareSplit(ctx context.Context, ride *models.Ride) {
+	if ride.FareSplitID == nil {
+		return
+	}
+
+	if err := s.fareSplitService.CancelSplit(ctx, ride.ID); err != nil {
+		s.logger.WithError(err).WithRideID(ride.ID).Error("Failed to cancel fare split")
+	}
+}
+
+// calculateWaiting prices the time waited since the driver arrived, using the
+// free window and per-minute rate of the active fare structure.
+func (s *rideService) calculateWaiting(ctx context.Context, ride *models.Ride, until time.Time) *WaitingStatus {
+	if ride.DriverArrivedAt == nil {
+		return nil
+	}
+
+	fareStructure, err := s.fareStructureRepo.GetActive(ctx, ride.PickupLocation.City, ride.RideType, *ride.DriverArrivedAt)
+	if err != nil {
+		s.logger.WithError(err).WithRideID(ride.ID).Warn("Failed to get fare structure for waiting time")
+		return nil
+	}
+
+	waited := int(until.Sub(*ride.DriverArrivedAt).Minutes())
+	if waited < 0 {
+		waited = 0
+	}
+
+	billable := billableWaitingMinutes(fareStructure, waited)
+
+	return &WaitingStatus{
+		RideID:            ride.ID,
+		DriverArrivedAt:   *ride.DriverArrivedAt,
+		WaitedMinutes:     waited,
+		FreeMinutes:       fareStructure.FreeWaitingTime,
+		BillableMinutes:   billable,
+		RatePerMinute:     fareStructure.WaitingTimeRate,
+		Charge:            money.FromMajor(float64(billable)*fareStructure.WaitingTimeRate, fareStructure.Currency),
+		Currency:          fareStructure.Currency,
+		NoShowAvailableAt: ride.DriverArrivedAt.Add(s.waitingConfig.NoShowWaitTime),
+		NoShowFee:         fareStructure.CancellationFee,
+	}
+}
+
+// validateNoShow guards against drivers claiming a no-show without having
+// waited long enough at the pickup point.
+func (s *rideService) validateNoShow(ctx context.Context, ride *models.Ride, now time.Time) error {
+	if ride.DriverArrivedAt == nil {
+		return fmt.Errorf("driver has not arrived at pickup")
+	}
+
+	availableAt := ride.DriverArrivedAt.Add(s.waitingConfig.NoShowWaitTime)
+	if now.Before(availableAt) {
+		return fmt.Errorf("rider can be marked as no-show in %d seconds", int(availableAt.Sub(now).Seconds()))
+	}
+
+	location, err := s.cache.GetDriverLocation(ctx, *ride.DriverID)
+	if err != nil || location == nil {
+		return fmt.Errorf("driver location is unavailable")
+	}
+
+	distance := utils.CalculateDistance(
+		location.Latitude(), location.Longitude(),
+		ride.PickupLocation.Latitude(), ride.PickupLocation.Longitude(),
+	)
+	if distance > s.waitingConfig.NoShowMaxDistanceKM {
+		return fmt.Errorf("driver must be at the pickup location to mark a no-show")
+	}
+
+	return nil
+}
+
+// noShowFee returns the fee a rider owes for not showing up, the cancellation
+// fee of the fare structure in effect.
+func (s *rideService) noShowFee(ctx context.Context, ride *models.Ride) (money.Money, error) {
+	fareStructure, err := s.fareStructureRepo.GetActive(ctx, ride.PickupLocation.City, ride.RideType, time.Now())
+	if err != nil {
+		return money.Money{}, fmt.Errorf("failed to get fare structure: %w", err)
+	}
+
+	if !fareStructure.CancellationFee.IsPositive() {
+		return money.Zero(fareStructure.Currency), nil
+	}
+	return fareStructure.CancellationFee, nil
+}
+
+// chargeNoShowFee charges the no-show fee as a penalty payment from the rider
+// with the full amount going to the driver.
+func (s *rideService) chargeNoShowFee(ctx context.Context, ride *models.Ride, fee money.Money) {
+	if !fee.IsPositive() {
+		return
+	}
+
+	driver, err := s.driverRepo.GetByID(ctx, *ride.DriverID)
+	if err != nil {
+		s.logger.WithError(err).WithRideID(ride.ID).Error("Failed to get driver for no-show fee")
+		return
+	}
+
+	charge := &models.Payment{
+		RideID:         ride.ID,
+		PayerID:        ride.RiderID,
+		PayeeID:        driver.UserID,
+		PaymentMethod:  models.PaymentMethodCreditCard,
+		PaymentType:    models.PaymentTypePenalty,
+		Status:         models.PaymentStatusPending,
+		Amount:         fee,
+		Currency:       fee.Currency,
+		DriverEarnings: fee,
+	}
+
+	s.chargeRiderFee(ctx, ride, charge, "Rider no-show fee")
+}
+
+// chargeRiderFee charges a fee the rider owes on a ride that ended without a
+// fare. It is captured from the ride's payment hold when there is one, debited
+// from the wallet for wallet rides and charged to the ride's card otherwise.
+// The ride has already ended, so failures are logged and the charge left to
+// payment recovery.
+func (s *rideService) chargeRiderFee(ctx context.Context, ride *models.Ride, charge *models.Payment, description string) {
+	if !charge.Amount.IsPositive() {
+		return
+	}
+
+	captured, err := s.holdService.CaptureCharge(ctx, ride.ID, charge)
+	if err != nil {
+		s.logger.WithError(err).WithRideID(ride.ID).
+			WithField("description", description).
+			Warn("Failed to capture rider fee from payment hold")
+	}
+	if len(captured) > 0 {
+		s.logger.WithRideID(ride.ID).
+			WithField("payment_id", captured[0].ID.Hex()).
+			WithField("description", description).
+			WithField("fee", charge.Amount.String()).
+			WithField("currency", charge.Amount.Currency).
+			Info("Rider fee captured from payment hold")
+		return
+	}
+
+	if err := s.exchangeService.SnapshotPayment(ctx, charge); err != nil {
+		s.logger.WithError(err).WithRideID(ride.ID).Warn("Rider fee charged without an exchange rate snapshot")
+	}
+
+	switch ride.PaymentMethod {
+	case models.PaymentMethodCash:
+		// Nothing to charge the fee to; it is recorded so it can be collected
+		now := time.Now()
+		charge.PaymentMethod = models.PaymentMethodCash
+		charge.Status = models.PaymentStatusFailed
+		charge.FailureReason = "cash ride has no payment method to charge"
+		charge.FailedAt = &now
+		err = s.paymentRepo.CreateAttempt(ctx, charge)
+	case models.PaymentMethodWallet:
+		now := time.Now()
+		charge.PaymentMethod = models.PaymentMethodWallet
+		charge.Status = models.PaymentStatusCompleted
+		charge.ProcessedAt = &now
+		if err = s.paymentRepo.CreateAttempt(ctx, charge); err == nil {
+			s.recordRiderFee(ctx, charge)
+		}
+	default:
+		err = s.sendRiderFee(ctx, ride, charge, description)
+	}
+	if err != nil {
+		s.logger.WithError(err).WithRideID(ride.ID).
+			WithField("description", description).
+			Error("Failed to create rider fee payment")
+		return
+	}
+
+	s.logger.WithRideID(ride.ID).
+		WithField("payment_id", charge.ID.Hex()).
+		WithField("description", description).
+		WithField("status", string(charge.Status)).
+		WithField("fee", charge.Amount.String()).
+		WithField("currency", charge.Amount.Currency).
+		Info("Rider fee charged")
+}
+
+// sendRiderFee charges a rider fee to the ride's card, or the rider's default
+// card when the ride named none. A rider without a card gets a failed payment
+// recording the fee.
+func (s *rideService) sendRiderFee(ctx context.Context, ride *models.Ride, charge *models.Payment, description string) error {
+	if ride.PaymentMethod != "" {
+		charge.PaymentMethod = ride.PaymentMethod
+	}
+
+	methodID := ride.PaymentMethodID
+	if methodID == nil {
+		rider, err := s.riderRepo.GetByUserID(ctx, ride.RiderID)
+		if err != nil {
+			return fmt.Errorf("failed to get rider: %w", err)
+		}
+		methodID = rider.DefaultPaymentID
+	}
+	if methodID == nil {
+		now := time.Now()
+		charge.Status = models.PaymentStatusFailed
+		charge.FailureReason = "no default payment method"
+		charge.FailedAt = &now
+		return s.paymentRepo.CreateAttempt(ctx, charge)
+	}
+
+	charge.PaymentMethodID = *methodID
+	if err := sendPayment(ctx, s.paymentRepo, s.paymentProvider, s.logger, charge, &payment.PaymentRequest{
+		PaymentMethodID: methodID.Hex(),
+		Amount:          charge.Amount,
+		Description:     description,
+		CustomerID:      ride.RiderID.Hex(),
+		Metadata: map[string]interface{}{
+			"ride_id": ride.ID.Hex(),
+		},
+	}); err != nil {
+		return err
+	}
+
+	s.recordRiderFee(ctx, charge)
+	return nil
+}
+
+func (s *rideService) recordRiderFee(ctx context.Context, charge *models.Payment) {
+	if charge.Status != models.PaymentStatusCompleted {
+		return
+	}
+
+	if _, err := s.walletService.RecordPayment(ctx, charge); err != nil {
+		s.logger.WithError(err).
+			WithRideID(charge.RideID).
+			WithField("payment_id", charge.ID.Hex()).
+			Error("Rider fee charged but not posted to the ledger")
+	}
+}
+
+// isPINRequired decides at acceptance whether the driver must enter the pickup
+// PIN. Night-time enforcement is checked again when the trip starts.
+func (s *rideService) isPINRequired(ctx context.Context, ride *models.Ride, now time.Time) bool {
+	if s.pinConfig.EnforceAlways || s.isNightTime(now) {
+		return true
+	}
+
+	rider, err := s.riderRepo.GetByUserID(ctx, ride.RiderID)
+	if err != nil {
+		s.logger.WithError(err).WithRideID(ride.ID).Warn("Failed to get rider PIN preference")
+		return false
+	}
+
+	return rider.RidePreferences != nil && rider.RidePreferences.AlwaysRequirePIN
+}
+
+func (s *rideService) isNightTime(t time.Time) bool {
+	start, end := s.pinConfig.NightStartHour, s.pinConfig.NightEndHour
+	if start == end {
+		return false
+	}
+
+	location, err := time.LoadLocation(s.pinConfig.NightTimezone)
+	if err != nil {
+		location = time.UTC
+	}
+
+	hour := t.In(location).Hour()
+	if start < end {
+		return hour >= start && hour < end
+	}
+	return hour >= start || hour < end
+}
+
+// verifyPickupPIN checks the PIN entered by the driver in constant time.
+// Failed attempts are limited per ride over the attempt window, and repeated
+// failures raise a safety event, since they may mean the rider is about to get
+// into the wrong car.
+func (s *rideService) verifyPickupPIN(ctx context.Context, ride *models.Ride, pin string, now time.Time) error {
+	if !ride.PINRequired && !s.isNightTime(now) {
+		return nil
+	}
+
+	if ride.OTP == "" {
+		if ride.PINRequired {
+			return fmt.Errorf("pickup PIN is missing for this ride")
+		}
+		// Accepted before PINs were issued
+		s.logger.WithRideID(ride.ID).Warn("Ride has no pickup PIN, skipping verification")
+		return nil
+	}
+
+	// Every attempt is counted up front, so concurrent guesses cannot get past
+	// the limit, and taken back off when the PIN turns out to be right
+	attemptsKey := fmt.Sprintf("ride_pin:%s", ride.ID.Hex())
+	attempts, err := s.cache.Increment(ctx, attemptsKey, 1, s.pinConfig.AttemptWindow)
+	if err != nil {
+		return fmt.Errorf("failed to check PIN attempts: %w", err)
+	}
+	if attempts > int64(s.pinConfig.MaxAttempts) {
+		retryAfter, _ := s.cache.GetTTL(ctx, attemptsKey)
+		return fmt.Errorf("too many incorrect PIN attempts, try again in %d seconds", int(retryAfter.Seconds()))
+	}
+
+	if subtle.ConstantTimeCompare([]byte(pin), []byte(ride.OTP)) == 1 {
+		if _, err := s.cache.Decrement(ctx, attemptsKey, 1, s.pinConfig.AttemptWindow); err != nil {
+			s.logger.WithError(err).WithRideID(ride.ID).Warn("Failed to clear PIN attempt")
+		}
+		return nil
+	}
+
+	failures, err := s.cache.Increment(ctx, fmt.Sprintf("ride_pin_failures:%s", ride.ID.Hex()), 1, ridePINFailureTTL)
+	if err != nil {
+		s.logger.WithError(err).WithRideID(ride.ID).Warn("Failed to count PIN failures")
+	}
+
+	s.logger.WithRideID(ride.ID).
+		WithField("driver_id", ride.DriverID.Hex()).
+		WithField("failures", failures).
+		Warn("Incorrect pickup PIN entered")
+
+	if failures == int64(s.pinConfig.SafetyEventThreshold) {
+		s.raisePINSafetyEvent(ctx, ride, failures)
+	}
+
+	return fmt.Errorf("incorrect pickup PIN")
+}
+
+func (s *rideService) raisePINSafetyEvent(ctx context.Context, ride *models.Ride, failures int64) {
+	location := ride.PickupLocation
+	if current, err := s.cache.GetDriverLocation(ctx, *ride.DriverID); err == nil && current != nil {
+		location = *current
+	}
+
+	emergency := &models.Emergency{
+		UserID:      ride.RiderID,
+		RideID:      &ride.ID,
+		Type:        models.EmergencyTypeSafety,
+		Status:      models.EmergencyStatusActive,
+		Location:    location,
+		Description: fmt.Sprintf("Driver entered an incorrect pickup PIN %d times", failures),
+	}
+
+	if err := s.emergencyRepo.Create(ctx, emergency); err != nil {
+		s.logger.WithError(err).WithRideID(ride.ID).Error("Failed to raise pickup PIN safety event")
+		return
+	}
+
+	if err := s.rideRepo.AddHistoryEntry(ctx, ride.ID, &models.RideHistoryEntry{
+		Event:     RideHistoryPINSafetyEvent,
+		ActorID:   ride.DriverID,
+		ActorType: string(models.UserTypeDriver),
+		Details: map[string]interface{}{
+			"emergency_id": emergency.ID.Hex(),
+			"failures":     failures,
+		},
+	}); err != nil {
+		s.logger.WithError(err).WithRideID(ride.ID).Warn("Failed to record ride history")
+	}
+
+	s.logger.WithRideID(ride.ID).
+		WithField("emergency_id", emergency.ID.Hex()).
+		Warn("Pickup PIN safety event raised")
+}
+
+// sendPINToRider delivers the PIN on the rider's own channel; it is never part
+// of the ride room events the driver receives.
+func (s *rideService) sendPINToRider(ride *models.Ride) {
+	if s.wsHandler == nil {
+		return
+	}
+
+	s.wsHandler.SendUserNotification(ride.RiderID, RideEventPIN, map[string]interface{}{
+		"ride_id":      ride.ID.Hex(),
+		"pin":          ride.OTP,
+		"pin_required": ride.PINRequired,
+	})
+}
+
+func validateRideDriver(ride *models.Ride, driverID primitive.ObjectID) error {
+	if ride.DriverID == nil || *ride.DriverID != driverID {
+		return fmt.Errorf("driver is not assigned to this ride")
+	}
+	return nil
+}
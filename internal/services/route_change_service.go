@@ -0,0 +1,560 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	"goride/internal/models"
+	"goride/internal/repositories/interfaces"
+	"goride/internal/utils"
+	"goride/pkg/logger"
+	"goride/pkg/maps"
+	"goride/pkg/money"
+	"goride/pkg/websocket"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type RouteChangeService interface {
+	// Route Changes
+	RequestRouteChange(ctx context.Context, rideID, riderID primitive.ObjectID, request *RouteChangeRequest) (*RouteChangeQuote, error)
+	AcceptRouteChange(ctx context.Context, rideID, riderID primitive.ObjectID, quoteID string) (*models.Ride, error)
+	RejectRouteChange(ctx context.Context, rideID, riderID primitive.ObjectID, quoteID string) error
+	GetPendingRouteChange(ctx context.Context, rideID primitive.ObjectID) (*RouteChangeQuote, error)
+
+	// History
+	GetRideHistory(ctx context.Context, rideID primitive.ObjectID) ([]models.RideHistoryEntry, error)
+}
+
+type RouteChangeType string
+
+const (
+	RouteChangeAddWaypoint       RouteChangeType = "add_waypoint"
+	RouteChangeRemoveWaypoint    RouteChangeType = "remove_waypoint"
+	RouteChangeChangeDestination RouteChangeType = "change_destination"
+)
+
+// Ride history events recorded for route changes
+const (
+	RideHistoryRouteChangeQuoted   = "route_change_quoted"
+	RideHistoryRouteChangeAccepted = "route_change_accepted"
+	RideHistoryRouteChangeRejected = "route_change_rejected"
+)
+
+// Route change websocket events
+const (
+	RouteChangeEventQuoted  = "route_change_quoted"
+	RouteChangeEventUpdated = "route_updated"
+)
+
+const (
+	routeChangeQuoteTTL = 2 * time.Minute
+	routeChangeLockTTL  = 10 * time.Second
+)
+
+type RouteChangeRequest struct {
+	Type          RouteChangeType  `json:"type" validate:"required,oneof=add_waypoint remove_waypoint change_destination"`
+	Location      *models.Location `json:"location"`
+	WaypointIndex int              `json:"waypoint_index"`
+}
+
+// RouteChangeQuote is the re-priced trip the rider has to accept before the
+// change is applied to the ride.
+type RouteChangeQuote struct {
+	QuoteID          string                `json:"quote_id"`
+	RideID           primitive.ObjectID    `json:"ride_id"`
+	Request          RouteChangeRequest    `json:"request"`
+	DropoffLocation  models.Location       `json:"dropoff_location"`
+	Waypoints        []models.Location     `json:"waypoints"`
+	Route            *models.Route         `json:"route"`
+	PreviousFare     money.Money           `json:"previous_fare"`
+	NewFare          money.Money           `json:"new_fare"`
+	FareDifference   money.Money           `json:"fare_difference"`
+	PreviousDistance float64               `json:"previous_distance"` // kilometers
+	NewDistance      float64               `json:"new_distance"`      // kilometers
+	NewDuration      int                   `json:"new_duration"`      // minutes
+	SurgeMultiplier  float64               `json:"surge_multiplier"`
+	Currency         string                `json:"currency"`
+	FareStructureID  primitive.ObjectID    `json:"fare_structure_id"`
+	Breakdown        *models.FareBreakdown `json:"breakdown"`
+	CreatedAt        time.Time             `json:"created_at"`
+	ExpiresAt        time.Time             `json:"expires_at"`
+}
+
+type routeChangeService struct {
+	rideRepo     interfaces.RideRepository
+	driverRepo   interfaces.DriverRepository
+	fareService  FareCalculationService
+	mapsProvider maps.MapsProvider
+	cache        CacheService
+	wsHandler    *websocket.Handler
+	logger       *logger.Logger
+}
+
+func NewRouteChangeService(
+	rideRepo interfaces.RideRepository,
+	driverRepo interfaces.DriverRepository,
+	fareService FareCalculationService,
+	mapsProvider maps.MapsProvider,
+	cache CacheService,
+	wsHandler *websocket.Handler,
+	logger *logger.Logger,
+) RouteChangeService {
+	return &routeChangeService{
+		rideRepo:     rideRepo,
+		driverRepo:   driverRepo,
+		fareService:  fareService,
+		mapsProvider: mapsProvider,
+		cache:        cache,
+		wsHandler:    wsHandler,
+		logger:       logger,
+	}
+}
+
+// Route Changes
+
+// RequestRouteChange routes the trip with the requested change applied and
+// prices it from the ride's fare structure. A ride under way is re-routed from
+// the driver's last known location, and the part already driven keeps its
+// planned distance and duration. Nothing on the ride changes until the rider
+// accepts the returned quote.
+func (s *routeChangeService) RequestRouteChange(ctx context.Context, rideID, riderID primitive.ObjectID, request *RouteChangeRequest) (*RouteChangeQuote, error) {
+	ride, err := s.getRiderRide(ctx, rideID, riderID)
+	if err != nil {
+		return nil, err
+	}
+
+	dropoff, waypoints, err := applyRouteChange(ride, request)
+	if err != nil {
+		return nil, err
+	}
+
+	origin := ride.PickupLocation
+	if ride.Status == models.RideStatusInProgress {
+		if origin, err = s.driverLocation(ctx, ride); err != nil {
+			return nil, err
+		}
+	}
+
+	route, err := getDrivingRoute(ctx, s.mapsProvider, ride.ID, origin, dropoff, waypoints)
+	if err != nil {
+		return nil, err
+	}
+
+	distance := route.Distance
+	durationMinutes := int(math.Ceil(float64(route.Duration) / 60))
+	if ride.Status == models.RideStatusInProgress {
+		// What is left of the current plan, to tell the driven part from it
+		remaining, err := getDrivingRoute(ctx, s.mapsProvider, ride.ID, origin, ride.DropoffLocation, ride.Waypoints)
+		if err != nil {
+			return nil, err
+		}
+		distance += math.Max(0, ride.EstimatedDistance-remaining.Distance)
+		durationMinutes += max(0, ride.EstimatedDuration-int(math.Ceil(float64(remaining.Duration)/60)))
+	}
+
+	// Price the changed trip, so surcharges follow the new destination and route
+	changed := *ride
+	changed.DropoffLocation = dropoff
+	changed.Waypoints = waypoints
+	changed.Route = route
+
+	breakdown, err := s.fareService.CalculateRideFare(ctx, &changed, distance, durationMinutes, FareRoutePlanned)
+	if err != nil {
+		return nil, fmt.Errorf("failed to calculate fare: %w", err)
+	}
+	newFare := breakdown.Total
+	previousFare := money.FromMajor(ride.EstimatedFare, breakdown.Currency)
+	fareDifference, err := newFare.Sub(previousFare)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compare fares: %w", err)
+	}
+
+	now := time.Now()
+	quote := &RouteChangeQuote{
+		QuoteID:          primitive.NewObjectID().Hex(),
+		RideID:           ride.ID,
+		Request:          *request,
+		DropoffLocation:  dropoff,
+		Waypoints:        waypoints,
+		Route:            route,
+		PreviousFare:     previousFare,
+		NewFare:          newFare,
+		FareDifference:   fareDifference,
+		PreviousDistance: ride.EstimatedDistance,
+		NewDistance:      distance,
+		NewDuration:      durationMinutes,
+		SurgeMultiplier:  breakdown.SurgeMultiplier,
+		Currency:         breakdown.Currency,
+		FareStructureID:  breakdown.FareStructureID,
+		Breakdown:        breakdown,
+		CreatedAt:        now,
+		ExpiresAt:        now.Add(routeChangeQuoteTTL),
+	}
+
+	if err := s.cache.Set(ctx, routeChangeCacheKey(ride.ID), quote, routeChangeQuoteTTL); err != nil {
+		return nil, fmt.Errorf("failed to store route change quote: %w", err)
+	}
+
+	s.recordHistory(ctx, ride, RideHistoryRouteChangeQuoted, map[string]interface{}{
+		"quote_id":          quote.QuoteID,
+		"change_type":       request.Type,
+		"previous_fare":     quote.PreviousFare,
+		"new_fare":          quote.NewFare,
+		"previous_distance": quote.PreviousDistance,
+		"new_distance":      quote.NewDistance,
+		"fare_structure_id": quote.FareStructureID.Hex(),
+	})
+
+	s.wsHandler.SendUserNotification(ride.RiderID, RouteChangeEventQuoted, map[string]interface{}{
+		"ride_id":         ride.ID.Hex(),
+		"quote_id":        quote.QuoteID,
+		"change_type":     request.Type,
+		"previous_fare":   quote.PreviousFare,
+		"new_fare":        quote.NewFare,
+		"fare_difference": quote.FareDifference,
+		"new_distance":    quote.NewDistance,
+		"new_duration":    quote.NewDuration,
+		"currency":        quote.Currency,
+		"expires_at":      quote.ExpiresAt,
+	})
+
+	s.logger.WithRideID(ride.ID).
+		WithField("change_type", request.Type).
+		WithField("previous_fare", quote.PreviousFare).
+		WithField("new_fare", quote.NewFare).
+		Info("Route change quoted")
+
+	return quote, nil
+}
+
+func (s *routeChangeService) AcceptRouteChange(ctx context.Context, rideID, riderID primitive.ObjectID, quoteID string) (*models.Ride, error) {
+	lock, err := s.cache.Lock(ctx, fmt.Sprintf("route_change_lock:%s", rideID.Hex()), routeChangeLockTTL)
+	if err != nil {
+		return nil, fmt.Errorf("route change is being processed, please retry: %w", err)
+	}
+	defer s.cache.Unlock(ctx, lock)
+
+	ride, err := s.getRiderRide(ctx, rideID, riderID)
+	if err != nil {
+		return nil, err
+	}
+
+	quote, err := s.getQuote(ctx, rideID, quoteID)
+	if err != nil {
+		return nil, err
+	}
+
+	// The quote is consumed whether or not applying it succeeds
+	s.cache.Delete(ctx, routeChangeCacheKey(rideID))
+
+	if err := s.applyQuote(ctx, ride, quote); err != nil {
+		return nil, err
+	}
+
+	s.recordHistory(ctx, ride, RideHistoryRouteChangeAccepted, map[string]interface{}{
+		"quote_id":      quote.QuoteID,
+		"change_type":   quote.Request.Type,
+		"previous_fare": quote.PreviousFare,
+		"new_fare":      quote.NewFare,
+		"new_distance":  quote.NewDistance,
+		"new_duration":  quote.NewDuration,
+	})
+
+	updated, err := s.rideRepo.GetByID(ctx, rideID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get ride: %w", err)
+	}
+
+	s.notifyRouteUpdated(ctx, updated, quote)
+
+	s.logger.WithRideID(rideID).
+		WithField("change_type", quote.Request.Type).
+		WithField("new_fare", quote.NewFare).
+		Info("Route change accepted")
+
+	return updated, nil
+}
+
+func (s *routeChangeService) RejectRouteChange(ctx context.Context, rideID, riderID primitive.ObjectID, quoteID string) error {
+	ride, err := s.getRiderRide(ctx, rideID, riderID)
+	if err != nil {
+		return err
+	}
+
+	quote, err := s.getQuote(ctx, rideID, quoteID)
+	if err != nil {
+		return err
+	}
+
+	s.cache.Delete(ctx, routeChangeCacheKey(rideID))
+
+	s.recordHistory(ctx, ride, RideHistoryRouteChangeRejected, map[string]interface{}{
+		"quote_id":    quote.QuoteID,
+		"change_type": quote.Request.Type,
+		"new_fare":    quote.NewFare,
+	})
+
+	return nil
+}
+
+func (s *routeChangeService) GetPendingRouteChange(ctx context.Context, rideID primitive.ObjectID) (*RouteChangeQuote, error) {
+	var quote RouteChangeQuote
+	if err := s.cache.Get(ctx, routeChangeCacheKey(rideID), &quote); err != nil {
+		return nil, fmt.Errorf("no pending route change for this ride")
+	}
+
+	return &quote, nil
+}
+
+// History
+func (s *routeChangeService) GetRideHistory(ctx context.Context, rideID primitive.ObjectID) ([]models.RideHistoryEntry, error) {
+	ride, err := s.rideRepo.GetByID(ctx, rideID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get ride: %w", err)
+	}
+
+	return ride.History, nil
+}
+
+// Helper methods
+func (s *routeChangeService) getRiderRide(ctx context.Context, rideID, riderID primitive.ObjectID) (*models.Ride, error) {
+	ride, err := s.rideRepo.GetByID(ctx, rideID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get ride: %w", err)
+	}
+
+	if ride.RiderID != riderID {
+		return nil, fmt.Errorf("ride does not belong to this rider")
+	}
+
+	switch ride.Status {
+	case models.RideStatusAccepted, models.RideStatusDriverArrived, models.RideStatusInProgress:
+	default:
+		return nil, fmt.Errorf("route cannot be changed for a ride in status %s", ride.Status)
+	}
+
+	if len(ride.SharedWith) > 0 {
+		return nil, fmt.Errorf("route cannot be changed on a shared ride")
+	}
+
+	return ride, nil
+}
+
+// driverLocation returns the last location the ride's driver reported,
+// falling back to the location stored on the driver.
+func (s *routeChangeService) driverLocation(ctx context.Context, ride *models.Ride) (models.Location, error) {
+	if ride.DriverID == nil {
+		return models.Location{}, fmt.Errorf("ride has no driver")
+	}
+
+	if location, err := s.cache.GetDriverLocation(ctx, *ride.DriverID); err == nil && location != nil {
+		return *location, nil
+	}
+
+	driver, err := s.driverRepo.GetByID(ctx, *ride.DriverID)
+	if err != nil {
+		return models.Location{}, fmt.Errorf("failed to get driver: %w", err)
+	}
+	if driver.CurrentLocation == nil {
+		return models.Location{}, fmt.Errorf("driver location is unknown, please retry")
+	}
+
+	return *driver.CurrentLocation, nil
+}
+
+func (s *routeChangeService) getQuote(ctx context.Context, rideID primitive.ObjectID, quoteID string) (*RouteChangeQuote, error) {
+	quote, err := s.GetPendingRouteChange(ctx, rideID)
+	if err != nil {
+		return nil, err
+	}
+
+	if quote.QuoteID != quoteID || time.Now().After(quote.ExpiresAt) {
+		return nil, fmt.Errorf("route change quote has expired, please request a new one")
+	}
+
+	return quote, nil
+}
+
+func (s *routeChangeService) applyQuote(ctx context.Context, ride *models.Ride, quote *RouteChangeQuote) error {
+	switch quote.Request.Type {
+	case RouteChangeAddWaypoint:
+		if err := s.rideRepo.AddWaypoint(ctx, ride.ID, quote.Request.Location); err != nil {
+			return err
+		}
+	case RouteChangeRemoveWaypoint:
+		if err := s.rideRepo.RemoveWaypoint(ctx, ride.ID, quote.Request.WaypointIndex); err != nil {
+			return err
+		}
+	case RouteChangeChangeDestination:
+		if err := s.rideRepo.Update(ctx, ride.ID, map[string]interface{}{
+			"dropoff_location": quote.DropoffLocation,
+		}); err != nil {
+			return fmt.Errorf("failed to update destination: %w", err)
+		}
+	}
+
+	quote.Route.CreatedAt = time.Now()
+	if err := s.rideRepo.UpdateRoute(ctx, ride.ID, quote.Route); err != nil {
+		return fmt.Errorf("failed to update route: %w", err)
+	}
+
+	// The new fare already includes waiting charges accrued at pickup
+	if err := s.rideRepo.Update(ctx, ride.ID, map[string]interface{}{
+		"estimated_fare":     quote.NewFare.Float64(),
+		"estimated_distance": quote.NewDistance,
+		"estimated_duration": quote.NewDuration,
+	}); err != nil {
+		return fmt.Errorf("failed to update fare: %w", err)
+	}
+
+	return nil
+}
+
+func (s *routeChangeService) notifyRouteUpdated(ctx context.Context, ride *models.Ride, quote *RouteChangeQuote) {
+	data := map[string]interface{}{
+		"ride_id":          ride.ID.Hex(),
+		"change_type":      quote.Request.Type,
+		"dropoff_location": ride.DropoffLocation,
+		"waypoints":        ride.Waypoints,
+		"route":            ride.Route,
+		"estimated_fare":   ride.EstimatedFare,
+		"updated_at":       ride.UpdatedAt,
+	}
+
+	s.wsHandler.SendRideUpdate(ride.ID, RouteChangeEventUpdated, data)
+
+	if ride.DriverID == nil {
+		return
+	}
+
+	// Drivers are connected by user ID, so look up the driver's account
+	driver, err := s.driverRepo.GetByID(ctx, *ride.DriverID)
+	if err != nil {
+		s.logger.WithError(err).WithRideID(ride.ID).Warn("Failed to notify driver of route change")
+		return
+	}
+
+	s.wsHandler.SendUserNotification(driver.UserID, RouteChangeEventUpdated, data)
+}
+
+func (s *routeChangeService) recordHistory(ctx context.Context, ride *models.Ride, event string, details map[string]interface{}) {
+	entry := &models.RideHistoryEntry{
+		Event:     event,
+		ActorID:   &ride.RiderID,
+		ActorType: string(models.UserTypeRider),
+		Details:   details,
+		CreatedAt: time.Now(),
+	}
+
+	if err := s.rideRepo.AddHistoryEntry(ctx, ride.ID, entry); err != nil {
+		s.logger.WithError(err).WithRideID(ride.ID).Warn("Failed to record ride history")
+	}
+}
+
+// applyRouteChange returns the destination and waypoints the ride would have
+// after the change, without modifying the ride.
+func applyRouteChange(ride *models.Ride, request *RouteChangeRequest) (models.Location, []models.Location, error) {
+	dropoff := ride.DropoffLocation
+	waypoints := make([]models.Location, len(ride.Waypoints))
+	copy(waypoints, ride.Waypoints)
+
+	switch request.Type {
+	case RouteChangeAddWaypoint:
+		if request.Location == nil {
+			return dropoff, nil, fmt.Errorf("waypoint location is required")
+		}
+		if len(waypoints) >= utils.MaxWaypoints {
+			return dropoff, nil, fmt.Errorf("a ride can have at most %d stops", utils.MaxWaypoints)
+		}
+		waypoints = append(waypoints, *request.Location)
+	case RouteChangeRemoveWaypoint:
+		if request.WaypointIndex < 0 || request.WaypointIndex >= len(waypoints) {
+			return dropoff, nil, fmt.Errorf("waypoint index out of range")
+		}
+		waypoints = append(waypoints[:request.WaypointIndex], waypoints[request.WaypointIndex+1:]...)
+	case RouteChangeChangeDestination:
+		if request.Location == nil {
+			return dropoff, nil, fmt.Errorf("destination location is required")
+		}
+		dropoff = *request.Location
+	default:
+		return dropoff, nil, fmt.Errorf("invalid route change type: %s", request.Type)
+	}
+
+	return dropoff, waypoints, nil
+}
+
+// getDrivingRoute asks the maps provider for a driving route through the
+// waypoints and converts the best one to a ride route.
+func getDrivingRoute(ctx context.Context, mapsProvider maps.MapsProvider, rideID primitive.ObjectID, pickup, dropoff models.Location, waypoints []models.Location) (*models.Route, error) {
+	request := &maps.DirectionsRequest{
+		Origin:      toMapsLocation(pickup),
+		Destination: toMapsLocation(dropoff),
+		Mode:        "driving",
+	}
+	for _, waypoint := range waypoints {
+		request.Waypoints = append(request.Waypoints, toMapsLocation(waypoint))
+	}
+
+	response, err := mapsProvider.GetDirections(ctx, request)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get directions: %w", err)
+	}
+	if len(response.Routes) == 0 {
+		return nil, fmt.Errorf("no route found")
+	}
+
+	return toRideRoute(rideID, pickup, dropoff, waypoints, &response.Routes[0]), nil
+}
+
+func toMapsLocation(location models.Location) maps.Location {
+	return maps.Location{
+		Latitude:  location.Latitude(),
+		Longitude: location.Longitude(),
+	}
+}
+
+func fromMapsLocation(location maps.Location) models.Location {
+	return models.Location{
+		Type:        "Point",
+		Coordinates: []float64{location.Longitude, location.Latitude},
+	}
+}
+
+func toRideRoute(rideID primitive.ObjectID, start, end models.Location, waypoints []models.Location, route *maps.Route) *models.Route {
+	rideRoute := &models.Route{
+		RideID:          rideID,
+		StartLocation:   start,
+		EndLocation:     end,
+		Waypoints:       waypoints,
+		EncodedPolyline: route.Polyline,
+		Distance:        route.Distance.Value / 1000,
+		Duration:        route.Duration.Value,
+		Bounds: &models.RouteBounds{
+			Northeast: fromMapsLocation(route.Bounds.Northeast),
+			Southwest: fromMapsLocation(route.Bounds.Southwest),
+		},
+		CreatedAt: time.Now(),
+	}
+
+	for _, step := range route.Steps {
+		rideRoute.Steps = append(rideRoute.Steps, models.RouteStep{
+			Instruction:     step.Instructions,
+			Distance:        step.Distance.Value / 1000,
+			Duration:        step.Duration.Value,
+			StartLocation:   fromMapsLocation(step.StartPoint),
+			EndLocation:     fromMapsLocation(step.EndPoint),
+			EncodedPolyline: step.Polyline,
+			Maneuver:        step.Maneuver,
+		})
+	}
+
+	return rideRoute
+}
+
+func routeChangeCacheKey(rideID primitive.ObjectID) string {
+	return fmt.Sprintf("route_change:%s", rideID.Hex())
+}
@@ -0,0 +1,278 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	"goride/internal/config"
+	"goride/internal/models"
+	"goride/internal/repositories/interfaces"
+	"goride/pkg/logger"
+	"goride/pkg/websocket"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type ScheduledRideService interface {
+	// Worker
+	Start(ctx context.Context)
+	ProcessScheduledRides(ctx context.Context) error
+}
+
+// Cancellation reason recorded when a scheduled ride never finds a driver
+const ScheduledRideNoDriverReason = "scheduled_ride_no_driver_found"
+
+// Scheduled ride websocket events
+const (
+	ScheduledRideEventReminder  = "scheduled_ride_reminder"
+	ScheduledRideEventSearching = "scheduled_ride_searching"
+)
+
+const (
+	scheduledRideSweepLock    = "scheduled_rides_sweep"
+	scheduledRideMarkerTTL    = 3 * time.Hour
+	scheduledRideQueryWindow  = 30 * time.Minute // GetScheduledRides covers +/-15 minutes
+	scheduledRideFirstNotice  = 60 * time.Minute
+	scheduledRideSecondNotice = 15 * time.Minute
+)
+
+type scheduledRideService struct {
+	rideRepo        interfaces.RideRepository
+	rideService     RideService
+	matchingService MatchingService
+	cache           CacheService
+	wsHandler       *websocket.Handler
+	config          *config.DispatchConfig
+	logger          *logger.Logger
+}
+
+func NewScheduledRideService(
+	rideRepo interfaces.RideRepository,
+	rideService RideService,
+	matchingService MatchingService,
+	cache CacheService,
+	wsHandler *websocket.Handler,
+	config *config.DispatchConfig,
+	logger *logger.Logger,
+) ScheduledRideService {
+	return &scheduledRideService{
+		rideRepo:        rideRepo,
+		rideService:     rideService,
+		matchingService: matchingService,
+		cache:           cache,
+		wsHandler:       wsHandler,
+		config:          config,
+		logger:          logger,
+	}
+}
+
+// Worker
+func (s *scheduledRideService) Start(ctx context.Context) {
+	ticker := time.NewTicker(s.config.ScheduledCheckInterval)
+	defer ticker.Stop()
+
+	s.logger.WithField("interval", s.config.ScheduledCheckInterval.String()).
+		Info("Scheduled ride worker started")
+
+	for {
+		select {
+		case <-ctx.Done():
+			s.logger.Info("Scheduled ride worker stopped")
+			return
+		case <-ticker.C:
+			if err := s.ProcessScheduledRides(ctx); err != nil {
+				s.logger.WithError(err).Error("Failed to process scheduled rides")
+			}
+		}
+	}
+}
+
+// ProcessScheduledRides runs a single sweep. Only one instance sweeps at a
+// time, and every per-ride step is guarded by a marker so a sweep that overlaps
+// with another instance never repeats a reminder, dispatch or escalation.
+func (s *scheduledRideService) ProcessScheduledRides(ctx context.Context) error {
+	lock, err := s.cache.Lock(ctx, scheduledRideSweepLock, s.config.ScheduledCheckInterval)
+	if err != nil {
+		// Another instance holds the sweep
+		return nil
+	}
+	defer s.cache.Unlock(ctx, lock)
+
+	now := time.Now()
+	rides, err := s.getUpcomingRides(ctx, now)
+	if err != nil {
+		return err
+	}
+
+	for _, ride := range rides {
+		if err := s.processRide(ctx, ride, now); err != nil {
+			s.logger.WithError(err).WithRideID(ride.ID).Error("Failed to process scheduled ride")
+		}
+	}
+
+	s.logger.WithField("rides", len(rides)).Debug("Scheduled ride sweep completed")
+
+	return nil
+}
+
+// Helper methods
+
+// getUpcomingRides collects requested rides from just past their pickup time
+// (for the no-driver cut-off) up to the furthest notice or lead time ahead.
+func (s *scheduledRideService) getUpcomingRides(ctx context.Context, now time.Time) ([]*models.Ride, error) {
+	horizon := s.config.ScheduledLeadTime
+	if horizon < scheduledRideFirstNotice {
+		horizon = scheduledRideFirstNotice
+	}
+
+	seen := make(map[primitive.ObjectID]bool)
+	var rides []*models.Ride
+
+	start := now.Add(-s.config.ScheduledNoDriverGrace - scheduledRideQueryWindow/2)
+	for anchor := start; !anchor.After(now.Add(horizon + scheduledRideQueryWindow/2)); anchor = anchor.Add(scheduledRideQueryWindow) {
+		batch, err := s.rideRepo.GetScheduledRides(ctx, anchor)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get scheduled rides: %w", err)
+		}
+
+		for _, ride := range batch {
+			if ride.ScheduledTime == nil || seen[ride.ID] {
+				continue
+			}
+			seen[ride.ID] = true
+			rides = append(rides, ride)
+		}
+	}
+
+	return rides, nil
+}
+
+func (s *scheduledRideService) processRide(ctx context.Context, ride *models.Ride, now time.Time) error {
+	untilPickup := ride.ScheduledTime.Sub(now)
+
+	if untilPickup <= -s.config.ScheduledNoDriverGrace {
+		return s.cancelUnmatchedRide(ctx, ride)
+	}
+
+	if untilPickup <= scheduledRideFirstNotice && untilPickup > scheduledRideSecondNotice {
+		s.sendReminder(ctx, ride, scheduledRideFirstNotice, untilPickup)
+	}
+	if untilPickup <= scheduledRideSecondNotice && untilPickup > 0 {
+		s.sendReminder(ctx, ride, scheduledRideSecondNotice, untilPickup)
+	}
+
+	if untilPickup <= s.config.ScheduledLeadTime {
+		if err := s.startDispatch(ctx, ride, untilPickup); err != nil {
+			return err
+		}
+	}
+
+	if untilPickup <= s.config.ScheduledEscalationTime {
+		if err := s.escalateDispatch(ctx, ride); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *scheduledRideService) sendReminder(ctx context.Context, ride *models.Ride, notice, untilPickup time.Duration) {
+	step := fmt.Sprintf("reminder_%d", int(notice.Minutes()))
+	if !s.markStep(ctx, ride.ID, step) {
+		return
+	}
+
+	s.wsHandler.SendUserNotification(ride.RiderID, ScheduledRideEventReminder, map[string]interface{}{
+		"ride_id":         ride.ID.Hex(),
+		"ride_number":     ride.RideNumber,
+		"scheduled_time":  ride.ScheduledTime,
+		"minutes_until":   int(math.Ceil(untilPickup.Minutes())),
+		"pickup_location": ride.PickupLocation,
+	})
+
+	s.logger.WithRideID(ride.ID).
+		WithField("notice_minutes", int(notice.Minutes())).
+		Info("Scheduled ride reminder sent")
+}
+
+func (s *scheduledRideService) startDispatch(ctx context.Context, ride *models.Ride, untilPickup time.Duration) error {
+	if !s.markStep(ctx, ride.ID, "dispatch") {
+		return nil
+	}
+
+	// Keep searching until the pickup time plus the grace period has passed
+	maxWait := int(math.Ceil((untilPickup + s.config.ScheduledNoDriverGrace).Minutes()))
+	options := &DispatchOptions{
+		MaxWaitTime:  maxWait,
+		ExpiryReason: ScheduledRideNoDriverReason,
+	}
+
+	if _, err := s.matchingService.StartDispatch(ctx, ride, options); err != nil {
+		// Let the next sweep retry
+		s.clearStep(ctx, ride.ID, "dispatch")
+		return fmt.Errorf("failed to start dispatch: %w", err)
+	}
+
+	s.wsHandler.SendUserNotification(ride.RiderID, ScheduledRideEventSearching, map[string]interface{}{
+		"ride_id":        ride.ID.Hex(),
+		"scheduled_time": ride.ScheduledTime,
+	})
+
+	return nil
+}
+
+func (s *scheduledRideService) escalateDispatch(ctx context.Context, ride *models.Ride) error {
+	if !s.markStep(ctx, ride.ID, "escalation") {
+		return nil
+	}
+
+	escalation := &DispatchEscalation{
+		RadiusKM:    s.config.ScheduledEscalationRadiusKM,
+		BonusAmount: s.config.ScheduledEscalationBonus,
+		Reason:      "scheduled_pickup_imminent",
+	}
+
+	if err := s.matchingService.EscalateDispatch(ctx, ride.ID, escalation); err != nil {
+		s.clearStep(ctx, ride.ID, "escalation")
+		return fmt.Errorf("failed to escalate dispatch: %w", err)
+	}
+
+	return nil
+}
+
+// cancelUnmatchedRide is the backstop for rides whose dispatch did not cancel
+// them itself, for example because the instance running it went away.
+func (s *scheduledRideService) cancelUnmatchedRide(ctx context.Context, ride *models.Ride) error {
+	s.matchingService.CancelDispatch(ctx, ride.ID)
+
+	if _, err := s.rideService.CancelRide(ctx, ride.ID, ScheduledRideNoDriverReason, CancelledBySystem); err != nil {
+		return fmt.Errorf("failed to cancel scheduled ride: %w", err)
+	}
+
+	s.logger.WithRideID(ride.ID).
+		WithField("scheduled_time", ride.ScheduledTime).
+		Warn("Scheduled ride cancelled, no driver found")
+
+	return nil
+}
+
+// markStep records that a step ran for a ride and reports whether this caller
+// was the first to do so.
+func (s *scheduledRideService) markStep(ctx context.Context, rideID primitive.ObjectID, step string) bool {
+	marked, err := s.cache.SetNX(ctx, scheduledRideStepKey(rideID, step), time.Now().Unix(), scheduledRideMarkerTTL)
+	if err != nil {
+		s.logger.WithError(err).WithRideID(rideID).Warn("Failed to mark scheduled ride step")
+		return false
+	}
+	return marked
+}
+
+func (s *scheduledRideService) clearStep(ctx context.Context, rideID primitive.ObjectID, step string) {
+	s.cache.Delete(ctx, scheduledRideStepKey(rideID, step))
+}
+
+func scheduledRideStepKey(rideID primitive.ObjectID, step string) string {
+	return fmt.Sprintf("scheduled_ride:%s:%s", rideID.Hex(), step)
+}
@@ -0,0 +1,727 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"goride/internal/config"
+	"goride/internal/models"
+	"goride/internal/repositories/interfaces"
+	"goride/internal/utils"
+	"goride/pkg/hexgrid"
+	"goride/pkg/logger"
+	"goride/pkg/websocket"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type SurgePricingService interface {
+	// Worker
+	Start(ctx context.Context)
+	UpdateSurgePricing(ctx context.Context) error
+
+	// Lookup
+	GetSurgeMultiplier(ctx context.Context, location models.Location, rideType models.RideType) (float64, error)
+	GetExperimentSurgeMultiplier(ctx context.Context, location models.Location, rideType models.RideType, curve *models.SurgeCurveOverride) (float64, error)
+	GetActiveSurges(ctx context.Context) ([]*models.SurgePricing, error)
+	GetSurgeHistory(ctx context.Context, geofenceID primitive.ObjectID, params *utils.PaginationParams) ([]*models.SurgePricing, int64, error)
+
+	// Admin Overrides
+	SetOverride(ctx context.Context, adminID primitive.ObjectID, request *SurgeOverrideRequest) (*models.SurgePricing, error)
+	ClearOverride(ctx context.Context, adminID, geofenceID primitive.ObjectID, reason string) error
+}
+
+// Surge websocket events
+const SurgeEventUpdated = "surge_updated"
+
+// Reasons recorded on engine-computed surge records
+const (
+	SurgeReasonDemand         = "demand_exceeds_supply"
+	SurgeReasonOverrideExpiry = "override_expired"
+)
+
+const surgePricingSweepLock = "surge_pricing_sweep"
+
+type SurgeOverrideRequest struct {
+	GeofenceID primitive.ObjectID `json:"geofence_id" validate:"required"`
+	Multiplier float64            `json:"multiplier" validate:"required,min=1"`
+	RideTypes  []models.RideType  `json:"ride_types"`
+	ExpiresAt  time.Time          `json:"expires_at" validate:"required"`
+	Reason     string             `json:"reason" validate:"required"`
+}
+
+// surgeZone is the per-geofence count gathered by a sweep.
+type surgeZone struct {
+	geofence *models.Geofence
+	cellIDs  []string
+	demand   int
+	supply   int
+}
+
+type surgePricingService struct {
+	surgeRepo      interfaces.SurgePricingRepository
+	geofenceRepo   interfaces.GeofenceRepository
+	rideRepo       interfaces.RideRepository
+	driverRepo     interfaces.DriverRepository
+	cache          CacheService
+	wsHandler      *websocket.Handler
+	config         *config.SurgeConfig
+	dispatchConfig *config.DispatchConfig
+	logger         *logger.Logger
+}
+
+func NewSurgePricingService(
+	surgeRepo interfaces.SurgePricingRepository,
+	geofenceRepo interfaces.GeofenceRepository,
+	rideRepo interfaces.RideRepository,
+	driverRepo interfaces.DriverRepository,
+	cache CacheService,
+	wsHandler *websocket.Handler,
+	config *config.SurgeConfig,
+	dispatchConfig *config.DispatchConfig,
+	logger *logger.Logger,
+) SurgePricingService {
+	return &surgePricingService{
+		surgeRepo:      surgeRepo,
+		geofenceRepo:   geofenceRepo,
+		rideRepo:       rideRepo,
+		driverRepo:     driverRepo,
+		cache:          cache,
+		wsHandler:      wsHandler,
+		config:         config,
+		dispatchConfig: dispatchConfig,
+		logger:         logger,
+	}
+}
+
+// Worker
+func (s *surgePricingService) Start(ctx context.Context) {
+	ticker := time.NewTicker(s.config.UpdateInterval)
+	defer ticker.Stop()
+
+	s.logger.WithField("interval", s.config.UpdateInterval.String()).
+		Info("Surge pricing worker started")
+
+	for {
+		select {
+		case <-ctx.Done():
+			s.logger.Info("Surge pricing worker stopped")
+			return
+		case <-ticker.C:
+			if err := s.UpdateSurgePricing(ctx); err != nil {
+				s.logger.WithError(err).Error("Failed to update surge pricing")
+			}
+		}
+	}
+}
+
+// UpdateSurgePricing runs a single sweep: it counts open requests and idle
+// drivers in every active geofence, moves each zone's multiplier toward the
+// curve and pushes the resulting surge map to drivers.
+func (s *surgePricingService) UpdateSurgePricing(ctx context.Context) error {
+	lock, err := s.cache.Lock(ctx, surgePricingSweepLock, s.config.UpdateInterval)
+	if err != nil {
+		// Another instance holds the sweep
+		return nil
+	}
+	defer s.cache.Unlock(ctx, lock)
+
+	zones, err := s.countZones(ctx)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, zone := range zones {
+		if err := s.updateZone(ctx, zone, now); err != nil {
+			s.logger.WithError(err).
+				WithField("geofence_id", zone.geofence.ID.Hex()).
+				Error("Failed to update surge for geofence")
+		}
+	}
+
+	s.broadcastSurges(ctx)
+
+	s.logger.WithField("geofences", len(zones)).Debug("Surge pricing sweep completed")
+
+	return nil
+}
+
+// Lookup
+
+// GetSurgeMultiplier returns the multiplier for a pickup location, looked up
+// by the pickup's hexgrid cell. Where geofences overlap the highest applicable
+// multiplier wins.
+func (s *surgePricingService) GetSurgeMultiplier(ctx context.Context, location models.Location, rideType models.RideType) (float64, error) {
+	cellID := locationCell(location)
+	if cellID == "" {
+		return 1, nil
+	}
+
+	surges, err := s.surgeRepo.GetActiveByCell(ctx, cellID)
+	if err != nil {
+		return 1, fmt.Errorf("failed to get surges for cell: %w", err)
+	}
+
+	now := time.Now()
+	multiplier := 1.0
+	for _, surge := range surges {
+		if isOverrideExpired(surge, now) || !surgeAppliesTo(surge, rideType) {
+			continue
+		}
+		if surge.Multiplier > multiplier {
+			multiplier = surge.Multiplier
+		}
+	}
+
+	return multiplier, nil
+}
+
+// GetExperimentSurgeMultiplier prices surge at a pickup from a pricing
+// experiment's curve. The curve is read at each zone's latest demand and
+// supply counts and stepped like the engine's, without the smoothing and dwell
+// time the shared zone multiplier goes through. Admin overrides still apply.
+func (s *surgePricingService) GetExperimentSurgeMultiplier(ctx context.Context, location models.Location, rideType models.RideType, curve *models.SurgeCurveOverride) (float64, error) {
+	cellID := locationCell(location)
+	if cellID == "" {
+		return 1, nil
+	}
+
+	surges, err := s.surgeRepo.GetActiveByCell(ctx, cellID)
+	if err != nil {
+		return 1, fmt.Errorf("failed to get surges for cell: %w", err)
+	}
+
+	points := make([]config.SurgeCurvePoint, len(curve.Curve))
+	for i, point := range curve.Curve {
+		points[i] = config.SurgeCurvePoint{Ratio: point.Ratio, Multiplier: point.Multiplier}
+	}
+
+	now := time.Now()
+	multiplier := 1.0
+	for _, surge := range surges {
+		if isOverrideExpired(surge, now) || !surgeAppliesTo(surge, rideType) {
+			continue
+		}
+
+		zoneMultiplier := surge.Multiplier
+		if !surge.IsOverride {
+			target := interpolateSurgeCurve(points, surge.Demand, surge.Supply)
+			zoneMultiplier = s.stepToward(target, target, curve.MaxMultiplier)
+		}
+		if zoneMultiplier > multiplier {
+			multiplier = zoneMultiplier
+		}
+	}
+
+	return multiplier, nil
+}
+
+func (s *surgePricingService) GetActiveSurges(ctx context.Context) ([]*models.SurgePricing, error) {
+	surges, err := s.surgeRepo.GetActive(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get active surges: %w", err)
+	}
+	return surges, nil
+}
+
+func (s *surgePricingService) GetSurgeHistory(ctx context.Context, geofenceID primitive.ObjectID, params *utils.PaginationParams) ([]*models.SurgePricing, int64, error) {
+	return s.surgeRepo.GetHistory(ctx, geofenceID, params)
+}
+
+// Admin Overrides
+
+// SetOverride pins a geofence's multiplier until ExpiresAt. The engine leaves
+// the zone alone while the override holds and resumes from its value after.
+func (s *surgePricingService) SetOverride(ctx context.Context, adminID primitive.ObjectID, request *SurgeOverrideRequest) (*models.SurgePricing, error) {
+	if request.Reason == "" {
+		return nil, fmt.Errorf("a reason is required to override surge pricing")
+	}
+	if request.Multiplier < utils.MinSurgeMultiplier || request.Multiplier > utils.MaxSurgeMultiplier {
+		return nil, fmt.Errorf("surge multiplier must be between %.1f and %.1f", utils.MinSurgeMultiplier, utils.MaxSurgeMultiplier)
+	}
+
+	now := time.Now()
+	if !request.ExpiresAt.After(now) {
+		return nil, fmt.Errorf("override must expire in the future")
+	}
+	if request.ExpiresAt.Sub(now) > s.config.MaxOverride {
+		return nil, fmt.Errorf("override cannot last longer than %s", s.config.MaxOverride)
+	}
+
+	geofence, err := s.geofenceRepo.GetByID(ctx, request.GeofenceID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get geofence: %w", err)
+	}
+
+	cellIDs, err := geofenceCells(geofence)
+	if err != nil {
+		return nil, fmt.Errorf("failed to cover geofence with cells: %w", err)
+	}
+
+	if current, err := s.surgeRepo.GetCurrent(ctx, geofence.ID); err == nil {
+		if err := s.surgeRepo.End(ctx, current.ID, now); err != nil {
+			return nil, fmt.Errorf("failed to end current surge: %w", err)
+		}
+	}
+
+	expiresAt := request.ExpiresAt
+	surge := &models.SurgePricing{
+		Area:             geofence.Name,
+		GeofenceID:       geofence.ID,
+		CellIDs:          cellIDs,
+		RideTypes:        request.RideTypes,
+		Multiplier:       request.Multiplier,
+		TargetMultiplier: request.Multiplier,
+		IsActive:         true,
+		StartTime:        now,
+		Reason:           request.Reason,
+		IsOverride:       true,
+		OverriddenBy:     &adminID,
+		ExpiresAt:        &expiresAt,
+	}
+
+	if err := s.surgeRepo.Create(ctx, surge); err != nil {
+		return nil, fmt.Errorf("failed to create surge override: %w", err)
+	}
+
+	s.broadcastSurges(ctx)
+
+	s.logger.WithUserID(adminID).
+		WithField("geofence_id", geofence.ID.Hex()).
+		WithField("multiplier", surge.Multiplier).
+		WithField("expires_at", expiresAt).
+		WithField("reason", request.Reason).
+		Info("Surge override set")
+
+	return surge, nil
+}
+
+// ClearOverride ends an override early and hands the zone back to the engine.
+func (s *surgePricingService) ClearOverride(ctx context.Context, adminID, geofenceID primitive.ObjectID, reason string) error {
+	if reason == "" {
+		return fmt.Errorf("a reason is required to clear a surge override")
+	}
+
+	current, err := s.surgeRepo.GetCurrent(ctx, geofenceID)
+	if err != nil || !current.IsOverride {
+		return fmt.Errorf("geofence has no surge override")
+	}
+
+	if err := s.surgeRepo.Update(ctx, current.ID, map[string]interface{}{
+		"is_active": false,
+		"end_time":  time.Now(),
+		"reason":    current.Reason + "; cleared: " + reason,
+	}); err != nil {
+		return fmt.Errorf("failed to clear surge override: %w", err)
+	}
+
+	s.broadcastSurges(ctx)
+
+	s.logger.WithUserID(adminID).
+		WithField("geofence_id", geofenceID.Hex()).
+		WithField("reason", reason).
+		Info("Surge override cleared")
+
+	return nil
+}
+
+// Helper methods
+
+// countZones counts requested rides and idle drivers per hexgrid cell and sums
+// them over the cells covering every active geofence. Overlapping geofences
+// each count the same ride or driver. Scheduled rides only count as demand
+// once they are within the dispatch lead time of their pickup.
+func (s *surgePricingService) countZones(ctx context.Context) ([]*surgeZone, error) {
+	geofences, err := s.geofenceRepo.GetActive(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get active geofences: %w", err)
+	}
+
+	rides, err := s.rideRepo.GetPendingRides(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get pending rides: %w", err)
+	}
+
+	horizon := time.Now().Add(s.dispatchConfig.ScheduledLeadTime)
+	demand := make(map[string]int)
+	for _, ride := range rides {
+		if ride.ScheduledTime != nil && ride.ScheduledTime.After(horizon) {
+			continue
+		}
+		if cellID := locationCell(ride.PickupLocation); cellID != "" {
+			demand[cellID]++
+		}
+	}
+
+	var zones []*surgeZone
+	for _, geofence := range geofences {
+		bounds := geofenceBounds(geofence)
+		if bounds == nil {
+			continue
+		}
+
+		cellIDs, err := geofenceCells(geofence)
+		if err != nil {
+			s.logger.WithError(err).
+				WithField("geofence_id", geofence.ID.Hex()).
+				Warn("Failed to cover geofence with cells")
+			continue
+		}
+
+		zone := &surgeZone{geofence: geofence, cellIDs: cellIDs}
+		inZone := make(map[string]bool, len(cellIDs))
+		for _, cellID := range cellIDs {
+			inZone[cellID] = true
+			zone.demand += demand[cellID]
+		}
+
+		drivers, err := s.driverRepo.GetDriversInArea(ctx, bounds)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get drivers in geofence: %w", err)
+		}
+		for _, driver := range drivers {
+			if driver.CurrentLocation != nil && inZone[locationCell(*driver.CurrentLocation)] {
+				zone.supply++
+			}
+		}
+
+		zones = append(zones, zone)
+	}
+
+	return zones, nil
+}
+
+// updateZone applies one engine step to a geofence. A new SurgePricing record
+// is written whenever the multiplier changes, so the collection doubles as the
+// zone's surge history.
+func (s *surgePricingService) updateZone(ctx context.Context, zone *surgeZone, now time.Time) error {
+	current, err := s.surgeRepo.GetCurrent(ctx, zone.geofence.ID)
+	if err != nil {
+		current = nil
+	}
+
+	previous := 1.0
+	if current != nil {
+		previous = current.Multiplier
+	}
+
+	// A zone without surge has been at 1.0 since its last surge ended, and
+	// that holds for the dwell time like any other multiplier
+	var restingSince *time.Time
+	if current == nil {
+		if last, err := s.surgeRepo.GetLastEnded(ctx, zone.geofence.ID); err == nil {
+			restingSince = last.EndTime
+		}
+	}
+
+	target := s.curveMultiplier(zone.demand, zone.supply)
+
+	// While an override holds, the engine's target is still recorded so admins
+	// can see what the zone would be priced at
+	if current != nil && current.IsOverride {
+		if !isOverrideExpired(current, now) {
+			return s.recordCounts(ctx, current, zone, target)
+		}
+
+		if err := s.surgeRepo.Update(ctx, current.ID, map[string]interface{}{
+			"is_active": false,
+			"end_time":  now,
+			"reason":    current.Reason + "; " + SurgeReasonOverrideExpiry,
+		}); err != nil {
+			return fmt.Errorf("failed to end expired override: %w", err)
+		}
+		current = nil
+	}
+
+	multiplier := s.stepToward(previous, target, s.config.MaxMultiplier)
+
+	// Hold the current multiplier until it has been in place for the dwell time
+	if current != nil && multiplier != current.Multiplier && now.Sub(current.StartTime) < s.config.MinDwell {
+		multiplier = current.Multiplier
+	}
+	if restingSince != nil && now.Sub(*restingSince) < s.config.MinDwell {
+		multiplier = utils.MinSurgeMultiplier
+	}
+
+	if current != nil && multiplier == current.Multiplier {
+		return s.recordCounts(ctx, current, zone, target)
+	}
+
+	if current != nil {
+		if err := s.surgeRepo.End(ctx, current.ID, now); err != nil {
+			return fmt.Errorf("failed to end surge: %w", err)
+		}
+	}
+
+	if multiplier <= utils.MinSurgeMultiplier {
+		return nil
+	}
+
+	surge := &models.SurgePricing{
+		Area:             zone.geofence.Name,
+		GeofenceID:       zone.geofence.ID,
+		CellIDs:          zone.cellIDs,
+		Multiplier:       multiplier,
+		TargetMultiplier: target,
+		Demand:           zone.demand,
+		Supply:           zone.supply,
+		IsActive:         true,
+		StartTime:        now,
+		Reason:           SurgeReasonDemand,
+	}
+
+	if err := s.surgeRepo.Create(ctx, surge); err != nil {
+		return fmt.Errorf("failed to create surge: %w", err)
+	}
+
+	s.logger.WithField("geofence_id", zone.geofence.ID.Hex()).
+		WithField("demand", zone.demand).
+		WithField("supply", zone.supply).
+		WithField("multiplier", multiplier).
+		Info("Surge multiplier changed")
+
+	return nil
+}
+
+func (s *surgePricingService) recordCounts(ctx context.Context, surge *models.SurgePricing, zone *surgeZone, target float64) error {
+	return s.surgeRepo.Update(ctx, surge.ID, map[string]interface{}{
+		"cell_ids":          zone.cellIDs,
+		"demand":            zone.demand,
+		"supply":            zone.supply,
+		"target_multiplier": target,
+	})
+}
+
+// curveMultiplier interpolates the configured curve at the demand/supply
+// ratio and caps the result.
+func (s *surgePricingService) curveMultiplier(demand, supply int) float64 {
+	return s.clampMultiplier(interpolateSurgeCurve(s.config.Curve, demand, supply), s.config.MaxMultiplier)
+}
+
+// stepToward smooths the move from previous to target and quantizes it to the
+// configured step. Rounding is always toward the target, and never past it,
+// so the multiplier settles on the target instead of oscillating around it.
+func (s *surgePricingService) stepToward(previous, target, maximum float64) float64 {
+	step := s.config.Step
+	if step <= 0 {
+		step = 0.1
+	}
+
+	previousSteps := math.Round(previous / step)
+	targetSteps := math.Round(target / step)
+	smoothed := previousSteps + s.config.Smoothing*(targetSteps-previousSteps)
+
+	steps := previousSteps
+	switch {
+	case targetSteps > previousSteps:
+		steps = math.Min(math.Ceil(smoothed-1e-9), targetSteps)
+	case targetSteps < previousSteps:
+		steps = math.Max(math.Floor(smoothed+1e-9), targetSteps)
+	}
+
+	return s.clampMultiplier(math.Round(steps*step*100)/100, maximum)
+}
+
+// clampMultiplier keeps a multiplier between 1 and the given maximum, which
+// itself never exceeds the platform limit.
+func (s *surgePricingService) clampMultiplier(multiplier, maximum float64) float64 {
+	if maximum <= 0 || maximum > utils.MaxSurgeMultiplier {
+		maximum = utils.MaxSurgeMultiplier
+	}
+	return math.Max(utils.MinSurgeMultiplier, math.Min(multiplier, maximum))
+}
+
+func (s *surgePricingService) getGeofences(ctx context.Context) (map[primitive.ObjectID]*models.Geofence, error) {
+	geofences, err := s.geofenceRepo.GetActive(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get active geofences: %w", err)
+	}
+
+	byID := make(map[primitive.ObjectID]*models.Geofence, len(geofences))
+	for _, geofence := range geofences {
+		byID[geofence.ID] = geofence
+	}
+	return byID, nil
+}
+
+// broadcastSurges pushes the current surge map to every connected driver so
+// they can reposition toward high-demand zones.
+func (s *surgePricingService) broadcastSurges(ctx context.Context) {
+	surges, err := s.surgeRepo.GetActive(ctx)
+	if err != nil {
+		s.logger.WithError(err).Warn("Failed to load surges for broadcast")
+		return
+	}
+
+	geofences, err := s.getGeofences(ctx)
+	if err != nil {
+		s.logger.WithError(err).Warn("Failed to load geofences for broadcast")
+		return
+	}
+
+	now := time.Now()
+	zones := make([]map[string]interface{}, 0, len(surges))
+	for _, surge := range surges {
+		geofence, exists := geofences[surge.GeofenceID]
+		if !exists || isOverrideExpired(surge, now) || surge.Multiplier <= utils.MinSurgeMultiplier {
+			continue
+		}
+
+		center := geofenceCenter(geofence)
+		zones = append(zones, map[string]interface{}{
+			"geofence_id": geofence.ID.Hex(),
+			"name":        geofence.Name,
+			"cell_ids":    surge.CellIDs,
+			"multiplier":  surge.Multiplier,
+			"ride_types":  surge.RideTypes,
+			"center":      map[string]float64{"lat": center.Lat, "lng": center.Lng},
+			"coordinates": geofence.Coordinates,
+			"radius":      geofence.Radius,
+		})
+	}
+
+	s.wsHandler.SendDriverBroadcast(SurgeEventUpdated, map[string]interface{}{
+		"zones":      zones,
+		"updated_at": now,
+	})
+}
+
+func isOverrideExpired(surge *models.SurgePricing, now time.Time) bool {
+	return surge.IsOverride && surge.ExpiresAt != nil && !now.Before(*surge.ExpiresAt)
+}
+
+// interpolateSurgeCurve reads a curve at the demand/supply ratio, linearly
+// between points and flat beyond the first and last.
+func interpolateSurgeCurve(points []config.SurgeCurvePoint, demand, supply int) float64 {
+	if supply < 1 {
+		supply = 1
+	}
+	ratio := float64(demand) / float64(supply)
+
+	curve := make([]config.SurgeCurvePoint, len(points))
+	copy(curve, points)
+	sort.Slice(curve, func(i, j int) bool { return curve[i].Ratio < curve[j].Ratio })
+
+	multiplier := 1.0
+	switch {
+	case len(curve) == 0:
+	case ratio <= curve[0].Ratio:
+		multiplier = curve[0].Multiplier
+	case ratio >= curve[len(curve)-1].Ratio:
+		multiplier = curve[len(curve)-1].Multiplier
+	default:
+		for i := 1; i < len(curve); i++ {
+			if ratio <= curve[i].Ratio {
+				lower, upper := curve[i-1], curve[i]
+				position := (ratio - lower.Ratio) / (upper.Ratio - lower.Ratio)
+				multiplier = lower.Multiplier + position*(upper.Multiplier-lower.Multiplier)
+				break
+			}
+		}
+	}
+
+	return multiplier
+}
+
+func surgeAppliesTo(surge *models.SurgePricing, rideType models.RideType) bool {
+	if len(surge.RideTypes) == 0 {
+		return true
+	}
+	for _, applicable := range surge.RideTypes {
+		if applicable == rideType {
+			return true
+		}
+	}
+	return false
+}
+
+// geofenceContains reports whether a point lies inside a geofence. Polygon
+// coordinates are [lng, lat] pairs; a circle's first coordinate is its center
+// and its radius is in kilometers.
+func geofenceContains(geofence *models.Geofence, lat, lng float64) bool {
+	point := utils.Point{Lat: lat, Lng: lng}
+
+	switch geofence.Type {
+	case models.GeofenceTypeCircle:
+		if len(geofence.Coordinates) == 0 {
+			return false
+		}
+		return utils.IsPointInCircle(point, utils.NewPointFromCoordinates(geofence.Coordinates[0]), geofence.Radius)
+	case models.GeofenceTypePolygon:
+		return utils.IsPointInPolygon(point, geofencePolygon(geofence))
+	}
+	return false
+}
+
+func geofencePolygon(geofence *models.Geofence) utils.Polygon {
+	polygon := make(utils.Polygon, 0, len(geofence.Coordinates))
+	for _, coordinates := range geofence.Coordinates {
+		polygon = append(polygon, utils.NewPointFromCoordinates(coordinates))
+	}
+	return polygon
+}
+
+// geofenceBounds returns the bounding box used to pre-filter drivers.
+func geofenceBounds(geofence *models.Geofence) *utils.Bounds {
+	if len(geofence.Coordinates) == 0 {
+		return nil
+	}
+
+	if geofence.Type == models.GeofenceTypeCircle {
+		center := utils.NewPointFromCoordinates(geofence.Coordinates[0])
+		latDelta := geofence.Radius / 111.0
+		lngDelta := latDelta / math.Max(math.Cos(center.Lat*math.Pi/180), 0.01)
+		return &utils.Bounds{
+			Northeast: utils.Point{Lat: center.Lat + latDelta, Lng: center.Lng + lngDelta},
+			Southwest: utils.Point{Lat: center.Lat - latDelta, Lng: center.Lng - lngDelta},
+		}
+	}
+
+	return utils.CalculateBounds(geofencePolygon(geofence))
+}
+
+func geofenceCenter(geofence *models.Geofence) utils.Point {
+	if geofence.Type == models.GeofenceTypeCircle && len(geofence.Coordinates) > 0 {
+		return utils.NewPointFromCoordinates(geofence.Coordinates[0])
+	}
+	return utils.CalculateCenter(geofencePolygon(geofence))
+}
+
+// geofenceCells returns the hexgrid cells whose centers lie inside a geofence.
+func geofenceCells(geofence *models.Geofence) ([]string, error) {
+	bounds := geofenceBounds(geofence)
+	if bounds == nil {
+		return nil, fmt.Errorf("geofence has no coordinates")
+	}
+
+	cells, err := hexgrid.Cover(
+		hexgrid.LatLng{Lat: bounds.Southwest.Lat, Lng: bounds.Southwest.Lng},
+		hexgrid.LatLng{Lat: bounds.Northeast.Lat, Lng: bounds.Northeast.Lng},
+		utils.CellResolution,
+		func(point hexgrid.LatLng) bool {
+			return geofenceContains(geofence, point.Lat, point.Lng)
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	cellIDs := make([]string, len(cells))
+	for i, cell := range cells {
+		cellIDs[i] = cell.String()
+	}
+	return cellIDs, nil
+}
+
+// locationCell returns a location's cell at the standard resolution, using the
+// stored one when present.
+func locationCell(location models.Location) string {
+	if location.CellID == "" {
+		location.AssignCell(utils.CellResolution)
+	}
+	return location.CellID
+}
@@ -0,0 +1,478 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"goride/internal/config"
+	"goride/internal/models"
+	"goride/internal/repositories/interfaces"
+	"goride/internal/utils"
+	"goride/pkg/logger"
+	"goride/pkg/money"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type TaxService interface {
+	// Tax Calculation
+	CalculateTax(ctx context.Context, request *TaxRequest) (*TaxResult, error)
+
+	// Tax Rules
+	CreateTaxRule(ctx context.Context, adminID primitive.ObjectID, rule *models.TaxRule) (*models.TaxRule, error)
+	ExpireTaxRule(ctx context.Context, id primitive.ObjectID, at time.Time) error
+	ListTaxRules(ctx context.Context, country string, params *utils.PaginationParams) ([]*models.TaxRule, int64, error)
+
+	// Reports
+	GetTaxReport(ctx context.Context, startDate, endDate time.Time) (map[string]interface{}, error)
+}
+
+// TaxRequest lists the amounts of a charge by component. Taxes are those of the
+// jurisdiction the trip started in, as in force at At.
+type TaxRequest struct {
+	Country    string
+	Region     string
+	City       string
+	Location   *models.Location // checked against geofence rules
+	At         time.Time
+	Currency   string
+	Components map[models.TaxComponent]money.Money
+	Discount   money.Money // spread over the components in proportion to their amounts
+}
+
+type TaxResult struct {
+	Lines                []models.TaxLine
+	Inclusive            money.Money                         // tax contained in the component amounts
+	Exclusive            money.Money                         // tax to add on top of them
+	InclusiveByComponent map[models.TaxComponent]money.Money // share of Inclusive in each component
+}
+
+// RateOn returns the combined rate, in percent, of the taxes on a component.
+func (r *TaxResult) RateOn(component models.TaxComponent) float64 {
+	rate := 0.0
+	for _, line := range r.Lines {
+		for _, taxed := range line.Components {
+			if taxed == component {
+				rate += line.Rate
+				break
+			}
+		}
+	}
+	return rate
+}
+
+// taxComponents fixes the order components are taxed and reported in.
+var taxComponents = []models.TaxComponent{
+	models.TaxComponentRide,
+	models.TaxComponentBookingFee,
+	models.TaxComponentWaiting,
+	models.TaxComponentToll,
+	models.TaxComponentSurcharge,
+	models.TaxComponentTip,
+	models.TaxComponentCancellationFee,
+}
+
+type taxService struct {
+	taxRuleRepo  interfaces.TaxRuleRepository
+	geofenceRepo interfaces.GeofenceRepository
+	paymentRepo  interfaces.PaymentRepository
+	config       *config.PricingConfig
+	logger       *logger.Logger
+}
+
+func NewTaxService(
+	taxRuleRepo interfaces.TaxRuleRepository,
+	geofenceRepo interfaces.GeofenceRepository,
+	paymentRepo interfaces.PaymentRepository,
+	config *config.PricingConfig,
+	logger *logger.Logger,
+) TaxService {
+	return &taxService{
+		taxRuleRepo:  taxRuleRepo,
+		geofenceRepo: geofenceRepo,
+		paymentRepo:  paymentRepo,
+		config:       config,
+		logger:       logger,
+	}
+}
+
+// Tax Calculation
+
+// CalculateTax levies every rule of the trip's jurisdiction on the components
+// it covers. The discount is taken off first, in proportion to the components.
+// Inclusive rules then split each component into its net amount and the tax it
+// contains; exclusive rules are charged on that net amount. Where no rule
+// applies, the configured flat rate is charged exclusive on the fare, as it was
+// before tax rules existed.
+func (s *taxService) CalculateTax(ctx context.Context, request *TaxRequest) (*TaxResult, error) {
+	at := request.At
+	if at.IsZero() {
+		at = time.Now()
+	}
+
+	rules, err := s.matchRules(ctx, request, at)
+	if err != nil {
+		return nil, err
+	}
+
+	zero := money.Zero(request.Currency)
+	result := &TaxResult{
+		Inclusive:            zero,
+		Exclusive:            zero,
+		InclusiveByComponent: make(map[models.TaxComponent]money.Money),
+	}
+
+	amounts, err := discountedComponents(request, zero)
+	if err != nil {
+		return nil, err
+	}
+
+	// Net amount of each component, before any tax it contains
+	net := make(map[models.TaxComponent]money.Money, len(amounts))
+	inclusiveShares := make(map[*models.TaxRule]money.Money)
+	for _, component := range taxComponents {
+		amount, exists := amounts[component]
+		if !exists {
+			continue
+		}
+
+		var inclusive []*models.TaxRule
+		var rates []float64
+		inclusiveRate := 0.0
+		for _, rule := range rules {
+			if rule.Inclusive && rule.Taxes(component) {
+				inclusive = append(inclusive, rule)
+				rates = append(rates, rule.Rate)
+				inclusiveRate += rule.Rate
+			}
+		}
+
+		net[component] = amount.Multiply(1 / (1 + inclusiveRate/100))
+		contained, err := amount.Sub(net[component])
+		if err != nil {
+			return nil, err
+		}
+		result.InclusiveByComponent[component] = contained
+		if len(inclusive) == 0 {
+			continue
+		}
+
+		// Split the contained tax between the inclusive rules so the lines add
+		// up to exactly what the component holds
+		shares, err := contained.Allocate(rates...)
+		if err != nil {
+			return nil, err
+		}
+		for i, rule := range inclusive {
+			if inclusiveShares[rule], err = money.Sum(inclusiveShares[rule], shares[i]); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	for _, rule := range rules {
+		line := models.TaxLine{
+			RuleID:        rule.ID,
+			Name:          rule.Name,
+			TaxCode:       rule.TaxCode,
+			Jurisdiction:  rule.Jurisdiction(),
+			Rate:          rule.Rate,
+			Inclusive:     rule.Inclusive,
+			TaxableAmount: zero,
+		}
+		for _, component := range taxComponents {
+			if _, exists := net[component]; !exists || !rule.Taxes(component) {
+				continue
+			}
+			line.Components = append(line.Components, component)
+			if line.TaxableAmount, err = line.TaxableAmount.Add(net[component]); err != nil {
+				return nil, err
+			}
+		}
+		if !line.TaxableAmount.IsPositive() {
+			continue
+		}
+
+		if rule.Inclusive {
+			line.Amount, err = money.Sum(zero, inclusiveShares[rule])
+			if err == nil {
+				result.Inclusive, err = result.Inclusive.Add(line.Amount)
+			}
+		} else {
+			line.Amount = line.TaxableAmount.Percent(rule.Rate)
+			result.Exclusive, err = result.Exclusive.Add(line.Amount)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		result.Lines = append(result.Lines, line)
+	}
+
+	return result, nil
+}
+
+// Tax Rules
+
+// CreateTaxRule adds a tax for a jurisdiction. Like fare structures, a rule is
+// changed by expiring it and creating its replacement, so past receipts keep
+// resolving to the rule they were taxed under.
+func (s *taxService) CreateTaxRule(ctx context.Context, adminID primitive.ObjectID, rule *models.TaxRule) (*models.TaxRule, error) {
+	rule.Country = strings.ToUpper(rule.Country)
+	if err := validateTaxRule(rule); err != nil {
+		return nil, err
+	}
+
+	if rule.GeofenceID != nil {
+		if _, err := s.geofenceRepo.GetByID(ctx, *rule.GeofenceID); err != nil {
+			return nil, fmt.Errorf("failed to get geofence: %w", err)
+		}
+	}
+
+	if rule.EffectiveFrom.IsZero() {
+		rule.EffectiveFrom = time.Now()
+	}
+	rule.IsActive = true
+	rule.CreatedBy = &adminID
+
+	if err := s.taxRuleRepo.Create(ctx, rule); err != nil {
+		return nil, fmt.Errorf("failed to create tax rule: %w", err)
+	}
+
+	s.logger.WithUserID(adminID).
+		WithField("jurisdiction", rule.Jurisdiction()).
+		WithField("rate", rule.Rate).
+		WithField("inclusive", rule.Inclusive).
+		WithField("effective_from", rule.EffectiveFrom).
+		Info("Tax rule created")
+
+	return rule, nil
+}
+
+func (s *taxService) ExpireTaxRule(ctx context.Context, id primitive.ObjectID, at time.Time) error {
+	rule, err := s.taxRuleRepo.GetByID(ctx, id)
+	if err != nil {
+		return fmt.Errorf("failed to get tax rule: %w", err)
+	}
+
+	if at.Before(rule.EffectiveFrom) {
+		return fmt.Errorf("tax rule cannot expire before it takes effect")
+	}
+
+	if err := s.taxRuleRepo.Update(ctx, id, map[string]interface{}{
+		"effective_until": at,
+	}); err != nil {
+		return fmt.Errorf("failed to expire tax rule: %w", err)
+	}
+
+	return nil
+}
+
+func (s *taxService) ListTaxRules(ctx context.Context, country string, params *utils.PaginationParams) ([]*models.TaxRule, int64, error) {
+	return s.taxRuleRepo.List(ctx, country, params)
+}
+
+// Reports
+
+// GetTaxReport lists the tax collected per jurisdiction and tax for filing,
+// with the tax reversed by refunds netted off. Amounts stay in the currency
+// they were collected in.
+func (s *taxService) GetTaxReport(ctx context.Context, startDate, endDate time.Time) (map[string]interface{}, error) {
+	lines, err := s.paymentRepo.GetTaxByJurisdiction(ctx, startDate, endDate)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get tax by jurisdiction: %w", err)
+	}
+
+	type jurisdictionKey struct {
+		jurisdiction string
+		currency     string
+	}
+	byJurisdiction := make(map[jurisdictionKey]map[string]interface{})
+	var order []jurisdictionKey
+
+	for _, line := range lines {
+		currency := stringValue(line["currency"])
+		collected := moneyValue(line["tax_amount"], currency)
+		refunded := moneyValue(line["refunded_tax"], currency)
+
+		// Amounts within a line share a currency, so the sums cannot fail
+		netTax, _ := collected.Sub(refunded)
+		line["net_tax"] = netTax
+
+		key := jurisdictionKey{jurisdiction: stringValue(line["jurisdiction"]), currency: currency}
+		summary, exists := byJurisdiction[key]
+		if !exists {
+			summary = map[string]interface{}{
+				"jurisdiction": key.jurisdiction,
+				"currency":     currency,
+				"tax_amount":   money.Zero(currency),
+				"refunded_tax": money.Zero(currency),
+				"net_tax":      money.Zero(currency),
+				"taxes":        []map[string]interface{}{},
+			}
+			byJurisdiction[key] = summary
+			order = append(order, key)
+		}
+
+		summary["tax_amount"], _ = summary["tax_amount"].(money.Money).Add(collected)
+		summary["refunded_tax"], _ = summary["refunded_tax"].(money.Money).Add(refunded)
+		summary["net_tax"], _ = summary["net_tax"].(money.Money).Add(netTax)
+		summary["taxes"] = append(summary["taxes"].([]map[string]interface{}), line)
+	}
+
+	jurisdictions := make([]map[string]interface{}, 0, len(order))
+	for _, key := range order {
+		jurisdictions = append(jurisdictions, byJurisdiction[key])
+	}
+
+	return map[string]interface{}{
+		"jurisdictions": jurisdictions,
+		"start_date":    startDate,
+		"end_date":      endDate,
+	}, nil
+}
+
+// Helper methods
+
+// matchRules returns the rules in force for the trip's jurisdiction, or the
+// configured flat rate when none applies.
+func (s *taxService) matchRules(ctx context.Context, request *TaxRequest, at time.Time) ([]*models.TaxRule, error) {
+	active, err := s.taxRuleRepo.GetActive(ctx, at)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get tax rules: %w", err)
+	}
+
+	var geofences map[primitive.ObjectID]*models.Geofence
+	var rules []*models.TaxRule
+	for _, rule := range active {
+		if !jurisdictionMatches(rule.Country, request.Country) ||
+			!jurisdictionMatches(rule.Region, request.Region) ||
+			!jurisdictionMatches(rule.City, request.City) {
+			continue
+		}
+
+		if rule.GeofenceID != nil {
+			if request.Location == nil {
+				continue
+			}
+			if geofences == nil {
+				geofenceList, err := s.geofenceRepo.GetActive(ctx)
+				if err != nil {
+					return nil, fmt.Errorf("failed to get geofences: %w", err)
+				}
+				geofences = make(map[primitive.ObjectID]*models.Geofence, len(geofenceList))
+				for _, geofence := range geofenceList {
+					geofences[geofence.ID] = geofence
+				}
+			}
+			geofence, exists := geofences[*rule.GeofenceID]
+			if !exists || !geofenceContains(geofence, request.Location.Latitude(), request.Location.Longitude()) {
+				continue
+			}
+		}
+
+		rules = append(rules, rule)
+	}
+
+	if len(rules) == 0 && s.config.TaxRate > 0 {
+		rules = append(rules, &models.TaxRule{
+			Name: "Tax",
+			Rate: s.config.TaxRate,
+			Components: []models.TaxComponent{
+				models.TaxComponentRide,
+				models.TaxComponentBookingFee,
+				models.TaxComponentWaiting,
+				models.TaxComponentToll,
+				models.TaxComponentSurcharge,
+			},
+		})
+	}
+
+	return rules, nil
+}
+
+// discountedComponents takes the discount off the request's components in
+// proportion to their amounts, leaving out components with nothing to tax.
+// Tips are the driver's and are never discounted.
+func discountedComponents(request *TaxRequest, zero money.Money) (map[models.TaxComponent]money.Money, error) {
+	var components []models.TaxComponent
+	var ratios []float64
+	total := zero
+	for _, component := range taxComponents {
+		amount, exists := request.Components[component]
+		if !exists || !amount.IsPositive() || component == models.TaxComponentTip {
+			continue
+		}
+		var err error
+		if total, err = total.Add(amount); err != nil {
+			return nil, err
+		}
+		components = append(components, component)
+		ratios = append(ratios, float64(amount.Amount))
+	}
+
+	amounts := make(map[models.TaxComponent]money.Money, len(components)+1)
+	if tip, exists := request.Components[models.TaxComponentTip]; exists && tip.IsPositive() {
+		amounts[models.TaxComponentTip] = tip
+	}
+	if len(components) == 0 {
+		return amounts, nil
+	}
+
+	discount, err := money.Min(request.Discount.Abs(), total)
+	if err != nil {
+		return nil, err
+	}
+	shares, err := discount.Allocate(ratios...)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, component := range components {
+		amount, err := request.Components[component].Sub(shares[i])
+		if err != nil {
+			return nil, err
+		}
+		if amount.IsPositive() {
+			amounts[component] = amount
+		}
+	}
+	return amounts, nil
+}
+
+func jurisdictionMatches(ruleValue, value string) bool {
+	return ruleValue == "" || strings.EqualFold(ruleValue, value)
+}
+
+func validateTaxRule(rule *models.TaxRule) error {
+	if rule.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	if rule.Country == "" && rule.Region == "" && rule.City == "" && rule.GeofenceID == nil {
+		return fmt.Errorf("a jurisdiction is required")
+	}
+	if rule.Rate <= 0 || rule.Rate > 100 {
+		return fmt.Errorf("rate must be above 0 and at most 100 percent")
+	}
+	if len(rule.Components) == 0 {
+		return fmt.Errorf("at least one taxed component is required")
+	}
+	for _, component := range rule.Components {
+		valid := false
+		for _, known := range taxComponents {
+			if component == known {
+				valid = true
+				break
+			}
+		}
+		if !valid {
+			return fmt.Errorf("invalid tax component: %s", component)
+		}
+	}
+	if rule.EffectiveUntil != nil && !rule.EffectiveUntil.After(rule.EffectiveFrom) {
+		return fmt.Errorf("effective until must be after effective from")
+	}
+	return nil
+}
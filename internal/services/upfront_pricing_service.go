@@ -0,0 +1,506 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"goride/internal/config"
+	"goride/internal/models"
+	"goride/internal/repositories/interfaces"
+	"goride/internal/utils"
+	"goride/pkg/logger"
+	"goride/pkg/maps"
+	"goride/pkg/money"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type UpfrontPricingService interface {
+	// Quotes
+	CreateQuote(ctx context.Context, riderID primitive.ObjectID, request *FareQuoteRequest) (*models.FareQuote, error)
+	LockQuote(ctx context.Context, rideID primitive.ObjectID, quoteID string) (*models.Ride, error)
+
+	// Reconciliation
+	ReconcileFare(ctx context.Context, rideID primitive.ObjectID) (*models.FareReconciliation, error)
+	GetFareAudit(ctx context.Context, rideID primitive.ObjectID) (*FareAudit, error)
+}
+
+// Reasons recorded on a fare reconciliation
+const (
+	FareReasonWithinThreshold   = "within_threshold"
+	FareReasonRiderRouteChange  = "rider_route_change"
+	FareReasonDistanceDeviation = "distance_deviation"
+	FareReasonDurationDeviation = "duration_deviation"
+)
+
+// Ride history event recorded when the charged fare is decided
+const RideHistoryFareReconciled = "fare_reconciled"
+
+// Pickup and dropoff may drift this far from the quote before it no longer
+// describes the booked trip
+const fareQuoteLocationToleranceKM = 0.2
+
+type FareQuoteRequest struct {
+	RideType        models.RideType   `json:"ride_type" validate:"required"`
+	PickupLocation  models.Location   `json:"pickup_location" validate:"required"`
+	DropoffLocation models.Location   `json:"dropoff_location" validate:"required"`
+	Waypoints       []models.Location `json:"waypoints"`
+	PromoCode       string            `json:"promo_code"`
+}
+
+// FareAudit collects what a dispute needs to explain a charged fare.
+type FareAudit struct {
+	RideID         primitive.ObjectID         `json:"ride_id"`
+	Quote          *models.FareQuote          `json:"quote"`
+	ActualDistance float64                    `json:"actual_distance"`
+	ActualDuration int                        `json:"actual_duration"`
+	MeteredFare    float64                    `json:"metered_fare"`
+	FinalFare      float64                    `json:"final_fare"`
+	Breakdown      *models.FareBreakdown      `json:"breakdown"`
+	Reconciliation *models.FareReconciliation `json:"reconciliation"`
+	History        []models.RideHistoryEntry  `json:"history"`
+}
+
+type upfrontPricingService struct {
+	rideRepo          interfaces.RideRepository
+	fareService       FareCalculationService
+	surgeService      SurgePricingService
+	experimentService PricingExperimentService
+	mapsProvider      maps.MapsProvider
+	cache             CacheService
+	config            *config.PricingConfig
+	logger            *logger.Logger
+}
+
+func NewUpfrontPricingService(
+	rideRepo interfaces.RideRepository,
+	fareService FareCalculationService,
+	surgeService SurgePricingService,
+	experimentService PricingExperimentService,
+	mapsProvider maps.MapsProvider,
+	cache CacheService,
+	config *config.PricingConfig,
+	logger *logger.Logger,
+) UpfrontPricingService {
+	return &upfrontPricingService{
+		rideRepo:          rideRepo,
+		fareService:       fareService,
+		surgeService:      surgeService,
+		experimentService: experimentService,
+		mapsProvider:      mapsProvider,
+		cache:             cache,
+		config:            config,
+		logger:            logger,
+	}
+}
+
+// Quotes
+
+// CreateQuote prices a trip before it is booked. The returned quote ID carries
+// a signature over the quoted price, so it cannot be altered by the client.
+// Riders enrolled in a pricing experiment are quoted under their arm.
+func (s *upfrontPricingService) CreateQuote(ctx context.Context, riderID primitive.ObjectID, request *FareQuoteRequest) (*models.FareQuote, error) {
+	route, err := getDrivingRoute(ctx, s.mapsProvider, primitive.NilObjectID, request.PickupLocation, request.DropoffLocation, request.Waypoints)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	experiment, err := s.experimentService.Assign(ctx, riderID, request.PickupLocation.City, request.RideType, now)
+	if err != nil {
+		// Quote at regular prices rather than fail the booking
+		s.logger.WithError(err).WithUserID(riderID).Warn("Failed to assign pricing experiment for quote")
+	}
+
+	var surge float64
+	if experiment != nil && experiment.Surge != nil {
+		surge, err = s.surgeService.GetExperimentSurgeMultiplier(ctx, request.PickupLocation, request.RideType, experiment.Surge)
+	} else {
+		surge, err = s.surgeService.GetSurgeMultiplier(ctx, request.PickupLocation, request.RideType)
+	}
+	if err != nil {
+		// Quote without surge rather than fail the booking
+		s.logger.WithError(err).WithUserID(riderID).Warn("Failed to get surge multiplier for quote")
+		surge = 1
+	}
+
+	path, err := utils.DecodePolyline(route.EncodedPolyline)
+	if err != nil {
+		// Quote without tolls rather than fail the booking
+		s.logger.WithError(err).WithUserID(riderID).Warn("Failed to decode route for quote")
+	}
+
+	duration := int(math.Ceil(float64(route.Duration) / 60))
+	breakdown, err := s.fareService.CalculateFare(ctx, &FareCalculationRequest{
+		City:            request.PickupLocation.City,
+		RideType:        request.RideType,
+		RequestedAt:     now,
+		Distance:        route.Distance,
+		Duration:        duration,
+		SurgeMultiplier: surge,
+		PromoCode:       request.PromoCode,
+		RiderID:         riderID,
+		PickupLocation:  &request.PickupLocation,
+		DropoffLocation: &request.DropoffLocation,
+		Path:            path,
+		Experiment:      experiment,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to calculate fare: %w", err)
+	}
+
+	quote := &models.FareQuote{
+		RiderID:         riderID,
+		RideType:        request.RideType,
+		PickupLocation:  request.PickupLocation,
+		DropoffLocation: request.DropoffLocation,
+		Waypoints:       request.Waypoints,
+		Distance:        route.Distance,
+		Duration:        duration,
+		Fare:            breakdown.Total,
+		SurgeMultiplier: breakdown.SurgeMultiplier,
+		Currency:        breakdown.Currency,
+		FareStructureID: breakdown.FareStructureID,
+		EncodedPolyline: route.EncodedPolyline,
+		Breakdown:       breakdown,
+		Experiment:      experiment,
+		CreatedAt:       now,
+		ExpiresAt:       now.Add(s.config.QuoteTTL),
+	}
+
+	id := primitive.NewObjectID().Hex()
+	quote.QuoteID = id + "." + utils.GenerateHMAC(fareQuotePayload(id, quote), s.config.QuoteSecret)
+
+	if err := s.cache.Set(ctx, fareQuoteCacheKey(id), quote, s.config.QuoteTTL); err != nil {
+		return nil, fmt.Errorf("failed to store fare quote: %w", err)
+	}
+
+	if err := s.experimentService.RecordExposure(ctx, quote); err != nil {
+		s.logger.WithError(err).WithUserID(riderID).Warn("Failed to record pricing experiment exposure")
+	}
+
+	s.logger.WithUserID(riderID).
+		WithField("ride_type", request.RideType).
+		WithField("fare", quote.Fare).
+		WithField("distance", quote.Distance).
+		Info("Fare quote created")
+
+	return quote, nil
+}
+
+// LockQuote verifies a quote and locks its price onto a ride. A quote can be
+// used once, by the rider it was issued to, for the trip it was priced for.
+func (s *upfrontPricingService) LockQuote(ctx context.Context, rideID primitive.ObjectID, quoteID string) (*models.Ride, error) {
+	ride, err := s.rideRepo.GetByID(ctx, rideID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get ride: %w", err)
+	}
+
+	if ride.FareQuote != nil {
+		return nil, fmt.Errorf("ride already has a locked fare")
+	}
+
+	quote, err := s.verifyQuote(ctx, quoteID)
+	if err != nil {
+		return nil, err
+	}
+
+	if quote.RiderID != ride.RiderID || quote.RideType != ride.RideType {
+		return nil, fmt.Errorf("fare quote does not match this ride")
+	}
+	if !isSameLocation(quote.PickupLocation, ride.PickupLocation) || !isSameLocation(quote.DropoffLocation, ride.DropoffLocation) {
+		return nil, fmt.Errorf("fare quote does not match this ride's pickup or destination")
+	}
+
+	// Claim the quote before using it, so two rides locking it at once
+	// cannot both get its price
+	id, _, _ := strings.Cut(quoteID, ".")
+	claimed, err := s.cache.SetNX(ctx, fareQuoteClaimKey(id), rideID.Hex(), s.config.QuoteTTL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim fare quote: %w", err)
+	}
+	if !claimed {
+		return nil, fmt.Errorf("fare quote has already been used")
+	}
+
+	now := time.Now()
+	quote.LockedAt = &now
+
+	updates := map[string]interface{}{
+		"fare_quote":         quote,
+		"estimated_fare":     quote.Fare.Float64(),
+		"estimated_distance": quote.Distance,
+		"estimated_duration": quote.Duration,
+		"surge_multiplier":   quote.SurgeMultiplier,
+		"currency":           quote.Currency,
+		"experiment":         quote.Experiment,
+	}
+	// A promotion applied to the quote carries over to the ride's receipt
+	if quote.Breakdown != nil && quote.Breakdown.PromoCode != "" && ride.PromoCode == "" {
+		updates["promo_code"] = quote.Breakdown.PromoCode
+		ride.PromoCode = quote.Breakdown.PromoCode
+	}
+
+	if err := s.rideRepo.Update(ctx, rideID, updates); err != nil {
+		// Give the quote back, so the rider can retry with it
+		s.cache.Delete(ctx, fareQuoteClaimKey(id))
+		return nil, fmt.Errorf("failed to lock fare quote: %w", err)
+	}
+	s.cache.Delete(ctx, fareQuoteCacheKey(id))
+
+	ride.FareQuote = quote
+	ride.EstimatedFare = quote.Fare.Float64()
+	ride.EstimatedDistance = quote.Distance
+	ride.EstimatedDuration = quote.Duration
+	ride.SurgeMultiplier = quote.SurgeMultiplier
+	ride.Currency = quote.Currency
+	ride.Experiment = quote.Experiment
+
+	if err := s.experimentService.RecordConversion(ctx, quote, rideID); err != nil {
+		s.logger.WithError(err).WithRideID(rideID).Warn("Failed to record pricing experiment conversion")
+	}
+
+	s.logger.WithRideID(rideID).
+		WithField("fare", quote.Fare).
+		Info("Fare quote locked")
+
+	return ride, nil
+}
+
+// Reconciliation
+
+// ReconcileFare decides the fare charged for a completed ride. The locked
+// price stands unless the rider changed the route or the trip ran longer than
+// the configured deviation allows, in which case it is re-priced.
+func (s *upfrontPricingService) ReconcileFare(ctx context.Context, rideID primitive.ObjectID) (*models.FareReconciliation, error) {
+	ride, err := s.rideRepo.GetByID(ctx, rideID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get ride: %w", err)
+	}
+
+	if ride.Status != models.RideStatusCompleted {
+		return nil, fmt.Errorf("ride is not completed")
+	}
+	if ride.FareQuote == nil {
+		return nil, fmt.Errorf("ride has no locked fare quote")
+	}
+
+	quote := ride.FareQuote
+	reconciliation := &models.FareReconciliation{
+		Decision:          models.FareDecisionLocked,
+		Reason:            FareReasonWithinThreshold,
+		QuotedFare:        quote.Fare,
+		QuotedDistance:    quote.Distance,
+		QuotedDuration:    quote.Duration,
+		ActualDistance:    ride.ActualDistance,
+		ActualDuration:    ride.ActualDuration,
+		DistanceDeviation: deviationPercent(ride.ActualDistance, quote.Distance),
+		DurationDeviation: deviationPercent(float64(ride.ActualDuration), float64(quote.Duration)),
+		MeteredFare:       money.FromMajor(ride.ActualFare, quote.Currency),
+		WaitingCharge:     money.FromMajor(ride.WaitingCharge, quote.Currency),
+		ReconciledAt:      time.Now(),
+	}
+
+	distance, duration, route := decideFare(ride, reconciliation, s.config)
+
+	// A locked fare is what the rider agreed to, so only waiting time is
+	// added to it; re-priced rides go through the fare calculation again
+	breakdown, err := lockedFareBreakdown(quote, ride.WaitingTime, reconciliation.WaitingCharge, s.config.PlatformCommission)
+	if err != nil {
+		return nil, fmt.Errorf("failed to calculate fare: %w", err)
+	}
+	if reconciliation.Decision == models.FareDecisionRepriced {
+		breakdown, err = s.fareService.CalculateRideFare(ctx, ride, distance, duration, route)
+		if err != nil {
+			return nil, fmt.Errorf("failed to calculate fare: %w", err)
+		}
+	}
+	reconciliation.ChargedFare = breakdown.Total
+
+	if err := s.rideRepo.Update(ctx, rideID, map[string]interface{}{
+		"fare_reconciliation": reconciliation,
+		"fare_breakdown":      breakdown,
+		"final_fare":          reconciliation.ChargedFare.Float64(),
+	}); err != nil {
+		return nil, fmt.Errorf("failed to save fare reconciliation: %w", err)
+	}
+
+	if err := s.rideRepo.AddHistoryEntry(ctx, rideID, &models.RideHistoryEntry{
+		Event:     RideHistoryFareReconciled,
+		ActorType: CancelledBySystem,
+		Details: map[string]interface{}{
+			"decision":           reconciliation.Decision,
+			"reason":             reconciliation.Reason,
+			"quoted_fare":        reconciliation.QuotedFare,
+			"charged_fare":       reconciliation.ChargedFare,
+			"distance_deviation": reconciliation.DistanceDeviation,
+			"duration_deviation": reconciliation.DurationDeviation,
+		},
+	}); err != nil {
+		s.logger.WithError(err).WithRideID(rideID).Warn("Failed to record ride history")
+	}
+
+	s.logger.WithRideID(rideID).
+		WithField("decision", reconciliation.Decision).
+		WithField("reason", reconciliation.Reason).
+		WithField("quoted_fare", reconciliation.QuotedFare).
+		WithField("charged_fare", reconciliation.ChargedFare).
+		Info("Fare reconciled")
+
+	return reconciliation, nil
+}
+
+func (s *upfrontPricingService) GetFareAudit(ctx context.Context, rideID primitive.ObjectID) (*FareAudit, error) {
+	ride, err := s.rideRepo.GetByID(ctx, rideID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get ride: %w", err)
+	}
+
+	return &FareAudit{
+		RideID:         ride.ID,
+		Quote:          ride.FareQuote,
+		ActualDistance: ride.ActualDistance,
+		ActualDuration: ride.ActualDuration,
+		MeteredFare:    ride.ActualFare,
+		FinalFare:      ride.FinalFare,
+		Breakdown:      ride.FareBreakdown,
+		Reconciliation: ride.FareReconciliation,
+		History:        ride.History,
+	}, nil
+}
+
+// Helper methods
+func (s *upfrontPricingService) verifyQuote(ctx context.Context, quoteID string) (*models.FareQuote, error) {
+	id, signature, found := strings.Cut(quoteID, ".")
+	if !found {
+		return nil, fmt.Errorf("invalid fare quote")
+	}
+
+	var quote models.FareQuote
+	if err := s.cache.Get(ctx, fareQuoteCacheKey(id), &quote); err != nil {
+		return nil, fmt.Errorf("fare quote has expired, please request a new one")
+	}
+
+	if quote.QuoteID != quoteID || !utils.VerifyHMAC(fareQuotePayload(id, &quote), signature, s.config.QuoteSecret) {
+		return nil, fmt.Errorf("invalid fare quote")
+	}
+
+	if time.Now().After(quote.ExpiresAt) {
+		return nil, fmt.Errorf("fare quote has expired, please request a new one")
+	}
+
+	return &quote, nil
+}
+
+// fareQuotePayload lists the quote fields covered by its signature.
+func fareQuotePayload(id string, quote *models.FareQuote) string {
+	return fmt.Sprintf("%s|%s|%s|%.6f,%.6f|%.6f,%.6f|%d|%.2f|%s|%d",
+		id,
+		quote.RiderID.Hex(),
+		quote.RideType,
+		quote.PickupLocation.Latitude(), quote.PickupLocation.Longitude(),
+		quote.DropoffLocation.Latitude(), quote.DropoffLocation.Longitude(),
+		quote.Fare.Amount,
+		quote.SurgeMultiplier,
+		quote.Currency,
+		quote.ExpiresAt.Unix(),
+	)
+}
+
+// hasAcceptedRouteChange reports whether the rider accepted a route change
+// after the fare was locked.
+func hasAcceptedRouteChange(ride *models.Ride, quote *models.FareQuote) bool {
+	for _, entry := range ride.History {
+		if entry.Event != RideHistoryRouteChangeAccepted {
+			continue
+		}
+		if quote.LockedAt == nil || entry.CreatedAt.After(*quote.LockedAt) {
+			return true
+		}
+	}
+	return false
+}
+
+// decideFare sets the reconciliation's decision and reason and returns the
+// trip a re-priced ride is charged over.
+func decideFare(ride *models.Ride, reconciliation *models.FareReconciliation, cfg *config.PricingConfig) (float64, int, FareRoute) {
+	switch {
+	case hasAcceptedRouteChange(ride, ride.FareQuote):
+		// The rider already accepted the re-quoted route
+		reconciliation.Decision = models.FareDecisionRepriced
+		reconciliation.Reason = FareReasonRiderRouteChange
+		return ride.EstimatedDistance, ride.EstimatedDuration, FareRoutePlanned
+	case reconciliation.DistanceDeviation > cfg.MaxDistanceDeviation:
+		reconciliation.Decision = models.FareDecisionRepriced
+		reconciliation.Reason = FareReasonDistanceDeviation
+		return ride.ActualDistance, ride.ActualDuration, FareRouteActual
+	case reconciliation.DurationDeviation > cfg.MaxDurationDeviation:
+		reconciliation.Decision = models.FareDecisionRepriced
+		reconciliation.Reason = FareReasonDurationDeviation
+		return ride.ActualDistance, ride.ActualDuration, FareRouteActual
+	}
+
+	return ride.FareQuote.Distance, ride.FareQuote.Duration, FareRoutePlanned
+}
+
+// lockedFareBreakdown is the quote's breakdown with the ride's waiting charge
+// added. The driver earns the waiting charge less the platform commission.
+func lockedFareBreakdown(quote *models.FareQuote, waitingTime int, waiting money.Money, commissionPercent float64) (*models.FareBreakdown, error) {
+	breakdown := models.FareBreakdown{Currency: quote.Currency, Total: quote.Fare}
+	if quote.Breakdown != nil {
+		breakdown = *quote.Breakdown
+	}
+	breakdown.CalculatedAt = time.Now()
+	if waiting.IsZero() {
+		return &breakdown, nil
+	}
+
+	commission := waiting.Percent(commissionPercent)
+	earnings, err := waiting.Sub(commission)
+	if err != nil {
+		return nil, err
+	}
+
+	breakdown.WaitingTime = waitingTime
+	for _, line := range []struct {
+		total  *money.Money
+		amount money.Money
+	}{
+		{&breakdown.WaitingCharge, waiting},
+		{&breakdown.Subtotal, waiting},
+		{&breakdown.Total, waiting},
+		{&breakdown.PlatformFee, commission},
+		{&breakdown.DriverEarnings, earnings},
+	} {
+		sum, err := line.total.Add(line.amount)
+		if err != nil {
+			return nil, err
+		}
+		*line.total = sum
+	}
+
+	return &breakdown, nil
+}
+
+func isSameLocation(a, b models.Location) bool {
+	return utils.CalculateDistance(a.Latitude(), a.Longitude(), b.Latitude(), b.Longitude()) <= fareQuoteLocationToleranceKM
+}
+
+// deviationPercent returns how far actual runs over expected, in percent.
+func deviationPercent(actual, expected float64) float64 {
+	if expected <= 0 {
+		return 0
+	}
+	return math.Round((actual-expected)/expected*100*100) / 100
+}
+
+func fareQuoteCacheKey(id string) string {
+	return fmt.Sprintf("fare_quote:%s", id)
+}
+
+func fareQuoteClaimKey(id string) string {
+	return fmt.Sprintf("fare_quote_claim:%s", id)
+}
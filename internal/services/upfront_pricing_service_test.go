@@ -0,0 +1,190 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"goride/internal/config"
+	"goride/internal/models"
+	"goride/pkg/money"
+)
+
+func TestDecideFare(t *testing.T) {
+	cfg := &config.PricingConfig{MaxDistanceDeviation: 25, MaxDurationDeviation: 50}
+	lockedAt := time.Date(2024, 5, 1, 9, 0, 0, 0, time.UTC)
+
+	routeChange := func(at time.Time) []models.RideHistoryEntry {
+		return []models.RideHistoryEntry{{Event: RideHistoryRouteChangeAccepted, CreatedAt: at}}
+	}
+
+	tests := []struct {
+		name              string
+		history           []models.RideHistoryEntry
+		distanceDeviation float64
+		durationDeviation float64
+		wantDecision      models.FareReconciliationDecision
+		wantReason        string
+		wantDistance      float64
+		wantDuration      int
+		wantRoute         FareRoute
+	}{
+		{
+			name:         "within threshold keeps the quote",
+			wantDecision: models.FareDecisionLocked,
+			wantReason:   FareReasonWithinThreshold,
+			wantDistance: 10,
+			wantDuration: 20,
+			wantRoute:    FareRoutePlanned,
+		},
+		{
+			name:              "deviation at the threshold keeps the quote",
+			distanceDeviation: 25,
+			durationDeviation: 50,
+			wantDecision:      models.FareDecisionLocked,
+			wantReason:        FareReasonWithinThreshold,
+			wantDistance:      10,
+			wantDuration:      20,
+			wantRoute:         FareRoutePlanned,
+		},
+		{
+			name:              "distance over the threshold reprices the actual trip",
+			distanceDeviation: 30,
+			wantDecision:      models.FareDecisionRepriced,
+			wantReason:        FareReasonDistanceDeviation,
+			wantDistance:      14,
+			wantDuration:      35,
+			wantRoute:         FareRouteActual,
+		},
+		{
+			name:              "duration over the threshold reprices the actual trip",
+			durationDeviation: 75,
+			wantDecision:      models.FareDecisionRepriced,
+			wantReason:        FareReasonDurationDeviation,
+			wantDistance:      14,
+			wantDuration:      35,
+			wantRoute:         FareRouteActual,
+		},
+		{
+			name:              "accepted route change reprices the new route",
+			history:           routeChange(lockedAt.Add(time.Minute)),
+			distanceDeviation: 30,
+			wantDecision:      models.FareDecisionRepriced,
+			wantReason:        FareReasonRiderRouteChange,
+			wantDistance:      12,
+			wantDuration:      25,
+			wantRoute:         FareRoutePlanned,
+		},
+		{
+			name:         "route change before the lock is ignored",
+			history:      routeChange(lockedAt.Add(-time.Minute)),
+			wantDecision: models.FareDecisionLocked,
+			wantReason:   FareReasonWithinThreshold,
+			wantDistance: 10,
+			wantDuration: 20,
+			wantRoute:    FareRoutePlanned,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ride := &models.Ride{
+				EstimatedDistance: 12,
+				EstimatedDuration: 25,
+				ActualDistance:    14,
+				ActualDuration:    35,
+				History:           tt.history,
+				FareQuote:         &models.FareQuote{Distance: 10, Duration: 20, LockedAt: &lockedAt},
+			}
+			reconciliation := &models.FareReconciliation{
+				Decision:          models.FareDecisionLocked,
+				Reason:            FareReasonWithinThreshold,
+				DistanceDeviation: tt.distanceDeviation,
+				DurationDeviation: tt.durationDeviation,
+			}
+
+			distance, duration, route := decideFare(ride, reconciliation, cfg)
+
+			if reconciliation.Decision != tt.wantDecision || reconciliation.Reason != tt.wantReason {
+				t.Errorf("decision = %s (%s), want %s (%s)", reconciliation.Decision, reconciliation.Reason, tt.wantDecision, tt.wantReason)
+			}
+			if distance != tt.wantDistance || duration != tt.wantDuration || route != tt.wantRoute {
+				t.Errorf("trip = %v km, %d min, %s; want %v km, %d min, %s", distance, duration, route, tt.wantDistance, tt.wantDuration, tt.wantRoute)
+			}
+		})
+	}
+}
+
+func TestLockedFareBreakdown(t *testing.T) {
+	quoted := &models.FareBreakdown{
+		Currency:       "USD",
+		Subtotal:       money.New(2000, "USD"),
+		Total:          money.New(2000, "USD"),
+		PlatformFee:    money.New(400, "USD"),
+		DriverEarnings: money.New(1600, "USD"),
+	}
+
+	tests := []struct {
+		name         string
+		quote        *models.FareQuote
+		waiting      money.Money
+		wantTotal    money.Money
+		wantWaiting  money.Money
+		wantFee      money.Money
+		wantEarnings money.Money
+	}{
+		{
+			name:         "no waiting charges the quoted fare",
+			quote:        &models.FareQuote{Currency: "USD", Fare: money.New(2000, "USD"), Breakdown: quoted},
+			waiting:      money.Zero("USD"),
+			wantTotal:    money.New(2000, "USD"),
+			wantWaiting:  money.Money{},
+			wantFee:      money.New(400, "USD"),
+			wantEarnings: money.New(1600, "USD"),
+		},
+		{
+			name:         "waiting is added on top of the quote",
+			quote:        &models.FareQuote{Currency: "USD", Fare: money.New(2000, "USD"), Breakdown: quoted},
+			waiting:      money.New(300, "USD"),
+			wantTotal:    money.New(2300, "USD"),
+			wantWaiting:  money.New(300, "USD"),
+			wantFee:      money.New(460, "USD"),
+			wantEarnings: money.New(1840, "USD"),
+		},
+		{
+			name:         "quote without a breakdown charges its fare",
+			quote:        &models.FareQuote{Currency: "USD", Fare: money.New(1500, "USD")},
+			waiting:      money.New(100, "USD"),
+			wantTotal:    money.New(1600, "USD"),
+			wantWaiting:  money.New(100, "USD"),
+			wantFee:      money.New(20, "USD"),
+			wantEarnings: money.New(80, "USD"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			breakdown, err := lockedFareBreakdown(tt.quote, 3, tt.waiting, 20)
+			if err != nil {
+				t.Fatalf("lockedFareBreakdown() error = %v", err)
+			}
+
+			for _, check := range []struct {
+				line      string
+				got, want money.Money
+			}{
+				{"total", breakdown.Total, tt.wantTotal},
+				{"waiting charge", breakdown.WaitingCharge, tt.wantWaiting},
+				{"platform fee", breakdown.PlatformFee, tt.wantFee},
+				{"driver earnings", breakdown.DriverEarnings, tt.wantEarnings},
+			} {
+				if check.got.Amount != check.want.Amount {
+					t.Errorf("%s = %s, want %s", check.line, check.got, check.want)
+				}
+			}
+		})
+	}
+
+	if quoted.Total.Amount != 2000 {
+		t.Errorf("quote breakdown was modified: total = %s", quoted.Total)
+	}
+}
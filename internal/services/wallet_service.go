@@ -0,0 +1,458 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"goride/internal/config"
+	"goride/internal/models"
+	"goride/internal/repositories/interfaces"
+	"goride/internal/utils"
+	"goride/pkg/logger"
+	"goride/pkg/money"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type WalletService interface {
+	// Wallets
+	GetWallet(ctx context.Context, userID primitive.ObjectID, accountType models.LedgerAccountType, currency string) (*models.Wallet, error)
+	GetWallets(ctx context.Context, userID primitive.ObjectID) ([]*models.Wallet, error)
+	GetTransactions(ctx context.Context, userID, walletID primitive.ObjectID, params *utils.PaginationParams) ([]*models.Transaction, int64, error)
+
+	// Movements
+	TopUp(ctx context.Context, userID primitive.ObjectID, amount money.Money, paymentID primitive.ObjectID) (*models.LedgerEntry, error)
+	RecordPayment(ctx context.Context, payment *models.Payment) (*models.LedgerEntry, error)
+	RecordRefund(ctx context.Context, payment *models.Payment, amount money.Money, reference string) (*models.LedgerEntry, error)
+	SettleCash(ctx context.Context, driverID primitive.ObjectID, currency string) (*models.LedgerEntry, error)
+	Withdraw(ctx context.Context, driverID primitive.ObjectID, amount, fee money.Money, reference string) (*models.LedgerEntry, error)
+	ReverseWithdrawal(ctx context.Context, driverID primitive.ObjectID, amount, fee money.Money, reference string) (*models.LedgerEntry, error)
+	Adjust(ctx context.Context, adminID primitive.ObjectID, description, reference string, postings []models.LedgerPosting) (*models.LedgerEntry, error)
+
+	// Invariants
+	Start(ctx context.Context)
+	CheckLedger(ctx context.Context) (*models.LedgerCheck, error)
+}
+
+const ledgerCheckLock = "ledger:check"
+
+type walletService struct {
+	ledgerRepo      interfaces.LedgerRepository
+	exchangeService ExchangeRateService
+	cache           CacheService
+	config          *config.LedgerConfig
+	logger          *logger.Logger
+}
+
+func NewWalletService(
+	ledgerRepo interfaces.LedgerRepository,
+	exchangeService ExchangeRateService,
+	cache CacheService,
+	config *config.LedgerConfig,
+	logger *logger.Logger,
+) WalletService {
+	return &walletService{
+		ledgerRepo:      ledgerRepo,
+		exchangeService: exchangeService,
+		cache:           cache,
+		config:          config,
+		logger:          logger,
+	}
+}
+
+// Wallets
+func (s *walletService) GetWallet(ctx context.Context, userID primitive.ObjectID, accountType models.LedgerAccountType, currency string) (*models.Wallet, error) {
+	if !accountType.IsUserAccount() {
+		return nil, fmt.Errorf("%s is not a user account", accountType)
+	}
+	return s.ledgerRepo.GetAccount(ctx, accountType, userID, strings.ToUpper(currency))
+}
+
+func (s *walletService) GetWallets(ctx context.Context, userID primitive.ObjectID) ([]*models.Wallet, error) {
+	return s.ledgerRepo.GetAccountsByUser(ctx, userID)
+}
+
+func (s *walletService) GetTransactions(ctx context.Context, userID, walletID primitive.ObjectID, params *utils.PaginationParams) ([]*models.Transaction, int64, error) {
+	wallets, err := s.ledgerRepo.GetAccountsByUser(ctx, userID)
+	if err != nil {
+		return nil, 0, err
+	}
+	for _, wallet := range wallets {
+		if wallet.ID == walletID {
+			return s.ledgerRepo.GetTransactions(ctx, walletID, params)
+		}
+	}
+	return nil, 0, fmt.Errorf("wallet not found")
+}
+
+// Movements
+
+// TopUp credits a rider wallet with money charged through the payment
+// provider.
+func (s *walletService) TopUp(ctx context.Context, userID primitive.ObjectID, amount money.Money, paymentID primitive.ObjectID) (*models.LedgerEntry, error) {
+	if !amount.IsPositive() {
+		return nil, fmt.Errorf("top-up amount must be positive")
+	}
+
+	entry := &models.LedgerEntry{
+		Type:        models.LedgerEntryTopUp,
+		Currency:    amount.Currency,
+		Description: "Wallet top-up",
+		Reference:   "top_up:" + paymentID.Hex(),
+		PaymentID:   &paymentID,
+	}
+	return s.post(ctx, entry, []models.LedgerPosting{
+		{AccountType: models.LedgerAccountPaymentClearing, Amount: amount.Neg()},
+		{AccountType: models.LedgerAccountRiderWallet, UserID: userID, Amount: amount},
+	})
+}
+
+// RecordPayment posts a completed payment. The rider's money comes from their
+// wallet, from the driver's cash in transit for cash rides, or from payment
+// clearing. It is split between the driver's earnings, tax payable and
+// platform revenue, with discounts funded from promotions expense. Platform
+// revenue takes the remainder, so rounding in the breakdown never unbalances
+// the entry. Tips go to the driver whole, bonuses are paid to the driver
+// from promotions expense and driver fines are taken from the paying driver's
+// wallet as platform revenue.
+func (s *walletService) RecordPayment(ctx context.Context, payment *models.Payment) (*models.LedgerEntry, error) {
+	if payment.Status != models.PaymentStatusCompleted {
+		return nil, fmt.Errorf("payment is not completed")
+	}
+
+	currency := payment.Amount.Currency
+	amount := func(value money.Money) money.Money {
+		if value.Currency == "" && value.IsZero() {
+			return money.Zero(currency)
+		}
+		return value
+	}
+
+	entry := &models.LedgerEntry{
+		Type:          models.LedgerEntryRidePayment,
+		Currency:      currency,
+		Description:   fmt.Sprintf("%s payment", payment.PaymentType),
+		Reference:     "payment:" + payment.ID.Hex(),
+		PaymentID:     &payment.ID,
+		PaymentMethod: payment.PaymentMethod,
+		ExchangeRate:  payment.ExchangeRate,
+	}
+	if !payment.RideID.IsZero() {
+		entry.RideID = &payment.RideID
+	}
+
+	source, err := paymentSource(payment)
+	if err != nil {
+		return nil, err
+	}
+	source.Amount = payment.Amount.Neg()
+
+	var postings []models.LedgerPosting
+	switch payment.PaymentType {
+	case models.PaymentTypeRefund:
+		return nil, fmt.Errorf("refunds are recorded against the payment they refund")
+	case models.PaymentTypeTip:
+		if payment.PayeeID.IsZero() {
+			return nil, fmt.Errorf("tip has no driver")
+		}
+		postings = []models.LedgerPosting{
+			source,
+			{AccountType: models.LedgerAccountDriverWallet, UserID: payment.PayeeID, Amount: payment.Amount},
+		}
+	case models.PaymentTypeBonus:
+		if payment.PayeeID.IsZero() {
+			return nil, fmt.Errorf("bonus has no driver")
+		}
+		postings = []models.LedgerPosting{
+			{AccountType: models.LedgerAccountPromotionsExpense, Amount: payment.Amount.Neg()},
+			{AccountType: models.LedgerAccountDriverWallet, UserID: payment.PayeeID, Amount: payment.Amount},
+		}
+	case models.PaymentTypeDriverFine:
+		postings = []models.LedgerPosting{
+			{AccountType: models.LedgerAccountDriverWallet, UserID: payment.PayerID, Amount: payment.Amount.Neg()},
+			{AccountType: models.LedgerAccountPlatformRevenue, Amount: payment.Amount},
+		}
+	default:
+		discount := amount(payment.DiscountAmount)
+		driverEarnings := amount(payment.DriverEarnings)
+		tax := amount(payment.TaxAmount)
+		if driverEarnings.IsPositive() && payment.PayeeID.IsZero() {
+			return nil, fmt.Errorf("payment has driver earnings but no driver")
+		}
+
+		revenue, err := money.Sum(payment.Amount, discount, driverEarnings.Neg(), tax.Neg())
+		if err != nil {
+			return nil, fmt.Errorf("failed to total payment: %w", err)
+		}
+
+		postings = []models.LedgerPosting{
+			source,
+			{AccountType: models.LedgerAccountPromotionsExpense, Amount: discount.Neg()},
+			{AccountType: models.LedgerAccountDriverWallet, UserID: payment.PayeeID, Amount: driverEarnings},
+			{AccountType: models.LedgerAccountTaxPayable, Amount: tax},
+			{AccountType: models.LedgerAccountPlatformRevenue, Amount: revenue},
+		}
+	}
+
+	return s.post(ctx, entry, postings)
+}
+
+// RecordRefund posts money returned to a rider out of platform revenue. Card
+// refunds go back through payment clearing; wallet and cash payments are
+// refunded to the rider wallet.
+func (s *walletService) RecordRefund(ctx context.Context, payment *models.Payment, amount money.Money, reference string) (*models.LedgerEntry, error) {
+	if !amount.IsPositive() {
+		return nil, fmt.Errorf("refund amount must be positive")
+	}
+
+	destination := models.LedgerPosting{AccountType: models.LedgerAccountPaymentClearing, Amount: amount}
+	switch payment.PaymentMethod {
+	case models.PaymentMethodWallet, models.PaymentMethodCash:
+		destination = models.LedgerPosting{AccountType: models.LedgerAccountRiderWallet, UserID: payment.PayerID, Amount: amount}
+	}
+
+	entry := &models.LedgerEntry{
+		Type:         models.LedgerEntryRefund,
+		Currency:     amount.Currency,
+		Description:  "Payment refund",
+		Reference:    "refund:" + reference,
+		PaymentID:    &payment.ID,
+		ExchangeRate: payment.ExchangeRate,
+	}
+	if !payment.RideID.IsZero() {
+		entry.RideID = &payment.RideID
+	}
+
+	return s.post(ctx, entry, []models.LedgerPosting{
+		{AccountType: models.LedgerAccountPlatformRevenue, Amount: amount.Neg()},
+		destination,
+	})
+}
+
+// SettleCash lets a driver keep the cash they collected: the cash in transit
+// is cleared against their wallet, which is left owing the platform its share
+// of the cash rides.
+func (s *walletService) SettleCash(ctx context.Context, driverID primitive.ObjectID, currency string) (*models.LedgerEntry, error) {
+	currency = strings.ToUpper(currency)
+	cash, err := s.ledgerRepo.GetAccount(ctx, models.LedgerAccountCashInTransit, driverID, currency)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get cash in transit: %w", err)
+	}
+	if cash.Balance.IsZero() {
+		return nil, fmt.Errorf("driver has no cash in transit")
+	}
+
+	// The version makes the reference unique per settlement
+	entry := &models.LedgerEntry{
+		Type:        models.LedgerEntryCashSettlement,
+		Currency:    currency,
+		Description: "Cash collected on rides",
+		Reference:   fmt.Sprintf("cash_settlement:%s:%d", cash.ID.Hex(), cash.Version),
+	}
+	return s.post(ctx, entry, []models.LedgerPosting{
+		{AccountType: models.LedgerAccountCashInTransit, UserID: driverID, Amount: cash.Balance.Neg()},
+		{AccountType: models.LedgerAccountDriverWallet, UserID: driverID, Amount: cash.Balance},
+	})
+}
+
+// Withdraw pays money out of a driver wallet, less a fee kept as platform
+// revenue. The wallet must cover the amount and the fee.
+func (s *walletService) Withdraw(ctx context.Context, driverID primitive.ObjectID, amount, fee money.Money, reference string) (*models.LedgerEntry, error) {
+	if !amount.IsPositive() {
+		return nil, fmt.Errorf("withdrawal amount must be positive")
+	}
+	if fee.IsNegative() {
+		return nil, fmt.Errorf("withdrawal fee cannot be negative")
+	}
+	if fee.Currency == "" {
+		fee = money.Zero(amount.Currency)
+	}
+
+	debit, err := amount.Add(fee)
+	if err != nil {
+		return nil, err
+	}
+
+	entry := &models.LedgerEntry{
+		Type:        models.LedgerEntryWithdrawal,
+		Currency:    amount.Currency,
+		Description: "Wallet withdrawal",
+		Reference:   "withdrawal:" + reference,
+	}
+	return s.post(ctx, entry, []models.LedgerPosting{
+		{AccountType: models.LedgerAccountDriverWallet, UserID: driverID, Amount: debit.Neg(), RequireFunds: true},
+		{AccountType: models.LedgerAccountPaymentClearing, Amount: amount},
+		{AccountType: models.LedgerAccountPlatformRevenue, Amount: fee},
+	})
+}
+
+// ReverseWithdrawal puts a withdrawal that never reached the driver back in
+// their wallet, fee included.
+func (s *walletService) ReverseWithdrawal(ctx context.Context, driverID primitive.ObjectID, amount, fee money.Money, reference string) (*models.LedgerEntry, error) {
+	if !amount.IsPositive() {
+		return nil, fmt.Errorf("withdrawal amount must be positive")
+	}
+	if fee.Currency == "" {
+		fee = money.Zero(amount.Currency)
+	}
+
+	credit, err := amount.Add(fee)
+	if err != nil {
+		return nil, err
+	}
+
+	entry := &models.LedgerEntry{
+		Type:        models.LedgerEntryWithdrawalReversal,
+		Currency:    amount.Currency,
+		Description: "Wallet withdrawal reversed",
+		Reference:   "withdrawal_reversal:" + reference,
+	}
+	return s.post(ctx, entry, []models.LedgerPosting{
+		{AccountType: models.LedgerAccountPaymentClearing, Amount: amount.Neg()},
+		{AccountType: models.LedgerAccountPlatformRevenue, Amount: fee.Neg()},
+		{AccountType: models.LedgerAccountDriverWallet, UserID: driverID, Amount: credit},
+	})
+}
+
+// Adjust posts a manual correction. It must balance like any other entry.
+func (s *walletService) Adjust(ctx context.Context, adminID primitive.ObjectID, description, reference string, postings []models.LedgerPosting) (*models.LedgerEntry, error) {
+	if description == "" || reference == "" {
+		return nil, fmt.Errorf("adjustments need a description and a reference")
+	}
+	if len(postings) == 0 {
+		return nil, fmt.Errorf("adjustment has no postings")
+	}
+
+	entry := &models.LedgerEntry{
+		Type:        models.LedgerEntryAdjustment,
+		Currency:    postings[0].Amount.Currency,
+		Description: description,
+		Reference:   "adjustment:" + reference,
+		CreatedBy:   &adminID,
+	}
+	return s.post(ctx, entry, postings)
+}
+
+// Invariants
+
+// Start runs the ledger check until the context is cancelled.
+func (s *walletService) Start(ctx context.Context) {
+	ticker := time.NewTicker(s.config.CheckInterval)
+	defer ticker.Stop()
+
+	s.logger.WithField("interval", s.config.CheckInterval.String()).
+		Info("Ledger check worker started")
+
+	for {
+		select {
+		case <-ctx.Done():
+			s.logger.Info("Ledger check worker stopped")
+			return
+		case <-ticker.C:
+			lock, err := s.cache.Lock(ctx, ledgerCheckLock, s.config.CheckInterval)
+			if err != nil {
+				// Another instance runs the check
+				continue
+			}
+			if _, err := s.CheckLedger(ctx); err != nil {
+				s.logger.WithError(err).Error("Failed to check ledger")
+			}
+			s.cache.Unlock(ctx, lock)
+		}
+	}
+}
+
+// CheckLedger proves the ledger sound and records the result: in every
+// currency the account balances and the postings each sum to zero, every
+// entry balances and every account's balance is the sum of its postings.
+func (s *walletService) CheckLedger(ctx context.Context) (*models.LedgerCheck, error) {
+	totals, err := s.ledgerRepo.GetTotals(ctx)
+	if err != nil {
+		return nil, err
+	}
+	unbalanced, err := s.ledgerRepo.GetUnbalancedEntries(ctx)
+	if err != nil {
+		return nil, err
+	}
+	drifted, err := s.ledgerRepo.GetDriftedAccounts(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	check := &models.LedgerCheck{
+		Balanced:          len(unbalanced) == 0 && len(drifted) == 0,
+		Totals:            totals,
+		UnbalancedEntries: unbalanced,
+		DriftedAccounts:   drifted,
+		CheckedAt:         time.Now(),
+	}
+	for _, total := range totals {
+		if !total.Balance.IsZero() || !total.Postings.IsZero() {
+			check.Balanced = false
+		}
+	}
+
+	if err := s.ledgerRepo.CreateCheck(ctx, check); err != nil {
+		return nil, err
+	}
+
+	if !check.Balanced {
+		s.logger.WithField("check_id", check.ID.Hex()).
+			WithField("unbalanced_entries", len(unbalanced)).
+			WithField("drifted_accounts", len(drifted)).
+			Error("Ledger does not sum to zero")
+	}
+
+	return check, nil
+}
+
+// Helper methods
+
+// post writes an entry once: an entry already posted under the same
+// reference is returned as it is. Zero postings are left out.
+func (s *walletService) post(ctx context.Context, entry *models.LedgerEntry, postings []models.LedgerPosting) (*models.LedgerEntry, error) {
+	if existing, err := s.ledgerRepo.GetEntryByReference(ctx, entry.Reference); err == nil {
+		return existing, nil
+	}
+
+	var nonZero []models.LedgerPosting
+	for _, posting := range postings {
+		if !posting.Amount.IsZero() {
+			nonZero = append(nonZero, posting)
+		}
+	}
+
+	// Payments and refunds carry the rate taken at charge time; any other
+	// movement is reported at today's rate
+	if err := s.exchangeService.SnapshotEntry(ctx, entry); err != nil {
+		s.logger.WithError(err).WithField("reference", entry.Reference).Warn("Ledger entry posted without an exchange rate snapshot")
+	}
+
+	if _, err := s.ledgerRepo.PostEntry(ctx, entry, nonZero); err != nil {
+		return nil, err
+	}
+
+	s.logger.WithField("entry_id", entry.ID.Hex()).
+		WithField("type", entry.Type).
+		WithField("reference", entry.Reference).
+		Info("Ledger entry posted")
+
+	return entry, nil
+}
+
+// paymentSource is the account a payment's money is taken from.
+func paymentSource(payment *models.Payment) (models.LedgerPosting, error) {
+	switch payment.PaymentMethod {
+	case models.PaymentMethodWallet:
+		return models.LedgerPosting{AccountType: models.LedgerAccountRiderWallet, UserID: payment.PayerID}, nil
+	case models.PaymentMethodCash:
+		if payment.PayeeID.IsZero() {
+			return models.LedgerPosting{}, fmt.Errorf("cash payment has no driver")
+		}
+		return models.LedgerPosting{AccountType: models.LedgerAccountCashInTransit, UserID: payment.PayeeID}, nil
+	default:
+		return models.LedgerPosting{AccountType: models.LedgerAccountPaymentClearing}, nil
+	}
+}
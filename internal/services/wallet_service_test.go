@@ -0,0 +1,280 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"goride/internal/models"
+	"goride/pkg/money"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestRecordPaymentBalances(t *testing.T) {
+	usd := func(amount int64) money.Money { return money.New(amount, "USD") }
+
+	tests := []struct {
+		name    string
+		payment models.Payment
+		want    map[models.LedgerAccountType]int64
+	}{
+		{
+			name: "card ride splits the fare",
+			payment: models.Payment{
+				PaymentType:    models.PaymentTypeRide,
+				PaymentMethod:  models.PaymentMethodCreditCard,
+				Amount:         usd(2000),
+				DiscountAmount: usd(300),
+				DriverEarnings: usd(1600),
+				TaxAmount:      usd(150),
+			},
+			want: map[models.LedgerAccountType]int64{
+				models.LedgerAccountPaymentClearing:   -2000,
+				models.LedgerAccountPromotionsExpense: -300,
+				models.LedgerAccountDriverWallet:      1600,
+				models.LedgerAccountTaxPayable:        150,
+				models.LedgerAccountPlatformRevenue:   550,
+			},
+		},
+		{
+			name: "wallet ride without discount or tax",
+			payment: models.Payment{
+				PaymentType:    models.PaymentTypeRide,
+				PaymentMethod:  models.PaymentMethodWallet,
+				Amount:         usd(1000),
+				DriverEarnings: usd(800),
+			},
+			want: map[models.LedgerAccountType]int64{
+				models.LedgerAccountRiderWallet:     -1000,
+				models.LedgerAccountDriverWallet:    800,
+				models.LedgerAccountPlatformRevenue: 200,
+			},
+		},
+		{
+			name: "cash ride is owed by the driver's cash in transit",
+			payment: models.Payment{
+				PaymentType:    models.PaymentTypeRide,
+				PaymentMethod:  models.PaymentMethodCash,
+				Amount:         usd(1001),
+				DriverEarnings: usd(801),
+				TaxAmount:      usd(99),
+			},
+			want: map[models.LedgerAccountType]int64{
+				models.LedgerAccountCashInTransit:   -1001,
+				models.LedgerAccountDriverWallet:    801,
+				models.LedgerAccountTaxPayable:      99,
+				models.LedgerAccountPlatformRevenue: 101,
+			},
+		},
+		{
+			name: "fully discounted ride is funded by promotions",
+			payment: models.Payment{
+				PaymentType:    models.PaymentTypeRide,
+				PaymentMethod:  models.PaymentMethodCreditCard,
+				Amount:         usd(0),
+				DiscountAmount: usd(1200),
+				DriverEarnings: usd(960),
+			},
+			want: map[models.LedgerAccountType]int64{
+				models.LedgerAccountPromotionsExpense: -1200,
+				models.LedgerAccountDriverWallet:      960,
+				models.LedgerAccountPlatformRevenue:   240,
+			},
+		},
+		{
+			name: "tip goes to the driver whole",
+			payment: models.Payment{
+				PaymentType:   models.PaymentTypeTip,
+				PaymentMethod: models.PaymentMethodCreditCard,
+				Amount:        usd(500),
+			},
+			want: map[models.LedgerAccountType]int64{
+				models.LedgerAccountPaymentClearing: -500,
+				models.LedgerAccountDriverWallet:    500,
+			},
+		},
+		{
+			name: "bonus is paid from promotions",
+			payment: models.Payment{
+				PaymentType:   models.PaymentTypeBonus,
+				PaymentMethod: models.PaymentMethodCreditCard,
+				Amount:        usd(1000),
+			},
+			want: map[models.LedgerAccountType]int64{
+				models.LedgerAccountPromotionsExpense: -1000,
+				models.LedgerAccountDriverWallet:      1000,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ledger := newFakeLedgerRepo()
+			service := NewWalletService(ledger, fakeExchange{}, newFakeCache(), nil, newTestLogger(t))
+
+			p := tt.payment
+			p.ID = primitive.NewObjectID()
+			p.RideID = primitive.NewObjectID()
+			p.PayerID = primitive.NewObjectID()
+			p.PayeeID = primitive.NewObjectID()
+			p.Status = models.PaymentStatusCompleted
+
+			entry, err := service.RecordPayment(context.Background(), &p)
+			if err != nil {
+				t.Fatalf("RecordPayment() error = %v", err)
+			}
+			assertPostings(t, ledger.postings[entry.Reference], tt.want)
+
+			again, err := service.RecordPayment(context.Background(), &p)
+			if err != nil {
+				t.Fatalf("second RecordPayment() error = %v", err)
+			}
+			if again.ID != entry.ID || len(ledger.entries) != 1 {
+				t.Errorf("payment posted %d times, want once", len(ledger.entries))
+			}
+		})
+	}
+}
+
+func TestRecordRefundBalances(t *testing.T) {
+	tests := []struct {
+		name   string
+		method models.PaymentMethod
+		want   map[models.LedgerAccountType]int64
+	}{
+		{
+			name:   "card refund goes back through payment clearing",
+			method: models.PaymentMethodCreditCard,
+			want: map[models.LedgerAccountType]int64{
+				models.LedgerAccountPlatformRevenue: -400,
+				models.LedgerAccountPaymentClearing: 400,
+			},
+		},
+		{
+			name:   "wallet refund goes to the rider wallet",
+			method: models.PaymentMethodWallet,
+			want: map[models.LedgerAccountType]int64{
+				models.LedgerAccountPlatformRevenue: -400,
+				models.LedgerAccountRiderWallet:     400,
+			},
+		},
+		{
+			name:   "cash refund goes to the rider wallet",
+			method: models.PaymentMethodCash,
+			want: map[models.LedgerAccountType]int64{
+				models.LedgerAccountPlatformRevenue: -400,
+				models.LedgerAccountRiderWallet:     400,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ledger := newFakeLedgerRepo()
+			service := NewWalletService(ledger, fakeExchange{}, newFakeCache(), nil, newTestLogger(t))
+
+			p := &models.Payment{
+				ID:            primitive.NewObjectID(),
+				PayerID:       primitive.NewObjectID(),
+				PaymentMethod: tt.method,
+				Amount:        money.New(1500, "USD"),
+				Status:        models.PaymentStatusCompleted,
+			}
+
+			entry, err := service.RecordRefund(context.Background(), p, money.New(400, "USD"), "re_1")
+			if err != nil {
+				t.Fatalf("RecordRefund() error = %v", err)
+			}
+			assertPostings(t, ledger.postings[entry.Reference], tt.want)
+		})
+	}
+}
+
+// TestPostSnapshotsExchangeRate checks payments and refunds are reported at
+// the rate taken when the payment was charged, and other movements at the
+// rate of the day they are posted.
+func TestPostSnapshotsExchangeRate(t *testing.T) {
+	charged := &models.ExchangeRate{From: "USD", To: "EUR", Rate: 0.8, Source: "charge"}
+	p := &models.Payment{
+		ID:             primitive.NewObjectID(),
+		PayerID:        primitive.NewObjectID(),
+		PayeeID:        primitive.NewObjectID(),
+		PaymentType:    models.PaymentTypeRide,
+		PaymentMethod:  models.PaymentMethodCreditCard,
+		Amount:         money.New(2000, "USD"),
+		DriverEarnings: money.New(1600, "USD"),
+		Status:         models.PaymentStatusCompleted,
+		ExchangeRate:   charged,
+	}
+
+	tests := []struct {
+		name       string
+		post       func(WalletService) (*models.LedgerEntry, error)
+		wantSource string
+	}{
+		{
+			name: "payment keeps its charge rate",
+			post: func(s WalletService) (*models.LedgerEntry, error) {
+				return s.RecordPayment(context.Background(), p)
+			},
+			wantSource: "charge",
+		},
+		{
+			name: "refund keeps the charge rate",
+			post: func(s WalletService) (*models.LedgerEntry, error) {
+				return s.RecordRefund(context.Background(), p, money.New(500, "USD"), "re_1")
+			},
+			wantSource: "charge",
+		},
+		{
+			name: "top-up is reported at today's rate",
+			post: func(s WalletService) (*models.LedgerEntry, error) {
+				return s.TopUp(context.Background(), p.PayerID, money.New(1000, "USD"), primitive.NewObjectID())
+			},
+			wantSource: "today",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := NewWalletService(newFakeLedgerRepo(), fakeExchange{}, newFakeCache(), nil, newTestLogger(t))
+
+			entry, err := tt.post(service)
+			if err != nil {
+				t.Fatalf("post error = %v", err)
+			}
+			if entry.ExchangeRate == nil || entry.ExchangeRate.Source != tt.wantSource {
+				t.Errorf("entry rate = %+v, want the %s rate", entry.ExchangeRate, tt.wantSource)
+			}
+		})
+	}
+}
+
+// assertPostings checks an entry sums to zero, leaves out zero postings and
+// moves the wanted amount on each account.
+func assertPostings(t *testing.T, postings []models.LedgerPosting, want map[models.LedgerAccountType]int64) {
+	t.Helper()
+
+	var sum int64
+	got := make(map[models.LedgerAccountType]int64)
+	for _, posting := range postings {
+		if posting.Amount.IsZero() {
+			t.Errorf("zero posting to %s", posting.AccountType)
+		}
+		sum += posting.Amount.Amount
+		got[posting.AccountType] += posting.Amount.Amount
+	}
+
+	if sum != 0 {
+		t.Errorf("postings sum to %d, want 0", sum)
+	}
+	if len(got) != len(want) {
+		t.Errorf("postings = %v, want %v", got, want)
+		return
+	}
+	for account, amount := range want {
+		if got[account] != amount {
+			t.Errorf("%s = %d, want %d", account, got[account], amount)
+		}
+	}
+}
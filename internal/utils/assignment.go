@@ -0,0 +1,106 @@
+package utils
+
+// AssignmentInfeasibleCost marks a pairing that must never be chosen. It is a
+// large finite value rather than +Inf so the solver's potentials stay finite.
+const AssignmentInfeasibleCost = 1e9
+
+// SolveAssignment returns, for each row of cost, the column assigned to it by a
+// minimum total cost matching (Hungarian algorithm), or -1 when the row is left
+// unassigned. The matrix may be rectangular but every row must have the same
+// number of columns. Rows matched to an infeasible cell are reported as -1.
+func SolveAssignment(cost [][]float64) []int {
+	rows := len(cost)
+	result := make([]int, rows)
+	for i := range result {
+		result[i] = -1
+	}
+	if rows == 0 || len(cost[0]) == 0 {
+		return result
+	}
+	cols := len(cost[0])
+
+	// The solver below needs rows <= cols, so solve the transposed problem instead
+	if rows > cols {
+		transposed := make([][]float64, cols)
+		for j := range transposed {
+			transposed[j] = make([]float64, rows)
+			for i := 0; i < rows; i++ {
+				transposed[j][i] = cost[i][j]
+			}
+		}
+
+		for j, i := range SolveAssignment(transposed) {
+			if i >= 0 {
+				result[i] = j
+			}
+		}
+		return result
+	}
+
+	// Potentials-based O(n^2 m) Hungarian algorithm with 1-based indices;
+	// column 0 is a virtual column used to grow augmenting paths.
+	u := make([]float64, rows+1)
+	v := make([]float64, cols+1)
+	match := make([]int, cols+1) // row matched to each column
+	way := make([]int, cols+1)
+
+	for i := 1; i <= rows; i++ {
+		match[0] = i
+		j0 := 0
+		minv := make([]float64, cols+1)
+		used := make([]bool, cols+1)
+		for j := range minv {
+			minv[j] = AssignmentInfeasibleCost * float64(rows+1)
+		}
+
+		for {
+			used[j0] = true
+			i0 := match[j0]
+			delta := AssignmentInfeasibleCost * float64(rows+1)
+			j1 := 0
+
+			for j := 1; j <= cols; j++ {
+				if used[j] {
+					continue
+				}
+				current := cost[i0-1][j-1] - u[i0] - v[j]
+				if current < minv[j] {
+					minv[j] = current
+					way[j] = j0
+				}
+				if minv[j] < delta {
+					delta = minv[j]
+					j1 = j
+				}
+			}
+
+			for j := 0; j <= cols; j++ {
+				if used[j] {
+					u[match[j]] += delta
+					v[j] -= delta
+				} else {
+					minv[j] -= delta
+				}
+			}
+
+			j0 = j1
+			if match[j0] == 0 {
+				break
+			}
+		}
+
+		for j0 != 0 {
+			j1 := way[j0]
+			match[j0] = match[j1]
+			j0 = j1
+		}
+	}
+
+	for j := 1; j <= cols; j++ {
+		if i := match[j]; i != 0 && cost[i-1][j-1] < AssignmentInfeasibleCost {
+			result[i-1] = j - 1
+		}
+	}
+
+	return result
+}
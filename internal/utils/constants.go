@@ -69,6 +69,9 @@ const (
 	MaxSurgeMultiplier  = 5.0
 	SurgeUpdateInterval = 5 * time.Minute
 
+	// Spatial Index
+	CellResolution = 8 // hexgrid cells with ~460 m edges
+
 	// Notification
 	NotificationRetryAttempts = 3
 	NotificationTimeout       = 30 * time.Second
@@ -135,9 +138,11 @@ const (
 	EventUserLogin          = "user_login"
 	EventRideRequested      = "ride_requested"
 	EventRideAccepted       = "ride_accepted"
+	EventRideDriverArrived  = "ride_driver_arrived"
 	EventRideStarted        = "ride_started"
 	EventRideCompleted      = "ride_completed"
 	EventRideCancelled      = "ride_cancelled"
+	EventRideNoShow         = "ride_no_show"
 	EventPaymentProcessed   = "payment_processed"
 	EventEmergencyTriggered = "emergency_triggered"
 )
@@ -5,6 +5,8 @@ import (
 	"math"
 	"strconv"
 	"strings"
+
+	"goride/pkg/money"
 )
 
 type Currency struct {
@@ -61,6 +63,8 @@ func ParseCurrencyAmount(amountStr string) (float64, error) {
 	return strconv.ParseFloat(cleaned, 64)
 }
 
+// Deprecated: ConvertCurrency uses fixed demonstration rates. Use
+// services.ExchangeRateService, which snapshots real rates onto payments.
 func ConvertCurrency(amount float64, fromCurrency, toCurrency string) float64 {
 	// Simplified conversion - in production, use real exchange rates from an API
 	// This is just for demonstration
@@ -111,20 +115,20 @@ func RoundCurrency(amount float64, currencyCode string) float64 {
 	}
 }
 
-func CalculateTip(amount float64, tipPercentage float64) float64 {
-	tip := amount * (tipPercentage / 100)
-	return math.Round(tip*100) / 100
+func CalculateTip(amount money.Money, tipPercentage float64) money.Money {
+	return amount.Percent(tipPercentage)
 }
 
-func CalculateTax(amount float64, taxRate float64) float64 {
-	tax := amount * (taxRate / 100)
-	return math.Round(tax*100) / 100
+func CalculateTax(amount money.Money, taxRate float64) money.Money {
+	return amount.Percent(taxRate)
 }
 
-func CalculateDiscount(amount float64, discountPercentage float64, maxDiscount float64) float64 {
-	discount := amount * (discountPercentage / 100)
-	if maxDiscount > 0 && discount > maxDiscount {
-		discount = maxDiscount
+// CalculateDiscount returns a percentage of the amount, capped at maxDiscount
+// when it is positive. The cap must be in the amount's currency.
+func CalculateDiscount(amount money.Money, discountPercentage float64, maxDiscount money.Money) (money.Money, error) {
+	discount := amount.Percent(discountPercentage)
+	if !maxDiscount.IsPositive() {
+		return discount, nil
 	}
-	return math.Round(discount*100) / 100
-}
\ No newline at end of file
+	return money.Min(discount, maxDiscount)
+}
@@ -139,6 +139,81 @@ func IsPointInCircle(point Point, center Point, radiusKM float64) bool {
 	return distance <= radiusKM
 }
 
+// PathIntersectsPolygon reports whether a path enters a polygon, either with
+// a point inside it or a segment crossing one of its edges.
+func PathIntersectsPolygon(path []Point, polygon Polygon) bool {
+	if len(polygon) < 3 {
+		return false
+	}
+
+	for i, point := range path {
+		if IsPointInPolygon(point, polygon) {
+			return true
+		}
+		if i == 0 {
+			continue
+		}
+		for j := range polygon {
+			if segmentsIntersect(path[i-1], point, polygon[j], polygon[(j+1)%len(polygon)]) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// PathIntersectsCircle reports whether any segment of a path comes within
+// radiusKM of the center.
+func PathIntersectsCircle(path []Point, center Point, radiusKM float64) bool {
+	for i, point := range path {
+		if IsPointInCircle(point, center, radiusKM) {
+			return true
+		}
+		if i > 0 && segmentDistanceKM(path[i-1], point, center) <= radiusKM {
+			return true
+		}
+	}
+	return false
+}
+
+// DecodePolyline reverses EncodePolyline and decodes polylines returned by
+// the maps providers.
+func DecodePolyline(encoded string) ([]Point, error) {
+	var points []Point
+	lat, lng := 0, 0
+
+	for index := 0; index < len(encoded); {
+		var deltas [2]int
+		for i := range deltas {
+			result, shift := 0, 0
+			for {
+				if index >= len(encoded) {
+					return nil, fmt.Errorf("invalid polyline")
+				}
+				b := int(encoded[index]) - 63
+				index++
+				result |= (b & 0x1f) << shift
+				shift += 5
+				if b < 0x20 {
+					break
+				}
+			}
+			if result&1 != 0 {
+				deltas[i] = ^(result >> 1)
+			} else {
+				deltas[i] = result >> 1
+			}
+		}
+
+		lat += deltas[0]
+		lng += deltas[1]
+		points = append(points, Point{Lat: float64(lat) / 1e5, Lng: float64(lng) / 1e5})
+	}
+
+	return points, nil
+}
+
 func EncodePolyline(points []Point) string {
 	// Simplified polyline encoding - in production, use a proper library
 	encoded := ""
@@ -178,3 +253,35 @@ func encodeNumber(num int) string {
 	encoded += string(rune(num + 63))
 	return encoded
 }
+
+// segmentsIntersect reports whether segments ab and cd cross, treating
+// coordinates as planar, which holds for the short segments of a route.
+func segmentsIntersect(a, b, c, d Point) bool {
+	orientation := func(p, q, r Point) float64 {
+		return (q.Lng-p.Lng)*(r.Lat-p.Lat) - (q.Lat-p.Lat)*(r.Lng-p.Lng)
+	}
+
+	d1, d2 := orientation(c, d, a), orientation(c, d, b)
+	d3, d4 := orientation(a, b, c), orientation(a, b, d)
+
+	return ((d1 > 0 && d2 < 0) || (d1 < 0 && d2 > 0)) &&
+		((d3 > 0 && d4 < 0) || (d3 < 0 && d4 > 0))
+}
+
+// segmentDistanceKM returns the distance from p to segment ab on a local
+// equirectangular projection around p.
+func segmentDistanceKM(a, b, p Point) float64 {
+	const kmPerDegree = 111.32
+	scale := math.Cos(p.Lat * math.Pi / 180)
+
+	ax, ay := (a.Lng-p.Lng)*kmPerDegree*scale, (a.Lat-p.Lat)*kmPerDegree
+	bx, by := (b.Lng-p.Lng)*kmPerDegree*scale, (b.Lat-p.Lat)*kmPerDegree
+
+	dx, dy := bx-ax, by-ay
+	t := 0.0
+	if length := dx*dx + dy*dy; length > 0 {
+		t = math.Max(0, math.Min(1, -(ax*dx+ay*dy)/length))
+	}
+
+	return math.Hypot(ax+t*dx, ay+t*dy)
+}
@@ -0,0 +1,212 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Ledger account types, as stored by internal/models
+const (
+	ledgerRiderWallet     = "rider_wallet"
+	ledgerDriverWallet    = "driver_wallet"
+	ledgerPaymentClearing = "payment_clearing"
+	ledgerOpeningBalance  = "opening_balance"
+)
+
+func createLedgerIndexes(db *mongo.Database) error {
+	ctx := context.Background()
+
+	wallets := []mongo.IndexModel{
+		{
+			Keys:    bson.D{{"account_type", 1}, {"user_id", 1}, {"currency", 1}},
+			Options: options.Index().SetUnique(true),
+		},
+	}
+	if _, err := db.Collection("wallets").Indexes().CreateMany(ctx, wallets); err != nil {
+		return err
+	}
+
+	transactions := []mongo.IndexModel{
+		{
+			Keys: bson.D{{"wallet_id", 1}, {"created_at", -1}},
+		},
+		{
+			Keys: bson.D{{"entry_id", 1}},
+		},
+	}
+	if _, err := db.Collection("transactions").Indexes().CreateMany(ctx, transactions); err != nil {
+		return err
+	}
+
+	entries := []mongo.IndexModel{
+		{
+			Keys:    bson.D{{"reference", 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys: bson.D{{"created_at", -1}},
+		},
+	}
+	_, err := db.Collection("ledger_entries").Indexes().CreateMany(ctx, entries)
+	return err
+}
+
+// openLedger turns the wallets kept before the ledger into ledger accounts.
+// Each wallet becomes a rider or driver wallet after its user, and a non-zero
+// balance is posted as an opening entry against payment clearing, where the
+// money was topped up from, so the ledger sums to zero from the start.
+func openLedger(db *mongo.Database) error {
+	ctx := context.Background()
+	wallets := db.Collection("wallets")
+
+	cursor, err := wallets.Find(ctx, bson.M{"account_type": bson.M{"$exists": false}})
+	if err != nil {
+		return fmt.Errorf("failed to read wallets: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var wallet struct {
+			ID      primitive.ObjectID `bson:"_id"`
+			UserID  primitive.ObjectID `bson:"user_id"`
+			Balance struct {
+				Amount   int64  `bson:"amount"`
+				Currency string `bson:"currency"`
+			} `bson:"balance"`
+		}
+		if err := cursor.Decode(&wallet); err != nil {
+			return fmt.Errorf("failed to decode wallet: %w", err)
+		}
+
+		accountType := ledgerRiderWallet
+		var user struct {
+			UserType string `bson:"user_type"`
+		}
+		err := db.Collection("users").FindOne(ctx, bson.M{"_id": wallet.UserID}).Decode(&user)
+		if err == nil && user.UserType == "driver" {
+			accountType = ledgerDriverWallet
+		}
+
+		if _, err := wallets.UpdateOne(ctx, bson.M{"_id": wallet.ID}, bson.M{"$set": bson.M{
+			"account_type": accountType,
+			"version":      0,
+		}}); err != nil {
+			return fmt.Errorf("failed to tag wallet %s: %w", wallet.ID.Hex(), err)
+		}
+
+		if wallet.Balance.Amount != 0 {
+			if err := postOpeningBalance(ctx, db, wallet.ID, wallet.UserID, accountType, wallet.Balance.Amount, wallet.Balance.Currency); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func postOpeningBalance(ctx context.Context, db *mongo.Database, walletID, userID primitive.ObjectID, accountType string, amount int64, currency string) error {
+	now := time.Now()
+
+	var clearing struct {
+		ID      primitive.ObjectID `bson:"_id"`
+		Balance struct {
+			Amount int64 `bson:"amount"`
+		} `bson:"balance"`
+	}
+	err := db.Collection("wallets").FindOneAndUpdate(
+		ctx,
+		bson.M{"account_type": ledgerPaymentClearing, "user_id": primitive.NilObjectID, "currency": currency},
+		bson.M{
+			"$inc": bson.M{"balance.amount": -amount, "version": 1},
+			"$set": bson.M{"balance.currency": currency, "updated_at": now},
+			"$setOnInsert": bson.M{
+				"is_active":  true,
+				"created_at": now,
+			},
+		},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	).Decode(&clearing)
+	if err != nil {
+		return fmt.Errorf("failed to post opening balance to payment clearing: %w", err)
+	}
+
+	entryID := primitive.NewObjectID()
+	reference := ledgerOpeningBalance + ":" + walletID.Hex()
+	money := func(value int64) bson.M {
+		return bson.M{"amount": value, "currency": currency}
+	}
+	posting := func(walletID, userID primitive.ObjectID, accountType string, amount, before int64) bson.M {
+		transactionType, absolute := "credit", amount
+		if amount < 0 {
+			transactionType, absolute = "debit", -amount
+		}
+		return bson.M{
+			"_id":            primitive.NewObjectID(),
+			"user_id":        userID,
+			"wallet_id":      walletID,
+			"account_type":   accountType,
+			"entry_id":       entryID,
+			"type":           transactionType,
+			"status":         "completed",
+			"amount":         money(absolute),
+			"currency":       currency,
+			"description":    "Opening balance",
+			"reference":      reference,
+			"balance_before": money(before),
+			"balance_after":  money(before + amount),
+			"processed_at":   now,
+			"created_at":     now,
+			"updated_at":     now,
+		}
+	}
+
+	// The clearing balance read back already includes this posting
+	walletPosting := posting(walletID, userID, accountType, amount, 0)
+	clearingPosting := posting(clearing.ID, primitive.NilObjectID, ledgerPaymentClearing, -amount, clearing.Balance.Amount+amount)
+
+	if _, err := db.Collection("transactions").InsertMany(ctx, []interface{}{walletPosting, clearingPosting}); err != nil {
+		return fmt.Errorf("failed to record opening balance of wallet %s: %w", walletID.Hex(), err)
+	}
+
+	_, err = db.Collection("ledger_entries").InsertOne(ctx, bson.M{
+		"_id":             entryID,
+		"type":            ledgerOpeningBalance,
+		"currency":        currency,
+		"description":     "Opening balance",
+		"reference":       reference,
+		"transaction_ids": bson.A{walletPosting["_id"], clearingPosting["_id"]},
+		"created_at":      now,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to record opening balance of wallet %s: %w", walletID.Hex(), err)
+	}
+
+	return nil
+}
+
+// closeLedger undoes openLedger, dropping the ledger's own records and leaving
+// the wallet balances as they are.
+func closeLedger(db *mongo.Database) error {
+	ctx := context.Background()
+
+	if err := db.Collection("ledger_entries").Drop(ctx); err != nil {
+		return err
+	}
+	if _, err := db.Collection("transactions").DeleteMany(ctx, bson.M{"entry_id": bson.M{"$ne": nil}}); err != nil {
+		return err
+	}
+	if _, err := db.Collection("wallets").DeleteMany(ctx, bson.M{"user_id": primitive.NilObjectID}); err != nil {
+		return err
+	}
+	_, err := db.Collection("wallets").UpdateMany(ctx, bson.M{}, bson.M{"$unset": bson.M{
+		"account_type": "",
+		"version":      "",
+	}})
+	return err
+}
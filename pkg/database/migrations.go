@@ -211,6 +211,73 @@ func getMigrations() []Migration {
 				return db.Collection("payments").Drop(context.Background())
 			},
 		},
+		{
+			Version:     7,
+			Description: "Store monetary amounts as integer minor units with their currency",
+			Up: func(db *mongo.Database) error {
+				return migrateMoney(db, true)
+			},
+			Down: func(db *mongo.Database) error {
+				return migrateMoney(db, false)
+			},
+		},
+		{
+			Version:     8,
+			Description: "Open the double-entry ledger over existing wallets",
+			Up: func(db *mongo.Database) error {
+				if err := createLedgerIndexes(db); err != nil {
+					return err
+				}
+				return openLedger(db)
+			},
+			Down: func(db *mongo.Database) error {
+				return closeLedger(db)
+			},
+		},
+		{
+			Version:     9,
+			Description: "Create payouts and payout batches collections with indexes",
+			Up: func(db *mongo.Database) error {
+				return createPayoutsIndexes(db)
+			},
+			Down: func(db *mongo.Database) error {
+				if err := db.Collection("payout_batches").Drop(context.Background()); err != nil {
+					return err
+				}
+				return db.Collection("payouts").Drop(context.Background())
+			},
+		},
+		{
+			Version:     10,
+			Description: "Index payment holds by authorization time",
+			Up: func(db *mongo.Database) error {
+				return createPaymentHoldsIndex(db)
+			},
+			Down: func(db *mongo.Database) error {
+				_, err := db.Collection("payments").Indexes().DropOne(context.Background(), paymentHoldsIndex)
+				return err
+			},
+		},
+		{
+			Version:     11,
+			Description: "Index payment idempotency keys and allow payments without a transaction ID",
+			Up: func(db *mongo.Database) error {
+				return createPaymentIdempotencyIndexes(db)
+			},
+			Down: func(db *mongo.Database) error {
+				return dropPaymentIdempotencyIndexes(db)
+			},
+		},
+		{
+			Version:     12,
+			Description: "Create payment webhook events collection with indexes",
+			Up: func(db *mongo.Database) error {
+				return createPaymentWebhookEventsIndexes(db)
+			},
+			Down: func(db *mongo.Database) error {
+				return db.Collection("payment_webhook_events").Drop(context.Background())
+			},
+		},
 	}
 }
 
@@ -389,3 +456,117 @@ func createPaymentsIndexes(db *mongo.Database) error {
 	_, err := collection.Indexes().CreateMany(ctx, indexes)
 	return err
 }
+
+const paymentHoldsIndex = "status_1_authorized_at_1"
+
+// createPaymentHoldsIndex lets the hold sweep find card holds that are still
+// open, oldest first.
+func createPaymentHoldsIndex(db *mongo.Database) error {
+	_, err := db.Collection("payments").Indexes().CreateOne(context.Background(), mongo.IndexModel{
+		Keys:    bson.D{{"status", 1}, {"authorized_at", 1}},
+		Options: options.Index().SetName(paymentHoldsIndex),
+	})
+	return err
+}
+
+// createPaymentIdempotencyIndexes makes idempotency keys unique. Payments are
+// now stored before the provider has given them a transaction ID, so the
+// transaction ID is only unique once set; the sparse index treated every empty
+// ID as the same value.
+func createPaymentIdempotencyIndexes(db *mongo.Database) error {
+	ctx := context.Background()
+	collection := db.Collection("payments")
+
+	if _, err := collection.Indexes().DropOne(ctx, "transaction_id_1"); err != nil {
+		return err
+	}
+
+	indexes := []mongo.IndexModel{
+		{
+			Keys: bson.D{{"transaction_id", 1}},
+			Options: options.Index().
+				SetUnique(true).
+				SetPartialFilterExpression(bson.M{"transaction_id": bson.M{"$gt": ""}}),
+		},
+		{
+			Keys: bson.D{{"idempotency_key", 1}},
+			Options: options.Index().
+				SetUnique(true).
+				SetPartialFilterExpression(bson.M{"idempotency_key": bson.M{"$exists": true}}),
+		},
+		{
+			Keys: bson.D{{"status", 1}, {"created_at", 1}},
+		},
+	}
+
+	_, err := collection.Indexes().CreateMany(ctx, indexes)
+	return err
+}
+
+func dropPaymentIdempotencyIndexes(db *mongo.Database) error {
+	ctx := context.Background()
+	collection := db.Collection("payments")
+
+	for _, name := range []string{"transaction_id_1", "idempotency_key_1", "status_1_created_at_1"} {
+		if _, err := collection.Indexes().DropOne(ctx, name); err != nil {
+			return err
+		}
+	}
+
+	_, err := collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{"transaction_id", 1}},
+		Options: options.Index().SetUnique(true).SetSparse(true),
+	})
+	return err
+}
+
+func createPayoutsIndexes(db *mongo.Database) error {
+	ctx := context.Background()
+
+	payouts := []mongo.IndexModel{
+		{
+			Keys:    bson.D{{"reference", 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys: bson.D{{"driver_id", 1}, {"type", 1}, {"created_at", -1}},
+		},
+		{
+			Keys: bson.D{{"batch_id", 1}},
+		},
+		{
+			Keys: bson.D{{"status", 1}, {"updated_at", 1}},
+		},
+	}
+	if _, err := db.Collection("payouts").Indexes().CreateMany(ctx, payouts); err != nil {
+		return err
+	}
+
+	batches := []mongo.IndexModel{
+		{
+			Keys: bson.D{{"period_end", -1}},
+		},
+	}
+	_, err := db.Collection("payout_batches").Indexes().CreateMany(ctx, batches)
+	return err
+}
+
+func createPaymentWebhookEventsIndexes(db *mongo.Database) error {
+	ctx := context.Background()
+
+	indexes := []mongo.IndexModel{
+		{
+			Keys:    bson.D{{"provider", 1}, {"event_id", 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys: bson.D{{"status", 1}, {"next_attempt_at", 1}},
+		},
+		{
+			Keys: bson.D{{"status", 1}, {"created_at", -1}},
+		},
+	}
+
+	_, err := db.Collection("payment_webhook_events").Indexes().CreateMany(ctx, indexes)
+	return err
+}
@@ -0,0 +1,404 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"goride/pkg/money"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Amounts used to be stored as doubles in major units. The money migration
+// rewrites them as {amount: <int64 minor units>, currency}, the form written by
+// money.Money. Every collection is checked before anything is written, and a
+// double that is not a whole number of minor units fails the migration instead
+// of being rounded, so no stored value changes.
+
+// migrationDefaultCurrency is used for documents that have no currency of their
+// own and whose city has no fare structure.
+const migrationDefaultCurrency = "USD"
+
+// floatNoise is how far a stored double may sit from a whole number of minor
+// units and still be treated as that amount. It covers float arithmetic error
+// such as 0.30000000000000004, not sub-cent amounts.
+const floatNoise = 1e-6
+
+// moneyField is a monetary field to convert. Paths are dotted; a "[]" segment
+// steps into every element of an array.
+type moneyField struct {
+	Path           string
+	CurrencyFields []string // document fields holding the currency, first set wins
+}
+
+type moneyCollection struct {
+	Name           string
+	CurrencyFields []string // default currency fields for the collection's amounts
+	CityField      string   // city, or list of cities, whose fare structure currency applies when none is stored
+	Fields         []moneyField
+	Prepare        func(document bson.D) bson.D // runs before conversion to money
+	Revert         bson.M                       // extra $unset applied when converting back
+}
+
+func moneyCollections() []moneyCollection {
+	breakdown := func(prefix string, currencyFields ...string) []moneyField {
+		lines := []string{
+			"base_fare", "distance_fare", "time_fare", "booking_fee", "surge_amount", "fare_adjustment",
+			"fixed_fare", "waiting_charge", "toll_amount", "surcharge_amount", "subtotal",
+			"discount_amount", "tax_amount", "total", "platform_fee", "driver_earnings", "surcharges.[].amount",
+		}
+		fields := make([]moneyField, 0, len(lines))
+		for _, line := range lines {
+			fields = append(fields, moneyField{Path: prefix + line, CurrencyFields: currencyFields})
+		}
+		return fields
+	}
+
+	rideFields := []moneyField{
+		{Path: "fare_quote.fare", CurrencyFields: []string{"fare_quote.currency", "currency"}},
+		{Path: "fare_reconciliation.quoted_fare"},
+		{Path: "fare_reconciliation.metered_fare"},
+		{Path: "fare_reconciliation.waiting_charge"},
+		{Path: "fare_reconciliation.charged_fare"},
+	}
+	rideFields = append(rideFields, breakdown("fare_quote.breakdown.", "fare_quote.breakdown.currency", "fare_quote.currency", "currency")...)
+	rideFields = append(rideFields, breakdown("fare_breakdown.", "fare_breakdown.currency", "currency")...)
+
+	return []moneyCollection{
+		{
+			Name:           "payments",
+			CurrencyFields: []string{"currency"},
+			Fields: []moneyField{
+				{Path: "amount"}, {Path: "base_fare"}, {Path: "distance_fare"}, {Path: "time_fare"},
+				{Path: "surge_amount"}, {Path: "surcharge_amount"}, {Path: "surcharges.[].amount"},
+				{Path: "tip_amount"}, {Path: "tax_amount"}, {Path: "discount_amount"},
+				{Path: "platform_fee"}, {Path: "driver_earnings"}, {Path: "refund_amount"},
+				{Path: "reporting_amount", CurrencyFields: []string{"reporting_currency"}},
+				{Path: "refund_reporting_amount", CurrencyFields: []string{"reporting_currency"}},
+			},
+		},
+		{
+			Name:           "wallets",
+			CurrencyFields: []string{"currency"},
+			Fields:         []moneyField{{Path: "balance"}},
+		},
+		{
+			Name:           "transactions",
+			CurrencyFields: []string{"currency"},
+			Fields: []moneyField{
+				{Path: "amount"}, {Path: "balance_before"}, {Path: "balance_after"},
+				{Path: "reporting_amount", CurrencyFields: []string{"reporting_currency"}},
+			},
+		},
+		{
+			Name:           "fare_structures",
+			CurrencyFields: []string{"currency"},
+			Fields: []moneyField{
+				{Path: "base_fare"}, {Path: "minimum_fare"}, {Path: "maximum_fare"},
+				{Path: "booking_fee"}, {Path: "cancellation_fee"},
+			},
+		},
+		{
+			Name:      "surcharge_rules",
+			CityField: "city",
+			Fields:    []moneyField{{Path: "amount"}},
+		},
+		{
+			Name:      "cancellation_policies",
+			CityField: "city",
+			Fields:    []moneyField{{Path: "rider_fee"}, {Path: "driver_penalty"}},
+		},
+		{
+			Name:      "promotions",
+			CityField: "target_cities",
+			Fields: []moneyField{
+				{Path: "discount_amount"}, {Path: "max_discount"}, {Path: "min_ride_amount"},
+			},
+			// Fixed promotions kept their amount in discount_value, which is
+			// now a percentage only
+			Prepare: func(document bson.D) bson.D {
+				if promotionType, _ := lookupPath(document, "type").(string); promotionType != "fixed" {
+					return document
+				}
+				if lookupPath(document, "discount_amount") != nil {
+					return document
+				}
+				return append(document, bson.E{Key: "discount_amount", Value: lookupPath(document, "discount_value")})
+			},
+			Revert: bson.M{"discount_amount": ""},
+		},
+		{
+			Name:           "rides",
+			CurrencyFields: []string{"currency"},
+			Fields:         rideFields,
+		},
+	}
+}
+
+// migrateMoney converts monetary fields to money documents, or back to
+// doubles when toMoney is false.
+func migrateMoney(db *mongo.Database, toMoney bool) error {
+	ctx := context.Background()
+
+	cityCurrencies, err := fareStructureCurrencies(ctx, db)
+	if err != nil {
+		return err
+	}
+
+	collections := moneyCollections()
+
+	// Check everything first so a bad amount leaves the database untouched
+	for _, collection := range collections {
+		if err := convertMoneyCollection(ctx, db, collection, cityCurrencies, toMoney, false); err != nil {
+			return err
+		}
+	}
+	for _, collection := range collections {
+		if err := convertMoneyCollection(ctx, db, collection, cityCurrencies, toMoney, true); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func convertMoneyCollection(ctx context.Context, db *mongo.Database, spec moneyCollection, cityCurrencies map[string]string, toMoney, write bool) error {
+	collection := db.Collection(spec.Name)
+
+	cursor, err := collection.Find(ctx, bson.M{})
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", spec.Name, err)
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var document bson.D
+		if err := cursor.Decode(&document); err != nil {
+			return fmt.Errorf("failed to decode %s document: %w", spec.Name, err)
+		}
+
+		if toMoney && spec.Prepare != nil {
+			document = spec.Prepare(document)
+		}
+
+		changed := make(map[string]bool)
+		for _, field := range spec.Fields {
+			currencyFields := field.CurrencyFields
+			if len(currencyFields) == 0 {
+				currencyFields = spec.CurrencyFields
+			}
+			currency := documentCurrency(document, currencyFields, spec.CityField, cityCurrencies)
+
+			segments := strings.Split(field.Path, ".")
+			converted, err := convertMoneyPath(document, segments, currency, toMoney)
+			if err != nil {
+				return fmt.Errorf("%s %v: %s: %w", spec.Name, lookupPath(document, "_id"), field.Path, err)
+			}
+			if converted {
+				changed[segments[0]] = true
+			}
+		}
+
+		if !write || (len(changed) == 0 && (toMoney || spec.Revert == nil)) {
+			continue
+		}
+
+		set := bson.M{}
+		for key := range changed {
+			// A field that is unset on the way back must not also be set
+			if _, unset := spec.Revert[key]; !toMoney && unset {
+				continue
+			}
+			set[key] = lookupPath(document, key)
+		}
+		update := bson.M{}
+		if len(set) > 0 {
+			update["$set"] = set
+		}
+		if !toMoney && spec.Revert != nil {
+			update["$unset"] = spec.Revert
+		}
+
+		if _, err := collection.UpdateOne(ctx, bson.M{"_id": lookupPath(document, "_id")}, update); err != nil {
+			return fmt.Errorf("failed to update %s document: %w", spec.Name, err)
+		}
+	}
+
+	return cursor.Err()
+}
+
+// fareStructureCurrencies maps each city to the currency of its fare
+// structures, for collections that store amounts without a currency. Cities
+// priced in more than one currency are left out.
+func fareStructureCurrencies(ctx context.Context, db *mongo.Database) (map[string]string, error) {
+	cursor, err := db.Collection("fare_structures").Find(ctx, bson.M{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read fare structures: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	currencies := make(map[string]string)
+	ambiguous := make(map[string]bool)
+	for cursor.Next(ctx) {
+		var fareStructure struct {
+			City     string `bson:"city"`
+			Currency string `bson:"currency"`
+		}
+		if err := cursor.Decode(&fareStructure); err != nil {
+			return nil, fmt.Errorf("failed to decode fare structure: %w", err)
+		}
+		if fareStructure.City == "" || fareStructure.Currency == "" {
+			continue
+		}
+
+		currency := strings.ToUpper(fareStructure.Currency)
+		if existing, exists := currencies[fareStructure.City]; exists && existing != currency {
+			ambiguous[fareStructure.City] = true
+		}
+		currencies[fareStructure.City] = currency
+	}
+
+	for city := range ambiguous {
+		delete(currencies, city)
+	}
+	return currencies, cursor.Err()
+}
+
+func documentCurrency(document bson.D, currencyFields []string, cityField string, cityCurrencies map[string]string) string {
+	for _, field := range currencyFields {
+		if currency, ok := lookupPath(document, field).(string); ok && currency != "" {
+			return strings.ToUpper(currency)
+		}
+	}
+
+	if cityField != "" {
+		var cities []interface{}
+		switch value := lookupPath(document, cityField).(type) {
+		case string:
+			cities = []interface{}{value}
+		case primitive.A:
+			cities = value
+		}
+		for _, city := range cities {
+			if name, ok := city.(string); ok {
+				if currency, exists := cityCurrencies[name]; exists {
+					return currency
+				}
+			}
+		}
+	}
+
+	return migrationDefaultCurrency
+}
+
+// convertMoneyPath converts the value at the path in place and reports whether
+// anything changed.
+func convertMoneyPath(document bson.D, segments []string, currency string, toMoney bool) (bool, error) {
+	for i := range document {
+		if document[i].Key != segments[0] {
+			continue
+		}
+
+		if len(segments) == 1 {
+			value, changed, err := convertMoneyValue(document[i].Value, currency, toMoney)
+			if err != nil || !changed {
+				return false, err
+			}
+			document[i].Value = value
+			return true, nil
+		}
+
+		return convertMoneyNested(document[i].Value, segments[1:], currency, toMoney)
+	}
+	return false, nil
+}
+
+func convertMoneyNested(value interface{}, segments []string, currency string, toMoney bool) (bool, error) {
+	switch nested := value.(type) {
+	case bson.D:
+		return convertMoneyPath(nested, segments, currency, toMoney)
+	case primitive.A:
+		if segments[0] != "[]" || len(segments) == 1 {
+			return false, nil
+		}
+		changed := false
+		for _, element := range nested {
+			document, ok := element.(bson.D)
+			if !ok {
+				continue
+			}
+			elementChanged, err := convertMoneyPath(document, segments[1:], currency, toMoney)
+			if err != nil {
+				return false, err
+			}
+			changed = changed || elementChanged
+		}
+		return changed, nil
+	}
+	return false, nil
+}
+
+func convertMoneyValue(value interface{}, currency string, toMoney bool) (interface{}, bool, error) {
+	if !toMoney {
+		document, ok := value.(bson.D)
+		if !ok {
+			return value, false, nil
+		}
+		amount, ok := lookupPath(document, "amount").(int64)
+		if !ok {
+			return value, false, nil
+		}
+		storedCurrency, _ := lookupPath(document, "currency").(string)
+		if storedCurrency == "" {
+			storedCurrency = currency
+		}
+		return money.New(amount, storedCurrency).Float64(), true, nil
+	}
+
+	var major float64
+	switch number := value.(type) {
+	case float64:
+		major = number
+	case int32:
+		major = float64(number)
+	case int64:
+		major = float64(number)
+	case primitive.Decimal128:
+		amount, err := money.Parse(number.String(), currency)
+		if err != nil {
+			return nil, false, err
+		}
+		return bson.D{{Key: "amount", Value: amount.Amount}, {Key: "currency", Value: amount.Currency}}, true, nil
+	default:
+		// Already converted, or not set
+		return value, false, nil
+	}
+
+	amount := money.FromMajor(major, currency)
+	if math.Abs(amount.Float64()-major) > floatNoise {
+		return nil, false, fmt.Errorf("%s is not a whole number of %s minor units", strconv.FormatFloat(major, 'f', -1, 64), amount.Currency)
+	}
+	return bson.D{{Key: "amount", Value: amount.Amount}, {Key: "currency", Value: amount.Currency}}, true, nil
+}
+
+func lookupPath(document bson.D, path string) interface{} {
+	key, rest, nested := strings.Cut(path, ".")
+	for _, element := range document {
+		if element.Key != key {
+			continue
+		}
+		if !nested {
+			return element.Value
+		}
+		if child, ok := element.Value.(bson.D); ok {
+			return lookupPath(child, rest)
+		}
+		return nil
+	}
+	return nil
+}
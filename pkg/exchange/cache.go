@@ -0,0 +1,60 @@
+package exchange
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CachedProvider keeps rates from another provider in memory for a TTL.
+type CachedProvider struct {
+	provider ExchangeRateProvider
+	ttl      time.Duration
+	mu       sync.RWMutex
+	entries  map[string]cachedRate
+}
+
+type cachedRate struct {
+	rate      *Rate
+	expiresAt time.Time
+}
+
+func NewCachedProvider(provider ExchangeRateProvider, ttl time.Duration) *CachedProvider {
+	return &CachedProvider{
+		provider: provider,
+		ttl:      ttl,
+		entries:  make(map[string]cachedRate),
+	}
+}
+
+func (c *CachedProvider) GetRate(ctx context.Context, from, to string) (*Rate, error) {
+	key := strings.ToUpper(from) + ":" + strings.ToUpper(to)
+
+	c.mu.RLock()
+	entry, exists := c.entries[key]
+	c.mu.RUnlock()
+	if exists && time.Now().Before(entry.expiresAt) {
+		rate := *entry.rate
+		return &rate, nil
+	}
+
+	rate, err := c.provider.GetRate(ctx, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	c.entries[key] = cachedRate{rate: rate, expiresAt: time.Now().Add(c.ttl)}
+	c.mu.Unlock()
+
+	copied := *rate
+	return &copied, nil
+}
+
+// Invalidate drops every cached rate, for use after new rates are saved.
+func (c *CachedProvider) Invalidate() {
+	c.mu.Lock()
+	c.entries = make(map[string]cachedRate)
+	c.mu.Unlock()
+}
@@ -0,0 +1,84 @@
+package exchange
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FileProvider reads a RateTable from a JSON file and reloads it whenever the
+// file changes, so rates can be updated by replacing the file.
+type FileProvider struct {
+	path    string
+	mu      sync.RWMutex
+	table   *RateTable
+	modTime time.Time
+}
+
+func NewFileProvider(path string) (*FileProvider, error) {
+	provider := &FileProvider{path: path}
+	if err := provider.reload(); err != nil {
+		return nil, err
+	}
+	return provider, nil
+}
+
+func (f *FileProvider) GetRate(ctx context.Context, from, to string) (*Rate, error) {
+	if err := f.reload(); err != nil {
+		return nil, err
+	}
+
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.table.Rate(from, to)
+}
+
+func (f *FileProvider) reload() error {
+	info, err := os.Stat(f.path)
+	if err != nil {
+		return fmt.Errorf("failed to read exchange rates: %w", err)
+	}
+
+	f.mu.RLock()
+	current := f.table != nil && info.ModTime().Equal(f.modTime)
+	f.mu.RUnlock()
+	if current {
+		return nil
+	}
+
+	data, err := os.ReadFile(f.path)
+	if err != nil {
+		return fmt.Errorf("failed to read exchange rates: %w", err)
+	}
+
+	var table RateTable
+	if err := json.Unmarshal(data, &table); err != nil {
+		return fmt.Errorf("failed to parse exchange rates: %w", err)
+	}
+	if table.Base == "" {
+		return fmt.Errorf("exchange rate file has no base currency")
+	}
+
+	rates := make(map[string]float64, len(table.Rates))
+	for currency, rate := range table.Rates {
+		rates[strings.ToUpper(currency)] = rate
+	}
+	table.Rates = rates
+	if table.Source == "" {
+		table.Source = "file"
+	}
+	if table.AsOf.IsZero() {
+		table.AsOf = info.ModTime()
+	}
+
+	f.mu.Lock()
+	f.table = &table
+	f.modTime = info.ModTime()
+	f.mu.Unlock()
+
+	return nil
+}
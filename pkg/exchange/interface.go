@@ -0,0 +1,96 @@
+package exchange
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type ExchangeRateProvider interface {
+	GetRate(ctx context.Context, from, to string) (*Rate, error)
+}
+
+// Rate converts an amount in From into To.
+type Rate struct {
+	From   string    `json:"from"`
+	To     string    `json:"to"`
+	Rate   float64   `json:"rate"` // units of To per unit of From
+	Source string    `json:"source"`
+	AsOf   time.Time `json:"as_of"`
+}
+
+func (r *Rate) Convert(amount float64) float64 {
+	return amount * r.Rate
+}
+
+// RateTable is a set of rates quoted against one base currency, the form in
+// which rate feeds usually publish them.
+type RateTable struct {
+	Base   string             `json:"base" bson:"base"`
+	Rates  map[string]float64 `json:"rates" bson:"rates"` // units of each currency per unit of Base
+	Source string             `json:"source" bson:"source"`
+	AsOf   time.Time          `json:"as_of" bson:"as_of"`
+}
+
+// Rate derives the rate between two currencies, crossing through the base
+// currency when neither side is the base.
+func (t *RateTable) Rate(from, to string) (*Rate, error) {
+	from, to = strings.ToUpper(from), strings.ToUpper(to)
+
+	rate := &Rate{From: from, To: to, Rate: 1, Source: t.Source, AsOf: t.AsOf}
+	if from == to {
+		return rate, nil
+	}
+
+	fromRate, err := t.baseRate(from)
+	if err != nil {
+		return nil, err
+	}
+	toRate, err := t.baseRate(to)
+	if err != nil {
+		return nil, err
+	}
+
+	rate.Rate = toRate / fromRate
+	return rate, nil
+}
+
+func (t *RateTable) baseRate(currency string) (float64, error) {
+	if currency == strings.ToUpper(t.Base) {
+		return 1, nil
+	}
+	rate, exists := t.Rates[currency]
+	if !exists || rate <= 0 {
+		return 0, fmt.Errorf("no exchange rate for %s", currency)
+	}
+	return rate, nil
+}
+
+// NewProvider builds the configured provider, file or mongodb, behind an
+// in-memory cache.
+func NewProvider(source, ratesFile string, db *mongo.Database, cacheTTL time.Duration) (ExchangeRateProvider, error) {
+	var provider ExchangeRateProvider
+	switch source {
+	case "file":
+		fileProvider, err := NewFileProvider(ratesFile)
+		if err != nil {
+			return nil, err
+		}
+		provider = fileProvider
+	case "mongodb":
+		if db == nil {
+			return nil, fmt.Errorf("mongodb exchange rates require a database")
+		}
+		provider = NewMongoProvider(db)
+	default:
+		return nil, fmt.Errorf("unsupported exchange rate source: %s", source)
+	}
+
+	if cacheTTL <= 0 {
+		return provider, nil
+	}
+	return NewCachedProvider(provider, cacheTTL), nil
+}
@@ -0,0 +1,69 @@
+package exchange
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MongoProvider serves rates from the most recent RateTable saved to the
+// exchange_rates collection. Earlier tables are kept as history.
+type MongoProvider struct {
+	collection *mongo.Collection
+}
+
+func NewMongoProvider(db *mongo.Database) *MongoProvider {
+	return &MongoProvider{
+		collection: db.Collection("exchange_rates"),
+	}
+}
+
+func (m *MongoProvider) GetRate(ctx context.Context, from, to string) (*Rate, error) {
+	opts := options.FindOne().SetSort(bson.D{{Key: "as_of", Value: -1}})
+
+	var table RateTable
+	if err := m.collection.FindOne(ctx, bson.M{}, opts).Decode(&table); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, fmt.Errorf("no exchange rates available")
+		}
+		return nil, fmt.Errorf("failed to get exchange rates: %w", err)
+	}
+
+	return table.Rate(from, to)
+}
+
+// SaveRates stores a new rate table, typically from a scheduled feed import.
+func (m *MongoProvider) SaveRates(ctx context.Context, table *RateTable) error {
+	if table.Base == "" || len(table.Rates) == 0 {
+		return fmt.Errorf("rate table requires a base currency and rates")
+	}
+
+	rates := make(map[string]float64, len(table.Rates))
+	for currency, rate := range table.Rates {
+		if rate <= 0 {
+			return fmt.Errorf("invalid exchange rate for %s", currency)
+		}
+		rates[strings.ToUpper(currency)] = rate
+	}
+
+	document := &RateTable{
+		Base:   strings.ToUpper(table.Base),
+		Rates:  rates,
+		Source: table.Source,
+		AsOf:   table.AsOf,
+	}
+	if document.AsOf.IsZero() {
+		document.AsOf = time.Now()
+	}
+
+	if _, err := m.collection.InsertOne(ctx, document); err != nil {
+		return fmt.Errorf("failed to save exchange rates: %w", err)
+	}
+
+	return nil
+}
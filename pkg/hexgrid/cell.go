@@ -0,0 +1,212 @@
+// Package hexgrid is a hierarchical hexagonal grid index, similar in spirit to
+// H3, written in pure Go.
+//
+// Cells are laid out on the Web Mercator plane, so they are regular hexagons
+// on web maps and their ground size shrinks with cos(latitude). Each finer
+// resolution is the previous lattice rotated and scaled by 1/sqrt(7), so a
+// cell has exactly seven children: the child at its center and that child's
+// six neighbours. As with H3 the children only approximately cover their
+// parent, so a point's cell at a coarse resolution can differ from the parent
+// of its cell at a finer one near cell edges. The grid does not wrap at the
+// antimeridian.
+package hexgrid
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+)
+
+// Cell identifies a hexagon at a given resolution.
+type Cell uint64
+
+// LatLng is a point in degrees.
+type LatLng struct {
+	Lat float64 `json:"lat"`
+	Lng float64 `json:"lng"`
+}
+
+const (
+	MaxResolution = 15
+
+	// InvalidCell is never returned for a valid point
+	InvalidCell Cell = 0
+)
+
+const (
+	earthRadius  = 6378137.0         // meters, Web Mercator sphere
+	maxLatitude  = 85.05112877980659 // Web Mercator limit
+	baseEdge     = 1107712.591       // meters at resolution 0, close to H3's average
+	coordBits    = 30
+	coordOffset  = 1 << (coordBits - 1)
+	coordMask    = 1<<coordBits - 1
+	resolutionAt = 2 * coordBits
+)
+
+type vector struct {
+	x, y float64
+}
+
+// lattice holds the basis of one resolution. Neighbouring centers are e1, e2
+// and e2-e1 apart, 60 degrees between each.
+type lattice struct {
+	e1, e2 vector
+	det    float64
+}
+
+var lattices = buildLattices()
+
+func buildLattices() [MaxResolution + 1]lattice {
+	var result [MaxResolution + 1]lattice
+
+	spacing := math.Sqrt(3) * baseEdge
+	e1 := vector{spacing, 0}
+	e2 := vector{spacing / 2, spacing * math.Sqrt(3) / 2}
+
+	for resolution := 0; resolution <= MaxResolution; resolution++ {
+		result[resolution] = lattice{e1: e1, e2: e2, det: e1.x*e2.y - e1.y*e2.x}
+
+		// The coarse basis is (2, 1) and (-1, 3) in the fine one
+		e1, e2 = vector{(3*e1.x - e2.x) / 7, (3*e1.y - e2.y) / 7},
+			vector{(e1.x + 2*e2.x) / 7, (e1.y + 2*e2.y) / 7}
+	}
+
+	return result
+}
+
+// FromLatLng returns the cell containing a point at the given resolution.
+// Latitudes beyond the Web Mercator limit are clamped.
+func FromLatLng(lat, lng float64, resolution int) (Cell, error) {
+	if resolution < 0 || resolution > MaxResolution {
+		return InvalidCell, fmt.Errorf("resolution must be between 0 and %d", MaxResolution)
+	}
+	if math.IsNaN(lat) || math.IsNaN(lng) || lat < -90 || lat > 90 || lng < -180 || lng > 180 {
+		return InvalidCell, fmt.Errorf("invalid coordinates: %f, %f", lat, lng)
+	}
+
+	q, r := lattices[resolution].toAxial(project(lat, lng))
+	return newCell(resolution, roundAxial(q, r)), nil
+}
+
+// ParseCell reads a cell from its String form.
+func ParseCell(value string) (Cell, error) {
+	id, err := strconv.ParseUint(value, 16, 64)
+	if err != nil {
+		return InvalidCell, fmt.Errorf("invalid cell: %s", value)
+	}
+
+	cell := Cell(id)
+	if !cell.IsValid() {
+		return InvalidCell, fmt.Errorf("invalid cell: %s", value)
+	}
+
+	return cell, nil
+}
+
+// EdgeLength returns a cell's edge length in meters at the equator.
+func EdgeLength(resolution int) float64 {
+	return baseEdge / math.Pow(math.Sqrt(7), float64(resolution))
+}
+
+func (c Cell) String() string {
+	return fmt.Sprintf("%016x", uint64(c))
+}
+
+func (c Cell) IsValid() bool {
+	return c != InvalidCell && c.Resolution() <= MaxResolution
+}
+
+func (c Cell) Resolution() int {
+	return int(uint64(c) >> resolutionAt)
+}
+
+// LatLng returns the cell's center. As the grid does not wrap, the center of a
+// cell straddling the antimeridian lies past 180 degrees of longitude.
+func (c Cell) LatLng() LatLng {
+	return unproject(lattices[c.Resolution()].toPlane(c.axial()))
+}
+
+// Boundary returns the cell's six vertices, counter-clockwise.
+func (c Cell) Boundary() []LatLng {
+	basis := lattices[c.Resolution()]
+	center := basis.toPlane(c.axial())
+
+	// Vertices sit between neighbour directions, one circumradius out
+	radius := math.Hypot(basis.e1.x, basis.e1.y) / math.Sqrt(3)
+	start := math.Atan2(basis.e1.y, basis.e1.x) + math.Pi/6
+
+	boundary := make([]LatLng, 6)
+	for i := range boundary {
+		angle := start + float64(i)*math.Pi/3
+		boundary[i] = unproject(vector{
+			center.x + radius*math.Cos(angle),
+			center.y + radius*math.Sin(angle),
+		})
+	}
+
+	return boundary
+}
+
+// Helper methods
+
+// axial is a cell's position on its resolution's lattice.
+type axial struct {
+	q, r int64
+}
+
+func newCell(resolution int, position axial) Cell {
+	return Cell(uint64(resolution)<<resolutionAt |
+		uint64(position.q+coordOffset)&coordMask<<coordBits |
+		uint64(position.r+coordOffset)&coordMask)
+}
+
+func (c Cell) axial() axial {
+	return axial{
+		q: int64(uint64(c)>>coordBits&coordMask) - coordOffset,
+		r: int64(uint64(c)&coordMask) - coordOffset,
+	}
+}
+
+func (l lattice) toAxial(point vector) (float64, float64) {
+	q := (point.x*l.e2.y - point.y*l.e2.x) / l.det
+	r := (l.e1.x*point.y - l.e1.y*point.x) / l.det
+	return q, r
+}
+
+func (l lattice) toPlane(position axial) vector {
+	q, r := float64(position.q), float64(position.r)
+	return vector{q*l.e1.x + r*l.e2.x, q*l.e1.y + r*l.e2.y}
+}
+
+// roundAxial snaps fractional axial coordinates to the nearest lattice point
+// using cube rounding.
+func roundAxial(q, r float64) axial {
+	s := -q - r
+	rq, rr, rs := math.Round(q), math.Round(r), math.Round(s)
+
+	dq, dr, ds := math.Abs(rq-q), math.Abs(rr-r), math.Abs(rs-s)
+	switch {
+	case dq > dr && dq > ds:
+		rq = -rr - rs
+	case dr > ds:
+		rr = -rq - rs
+	}
+
+	return axial{int64(rq), int64(rr)}
+}
+
+func project(lat, lng float64) vector {
+	lat = math.Max(-maxLatitude, math.Min(maxLatitude, lat))
+	phi := lat * math.Pi / 180
+	return vector{
+		x: earthRadius * lng * math.Pi / 180,
+		y: earthRadius * math.Log(math.Tan(math.Pi/4+phi/2)),
+	}
+}
+
+func unproject(point vector) LatLng {
+	return LatLng{
+		Lat: (2*math.Atan(math.Exp(point.y/earthRadius)) - math.Pi/2) * 180 / math.Pi,
+		Lng: point.x / earthRadius * 180 / math.Pi,
+	}
+}
@@ -0,0 +1,140 @@
+package hexgrid
+
+import (
+	"math"
+	"testing"
+)
+
+func TestFromLatLngRoundTrip(t *testing.T) {
+	tests := []struct {
+		name     string
+		lat, lng float64
+	}{
+		{name: "origin", lat: 0, lng: 0},
+		{name: "northern city", lat: 37.7749, lng: -122.4194},
+		{name: "southern city", lat: -33.8688, lng: 151.2093},
+		{name: "east of the antimeridian", lat: 10, lng: 179.9999},
+		{name: "west of the antimeridian", lat: 10, lng: -179.9999},
+		{name: "near the Web Mercator limit", lat: 85, lng: 45},
+		{name: "beyond the Web Mercator limit", lat: -89.9, lng: -45},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for resolution := 0; resolution <= MaxResolution; resolution++ {
+				cell, err := FromLatLng(tt.lat, tt.lng, resolution)
+				if err != nil {
+					t.Fatalf("FromLatLng(%d) error = %v", resolution, err)
+				}
+				if !cell.IsValid() || cell.Resolution() != resolution {
+					t.Fatalf("FromLatLng(%d) = %s at resolution %d, want a valid cell", resolution, cell, cell.Resolution())
+				}
+
+				parsed, err := ParseCell(cell.String())
+				if err != nil || parsed != cell {
+					t.Errorf("ParseCell(%s) = %s, %v; want the cell back", cell, parsed, err)
+				}
+
+				// Snap the center on the lattice directly, as the centers of
+				// cells straddling the antimeridian lie past 180 degrees,
+				// which FromLatLng rejects
+				center := cell.LatLng()
+				if again := newCell(resolution, roundAxial(lattices[resolution].toAxial(project(center.Lat, center.Lng)))); again != cell {
+					t.Errorf("resolution %d: center %v is in %s, want %s", resolution, center, again, cell)
+				}
+
+				// On the projected plane no point is further from its
+				// cell's center than a vertex is
+				point, middle := project(tt.lat, tt.lng), project(center.Lat, center.Lng)
+				if d := math.Hypot(point.x-middle.x, point.y-middle.y); d > EdgeLength(resolution)*1.0001 {
+					t.Errorf("resolution %d: point is %.2fm from its center, want at most %.2fm", resolution, d, EdgeLength(resolution))
+				}
+			}
+		})
+	}
+}
+
+// TestAntimeridian checks the grid does not wrap: points either side of the
+// antimeridian fall in cells far apart.
+func TestAntimeridian(t *testing.T) {
+	east, err := FromLatLng(0, 179.99, 3)
+	if err != nil {
+		t.Fatalf("FromLatLng() error = %v", err)
+	}
+	west, err := FromLatLng(0, -179.99, 3)
+	if err != nil {
+		t.Fatalf("FromLatLng() error = %v", err)
+	}
+
+	if east == west {
+		t.Fatalf("both sides of the antimeridian are in %s", east)
+	}
+	if distance, _ := GridDistance(east, west); distance < 100 {
+		t.Errorf("GridDistance() = %d across the antimeridian, want the width of the map", distance)
+	}
+}
+
+func TestFromLatLngRejects(t *testing.T) {
+	tests := []struct {
+		name       string
+		lat, lng   float64
+		resolution int
+	}{
+		{name: "negative resolution", resolution: -1},
+		{name: "resolution too fine", resolution: MaxResolution + 1},
+		{name: "latitude out of range", lat: 90.5, resolution: 5},
+		{name: "longitude out of range", lng: -180.5, resolution: 5},
+		{name: "latitude not a number", lat: math.NaN(), resolution: 5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if cell, err := FromLatLng(tt.lat, tt.lng, tt.resolution); err == nil || cell != InvalidCell {
+				t.Errorf("FromLatLng() = %s, %v; want an error", cell, err)
+			}
+		})
+	}
+}
+
+func TestParseCellRejects(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+	}{
+		{name: "empty", value: ""},
+		{name: "not hexadecimal", value: "not-a-cell"},
+		{name: "invalid cell", value: InvalidCell.String()},
+		{name: "too long", value: "1" + InvalidCell.String()},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if cell, err := ParseCell(tt.value); err == nil {
+				t.Errorf("ParseCell(%q) = %s, want an error", tt.value, cell)
+			}
+		})
+	}
+}
+
+func TestBoundary(t *testing.T) {
+	for _, resolution := range []int{0, 7, MaxResolution} {
+		cell, err := FromLatLng(51.5074, -0.1278, resolution)
+		if err != nil {
+			t.Fatalf("FromLatLng() error = %v", err)
+		}
+
+		boundary := cell.Boundary()
+		if len(boundary) != 6 {
+			t.Fatalf("resolution %d: Boundary() has %d vertices, want 6", resolution, len(boundary))
+		}
+
+		center := cell.LatLng()
+		middle := project(center.Lat, center.Lng)
+		for i, vertex := range boundary {
+			point := project(vertex.Lat, vertex.Lng)
+			if d := math.Hypot(point.x-middle.x, point.y-middle.y); math.Abs(d-EdgeLength(resolution)) > EdgeLength(resolution)*1e-6 {
+				t.Errorf("resolution %d: vertex %d is %.4fm from the center, want %.4fm", resolution, i, d, EdgeLength(resolution))
+			}
+		}
+	}
+}
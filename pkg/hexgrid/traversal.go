@@ -0,0 +1,184 @@
+package hexgrid
+
+import (
+	"fmt"
+	"math"
+)
+
+// maxCoverCells bounds Cover so a huge area at a fine resolution fails fast
+// instead of exhausting memory.
+const maxCoverCells = 200000
+
+// directions lists the six neighbour offsets in axial coordinates.
+var directions = [6]axial{
+	{1, 0}, {1, -1}, {0, -1}, {-1, 0}, {-1, 1}, {0, 1},
+}
+
+// Neighbors returns the six cells sharing an edge with c.
+func (c Cell) Neighbors() []Cell {
+	position := c.axial()
+	neighbors := make([]Cell, len(directions))
+	for i, direction := range directions {
+		neighbors[i] = newCell(c.Resolution(), axial{position.q + direction.q, position.r + direction.r})
+	}
+	return neighbors
+}
+
+// KRing returns every cell within k steps of c, c first and then ring by ring.
+func KRing(c Cell, k int) []Cell {
+	if k < 0 {
+		return nil
+	}
+
+	cells := []Cell{c}
+	for ring := 1; ring <= k; ring++ {
+		cells = append(cells, Ring(c, ring)...)
+	}
+	return cells
+}
+
+// Ring returns the cells exactly k steps from c.
+func Ring(c Cell, k int) []Cell {
+	if k <= 0 {
+		return []Cell{c}
+	}
+
+	// Start k steps out along direction 4 and walk each of the six sides
+	origin := c.axial()
+	position := axial{origin.q + directions[4].q*int64(k), origin.r + directions[4].r*int64(k)}
+
+	cells := make([]Cell, 0, 6*k)
+	for side := 0; side < 6; side++ {
+		for step := 0; step < k; step++ {
+			cells = append(cells, newCell(c.Resolution(), position))
+			position = axial{position.q + directions[side].q, position.r + directions[side].r}
+		}
+	}
+	return cells
+}
+
+// GridDistance returns the number of steps between two cells of the same
+// resolution.
+func GridDistance(a, b Cell) (int, error) {
+	if a.Resolution() != b.Resolution() {
+		return 0, fmt.Errorf("cells have different resolutions")
+	}
+
+	pa, pb := a.axial(), b.axial()
+	dq, dr := pa.q-pb.q, pa.r-pb.r
+	return int((abs(dq) + abs(dr) + abs(dq+dr)) / 2), nil
+}
+
+// Parent returns the cell at a coarser resolution whose children include c.
+func (c Cell) Parent(resolution int) (Cell, error) {
+	if resolution < 0 || resolution > c.Resolution() {
+		return InvalidCell, fmt.Errorf("parent resolution must be between 0 and %d", c.Resolution())
+	}
+
+	position := c.axial()
+	for current := c.Resolution(); current > resolution; current-- {
+		// Invert the child-center mapping (2q - r, q + 3r) and snap to the
+		// nearest parent
+		q, r := float64(position.q), float64(position.r)
+		position = roundAxial((3*q+r)/7, (2*r-q)/7)
+	}
+
+	return newCell(resolution, position), nil
+}
+
+// Children returns the cells at a finer resolution that descend from c, seven
+// per resolution step.
+func (c Cell) Children(resolution int) ([]Cell, error) {
+	if resolution < c.Resolution() || resolution > MaxResolution {
+		return nil, fmt.Errorf("child resolution must be between %d and %d", c.Resolution(), MaxResolution)
+	}
+
+	cells := []Cell{c}
+	for current := c.Resolution(); current < resolution; current++ {
+		next := make([]Cell, 0, len(cells)*7)
+		for _, cell := range cells {
+			next = append(next, cell.directChildren()...)
+		}
+		cells = next
+	}
+
+	return cells, nil
+}
+
+// CenterChild returns the child at c's center.
+func (c Cell) CenterChild(resolution int) (Cell, error) {
+	if resolution < c.Resolution() || resolution > MaxResolution {
+		return InvalidCell, fmt.Errorf("child resolution must be between %d and %d", c.Resolution(), MaxResolution)
+	}
+
+	cell := c
+	for current := c.Resolution(); current < resolution; current++ {
+		cell = cell.directChildren()[0]
+	}
+	return cell, nil
+}
+
+// Cover returns the cells whose centers fall inside an area, given by its
+// bounding box and a containment test. The cell containing the box's center is
+// always included so small areas are never left without a cell.
+func Cover(southwest, northeast LatLng, resolution int, contains func(LatLng) bool) ([]Cell, error) {
+	center, err := FromLatLng((southwest.Lat+northeast.Lat)/2, (southwest.Lng+northeast.Lng)/2, resolution)
+	if err != nil {
+		return nil, err
+	}
+
+	// Explore one cell beyond the box so cells along its edges are reached
+	basis := lattices[resolution]
+	margin := math.Hypot(basis.e1.x, basis.e1.y)
+	low, high := project(southwest.Lat, southwest.Lng), project(northeast.Lat, northeast.Lng)
+	inBox := func(point vector) bool {
+		return point.x >= low.x-margin && point.x <= high.x+margin &&
+			point.y >= low.y-margin && point.y <= high.y+margin
+	}
+
+	cells := []Cell{center}
+	visited := map[Cell]bool{center: true}
+	queue := []Cell{center}
+
+	for len(queue) > 0 {
+		cell := queue[0]
+		queue = queue[1:]
+
+		for _, neighbor := range cell.Neighbors() {
+			if visited[neighbor] {
+				continue
+			}
+			visited[neighbor] = true
+
+			if !inBox(basis.toPlane(neighbor.axial())) {
+				continue
+			}
+			if len(visited) > maxCoverCells {
+				return nil, fmt.Errorf("area needs more than %d cells at resolution %d", maxCoverCells, resolution)
+			}
+
+			queue = append(queue, neighbor)
+			if contains(neighbor.LatLng()) {
+				cells = append(cells, neighbor)
+			}
+		}
+	}
+
+	return cells, nil
+}
+
+// Helper methods
+
+// directChildren returns the center child followed by its six neighbours.
+func (c Cell) directChildren() []Cell {
+	position := c.axial()
+	center := newCell(c.Resolution()+1, axial{2*position.q - position.r, position.q + 3*position.r})
+	return append([]Cell{center}, center.Neighbors()...)
+}
+
+func abs(value int64) int64 {
+	if value < 0 {
+		return -value
+	}
+	return value
+}
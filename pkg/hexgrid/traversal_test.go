@@ -0,0 +1,239 @@
+package hexgrid
+
+import (
+	"math"
+	"testing"
+)
+
+func TestNeighbors(t *testing.T) {
+	tests := []struct {
+		name       string
+		lat, lng   float64
+		resolution int
+	}{
+		{name: "coarse cell", lat: 40.7128, lng: -74.006, resolution: 0},
+		{name: "fine cell", lat: 40.7128, lng: -74.006, resolution: 12},
+		{name: "cell at the origin", lat: 0, lng: 0, resolution: 9},
+		{name: "cell by the antimeridian", lat: -17.7, lng: 179.99, resolution: 6},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cell, err := FromLatLng(tt.lat, tt.lng, tt.resolution)
+			if err != nil {
+				t.Fatalf("FromLatLng() error = %v", err)
+			}
+
+			seen := map[Cell]bool{cell: true}
+			for _, neighbor := range cell.Neighbors() {
+				if seen[neighbor] {
+					t.Errorf("neighbor %s repeated", neighbor)
+				}
+				seen[neighbor] = true
+
+				if distance, err := GridDistance(cell, neighbor); err != nil || distance != 1 {
+					t.Errorf("GridDistance(%s, %s) = %d, %v; want 1", cell, neighbor, distance, err)
+				}
+
+				back := false
+				for _, other := range neighbor.Neighbors() {
+					back = back || other == cell
+				}
+				if !back {
+					t.Errorf("%s is not a neighbor of its neighbor %s", cell, neighbor)
+				}
+			}
+			if len(seen) != 7 {
+				t.Errorf("Neighbors() = %d distinct cells, want 6", len(seen)-1)
+			}
+		})
+	}
+}
+
+func TestKRing(t *testing.T) {
+	cell, err := FromLatLng(-23.5505, -46.6333, 8)
+	if err != nil {
+		t.Fatalf("FromLatLng() error = %v", err)
+	}
+
+	tests := []struct {
+		k         int
+		wantCells int
+	}{
+		{k: -1, wantCells: 0},
+		{k: 0, wantCells: 1},
+		{k: 1, wantCells: 7},
+		{k: 2, wantCells: 19},
+		{k: 5, wantCells: 91},
+	}
+
+	for _, tt := range tests {
+		cells := KRing(cell, tt.k)
+		if len(cells) != tt.wantCells {
+			t.Errorf("KRing(%d) = %d cells, want %d", tt.k, len(cells), tt.wantCells)
+			continue
+		}
+		if tt.k >= 0 && cells[0] != cell {
+			t.Errorf("KRing(%d) starts at %s, want %s", tt.k, cells[0], cell)
+		}
+
+		seen := make(map[Cell]bool)
+		for _, c := range cells {
+			if seen[c] {
+				t.Errorf("KRing(%d) repeats %s", tt.k, c)
+			}
+			seen[c] = true
+			if distance, _ := GridDistance(cell, c); distance > tt.k {
+				t.Errorf("KRing(%d) holds %s at distance %d", tt.k, c, distance)
+			}
+		}
+	}
+
+	for k := 1; k <= 4; k++ {
+		ring := Ring(cell, k)
+		if len(ring) != 6*k {
+			t.Errorf("Ring(%d) = %d cells, want %d", k, len(ring), 6*k)
+		}
+		for _, c := range ring {
+			if distance, _ := GridDistance(cell, c); distance != k {
+				t.Errorf("Ring(%d) holds %s at distance %d", k, c, distance)
+			}
+		}
+	}
+}
+
+func TestGridDistanceAcrossResolutions(t *testing.T) {
+	coarse, _ := FromLatLng(0, 0, 4)
+	fine, _ := FromLatLng(0, 0, 5)
+
+	if _, err := GridDistance(coarse, fine); err == nil {
+		t.Error("GridDistance() of cells at different resolutions succeeded, want an error")
+	}
+}
+
+func TestParentAndChildren(t *testing.T) {
+	cell, err := FromLatLng(48.8566, 2.3522, 6)
+	if err != nil {
+		t.Fatalf("FromLatLng() error = %v", err)
+	}
+
+	tests := []struct {
+		resolution int
+		wantCells  int
+	}{
+		{resolution: 6, wantCells: 1},
+		{resolution: 7, wantCells: 7},
+		{resolution: 8, wantCells: 49},
+	}
+
+	for _, tt := range tests {
+		children, err := cell.Children(tt.resolution)
+		if err != nil {
+			t.Fatalf("Children(%d) error = %v", tt.resolution, err)
+		}
+		if len(children) != tt.wantCells {
+			t.Errorf("Children(%d) = %d cells, want %d", tt.resolution, len(children), tt.wantCells)
+		}
+
+		seen := make(map[Cell]bool)
+		for _, child := range children {
+			if seen[child] || child.Resolution() != tt.resolution {
+				t.Errorf("Children(%d) holds %s at resolution %d", tt.resolution, child, child.Resolution())
+			}
+			seen[child] = true
+		}
+	}
+
+	// Direct children always snap back to their parent
+	children, _ := cell.Children(7)
+	for _, child := range children {
+		if parent, err := child.Parent(6); err != nil || parent != cell {
+			t.Errorf("Parent(6) of %s = %s, %v; want %s", child, parent, err, cell)
+		}
+	}
+
+	center, err := cell.CenterChild(MaxResolution)
+	if err != nil {
+		t.Fatalf("CenterChild() error = %v", err)
+	}
+	if parent, err := center.Parent(6); err != nil || parent != cell {
+		t.Errorf("Parent(6) of the center child = %s, %v; want %s", parent, err, cell)
+	}
+	got, want := center.LatLng(), cell.LatLng()
+	a, b := project(got.Lat, got.Lng), project(want.Lat, want.Lng)
+	if d := math.Hypot(a.x-b.x, a.y-b.y); d > 1e-6 {
+		t.Errorf("center child is %gm from the center, want it on the center", d)
+	}
+
+	if _, err := cell.Parent(7); err == nil {
+		t.Error("Parent() at a finer resolution succeeded, want an error")
+	}
+	if _, err := cell.Children(5); err == nil {
+		t.Error("Children() at a coarser resolution succeeded, want an error")
+	}
+	if _, err := cell.CenterChild(MaxResolution + 1); err == nil {
+		t.Error("CenterChild() beyond the finest resolution succeeded, want an error")
+	}
+}
+
+func TestCover(t *testing.T) {
+	everywhere := func(LatLng) bool { return true }
+	nowhere := func(LatLng) bool { return false }
+
+	tests := []struct {
+		name                 string
+		southwest, northeast LatLng
+		resolution           int
+		contains             func(LatLng) bool
+		wantMin, wantMax     int
+		wantErr              bool
+	}{
+		{
+			name:       "box covered by its cells",
+			southwest:  LatLng{Lat: 37.70, Lng: -122.52},
+			northeast:  LatLng{Lat: 37.82, Lng: -122.35},
+			resolution: 6,
+			contains:   everywhere,
+			wantMin:    10,
+			wantMax:    200,
+		},
+		{
+			name:       "area smaller than a cell keeps the center cell",
+			southwest:  LatLng{Lat: 37.7749, Lng: -122.4194},
+			northeast:  LatLng{Lat: 37.7750, Lng: -122.4193},
+			resolution: 2,
+			contains:   nowhere,
+			wantMin:    1,
+			wantMax:    1,
+		},
+		{
+			name:       "area too large for the resolution",
+			southwest:  LatLng{Lat: -40, Lng: -60},
+			northeast:  LatLng{Lat: 40, Lng: 60},
+			resolution: 10,
+			contains:   everywhere,
+			wantErr:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cells, err := Cover(tt.southwest, tt.northeast, tt.resolution, tt.contains)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Cover() error = %v, want error %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			if len(cells) < tt.wantMin || len(cells) > tt.wantMax {
+				t.Errorf("Cover() = %d cells, want between %d and %d", len(cells), tt.wantMin, tt.wantMax)
+			}
+
+			center, _ := FromLatLng((tt.southwest.Lat+tt.northeast.Lat)/2, (tt.southwest.Lng+tt.northeast.Lng)/2, tt.resolution)
+			if cells[0] != center {
+				t.Errorf("Cover() starts at %s, want the center cell %s", cells[0], center)
+			}
+		})
+	}
+}
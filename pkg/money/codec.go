@@ -0,0 +1,125 @@
+package money
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+)
+
+// Money is stored in MongoDB as {amount: <int64 minor units>, currency} and
+// sent over JSON as {"amount": "12.34", "currency": "USD"}, the amount being a
+// decimal string in major units so clients need no exponent table.
+//
+// Amounts written before the move to Money were plain numbers in major units.
+// Both decoders still read them, assuming two decimals because the currency is
+// not known; the money migration rewrites stored documents with their real
+// currency.
+
+type bsonMoney struct {
+	Amount   int64  `bson:"amount"`
+	Currency string `bson:"currency"`
+}
+
+type jsonMoney struct {
+	Amount   json.RawMessage `json:"amount"`
+	Currency string          `json:"currency"`
+}
+
+func (m Money) MarshalBSONValue() (bsontype.Type, []byte, error) {
+	data, err := bson.Marshal(bsonMoney{Amount: m.Amount, Currency: m.Currency})
+	if err != nil {
+		return 0, nil, err
+	}
+	return bson.TypeEmbeddedDocument, data, nil
+}
+
+func (m *Money) UnmarshalBSONValue(t bsontype.Type, data []byte) error {
+	value := bson.RawValue{Type: t, Value: data}
+
+	switch t {
+	case bson.TypeEmbeddedDocument:
+		document := value.Document()
+		amount, err := document.LookupErr("amount")
+		if err != nil {
+			*m = Money{}
+		} else {
+			minor, ok := amount.AsInt64OK()
+			if !ok {
+				return fmt.Errorf("invalid money amount of type %s", amount.Type)
+			}
+			m.Amount = minor
+		}
+		if currency, ok := document.Lookup("currency").StringValueOK(); ok {
+			m.Currency = currency
+		} else {
+			m.Currency = ""
+		}
+	case bson.TypeDouble:
+		*m = FromMajor(value.Double(), "")
+	case bson.TypeInt32:
+		*m = New(int64(value.Int32())*100, "")
+	case bson.TypeInt64:
+		*m = New(value.Int64()*100, "")
+	case bson.TypeDecimal128:
+		parsed, err := parseDecimal(value.Decimal128().String(), 2, true)
+		if err != nil {
+			return err
+		}
+		*m = New(parsed, "")
+	case bson.TypeNull, bson.TypeUndefined:
+		*m = Money{}
+	default:
+		return fmt.Errorf("cannot decode money from BSON %s", t)
+	}
+
+	return nil
+}
+
+func (m Money) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Amount   string `json:"amount"`
+		Currency string `json:"currency"`
+	}{
+		Amount:   m.String(),
+		Currency: m.Currency,
+	})
+}
+
+func (m *Money) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	if bytes.Equal(data, []byte("null")) {
+		*m = Money{}
+		return nil
+	}
+
+	var amount json.RawMessage
+	currency := ""
+	if len(data) > 0 && data[0] == '{' {
+		var value jsonMoney
+		if err := json.Unmarshal(data, &value); err != nil {
+			return err
+		}
+		amount, currency = value.Amount, strings.ToUpper(value.Currency)
+	} else {
+		amount = data
+	}
+
+	// The amount may be a decimal string or a JSON number; both are read as
+	// written, without a trip through float64
+	text := strings.Trim(string(bytes.TrimSpace(amount)), `"`)
+	if text == "" || text == "null" {
+		*m = Zero(currency)
+		return nil
+	}
+
+	parsed, err := Parse(text, currency)
+	if err != nil {
+		return err
+	}
+	*m = parsed
+	return nil
+}
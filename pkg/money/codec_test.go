@@ -0,0 +1,80 @@
+package money
+
+import (
+	"encoding/json"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestJSON(t *testing.T) {
+	data, err := json.Marshal(New(-1250, "USD"))
+	if err != nil {
+		t.Fatalf("Marshal() error = %v", err)
+	}
+	if string(data) != `{"amount":"-12.50","currency":"USD"}` {
+		t.Errorf("Marshal() = %s", data)
+	}
+
+	tests := []struct {
+		name    string
+		data    string
+		want    Money
+		wantErr bool
+	}{
+		{name: "decimal string", data: `{"amount":"12.34","currency":"usd"}`, want: New(1234, "USD")},
+		{name: "number", data: `{"amount":12.34,"currency":"USD"}`, want: New(1234, "USD")},
+		{name: "currency without decimals", data: `{"amount":"1500","currency":"JPY"}`, want: New(1500, "JPY")},
+		{name: "missing amount", data: `{"currency":"EUR"}`, want: Zero("EUR")},
+		{name: "legacy plain number", data: `7.5`, want: New(750, "")},
+		{name: "null", data: `null`, want: Money{}},
+		{name: "too many decimals", data: `{"amount":"1.234","currency":"USD"}`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got Money
+			err := json.Unmarshal([]byte(tt.data), &got)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Unmarshal() error = %v, want error %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("Unmarshal() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBSON(t *testing.T) {
+	type document struct {
+		Fare Money `bson:"fare"`
+	}
+
+	tests := []struct {
+		name   string
+		stored interface{}
+		want   Money
+	}{
+		{name: "money", stored: New(1234, "KWD"), want: New(1234, "KWD")},
+		{name: "legacy double", stored: 12.345, want: New(1235, "")},
+		{name: "legacy integer", stored: int32(12), want: New(1200, "")},
+		{name: "null", stored: nil, want: Money{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := bson.Marshal(bson.M{"fare": tt.stored})
+			if err != nil {
+				t.Fatalf("Marshal() error = %v", err)
+			}
+
+			var got document
+			if err := bson.Unmarshal(data, &got); err != nil {
+				t.Fatalf("Unmarshal() error = %v", err)
+			}
+			if got.Fare != tt.want {
+				t.Errorf("Unmarshal() = %+v, want %+v", got.Fare, tt.want)
+			}
+		})
+	}
+}
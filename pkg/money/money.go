@@ -0,0 +1,392 @@
+// Package money represents monetary amounts as an integer number of minor
+// units (cents, paise, yen) in an ISO 4217 currency. Sums, splits and
+// conversions are exact, so stored amounts reconcile to the cent instead of
+// drifting the way float64 amounts do.
+package money
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ErrCurrencyMismatch is returned when amounts in different currencies are
+// combined.
+var ErrCurrencyMismatch = errors.New("currency mismatch")
+
+// Money is an amount in the minor unit of its currency. The zero value is an
+// amount of zero in no particular currency and combines with any currency.
+type Money struct {
+	Amount   int64  // minor units
+	Currency string // ISO 4217 code
+}
+
+// exponents lists the currencies whose minor unit is not a hundredth of the
+// major unit. Every other currency has two decimals.
+var exponents = map[string]int{
+	"BIF": 0, "CLP": 0, "DJF": 0, "GNF": 0, "ISK": 0, "JPY": 0, "KMF": 0, "KRW": 0,
+	"PYG": 0, "RWF": 0, "UGX": 0, "UYI": 0, "VND": 0, "VUV": 0, "XAF": 0, "XOF": 0, "XPF": 0,
+	"BHD": 3, "IQD": 3, "JOD": 3, "KWD": 3, "LYD": 3, "OMR": 3, "TND": 3,
+}
+
+// New returns an amount given in minor units.
+func New(amount int64, currency string) Money {
+	return Money{Amount: amount, Currency: strings.ToUpper(currency)}
+}
+
+// Zero returns an amount of zero in a currency.
+func Zero(currency string) Money {
+	return New(0, currency)
+}
+
+// FromMajor converts an amount in major units, rounding half away from zero to
+// the currency's minor unit. The float is read through its shortest decimal
+// form, so 1.005 becomes 1.01 rather than 1.00.
+func FromMajor(amount float64, currency string) Money {
+	if math.IsNaN(amount) || math.IsInf(amount, 0) {
+		return Zero(currency)
+	}
+
+	minor, err := parseDecimal(strconv.FormatFloat(amount, 'f', -1, 64), Exponent(currency), true)
+	if err != nil {
+		// Only reachable for amounts beyond int64 minor units
+		return Zero(currency)
+	}
+	return New(minor, currency)
+}
+
+// Parse reads a decimal amount in major units, such as "12.34". It fails
+// rather than round when the value has more decimals than the currency allows.
+func Parse(value, currency string) (Money, error) {
+	minor, err := parseDecimal(strings.TrimSpace(value), Exponent(currency), false)
+	if err != nil {
+		return Money{}, err
+	}
+	return New(minor, currency), nil
+}
+
+// Exponent returns the number of decimals of a currency's minor unit.
+func Exponent(currency string) int {
+	if exponent, exists := exponents[strings.ToUpper(currency)]; exists {
+		return exponent
+	}
+	return 2
+}
+
+// Exponents returns the currencies whose minor unit is not a hundredth, keyed
+// by currency code.
+func Exponents() map[string]int {
+	result := make(map[string]int, len(exponents))
+	for currency, exponent := range exponents {
+		result[currency] = exponent
+	}
+	return result
+}
+
+// Float64 returns the amount in major units. Use it only for display and
+// analytics, never to compute an amount that is stored or charged.
+func (m Money) Float64() float64 {
+	return float64(m.Amount) / math.Pow10(Exponent(m.Currency))
+}
+
+// String returns the amount in major units with the currency's decimals, such
+// as "12.34" or "-0.50".
+func (m Money) String() string {
+	exponent := Exponent(m.Currency)
+	amount := m.Amount
+	sign := ""
+	if amount < 0 {
+		sign = "-"
+	}
+
+	digits := strconv.FormatUint(absUint(amount), 10)
+	if exponent == 0 {
+		return sign + digits
+	}
+	if len(digits) <= exponent {
+		digits = strings.Repeat("0", exponent-len(digits)+1) + digits
+	}
+	return sign + digits[:len(digits)-exponent] + "." + digits[len(digits)-exponent:]
+}
+
+func (m Money) IsZero() bool {
+	return m.Amount == 0
+}
+
+func (m Money) IsPositive() bool {
+	return m.Amount > 0
+}
+
+func (m Money) IsNegative() bool {
+	return m.Amount < 0
+}
+
+func (m Money) Neg() Money {
+	return Money{Amount: -m.Amount, Currency: m.Currency}
+}
+
+func (m Money) Abs() Money {
+	if m.Amount < 0 {
+		return m.Neg()
+	}
+	return m
+}
+
+// SameCurrency reports whether two amounts can be combined.
+func (m Money) SameCurrency(other Money) bool {
+	_, err := commonCurrency(m, other)
+	return err == nil
+}
+
+// Add returns m + other.
+func (m Money) Add(other Money) (Money, error) {
+	currency, err := commonCurrency(m, other)
+	if err != nil {
+		return Money{}, err
+	}
+	return Money{Amount: m.Amount + other.Amount, Currency: currency}, nil
+}
+
+// Sub returns m - other.
+func (m Money) Sub(other Money) (Money, error) {
+	currency, err := commonCurrency(m, other)
+	if err != nil {
+		return Money{}, err
+	}
+	return Money{Amount: m.Amount - other.Amount, Currency: currency}, nil
+}
+
+// Compare returns -1, 0 or 1 as m is less than, equal to or greater than
+// other.
+func (m Money) Compare(other Money) (int, error) {
+	if _, err := commonCurrency(m, other); err != nil {
+		return 0, err
+	}
+	switch {
+	case m.Amount < other.Amount:
+		return -1, nil
+	case m.Amount > other.Amount:
+		return 1, nil
+	}
+	return 0, nil
+}
+
+// Multiply scales the amount, rounding half away from zero to the minor unit.
+func (m Money) Multiply(factor float64) Money {
+	return Money{Amount: int64(math.Round(float64(m.Amount) * factor)), Currency: m.Currency}
+}
+
+// Percent returns the given percentage of the amount, rounded to the minor
+// unit.
+func (m Money) Percent(percent float64) Money {
+	return m.Multiply(percent / 100)
+}
+
+// Convert converts the amount into another currency at a rate given in major
+// units, rounding to the target currency's minor unit.
+func (m Money) Convert(rate float64, currency string) Money {
+	return FromMajor(m.Float64()*rate, currency)
+}
+
+// Allocate splits the amount in proportion to the given ratios without losing
+// minor units: each share is rounded down and the remainder is handed out one
+// unit at a time to the shares that lost the most, earlier shares first on
+// ties. The shares always sum to the original amount.
+func (m Money) Allocate(ratios ...float64) ([]Money, error) {
+	if len(ratios) == 0 {
+		return nil, fmt.Errorf("at least one ratio is required")
+	}
+
+	var total float64
+	for _, ratio := range ratios {
+		if ratio < 0 || math.IsNaN(ratio) || math.IsInf(ratio, 0) {
+			return nil, fmt.Errorf("ratios must be non-negative numbers")
+		}
+		total += ratio
+	}
+	if total <= 0 {
+		return nil, fmt.Errorf("ratios must not all be zero")
+	}
+
+	// Allocate the magnitude and restore the sign afterwards so negative
+	// amounts round the same way as positive ones
+	amount := m.Amount
+	sign := int64(1)
+	if amount < 0 {
+		amount, sign = -amount, -1
+	}
+
+	shares := make([]Money, len(ratios))
+	remainders := make([]float64, len(ratios))
+	allocated := int64(0)
+	for i, ratio := range ratios {
+		exact := float64(amount) * ratio / total
+		share := int64(math.Floor(exact))
+		shares[i] = Money{Amount: share, Currency: m.Currency}
+		remainders[i] = exact - float64(share)
+		allocated += share
+	}
+
+	// Hand out what rounding down left over, largest remainder first
+	order := make([]int, 0, len(ratios))
+	for i, ratio := range ratios {
+		if ratio > 0 {
+			order = append(order, i)
+		}
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return remainders[order[a]] > remainders[order[b]]
+	})
+	for left, next := amount-allocated, 0; left > 0; left, next = left-1, next+1 {
+		shares[order[next%len(order)]].Amount++
+	}
+	// Float error can round a share up; take it back from the smallest
+	// remainders
+	for excess, next := allocated-amount, len(order)-1; excess > 0; excess, next = excess-1, next-1 {
+		shares[order[(next%len(order)+len(order))%len(order)]].Amount--
+	}
+
+	for i := range shares {
+		shares[i].Amount *= sign
+	}
+	return shares, nil
+}
+
+// Split divides the amount into n equal shares, the first shares taking one
+// extra minor unit each when it does not divide evenly.
+func (m Money) Split(n int) ([]Money, error) {
+	if n <= 0 {
+		return nil, fmt.Errorf("cannot split into %d shares", n)
+	}
+
+	ratios := make([]float64, n)
+	for i := range ratios {
+		ratios[i] = 1
+	}
+	return m.Allocate(ratios...)
+}
+
+// Sum adds amounts of one currency.
+func Sum(amounts ...Money) (Money, error) {
+	var total Money
+	for _, amount := range amounts {
+		var err error
+		if total, err = total.Add(amount); err != nil {
+			return Money{}, err
+		}
+	}
+	return total, nil
+}
+
+// Min returns the smaller of two amounts.
+func Min(a, b Money) (Money, error) {
+	comparison, err := a.Compare(b)
+	if err != nil {
+		return Money{}, err
+	}
+	if comparison > 0 {
+		return b, nil
+	}
+	return a, nil
+}
+
+// Max returns the larger of two amounts.
+func Max(a, b Money) (Money, error) {
+	comparison, err := a.Compare(b)
+	if err != nil {
+		return Money{}, err
+	}
+	if comparison < 0 {
+		return b, nil
+	}
+	return a, nil
+}
+
+// Helper methods
+
+// commonCurrency returns the currency two amounts share. A zero amount with no
+// currency takes the other amount's currency.
+func commonCurrency(a, b Money) (string, error) {
+	switch {
+	case a.Currency == b.Currency:
+		return a.Currency, nil
+	case a.Currency == "" && a.Amount == 0:
+		return b.Currency, nil
+	case b.Currency == "" && b.Amount == 0:
+		return a.Currency, nil
+	}
+	return "", fmt.Errorf("%w: %s and %s", ErrCurrencyMismatch, a.Currency, b.Currency)
+}
+
+// parseDecimal reads a plain decimal number into minor units. With round set,
+// extra decimals are rounded half away from zero; otherwise they must be zero.
+func parseDecimal(value string, exponent int, round bool) (int64, error) {
+	if value == "" {
+		return 0, fmt.Errorf("invalid amount: empty")
+	}
+
+	negative := false
+	digits := value
+	switch digits[0] {
+	case '-':
+		negative = true
+		digits = digits[1:]
+	case '+':
+		digits = digits[1:]
+	}
+
+	whole, fraction, _ := strings.Cut(digits, ".")
+	if whole == "" && fraction == "" || !isDigits(whole) || !isDigits(fraction) {
+		return 0, fmt.Errorf("invalid amount: %s", value)
+	}
+
+	roundUp := false
+	if len(fraction) > exponent {
+		extra := fraction[exponent:]
+		if !round && strings.Trim(extra, "0") != "" {
+			return 0, fmt.Errorf("amount %s has more than %d decimals", value, exponent)
+		}
+		roundUp = round && extra[0] >= '5'
+		fraction = fraction[:exponent]
+	}
+	fraction += strings.Repeat("0", exponent-len(fraction))
+
+	combined := strings.TrimLeft(whole+fraction, "0")
+	if combined == "" {
+		combined = "0"
+	}
+	minor, err := strconv.ParseInt(combined, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("amount %s is out of range", value)
+	}
+	if roundUp {
+		if minor == math.MaxInt64 {
+			return 0, fmt.Errorf("amount %s is out of range", value)
+		}
+		minor++
+	}
+
+	if negative {
+		minor = -minor
+	}
+	return minor, nil
+}
+
+func isDigits(value string) bool {
+	for _, r := range value {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func absUint(value int64) uint64 {
+	if value < 0 {
+		return uint64(-(value + 1)) + 1
+	}
+	return uint64(value)
+}
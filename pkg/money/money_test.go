@@ -0,0 +1,305 @@
+package money
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestFromMajor(t *testing.T) {
+	tests := []struct {
+		name     string
+		amount   float64
+		currency string
+		want     int64
+	}{
+		{name: "whole cents", amount: 12.34, currency: "USD", want: 1234},
+		{name: "half cent rounds up", amount: 1.005, currency: "USD", want: 101},
+		{name: "half cent rounds away from zero", amount: -1.005, currency: "USD", want: -101},
+		{name: "below half a cent rounds down", amount: 2.674, currency: "USD", want: 267},
+		{name: "currency without decimals", amount: 12.5, currency: "JPY", want: 13},
+		{name: "currency with three decimals", amount: 1.0005, currency: "KWD", want: 1001},
+		{name: "lower case currency", amount: 1, currency: "eur", want: 100},
+		{name: "not a number", amount: math.NaN(), currency: "USD", want: 0},
+		{name: "infinity", amount: math.Inf(1), currency: "USD", want: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := FromMajor(tt.amount, tt.currency)
+			if got.Amount != tt.want {
+				t.Errorf("FromMajor(%v, %s) = %d, want %d", tt.amount, tt.currency, got.Amount, tt.want)
+			}
+			if got.Currency != New(0, tt.currency).Currency {
+				t.Errorf("FromMajor() currency = %q, want %q", got.Currency, New(0, tt.currency).Currency)
+			}
+		})
+	}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		value    string
+		currency string
+		want     int64
+		wantErr  bool
+	}{
+		{value: "12.34", currency: "USD", want: 1234},
+		{value: " 12.3 ", currency: "USD", want: 1230},
+		{value: "12.340", currency: "USD", want: 1234},
+		{value: "-0.5", currency: "USD", want: -50},
+		{value: "+7", currency: "USD", want: 700},
+		{value: ".25", currency: "USD", want: 25},
+		{value: "1500", currency: "JPY", want: 1500},
+		{value: "1.234", currency: "BHD", want: 1234},
+		{value: "12.345", currency: "USD", wantErr: true},
+		{value: "1.5", currency: "JPY", wantErr: true},
+		{value: "", currency: "USD", wantErr: true},
+		{value: ".", currency: "USD", wantErr: true},
+		{value: "1.2.3", currency: "USD", wantErr: true},
+		{value: "12,34", currency: "USD", wantErr: true},
+		{value: "1e3", currency: "USD", wantErr: true},
+		{value: "99999999999999999999", currency: "USD", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := Parse(tt.value, tt.currency)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("Parse(%q, %s) error = %v, want error %v", tt.value, tt.currency, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && got.Amount != tt.want {
+			t.Errorf("Parse(%q, %s) = %d, want %d", tt.value, tt.currency, got.Amount, tt.want)
+		}
+	}
+}
+
+func TestString(t *testing.T) {
+	tests := []struct {
+		money Money
+		want  string
+	}{
+		{money: New(1234, "USD"), want: "12.34"},
+		{money: New(5, "USD"), want: "0.05"},
+		{money: New(-50, "USD"), want: "-0.50"},
+		{money: New(0, "USD"), want: "0.00"},
+		{money: New(1500, "JPY"), want: "1500"},
+		{money: New(1, "KWD"), want: "0.001"},
+		{money: New(math.MinInt64, "USD"), want: "-92233720368547758.08"},
+	}
+
+	for _, tt := range tests {
+		if got := tt.money.String(); got != tt.want {
+			t.Errorf("%d %s String() = %q, want %q", tt.money.Amount, tt.money.Currency, got, tt.want)
+		}
+	}
+}
+
+func TestMultiply(t *testing.T) {
+	tests := []struct {
+		name   string
+		amount int64
+		factor float64
+		want   int64
+	}{
+		{name: "exact", amount: 250, factor: 0.5, want: 125},
+		{name: "half unit rounds up", amount: 5, factor: 0.5, want: 3},
+		{name: "negative half unit rounds away from zero", amount: -5, factor: 0.5, want: -3},
+		{name: "below half a unit rounds down", amount: 1000, factor: 0.3333, want: 333},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := New(tt.amount, "USD").Multiply(tt.factor); got.Amount != tt.want || got.Currency != "USD" {
+				t.Errorf("Multiply(%v) = %d %s, want %d USD", tt.factor, got.Amount, got.Currency, tt.want)
+			}
+		})
+	}
+
+	if got := New(999, "USD").Percent(15); got.Amount != 150 {
+		t.Errorf("Percent(15) of 9.99 = %d, want 150", got.Amount)
+	}
+}
+
+func TestConvert(t *testing.T) {
+	tests := []struct {
+		name     string
+		money    Money
+		rate     float64
+		currency string
+		want     int64
+	}{
+		{name: "same exponent", money: New(1000, "USD"), rate: 0.9, currency: "EUR", want: 900},
+		{name: "into a currency without decimals", money: New(1000, "USD"), rate: 150.55, currency: "JPY", want: 1506},
+		{name: "from a currency without decimals", money: New(1500, "JPY"), rate: 0.0067, currency: "USD", want: 1005},
+		{name: "into a currency with three decimals", money: New(1000, "USD"), rate: 0.3075, currency: "KWD", want: 3075},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.money.Convert(tt.rate, tt.currency)
+			if got.Amount != tt.want || got.Currency != tt.currency {
+				t.Errorf("Convert() = %d %s, want %d %s", got.Amount, got.Currency, tt.want, tt.currency)
+			}
+		})
+	}
+}
+
+func TestCurrencyMismatch(t *testing.T) {
+	usd, eur := New(1000, "USD"), New(500, "EUR")
+
+	operations := []struct {
+		name string
+		run  func(a, b Money) error
+	}{
+		{name: "Add", run: func(a, b Money) error { _, err := a.Add(b); return err }},
+		{name: "Sub", run: func(a, b Money) error { _, err := a.Sub(b); return err }},
+		{name: "Compare", run: func(a, b Money) error { _, err := a.Compare(b); return err }},
+		{name: "Min", run: func(a, b Money) error { _, err := Min(a, b); return err }},
+		{name: "Max", run: func(a, b Money) error { _, err := Max(a, b); return err }},
+		{name: "Sum", run: func(a, b Money) error { _, err := Sum(a, b); return err }},
+	}
+
+	tests := []struct {
+		name    string
+		a, b    Money
+		wantErr bool
+	}{
+		{name: "same currency", a: usd, b: New(250, "USD")},
+		{name: "different currencies", a: usd, b: eur, wantErr: true},
+		{name: "zero without a currency", a: usd, b: Money{}},
+		{name: "amount without a currency", a: usd, b: Money{Amount: 1}, wantErr: true},
+		{name: "zero in another currency", a: usd, b: Zero("EUR"), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		for _, op := range operations {
+			err := op.run(tt.a, tt.b)
+			if tt.wantErr != (err != nil) || tt.wantErr && !errors.Is(err, ErrCurrencyMismatch) {
+				t.Errorf("%s: %s() error = %v, want mismatch %v", tt.name, op.name, err, tt.wantErr)
+			}
+		}
+		if got := tt.a.SameCurrency(tt.b); got == tt.wantErr {
+			t.Errorf("%s: SameCurrency() = %v, want %v", tt.name, got, !tt.wantErr)
+		}
+	}
+
+	// A zero amount without a currency takes the other's currency
+	if sum, _ := (Money{}).Add(usd); sum.Currency != "USD" || sum.Amount != 1000 {
+		t.Errorf("zero Add() = %d %s, want 1000 USD", sum.Amount, sum.Currency)
+	}
+}
+
+func TestMinMax(t *testing.T) {
+	tests := []struct {
+		a, b    int64
+		wantMin int64
+		wantMax int64
+	}{
+		{a: 100, b: 200, wantMin: 100, wantMax: 200},
+		{a: 200, b: 100, wantMin: 100, wantMax: 200},
+		{a: -300, b: 100, wantMin: -300, wantMax: 100},
+		{a: 150, b: 150, wantMin: 150, wantMax: 150},
+	}
+
+	for _, tt := range tests {
+		a, b := New(tt.a, "USD"), New(tt.b, "USD")
+		if got, err := Min(a, b); err != nil || got.Amount != tt.wantMin {
+			t.Errorf("Min(%d, %d) = %d, %v; want %d", tt.a, tt.b, got.Amount, err, tt.wantMin)
+		}
+		if got, err := Max(a, b); err != nil || got.Amount != tt.wantMax {
+			t.Errorf("Max(%d, %d) = %d, %v; want %d", tt.a, tt.b, got.Amount, err, tt.wantMax)
+		}
+		if got, _ := a.Compare(b); got != compareInts(tt.a, tt.b) {
+			t.Errorf("Compare(%d, %d) = %d, want %d", tt.a, tt.b, got, compareInts(tt.a, tt.b))
+		}
+	}
+}
+
+func TestAllocate(t *testing.T) {
+	tests := []struct {
+		name    string
+		amount  int64
+		ratios  []float64
+		want    []int64
+		wantErr bool
+	}{
+		{name: "even split hands the remainder to the first share", amount: 100, ratios: []float64{1, 1, 1}, want: []int64{34, 33, 33}},
+		{name: "remainder goes to the largest loss", amount: 100, ratios: []float64{1, 2}, want: []int64{33, 67}},
+		{name: "weighted split", amount: 1000, ratios: []float64{0.5, 0.3, 0.2}, want: []int64{500, 300, 200}},
+		{name: "zero ratio gets nothing", amount: 5, ratios: []float64{1, 0, 1}, want: []int64{3, 0, 2}},
+		{name: "single unit", amount: 1, ratios: []float64{1, 1, 1}, want: []int64{1, 0, 0}},
+		{name: "negative amount rounds like a positive one", amount: -100, ratios: []float64{1, 1, 1}, want: []int64{-34, -33, -33}},
+		{name: "zero amount", amount: 0, ratios: []float64{3, 1}, want: []int64{0, 0}},
+		{name: "no ratios", amount: 100, wantErr: true},
+		{name: "negative ratio", amount: 100, ratios: []float64{1, -1}, wantErr: true},
+		{name: "all ratios zero", amount: 100, ratios: []float64{0, 0}, wantErr: true},
+		{name: "ratio not a number", amount: 100, ratios: []float64{1, math.NaN()}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			shares, err := New(tt.amount, "USD").Allocate(tt.ratios...)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Allocate() error = %v, want error %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			if len(shares) != len(tt.want) {
+				t.Fatalf("Allocate() = %d shares, want %d", len(shares), len(tt.want))
+			}
+			for i, share := range shares {
+				if share.Amount != tt.want[i] || share.Currency != "USD" {
+					t.Errorf("share %d = %d %s, want %d USD", i, share.Amount, share.Currency, tt.want[i])
+				}
+			}
+			if total, _ := Sum(shares...); total.Amount != tt.amount {
+				t.Errorf("shares sum to %d, want %d", total.Amount, tt.amount)
+			}
+		})
+	}
+}
+
+// TestAllocateSums checks shares sum to the amount for ratios whose float
+// shares do not add up exactly.
+func TestAllocateSums(t *testing.T) {
+	ratios := []float64{0.1, 0.2, 0.3, 0.15, 0.25, 1.0 / 3, 2.0 / 7}
+	for _, amount := range []int64{1, 7, 99, 1001, 123456789, -987654321} {
+		shares, err := New(amount, "USD").Allocate(ratios...)
+		if err != nil {
+			t.Fatalf("Allocate(%d) error = %v", amount, err)
+		}
+		if total, _ := Sum(shares...); total.Amount != amount {
+			t.Errorf("Allocate(%d) shares sum to %d", amount, total.Amount)
+		}
+	}
+}
+
+func TestSplit(t *testing.T) {
+	shares, err := New(1000, "USD").Split(3)
+	if err != nil {
+		t.Fatalf("Split() error = %v", err)
+	}
+	want := []int64{334, 333, 333}
+	for i, share := range shares {
+		if share.Amount != want[i] {
+			t.Errorf("share %d = %d, want %d", i, share.Amount, want[i])
+		}
+	}
+
+	if _, err := New(1000, "USD").Split(0); err == nil {
+		t.Error("Split(0) succeeded, want an error")
+	}
+}
+
+func compareInts(a, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,108 @@
+package payment
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"time"
+)
+
+var unsafePayoutChars = regexp.MustCompile(`[^A-Za-z0-9_-]+`)
+
+// FilePayoutProvider stands in for a bank payout API in development and
+// tests. Each payout is written to a JSON file named after its ID; editing the
+// status in the file to paid, failed or returned plays the bank's answer.
+type FilePayoutProvider struct {
+	basePath string
+	mu       sync.Mutex
+}
+
+func NewFilePayoutProvider(basePath string) (*FilePayoutProvider, error) {
+	// Create base directory if it doesn't exist
+	if err := os.MkdirAll(basePath, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create payout directory: %w", err)
+	}
+
+	return &FilePayoutProvider{
+		basePath: basePath,
+	}, nil
+}
+
+func (f *FilePayoutProvider) CreatePayout(ctx context.Context, request *PayoutRequest) (*PayoutResponse, error) {
+	if request.Reference == "" {
+		return nil, fmt.Errorf("payout reference is required")
+	}
+	if !request.Amount.IsPositive() {
+		return nil, fmt.Errorf("payout amount must be positive")
+	}
+	if request.Destination == nil || request.Destination.AccountNumber == "" {
+		return nil, fmt.Errorf("payout destination is required")
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	payoutID := "po_" + unsafePayoutChars.ReplaceAllString(request.Reference, "_")
+
+	// A retried request gets the payout already written
+	if existing, err := f.read(payoutID); err == nil {
+		return existing, nil
+	}
+
+	record := &filePayout{
+		PayoutResponse: PayoutResponse{
+			PayoutID:  payoutID,
+			Reference: request.Reference,
+			Status:    PayoutStatusPending,
+			Amount:    request.Amount,
+			CreatedAt: time.Now().Unix(),
+		},
+		Request: request,
+	}
+
+	data, err := json.MarshalIndent(record, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode payout: %w", err)
+	}
+	if err := os.WriteFile(f.path(payoutID), data, 0644); err != nil {
+		return nil, fmt.Errorf("failed to write payout: %w", err)
+	}
+
+	return &record.PayoutResponse, nil
+}
+
+func (f *FilePayoutProvider) GetPayout(ctx context.Context, payoutID string) (*PayoutResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.read(payoutID)
+}
+
+// filePayout is the file layout: the provider's view of the payout and the
+// request that created it.
+type filePayout struct {
+	PayoutResponse
+	Request *PayoutRequest `json:"request"`
+}
+
+func (f *FilePayoutProvider) read(payoutID string) (*PayoutResponse, error) {
+	data, err := os.ReadFile(f.path(payoutID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read payout: %w", err)
+	}
+
+	var record filePayout
+	if err := json.Unmarshal(data, &record); err != nil {
+		return nil, fmt.Errorf("failed to decode payout: %w", err)
+	}
+
+	return &record.PayoutResponse, nil
+}
+
+func (f *FilePayoutProvider) path(payoutID string) string {
+	return filepath.Join(f.basePath, unsafePayoutChars.ReplaceAllString(payoutID, "_")+".json")
+}
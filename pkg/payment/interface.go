@@ -2,48 +2,117 @@ package payment
 
 import (
 	"context"
+	"errors"
+	"net/http"
+
+	"goride/pkg/money"
 )
 
+var (
+	// ErrIncrementNotSupported is returned by providers that cannot raise an
+	// existing hold; the caller captures the hold and charges the difference.
+	ErrIncrementNotSupported = errors.New("incremental authorization not supported")
+
+	// ErrPaymentNotFound is returned by GetPayment when the provider has no
+	// payment for the lookup, so the charge never reached it.
+	ErrPaymentNotFound = errors.New("payment not found at provider")
+
+	// ErrAuthorizationClosed is returned by Capture when the authorization was
+	// already captured or voided, as when a capture whose answer was lost is
+	// sent again. GetPayment with the authorization ID tells which.
+	ErrAuthorizationClosed = errors.New("authorization already captured or voided")
+)
+
+// PaymentProvider charges riders. ProcessPayment charges at once; Authorize
+// places a hold that is later captured for at most the held amount, raised
+// with IncrementAuthorization or released with Void. Charges and refunds
+// carrying an idempotency key are made once however often they are sent, and
+// GetPayment finds a charge by its key when its answer was lost, or what
+// became of a hold by its authorization ID.
+// ValidateWebhook verifies a webhook request's signature before parsing it;
+// ParseWebhook parses an event already verified, so stored events can be
+// processed again.
 type PaymentProvider interface {
 	ProcessPayment(ctx context.Context, request *PaymentRequest) (*PaymentResponse, error)
+	GetPayment(ctx context.Context, request *PaymentLookupRequest) (*PaymentResponse, error)
+	Authorize(ctx context.Context, request *PaymentRequest) (*AuthorizationResponse, error)
+	Capture(ctx context.Context, request *CaptureRequest) (*PaymentResponse, error)
+	Void(ctx context.Context, authorizationID string) (*AuthorizationResponse, error)
+	IncrementAuthorization(ctx context.Context, request *IncrementAuthorizationRequest) (*AuthorizationResponse, error)
 	RefundPayment(ctx context.Context, request *RefundRequest) (*RefundResponse, error)
 	CreatePaymentMethod(ctx context.Context, request *PaymentMethodRequest) (*PaymentMethodResponse, error)
 	DeletePaymentMethod(ctx context.Context, paymentMethodID string) error
 	GetPaymentMethod(ctx context.Context, paymentMethodID string) (*PaymentMethodResponse, error)
-	ValidateWebhook(ctx context.Context, payload []byte, signature string) (*WebhookEvent, error)
+	ValidateWebhook(ctx context.Context, payload []byte, header http.Header) (*WebhookEvent, error)
+	ParseWebhook(payload []byte) (*WebhookEvent, error)
 }
 
 type PaymentRequest struct {
 	PaymentMethodID string                 `json:"payment_method_id"`
-	Amount          float64                `json:"amount"`
-	Currency        string                 `json:"currency"`
+	Amount          money.Money            `json:"amount"`
 	Description     string                 `json:"description"`
 	CustomerID      string                 `json:"customer_id"`
+	IdempotencyKey  string                 `json:"idempotency_key"`
 	Metadata        map[string]interface{} `json:"metadata"`
 }
 
+// PaymentLookupRequest finds a charge by its transaction ID or, when the
+// charge was never answered, by the idempotency key it was sent with. With an
+// authorization ID it finds the capture of that hold instead; a hold that was
+// voided or lapsed is reported with AuthorizationStatusVoided.
+type PaymentLookupRequest struct {
+	TransactionID   string `json:"transaction_id"`
+	IdempotencyKey  string `json:"idempotency_key"`
+	AuthorizationID string `json:"authorization_id"`
+	CreatedAt       int64  `json:"created_at"` // when the charge was sent, to narrow searches
+}
+
 type PaymentResponse struct {
 	TransactionID string                 `json:"transaction_id"`
 	Status        string                 `json:"status"`
-	Amount        float64                `json:"amount"`
-	Currency      string                 `json:"currency"`
-	Fees          float64                `json:"fees"`
+	Amount        money.Money            `json:"amount"`
+	Fees          money.Money            `json:"fees"`
 	CreatedAt     int64                  `json:"created_at"`
 	Metadata      map[string]interface{} `json:"metadata"`
 }
 
+// Authorization statuses reported by providers
+const (
+	AuthorizationStatusAuthorized = "authorized"
+	AuthorizationStatusCaptured   = "captured"
+	AuthorizationStatusVoided     = "voided"
+	AuthorizationStatusFailed     = "failed"
+)
+
+type AuthorizationResponse struct {
+	AuthorizationID string      `json:"authorization_id"` // may change when the hold is raised
+	Status          string      `json:"status"`
+	Amount          money.Money `json:"amount"` // held and still capturable
+	CreatedAt       int64       `json:"created_at"`
+}
+
+type CaptureRequest struct {
+	AuthorizationID string      `json:"authorization_id"`
+	Amount          money.Money `json:"amount"` // at most the held amount; zero captures all of it
+}
+
+type IncrementAuthorizationRequest struct {
+	AuthorizationID string      `json:"authorization_id"`
+	Amount          money.Money `json:"amount"` // new total to hold, not the increase
+}
+
 type RefundRequest struct {
-	TransactionID string  `json:"transaction_id"`
-	Amount        float64 `json:"amount"`
-	Reason        string  `json:"reason"`
+	TransactionID  string      `json:"transaction_id"`
+	Amount         money.Money `json:"amount"` // zero refunds the full payment
+	Reason         string      `json:"reason"`
+	IdempotencyKey string      `json:"idempotency_key"`
 }
 
 type RefundResponse struct {
-	RefundID  string  `json:"refund_id"`
-	Status    string  `json:"status"`
-	Amount    float64 `json:"amount"`
-	Currency  string  `json:"currency"`
-	CreatedAt int64   `json:"created_at"`
+	RefundID  string      `json:"refund_id"`
+	Status    string      `json:"status"`
+	Amount    money.Money `json:"amount"`
+	CreatedAt int64       `json:"created_at"`
 }
 
 type PaymentMethodRequest struct {
@@ -72,9 +141,71 @@ type BillingAddress struct {
 	Country    string `json:"country"`
 }
 
+// WebhookAction is what a provider event means for one of our payments.
+type WebhookAction string
+
+const (
+	WebhookActionNone             WebhookAction = ""
+	WebhookActionPaymentSucceeded WebhookAction = "payment_succeeded"
+	WebhookActionPaymentFailed    WebhookAction = "payment_failed"
+	WebhookActionPaymentRefunded  WebhookAction = "payment_refunded"
+	WebhookActionDisputeOpened    WebhookAction = "dispute_opened"
+)
+
+// WebhookEvent is a provider event. Events about payments carry the IDs the
+// payment may be stored under, since an order, its payment and its capture
+// have IDs of their own. Amount is the total refunded for refunds and the
+// amount disputed for disputes.
 type WebhookEvent struct {
-	EventID   string                 `json:"event_id"`
-	EventType string                 `json:"event_type"`
-	Data      map[string]interface{} `json:"data"`
-	CreatedAt int64                  `json:"created_at"`
+	EventID        string                 `json:"event_id"`
+	EventType      string                 `json:"event_type"`
+	Action         WebhookAction          `json:"action"`
+	TransactionIDs []string               `json:"transaction_ids"`
+	IdempotencyKey string                 `json:"idempotency_key"`
+	ObjectID       string                 `json:"object_id"` // refund or dispute
+	Amount         money.Money            `json:"amount"`
+	Reason         string                 `json:"reason"`
+	Data           map[string]interface{} `json:"data"`
+	CreatedAt      int64                  `json:"created_at"`
+}
+
+// PayoutProvider sends money to a bank account. Requests carry a reference
+// the provider uses to send each payout once, however often it is retried.
+type PayoutProvider interface {
+	CreatePayout(ctx context.Context, request *PayoutRequest) (*PayoutResponse, error)
+	GetPayout(ctx context.Context, payoutID string) (*PayoutResponse, error)
+}
+
+// Payout statuses reported by providers
+const (
+	PayoutStatusPending  = "pending"
+	PayoutStatusPaid     = "paid"
+	PayoutStatusFailed   = "failed"
+	PayoutStatusReturned = "returned" // the receiving bank sent it back
+)
+
+type PayoutRequest struct {
+	Reference   string                 `json:"reference"`
+	Amount      money.Money            `json:"amount"`
+	Instant     bool                   `json:"instant"`
+	Destination *BankDestination       `json:"destination"`
+	Description string                 `json:"description"`
+	Metadata    map[string]interface{} `json:"metadata"`
+}
+
+type BankDestination struct {
+	AccountNumber string `json:"account_number"`
+	RoutingNumber string `json:"routing_number"`
+	AccountName   string `json:"account_name"`
+	BankName      string `json:"bank_name"`
+	AccountType   string `json:"account_type"`
+}
+
+type PayoutResponse struct {
+	PayoutID      string      `json:"payout_id"`
+	Reference     string      `json:"reference"`
+	Status        string      `json:"status"`
+	Amount        money.Money `json:"amount"`
+	FailureReason string      `json:"failure_reason"`
+	CreatedAt     int64       `json:"created_at"`
 }
@@ -4,16 +4,22 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
+	"path"
 	"strings"
 	"time"
+
+	"goride/pkg/money"
 )
 
 type PayPalProvider struct {
 	clientID     string
 	clientSecret string
+	webhookID    string
 	baseURL      string
 	httpClient   *http.Client
 }
@@ -35,6 +41,7 @@ type PayPalPurchaseUnit struct {
 	Amount      PayPalAmount `json:"amount"`
 	Description string       `json:"description"`
 	ReferenceID string       `json:"reference_id"`
+	CustomID    string       `json:"custom_id,omitempty"` // idempotency key, found again by GetPayment
 }
 
 type PayPalAmount struct {
@@ -58,7 +65,7 @@ type PayPalApplicationContext struct {
 	CancelURL string `json:"cancel_url"`
 }
 
-func NewPayPalProvider(clientID, clientSecret, mode string) *PayPalProvider {
+func NewPayPalProvider(clientID, clientSecret, mode, webhookID string) *PayPalProvider {
 	baseURL := "https://api.sandbox.paypal.com"
 	if mode == "live" {
 		baseURL = "https://api.paypal.com"
@@ -67,6 +74,7 @@ func NewPayPalProvider(clientID, clientSecret, mode string) *PayPalProvider {
 	return &PayPalProvider{
 		clientID:     clientID,
 		clientSecret: clientSecret,
+		webhookID:    webhookID,
 		baseURL:      baseURL,
 		httpClient:   &http.Client{Timeout: 30 * time.Second},
 	}
@@ -83,11 +91,12 @@ func (p *PayPalProvider) ProcessPayment(ctx context.Context, request *PaymentReq
 		PurchaseUnits: []PayPalPurchaseUnit{
 			{
 				Amount: PayPalAmount{
-					CurrencyCode: strings.ToUpper(request.Currency),
-					Value:        fmt.Sprintf("%.2f", request.Amount),
+					CurrencyCode: strings.ToUpper(request.Amount.Currency),
+					Value:        request.Amount.String(),
 				},
 				Description: request.Description,
 				ReferenceID: request.CustomerID,
+				CustomID:    request.IdempotencyKey,
 			},
 		},
 		PaymentSource: PayPalPaymentSource{
@@ -97,104 +106,238 @@ func (p *PayPalProvider) ProcessPayment(ctx context.Context, request *PaymentReq
 		},
 	}
 
-	reqBody, err := json.Marshal(paypalRequest)
+	// A repeated PayPal-Request-Id returns the order already created
+	result, err := p.do(ctx, token, http.MethodPost, "/v2/checkout/orders", request.IdempotencyKey, paypalRequest)
 	if err != nil {
-		return nil, fmt.Errorf("failed to marshal request: %w", err)
+		return nil, err
 	}
 
-	req, err := http.NewRequestWithContext(ctx, "POST", p.baseURL+"/v2/checkout/orders", bytes.NewBuffer(reqBody))
+	orderID, _ := result["id"].(string)
+	status, _ := result["status"].(string)
+
+	return &PaymentResponse{
+		TransactionID: orderID,
+		Status:        status,
+		Amount:        request.Amount,
+		CreatedAt:     time.Now().Unix(),
+	}, nil
+}
+
+// GetPayment fetches an order by ID. Without one it searches the
+// transactions reported around the time the charge was sent for the
+// idempotency key, kept as the custom ID. PayPal reports transactions with a
+// delay of up to a few hours, so a recent charge may not be found yet.
+func (p *PayPalProvider) GetPayment(ctx context.Context, request *PaymentLookupRequest) (*PaymentResponse, error) {
+	token, err := p.getAccessToken(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
+		return nil, fmt.Errorf("failed to get access token: %w", err)
 	}
 
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+token)
+	if request.AuthorizationID != "" {
+		return p.authorizationCapture(ctx, token, request.AuthorizationID)
+	}
 
-	resp, err := p.httpClient.Do(req)
+	if request.TransactionID != "" {
+		order, err := p.do(ctx, token, http.MethodGet, "/v2/checkout/orders/"+request.TransactionID, "", nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get order: %w", err)
+		}
+
+		orderID, _ := order["id"].(string)
+		status, _ := order["status"].(string)
+		response := &PaymentResponse{
+			TransactionID: orderID,
+			Status:        status,
+			CreatedAt:     time.Now().Unix(),
+		}
+		if units, _ := order["purchase_units"].([]interface{}); len(units) > 0 {
+			unit, _ := units[0].(map[string]interface{})
+			response.Amount = refundedAmount(unit, money.Money{})
+		}
+		return response, nil
+	}
+
+	if request.IdempotencyKey == "" {
+		return nil, fmt.Errorf("transaction ID or idempotency key is required")
+	}
+
+	sentAt := time.Unix(request.CreatedAt, 0)
+	until := sentAt.Add(24 * time.Hour)
+	if now := time.Now(); until.After(now) {
+		until = now
+	}
+	query := url.Values{}
+	query.Set("start_date", sentAt.Add(-time.Hour).UTC().Format(time.RFC3339))
+	query.Set("end_date", until.UTC().Format(time.RFC3339))
+	query.Set("fields", "transaction_info")
+	query.Set("page_size", "500")
+
+	result, err := p.do(ctx, token, http.MethodGet, "/v1/reporting/transactions?"+query.Encode(), "", nil)
 	if err != nil {
-		return nil, fmt.Errorf("failed to execute request: %w", err)
+		return nil, fmt.Errorf("failed to search transactions: %w", err)
 	}
-	defer resp.Body.Close()
 
-	body, err := io.ReadAll(resp.Body)
+	details, _ := result["transaction_details"].([]interface{})
+	for _, detail := range details {
+		entry, _ := detail.(map[string]interface{})
+		info, _ := entry["transaction_info"].(map[string]interface{})
+		if customID, _ := info["custom_field"].(string); customID != request.IdempotencyKey {
+			continue
+		}
+
+		transactionID, _ := info["transaction_id"].(string)
+		status, _ := info["transaction_status"].(string)
+		amount, _ := info["transaction_amount"].(map[string]interface{})
+		return &PaymentResponse{
+			TransactionID: transactionID,
+			Status:        paypalTransactionStatus(status),
+			Amount:        refundedAmount(map[string]interface{}{"amount": amount}, money.Money{}),
+			CreatedAt:     time.Now().Unix(),
+		}, nil
+	}
+
+	return nil, ErrPaymentNotFound
+}
+
+// Authorize creates an order with the AUTHORIZE intent and authorizes it. The
+// authorization, not the order, is what is later captured or voided.
+func (p *PayPalProvider) Authorize(ctx context.Context, request *PaymentRequest) (*AuthorizationResponse, error) {
+	token, err := p.getAccessToken(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read response: %w", err)
+		return nil, fmt.Errorf("failed to get access token: %w", err)
 	}
 
-	if resp.StatusCode != http.StatusCreated {
-		return nil, fmt.Errorf("PayPal API error: %s", string(body))
+	order, err := p.do(ctx, token, http.MethodPost, "/v2/checkout/orders", request.IdempotencyKey, PayPalPaymentRequest{
+		Intent: "AUTHORIZE",
+		PurchaseUnits: []PayPalPurchaseUnit{
+			{
+				Amount:      paypalAmount(request.Amount),
+				Description: request.Description,
+				ReferenceID: request.CustomerID,
+				CustomID:    request.IdempotencyKey,
+			},
+		},
+		PaymentSource: PayPalPaymentSource{
+			Card: PayPalCard{
+				Number: request.PaymentMethodID, // This would be tokenized in real implementation
+			},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create order: %w", err)
 	}
 
-	var result map[string]interface{}
-	err = json.Unmarshal(body, &result)
+	orderID, _ := order["id"].(string)
+	authorized, err := p.do(ctx, token, http.MethodPost, fmt.Sprintf("/v2/checkout/orders/%s/authorize", orderID), request.IdempotencyKey, map[string]interface{}{})
 	if err != nil {
-		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+		return nil, fmt.Errorf("failed to authorize order: %w", err)
+	}
+
+	authorization := paypalOrderAuthorization(authorized)
+	if authorization == nil {
+		return nil, fmt.Errorf("PayPal order %s returned no authorization", orderID)
+	}
+
+	return paypalAuthorization(authorization, request.Amount), nil
+}
+
+func (p *PayPalProvider) Capture(ctx context.Context, request *CaptureRequest) (*PaymentResponse, error) {
+	token, err := p.getAccessToken(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get access token: %w", err)
+	}
+
+	captureRequest := map[string]interface{}{
+		"final_capture": true,
+	}
+	// Without an amount PayPal captures the full authorization
+	if request.Amount.IsPositive() {
+		captureRequest["amount"] = paypalAmount(request.Amount)
 	}
 
+	result, err := p.do(ctx, token, http.MethodPost, fmt.Sprintf("/v2/payments/authorizations/%s/capture", request.AuthorizationID), "", captureRequest)
+	if err != nil {
+		var providerErr *ProviderError
+		if errors.As(err, &providerErr) && paypalAuthorizationClosed(providerErr.Body) {
+			return nil, fmt.Errorf("failed to capture authorization: %w: %v", ErrAuthorizationClosed, err)
+		}
+		return nil, fmt.Errorf("failed to capture authorization: %w", err)
+	}
+
+	captureID, _ := result["id"].(string)
+	status, _ := result["status"].(string)
+
 	return &PaymentResponse{
-		TransactionID: result["id"].(string),
-		Status:        result["status"].(string),
-		Amount:        request.Amount,
-		Currency:      request.Currency,
+		TransactionID: captureID, // refunds are made against the capture
+		Status:        status,
+		Amount:        refundedAmount(result, request.Amount),
 		CreatedAt:     time.Now().Unix(),
 	}, nil
 }
 
-func (p *PayPalProvider) RefundPayment(ctx context.Context, request *RefundRequest) (*RefundResponse, error) {
+func (p *PayPalProvider) Void(ctx context.Context, authorizationID string) (*AuthorizationResponse, error) {
 	token, err := p.getAccessToken(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get access token: %w", err)
 	}
 
-	refundRequest := map[string]interface{}{
-		"amount": map[string]string{
-			"value":         fmt.Sprintf("%.2f", request.Amount),
-			"currency_code": "USD", // Should be dynamic
-		},
-		"note_to_payer": request.Reason,
+	if _, err := p.do(ctx, token, http.MethodPost, fmt.Sprintf("/v2/payments/authorizations/%s/void", authorizationID), "", nil); err != nil {
+		return nil, fmt.Errorf("failed to void authorization: %w", err)
 	}
 
-	reqBody, err := json.Marshal(refundRequest)
+	return &AuthorizationResponse{
+		AuthorizationID: authorizationID,
+		Status:          AuthorizationStatusVoided,
+		CreatedAt:       time.Now().Unix(),
+	}, nil
+}
+
+// IncrementAuthorization reauthorizes for the new total. PayPal answers with a
+// new authorization, whose ID replaces the old one for capture and void.
+func (p *PayPalProvider) IncrementAuthorization(ctx context.Context, request *IncrementAuthorizationRequest) (*AuthorizationResponse, error) {
+	token, err := p.getAccessToken(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("failed to marshal request: %w", err)
+		return nil, fmt.Errorf("failed to get access token: %w", err)
 	}
 
-	req, err := http.NewRequestWithContext(ctx, "POST", 
-		fmt.Sprintf("%s/v2/payments/captures/%s/refund", p.baseURL, request.TransactionID), 
-		bytes.NewBuffer(reqBody))
+	result, err := p.do(ctx, token, http.MethodPost, fmt.Sprintf("/v2/payments/authorizations/%s/reauthorize", request.AuthorizationID), "", map[string]interface{}{
+		"amount": paypalAmount(request.Amount),
+	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
+		return nil, fmt.Errorf("failed to reauthorize: %w", err)
 	}
 
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+token)
+	return paypalAuthorization(result, request.Amount), nil
+}
 
-	resp, err := p.httpClient.Do(req)
+func (p *PayPalProvider) RefundPayment(ctx context.Context, request *RefundRequest) (*RefundResponse, error) {
+	token, err := p.getAccessToken(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("failed to execute request: %w", err)
+		return nil, fmt.Errorf("failed to get access token: %w", err)
 	}
-	defer resp.Body.Close()
 
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read response: %w", err)
+	refundRequest := map[string]interface{}{
+		"note_to_payer": request.Reason,
 	}
-
-	if resp.StatusCode != http.StatusCreated {
-		return nil, fmt.Errorf("PayPal API error: %s", string(body))
+	// Without an amount PayPal refunds the full capture
+	if request.Amount.IsPositive() {
+		refundRequest["amount"] = map[string]string{
+			"value":         request.Amount.String(),
+			"currency_code": strings.ToUpper(request.Amount.Currency),
+		}
 	}
 
-	var result map[string]interface{}
-	err = json.Unmarshal(body, &result)
+	result, err := p.do(ctx, token, http.MethodPost,
+		fmt.Sprintf("/v2/payments/captures/%s/refund", request.TransactionID),
+		request.IdempotencyKey, refundRequest)
 	if err != nil {
-		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+		return nil, err
 	}
 
 	return &RefundResponse{
 		RefundID:  result["id"].(string),
 		Status:    result["status"].(string),
-		Amount:    request.Amount,
-		Currency:  "USD", // Should be dynamic
+		Amount:    refundedAmount(result, request.Amount),
 		CreatedAt: time.Now().Unix(),
 	}, nil
 }
@@ -213,20 +356,86 @@ func (p *PayPalProvider) GetPaymentMethod(ctx context.Context, paymentMethodID s
 	return nil, fmt.Errorf("GetPaymentMethod not implemented for PayPal")
 }
 
-func (p *PayPalProvider) ValidateWebhook(ctx context.Context, payload []byte, signature string) (*WebhookEvent, error) {
-	// PayPal webhook validation implementation
-	var event map[string]interface{}
-	err := json.Unmarshal(payload, &event)
+// ValidateWebhook has PayPal verify the request's transmission signature
+// against the webhook configured for us.
+func (p *PayPalProvider) ValidateWebhook(ctx context.Context, payload []byte, header http.Header) (*WebhookEvent, error) {
+	token, err := p.getAccessToken(ctx)
 	if err != nil {
+		return nil, fmt.Errorf("failed to get access token: %w", err)
+	}
+
+	result, err := p.do(ctx, token, http.MethodPost, "/v1/notifications/verify-webhook-signature", "", map[string]interface{}{
+		"auth_algo":         header.Get("PAYPAL-AUTH-ALGO"),
+		"cert_url":          header.Get("PAYPAL-CERT-URL"),
+		"transmission_id":   header.Get("PAYPAL-TRANSMISSION-ID"),
+		"transmission_sig":  header.Get("PAYPAL-TRANSMISSION-SIG"),
+		"transmission_time": header.Get("PAYPAL-TRANSMISSION-TIME"),
+		"webhook_id":        p.webhookID,
+		"webhook_event":     json.RawMessage(payload),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to verify webhook signature: %w", err)
+	}
+	if status, _ := result["verification_status"].(string); status != "SUCCESS" {
+		return nil, fmt.Errorf("invalid webhook signature")
+	}
+
+	return p.ParseWebhook(payload)
+}
+
+// ParseWebhook reads capture outcomes, refunds and new disputes. Charges are
+// stored under their order and held payments under their capture; refunds
+// and disputes name the capture.
+func (p *PayPalProvider) ParseWebhook(payload []byte) (*WebhookEvent, error) {
+	var event map[string]interface{}
+	if err := json.Unmarshal(payload, &event); err != nil {
 		return nil, fmt.Errorf("failed to unmarshal webhook payload: %w", err)
 	}
 
-	return &WebhookEvent{
-		EventID:   event["id"].(string),
-		EventType: event["event_type"].(string),
+	result := &WebhookEvent{
+		EventID:   webhookString(event, "id"),
+		EventType: webhookString(event, "event_type"),
 		Data:      event,
-		CreatedAt: time.Now().Unix(),
-	}, nil
+	}
+	if result.EventID == "" {
+		return nil, fmt.Errorf("webhook event has no ID")
+	}
+	if created, err := time.Parse(time.RFC3339, webhookString(event, "create_time")); err == nil {
+		result.CreatedAt = created.Unix()
+	}
+
+	resource := webhookObject(event, "resource")
+	orderID := webhookString(resource, "supplementary_data", "related_ids", "order_id")
+	switch result.EventType {
+	case "PAYMENT.CAPTURE.COMPLETED", "PAYMENT.CAPTURE.DENIED", "PAYMENT.CAPTURE.DECLINED":
+		result.Action = WebhookActionPaymentSucceeded
+		if result.EventType != "PAYMENT.CAPTURE.COMPLETED" {
+			result.Action = WebhookActionPaymentFailed
+			result.Reason = webhookString(resource, "status_details", "reason")
+		}
+		result.TransactionIDs = webhookIDs(orderID, webhookString(resource, "id"))
+		result.IdempotencyKey = webhookString(resource, "custom_id")
+		result.Amount = paypalMoney(webhookObject(resource, "amount"))
+	case "PAYMENT.CAPTURE.REFUNDED":
+		// The resource is the refund, linked up to its capture
+		result.Action = WebhookActionPaymentRefunded
+		result.TransactionIDs = webhookIDs(orderID, paypalLinkedID(resource, "up"))
+		result.ObjectID = webhookString(resource, "id")
+		result.Amount = paypalMoney(webhookObject(resource, "seller_payable_breakdown", "total_refunded_amount"))
+	case "CUSTOMER.DISPUTE.CREATED":
+		var captureID string
+		if transactions, _ := resource["disputed_transactions"].([]interface{}); len(transactions) > 0 {
+			transaction, _ := transactions[0].(map[string]interface{})
+			captureID = webhookString(transaction, "seller_transaction_id")
+		}
+		result.Action = WebhookActionDisputeOpened
+		result.TransactionIDs = webhookIDs(captureID)
+		result.ObjectID = webhookString(resource, "dispute_id")
+		result.Amount = paypalMoney(webhookObject(resource, "dispute_amount"))
+		result.Reason = webhookString(resource, "reason")
+	}
+
+	return result, nil
 }
 
 func (p *PayPalProvider) getAccessToken(ctx context.Context) (string, error) {
@@ -253,3 +462,219 @@ func (p *PayPalProvider) getAccessToken(ctx context.Context) (string, error) {
 
 	return tokenResp.AccessToken, nil
 }
+
+// do sends a JSON request to the PayPal API and decodes the response, which
+// is empty for calls answered with 204 No Content. A request ID makes PayPal
+// answer a repeated request with the outcome of the first.
+func (p *PayPalProvider) do(ctx context.Context, token, method, path, requestID string, payload interface{}) (map[string]interface{}, error) {
+	var reqBody io.Reader
+	if payload != nil {
+		data, err := json.Marshal(payload)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal request: %w", err)
+		}
+		reqBody = bytes.NewBuffer(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, p.baseURL+path, reqBody)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+	if requestID != "" {
+		req.Header.Set("PayPal-Request-Id", requestID)
+	}
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, &ProviderError{Provider: "PayPal", StatusCode: resp.StatusCode, Body: string(body)}
+	}
+
+	result := make(map[string]interface{})
+	if len(body) == 0 {
+		return result, nil
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+
+	return result, nil
+}
+
+// paypalTransactionStatus names the one-letter status of a reported
+// transaction.
+func paypalTransactionStatus(status string) string {
+	switch status {
+	case "S":
+		return "COMPLETED"
+	case "D":
+		return "DECLINED"
+	case "V":
+		return "REVERSED"
+	default:
+		return "PENDING"
+	}
+}
+
+func paypalAmount(amount money.Money) PayPalAmount {
+	return PayPalAmount{
+		CurrencyCode: strings.ToUpper(amount.Currency),
+		Value:        amount.String(),
+	}
+}
+
+// paypalMoney reads a PayPal amount object, zero when it has none.
+func paypalMoney(amount map[string]interface{}) money.Money {
+	value, _ := amount["value"].(string)
+	currency, _ := amount["currency_code"].(string)
+	parsed, err := money.Parse(value, currency)
+	if err != nil {
+		return money.Zero(currency)
+	}
+	return parsed
+}
+
+// paypalLinkedID is the ID at the end of a resource's link with the given
+// relation.
+func paypalLinkedID(resource map[string]interface{}, rel string) string {
+	links, _ := resource["links"].([]interface{})
+	for _, item := range links {
+		link, _ := item.(map[string]interface{})
+		if link["rel"] == rel {
+			href, _ := link["href"].(string)
+			return path.Base(href)
+		}
+	}
+	return ""
+}
+
+// paypalOrderAuthorization finds the authorization in an authorized order.
+func paypalOrderAuthorization(order map[string]interface{}) map[string]interface{} {
+	units, _ := order["purchase_units"].([]interface{})
+	if len(units) == 0 {
+		return nil
+	}
+	unit, _ := units[0].(map[string]interface{})
+	payments, _ := unit["payments"].(map[string]interface{})
+	authorizations, _ := payments["authorizations"].([]interface{})
+	if len(authorizations) == 0 {
+		return nil
+	}
+	authorization, _ := authorizations[0].(map[string]interface{})
+	return authorization
+}
+
+func paypalAuthorization(authorization map[string]interface{}, requested money.Money) *AuthorizationResponse {
+	id, _ := authorization["id"].(string)
+	status, _ := authorization["status"].(string)
+
+	response := &AuthorizationResponse{
+		AuthorizationID: id,
+		Status:          AuthorizationStatusFailed,
+		Amount:          refundedAmount(authorization, requested),
+		CreatedAt:       time.Now().Unix(),
+	}
+	switch strings.ToUpper(status) {
+	case "CREATED", "PENDING":
+		response.Status = AuthorizationStatusAuthorized
+	case "CAPTURED", "PARTIALLY_CAPTURED":
+		response.Status = AuthorizationStatusCaptured
+	case "VOIDED", "EXPIRED":
+		response.Status = AuthorizationStatusVoided
+	}
+
+	return response
+}
+
+// authorizationCapture reports what became of an authorization: the capture
+// made from it, found on its order, or a voided hold when it was voided or
+// lapsed.
+func (p *PayPalProvider) authorizationCapture(ctx context.Context, token, authorizationID string) (*PaymentResponse, error) {
+	authorization, err := p.do(ctx, token, http.MethodGet, "/v2/payments/authorizations/"+authorizationID, "", nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get authorization: %w", err)
+	}
+
+	status, _ := authorization["status"].(string)
+	if status != "CAPTURED" && status != "PARTIALLY_CAPTURED" {
+		switch status {
+		case "VOIDED", "EXPIRED", "DENIED":
+			status = AuthorizationStatusVoided
+		}
+		return &PaymentResponse{
+			TransactionID: authorizationID,
+			Status:        status,
+			Amount:        refundedAmount(authorization, money.Money{}),
+			CreatedAt:     time.Now().Unix(),
+		}, nil
+	}
+
+	supplementary, _ := authorization["supplementary_data"].(map[string]interface{})
+	related, _ := supplementary["related_ids"].(map[string]interface{})
+	orderID, _ := related["order_id"].(string)
+	order, err := p.do(ctx, token, http.MethodGet, "/v2/checkout/orders/"+orderID, "", nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get order: %w", err)
+	}
+
+	units, _ := order["purchase_units"].([]interface{})
+	for _, entry := range units {
+		unit, _ := entry.(map[string]interface{})
+		payments, _ := unit["payments"].(map[string]interface{})
+		captures, _ := payments["captures"].([]interface{})
+		if len(captures) == 0 {
+			continue
+		}
+
+		capture, _ := captures[0].(map[string]interface{})
+		captureID, _ := capture["id"].(string)
+		captureStatus, _ := capture["status"].(string)
+		return &PaymentResponse{
+			TransactionID: captureID, // refunds are made against the capture
+			Status:        captureStatus,
+			Amount:        refundedAmount(capture, money.Money{}),
+			CreatedAt:     time.Now().Unix(),
+		}, nil
+	}
+
+	return nil, ErrPaymentNotFound
+}
+
+// paypalAuthorizationClosed reports whether a capture was refused because the
+// authorization was already captured, voided or expired.
+func paypalAuthorizationClosed(body string) bool {
+	for _, issue := range []string{"AUTHORIZATION_ALREADY_CAPTURED", "AUTHORIZATION_VOIDED", "AUTHORIZATION_EXPIRED", "PREVIOUSLY_CAPTURED", "PREVIOUSLY_VOIDED"} {
+		if strings.Contains(body, issue) {
+			return true
+		}
+	}
+	return false
+}
+
+// refundedAmount reads the amount from a PayPal refund, capture or
+// authorization response, falling back to the requested amount when the response does not carry one.
+func refundedAmount(result map[string]interface{}, requested money.Money) money.Money {
+	amount, ok := result["amount"].(map[string]interface{})
+	if !ok {
+		return requested
+	}
+	value, _ := amount["value"].(string)
+	currency, _ := amount["currency_code"].(string)
+	refunded, err := money.Parse(value, currency)
+	if err != nil {
+		return requested
+	}
+	return refunded
+}
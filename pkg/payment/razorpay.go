@@ -7,8 +7,12 @@ import (
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"net/http"
+	"strings"
 	"time"
 
+	"goride/pkg/money"
+
 	"github.com/razorpay/razorpay-go"
 )
 
@@ -27,13 +31,17 @@ func NewRazorpayProvider(keyID, keySecret, webhookSecret string) *RazorpayProvid
 }
 
 func (r *RazorpayProvider) ProcessPayment(ctx context.Context, request *PaymentRequest) (*PaymentResponse, error) {
-	// Create order first
+	// Create order first. Razorpay has no idempotency keys, so the key is kept
+	// as the receipt for GetPayment to find the order by.
 	orderData := map[string]interface{}{
-		"amount":   int(request.Amount * 100), // Amount in paise
-		"currency": request.Currency,
+		"amount":   request.Amount.Amount, // Amount in paise
+		"currency": request.Amount.Currency,
 		"receipt":  request.CustomerID,
 		"notes":    request.Metadata,
 	}
+	if request.IdempotencyKey != "" {
+		orderData["receipt"] = request.IdempotencyKey
+	}
 
 	order, err := r.client.Order.Create(orderData, nil)
 	if err != nil {
@@ -42,24 +50,201 @@ func (r *RazorpayProvider) ProcessPayment(ctx context.Context, request *PaymentR
 
 	// Return order details - actual payment will be processed on frontend
 	// In Razorpay, payments are typically authorized on the frontend and then captured
+	return convertRazorpayOrder(order), nil
+}
+
+// GetPayment fetches an order or payment by ID, or finds the order created
+// with the idempotency key as its receipt.
+func (r *RazorpayProvider) GetPayment(ctx context.Context, request *PaymentLookupRequest) (*PaymentResponse, error) {
+	switch {
+	case request.AuthorizationID != "":
+		result, err := r.client.Payment.Fetch(request.AuthorizationID, nil, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch payment: %w", err)
+		}
+		status := razorpayString(result["status"])
+		if captured, _ := result["captured"].(bool); !captured && status != "authorized" {
+			// Uncaptured payments lapse and are refunded to the payer
+			status = AuthorizationStatusVoided
+		}
+		return &PaymentResponse{
+			TransactionID: razorpayString(result["id"]),
+			Status:        status,
+			Amount:        money.New(razorpayInt(result["amount"]), razorpayString(result["currency"])),
+			Fees:          money.New(razorpayInt(result["fee"]), razorpayString(result["currency"])),
+			CreatedAt:     razorpayInt(result["created_at"]),
+		}, nil
+	case strings.HasPrefix(request.TransactionID, "pay_"):
+		result, err := r.client.Payment.Fetch(request.TransactionID, nil, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch payment: %w", err)
+		}
+		return &PaymentResponse{
+			TransactionID: razorpayString(result["id"]),
+			Status:        razorpayString(result["status"]),
+			Amount:        money.New(razorpayInt(result["amount"]), razorpayString(result["currency"])),
+			Fees:          money.New(razorpayInt(result["fee"]), razorpayString(result["currency"])),
+			CreatedAt:     razorpayInt(result["created_at"]),
+		}, nil
+	case request.TransactionID != "":
+		order, err := r.client.Order.Fetch(request.TransactionID, nil, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch order: %w", err)
+		}
+		return convertRazorpayOrder(order), nil
+	case request.IdempotencyKey == "":
+		return nil, fmt.Errorf("transaction ID or idempotency key is required")
+	}
+
+	result, err := r.client.Order.All(map[string]interface{}{
+		"receipt": request.IdempotencyKey,
+	}, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list orders: %w", err)
+	}
+
+	items, _ := result["items"].([]interface{})
+	if len(items) == 0 {
+		return nil, ErrPaymentNotFound
+	}
+	order, _ := items[0].(map[string]interface{})
+
+	return convertRazorpayOrder(order), nil
+}
+
+// Authorize creates an order that is not captured automatically and charges
+// the saved token against it, which leaves the payment authorized. The
+// payment ID is the authorization ID.
+func (r *RazorpayProvider) Authorize(ctx context.Context, request *PaymentRequest) (*AuthorizationResponse, error) {
+	order, err := r.client.Order.Create(map[string]interface{}{
+		"amount":          request.Amount.Amount,
+		"currency":        request.Amount.Currency,
+		"receipt":         request.CustomerID,
+		"payment_capture": 0,
+		"notes":           request.Metadata,
+	}, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create order: %w", err)
+	}
+
+	paymentData := map[string]interface{}{
+		"order_id":    razorpayString(order["id"]),
+		"customer_id": request.CustomerID,
+		"token":       request.PaymentMethodID,
+		"amount":      request.Amount.Amount,
+		"currency":    request.Amount.Currency,
+		"recurring":   "1",
+		"description": request.Description,
+		"notes":       request.Metadata,
+	}
+	// Razorpay requires the payer's contact details on token payments
+	for _, key := range []string{"email", "contact"} {
+		if value, ok := request.Metadata[key]; ok {
+			paymentData[key] = value
+		}
+	}
+
+	result, err := r.client.Payment.CreateRecurringPayment(paymentData, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to authorize payment: %w", err)
+	}
+
+	paymentID := razorpayString(result["razorpay_payment_id"])
+	if paymentID == "" {
+		paymentID = razorpayString(result["id"])
+	}
+
+	return &AuthorizationResponse{
+		AuthorizationID: paymentID,
+		Status:          AuthorizationStatusAuthorized,
+		Amount:          request.Amount,
+		CreatedAt:       time.Now().Unix(),
+	}, nil
+}
+
+// Capture captures a Razorpay payment, which only accepts the full authorized
+// amount. A smaller capture is made by capturing it all and refunding the
+// difference straight away.
+func (r *RazorpayProvider) Capture(ctx context.Context, request *CaptureRequest) (*PaymentResponse, error) {
+	authorized, err := r.client.Payment.Fetch(request.AuthorizationID, nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch payment: %w", err)
+	}
+	if status := razorpayString(authorized["status"]); status != "authorized" {
+		return nil, fmt.Errorf("%w: payment is %s", ErrAuthorizationClosed, status)
+	}
+	held := money.New(razorpayInt(authorized["amount"]), razorpayString(authorized["currency"]))
+
+	amount := request.Amount
+	if !amount.IsPositive() {
+		amount = held
+	}
+	excess, err := held.Sub(amount)
+	if err != nil {
+		return nil, err
+	}
+	if excess.IsNegative() {
+		return nil, fmt.Errorf("capture of %s exceeds the authorized %s", amount.String(), held.String())
+	}
+
+	captured, err := r.client.Payment.Capture(request.AuthorizationID, int(held.Amount), map[string]interface{}{
+		"currency": held.Currency,
+	}, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to capture payment: %w", err)
+	}
+
+	if excess.IsPositive() {
+		if _, err := r.client.Payment.Refund(request.AuthorizationID, int(excess.Amount), map[string]interface{}{
+			"amount": excess.Amount,
+			"notes": map[string]interface{}{
+				"reason": "uncaptured part of authorization",
+			},
+		}, nil); err != nil {
+			return nil, fmt.Errorf("failed to refund uncaptured amount: %w", err)
+		}
+	}
+
 	return &PaymentResponse{
-		TransactionID: order["id"].(string),
-		Status:        "created",
-		Amount:        float64(order["amount"].(int)) / 100,
-		Currency:      order["currency"].(string),
-		CreatedAt:     int64(order["created_at"].(int)),
+		TransactionID: razorpayString(captured["id"]), // refunds are made against the payment
+		Status:        razorpayString(captured["status"]),
+		Amount:        amount,
+		Fees:          money.New(razorpayInt(captured["fee"]), razorpayString(captured["currency"])),
+		CreatedAt:     razorpayInt(captured["created_at"]),
+	}, nil
+}
+
+// Void cannot release a Razorpay authorization: there is no API for it.
+// Uncaptured payments lapse and are refunded to the payer automatically, so
+// the hold is reported as still authorized for the caller to stop tracking.
+func (r *RazorpayProvider) Void(ctx context.Context, authorizationID string) (*AuthorizationResponse, error) {
+	authorized, err := r.client.Payment.Fetch(authorizationID, nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch payment: %w", err)
+	}
+
+	return &AuthorizationResponse{
+		AuthorizationID: authorizationID,
+		Status:          razorpayString(authorized["status"]),
+		Amount:          money.New(razorpayInt(authorized["amount"]), razorpayString(authorized["currency"])),
+		CreatedAt:       razorpayInt(authorized["created_at"]),
 	}, nil
 }
 
+func (r *RazorpayProvider) IncrementAuthorization(ctx context.Context, request *IncrementAuthorizationRequest) (*AuthorizationResponse, error) {
+	return nil, ErrIncrementNotSupported
+}
+
 func (r *RazorpayProvider) RefundPayment(ctx context.Context, request *RefundRequest) (*RefundResponse, error) {
 	refundData := map[string]interface{}{
-		"amount": int(request.Amount * 100),
+		"amount": request.Amount.Amount,
 		"notes": map[string]interface{}{
-			"reason": request.Reason,
+			"reason":          request.Reason,
+			"idempotency_key": request.IdempotencyKey,
 		},
 	}
 
-	amount := int(request.Amount * 100)
+	amount := int(request.Amount.Amount)
 	refund, err := r.client.Payment.Refund(request.TransactionID, amount, refundData, map[string]string{})
 	if err != nil {
 		return nil, fmt.Errorf("failed to create refund: %w", err)
@@ -68,8 +253,7 @@ func (r *RazorpayProvider) RefundPayment(ctx context.Context, request *RefundReq
 	return &RefundResponse{
 		RefundID:  refund["id"].(string),
 		Status:    refund["status"].(string),
-		Amount:    float64(refund["amount"].(int)) / 100,
-		Currency:  refund["currency"].(string),
+		Amount:    money.New(int64(refund["amount"].(int)), refund["currency"].(string)),
 		CreatedAt: int64(refund["created_at"].(int)),
 	}, nil
 }
@@ -88,25 +272,103 @@ func (r *RazorpayProvider) GetPaymentMethod(ctx context.Context, paymentMethodID
 	return nil, fmt.Errorf("GetPaymentMethod not implemented for Razorpay")
 }
 
-func (r *RazorpayProvider) ValidateWebhook(ctx context.Context, payload []byte, signature string) (*WebhookEvent, error) {
+func (r *RazorpayProvider) ValidateWebhook(ctx context.Context, payload []byte, header http.Header) (*WebhookEvent, error) {
 	// Verify webhook signature
 	expectedSignature := r.generateSignature(string(payload))
-	if !hmac.Equal([]byte(signature), []byte(expectedSignature)) {
+	if !hmac.Equal([]byte(header.Get("X-Razorpay-Signature")), []byte(expectedSignature)) {
 		return nil, fmt.Errorf("invalid webhook signature")
 	}
 
-	var event map[string]interface{}
-	err := json.Unmarshal(payload, &event)
+	event, err := r.ParseWebhook(payload)
 	if err != nil {
+		return nil, err
+	}
+	if eventID := header.Get("X-Razorpay-Event-Id"); eventID != "" {
+		event.EventID = eventID
+	}
+
+	return event, nil
+}
+
+// ParseWebhook reads captured and failed payments, processed refunds and new
+// disputes. Razorpay sends the event ID only as a header, so an event parsed
+// from its payload alone is identified by a hash of the payload.
+func (r *RazorpayProvider) ParseWebhook(payload []byte) (*WebhookEvent, error) {
+	var event map[string]interface{}
+	if err := json.Unmarshal(payload, &event); err != nil {
 		return nil, fmt.Errorf("failed to unmarshal webhook payload: %w", err)
 	}
 
-	return &WebhookEvent{
-		EventID:   event["id"].(string),
-		EventType: event["event"].(string),
+	sum := sha256.Sum256(payload)
+	result := &WebhookEvent{
+		EventID:   "evt_" + hex.EncodeToString(sum[:16]),
+		EventType: razorpayString(event["event"]),
 		Data:      event,
-		CreatedAt: time.Now().Unix(),
-	}, nil
+		CreatedAt: razorpayInt(event["created_at"]),
+	}
+
+	// Payments are stored under their order, or under the payment itself
+	// when captured from a hold
+	p := webhookObject(event, "payload", "payment", "entity")
+	switch result.EventType {
+	case "payment.captured", "payment.failed":
+		result.Action = WebhookActionPaymentSucceeded
+		if result.EventType == "payment.failed" {
+			result.Action = WebhookActionPaymentFailed
+			result.Reason = razorpayString(p["error_description"])
+		}
+		result.TransactionIDs = webhookIDs(razorpayString(p["order_id"]), razorpayString(p["id"]))
+		result.Amount = money.New(razorpayInt(p["amount"]), razorpayString(p["currency"]))
+	case "refund.processed":
+		refund := webhookObject(event, "payload", "refund", "entity")
+		result.Action = WebhookActionPaymentRefunded
+		result.TransactionIDs = webhookIDs(razorpayString(p["order_id"]), razorpayString(refund["payment_id"]))
+		result.ObjectID = razorpayString(refund["id"])
+		result.Amount = money.New(razorpayInt(p["amount_refunded"]), razorpayString(p["currency"]))
+	case "payment.dispute.created":
+		dispute := webhookObject(event, "payload", "dispute", "entity")
+		result.Action = WebhookActionDisputeOpened
+		result.TransactionIDs = webhookIDs(razorpayString(p["order_id"]), razorpayString(dispute["payment_id"]))
+		result.ObjectID = razorpayString(dispute["id"])
+		result.Amount = money.New(razorpayInt(dispute["amount"]), razorpayString(dispute["currency"]))
+		result.Reason = razorpayString(dispute["reason_code"])
+	}
+
+	return result, nil
+}
+
+// convertRazorpayOrder reports an order as a payment: it is paid once a
+// payment against it has been captured.
+func convertRazorpayOrder(order map[string]interface{}) *PaymentResponse {
+	return &PaymentResponse{
+		TransactionID: razorpayString(order["id"]),
+		Status:        razorpayString(order["status"]),
+		Amount:        money.New(razorpayInt(order["amount"]), razorpayString(order["currency"])),
+		CreatedAt:     razorpayInt(order["created_at"]),
+	}
+}
+
+// razorpayString and razorpayInt read fields of a decoded Razorpay response,
+// which carries numbers as float64 and omits fields it has no value for.
+func razorpayString(value interface{}) string {
+	s, _ := value.(string)
+	return s
+}
+
+func razorpayInt(value interface{}) int64 {
+	switch v := value.(type) {
+	case float64:
+		return int64(v)
+	case int:
+		return int64(v)
+	case int64:
+		return v
+	case json.Number:
+		n, _ := v.Int64()
+		return n
+	default:
+		return 0
+	}
 }
 
 func (r *RazorpayProvider) generateSignature(payload string) string {
@@ -0,0 +1,211 @@
+package payment
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+
+	rzperrors "github.com/razorpay/razorpay-go/errors"
+	"github.com/stripe/stripe-go/v76"
+)
+
+// ProviderError is an error response from a provider's HTTP API.
+type ProviderError struct {
+	Provider   string
+	StatusCode int
+	Body       string
+}
+
+func (e *ProviderError) Error() string {
+	return fmt.Sprintf("%s API error (%d): %s", e.Provider, e.StatusCode, e.Body)
+}
+
+// IsTransient reports whether a provider call failed in a way that may
+// succeed when repeated: the network failed, the provider timed out, was
+// overloaded or rate limited us. Declines and invalid requests are final.
+func IsTransient(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	if errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) {
+		return true
+	}
+
+	var stripeErr *stripe.Error
+	if errors.As(err, &stripeErr) {
+		return retryableStatus(stripeErr.HTTPStatusCode) || stripeErr.Type == stripe.ErrorTypeAPI
+	}
+
+	var providerErr *ProviderError
+	if errors.As(err, &providerErr) {
+		return retryableStatus(providerErr.StatusCode)
+	}
+
+	var serverErr *rzperrors.ServerError
+	var gatewayErr *rzperrors.GatewayError
+	return errors.As(err, &serverErr) || errors.As(err, &gatewayErr)
+}
+
+func retryableStatus(status int) bool {
+	return status == http.StatusTooManyRequests || status >= http.StatusInternalServerError
+}
+
+// RetryPolicy bounds how often and how patiently a transient failure is
+// retried.
+type RetryPolicy struct {
+	MaxAttempts int           // including the first
+	BaseDelay   time.Duration // before the first retry, doubled for each one after
+	MaxDelay    time.Duration
+}
+
+// Backoff is the wait before the given retry: exponential in the retry
+// number, capped, with full jitter so callers retrying together spread out.
+func (p RetryPolicy) Backoff(retry int) time.Duration {
+	delay := p.BaseDelay
+	for i := 1; i < retry && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+	if p.MaxDelay > 0 && delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	if delay <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(delay) + 1))
+}
+
+// Retry calls fn until it succeeds, fails for good or the attempts run out,
+// and returns its last error.
+func Retry(ctx context.Context, policy RetryPolicy, fn func() error) error {
+	var err error
+	for attempt := 1; ; attempt++ {
+		if err = fn(); err == nil || !IsTransient(err) || attempt >= policy.MaxAttempts {
+			return err
+		}
+
+		timer := time.NewTimer(policy.Backoff(attempt))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+}
+
+// RetryingProvider retries transient failures of another provider. Charges
+// and refunds are only retried when they carry an idempotency key, since a
+// retry without one could pay twice.
+type RetryingProvider struct {
+	provider PaymentProvider
+	policy   RetryPolicy
+}
+
+func NewRetryingProvider(provider PaymentProvider, policy RetryPolicy) *RetryingProvider {
+	return &RetryingProvider{
+		provider: provider,
+		policy:   policy,
+	}
+}
+
+func (r *RetryingProvider) ProcessPayment(ctx context.Context, request *PaymentRequest) (response *PaymentResponse, err error) {
+	err = r.retry(ctx, request.IdempotencyKey != "", func() error {
+		response, err = r.provider.ProcessPayment(ctx, request)
+		return err
+	})
+	return response, err
+}
+
+func (r *RetryingProvider) GetPayment(ctx context.Context, request *PaymentLookupRequest) (response *PaymentResponse, err error) {
+	err = r.retry(ctx, true, func() error {
+		response, err = r.provider.GetPayment(ctx, request)
+		return err
+	})
+	return response, err
+}
+
+func (r *RetryingProvider) Authorize(ctx context.Context, request *PaymentRequest) (response *AuthorizationResponse, err error) {
+	err = r.retry(ctx, request.IdempotencyKey != "", func() error {
+		response, err = r.provider.Authorize(ctx, request)
+		return err
+	})
+	return response, err
+}
+
+// Capture is retried: a repeated capture is refused by the provider rather
+// than taken twice.
+func (r *RetryingProvider) Capture(ctx context.Context, request *CaptureRequest) (response *PaymentResponse, err error) {
+	err = r.retry(ctx, true, func() error {
+		response, err = r.provider.Capture(ctx, request)
+		return err
+	})
+	return response, err
+}
+
+func (r *RetryingProvider) Void(ctx context.Context, authorizationID string) (response *AuthorizationResponse, err error) {
+	err = r.retry(ctx, true, func() error {
+		response, err = r.provider.Void(ctx, authorizationID)
+		return err
+	})
+	return response, err
+}
+
+func (r *RetryingProvider) IncrementAuthorization(ctx context.Context, request *IncrementAuthorizationRequest) (response *AuthorizationResponse, err error) {
+	err = r.retry(ctx, true, func() error {
+		response, err = r.provider.IncrementAuthorization(ctx, request)
+		return err
+	})
+	return response, err
+}
+
+func (r *RetryingProvider) RefundPayment(ctx context.Context, request *RefundRequest) (response *RefundResponse, err error) {
+	err = r.retry(ctx, request.IdempotencyKey != "", func() error {
+		response, err = r.provider.RefundPayment(ctx, request)
+		return err
+	})
+	return response, err
+}
+
+func (r *RetryingProvider) CreatePaymentMethod(ctx context.Context, request *PaymentMethodRequest) (*PaymentMethodResponse, error) {
+	return r.provider.CreatePaymentMethod(ctx, request)
+}
+
+func (r *RetryingProvider) DeletePaymentMethod(ctx context.Context, paymentMethodID string) error {
+	return r.retry(ctx, true, func() error {
+		return r.provider.DeletePaymentMethod(ctx, paymentMethodID)
+	})
+}
+
+func (r *RetryingProvider) GetPaymentMethod(ctx context.Context, paymentMethodID string) (response *PaymentMethodResponse, err error) {
+	err = r.retry(ctx, true, func() error {
+		response, err = r.provider.GetPaymentMethod(ctx, paymentMethodID)
+		return err
+	})
+	return response, err
+}
+
+func (r *RetryingProvider) ValidateWebhook(ctx context.Context, payload []byte, header http.Header) (*WebhookEvent, error) {
+	return r.provider.ValidateWebhook(ctx, payload, header)
+}
+
+func (r *RetryingProvider) ParseWebhook(payload []byte) (*WebhookEvent, error) {
+	return r.provider.ParseWebhook(payload)
+}
+
+func (r *RetryingProvider) retry(ctx context.Context, safe bool, fn func() error) error {
+	if !safe {
+		return fn()
+	}
+	return Retry(ctx, r.policy, fn)
+}
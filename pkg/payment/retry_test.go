@@ -0,0 +1,157 @@
+package payment
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"goride/pkg/money"
+)
+
+// scriptedProvider answers charges and refunds with errs in turn, then
+// succeeds, and keeps the idempotency key of every call.
+type scriptedProvider struct {
+	PaymentProvider
+	errs []error
+	keys []string
+}
+
+func (p *scriptedProvider) next(key string) error {
+	p.keys = append(p.keys, key)
+	if len(p.keys) <= len(p.errs) {
+		return p.errs[len(p.keys)-1]
+	}
+	return nil
+}
+
+func (p *scriptedProvider) ProcessPayment(ctx context.Context, request *PaymentRequest) (*PaymentResponse, error) {
+	if err := p.next(request.IdempotencyKey); err != nil {
+		return nil, err
+	}
+	return &PaymentResponse{TransactionID: "txn_1", Status: "succeeded", Amount: request.Amount}, nil
+}
+
+func (p *scriptedProvider) RefundPayment(ctx context.Context, request *RefundRequest) (*RefundResponse, error) {
+	if err := p.next(request.IdempotencyKey); err != nil {
+		return nil, err
+	}
+	return &RefundResponse{}, nil
+}
+
+func TestRetryingProvider(t *testing.T) {
+	unavailable := &ProviderError{Provider: "test", StatusCode: 503, Body: "unavailable"}
+	rateLimited := &ProviderError{Provider: "test", StatusCode: 429, Body: "slow down"}
+	declined := &ProviderError{Provider: "test", StatusCode: 402, Body: "card declined"}
+	policy := RetryPolicy{MaxAttempts: 3}
+
+	tests := []struct {
+		name      string
+		refund    bool
+		key       string
+		errs      []error
+		wantCalls int
+		wantErr   error
+	}{
+		{
+			name:      "success is not retried",
+			key:       "ride:ride:1",
+			wantCalls: 1,
+		},
+		{
+			name:      "transient errors are retried with the same key",
+			key:       "ride:ride:1",
+			errs:      []error{unavailable, rateLimited},
+			wantCalls: 3,
+		},
+		{
+			name:      "retries stop after the last attempt",
+			key:       "ride:ride:1",
+			errs:      []error{unavailable, unavailable, unavailable, unavailable},
+			wantCalls: 3,
+			wantErr:   unavailable,
+		},
+		{
+			name:      "decline is not retried",
+			key:       "ride:ride:1",
+			errs:      []error{declined},
+			wantCalls: 1,
+			wantErr:   declined,
+		},
+		{
+			name:      "charge without a key is not retried",
+			errs:      []error{unavailable},
+			wantCalls: 1,
+			wantErr:   unavailable,
+		},
+		{
+			name:      "refund with a key is retried",
+			refund:    true,
+			key:       "payment:refund:500",
+			errs:      []error{unavailable},
+			wantCalls: 2,
+		},
+		{
+			name:      "refund without a key is not retried",
+			refund:    true,
+			errs:      []error{unavailable},
+			wantCalls: 1,
+			wantErr:   unavailable,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scripted := &scriptedProvider{errs: tt.errs}
+			provider := NewRetryingProvider(scripted, policy)
+
+			var err error
+			if tt.refund {
+				_, err = provider.RefundPayment(context.Background(), &RefundRequest{
+					TransactionID:  "txn_1",
+					Amount:         money.New(500, "USD"),
+					IdempotencyKey: tt.key,
+				})
+			} else {
+				_, err = provider.ProcessPayment(context.Background(), &PaymentRequest{
+					Amount:         money.New(2000, "USD"),
+					IdempotencyKey: tt.key,
+				})
+			}
+
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("error = %v, want %v", err, tt.wantErr)
+			}
+			if len(scripted.keys) != tt.wantCalls {
+				t.Errorf("provider called %d times, want %d", len(scripted.keys), tt.wantCalls)
+			}
+			for i, key := range scripted.keys {
+				if key != tt.key {
+					t.Errorf("call %d sent key %q, want %q", i+1, key, tt.key)
+				}
+			}
+		})
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	policy := RetryPolicy{BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+
+	tests := []struct {
+		retry   int
+		wantMax time.Duration
+	}{
+		{retry: 1, wantMax: 100 * time.Millisecond},
+		{retry: 2, wantMax: 200 * time.Millisecond},
+		{retry: 4, wantMax: 800 * time.Millisecond},
+		{retry: 10, wantMax: time.Second},
+	}
+
+	for _, tt := range tests {
+		for i := 0; i < 50; i++ {
+			if delay := policy.Backoff(tt.retry); delay < 0 || delay > tt.wantMax {
+				t.Fatalf("Backoff(%d) = %s, want between 0 and %s", tt.retry, delay, tt.wantMax)
+			}
+		}
+	}
+}
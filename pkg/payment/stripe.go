@@ -3,7 +3,12 @@ package payment
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"net/http"
+	"strings"
+
+	"goride/pkg/money"
 
 	"github.com/stripe/stripe-go/v76"
 	"github.com/stripe/stripe-go/v76/client"
@@ -27,8 +32,8 @@ func NewStripeProvider(secretKey, webhookSecret string) *StripeProvider {
 
 func (s *StripeProvider) ProcessPayment(ctx context.Context, request *PaymentRequest) (*PaymentResponse, error) {
 	params := &stripe.PaymentIntentParams{
-		Amount:             stripe.Int64(int64(request.Amount * 100)), // Convert to cents
-		Currency:           stripe.String(request.Currency),
+		Amount:             stripe.Int64(request.Amount.Amount), // Stripe takes minor units
+		Currency:           stripe.String(strings.ToLower(request.Amount.Currency)),
 		PaymentMethod:      stripe.String(request.PaymentMethodID),
 		Customer:           stripe.String(request.CustomerID),
 		Description:        stripe.String(request.Description),
@@ -42,21 +47,124 @@ func (s *StripeProvider) ProcessPayment(ctx context.Context, request *PaymentReq
 			params.AddMetadata(key, fmt.Sprintf("%v", value))
 		}
 	}
+	setStripeIdempotencyKey(params, request.IdempotencyKey)
 
 	pi, err := s.client.PaymentIntents.New(params)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create payment intent: %w", err)
 	}
 
-	return &PaymentResponse{
-		TransactionID: pi.ID,
-		Status:        string(pi.Status),
-		Amount:        float64(pi.Amount) / 100,
-		Currency:      string(pi.Currency),
-		Fees:          float64(pi.ApplicationFeeAmount) / 100,
-		CreatedAt:     pi.Created,
-		Metadata:      convertStripeMetadata(pi.Metadata),
-	}, nil
+	return convertStripePayment(pi), nil
+}
+
+// GetPayment looks a payment intent up by ID, or searches for the one
+// created with the idempotency key, which is kept in its metadata.
+func (s *StripeProvider) GetPayment(ctx context.Context, request *PaymentLookupRequest) (*PaymentResponse, error) {
+	if request.AuthorizationID != "" {
+		pi, err := s.client.PaymentIntents.Get(request.AuthorizationID, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get payment intent: %w", err)
+		}
+		return convertStripeCapture(pi), nil
+	}
+
+	if request.TransactionID != "" {
+		pi, err := s.client.PaymentIntents.Get(request.TransactionID, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get payment intent: %w", err)
+		}
+		return convertStripePayment(pi), nil
+	}
+
+	if request.IdempotencyKey == "" {
+		return nil, fmt.Errorf("transaction ID or idempotency key is required")
+	}
+
+	iter := s.client.PaymentIntents.Search(&stripe.PaymentIntentSearchParams{
+		SearchParams: stripe.SearchParams{
+			Query: fmt.Sprintf("metadata['idempotency_key']:'%s'", request.IdempotencyKey),
+			Limit: stripe.Int64(1),
+		},
+	})
+	if iter.Next() {
+		return convertStripePayment(iter.PaymentIntent()), nil
+	}
+	if err := iter.Err(); err != nil {
+		return nil, fmt.Errorf("failed to search payment intents: %w", err)
+	}
+
+	return nil, ErrPaymentNotFound
+}
+
+// Authorize confirms a payment intent with manual capture, so the card is
+// held but not charged. Incremental authorization is requested where the card
+// network supports it.
+func (s *StripeProvider) Authorize(ctx context.Context, request *PaymentRequest) (*AuthorizationResponse, error) {
+	params := &stripe.PaymentIntentParams{
+		Amount:        stripe.Int64(request.Amount.Amount),
+		Currency:      stripe.String(strings.ToLower(request.Amount.Currency)),
+		PaymentMethod: stripe.String(request.PaymentMethodID),
+		Customer:      stripe.String(request.CustomerID),
+		Description:   stripe.String(request.Description),
+		CaptureMethod: stripe.String(string(stripe.PaymentIntentCaptureMethodManual)),
+		Confirm:       stripe.Bool(true),
+		PaymentMethodOptions: &stripe.PaymentIntentPaymentMethodOptionsParams{
+			Card: &stripe.PaymentIntentPaymentMethodOptionsCardParams{
+				RequestIncrementalAuthorization: stripe.String(string(stripe.PaymentIntentPaymentMethodOptionsCardRequestIncrementalAuthorizationIfAvailable)),
+			},
+		},
+	}
+
+	for key, value := range request.Metadata {
+		params.AddMetadata(key, fmt.Sprintf("%v", value))
+	}
+	setStripeIdempotencyKey(params, request.IdempotencyKey)
+
+	pi, err := s.client.PaymentIntents.New(params)
+	if err != nil {
+		return nil, fmt.Errorf("failed to authorize payment intent: %w", err)
+	}
+
+	return convertStripeAuthorization(pi), nil
+}
+
+func (s *StripeProvider) Capture(ctx context.Context, request *CaptureRequest) (*PaymentResponse, error) {
+	params := &stripe.PaymentIntentCaptureParams{}
+	if request.Amount.IsPositive() {
+		params.AmountToCapture = stripe.Int64(request.Amount.Amount)
+	}
+
+	pi, err := s.client.PaymentIntents.Capture(request.AuthorizationID, params)
+	if err != nil {
+		// Stripe refuses to capture an intent that is no longer awaiting capture
+		var stripeErr *stripe.Error
+		if errors.As(err, &stripeErr) && stripeErr.Code == stripe.ErrorCodePaymentIntentUnexpectedState {
+			return nil, fmt.Errorf("failed to capture payment intent: %w: %v", ErrAuthorizationClosed, err)
+		}
+		return nil, fmt.Errorf("failed to capture payment intent: %w", err)
+	}
+
+	return convertStripeCapture(pi), nil
+}
+
+func (s *StripeProvider) Void(ctx context.Context, authorizationID string) (*AuthorizationResponse, error) {
+	pi, err := s.client.PaymentIntents.Cancel(authorizationID, &stripe.PaymentIntentCancelParams{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to cancel payment intent: %w", err)
+	}
+
+	return convertStripeAuthorization(pi), nil
+}
+
+func (s *StripeProvider) IncrementAuthorization(ctx context.Context, request *IncrementAuthorizationRequest) (*AuthorizationResponse, error) {
+	pi, err := s.client.PaymentIntents.IncrementAuthorization(request.AuthorizationID, &stripe.PaymentIntentIncrementAuthorizationParams{
+		Amount: stripe.Int64(request.Amount.Amount),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to increment authorization: %w", err)
+	}
+
+	return convertStripeAuthorization(pi), nil
 }
 
 func (s *StripeProvider) RefundPayment(ctx context.Context, request *RefundRequest) (*RefundResponse, error) {
@@ -65,8 +173,11 @@ func (s *StripeProvider) RefundPayment(ctx context.Context, request *RefundReque
 		Reason:        stripe.String(request.Reason),
 	}
 
-	if request.Amount > 0 {
-		params.Amount = stripe.Int64(int64(request.Amount * 100))
+	if request.Amount.IsPositive() {
+		params.Amount = stripe.Int64(request.Amount.Amount)
+	}
+	if request.IdempotencyKey != "" {
+		params.SetIdempotencyKey(request.IdempotencyKey)
 	}
 
 	refund, err := s.client.Refunds.New(params)
@@ -77,8 +188,7 @@ func (s *StripeProvider) RefundPayment(ctx context.Context, request *RefundReque
 	return &RefundResponse{
 		RefundID:  refund.ID,
 		Status:    string(refund.Status),
-		Amount:    float64(refund.Amount) / 100,
-		Currency:  string(refund.Currency),
+		Amount:    money.New(refund.Amount, string(refund.Currency)),
 		CreatedAt: refund.Created,
 	}, nil
 }
@@ -150,26 +260,111 @@ func (s *StripeProvider) GetPaymentMethod(ctx context.Context, paymentMethodID s
 	}, nil
 }
 
-func (s *StripeProvider) ValidateWebhook(ctx context.Context, payload []byte, signature string) (*WebhookEvent, error) {
-	event, err := webhook.ConstructEvent(payload, signature, s.webhookSecret)
-	if err != nil {
+func (s *StripeProvider) ValidateWebhook(ctx context.Context, payload []byte, header http.Header) (*WebhookEvent, error) {
+	if _, err := webhook.ConstructEvent(payload, header.Get("Stripe-Signature"), s.webhookSecret); err != nil {
 		return nil, fmt.Errorf("failed to verify webhook signature: %w", err)
 	}
 
+	return s.ParseWebhook(payload)
+}
+
+// ParseWebhook reads payment intent outcomes, refunds and disputes. Refund
+// and dispute events are about a charge, which belongs to the payment intent
+// we store as the transaction.
+func (s *StripeProvider) ParseWebhook(payload []byte) (*WebhookEvent, error) {
+	var event stripe.Event
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal webhook payload: %w", err)
+	}
+	if event.Data == nil {
+		return nil, fmt.Errorf("webhook event %s has no data", event.ID)
+	}
+
 	data := make(map[string]interface{})
 	if err := json.Unmarshal(event.Data.Raw, &data); err != nil {
 		return nil, fmt.Errorf("failed to unmarshal event data: %w", err)
 	}
 
-	return &WebhookEvent{
+	result := &WebhookEvent{
 		EventID:   event.ID,
 		EventType: string(event.Type),
 		Data:      data,
 		CreatedAt: event.Created,
-	}, nil
+	}
+
+	switch event.Type {
+	case stripe.EventTypePaymentIntentSucceeded, stripe.EventTypePaymentIntentPaymentFailed:
+		var pi stripe.PaymentIntent
+		if err := json.Unmarshal(event.Data.Raw, &pi); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal payment intent: %w", err)
+		}
+		result.Action = WebhookActionPaymentSucceeded
+		if event.Type == stripe.EventTypePaymentIntentPaymentFailed {
+			result.Action = WebhookActionPaymentFailed
+			if pi.LastPaymentError != nil {
+				result.Reason = pi.LastPaymentError.Msg
+			}
+		}
+		result.TransactionIDs = webhookIDs(pi.ID)
+		result.IdempotencyKey = pi.Metadata["idempotency_key"]
+		result.Amount = money.New(pi.Amount, string(pi.Currency))
+	case stripe.EventTypeChargeRefunded:
+		var charge stripe.Charge
+		if err := json.Unmarshal(event.Data.Raw, &charge); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal charge: %w", err)
+		}
+		result.Action = WebhookActionPaymentRefunded
+		result.TransactionIDs = webhookIDs(stripePaymentIntentID(charge.PaymentIntent), charge.ID)
+		result.Amount = money.New(charge.AmountRefunded, string(charge.Currency))
+	case stripe.EventTypeChargeDisputeCreated:
+		var dispute stripe.Dispute
+		if err := json.Unmarshal(event.Data.Raw, &dispute); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal dispute: %w", err)
+		}
+		chargeID := ""
+		if dispute.Charge != nil {
+			chargeID = dispute.Charge.ID
+		}
+		result.Action = WebhookActionDisputeOpened
+		result.TransactionIDs = webhookIDs(stripePaymentIntentID(dispute.PaymentIntent), chargeID)
+		result.ObjectID = dispute.ID
+		result.Amount = money.New(dispute.Amount, string(dispute.Currency))
+		result.Reason = string(dispute.Reason)
+	}
+
+	return result, nil
 }
 
 // Helper functions
+
+// setStripeIdempotencyKey sends the key with the request and keeps it in the
+// metadata, where GetPayment searches for it.
+func setStripeIdempotencyKey(params *stripe.PaymentIntentParams, key string) {
+	if key == "" {
+		return
+	}
+	params.SetIdempotencyKey(key)
+	params.AddMetadata("idempotency_key", key)
+}
+
+func convertStripePayment(pi *stripe.PaymentIntent) *PaymentResponse {
+	return &PaymentResponse{
+		TransactionID: pi.ID,
+		Status:        string(pi.Status),
+		Amount:        money.New(pi.Amount, string(pi.Currency)),
+		Fees:          money.New(pi.ApplicationFeeAmount, string(pi.Currency)),
+		CreatedAt:     pi.Created,
+		Metadata:      convertStripeMetadata(pi.Metadata),
+	}
+}
+
+func stripePaymentIntentID(pi *stripe.PaymentIntent) string {
+	if pi == nil {
+		return ""
+	}
+	return pi.ID
+}
+
 func convertStripeMetadata(metadata map[string]string) map[string]interface{} {
 	result := make(map[string]interface{})
 	for key, value := range metadata {
@@ -178,6 +373,43 @@ func convertStripeMetadata(metadata map[string]string) map[string]interface{} {
 	return result
 }
 
+// convertStripeCapture reports a captured intent as the payment, and one
+// cancelled before capture as a voided hold.
+func convertStripeCapture(pi *stripe.PaymentIntent) *PaymentResponse {
+	status := string(pi.Status)
+	if pi.Status == stripe.PaymentIntentStatusCanceled {
+		status = AuthorizationStatusVoided
+	}
+
+	return &PaymentResponse{
+		TransactionID: pi.ID, // refunds are made against the payment intent
+		Status:        status,
+		Amount:        money.New(pi.AmountReceived, string(pi.Currency)),
+		Fees:          money.New(pi.ApplicationFeeAmount, string(pi.Currency)),
+		CreatedAt:     pi.Created,
+		Metadata:      convertStripeMetadata(pi.Metadata),
+	}
+}
+
+func convertStripeAuthorization(pi *stripe.PaymentIntent) *AuthorizationResponse {
+	status := AuthorizationStatusFailed
+	switch pi.Status {
+	case stripe.PaymentIntentStatusRequiresCapture:
+		status = AuthorizationStatusAuthorized
+	case stripe.PaymentIntentStatusSucceeded:
+		status = AuthorizationStatusCaptured
+	case stripe.PaymentIntentStatusCanceled:
+		status = AuthorizationStatusVoided
+	}
+
+	return &AuthorizationResponse{
+		AuthorizationID: pi.ID,
+		Status:          status,
+		Amount:          money.New(pi.AmountCapturable, string(pi.Currency)),
+		CreatedAt:       pi.Created,
+	}
+}
+
 func convertStripeBillingAddress(details *stripe.PaymentMethodBillingDetails) *BillingAddress {
 	if details == nil || details.Address == nil {
 		return nil
@@ -0,0 +1,36 @@
+package payment
+
+// webhookField reads a nested field of a decoded webhook payload. It returns
+// nil when any part of the path is missing.
+func webhookField(data map[string]interface{}, path ...string) interface{} {
+	var value interface{} = data
+	for _, key := range path {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		value = object[key]
+	}
+	return value
+}
+
+func webhookObject(data map[string]interface{}, path ...string) map[string]interface{} {
+	object, _ := webhookField(data, path...).(map[string]interface{})
+	return object
+}
+
+func webhookString(data map[string]interface{}, path ...string) string {
+	value, _ := webhookField(data, path...).(string)
+	return value
+}
+
+// webhookIDs lists the IDs an event has, leaving out the empty ones.
+func webhookIDs(ids ...string) []string {
+	result := make([]string, 0, len(ids))
+	for _, id := range ids {
+		if id != "" {
+			result = append(result, id)
+		}
+	}
+	return result
+}
@@ -82,6 +82,17 @@ func (h *Handler) SendUserNotification(userID primitive.ObjectID, notificationTy
 	h.hub.SendToUser(userID, message)
 }
 
+func (h *Handler) SendDriverBroadcast(messageType string, data map[string]interface{}) {
+	message := Message{
+		Type:      messageType,
+		RoomID:    "drivers",
+		Timestamp: getCurrentTimestamp(),
+		Data:      data,
+	}
+
+	h.hub.SendToDrivers(message)
+}
+
 func (h *Handler) GetHub() *Hub {
 	return h.hub
 }
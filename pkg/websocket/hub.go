@@ -172,6 +172,10 @@ func (h *Hub) SendRideUpdate(rideID primitive.ObjectID, message Message) {
 	h.sendToRoom(roomID, message)
 }
 
+func (h *Hub) SendToDrivers(message Message) {
+	h.sendToRoom("drivers", message)
+}
+
 func (h *Hub) SendLocationUpdate(driverID primitive.ObjectID, location map[string]interface{}) {
 	message := Message{
 		Type:      "location_update",
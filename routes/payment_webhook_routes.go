@@ -0,0 +1,26 @@
+package routes
+
+import (
+	shared "goride/internal/handlers/shared"
+	"goride/internal/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SetupPaymentWebhookRoutes sets up routes for payment provider webhooks
+func SetupPaymentWebhookRoutes(r *gin.RouterGroup, webhookHandler *shared.PaymentWebhookHandler) {
+	// Public webhook routes (verified by the provider's signature)
+	webhooks := r.Group("/webhooks/payments")
+	{
+		webhooks.POST("/:provider", webhookHandler.HandlePaymentWebhook)
+	}
+
+	// Admin routes for inspecting and replaying webhooks
+	admin := r.Group("/admin/payments/webhooks")
+	admin.Use(middleware.AuthRequired(), middleware.AdminRequired())
+	{
+		admin.GET("/", webhookHandler.GetWebhookEvents)
+		admin.GET("/:id", webhookHandler.GetWebhookEvent)
+		admin.POST("/:id/replay", webhookHandler.ReplayWebhookEvent)
+	}
+}